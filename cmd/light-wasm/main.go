@@ -0,0 +1,101 @@
+//go:build js && wasm
+
+// Command light-wasm exposes the light-lang toolchain to JavaScript when
+// compiled to WebAssembly, so it can back a browser playground.
+//
+// Build:
+//
+//	GOOS=js GOARCH=wasm go build -o light.wasm ./cmd/light-wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Once loaded, the module installs a global `lightlang` object:
+//
+//	lightlang.run(source) -> Promise<{output, diagnostics, error}>
+//
+// output is everything the program printed, diagnostics is a list of
+// {code, severity, message, line, column, offset} from the lexer and parser,
+// and error is the runtime error message (or null).
+package main
+
+import (
+	"bytes"
+	"light-lang/internal/diag"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/runtime"
+	"syscall/js"
+)
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("run", js.FuncOf(jsRun))
+	js.Global().Set("lightlang", api)
+
+	// Keep the Go runtime alive so the exported functions stay callable
+	select {}
+}
+
+// jsRun implements lightlang.run(source). Execution happens on a goroutine
+// and the result is delivered through a Promise, because timers sleep and
+// blocking inside a JS callback would deadlock the event loop.
+func jsRun(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return js.Global().Get("Promise").Call("reject", "lightlang.run expects a source string")
+	}
+	source := args[0].String()
+
+	handler := js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		resolve := p[0]
+		go func() {
+			resolve.Invoke(js.ValueOf(runSource(source)))
+		}()
+		return nil
+	})
+	promise := js.Global().Get("Promise").New(handler)
+	handler.Release()
+	return promise
+}
+
+// runSource tokenizes, parses and runs source, collecting the result for JS.
+func runSource(source string) map[string]interface{} {
+	result := map[string]interface{}{
+		"output":      "",
+		"diagnostics": []interface{}{},
+		"error":       nil,
+	}
+
+	tokens, lexDiags := lexer.New(source, "<playground>").Tokenize()
+	file, parseDiags := parser.New(tokens).ParseFile()
+	allDiags := append(lexDiags, parseDiags...)
+	if len(allDiags) > 0 {
+		result["diagnostics"] = diagsToJS(allDiags)
+		return result
+	}
+
+	var out bytes.Buffer
+	interp := runtime.NewInterpreter(&out)
+	err := interp.Run(file)
+	if err == nil {
+		err = interp.RunEventLoop()
+	}
+	result["output"] = out.String()
+	if err != nil {
+		result["error"] = err.Error()
+	}
+	return result
+}
+
+func diagsToJS(diags []diag.Diagnostic) []interface{} {
+	result := make([]interface{}, len(diags))
+	for i, d := range diags {
+		result[i] = map[string]interface{}{
+			"code":     d.Code,
+			"severity": d.Severity.String(),
+			"message":  d.Message,
+			"line":     d.Span.Start.Line,
+			"column":   d.Span.Start.Column,
+			"offset":   d.Span.Start.Offset,
+		}
+	}
+	return result
+}
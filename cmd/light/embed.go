@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ---- embed command ----
+
+var embedTemplate = template.Must(template.New("embed").Parse(`// Code generated by "light embed"; DO NOT EDIT.
+
+package main
+
+import (
+	"embed"
+	"log"
+
+	"light-lang/pkg/light"
+)
+
+//go:embed {{.Dir}}
+var scripts embed.FS
+
+func main() {
+	if err := light.RunEmbedded(scripts, {{printf "%q" .Entry}}); err != nil {
+		log.Fatal(err)
+	}
+}
+`))
+
+// cmdEmbed prints a Go main package that embeds the scripts in dir and runs
+// entry (a file inside dir) on startup. Run it from the Go package directory
+// that contains dir.
+func cmdEmbed(dir, entry string) {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir == "." || strings.HasPrefix(dir, "../") || path.IsAbs(dir) {
+		fmt.Fprintln(os.Stderr, "error: embed directory must be a subdirectory of the Go package")
+		os.Exit(1)
+	}
+	full := path.Join(dir, filepath.ToSlash(entry))
+	if _, err := os.Stat(filepath.FromSlash(full)); err != nil {
+		fmt.Fprintf(os.Stderr, "error: entry script %s not found\n", full)
+		os.Exit(1)
+	}
+	err := embedTemplate.Execute(os.Stdout, map[string]string{"Dir": dir, "Entry": full})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
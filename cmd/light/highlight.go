@@ -0,0 +1,170 @@
+package main
+
+import (
+	"light-lang/internal/lexer"
+	"light-lang/internal/token"
+	"strings"
+)
+
+// ---- REPL syntax highlighting ----
+
+const (
+	colorMagenta  = "\033[35m"
+	colorBgRed    = "\033[41m"
+	colorBoldBlue = "\033[1;34m"
+)
+
+// replPainter colorizes the line being edited using the lexer. It implements
+// readline.Painter. Closing brackets without a matching opener are
+// highlighted; braces left open by earlier lines of a multi-line input
+// (pending) may still be closed. Each keystroke relexes only the edited
+// part of the line.
+type replPainter struct {
+	pending int             // '{' opened by previous lines of the current input
+	snap    *lexer.Snapshot // tokens of the line as last painted
+}
+
+func (p *replPainter) Paint(line []rune, _ int) (out []rune) {
+	defer func() {
+		// A painter must never take down the REPL; start over next time
+		if recover() != nil {
+			p.snap = nil
+			out = line
+		}
+	}()
+
+	src := string(line)
+	if p.snap == nil {
+		p.snap = lexer.Scan(src, "<repl>")
+	} else if src != p.snap.Source {
+		p.snap = p.snap.Apply(diffEdit(p.snap.Source, src))
+	}
+	return []rune(highlight(src, p.snap.Tokens, p.pending))
+}
+
+// diffEdit describes the change from old to src as a single replacement of
+// the text between their common prefix and suffix.
+func diffEdit(old, src string) lexer.Edit {
+	start := 0
+	for start < len(old) && start < len(src) && old[start] == src[start] {
+		start++
+	}
+	oldEnd, newEnd := len(old), len(src)
+	for oldEnd > start && newEnd > start && old[oldEnd-1] == src[newEnd-1] {
+		oldEnd--
+		newEnd--
+	}
+	return lexer.Edit{Start: start, End: oldEnd, Text: src[start:newEnd]}
+}
+
+// highlight returns src, whose tokens are given, with ANSI colors applied.
+// Text between tokens (spaces and comments) is copied unchanged apart from
+// dimming comments.
+func highlight(src string, tokens []token.Token, pending int) (out string) {
+	defer func() {
+		// A painter must never take down the REPL
+		if recover() != nil {
+			out = src
+		}
+	}()
+
+	unbalanced := unbalancedBrackets(tokens, pending)
+
+	var b strings.Builder
+	pos := 0
+	for idx, tok := range tokens {
+		start, end := tok.Span.Start.Offset, tok.Span.End.Offset
+		if tok.Kind == token.EOF || start < pos || end > len(src) {
+			continue
+		}
+		writeGap(&b, src[pos:start])
+		text := src[start:end]
+		if color := tokenColor(tok.Kind); unbalanced[idx] {
+			b.WriteString(colorBgRed + text + colorReset)
+		} else if color != "" {
+			b.WriteString(color + text + colorReset)
+		} else {
+			b.WriteString(text)
+		}
+		pos = end
+	}
+	writeGap(&b, src[pos:])
+	return b.String()
+}
+
+// writeGap copies inter-token text, dimming from the first // or /* comment
+// on.
+func writeGap(b *strings.Builder, gap string) {
+	idx := strings.Index(gap, "//")
+	if block := strings.Index(gap, "/*"); block >= 0 && (idx < 0 || block < idx) {
+		idx = block
+	}
+	if idx >= 0 {
+		b.WriteString(gap[:idx] + colorGray + gap[idx:] + colorReset)
+		return
+	}
+	b.WriteString(gap)
+}
+
+func tokenColor(k token.Kind) string {
+	switch {
+	case k == token.KW_TRUE || k == token.KW_FALSE || k == token.KW_NULL:
+		return colorCyan
+	case k.IsKeyword():
+		return colorBoldBlue
+	case k == token.INT || k == token.FLOAT:
+		return colorYellow
+	case k == token.STRING || k == token.TEMPLATE_LITERAL || k == token.TEMPLATE_HEAD ||
+		k == token.TEMPLATE_MIDDLE || k == token.TEMPLATE_TAIL:
+		return colorGreen
+	case k == token.ILLEGAL:
+		return colorRed
+	default:
+		return ""
+	}
+}
+
+// unbalancedBrackets returns the indexes of closing brackets that have no
+// matching opener on the line.
+func unbalancedBrackets(tokens []token.Token, pending int) map[int]bool {
+	pairs := map[token.Kind]token.Kind{
+		token.RPAREN:   token.LPAREN,
+		token.RBRACKET: token.LBRACKET,
+		token.RBRACE:   token.LBRACE,
+	}
+	bad := map[int]bool{}
+	var stack []token.Kind
+	for idx, tok := range tokens {
+		switch tok.Kind {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			stack = append(stack, tok.Kind)
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if n := len(stack); n > 0 && stack[n-1] == pairs[tok.Kind] {
+				stack = stack[:n-1]
+			} else if n == 0 && tok.Kind == token.RBRACE && pending > 0 {
+				pending-- // closes a brace from an earlier line
+			} else {
+				bad[idx] = true
+			}
+		}
+	}
+	return bad
+}
+
+// openBraces counts the '{' left unclosed by src, ignoring braces inside
+// strings and templates.
+func openBraces(src string) int {
+	tokens, _ := lexer.New(src, "<repl>").Tokenize()
+	depth := 0
+	for _, tok := range tokens {
+		switch tok.Kind {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return depth
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"light-lang/internal/jupyter"
+	"os"
+)
+
+// ---- kernel command ----
+
+func cmdKernel() {
+	files := flagValues("--connection-file")
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "error: missing --connection-file")
+		os.Exit(1)
+	}
+	info, err := jupyter.ReadConnectionFile(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	k, err := jupyter.Start(info)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer k.Close()
+	if err := k.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"light-lang/internal/jsonrpc"
+	"light-lang/internal/lsp"
+	"os"
+)
+
+// ---- lsp command ----
+
+// cmdLSP serves the Language Server Protocol on stdio for editors.
+func cmdLSP() {
+	server := lsp.NewServer(jsonrpc.NewConn(os.Stdin, os.Stdout))
+	if err := server.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	os.Exit(server.ExitCode())
+}
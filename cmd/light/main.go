@@ -5,17 +5,56 @@
 //	light tokens <file>            Print tokens
 //	light tokens <file> --json     Print tokens as JSON
 //	light parse  <file>            Print AST as JSON
+//	light parse  <file> --binary   Write the binary AST encoding to stdout
+//	light parse  <file> --optimize Print the AST after constant folding
 //	light run    <file>            Run a source file
+//	light doc    <file> [name]     Print documentation for declarations
+//	light check  <file>            Report errors found without running
+//	light run    <file> --plugin ext.so
+//	                               Run with a native extension loaded
+//	light run    <file> --timeout 5s --max-steps N --max-depth N --max-heap N
+//	                               Run with execution limits
+//	light run    <file> --seed N   Run with reproducible random numbers
+//	light run    <file> --strict-index
+//	                               Run with missing map keys and properties as errors
+//	light run    <file> --strict-equality
+//	                               Run with == never treating an int and a float as equal
+//	light run    <file> --strict   Run with implicit conversions as errors
+//	light run    <file> --vm       Run compiled to bytecode on the stack VM
+//	                               (experimental: rejects classes, try/catch,
+//	                               match, imports and more it cannot compile yet)
+//	light run    <file> -- a b c   Run with script arguments, read by args()
+//	light get    <module>...       Download remote modules
+//	light get                      Resolve light.toml dependencies into light.lock
+//	light embed  <dir> [entry]     Print a Go host that embeds dir
 //	light repl                     Start interactive REPL
+//	light repl --load session.lt   Start the REPL with a saved session restored
+//	light serve-rpc [--tcp addr]   Serve JSON-RPC on stdio or TCP
+//	light kernel --connection-file <file>
+//	                               Run as a Jupyter kernel
+//	light lsp                      Serve the Language Server Protocol on stdio
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"light-lang/internal/analysis"
 	"light-lang/internal/ast"
+	"light-lang/internal/check"
+	"light-lang/internal/compiler"
+	"light-lang/internal/diag"
 	"light-lang/internal/lexer"
+	"light-lang/internal/modules"
+	"light-lang/internal/optimize"
 	"light-lang/internal/parser"
 	"light-lang/internal/runtime"
+	"light-lang/internal/vm"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -41,7 +80,7 @@ func main() {
 			os.Exit(1)
 		}
 		source := readFile(os.Args[2])
-		cmdParse(source, os.Args[2])
+		cmdParse(source, os.Args[2], hasFlag("--binary"), hasFlag("--optimize"))
 	case "run":
 		if len(os.Args) < 3 {
 			fmt.Fprintln(os.Stderr, "error: missing file argument")
@@ -49,8 +88,43 @@ func main() {
 		}
 		source := readFile(os.Args[2])
 		cmdRun(source, os.Args[2])
+	case "doc":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "error: missing file argument")
+			os.Exit(1)
+		}
+		source := readFile(os.Args[2])
+		name := ""
+		if len(os.Args) > 3 {
+			name = os.Args[3]
+		}
+		cmdDoc(source, os.Args[2], name)
+	case "check":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "error: missing file argument")
+			os.Exit(1)
+		}
+		cmdCheck(readFile(os.Args[2]), os.Args[2])
+	case "get":
+		cmdGet(os.Args[2:])
+	case "embed":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "error: missing script directory")
+			os.Exit(1)
+		}
+		entry := "main.lt"
+		if len(os.Args) > 3 {
+			entry = os.Args[3]
+		}
+		cmdEmbed(os.Args[2], entry)
 	case "repl":
 		cmdRepl()
+	case "serve-rpc":
+		cmdServeRPC()
+	case "kernel":
+		cmdKernel()
+	case "lsp":
+		cmdLSP()
 	default:
 		fmt.Fprintf(os.Stderr, "error: unknown command '%s'\n", command)
 		usage()
@@ -61,9 +135,32 @@ func main() {
 func usage() {
 	fmt.Fprintln(os.Stderr, "Usage:")
 	fmt.Fprintln(os.Stderr, "  light tokens <file> [--json]   Tokenize and print tokens")
-	fmt.Fprintln(os.Stderr, "  light parse  <file>            Parse and print AST (JSON)")
+	fmt.Fprintln(os.Stderr, "  light parse  <file> [--binary] Parse and print AST (JSON or binary)")
+	fmt.Fprintln(os.Stderr, "  light parse  <file> --optimize Print the AST after constant folding")
 	fmt.Fprintln(os.Stderr, "  light run    <file>            Run a source file")
+	fmt.Fprintln(os.Stderr, "    --plugin <ext.so>            Load a native extension (repeatable)")
+	fmt.Fprintln(os.Stderr, "    --allow-ffi                  Allow scripts to call C functions (ffiOpen/ffiFunc)")
+	fmt.Fprintln(os.Stderr, "    --timeout <duration>         Stop the script after this long (e.g. 5s)")
+	fmt.Fprintln(os.Stderr, "    --max-steps <n>              Stop the script after n statements")
+	fmt.Fprintln(os.Stderr, "    --max-depth <n>              Limit nested function calls to n")
+	fmt.Fprintln(os.Stderr, "    --max-heap <n>               Stop the script after it creates n arrays, maps, objects and elements")
+	fmt.Fprintln(os.Stderr, "    --seed <n>                   Seed random(), randomInt() and shuffle() for reproducible runs")
+	fmt.Fprintln(os.Stderr, "    --strict-index               Make reading a missing map key or property an error")
+	fmt.Fprintln(os.Stderr, "    --strict-equality            Make == and != never treat an int and a float as equal")
+	fmt.Fprintln(os.Stderr, "    --strict                     Make string + non-string, non-bool conditions and int/float comparisons errors")
+	fmt.Fprintln(os.Stderr, "    --vm                         Compile to bytecode and run it on the stack VM (experimental;")
+	fmt.Fprintln(os.Stderr, "                                 rejects classes, try/catch, match, imports and more it cannot compile yet)")
+	fmt.Fprintln(os.Stderr, "    -- <args>...                 Pass the remaining arguments to the script as args()")
+	fmt.Fprintln(os.Stderr, "  light doc    <file> [name]     Print signatures and doc comments of functions and classes")
+	fmt.Fprintln(os.Stderr, "  light check  <file>            Report undefined names, wrong arity and other errors without running")
+	fmt.Fprintln(os.Stderr, "  light get    <module>...       Download remote modules into the cache")
+	fmt.Fprintln(os.Stderr, "  light get                      Resolve light.toml dependencies and write light.lock")
+	fmt.Fprintln(os.Stderr, "  light embed  <dir> [entry]     Print a Go main that embeds and runs dir/entry")
 	fmt.Fprintln(os.Stderr, "  light repl                     Start interactive REPL")
+	fmt.Fprintln(os.Stderr, "    --load <file>                Restore a session saved with :save")
+	fmt.Fprintln(os.Stderr, "  light serve-rpc [--tcp addr]   Serve tokenize/parse/eval over JSON-RPC")
+	fmt.Fprintln(os.Stderr, "  light kernel --connection-file <file>  Run as a Jupyter kernel")
+	fmt.Fprintln(os.Stderr, "  light lsp                      Serve the Language Server Protocol on stdio")
 }
 
 func readFile(filename string) string {
@@ -75,8 +172,31 @@ func readFile(filename string) string {
 	return string(source)
 }
 
+// cliArgs returns os.Args from index from up to "--"; the arguments after
+// it belong to the script.
+func cliArgs(from int) []string {
+	if from > len(os.Args) {
+		return nil
+	}
+	args := os.Args[from:]
+	for idx, arg := range args {
+		if arg == "--" {
+			return args[:idx]
+		}
+	}
+	return args
+}
+
+// scriptArgs returns the arguments after "--", or nil if there is none.
+func scriptArgs() []string {
+	if n := len(cliArgs(3)); 3+n < len(os.Args) {
+		return os.Args[3+n+1:]
+	}
+	return nil
+}
+
 func hasFlag(flag string) bool {
-	for _, arg := range os.Args[3:] {
+	for _, arg := range cliArgs(3) {
 		if arg == flag {
 			return true
 		}
@@ -84,6 +204,28 @@ func hasFlag(flag string) bool {
 	return false
 }
 
+// flagValues returns every value given for a repeatable flag ("--flag value").
+func flagValues(flag string) []string {
+	var values []string
+	args := cliArgs(2)
+	for idx := 0; idx < len(args)-1; idx++ {
+		if args[idx] == flag {
+			values = append(values, args[idx+1])
+			idx++
+		}
+	}
+	return values
+}
+
+// flagValue returns the last value given for flag, or "" if it is absent.
+func flagValue(flag string) string {
+	values := flagValues(flag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
 // ---- tokens command ----
 
 func cmdTokens(source, filename string, jsonMode bool) {
@@ -103,7 +245,7 @@ func cmdTokens(source, filename string, jsonMode bool) {
 
 // ---- parse command ----
 
-func cmdParse(source, filename string) {
+func cmdParse(source, filename string, binaryMode, optimized bool) {
 	l := lexer.New(source, filename)
 	tokens, lexDiags := l.Tokenize()
 
@@ -111,6 +253,24 @@ func cmdParse(source, filename string) {
 	file, parseDiags := p.ParseFile()
 
 	allDiags := append(lexDiags, parseDiags...)
+	if optimized {
+		optimize.File(file)
+	}
+
+	if binaryMode {
+		// Binary output carries no diagnostics; refuse to encode a broken tree
+		if len(allDiags) > 0 {
+			printDiagsText(allDiags)
+			os.Exit(1)
+		}
+		data, err := ast.EncodeBinary(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		return
+	}
 
 	output := map[string]interface{}{
 		"ast":         ast.NodeToMap(file),
@@ -123,6 +283,100 @@ func cmdParse(source, filename string) {
 	}
 }
 
+// ---- doc command ----
+
+// cmdDoc prints the top-level functions and classes of a file with their
+// doc comments, or only the one called name. The file is not run.
+func cmdDoc(source, filename, name string) {
+	tokens, lexDiags := lexer.New(source, filename).Tokenize()
+	file, parseDiags := parser.New(tokens).ParseFile()
+	if diags := append(lexDiags, parseDiags...); len(diags) > 0 {
+		printDiagsText(diags)
+		os.Exit(1)
+	}
+
+	var docs []string
+	for _, node := range file.Body {
+		switch decl := node.(type) {
+		case *ast.FuncDecl:
+			if name == "" || decl.Name == name {
+				docs = append(docs, runtime.FuncDoc(decl))
+			}
+		case *ast.ClassDecl:
+			if name == "" || decl.Name == name {
+				docs = append(docs, runtime.ClassDoc(decl))
+			}
+		}
+	}
+	if name != "" && len(docs) == 0 {
+		fmt.Fprintf(os.Stderr, "error: no function or class '%s' in %s\n", name, filename)
+		os.Exit(1)
+	}
+	fmt.Println(strings.Join(docs, "\n\n"))
+}
+
+// ---- check command ----
+
+// cmdCheck reports the errors and warnings found in a file without running
+// it, and exits with status 1 if there are errors.
+func cmdCheck(source, filename string) {
+	tokens, lexDiags := lexer.New(source, filename).Tokenize()
+	file, parseDiags := parser.New(tokens).ParseFile()
+	if diags := append(lexDiags, parseDiags...); len(diags) > 0 {
+		printDiagsText(diags)
+		os.Exit(1)
+	}
+
+	globals := runtime.NewInterpreter(io.Discard).Env().Names()
+	diags := append(analysis.File(file, globals), check.File(file)...)
+	sort.SliceStable(diags, func(x, y int) bool {
+		return diags[x].Span.Start.Offset < diags[y].Span.Start.Offset
+	})
+	printDiagsText(diags)
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			os.Exit(1)
+		}
+	}
+}
+
+// ---- get command ----
+
+// cmdGet downloads remote modules and records their checksums in light.sum
+// in the current directory. With no paths it resolves the dependencies of
+// the light.toml found from the current directory instead.
+func cmdGet(paths []string) {
+	if len(paths) == 0 {
+		lock, err := modules.GetDependencies(".")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		names := make([]string, 0, len(lock))
+		for name := range lock {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			dep := lock[name]
+			fmt.Printf("%s %s@%s (%d files)\n", name, dep.Source, dep.Version, len(dep.Sums))
+		}
+		return
+	}
+	failed := false
+	for _, path := range paths {
+		if err := modules.Get(path, modules.SumFile); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			failed = true
+			continue
+		}
+		fmt.Printf("got %s\n", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
 // ---- run command ----
 
 func cmdRun(source, filename string) {
@@ -141,11 +395,120 @@ func cmdRun(source, filename string) {
 		printDiagsText(parseDiags)
 		os.Exit(1)
 	}
+	printDiagsText(check.File(file))
+	optimize.File(file)
 
 	// Interpret
 	interp := runtime.NewInterpreter(os.Stdout)
+	interp.SetScriptPath(filename)
+	interp.SetArgs(scriptArgs())
+	if hasFlag("--allow-ffi") {
+		interp.AllowFFI()
+	}
+	interp.SetLimits(runLimits())
+	if v := flagValue("--seed"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid --seed '%s' (want an integer)\n", v)
+			os.Exit(1)
+		}
+		interp.SetSeed(seed)
+	}
+	if hasFlag("--strict-index") {
+		interp.SetStrictIndex(true)
+	}
+	if hasFlag("--strict-equality") {
+		interp.SetStrictEquality(true)
+	}
+	if hasFlag("--strict") {
+		interp.SetStrict(true)
+	}
+	for _, path := range flagValues("--plugin") {
+		if err := interp.LoadNative(path); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+	}
+	if hasFlag("--vm") {
+		if flagValue("--max-heap") != "" {
+			fmt.Fprintln(os.Stderr, "error: --max-heap is not supported with --vm")
+			os.Exit(1)
+		}
+		runVM(interp, file)
+	}
 	if err := interp.Run(file); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		exitWithError(err)
+	}
+
+	// Keep running while setTimeout/setInterval callbacks are pending
+	if err := interp.RunEventLoop(); err != nil {
+		exitWithError(err)
+	}
+	os.Exit(interp.ExitCode())
+}
+
+// runVM compiles file and runs it on the bytecode VM, using interp for
+// builtins and pending timers, then exits. The VM checks interp's timeout,
+// step and call depth limits; it counts loop iterations and calls as
+// steps.
+func runVM(interp *runtime.Interpreter, file *ast.File) {
+	bc, err := compiler.Compile(file)
+	if err != nil {
+		exitWithError(err)
+	}
+	machine := vm.New(bc, interp)
+	if err := machine.Run(); err != nil {
+		exitWithError(err)
+	}
+	if err := interp.RunEventLoop(); err != nil {
+		exitWithError(err)
+	}
+	code := machine.ExitCode()
+	if c := interp.ExitCode(); c != 0 {
+		code = c // exit() called from a timer callback
+	}
+	os.Exit(code)
+}
+
+// exitWithError reports a failed run, with the call stack for an uncaught
+// throw, and exits with status 1.
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	var thrown *runtime.ThrownError
+	if errors.As(err, &thrown) {
+		fmt.Fprint(os.Stderr, thrown.StackTrace())
+	}
+	os.Exit(1)
+}
+
+// runLimits builds interpreter limits from --timeout, --max-steps,
+// --max-depth and --max-heap, exiting on malformed values.
+func runLimits() runtime.Limits {
+	var limits runtime.Limits
+	var err error
+	if v := flagValue("--timeout"); v != "" {
+		if limits.Timeout, err = time.ParseDuration(v); err != nil || limits.Timeout <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid --timeout '%s' (want a duration such as 5s)\n", v)
+			os.Exit(1)
+		}
+	}
+	if v := flagValue("--max-steps"); v != "" {
+		if limits.MaxSteps, err = strconv.ParseInt(v, 10, 64); err != nil || limits.MaxSteps <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid --max-steps '%s' (want a positive integer)\n", v)
+			os.Exit(1)
+		}
+	}
+	if v := flagValue("--max-depth"); v != "" {
+		if limits.MaxCallDepth, err = strconv.Atoi(v); err != nil || limits.MaxCallDepth <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid --max-depth '%s' (want a positive integer)\n", v)
+			os.Exit(1)
+		}
+	}
+	if v := flagValue("--max-heap"); v != "" {
+		if limits.MaxHeapValues, err = strconv.ParseInt(v, 10, 64); err != nil || limits.MaxHeapValues <= 0 {
+			fmt.Fprintf(os.Stderr, "error: invalid --max-heap '%s' (want a positive integer)\n", v)
+			os.Exit(1)
+		}
 	}
+	return limits
 }
@@ -57,14 +57,22 @@ func printTokensText(tokens []token.Token, diags []diag.Diagnostic) {
 }
 
 func printTokensJSON(tokens []token.Token, diags []diag.Diagnostic) {
-	type tokenJSON struct {
-		Kind   string `json:"kind"`
-		Lexeme string `json:"lexeme"`
-		Line   int    `json:"line"`
-		Column int    `json:"column"`
-		Offset int    `json:"offset"`
+	output := map[string]interface{}{
+		"tokens":      tokensToSlice(tokens),
+		"diagnostics": diagsToSlice(diags),
 	}
+	printJSON(output)
+}
+
+type tokenJSON struct {
+	Kind   string `json:"kind"`
+	Lexeme string `json:"lexeme"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+}
 
+func tokensToSlice(tokens []token.Token) []tokenJSON {
 	var toks []tokenJSON
 	for _, tok := range tokens {
 		toks = append(toks, tokenJSON{
@@ -75,10 +83,5 @@ func printTokensJSON(tokens []token.Token, diags []diag.Diagnostic) {
 			Offset: tok.Span.Start.Offset,
 		})
 	}
-
-	output := map[string]interface{}{
-		"tokens":      toks,
-		"diagnostics": diagsToSlice(diags),
-	}
-	printJSON(output)
+	return toks
 }
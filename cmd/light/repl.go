@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"light-lang/internal/diag"
@@ -8,6 +9,7 @@ import (
 	"light-lang/internal/parser"
 	"light-lang/internal/runtime"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 
@@ -35,12 +37,15 @@ func cmdRepl() {
 		historyFile = filepath.Join(home, ".light_history")
 	}
 
+	painter := &replPainter{}
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:            colorGreen + "light> " + colorReset,
 		HistoryFile:       historyFile,
 		InterruptPrompt:   "^C",
 		EOFPrompt:         "exit",
 		HistorySearchFold: true,
+		Painter:           painter,
+		AutoComplete:      replIndenter{},
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "readline init failed: %v\n", err)
@@ -54,12 +59,26 @@ func cmdRepl() {
 
 	interp := runtime.NewInterpreter(rl.Stdout())
 	var accumulated strings.Builder
-	braceDepth := 0
+	resultCount := 0
+
+	// Entries that ran successfully, written out by :save
+	var session []string
+	if path := flagValue("--load"); path != "" {
+		if err := restoreSession(interp, &session, path); err != nil {
+			fmt.Fprintf(rl.Stderr(), "%serror: %s%s\n", colorRed, err, colorReset)
+		} else {
+			fmt.Fprintf(rl.Stdout(), "%srestored %s%s\n", colorGray, path, colorReset)
+		}
+	}
 
 	for {
 		// Update prompt based on multi-line state
-		if braceDepth > 0 {
+		continuing := accumulated.Len() > 0
+		painter.pending = openBraces(accumulated.String())
+		if continuing {
 			rl.SetPrompt(colorGray + "...   " + colorReset)
+			// Start the line at the indentation of the enclosing block
+			rl.WriteStdin([]byte(strings.Repeat(indentUnit, painter.pending)))
 		} else {
 			rl.SetPrompt(colorGreen + "light> " + colorReset)
 		}
@@ -67,10 +86,9 @@ func cmdRepl() {
 		line, err := rl.Readline()
 		if err != nil {
 			if err == readline.ErrInterrupt {
-				if braceDepth > 0 {
+				if continuing {
 					// Cancel multi-line input
 					accumulated.Reset()
-					braceDepth = 0
 					continue
 				}
 				// Show hint instead of exiting
@@ -85,29 +103,32 @@ func cmdRepl() {
 		}
 
 		// Exit command
-		if braceDepth == 0 && strings.TrimSpace(line) == "exit" {
+		if !continuing && strings.TrimSpace(line) == "exit" {
 			break
 		}
 
-		// Count braces for multi-line input
-		braceDepth += strings.Count(line, "{") - strings.Count(line, "}")
+		// REPL commands (:help, ...)
+		if !continuing && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			replCommand(rl.Stdout(), interp, &session, strings.TrimSpace(line))
+			continue
+		}
+
+		// Skip empty input
+		if !continuing && strings.TrimSpace(line) == "" {
+			continue
+		}
+
 		accumulated.WriteString(line)
 		accumulated.WriteString("\n")
 
-		// If braces are unbalanced, keep reading
-		if braceDepth > 0 {
+		// Keep reading while the input only fails because it ends early
+		if parser.Incomplete(accumulated.String()) {
 			continue
 		}
-		braceDepth = 0
 
 		source := accumulated.String()
 		accumulated.Reset()
 
-		// Skip empty input
-		if strings.TrimSpace(source) == "" {
-			continue
-		}
-
 		// Tokenize
 		l := lexer.New(source, "<repl>")
 		tokens, lexDiags := l.Tokenize()
@@ -124,11 +145,135 @@ func cmdRepl() {
 			continue
 		}
 
-		// Execute
-		if err := interp.Run(file); err != nil {
+		// Execute; Ctrl+C stops the entry instead of the REPL
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		val, err := interp.EvalContext(ctx, file)
+		stop()
+		if err != nil {
 			fmt.Fprintf(rl.Stderr(), "%serror: %s%s\n", colorRed, err, colorReset)
 			continue
 		}
+		session = append(session, source)
+
+		// Remember expression results as _ and _1, _2, ...
+		if _, isNull := val.(runtime.NullVal); !isNull {
+			resultCount++
+			name := fmt.Sprintf("_%d", resultCount)
+			bindResult(interp.Env(), name, val)
+			bindResult(interp.Env(), "_", val)
+			fmt.Fprintf(rl.Stdout(), "%s%s =%s %s\n", colorGray, name, colorReset, val)
+		}
+	}
+}
+
+// indentUnit is one level of REPL indentation.
+const indentUnit = "  "
+
+// replIndenter makes Tab insert one level of indentation at the cursor. It
+// implements readline.AutoCompleter.
+type replIndenter struct{}
+
+func (replIndenter) Do(_ []rune, _ int) ([][]rune, int) {
+	return [][]rune{[]rune(indentUnit)}, 0
+}
+
+// replCommand runs a ':' command typed at the prompt. session holds the
+// entries run so far.
+func replCommand(w io.Writer, interp *runtime.Interpreter, session *[]string, line string) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":help":
+		if len(fields) > 1 {
+			val, ok := interp.Env().Get(fields[1])
+			if !ok {
+				fmt.Fprintf(w, "%s'%s' is not defined%s\n", colorRed, fields[1], colorReset)
+				return
+			}
+			fmt.Fprintln(w, runtime.DocText(val))
+			return
+		}
+		fmt.Fprintf(w, "%sCommands:%s\n", colorBold, colorReset)
+		fmt.Fprintln(w, "  :help                                Show this help")
+		fmt.Fprintln(w, "  :help <name>                         Describe a builtin, function or class")
+		fmt.Fprintln(w, "  :env                                 List the variables defined in this session")
+		fmt.Fprintln(w, "  :save <file>                         Write the entries of this session to a script")
+		fmt.Fprintln(w, "  :restore <file>                      Run a saved session (or any script) here")
+		fmt.Fprintln(w, "  exit                                 Quit (or Ctrl+D)")
+		fmt.Fprintf(w, "\n%sBuiltins:%s\n", colorBold, colorReset)
+		fmt.Fprint(w, runtime.BuiltinsHelp(interp.Env()))
+		if defs := runtime.UserDefinitions(interp.Env()); len(defs) > 0 {
+			fmt.Fprintf(w, "\n%sDefined in this session:%s\n", colorBold, colorReset)
+			for _, def := range defs {
+				fmt.Fprintf(w, "  %s\n", def)
+			}
+		}
+	case ":env":
+		globals := interp.Globals()
+		if len(globals.Keys) == 0 {
+			fmt.Fprintf(w, "%s(no variables defined)%s\n", colorGray, colorReset)
+			return
+		}
+		for _, name := range globals.Keys {
+			val := globals.Values[name]
+			fmt.Fprintf(w, "  %s = %s %s(%s)%s\n", name, val, colorGray, val.TypeName(), colorReset)
+		}
+	case ":save":
+		if len(fields) != 2 {
+			fmt.Fprintf(w, "%susage: :save <file>%s\n", colorRed, colorReset)
+			return
+		}
+		if err := os.WriteFile(fields[1], []byte(strings.Join(*session, "")), 0o644); err != nil {
+			fmt.Fprintf(w, "%serror: %s%s\n", colorRed, err, colorReset)
+			return
+		}
+		fmt.Fprintf(w, "%ssaved %d entries to %s%s\n", colorGray, len(*session), fields[1], colorReset)
+	case ":restore":
+		if len(fields) != 2 {
+			fmt.Fprintf(w, "%susage: :restore <file>%s\n", colorRed, colorReset)
+			return
+		}
+		if err := restoreSession(interp, session, fields[1]); err != nil {
+			fmt.Fprintf(w, "%serror: %s%s\n", colorRed, err, colorReset)
+			return
+		}
+		fmt.Fprintf(w, "%srestored %s%s\n", colorGray, fields[1], colorReset)
+	default:
+		fmt.Fprintf(w, "%sunknown command '%s' (try :help)%s\n", colorRed, fields[0], colorReset)
+	}
+}
+
+// restoreSession runs the script at path in the REPL's interpreter, as if
+// its contents had been typed at the prompt, and adds it to session so a
+// later :save keeps it.
+func restoreSession(interp *runtime.Interpreter, session *[]string, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	source := string(data)
+	if source != "" && !strings.HasSuffix(source, "\n") {
+		source += "\n"
+	}
+	tokens, lexDiags := lexer.New(source, path).Tokenize()
+	if len(lexDiags) > 0 {
+		return fmt.Errorf("%s: %s", path, lexDiags[0])
+	}
+	file, parseDiags := parser.New(tokens).ParseFile()
+	if len(parseDiags) > 0 {
+		return fmt.Errorf("%s: %s", path, parseDiags[0])
+	}
+	if _, err := interp.Eval(file); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	*session = append(*session, source)
+	return nil
+}
+
+// bindResult stores a REPL result in a history variable, replacing any
+// earlier value. The user may reassign these names freely.
+func bindResult(env *runtime.Environment, name string, val runtime.Value) {
+	if env.Set(name, val) != nil {
+		env.Define(name, val, false)
 	}
 }
 
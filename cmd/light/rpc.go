@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/diag"
+	"light-lang/internal/jsonrpc"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/runtime"
+	"net"
+	"os"
+)
+
+// ---- serve-rpc command ----
+
+// cmdServeRPC serves JSON-RPC on stdio, or on a TCP address with --tcp.
+// An address without a host, like ":9000" or "9000", listens on localhost
+// only, since eval runs arbitrary code; give a host such as "0.0.0.0:9000"
+// to accept other machines.
+// Each connection is a session with its own interpreter, so definitions made
+// by one eval call are visible to the next.
+//
+// Methods:
+//
+//	tokenize {source, filename?} -> {tokens, diagnostics}
+//	parse    {source, filename?} -> {ast, diagnostics}
+//	eval     {source}            -> {output, value, diagnostics, error}
+//	reset    {}                  -> {}   discard the session's interpreter state
+func cmdServeRPC() {
+	addrs := flagValues("--tcp")
+	if len(addrs) == 0 {
+		if err := newRPCSession().serve(jsonrpc.NewConn(os.Stdin, os.Stdout)); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ln, err := net.Listen("tcp", rpcListenAddr(addrs[0]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "light: serving JSON-RPC on %s\n", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		go func() {
+			defer conn.Close()
+			if err := newRPCSession().serve(jsonrpc.NewConn(conn, conn)); err != nil {
+				fmt.Fprintf(os.Stderr, "light: %s: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// rpcListenAddr fills in localhost when addr gives no host.
+func rpcListenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.JoinHostPort("localhost", addr) // a bare port
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// rpcSession holds per-connection interpreter state.
+type rpcSession struct {
+	out    bytes.Buffer // output captured during the current eval
+	interp *runtime.Interpreter
+}
+
+func newRPCSession() *rpcSession {
+	s := &rpcSession{}
+	s.interp = runtime.NewInterpreter(&s.out)
+	return s
+}
+
+type sourceParams struct {
+	Source   string `json:"source"`
+	Filename string `json:"filename"`
+}
+
+func (s *rpcSession) serve(conn *jsonrpc.Conn) error {
+	return jsonrpc.Serve(conn, s.handle)
+}
+
+func (s *rpcSession) handle(req *jsonrpc.Request) (interface{}, error) {
+	var params sourceParams
+	if err := jsonrpc.DecodeParams(req, &params); err != nil {
+		return nil, err
+	}
+	if params.Filename == "" {
+		params.Filename = "<rpc>"
+	}
+
+	switch req.Method {
+	case "tokenize":
+		tokens, diags := lexer.New(params.Source, params.Filename).Tokenize()
+		return map[string]interface{}{
+			"tokens":      tokensToSlice(tokens),
+			"diagnostics": diagsToSlice(diags),
+		}, nil
+
+	case "parse":
+		file, diags := parseSource(params.Source, params.Filename)
+		return map[string]interface{}{
+			"ast":         ast.NodeToMap(file),
+			"diagnostics": diagsToSlice(diags),
+		}, nil
+
+	case "eval":
+		return s.eval(params.Source, params.Filename), nil
+
+	case "reset":
+		s.out.Reset()
+		s.interp = runtime.NewInterpreter(&s.out)
+		return nil, nil
+
+	default:
+		return nil, jsonrpc.Errorf(jsonrpc.MethodNotFound, "unknown method '%s'", req.Method)
+	}
+}
+
+// eval runs source in the session interpreter, including any timers it schedules.
+func (s *rpcSession) eval(source, filename string) map[string]interface{} {
+	result := map[string]interface{}{
+		"output":      "",
+		"value":       nil,
+		"diagnostics": []map[string]interface{}{},
+		"error":       nil,
+	}
+	file, diags := parseSource(source, filename)
+	if len(diags) > 0 {
+		result["diagnostics"] = diagsToSlice(diags)
+		return result
+	}
+
+	s.out.Reset()
+	val, err := s.interp.Eval(file)
+	if err == nil {
+		err = s.interp.RunEventLoop()
+	}
+	result["output"] = s.out.String()
+	if err != nil {
+		result["error"] = err.Error()
+	} else if _, isNull := val.(runtime.NullVal); !isNull {
+		result["value"] = val.String()
+	}
+	return result
+}
+
+// parseSource lexes and parses source, returning all diagnostics.
+func parseSource(source, filename string) (*ast.File, []diag.Diagnostic) {
+	tokens, lexDiags := lexer.New(source, filename).Tokenize()
+	file, parseDiags := parser.New(tokens).ParseFile()
+	return file, append(lexDiags, parseDiags...)
+}
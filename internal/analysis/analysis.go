@@ -0,0 +1,494 @@
+// Package analysis finds errors a program would hit when it runs, such as
+// undefined variables and calls with the wrong number of arguments, without
+// running it. Unlike the warnings of package check, most of its findings
+// are errors: the code they point at fails if it is reached.
+package analysis
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/diag"
+	"light-lang/internal/span"
+	"sort"
+)
+
+// Diagnostic codes.
+const (
+	CodeUndefined      = "E3001" // name that is declared nowhere in scope
+	CodeUseBeforeDecl  = "E3002" // name used before its declaration runs
+	CodeAssignConst    = "E3003" // assignment to a constant
+	CodeUnreachable    = "W3004" // statement after return, break, continue or throw
+	CodeDuplicateParam = "E3005" // parameter name given twice
+	CodeArity          = "E3006" // call with the wrong number of arguments
+)
+
+// File analyzes file and returns its diagnostics in source order. globals
+// are the names defined before the file runs, such as the builtins.
+//
+// Names brought in by module and native imports are only known once they
+// are loaded, so undefined names are not reported in files that have them.
+func File(file *ast.File, globals []string) []diag.Diagnostic {
+	a := &analyzer{assigned: make(map[string]bool)}
+	ast.Walk(file, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			if ident, ok := s.Target.(*ast.IdentExpr); ok {
+				a.assigned[ident.Name] = true
+			}
+		case *ast.AssignExpr:
+			if ident, ok := s.Target.(*ast.IdentExpr); ok {
+				a.assigned[ident.Name] = true
+			}
+		case *ast.ImportStmt:
+			if s.Name == "" {
+				a.openImports = true
+			}
+		}
+		return true
+	})
+
+	a.push()
+	for _, name := range globals {
+		a.declare(name, &binding{kind: "global", declared: true})
+	}
+	a.push()
+	a.stmts(file.Body)
+
+	sort.SliceStable(a.diags, func(x, y int) bool {
+		return a.diags[x].Span.Start.Offset < a.diags[y].Span.Start.Offset
+	})
+	return a.diags
+}
+
+// binding is a declared name.
+type binding struct {
+	kind     string // "var", "const", "function", "class", "parameter", ...
+	declared bool   // the declaration has run by the point being analyzed
+	fn       *ast.FuncDecl
+	class    *ast.ClassDecl
+}
+
+// scope holds the names of one block. depth is the number of functions it
+// is nested in: code in an inner function runs when the function is
+// called, by which time declarations further down outer blocks have run.
+type scope struct {
+	names map[string]*binding
+	depth int
+}
+
+type analyzer struct {
+	scopes      []*scope
+	depth       int
+	assigned    map[string]bool // names assigned with '=' anywhere
+	openImports bool            // the file imports names it cannot see
+	diags       []diag.Diagnostic
+}
+
+func (a *analyzer) push() {
+	a.scopes = append(a.scopes, &scope{names: make(map[string]*binding), depth: a.depth})
+}
+
+func (a *analyzer) pop() { a.scopes = a.scopes[:len(a.scopes)-1] }
+
+func (a *analyzer) declare(name string, b *binding) {
+	a.scopes[len(a.scopes)-1].names[name] = b
+}
+
+// markDeclared records that the declaration of name in the current scope
+// has run.
+func (a *analyzer) markDeclared(name string) {
+	if b, ok := a.scopes[len(a.scopes)-1].names[name]; ok {
+		b.declared = true
+	}
+}
+
+// lookup returns the nearest binding of name, declared yet or not.
+func (a *analyzer) lookup(name string) *binding {
+	for idx := len(a.scopes) - 1; idx >= 0; idx-- {
+		if b, ok := a.scopes[idx].names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// resolve returns the binding a use of name at s refers to when it runs,
+// reporting names that are undefined or not declared yet. A block's own
+// declarations do not exist until they run, so until then the name refers
+// to an outer one, as in the interpreter.
+func (a *analyzer) resolve(name string, s span.Span) *binding {
+	pending := false
+	for idx := len(a.scopes) - 1; idx >= 0; idx-- {
+		sc := a.scopes[idx]
+		b, ok := sc.names[name]
+		if !ok {
+			continue
+		}
+		if b.declared || sc.depth < a.depth {
+			return b
+		}
+		pending = true
+	}
+	if pending {
+		a.errorf(CodeUseBeforeDecl, s, "'%s' is used before its declaration", name)
+	} else if !a.openImports {
+		a.errorf(CodeUndefined, s, "undefined variable '%s'", name)
+	}
+	return nil
+}
+
+func (a *analyzer) errorf(code string, s span.Span, format string, args ...interface{}) {
+	a.diags = append(a.diags, diag.Errorf(code, s, format, args...))
+}
+
+// declareAll adds the names a block's statements declare, not yet run.
+func (a *analyzer) declareAll(stmts []ast.Node) {
+	for _, node := range stmts {
+		switch d := node.(type) {
+		case *ast.VarDeclStmt:
+			kind := "var"
+			if d.IsConst {
+				kind = "const"
+			}
+			if len(d.Names) > 0 {
+				for _, name := range d.Names {
+					a.declare(name, &binding{kind: kind})
+				}
+				continue
+			}
+			a.declare(d.Name, &binding{kind: kind})
+		case *ast.FuncDecl:
+			a.declare(d.Name, &binding{kind: "function", fn: d})
+		case *ast.ClassDecl:
+			a.declare(d.Name, &binding{kind: "class", class: d})
+		case *ast.EnumDecl:
+			a.declare(d.Name, &binding{kind: "enum"})
+		case *ast.InterfaceDecl:
+			a.declare(d.Name, &binding{kind: "interface"})
+		case *ast.ImportStmt:
+			if d.Name != "" {
+				a.declare(d.Name, &binding{kind: "import"})
+			}
+		}
+	}
+}
+
+// stmts analyzes statements in the current scope.
+func (a *analyzer) stmts(stmts []ast.Node) {
+	a.declareAll(stmts)
+	reported := false
+	for idx, node := range stmts {
+		if !reported && idx > 0 && terminates(stmts[idx-1]) {
+			d := diag.Warningf(CodeUnreachable, node.GetSpan(), "unreachable code")
+			d.Hint = "nothing after return, break, continue or throw in the same block runs"
+			a.diags = append(a.diags, d)
+			reported = true
+		}
+		a.node(node)
+	}
+}
+
+// terminates reports whether control never reaches the statement after n.
+func terminates(n ast.Node) bool {
+	switch s := n.(type) {
+	case *ast.ReturnStmt, *ast.BreakStmt, *ast.ContinueStmt, *ast.ThrowStmt:
+		return true
+	case *ast.BlockStmt:
+		return blockTerminates(s)
+	case *ast.IfStmt:
+		if s.ElseBody == nil || !blockTerminates(s.Body) || !blockTerminates(s.ElseBody) {
+			return false
+		}
+		for _, clause := range s.ElseIfs {
+			if !blockTerminates(clause.Body) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func blockTerminates(b *ast.BlockStmt) bool {
+	if b == nil {
+		return false
+	}
+	for _, node := range b.Stmts {
+		if terminates(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// block analyzes b in a new scope holding the given bindings, such as a
+// loop variable.
+func (a *analyzer) block(b *ast.BlockStmt, names ...string) {
+	a.push()
+	for _, name := range names {
+		if name != "" {
+			a.declare(name, &binding{kind: "var", declared: true})
+		}
+	}
+	if b != nil {
+		a.stmts(b.Stmts)
+	}
+	a.pop()
+}
+
+// function analyzes a function body, which runs when the function is
+// called.
+func (a *analyzer) function(params []string, body *ast.BlockStmt, s span.Span) {
+	a.depth++
+	a.push()
+	seen := make(map[string]bool, len(params))
+	for _, p := range params {
+		if seen[p] {
+			a.errorf(CodeDuplicateParam, s, "duplicate parameter '%s'", p)
+		}
+		seen[p] = true
+		a.declare(p, &binding{kind: "parameter", declared: true})
+	}
+	if body != nil {
+		a.stmts(body.Stmts)
+	}
+	a.pop()
+	a.depth--
+}
+
+func (a *analyzer) node(n ast.Node) {
+	switch s := n.(type) {
+	case *ast.VarDeclStmt:
+		a.expr(s.Init)
+		if len(s.Names) > 0 {
+			for _, name := range s.Names {
+				a.markDeclared(name)
+			}
+		} else {
+			a.markDeclared(s.Name)
+		}
+	case *ast.FuncDecl:
+		a.markDeclared(s.Name)
+		a.function(s.Params, s.Body, s.Span)
+	case *ast.ClassDecl:
+		if s.SuperClass != "" {
+			a.resolve(s.SuperClass, s.Span)
+		}
+		for _, iface := range s.Implements {
+			a.resolve(iface, s.Span)
+		}
+		a.markDeclared(s.Name)
+		for _, st := range s.Statics {
+			a.expr(st.Value)
+		}
+		for _, f := range s.Props {
+			a.expr(f.Value)
+		}
+		if s.Constructor != nil {
+			a.function(s.Constructor.Params, s.Constructor.Body, s.Constructor.Span)
+		}
+		for _, m := range s.Methods {
+			a.function(m.Params, m.Body, m.Span)
+		}
+		for _, m := range s.StaticMethods {
+			a.function(m.Params, m.Body, m.Span)
+		}
+		for _, m := range s.Getters {
+			a.function(m.Params, m.Body, m.Span)
+		}
+		for _, m := range s.Setters {
+			a.function(m.Params, m.Body, m.Span)
+		}
+	case *ast.EnumDecl:
+		a.markDeclared(s.Name)
+	case *ast.InterfaceDecl:
+		a.markDeclared(s.Name)
+	case *ast.ImportStmt:
+		if s.Name != "" {
+			a.markDeclared(s.Name)
+		}
+	case *ast.ExprStmt:
+		a.expr(s.Expr)
+	case *ast.AssignStmt:
+		a.expr(s.Value)
+		a.target(s.Target)
+	case *ast.ReturnStmt:
+		a.expr(s.Value)
+	case *ast.ThrowStmt:
+		a.expr(s.Value)
+	case *ast.BlockStmt:
+		a.block(s)
+	case *ast.IfStmt:
+		a.expr(s.Condition)
+		a.block(s.Body)
+		for _, clause := range s.ElseIfs {
+			a.expr(clause.Condition)
+			a.block(clause.Body)
+		}
+		if s.ElseBody != nil {
+			a.block(s.ElseBody)
+		}
+	case *ast.WhileStmt:
+		a.expr(s.Condition)
+		a.block(s.Body)
+	case *ast.ForStmt:
+		a.push()
+		if s.Init != nil {
+			a.declareAll([]ast.Node{s.Init})
+			a.node(s.Init)
+		}
+		a.expr(s.Condition)
+		a.block(s.Body)
+		if s.Update != nil {
+			a.node(s.Update)
+		}
+		a.pop()
+	case *ast.ForOfStmt:
+		a.expr(s.Iterable)
+		a.block(s.Body, append([]string{s.KeyName, s.VarName}, ast.PatternNames(s.Pattern)...)...)
+	case *ast.TryStmt:
+		a.block(s.Body)
+		if s.CatchBody != nil {
+			a.block(s.CatchBody, s.CatchParam)
+		}
+	case *ast.MatchStmt:
+		a.expr(s.Subject)
+		for _, arm := range s.Arms {
+			for _, p := range arm.Patterns {
+				a.expr(p)
+			}
+			a.push()
+			if arm.BindVar != "" {
+				a.declare(arm.BindVar, &binding{kind: "var", declared: true})
+			}
+			a.expr(arm.Guard)
+			a.block(arm.Body)
+			a.pop()
+		}
+	}
+}
+
+// target analyzes the target of an assignment, which may be a
+// destructuring pattern.
+func (a *analyzer) target(e ast.Expr) {
+	switch t := e.(type) {
+	case *ast.IdentExpr:
+		if b := a.resolve(t.Name, t.Span); b != nil && b.kind == "const" {
+			a.errorf(CodeAssignConst, t.Span, "cannot assign to constant '%s'", t.Name)
+		}
+	case *ast.SpreadExpr:
+		a.target(t.Operand)
+	case *ast.ArrayPattern:
+		for _, elem := range t.Elements {
+			a.target(elem)
+		}
+	case *ast.MapPattern:
+		for _, value := range t.Values {
+			a.target(value)
+		}
+	default:
+		a.expr(e)
+	}
+}
+
+func (a *analyzer) expr(e ast.Expr) {
+	if e == nil {
+		return
+	}
+	ast.Walk(e, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.IdentExpr:
+			a.resolve(x.Name, x.Span)
+		case *ast.FuncExpr:
+			a.function(x.Params, x.Body, x.Span)
+			return false
+		case *ast.AssignExpr:
+			a.expr(x.Value)
+			a.target(x.Target)
+			return false
+		case *ast.CallExpr:
+			ident, ok := x.Callee.(*ast.IdentExpr)
+			if !ok {
+				return true
+			}
+			b := a.resolve(ident.Name, ident.Span)
+			if b != nil && b.fn != nil && !a.assigned[ident.Name] && !hasSpread(x.Args) {
+				if msg := arityMessage(b.fn.Params, b.fn.Rest, len(x.Args)); msg != "" {
+					a.errorf(CodeArity, x.Span, "%s() expects %s", ident.Name, msg)
+				}
+			}
+			for _, arg := range x.Args {
+				a.expr(arg)
+			}
+			return false
+		case *ast.NewExpr:
+			b := a.resolve(x.ClassName, x.Span)
+			if b != nil && b.class != nil && !a.assigned[x.ClassName] && !hasSpread(x.Args) {
+				if msg := a.constructorArity(b.class, x.ClassName, len(x.Args)); msg != "" {
+					a.errorf(CodeArity, x.Span, "%s", msg)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// constructorArity describes what is wrong with creating an instance of
+// class with got arguments, or returns "" if it is fine or cannot be told.
+func (a *analyzer) constructorArity(class *ast.ClassDecl, name string, got int) string {
+	if class.Record {
+		if got != len(class.Fields) {
+			return fmt.Sprintf("%s expects %d arguments, got %d", name, len(class.Fields), got)
+		}
+		return ""
+	}
+	// The constructor may be inherited
+	for seen := map[*ast.ClassDecl]bool{}; !seen[class]; {
+		seen[class] = true
+		if ctor := class.Constructor; ctor != nil {
+			if msg := arityMessage(ctor.Params, ctor.Rest, got); msg != "" {
+				return fmt.Sprintf("%s constructor expects %s", name, msg)
+			}
+			return ""
+		}
+		if class.SuperClass == "" {
+			if got > 0 {
+				return fmt.Sprintf("%s has no constructor but was called with %d arguments", name, got)
+			}
+			return ""
+		}
+		super := a.lookup(class.SuperClass)
+		if super == nil || super.class == nil {
+			return ""
+		}
+		class = super.class
+	}
+	return ""
+}
+
+// arityMessage describes a call of a function taking params with got
+// arguments when the count is wrong, as "2 arguments, got 1", and returns
+// "" otherwise.
+func arityMessage(params []string, rest bool, got int) string {
+	if rest {
+		if got < len(params)-1 {
+			return fmt.Sprintf("at least %d arguments, got %d", len(params)-1, got)
+		}
+		return ""
+	}
+	if got != len(params) {
+		return fmt.Sprintf("%d arguments, got %d", len(params), got)
+	}
+	return ""
+}
+
+// hasSpread reports whether any argument is ...expr, whose length is not
+// known until it runs.
+func hasSpread(args []ast.Expr) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*ast.SpreadExpr); ok {
+			return true
+		}
+	}
+	return false
+}
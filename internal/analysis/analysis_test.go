@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"strings"
+	"testing"
+)
+
+func analyze(t *testing.T, source string) []string {
+	t.Helper()
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	file, diags := parser.New(tokens).ParseFile()
+	if len(diags) > 0 {
+		t.Fatalf("parse error: %v", diags[0])
+	}
+	var out []string
+	for _, d := range File(file, []string{"print", "len"}) {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+func expectDiags(t *testing.T, source string, want ...string) {
+	t.Helper()
+	got := analyze(t, source)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUndefinedAndUseBeforeDeclaration(t *testing.T) {
+	expectDiags(t, `print(missing, len([]))
+greet()
+function greet() { return later + helper(1) }
+function helper(n) { return n }
+var later = 1
+{
+    print(later)
+    var later = 2
+    print(inner)
+    var inner = 3
+}
+for (var k = 0; k < 2; k += 1) { print(k) }
+for (var item of [1]) { print(item) }
+try { throw "x" } catch (e) { print(e) }
+print(k, item)
+var f = function fact(n) { return n < 2 ? 1 : n * fact(n - 1) }
+class Pet extends Animal {}
+`,
+		"[E3001] error at 1:7: undefined variable 'missing'",
+		"[E3002] error at 2:1: 'greet' is used before its declaration",
+		"[E3002] error at 9:11: 'inner' is used before its declaration",
+		"[E3001] error at 15:7: undefined variable 'k'",
+		"[E3001] error at 15:10: undefined variable 'item'",
+		"[E3001] error at 16:51: undefined variable 'fact'",
+		"[E3001] error at 17:1: undefined variable 'Animal'",
+	)
+}
+
+func TestAssignToConst(t *testing.T) {
+	expectDiags(t, `const limit = 1
+var n = 0
+n = 2
+function bump() { limit += 1 }
+function shadow() { var limit = 0
+    limit = 3 }
+const [lo, hi] = [0, 1]
+[n, hi] = [hi, n]
+`,
+		"[E3003] error at 4:19: cannot assign to constant 'limit'",
+		"[E3003] error at 8:5: cannot assign to constant 'hi'",
+	)
+}
+
+func TestDestructuringNames(t *testing.T) {
+	expectDiags(t, `var {x, y: [first, ...others]} = {x: 1, y: [2, 3]}
+for (var [key, value] of [["a", 1]]) { print(key, value) }
+print(x, first, others, key)
+`,
+		"[E3001] error at 3:25: undefined variable 'key'",
+	)
+}
+
+func TestUnreachableCode(t *testing.T) {
+	expectDiags(t, `function f(x) {
+    if (x) { return 1 } else { throw "no" }
+    print("never")
+    print("reported once")
+}
+while (true) {
+    break
+    print("never")
+}
+function g(x) {
+    if (x) { return 1 }
+    return 2
+}
+`,
+		"[W3004] warning at 3:5: unreachable code (hint: nothing after return, break, continue or throw in the same block runs)",
+		"[W3004] warning at 8:5: unreachable code (hint: nothing after return, break, continue or throw in the same block runs)",
+	)
+}
+
+func TestDuplicateParameters(t *testing.T) {
+	expectDiags(t, `function f(a, b, a) { return a }
+var g = function(x, x) { return x }
+`,
+		"[E3005] error at 1:1: duplicate parameter 'a'",
+		"[E3005] error at 2:9: duplicate parameter 'x'",
+	)
+}
+
+func TestArity(t *testing.T) {
+	expectDiags(t, `function add(a, b) { return a + b }
+print(add(1), add(1, 2), add(1, 2, 3))
+record Point(x, y)
+class Base { constructor(name) {} }
+class Child extends Base {}
+class Empty {}
+print(new Point(1), new Child(), new Child("c"), new Empty(1))
+function swap() {}
+swap = function(a) {}
+swap(1)
+function log(level, ...args) {}
+log()
+log("info", 1, 2)
+add(...[1, 2, 3])
+`,
+		"[E3006] error at 2:7: add() expects 2 arguments, got 1",
+		"[E3006] error at 2:26: add() expects 2 arguments, got 3",
+		"[E3006] error at 7:7: Point expects 2 arguments, got 1",
+		"[E3006] error at 7:21: Child constructor expects 1 arguments, got 0",
+		"[E3006] error at 7:50: Empty has no constructor but was called with 1 arguments",
+		"[E3006] error at 12:1: log() expects at least 1 arguments, got 0",
+	)
+}
+
+func TestOpenImports(t *testing.T) {
+	expectDiags(t, `import "./util"
+print(helper(1))
+print(x)
+var x = 1
+`,
+		"[E3002] error at 3:7: 'x' is used before its declaration",
+	)
+}
@@ -4,6 +4,7 @@ package ast
 import (
 	"light-lang/internal/span"
 	"light-lang/internal/token"
+	"strings"
 )
 
 // ============================================================
@@ -119,25 +120,31 @@ type BinaryExpr struct {
 	Right Expr
 }
 
-// CallExpr represents a function call: f(a, b).
+// CallExpr represents a function call: f(a, b), or f?.(a, b) when
+// Optional.
 type CallExpr struct {
 	ExprBase
-	Callee Expr
-	Args   []Expr
+	Callee   Expr
+	Args     []Expr
+	Optional bool // f?.(): null when the function is null
 }
 
-// IndexExpr represents indexing: a[i].
+// IndexExpr represents indexing: a[i], or a?.[i] when Optional.
 type IndexExpr struct {
 	ExprBase
-	Object Expr
-	Index  Expr
+	Object   Expr
+	Index    Expr
+	Optional bool // a?.[i]: null when a is null
 }
 
-// MemberExpr represents member access: a.b.
+// MemberExpr represents member access: a.b, or a?.b when Optional. An
+// optional link that finds null makes the rest of its chain null too, so
+// a?.b.c does not fail when a is null.
 type MemberExpr struct {
 	ExprBase
 	Object   Expr
 	Property string
+	Optional bool // a?.b: null when a is null
 }
 
 // NewExpr represents object creation: new ClassName(args).
@@ -156,9 +163,33 @@ type ArrayLiteral struct {
 // FuncExpr represents a function expression: function(params) { body } or (x) => expr.
 type FuncExpr struct {
 	ExprBase
-	Name   string // may be empty for anonymous / arrow functions
-	Params []string
-	Body   *BlockStmt
+	Name      string // may be empty for anonymous / arrow functions
+	Params    []string
+	Body      *BlockStmt
+	Rest      bool // the last parameter collects the remaining arguments (...name)
+	Generator bool // the body contains yield
+	Async     bool // declared with async: calling it returns a promise
+}
+
+// YieldExpr represents yield [value] inside a generator function. It
+// evaluates to the argument of the next() call that resumes the generator.
+type YieldExpr struct {
+	ExprBase
+	Value Expr // may be nil (yields null)
+}
+
+// SpawnExpr represents spawn f(args): the call runs as a concurrent task
+// and the expression evaluates to the task.
+type SpawnExpr struct {
+	ExprBase
+	Call Expr // a *CallExpr
+}
+
+// AwaitExpr represents await value inside an async function or at the top
+// level. It waits for a promise to settle and evaluates to its value.
+type AwaitExpr struct {
+	ExprBase
+	Value Expr
 }
 
 // TernaryExpr represents a ternary: cond ? then : else.
@@ -169,10 +200,21 @@ type TernaryExpr struct {
 	Else      Expr
 }
 
+// AssignExpr is an assignment used as a value, written in parentheses as
+// in while ((line = next()) != null), or the value of another assignment
+// as in a = b = 0. It evaluates to the value stored. Target and Op are as
+// in AssignStmt, except that the target cannot be a pattern.
+type AssignExpr struct {
+	ExprBase
+	Target Expr
+	Value  Expr
+	Op     token.Kind
+}
+
 // MapLiteral represents a map literal: { key: val, ... }.
 type MapLiteral struct {
 	ExprBase
-	Keys   []Expr // StringLiteral (identifier keys are converted to strings)
+	Keys   []Expr // StringLiteral (identifier keys are converted to strings), or any expression for a computed [key]
 	Values []Expr
 }
 
@@ -181,6 +223,53 @@ type SuperExpr struct {
 	ExprBase
 }
 
+// SpreadExpr represents ...expr in call arguments, which passes the
+// elements of an array as separate arguments.
+type SpreadExpr struct {
+	ExprBase
+	Operand Expr
+}
+
+// ArrayPattern is the target of array destructuring: [a, b] in
+// var [a, b] = pair. Its elements are names, nested patterns or, in
+// assignments, any assignable expression; a last SpreadExpr collects the
+// remaining elements into an array.
+type ArrayPattern struct {
+	ExprBase
+	Elements []Expr
+}
+
+// MapPattern is the target of map destructuring: {x, y: b} in
+// var {x, y: b} = point. Values[i] receives the entry or field Keys[i];
+// for the shorthand {x} it is an IdentExpr named after the key.
+type MapPattern struct {
+	ExprBase
+	Keys   []string
+	Values []Expr
+}
+
+// PatternNames returns the variables a destructuring pattern, or a single
+// identifier, assigns, in source order. Member and index targets are left
+// out.
+func PatternNames(pattern Expr) []string {
+	var names []string
+	switch p := pattern.(type) {
+	case *IdentExpr:
+		names = append(names, p.Name)
+	case *SpreadExpr:
+		names = append(names, PatternNames(p.Operand)...)
+	case *ArrayPattern:
+		for _, elem := range p.Elements {
+			names = append(names, PatternNames(elem)...)
+		}
+	case *MapPattern:
+		for _, value := range p.Values {
+			names = append(names, PatternNames(value)...)
+		}
+	}
+	return names
+}
+
 // TemplateLiteral represents a template string: `text ${expr} text`.
 // Parts has len(Exprs)+1 elements; Parts[i] is the text before Exprs[i].
 type TemplateLiteral struct {
@@ -199,22 +288,33 @@ type ExprStmt struct {
 	Expr Expr
 }
 
-// AssignStmt represents an assignment: target = value.
+// AssignStmt represents an assignment: target = value. A compound
+// assignment such as target += rhs is stored with Value as target + rhs
+// and Op set to the compound token.
 type AssignStmt struct {
 	StmtBase
-	Target Expr // must be a valid lvalue (ident, member, index)
+	Target Expr // must be a valid lvalue (ident, member, index) or a pattern
 	Value  Expr
+	Op     token.Kind // PLUS_ASSIGN etc. for a compound assignment, else ILLEGAL
 }
 
-// VarDeclStmt represents a variable declaration: var x = expr / const x = expr.
+// VarDeclStmt represents a variable declaration: var x = expr / const x = expr,
+// or var a, b = expr, which unpacks an array into several variables. let
+// declares like var, but says that hiding a variable of an enclosing scope
+// is intended.
 type VarDeclStmt struct {
 	StmtBase
-	Name    string
-	IsConst bool
-	Init    Expr // may be nil if no initializer
+	Name     string
+	IsConst  bool
+	IsLet    bool
+	Init     Expr     // may be nil if no initializer
+	Names    []string // every declared name when unpacking (Name is Names[0]), nil otherwise
+	Pattern  Expr     // ArrayPattern or MapPattern when destructuring, nil otherwise; Names lists its names
+	Exported bool     // declared with 'export' at the top level
 }
 
-// ReturnStmt represents a return statement.
+// ReturnStmt represents a return statement. return a, b is parsed with an
+// ArrayLiteral value holding each result.
 type ReturnStmt struct {
 	StmtBase
 	Value Expr // may be nil
@@ -269,11 +369,17 @@ type ForStmt struct {
 }
 
 // ForOfStmt represents a for-of loop: for (var name of iterable) { body }.
+// for (var k, v of iterable) binds each index or key to KeyName and each
+// element or value to VarName. for (var [a, b] of pairs) destructures each
+// element into Pattern instead.
 type ForOfStmt struct {
 	StmtBase
 	VarName  string
 	Iterable Expr
 	Body     *BlockStmt
+	KeyName  string // first variable of the two-variable form, empty otherwise
+	Pattern  Expr   // ArrayPattern or MapPattern, nil unless destructuring
+	IsLet    bool   // declared with let instead of var
 }
 
 // TryStmt represents a try/catch block.
@@ -307,6 +413,16 @@ type MatchArm struct {
 	IsDefault bool       // true for _ => ...
 }
 
+// ImportStmt represents an import: import "path", import native "name", or
+// a data import: import name from "path" [as text|json].
+type ImportStmt struct {
+	StmtBase
+	Path   string // module path, data file path or native extension name
+	Native bool   // true for native (Go plugin) extensions
+	Name   string // variable bound by a data import, empty otherwise
+	As     string // format after 'as' in a data import ("text" or "json"), may be empty
+}
+
 // ============================================================
 // Declarations (also implement Stmt for top-level use)
 // ============================================================
@@ -314,19 +430,34 @@ type MatchArm struct {
 // FuncDecl represents a function declaration: function name(params) { ... }.
 type FuncDecl struct {
 	StmtBase
-	Name   string
-	Params []string
-	Body   *BlockStmt
+	Name      string
+	Params    []string
+	Body      *BlockStmt
+	Doc       string // text of the /// or // comment lines right above, if any
+	Exported  bool   // declared with 'export'
+	Rest      bool   // the last parameter collects the remaining arguments (...name)
+	Generator bool   // the body contains yield
+	Async     bool   // declared with async: calling it returns a promise
 }
 
-// ClassDecl represents a class declaration.
+// ClassDecl represents a class declaration. A record declaration,
+// record Point(x, y), is a ClassDecl with Record set and no constructor.
 type ClassDecl struct {
 	StmtBase
-	Name        string
-	SuperClass  string   // may be empty if no extends
-	Implements  []string // interface names (may be empty)
-	Constructor *ConstructorDecl // may be nil
-	Methods     []*MethodDecl
+	Name          string
+	SuperClass    string           // may be empty if no extends
+	Implements    []string         // interface names (may be empty)
+	Constructor   *ConstructorDecl // may be nil
+	Methods       []*MethodDecl
+	Statics       []*StaticFieldDecl
+	Record        bool          // declared as record Name(fields...)
+	Fields        []string      // record fields, in constructor order
+	Doc           string        // text of the /// or // comment lines right above, if any
+	Exported      bool          // declared with 'export'
+	StaticMethods []*MethodDecl // static NAME(params) { ... }, called on the class
+	Props         []*FieldDecl  // declared instance fields, set before the constructor runs
+	Getters       []*MethodDecl // get NAME() { ... }, run when obj.NAME is read
+	Setters       []*MethodDecl // set NAME(v) { ... }, run when obj.NAME is assigned
 }
 
 // EnumDecl represents an enum declaration: enum Name { Variant1, Variant2, ... }.
@@ -334,13 +465,15 @@ type EnumDecl struct {
 	StmtBase
 	Name     string
 	Variants []string
+	Exported bool // declared with 'export'
 }
 
 // InterfaceDecl represents an interface declaration.
 type InterfaceDecl struct {
 	StmtBase
-	Name    string
-	Methods []InterfaceMethodSig
+	Name     string
+	Methods  []InterfaceMethodSig
+	Exported bool // declared with 'export'
 }
 
 // InterfaceMethodSig represents a method signature in an interface.
@@ -354,12 +487,61 @@ type ConstructorDecl struct {
 	Span   span.Span
 	Params []string
 	Body   *BlockStmt
+	Rest   bool // the last parameter collects the remaining arguments (...name)
+}
+
+// StaticFieldDecl represents a class-level field: static NAME = expr, or
+// static const NAME = expr for one that cannot be reassigned.
+type StaticFieldDecl struct {
+	Span    span.Span
+	Name    string
+	Value   Expr // may be nil (initialized to null)
+	IsConst bool
+}
+
+// FieldDecl represents a declared instance field: NAME [= expr]. The
+// initializer is evaluated for each new instance, with 'this' bound to it.
+type FieldDecl struct {
+	Span  span.Span
+	Name  string
+	Value Expr   // may be nil (initialized to null)
+	Doc   string // text of the /// or // comment lines right above, if any
 }
 
 // MethodDecl represents a method inside a class.
 type MethodDecl struct {
-	Span   span.Span
-	Name   string
-	Params []string
-	Body   *BlockStmt
+	Span      span.Span
+	Name      string
+	Params    []string
+	Body      *BlockStmt
+	Doc       string // text of the /// or // comment lines right above, if any
+	Rest      bool   // the last parameter collects the remaining arguments (...name)
+	Generator bool   // the body contains yield
+	Async     bool   // declared with async: calling it returns a promise
+}
+
+// FormatParams writes a parameter list as it appears in source, with the
+// rest parameter, if any, as ...name.
+func FormatParams(params []string, rest bool) string {
+	if rest && len(params) > 0 {
+		last := len(params) - 1
+		return strings.Join(append(params[:last:last], "..."+params[last]), ", ")
+	}
+	return strings.Join(params, ", ")
+}
+
+// ============================================================
+// Error placeholders
+// ============================================================
+
+// BadExpr stands in for an expression that failed to parse. Its span covers
+// the offending token, so tools can still locate the error in the tree.
+type BadExpr struct {
+	ExprBase
+}
+
+// BadStmt stands in for a statement or declaration that failed to parse.
+// Its span covers the tokens skipped during error recovery.
+type BadStmt struct {
+	StmtBase
 }
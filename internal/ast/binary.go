@@ -0,0 +1,387 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+)
+
+// ============================================================
+// Binary AST encoding
+// ============================================================
+//
+// EncodeBinary produces a compact, self-describing-free encoding of an AST:
+//
+//	header:  "LTAST" uvarint(SchemaVersion) uint32(SchemaFingerprint)
+//	node:    uvarint(tag) fields...        (tag 0 = nil)
+//
+// Node fields are written in struct declaration order: ints as varints,
+// strings and slices length-prefixed, floats as IEEE-754 bits, pointers to
+// non-node structs with a presence byte. Tags index nodeTypes, which is
+// append-only so that tags stay stable across releases.
+
+// SchemaVersion identifies the binary encoding layout. Bump it when the
+// encoding rules themselves change.
+const SchemaVersion = 1
+
+var binaryMagic = []byte("LTAST")
+
+// nodeTypes lists every concrete node type. Tag i+1 refers to nodeTypes[i].
+// Append new node types at the end; never reorder.
+var nodeTypes = []reflect.Type{
+	reflect.TypeOf(File{}),
+	reflect.TypeOf(IdentExpr{}),
+	reflect.TypeOf(IntLiteral{}),
+	reflect.TypeOf(FloatLiteral{}),
+	reflect.TypeOf(StringLiteral{}),
+	reflect.TypeOf(BoolLiteral{}),
+	reflect.TypeOf(NullLiteral{}),
+	reflect.TypeOf(ThisExpr{}),
+	reflect.TypeOf(UnaryExpr{}),
+	reflect.TypeOf(BinaryExpr{}),
+	reflect.TypeOf(CallExpr{}),
+	reflect.TypeOf(IndexExpr{}),
+	reflect.TypeOf(MemberExpr{}),
+	reflect.TypeOf(NewExpr{}),
+	reflect.TypeOf(ArrayLiteral{}),
+	reflect.TypeOf(FuncExpr{}),
+	reflect.TypeOf(TernaryExpr{}),
+	reflect.TypeOf(MapLiteral{}),
+	reflect.TypeOf(SuperExpr{}),
+	reflect.TypeOf(TemplateLiteral{}),
+	reflect.TypeOf(ExprStmt{}),
+	reflect.TypeOf(AssignStmt{}),
+	reflect.TypeOf(VarDeclStmt{}),
+	reflect.TypeOf(ReturnStmt{}),
+	reflect.TypeOf(BreakStmt{}),
+	reflect.TypeOf(ContinueStmt{}),
+	reflect.TypeOf(BlockStmt{}),
+	reflect.TypeOf(IfStmt{}),
+	reflect.TypeOf(WhileStmt{}),
+	reflect.TypeOf(ForStmt{}),
+	reflect.TypeOf(ForOfStmt{}),
+	reflect.TypeOf(TryStmt{}),
+	reflect.TypeOf(ThrowStmt{}),
+	reflect.TypeOf(MatchStmt{}),
+	reflect.TypeOf(ImportStmt{}),
+	reflect.TypeOf(FuncDecl{}),
+	reflect.TypeOf(ClassDecl{}),
+	reflect.TypeOf(EnumDecl{}),
+	reflect.TypeOf(InterfaceDecl{}),
+	reflect.TypeOf(BadExpr{}),
+	reflect.TypeOf(BadStmt{}),
+	reflect.TypeOf(SpreadExpr{}),
+	reflect.TypeOf(ArrayPattern{}),
+	reflect.TypeOf(MapPattern{}),
+	reflect.TypeOf(YieldExpr{}),
+	reflect.TypeOf(SpawnExpr{}),
+	reflect.TypeOf(AwaitExpr{}),
+	reflect.TypeOf(AssignExpr{}),
+}
+
+var nodeTags = func() map[reflect.Type]uint64 {
+	tags := make(map[reflect.Type]uint64, len(nodeTypes))
+	for idx, t := range nodeTypes {
+		tags[t] = uint64(idx + 1)
+	}
+	return tags
+}()
+
+// SchemaFingerprint is a hash of the shape of every node type. It changes
+// whenever a node field is added, removed, renamed or retyped, so encodings
+// produced by an older build are rejected instead of misread.
+var SchemaFingerprint = func() uint32 {
+	h := fnv.New32a()
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		fmt.Fprintf(h, "%s/%s;", t.Name(), t.Kind())
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice:
+			walk(t.Elem())
+		case reflect.Struct:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+			for idx := 0; idx < t.NumField(); idx++ {
+				f := t.Field(idx)
+				fmt.Fprintf(h, "%s:", f.Name)
+				walk(f.Type)
+			}
+		}
+	}
+	for _, t := range nodeTypes {
+		walk(t)
+	}
+	return h.Sum32()
+}()
+
+var nodeInterface = reflect.TypeOf((*Node)(nil)).Elem()
+
+// EncodeBinary serializes an AST node (usually a *File).
+func EncodeBinary(n Node) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(binaryMagic)
+	buf.Write(binary.AppendUvarint(nil, SchemaVersion))
+	buf.Write(binary.BigEndian.AppendUint32(nil, SchemaFingerprint))
+	e := &binEncoder{buf: &buf}
+	if err := e.node(reflect.ValueOf(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeBinary parses data produced by EncodeBinary.
+func DecodeBinary(data []byte) (Node, error) {
+	if !bytes.HasPrefix(data, binaryMagic) {
+		return nil, errors.New("ast: not a binary AST")
+	}
+	d := &binDecoder{data: data[len(binaryMagic):]}
+	version, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if version != SchemaVersion {
+		return nil, fmt.Errorf("ast: binary AST schema version %d, want %d", version, SchemaVersion)
+	}
+	if len(d.data) < 4 {
+		return nil, errors.New("ast: truncated binary AST header")
+	}
+	if fp := binary.BigEndian.Uint32(d.data); fp != SchemaFingerprint {
+		return nil, fmt.Errorf("ast: binary AST schema fingerprint %08x, want %08x", fp, SchemaFingerprint)
+	}
+	d.data = d.data[4:]
+
+	v, err := d.node()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("ast: %d trailing bytes after binary AST", len(d.data))
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	return v.Interface().(Node), nil
+}
+
+// ---- encoder ----
+
+type binEncoder struct {
+	buf *bytes.Buffer
+}
+
+func (e *binEncoder) uvarint(n uint64) { e.buf.Write(binary.AppendUvarint(nil, n)) }
+func (e *binEncoder) varint(n int64)   { e.buf.Write(binary.AppendVarint(nil, n)) }
+
+// node writes a tagged node; v holds a node pointer or is nil.
+func (e *binEncoder) node(v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		e.uvarint(0)
+		return nil
+	}
+	tag, ok := nodeTags[v.Type().Elem()]
+	if v.Kind() != reflect.Ptr || !ok {
+		return fmt.Errorf("ast: cannot encode node of type %s", v.Type())
+	}
+	e.uvarint(tag)
+	return e.value(v.Elem())
+}
+
+func (e *binEncoder) value(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			if err := e.value(v.Field(idx)); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		return e.node(v)
+	case reflect.Ptr:
+		if v.Type().Implements(nodeInterface) {
+			return e.node(v)
+		}
+		if v.IsNil() {
+			e.buf.WriteByte(0)
+			return nil
+		}
+		e.buf.WriteByte(1)
+		return e.value(v.Elem())
+	case reflect.Slice:
+		e.uvarint(uint64(v.Len()))
+		for idx := 0; idx < v.Len(); idx++ {
+			if err := e.value(v.Index(idx)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		e.uvarint(uint64(v.Len()))
+		e.buf.WriteString(v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(1)
+		} else {
+			e.buf.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.varint(v.Int())
+	case reflect.Float64, reflect.Float32:
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v.Float())))
+	default:
+		return fmt.Errorf("ast: cannot encode field of kind %s", v.Kind())
+	}
+	return nil
+}
+
+// ---- decoder ----
+
+type binDecoder struct {
+	data []byte
+}
+
+var errTruncated = errors.New("ast: truncated binary AST")
+
+func (d *binDecoder) uvarint() (uint64, error) {
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 {
+		return 0, errTruncated
+	}
+	d.data = d.data[size:]
+	return n, nil
+}
+
+func (d *binDecoder) varint() (int64, error) {
+	n, size := binary.Varint(d.data)
+	if size <= 0 {
+		return 0, errTruncated
+	}
+	d.data = d.data[size:]
+	return n, nil
+}
+
+func (d *binDecoder) byte() (byte, error) {
+	if len(d.data) == 0 {
+		return 0, errTruncated
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b, nil
+}
+
+// length reads a length prefix, rejecting lengths the remaining input cannot hold.
+func (d *binDecoder) length() (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// node reads a tagged node, returning the zero Value for nil.
+func (d *binDecoder) node() (reflect.Value, error) {
+	tag, err := d.uvarint()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if tag == 0 {
+		return reflect.Value{}, nil
+	}
+	if tag > uint64(len(nodeTypes)) {
+		return reflect.Value{}, fmt.Errorf("ast: unknown node tag %d", tag)
+	}
+	ptr := reflect.New(nodeTypes[tag-1])
+	if err := d.value(ptr.Elem()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr, nil
+}
+
+// setNode stores a decoded node into dst, checking it has a compatible type.
+func (d *binDecoder) setNode(dst reflect.Value) error {
+	n, err := d.node()
+	if err != nil || !n.IsValid() {
+		return err
+	}
+	if !n.Type().AssignableTo(dst.Type()) {
+		return fmt.Errorf("ast: %s is not valid where %s is expected", n.Type().Elem().Name(), dst.Type())
+	}
+	dst.Set(n)
+	return nil
+}
+
+func (d *binDecoder) value(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			if err := d.value(v.Field(idx)); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		return d.setNode(v)
+	case reflect.Ptr:
+		if v.Type().Implements(nodeInterface) {
+			return d.setNode(v)
+		}
+		present, err := d.byte()
+		if err != nil || present == 0 {
+			return err
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		return d.value(v.Elem())
+	case reflect.Slice:
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil // keep empty slices nil, as the parser produces them
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for idx := 0; idx < n; idx++ {
+			if err := d.value(v.Index(idx)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(d.data[:n]))
+		d.data = d.data[n:]
+	case reflect.Bool:
+		b, err := d.byte()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := d.varint()
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64, reflect.Float32:
+		if len(d.data) < 8 {
+			return errTruncated
+		}
+		v.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(d.data)))
+		d.data = d.data[8:]
+	default:
+		return fmt.Errorf("ast: cannot decode field of kind %s", v.Kind())
+	}
+	return nil
+}
@@ -39,17 +39,29 @@ func NodeToMap(node Node) map[string]interface{} {
 			"left", NodeToMap(n.Left),
 			"right", NodeToMap(n.Right))
 	case *CallExpr:
-		return m("CallExpr", n.Span,
+		result := m("CallExpr", n.Span,
 			"callee", NodeToMap(n.Callee),
 			"args", exprSlice(n.Args))
+		if n.Optional {
+			result["optional"] = true
+		}
+		return result
 	case *IndexExpr:
-		return m("IndexExpr", n.Span,
+		result := m("IndexExpr", n.Span,
 			"object", NodeToMap(n.Object),
 			"index", NodeToMap(n.Index))
+		if n.Optional {
+			result["optional"] = true
+		}
+		return result
 	case *MemberExpr:
-		return m("MemberExpr", n.Span,
+		result := m("MemberExpr", n.Span,
 			"object", NodeToMap(n.Object),
 			"property", n.Property)
+		if n.Optional {
+			result["optional"] = true
+		}
+		return result
 	case *NewExpr:
 		return m("NewExpr", n.Span,
 			"className", n.ClassName,
@@ -57,12 +69,42 @@ func NodeToMap(node Node) map[string]interface{} {
 	case *ArrayLiteral:
 		return m("ArrayLiteral", n.Span, "elements", exprSlice(n.Elements))
 	case *FuncExpr:
-		return m("FuncExpr", n.Span, "name", n.Name, "params", n.Params, "body", NodeToMap(n.Body))
+		result := m("FuncExpr", n.Span, "name", n.Name, "params", n.Params, "body", NodeToMap(n.Body))
+		if n.Rest {
+			result["rest"] = true
+		}
+		if n.Generator {
+			result["generator"] = true
+		}
+		if n.Async {
+			result["async"] = true
+		}
+		return result
+	case *YieldExpr:
+		return m("YieldExpr", n.Span, "value", NodeToMap(n.Value))
+	case *SpawnExpr:
+		return m("SpawnExpr", n.Span, "call", NodeToMap(n.Call))
+	case *AwaitExpr:
+		return m("AwaitExpr", n.Span, "value", NodeToMap(n.Value))
+	case *SpreadExpr:
+		return m("SpreadExpr", n.Span, "operand", NodeToMap(n.Operand))
+	case *ArrayPattern:
+		return m("ArrayPattern", n.Span, "elements", exprSlice(n.Elements))
+	case *MapPattern:
+		return m("MapPattern", n.Span, "keys", n.Keys, "values", exprSlice(n.Values))
 	case *TernaryExpr:
 		return m("TernaryExpr", n.Span,
 			"condition", NodeToMap(n.Condition),
 			"then", NodeToMap(n.Then),
 			"else", NodeToMap(n.Else))
+	case *AssignExpr:
+		result := m("AssignExpr", n.Span,
+			"target", NodeToMap(n.Target),
+			"value", NodeToMap(n.Value))
+		if n.Op != token.ILLEGAL {
+			result["op"] = n.Op.String()
+		}
+		return result
 	case *MapLiteral:
 		return m("MapLiteral", n.Span,
 			"keys", exprSlice(n.Keys),
@@ -78,14 +120,30 @@ func NodeToMap(node Node) map[string]interface{} {
 	case *ExprStmt:
 		return m("ExprStmt", n.Span, "expr", NodeToMap(n.Expr))
 	case *AssignStmt:
-		return m("AssignStmt", n.Span,
+		result := m("AssignStmt", n.Span,
 			"target", NodeToMap(n.Target),
 			"value", NodeToMap(n.Value))
+		if n.Op != token.ILLEGAL {
+			result["op"] = n.Op.String()
+		}
+		return result
 	case *VarDeclStmt:
 		result := m("VarDeclStmt", n.Span, "name", n.Name, "isConst", n.IsConst)
+		if n.IsLet {
+			result["isLet"] = true
+		}
+		if len(n.Names) > 0 {
+			result["names"] = n.Names
+		}
+		if n.Pattern != nil {
+			result["pattern"] = NodeToMap(n.Pattern)
+		}
 		if n.Init != nil {
 			result["init"] = NodeToMap(n.Init)
 		}
+		if n.Exported {
+			result["exported"] = true
+		}
 		return result
 	case *ReturnStmt:
 		result := m("ReturnStmt", n.Span)
@@ -136,10 +194,20 @@ func NodeToMap(node Node) map[string]interface{} {
 		}
 		return result
 	case *ForOfStmt:
-		return m("ForOfStmt", n.Span,
+		result := m("ForOfStmt", n.Span,
 			"varName", n.VarName,
 			"iterable", NodeToMap(n.Iterable),
 			"body", NodeToMap(n.Body))
+		if n.KeyName != "" {
+			result["keyName"] = n.KeyName
+		}
+		if n.IsLet {
+			result["isLet"] = true
+		}
+		if n.Pattern != nil {
+			result["pattern"] = NodeToMap(n.Pattern)
+		}
+		return result
 	case *TryStmt:
 		result := m("TryStmt", n.Span, "body", NodeToMap(n.Body))
 		if n.CatchBody != nil {
@@ -169,15 +237,44 @@ func NodeToMap(node Node) map[string]interface{} {
 			arms[i] = armMap
 		}
 		return m("MatchStmt", n.Span, "subject", NodeToMap(n.Subject), "arms", arms)
+	case *ImportStmt:
+		result := m("ImportStmt", n.Span, "path", n.Path, "native", n.Native)
+		if n.Name != "" {
+			result["name"] = n.Name
+		}
+		if n.As != "" {
+			result["as"] = n.As
+		}
+		return result
 
 	// ---- Declarations ----
 	case *FuncDecl:
-		return m("FuncDecl", n.Span,
+		result := m("FuncDecl", n.Span,
 			"name", n.Name,
 			"params", n.Params,
 			"body", NodeToMap(n.Body))
+		if n.Doc != "" {
+			result["doc"] = n.Doc
+		}
+		if n.Exported {
+			result["exported"] = true
+		}
+		if n.Rest {
+			result["rest"] = true
+		}
+		if n.Generator {
+			result["generator"] = true
+		}
+		if n.Async {
+			result["async"] = true
+		}
+		return result
 	case *EnumDecl:
-		return m("EnumDecl", n.Span, "name", n.Name, "variants", n.Variants)
+		result := m("EnumDecl", n.Span, "name", n.Name, "variants", n.Variants)
+		if n.Exported {
+			result["exported"] = true
+		}
+		return result
 	case *InterfaceDecl:
 		methods := make([]interface{}, len(n.Methods))
 		for i, m := range n.Methods {
@@ -186,38 +283,108 @@ func NodeToMap(node Node) map[string]interface{} {
 				"paramCount": m.ParamCount,
 			}
 		}
-		return m("InterfaceDecl", n.Span, "name", n.Name, "methods", methods)
+		result := m("InterfaceDecl", n.Span, "name", n.Name, "methods", methods)
+		if n.Exported {
+			result["exported"] = true
+		}
+		return result
 	case *ClassDecl:
 		result := m("ClassDecl", n.Span, "name", n.Name)
+		if n.Doc != "" {
+			result["doc"] = n.Doc
+		}
+		if n.Exported {
+			result["exported"] = true
+		}
 		if n.SuperClass != "" {
 			result["superClass"] = n.SuperClass
 		}
 		if len(n.Implements) > 0 {
 			result["implements"] = n.Implements
 		}
+		if n.Record {
+			result["record"] = true
+			result["fields"] = n.Fields
+		}
 		if n.Constructor != nil {
-			result["constructor"] = map[string]interface{}{
+			ctor := map[string]interface{}{
 				"kind":   "ConstructorDecl",
 				"span":   spanToMap(n.Constructor.Span),
 				"params": n.Constructor.Params,
 				"body":   NodeToMap(n.Constructor.Body),
 			}
+			if n.Constructor.Rest {
+				ctor["rest"] = true
+			}
+			result["constructor"] = ctor
 		}
 		if len(n.Methods) > 0 {
 			methods := make([]interface{}, len(n.Methods))
 			for i, md := range n.Methods {
-				methods[i] = map[string]interface{}{
-					"kind":   "MethodDecl",
-					"span":   spanToMap(md.Span),
-					"name":   md.Name,
-					"params": md.Params,
-					"body":   NodeToMap(md.Body),
-				}
+				methods[i] = methodDeclToMap(md)
 			}
 			result["methods"] = methods
 		}
+		if len(n.Statics) > 0 {
+			statics := make([]interface{}, len(n.Statics))
+			for i, sf := range n.Statics {
+				field := map[string]interface{}{
+					"kind": "StaticFieldDecl",
+					"span": spanToMap(sf.Span),
+					"name": sf.Name,
+				}
+				if sf.Value != nil {
+					field["value"] = NodeToMap(sf.Value)
+				}
+				if sf.IsConst {
+					field["const"] = true
+				}
+				statics[i] = field
+			}
+			result["statics"] = statics
+		}
+		if len(n.Props) > 0 {
+			props := make([]interface{}, len(n.Props))
+			for i, fd := range n.Props {
+				field := map[string]interface{}{
+					"kind": "FieldDecl",
+					"span": spanToMap(fd.Span),
+					"name": fd.Name,
+				}
+				if fd.Value != nil {
+					field["value"] = NodeToMap(fd.Value)
+				}
+				if fd.Doc != "" {
+					field["doc"] = fd.Doc
+				}
+				props[i] = field
+			}
+			result["props"] = props
+		}
+		for key, accessors := range map[string][]*MethodDecl{"getters": n.Getters, "setters": n.Setters} {
+			if len(accessors) > 0 {
+				methods := make([]interface{}, len(accessors))
+				for i, md := range accessors {
+					methods[i] = methodDeclToMap(md)
+				}
+				result[key] = methods
+			}
+		}
+		if len(n.StaticMethods) > 0 {
+			methods := make([]interface{}, len(n.StaticMethods))
+			for i, md := range n.StaticMethods {
+				methods[i] = methodDeclToMap(md)
+			}
+			result["staticMethods"] = methods
+		}
 		return result
 
+	// ---- Error placeholders ----
+	case *BadExpr:
+		return m("BadExpr", n.Span)
+	case *BadStmt:
+		return m("BadStmt", n.Span)
+
 	default:
 		return map[string]interface{}{"kind": "Unknown"}
 	}
@@ -238,6 +405,29 @@ func m(kind string, s span.Span, kvs ...interface{}) map[string]interface{} {
 	return result
 }
 
+func methodDeclToMap(md *MethodDecl) map[string]interface{} {
+	method := map[string]interface{}{
+		"kind":   "MethodDecl",
+		"span":   spanToMap(md.Span),
+		"name":   md.Name,
+		"params": md.Params,
+		"body":   NodeToMap(md.Body),
+	}
+	if md.Doc != "" {
+		method["doc"] = md.Doc
+	}
+	if md.Rest {
+		method["rest"] = true
+	}
+	if md.Generator {
+		method["generator"] = true
+	}
+	if md.Async {
+		method["async"] = true
+	}
+	return method
+}
+
 func spanToMap(s span.Span) map[string]interface{} {
 	return map[string]interface{}{
 		"start": map[string]interface{}{
@@ -0,0 +1,62 @@
+package ast
+
+import (
+	"light-lang/internal/span"
+	"reflect"
+)
+
+var positionType = reflect.TypeOf(span.Position{})
+
+// Shift returns a deep copy of n with every position moved by delta bytes
+// and lineDelta lines. Columns are kept, so it is only correct for a node
+// that starts on a line after the edit being accounted for. Incremental
+// parsing uses it to reuse declarations that follow an edit.
+func Shift(n Node, delta, lineDelta int) Node {
+	if n == nil {
+		return nil
+	}
+	s := shifter{delta: delta, lineDelta: lineDelta}
+	return s.copy(reflect.ValueOf(n)).Interface().(Node)
+}
+
+type shifter struct {
+	delta, lineDelta int
+}
+
+func (s shifter) copy(v reflect.Value) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == positionType {
+			pos := v.Interface().(span.Position)
+			pos.Offset += s.delta
+			pos.Line += s.lineDelta
+			out.Set(reflect.ValueOf(pos))
+			break
+		}
+		for idx := 0; idx < v.NumField(); idx++ {
+			out.Field(idx).Set(s.copy(v.Field(idx)))
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			elem := reflect.New(v.Type().Elem())
+			elem.Elem().Set(s.copy(v.Elem()))
+			out.Set(elem)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			out.Set(s.copy(v.Elem()))
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			items := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			for idx := 0; idx < v.Len(); idx++ {
+				items.Index(idx).Set(s.copy(v.Index(idx)))
+			}
+			out.Set(items)
+		}
+	default:
+		out.Set(v)
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package ast
+
+import "reflect"
+
+// Walk calls visit for n and every node nested in it, parents first. When
+// visit returns false the children of that node are skipped.
+func Walk(n Node, visit func(Node) bool) {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return
+	}
+	if visit(n) {
+		walkValue(reflect.ValueOf(n), visit)
+	}
+}
+
+func walkValue(v reflect.Value, visit func(Node) bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if node, ok := v.Interface().(Node); ok && v.Kind() == reflect.Interface {
+			Walk(node, visit)
+			return
+		}
+		walkValue(v.Elem(), visit)
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			walkValue(v.Field(idx), visit)
+		}
+	case reflect.Slice:
+		for idx := 0; idx < v.Len(); idx++ {
+			walkValue(v.Index(idx), visit)
+		}
+	}
+}
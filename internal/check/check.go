@@ -0,0 +1,419 @@
+// Package check reports likely mistakes in a parsed file without running it.
+// Its findings are warnings: the file is valid and still runs.
+package check
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/diag"
+	"light-lang/internal/span"
+	"light-lang/internal/token"
+)
+
+// Warning codes.
+const (
+	CodeAlwaysFalse = "W3000" // == or != between values that can never be equal
+	CodeShadow      = "W3007" // var or const hiding a name of an enclosing scope
+)
+
+// File returns the warnings for file in source order.
+func File(file *ast.File) []diag.Diagnostic {
+	return run(file).diags
+}
+
+// VarKinds returns what the checker knows about the value of each
+// single-name variable declaration in file, such as "int" or "function".
+// Declarations it cannot tell, including those of variables assigned
+// elsewhere, are left out. Editors use it to describe variables.
+func VarKinds(file *ast.File) map[*ast.VarDeclStmt]string {
+	kinds := make(map[*ast.VarDeclStmt]string)
+	for decl, k := range run(file).varKinds {
+		if k != "" {
+			kinds[decl] = string(k)
+		}
+	}
+	return kinds
+}
+
+func run(file *ast.File) *checker {
+	c := &checker{reassigned: make(map[string]bool), varKinds: make(map[*ast.VarDeclStmt]kind)}
+	for _, node := range file.Body {
+		c.collectAssigned(node)
+	}
+	c.push()
+	for _, node := range file.Body {
+		c.hoist(node)
+	}
+	for _, node := range file.Body {
+		c.node(node)
+	}
+	return c
+}
+
+// kind is what the checker knows statically about a value: "int", "float",
+// "string", "bool", "null", "array", "map", "function", "object", "class",
+// "enum", "interface", or "" when it cannot tell.
+type kind string
+
+// family groups kinds whose values may compare equal; ints and floats do.
+func (k kind) family() string {
+	if k == "int" || k == "float" {
+		return "number"
+	}
+	return string(k)
+}
+
+type checker struct {
+	scopes     []map[string]kind
+	reassigned map[string]bool // names assigned with '=' anywhere, whose kind may change
+	varKinds   map[*ast.VarDeclStmt]kind
+	diags      []diag.Diagnostic
+}
+
+func (c *checker) push() { c.scopes = append(c.scopes, make(map[string]kind)) }
+func (c *checker) pop()  { c.scopes = c.scopes[:len(c.scopes)-1] }
+
+func (c *checker) declare(name string, k kind) {
+	if c.reassigned[name] {
+		k = ""
+	}
+	c.scopes[len(c.scopes)-1][name] = k
+}
+
+func (c *checker) lookup(name string) kind {
+	for idx := len(c.scopes) - 1; idx >= 0; idx-- {
+		if k, ok := c.scopes[idx][name]; ok {
+			return k
+		}
+	}
+	return ""
+}
+
+// collectAssigned records every variable that is the target of an
+// assignment, including destructuring, so declarations of those names are
+// not trusted.
+func (c *checker) collectAssigned(n ast.Node) {
+	ast.Walk(n, func(n ast.Node) bool {
+		switch assign := n.(type) {
+		case *ast.AssignStmt:
+			for _, name := range ast.PatternNames(assign.Target) {
+				c.reassigned[name] = true
+			}
+		case *ast.AssignExpr:
+			for _, name := range ast.PatternNames(assign.Target) {
+				c.reassigned[name] = true
+			}
+		}
+		return true
+	})
+}
+
+// hoist declares the top-level functions, classes, enums and interfaces up
+// front, since function bodies may refer to ones declared later.
+func (c *checker) hoist(n ast.Node) {
+	switch d := n.(type) {
+	case *ast.FuncDecl:
+		c.declare(d.Name, "function")
+	case *ast.ClassDecl:
+		c.declare(d.Name, "class")
+	case *ast.EnumDecl:
+		c.declare(d.Name, "enum")
+	case *ast.InterfaceDecl:
+		c.declare(d.Name, "interface")
+	}
+}
+
+func (c *checker) node(n ast.Node) {
+	switch s := n.(type) {
+	case nil:
+	case *ast.FuncDecl:
+		c.hoist(s)
+		c.function(s.Params, s.Body)
+	case *ast.ClassDecl:
+		c.hoist(s)
+		for _, st := range s.Statics {
+			c.expr(st.Value)
+		}
+		for _, f := range s.Props {
+			c.expr(f.Value)
+		}
+		if s.Constructor != nil {
+			c.function(s.Constructor.Params, s.Constructor.Body)
+		}
+		for _, m := range s.Methods {
+			c.function(m.Params, m.Body)
+		}
+		for _, m := range s.StaticMethods {
+			c.function(m.Params, m.Body)
+		}
+		for _, m := range s.Getters {
+			c.function(m.Params, m.Body)
+		}
+		for _, m := range s.Setters {
+			c.function(m.Params, m.Body)
+		}
+	case *ast.EnumDecl, *ast.InterfaceDecl:
+		c.hoist(s)
+	case *ast.ExprStmt:
+		c.expr(s.Expr)
+	case *ast.AssignStmt:
+		c.expr(s.Target)
+		c.expr(s.Value)
+	case *ast.VarDeclStmt:
+		names := s.Names
+		if len(names) == 0 {
+			names = []string{s.Name}
+		}
+		for _, name := range names {
+			c.shadow(name, s.IsLet, s.Span)
+		}
+		k := c.expr(s.Init)
+		if len(s.Names) > 0 {
+			for _, name := range s.Names {
+				c.declare(name, "")
+			}
+		} else {
+			c.declare(s.Name, k)
+			c.varKinds[s] = c.lookup(s.Name)
+		}
+	case *ast.ReturnStmt:
+		c.expr(s.Value)
+	case *ast.ThrowStmt:
+		c.expr(s.Value)
+	case *ast.BlockStmt:
+		c.block(s)
+	case *ast.IfStmt:
+		c.expr(s.Condition)
+		c.block(s.Body)
+		for _, clause := range s.ElseIfs {
+			c.expr(clause.Condition)
+			c.block(clause.Body)
+		}
+		c.block(s.ElseBody)
+	case *ast.WhileStmt:
+		c.expr(s.Condition)
+		c.block(s.Body)
+	case *ast.ForStmt:
+		c.push()
+		c.node(s.Init)
+		c.expr(s.Condition)
+		c.node(s.Update)
+		c.block(s.Body)
+		c.pop()
+	case *ast.ForOfStmt:
+		c.push()
+		names := []string{s.VarName}
+		switch {
+		case s.Pattern != nil:
+			names = ast.PatternNames(s.Pattern)
+		case s.KeyName != "":
+			names = []string{s.KeyName, s.VarName}
+		}
+		for _, name := range names {
+			c.shadow(name, s.IsLet, s.Span)
+		}
+		c.expr(s.Iterable)
+		for _, name := range names {
+			c.declare(name, "")
+		}
+		c.block(s.Body)
+		c.pop()
+	case *ast.TryStmt:
+		c.block(s.Body)
+		c.push()
+		if s.CatchParam != "" {
+			c.declare(s.CatchParam, "")
+		}
+		c.block(s.CatchBody)
+		c.pop()
+	case *ast.MatchStmt:
+		c.expr(s.Subject)
+		for _, arm := range s.Arms {
+			for _, p := range arm.Patterns {
+				c.expr(p)
+			}
+			c.push()
+			if arm.BindVar != "" {
+				c.declare(arm.BindVar, "")
+			}
+			c.expr(arm.Guard)
+			c.block(arm.Body)
+			c.pop()
+		}
+	case *ast.ImportStmt:
+		if s.Name != "" {
+			c.declare(s.Name, "")
+		}
+	}
+}
+
+func (c *checker) block(b *ast.BlockStmt) {
+	if b == nil {
+		return
+	}
+	c.push()
+	for _, n := range b.Stmts {
+		c.node(n)
+	}
+	c.pop()
+}
+
+// function checks a function body, which shares one scope with the
+// parameters.
+func (c *checker) function(params []string, body *ast.BlockStmt) {
+	c.push()
+	for _, p := range params {
+		c.declare(p, "")
+	}
+	for _, n := range body.Stmts {
+		c.node(n)
+	}
+	c.pop()
+}
+
+// shadow warns when a var or const declaration of name hides a name an
+// enclosing scope declares. Declaring it with let says that is intended.
+func (c *checker) shadow(name string, isLet bool, sp span.Span) {
+	if isLet {
+		return
+	}
+	for idx := len(c.scopes) - 2; idx >= 0; idx-- {
+		if _, ok := c.scopes[idx][name]; ok {
+			d := diag.Warningf(CodeShadow, sp, "'%s' shadows a declaration of an enclosing scope", name)
+			d.Hint = "declare it with let to shadow it on purpose, or rename it"
+			c.diags = append(c.diags, d)
+			return
+		}
+	}
+}
+
+// expr checks e and its subexpressions and returns the kind of e.
+func (c *checker) expr(e ast.Expr) kind {
+	switch x := e.(type) {
+	case nil:
+		return ""
+	case *ast.IntLiteral:
+		return "int"
+	case *ast.FloatLiteral:
+		return "float"
+	case *ast.StringLiteral:
+		return "string"
+	case *ast.BoolLiteral:
+		return "bool"
+	case *ast.NullLiteral:
+		return "null"
+	case *ast.TemplateLiteral:
+		for _, part := range x.Exprs {
+			c.expr(part)
+		}
+		return "string"
+	case *ast.ArrayLiteral:
+		for _, elem := range x.Elements {
+			c.expr(elem)
+		}
+		return "array"
+	case *ast.MapLiteral:
+		for idx := range x.Keys {
+			c.expr(x.Keys[idx])
+			c.expr(x.Values[idx])
+		}
+		return "map"
+	case *ast.FuncExpr:
+		c.function(x.Params, x.Body)
+		return "function"
+	case *ast.NewExpr:
+		for _, arg := range x.Args {
+			c.expr(arg)
+		}
+		return "object"
+	case *ast.IdentExpr:
+		return c.lookup(x.Name)
+	case *ast.UnaryExpr:
+		k := c.expr(x.Operand)
+		switch {
+		case x.Op == token.BANG:
+			return "bool"
+		case x.Op == token.MINUS && k.family() == "number":
+			return k
+		case x.Op == token.TILDE && k == "int":
+			return "int"
+		}
+		return ""
+	case *ast.BinaryExpr:
+		return c.binary(x)
+	case *ast.AssignExpr:
+		c.expr(x.Target)
+		return c.expr(x.Value)
+	case *ast.TernaryExpr:
+		c.expr(x.Condition)
+		then, els := c.expr(x.Then), c.expr(x.Else)
+		if then == els {
+			return then
+		}
+		return ""
+	case *ast.CallExpr:
+		c.expr(x.Callee)
+		for _, arg := range x.Args {
+			c.expr(arg)
+		}
+		return ""
+	case *ast.IndexExpr:
+		c.expr(x.Object)
+		c.expr(x.Index)
+		return ""
+	case *ast.MemberExpr:
+		c.expr(x.Object)
+		return ""
+	case *ast.YieldExpr:
+		c.expr(x.Value)
+		return ""
+	case *ast.SpawnExpr:
+		c.expr(x.Call)
+		return ""
+	case *ast.AwaitExpr:
+		c.expr(x.Value)
+		return ""
+	default:
+		return ""
+	}
+}
+
+func (c *checker) binary(e *ast.BinaryExpr) kind {
+	left, right := c.expr(e.Left), c.expr(e.Right)
+	switch e.Op {
+	case token.EQ, token.NEQ, token.STRICT_EQ, token.STRICT_NEQ:
+		differ := left.family() != right.family()
+		if e.Op == token.STRICT_EQ || e.Op == token.STRICT_NEQ {
+			differ = left != right
+		}
+		if left != "" && right != "" && differ {
+			result := "false"
+			if e.Op == token.NEQ || e.Op == token.STRICT_NEQ {
+				result = "true"
+			}
+			d := diag.Warningf(CodeAlwaysFalse, e.GetSpan(), "comparing %s with %s is always %s", left, right, result)
+			d.Hint = "values of different types are never equal"
+			c.diags = append(c.diags, d)
+		}
+		return "bool"
+	case token.LT, token.LTE, token.GT, token.GTE, token.KW_INSTANCEOF:
+		return "bool"
+	case token.PLUS:
+		if left == "string" || right == "string" {
+			return "string"
+		}
+	}
+	switch e.Op {
+	case token.AMP, token.PIPE, token.CARET, token.SHL, token.SHR:
+		if left == "int" && right == "int" {
+			return "int"
+		}
+	case token.PLUS, token.MINUS, token.STAR, token.SLASH, token.PERCENT:
+		if left == "int" && right == "int" {
+			return "int"
+		}
+		if left.family() == "number" && right.family() == "number" {
+			return "float"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package check
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"strings"
+	"testing"
+)
+
+func checkSource(t *testing.T, source string) []string {
+	t.Helper()
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	file, diags := parser.New(tokens).ParseFile()
+	if len(diags) > 0 {
+		t.Fatalf("parse error: %v", diags[0])
+	}
+	var out []string
+	for _, d := range File(file) {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+func TestAlwaysFalseComparison(t *testing.T) {
+	got := checkSource(t, `function f(x) { return x }
+const limit = 10
+if ("10" == limit) { print("no") }
+print(f == 0, 1 == 1.0, "a" != 1 + 2, [] == null, x == 1)
+var g = f
+print(g == 0)
+`)
+	want := []string{
+		"[W3000] warning at 3:5: comparing string with int is always false (hint: values of different types are never equal)",
+		"[W3000] warning at 4:7: comparing function with int is always false (hint: values of different types are never equal)",
+		"[W3000] warning at 4:25: comparing string with int is always true (hint: values of different types are never equal)",
+		"[W3000] warning at 4:39: comparing array with null is always false (hint: values of different types are never equal)",
+		"[W3000] warning at 6:7: comparing function with int is always false (hint: values of different types are never equal)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStrictComparison(t *testing.T) {
+	got := checkSource(t, `print(1 === 1.0, 1 !== 2.5, 1 === 2, "a" === 1)
+`)
+	want := []string{
+		"[W3000] warning at 1:7: comparing int with float is always false (hint: values of different types are never equal)",
+		"[W3000] warning at 1:18: comparing int with float is always true (hint: values of different types are never equal)",
+		"[W3000] warning at 1:38: comparing string with int is always false (hint: values of different types are never equal)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestComparisonUnknownKinds(t *testing.T) {
+	got := checkSource(t, `function f(x) { return x }
+function g(f) { return f == 0 }
+f = 3
+var n = 1
+n = "one"
+print(f == 0, n == "one", typeOf(n) == 1)
+for (var k = 0; k < 3; k += 1) { if (k == "0") { print(k) } }
+var m = 1
+[m] = ["one"]
+print(m == "one")
+`)
+	if len(got) != 0 {
+		t.Errorf("expected no warnings, got %v", got)
+	}
+}
+
+func TestShadow(t *testing.T) {
+	got := checkSource(t, `var total = 0
+function sum(xs, total) {
+    var n = 0
+    for (var x of xs) { const total = x; n += total }
+    return n
+}
+for (var i = 0; i < 3; i += 1) {
+    for (var i = 0; i < 3; i += 1) {}
+    let total = i
+    for (let x, sum of [1]) {}
+    { var i2 = 1 }
+    { var i2 = 2 }
+}
+`)
+	want := []string{
+		"[W3007] warning at 4:25: 'total' shadows a declaration of an enclosing scope (hint: declare it with let to shadow it on purpose, or rename it)",
+		"[W3007] warning at 8:10: 'i' shadows a declaration of an enclosing scope (hint: declare it with let to shadow it on purpose, or rename it)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestVarKinds(t *testing.T) {
+	tokens, _ := lexer.New("var a = 1\nvar b = \"s\"\nvar c = a\nvar d = 2\nd = 3\nvar e = f()\n", "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	var got []string
+	for _, node := range file.Body {
+		if decl, ok := node.(*ast.VarDeclStmt); ok {
+			got = append(got, decl.Name+"="+VarKinds(file)[decl])
+		}
+	}
+	if want := "a=int b=string c=int d= e="; strings.Join(got, " ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, " "), want)
+	}
+}
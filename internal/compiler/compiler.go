@@ -0,0 +1,890 @@
+// Package compiler translates a parsed file into bytecode for the stack
+// machine in package vm. It covers functions and closures, loops, arrays,
+// maps, templates and calls to builtins and methods. Classes, enums,
+// interfaces, try/throw, match and imports are reported as compile errors;
+// scripts using them run on the tree-walking interpreter.
+package compiler
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/runtime"
+	"light-lang/internal/span"
+	"light-lang/internal/token"
+	"sort"
+)
+
+// Error is a construct the compiler cannot translate.
+type Error struct {
+	Message string
+	Span    span.Span
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("compile error at %d:%d: %s", e.Span.Start.Line, e.Span.Start.Column, e.Message)
+}
+
+// Bytecode is a compiled file: the top-level code and the constant pool
+// every function in it indexes.
+type Bytecode struct {
+	Main      *Function
+	Constants []runtime.Value
+}
+
+// Function is the compiled body of a function, or of the top-level code.
+// Parameters occupy the first local slots.
+type Function struct {
+	Name         string
+	NumParams    int
+	Rest         bool // the last parameter collects the remaining arguments
+	NumLocals    int
+	Instructions []byte
+	LocalNames   []string // declared name of each local slot
+	FreeNames    []string // name of each variable captured from enclosing functions
+	spans        []spanEntry
+}
+
+// spanEntry maps the instructions from offset on to the node they came from.
+type spanEntry struct {
+	offset int
+	span   span.Span
+}
+
+func (f *Function) TypeName() string { return "function" }
+func (f *Function) String() string   { return fmt.Sprintf("<function %s>", f.Name) }
+
+// SpanAt returns the source span of the instruction at offset pos, for
+// runtime errors.
+func (f *Function) SpanAt(pos int) span.Span {
+	idx := sort.Search(len(f.spans), func(k int) bool { return f.spans[k].offset > pos })
+	if idx == 0 {
+		return span.Span{}
+	}
+	return f.spans[idx-1].span
+}
+
+// Compile translates file. Variables declared at the top level become
+// globals, looked up by name at run time like in the interpreter; all other
+// variables live in numbered local slots.
+func Compile(file *ast.File) (*Bytecode, error) {
+	c := &compiler{constIndex: make(map[runtime.Value]int)}
+	main := &Function{Name: "<main>"}
+	captured := make(map[string]bool)
+	for _, node := range file.Body {
+		collectCaptured(node, captured)
+	}
+	c.fn = &funcState{fn: main, main: true, captured: captured, free: make(map[string]int)}
+	c.push()
+	for _, node := range file.Body {
+		c.node(node)
+	}
+	c.emit(span.Span{}, OpReturnNull)
+	c.pop()
+	main.NumLocals = len(main.LocalNames)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Bytecode{Main: main, Constants: c.constants}, nil
+}
+
+type compiler struct {
+	constants  []runtime.Value
+	constIndex map[runtime.Value]int // pool index of each int, float and string constant
+	fn         *funcState
+	err        *Error // first error; compilation goes on so the tree is still walked
+}
+
+// funcState is the function being compiled.
+type funcState struct {
+	parent   *funcState
+	fn       *Function
+	main     bool                // top-level code, whose outermost scope is the globals
+	scopes   []map[string]*local // block scopes, innermost last
+	captured map[string]bool     // names used inside nested functions
+	free     map[string]int      // index of each captured variable by name
+	freeFrom []freeVar           // where each captured variable lives in the parent
+	loops    []*loop
+}
+
+type local struct {
+	slot        int
+	cell        bool // boxed because a nested function may use it
+	isConst     bool
+	predeclared bool // a function declaration whose cell exists from the block start
+}
+
+type freeVar struct {
+	fromLocal bool // a local slot of the parent, else one of its own free variables
+	index     int
+	isConst   bool
+}
+
+// loop collects the jumps of break and continue statements to patch once
+// the loop's end and continue point are known.
+type loop struct {
+	breaks    []int
+	continues []int
+}
+
+func (c *compiler) fail(s span.Span, format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = &Error{Message: fmt.Sprintf(format, args...), Span: s}
+	}
+}
+
+func (c *compiler) unsupported(s span.Span, what string) {
+	c.fail(s, "the bytecode VM does not support %s yet; run without --vm", what)
+}
+
+// ---- Emitting ----
+
+// emit appends an instruction attributed to s and returns its offset.
+func (c *compiler) emit(s span.Span, op Opcode, operands ...int) int {
+	fn := c.fn.fn
+	pos := len(fn.Instructions)
+	if n := len(fn.spans); n == 0 || fn.spans[n-1].span != s {
+		fn.spans = append(fn.spans, spanEntry{pos, s})
+	}
+	fn.Instructions = append(fn.Instructions, Make(op, operands...)...)
+	return pos
+}
+
+// patch points the jump at pos to the current end of the instructions.
+func (c *compiler) patch(pos int) {
+	c.patchTo(pos, len(c.fn.fn.Instructions))
+}
+
+func (c *compiler) patchTo(pos, target int) {
+	if target > 0xffff {
+		c.fail(span.Span{}, "function '%s' is too large", c.fn.fn.Name)
+		return
+	}
+	ins := c.fn.fn.Instructions
+	ins[pos+1], ins[pos+2] = byte(target>>8), byte(target)
+}
+
+func (c *compiler) addConstant(v runtime.Value) int {
+	switch v.(type) {
+	case runtime.IntVal, runtime.FloatVal, runtime.StringVal:
+		if idx, ok := c.constIndex[v]; ok {
+			return idx
+		}
+		c.constIndex[v] = len(c.constants)
+	}
+	if len(c.constants) > 0xffff {
+		c.fail(span.Span{}, "too many constants")
+	}
+	c.constants = append(c.constants, v)
+	return len(c.constants) - 1
+}
+
+func (c *compiler) name(name string) int {
+	return c.addConstant(runtime.StringVal(name))
+}
+
+// ---- Scopes ----
+
+func (c *compiler) push() { c.fn.scopes = append(c.fn.scopes, make(map[string]*local)) }
+func (c *compiler) pop()  { c.fn.scopes = c.fn.scopes[:len(c.fn.scopes)-1] }
+
+// atGlobalScope reports whether declarations made now are globals.
+func (c *compiler) atGlobalScope() bool {
+	return c.fn.main && len(c.fn.scopes) == 1
+}
+
+func (f *funcState) lookup(name string) *local {
+	for idx := len(f.scopes) - 1; idx >= 0; idx-- {
+		if f.main && idx == 0 {
+			break
+		}
+		if l, ok := f.scopes[idx][name]; ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// resolveFree finds name in the functions enclosing f and returns its free
+// variable index in f, capturing it through every function in between.
+func (c *compiler) resolveFree(f *funcState, name string) (int, bool) {
+	if idx, ok := f.free[name]; ok {
+		return idx, true
+	}
+	if f.parent == nil {
+		return 0, false
+	}
+	v := freeVar{}
+	if l := f.parent.lookup(name); l != nil {
+		v = freeVar{fromLocal: true, index: l.slot, isConst: l.isConst}
+	} else if idx, ok := c.resolveFree(f.parent, name); ok {
+		v = freeVar{index: idx, isConst: f.parent.freeFrom[idx].isConst}
+	} else {
+		return 0, false
+	}
+	f.free[name] = len(f.freeFrom)
+	f.freeFrom = append(f.freeFrom, v)
+	f.fn.FreeNames = append(f.fn.FreeNames, name)
+	return f.free[name], true
+}
+
+// declare allocates a local slot for name in the innermost scope.
+func (c *compiler) declare(name string, isConst bool, s span.Span) *local {
+	scope := c.fn.scopes[len(c.fn.scopes)-1]
+	if _, exists := scope[name]; exists {
+		c.fail(s, "variable '%s' already declared in this scope", name)
+	}
+	fn := c.fn.fn
+	if len(fn.LocalNames) > 0xff {
+		c.fail(s, "too many local variables in function '%s'", fn.Name)
+	}
+	l := &local{slot: len(fn.LocalNames), cell: c.fn.captured[name], isConst: isConst}
+	fn.LocalNames = append(fn.LocalNames, name)
+	scope[name] = l
+	return l
+}
+
+// define declares name and stores the value on top of the stack in it.
+func (c *compiler) define(name string, isConst bool, s span.Span) {
+	if c.atGlobalScope() {
+		flag := 0
+		if isConst {
+			flag = 1
+		}
+		c.emit(s, OpDefineGlobal, c.name(name), flag)
+		return
+	}
+	l := c.declare(name, isConst, s)
+	c.emit(s, OpSetLocal, l.slot)
+	if l.cell {
+		c.emit(s, OpMakeCell, l.slot)
+	}
+}
+
+// predeclare gives the captured functions declared in a block their cells
+// up front, so functions declared earlier in the block can call them.
+func (c *compiler) predeclare(stmts []ast.Node) {
+	if c.atGlobalScope() {
+		return
+	}
+	for _, node := range stmts {
+		if d, ok := node.(*ast.FuncDecl); ok && c.fn.captured[d.Name] {
+			l := c.declare(d.Name, false, d.Span)
+			l.predeclared = true
+			c.emit(d.Span, OpNewCell, l.slot)
+		}
+	}
+}
+
+func (c *compiler) load(name string, s span.Span) {
+	if l := c.fn.lookup(name); l != nil {
+		if l.cell {
+			c.emit(s, OpGetCell, l.slot)
+		} else {
+			c.emit(s, OpGetLocal, l.slot)
+		}
+		return
+	}
+	if idx, ok := c.resolveFree(c.fn, name); ok {
+		c.emit(s, OpGetFree, idx)
+		return
+	}
+	c.emit(s, OpGetGlobal, c.name(name))
+}
+
+func (c *compiler) store(name string, s span.Span) {
+	if l := c.fn.lookup(name); l != nil {
+		if l.isConst {
+			c.fail(s, "cannot assign to constant '%s'", name)
+		}
+		if l.cell {
+			c.emit(s, OpSetCell, l.slot)
+		} else {
+			c.emit(s, OpSetLocal, l.slot)
+		}
+		return
+	}
+	if idx, ok := c.resolveFree(c.fn, name); ok {
+		if c.fn.freeFrom[idx].isConst {
+			c.fail(s, "cannot assign to constant '%s'", name)
+		}
+		c.emit(s, OpSetFree, idx)
+		return
+	}
+	c.emit(s, OpSetGlobal, c.name(name))
+}
+
+// collectCaptured adds to names every identifier used inside a function
+// nested in n. Locals with those names are kept in cells.
+func collectCaptured(n ast.Node, names map[string]bool) {
+	ast.Walk(n, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncExpr:
+			body = fn.Body
+		default:
+			return true
+		}
+		ast.Walk(body, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.IdentExpr); ok {
+				names[ident.Name] = true
+			}
+			return true
+		})
+		return false
+	})
+}
+
+// ---- Statements ----
+
+func (c *compiler) node(node ast.Node) {
+	switch s := node.(type) {
+	case *ast.ExprStmt:
+		c.expr(s.Expr)
+		c.emit(s.Span, OpPop)
+	case *ast.VarDeclStmt:
+		c.varDecl(s)
+	case *ast.AssignStmt:
+		c.assign(s)
+	case *ast.ReturnStmt:
+		if s.Value == nil {
+			c.emit(s.Span, OpReturnNull)
+		} else {
+			c.expr(s.Value)
+			c.emit(s.Span, OpReturn)
+		}
+	case *ast.BreakStmt:
+		if len(c.fn.loops) == 0 {
+			c.fail(s.Span, "break outside of loop")
+			return
+		}
+		l := c.fn.loops[len(c.fn.loops)-1]
+		l.breaks = append(l.breaks, c.emit(s.Span, OpJump, 0))
+	case *ast.ContinueStmt:
+		if len(c.fn.loops) == 0 {
+			c.fail(s.Span, "continue outside of loop")
+			return
+		}
+		l := c.fn.loops[len(c.fn.loops)-1]
+		l.continues = append(l.continues, c.emit(s.Span, OpJump, 0))
+	case *ast.BlockStmt:
+		c.block(s)
+	case *ast.IfStmt:
+		c.ifStmt(s)
+	case *ast.WhileStmt:
+		c.whileStmt(s)
+	case *ast.ForStmt:
+		c.forStmt(s)
+	case *ast.ForOfStmt:
+		c.forOf(s)
+	case *ast.FuncDecl:
+		if s.Generator {
+			c.unsupported(s.Span, "generators")
+			return
+		}
+		if s.Async {
+			c.unsupported(s.Span, "async functions")
+			return
+		}
+		c.function(s.Name, s.Params, s.Rest, s.Body, s.Span)
+		if !c.atGlobalScope() {
+			if l := c.fn.scopes[len(c.fn.scopes)-1][s.Name]; l != nil && l.predeclared {
+				c.emit(s.Span, OpSetCell, l.slot)
+				return
+			}
+		}
+		c.define(s.Name, false, s.Span)
+	case *ast.ClassDecl:
+		c.unsupported(s.Span, "classes")
+	case *ast.EnumDecl:
+		c.unsupported(s.Span, "enums")
+	case *ast.InterfaceDecl:
+		c.unsupported(s.Span, "interfaces")
+	case *ast.TryStmt:
+		c.unsupported(s.Span, "try/catch")
+	case *ast.ThrowStmt:
+		c.unsupported(s.Span, "throw")
+	case *ast.MatchStmt:
+		c.unsupported(s.Span, "match")
+	case *ast.ImportStmt:
+		c.unsupported(s.Span, "imports")
+	case *ast.BadStmt:
+		c.fail(s.Span, "cannot run code with syntax errors")
+	default:
+		c.fail(node.GetSpan(), "unhandled statement type: %T", node)
+	}
+}
+
+// stmts compiles the statements of a block whose scope is already pushed.
+func (c *compiler) stmts(stmts []ast.Node) {
+	c.predeclare(stmts)
+	for _, node := range stmts {
+		c.node(node)
+	}
+}
+
+func (c *compiler) block(b *ast.BlockStmt) {
+	c.push()
+	c.stmts(b.Stmts)
+	c.pop()
+}
+
+func (c *compiler) varDecl(s *ast.VarDeclStmt) {
+	if s.Pattern != nil {
+		c.unsupported(s.Span, "destructuring")
+		return
+	}
+	if s.Init != nil {
+		c.expr(s.Init)
+	} else {
+		c.emit(s.Span, OpNull)
+	}
+	if len(s.Names) == 0 {
+		c.define(s.Name, s.IsConst, s.Span)
+		return
+	}
+	if len(s.Names) > 0xff {
+		c.fail(s.Span, "cannot unpack into more than 255 variables")
+	}
+	c.emit(s.Span, OpUnpack, len(s.Names))
+	for _, name := range s.Names {
+		c.define(name, s.IsConst, s.Span)
+	}
+}
+
+func (c *compiler) assign(s *ast.AssignStmt) {
+	if pattern, ok := s.Target.(*ast.ArrayPattern); ok {
+		c.tupleAssign(pattern, s.Value, s.Span)
+		return
+	}
+	c.assignTo(s.Target, s.Value, s.Op, false, s.Span)
+}
+
+// assignTo compiles target = value, or target op= rhs when op is a
+// compound token. With keep the value stored is left on the stack, as an
+// assignment expression needs.
+func (c *compiler) assignTo(target, value ast.Expr, op token.Kind, keep bool, s span.Span) {
+	switch target.(type) {
+	case *ast.MemberExpr, *ast.IndexExpr:
+		if op != token.ILLEGAL {
+			c.compoundAssign(target, value.(*ast.BinaryExpr), keep, s)
+			return
+		}
+	}
+	c.expr(value)
+	if keep {
+		c.emit(s, OpDup, 1)
+	}
+	c.storeTarget(target, s)
+}
+
+// storeTarget compiles storing the value on top of the stack in target.
+func (c *compiler) storeTarget(target ast.Expr, s span.Span) {
+	switch target := target.(type) {
+	case *ast.IdentExpr:
+		c.store(target.Name, s)
+	case *ast.MemberExpr:
+		c.expr(target.Object)
+		c.emit(s, OpSetMember, c.name(target.Property))
+	case *ast.IndexExpr:
+		c.expr(target.Object)
+		c.expr(target.Index)
+		c.emit(s, OpSetIndex)
+	case *ast.ArrayPattern, *ast.MapPattern:
+		c.unsupported(s, "destructuring")
+	default:
+		c.fail(s, "invalid assignment target")
+	}
+}
+
+// tupleAssign compiles [a, b] = value, as written a, b = b, a: the array
+// is unpacked onto the stack and its elements stored in turn. Nested
+// patterns and rest elements are not supported.
+func (c *compiler) tupleAssign(pattern *ast.ArrayPattern, value ast.Expr, s span.Span) {
+	for _, elem := range pattern.Elements {
+		switch elem.(type) {
+		case *ast.IdentExpr, *ast.MemberExpr, *ast.IndexExpr:
+		default:
+			c.unsupported(s, "destructuring")
+			return
+		}
+	}
+	if len(pattern.Elements) > 0xff {
+		c.fail(s, "cannot unpack into more than 255 variables")
+	}
+	c.expr(value)
+	c.emit(s, OpUnpack, len(pattern.Elements))
+	for _, elem := range pattern.Elements {
+		c.storeTarget(elem, elem.GetSpan())
+	}
+}
+
+// compoundAssign compiles a compound assignment to a member or index
+// target. The object and index are evaluated once and duplicated on the
+// stack: one copy reads the current value, the other stores the result.
+func (c *compiler) compoundAssign(target ast.Expr, bin *ast.BinaryExpr, keep bool, s span.Span) {
+	switch target := target.(type) {
+	case *ast.MemberExpr:
+		c.expr(target.Object)
+		c.emit(s, OpDup, 1)
+		c.emit(target.Span, OpGetMember, c.name(target.Property))
+		c.expr(bin.Right)
+		c.emit(bin.Span, OpBinary, int(bin.Op))
+		if keep {
+			// object, result → result, result, object
+			c.emit(s, OpDup, 1)
+			c.emit(s, OpRot, 2)
+		}
+		c.emit(s, OpRot, 1)
+		c.emit(s, OpSetMember, c.name(target.Property))
+	case *ast.IndexExpr:
+		c.expr(target.Object)
+		c.expr(target.Index)
+		c.emit(s, OpDup, 2)
+		c.emit(target.Span, OpIndex)
+		c.expr(bin.Right)
+		c.emit(bin.Span, OpBinary, int(bin.Op))
+		if keep {
+			// object, index, result → result, result, object, index
+			c.emit(s, OpDup, 1)
+			c.emit(s, OpRot, 3)
+		}
+		c.emit(s, OpRot, 2)
+		c.emit(s, OpSetIndex)
+	}
+}
+
+func (c *compiler) ifStmt(s *ast.IfStmt) {
+	var ends []int
+	branch := func(cond ast.Expr, body *ast.BlockStmt, s span.Span) {
+		c.expr(cond)
+		next := c.emit(s, OpJumpIfFalse, 0)
+		c.block(body)
+		ends = append(ends, c.emit(s, OpJump, 0))
+		c.patch(next)
+	}
+	branch(s.Condition, s.Body, s.Span)
+	for _, clause := range s.ElseIfs {
+		branch(clause.Condition, clause.Body, clause.Span)
+	}
+	if s.ElseBody != nil {
+		c.block(s.ElseBody)
+	}
+	for _, pos := range ends {
+		c.patch(pos)
+	}
+}
+
+// enterLoop starts collecting break and continue jumps.
+func (c *compiler) enterLoop() *loop {
+	l := &loop{}
+	c.fn.loops = append(c.fn.loops, l)
+	return l
+}
+
+// exitLoop points the loop's continues at cont and its breaks at the
+// current end of the instructions.
+func (c *compiler) exitLoop(l *loop, cont int) {
+	c.fn.loops = c.fn.loops[:len(c.fn.loops)-1]
+	for _, pos := range l.continues {
+		c.patchTo(pos, cont)
+	}
+	for _, pos := range l.breaks {
+		c.patch(pos)
+	}
+}
+
+func (c *compiler) whileStmt(s *ast.WhileStmt) {
+	start := len(c.fn.fn.Instructions)
+	c.expr(s.Condition)
+	exit := c.emit(s.Span, OpJumpIfFalse, 0)
+	l := c.enterLoop()
+	c.block(s.Body)
+	c.emit(s.Span, OpJump, start)
+	c.patch(exit)
+	c.exitLoop(l, start)
+}
+
+func (c *compiler) forStmt(s *ast.ForStmt) {
+	// Variables declared by the initializer belong to the whole loop
+	c.push()
+	if s.Init != nil {
+		c.node(s.Init)
+	}
+	start := len(c.fn.fn.Instructions)
+	exit := -1
+	if s.Condition != nil {
+		c.expr(s.Condition)
+		exit = c.emit(s.Span, OpJumpIfFalse, 0)
+	}
+	l := c.enterLoop()
+	c.block(s.Body)
+	cont := len(c.fn.fn.Instructions)
+	c.freshCells(s.Init, s.Span)
+	if s.Update != nil {
+		c.node(s.Update)
+	}
+	c.emit(s.Span, OpJump, start)
+	if exit >= 0 {
+		c.patch(exit)
+	}
+	c.exitLoop(l, cont)
+	c.pop()
+}
+
+// freshCells moves the captured variables init declares into new cells
+// before the next iteration of a for loop, so closures created in one
+// iteration keep that iteration's values.
+func (c *compiler) freshCells(init ast.Node, s span.Span) {
+	decl, ok := init.(*ast.VarDeclStmt)
+	if !ok {
+		return
+	}
+	names := decl.Names
+	if len(names) == 0 {
+		names = []string{decl.Name}
+	}
+	for _, name := range names {
+		if l := c.fn.lookup(name); l != nil && l.cell {
+			c.emit(s, OpGetCell, l.slot)
+			c.emit(s, OpSetLocal, l.slot)
+			c.emit(s, OpMakeCell, l.slot)
+		}
+	}
+}
+
+// forOf keeps the iterator on the stack while the body runs. Leaving the
+// loop with break goes through a pop of the iterator; running out of
+// elements pops it in ITER_NEXT.
+func (c *compiler) forOf(s *ast.ForOfStmt) {
+	if s.Pattern != nil {
+		c.unsupported(s.Span, "destructuring")
+		return
+	}
+	c.expr(s.Iterable)
+	c.emit(s.Span, OpIterStart)
+	next := OpIterNext
+	if s.KeyName != "" {
+		next = OpIterPair
+	}
+	start := c.emit(s.Span, next, 0)
+	l := c.enterLoop()
+	c.push()
+	c.define(s.VarName, false, s.Span)
+	if s.KeyName != "" {
+		c.define(s.KeyName, false, s.Span)
+	}
+	c.stmts(s.Body.Stmts)
+	c.pop()
+	c.emit(s.Span, OpJump, start)
+	c.exitLoop(l, start)
+	c.emit(s.Span, OpPop)
+	c.patch(start)
+}
+
+// function compiles a function body into the constant pool and emits the
+// instructions that create a closure of it.
+func (c *compiler) function(name string, params []string, rest bool, body *ast.BlockStmt, s span.Span) {
+	if name == "" {
+		name = "<anonymous>"
+	}
+	fn := &Function{Name: name, NumParams: len(params), Rest: rest}
+	captured := make(map[string]bool)
+	collectCaptured(body, captured)
+	c.fn = &funcState{parent: c.fn, fn: fn, captured: captured, free: make(map[string]int)}
+	// Parameters share the body's scope, as in the interpreter
+	c.push()
+	scope := c.fn.scopes[0]
+	for _, p := range params {
+		l := &local{slot: len(fn.LocalNames), cell: captured[p]}
+		fn.LocalNames = append(fn.LocalNames, p)
+		scope[p] = l
+		if l.cell {
+			c.emit(s, OpMakeCell, l.slot)
+		}
+	}
+	if len(fn.LocalNames) > 0xff {
+		c.fail(s, "too many parameters in function '%s'", name)
+	}
+	c.stmts(body.Stmts)
+	c.emit(body.Span, OpReturnNull)
+	c.pop()
+	fn.NumLocals = len(fn.LocalNames)
+
+	state := c.fn
+	c.fn = state.parent
+	for _, v := range state.freeFrom {
+		if v.fromLocal {
+			c.emit(s, OpLoadCell, v.index)
+		} else {
+			c.emit(s, OpLoadFree, v.index)
+		}
+	}
+	if len(state.freeFrom) > 0xff {
+		c.fail(s, "function '%s' captures too many variables", name)
+	}
+	c.emit(s, OpClosure, c.addConstant(fn), len(state.freeFrom))
+}
+
+// ---- Expressions ----
+
+func (c *compiler) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.IntLiteral:
+		c.emit(e.Span, OpConstant, c.addConstant(runtime.IntVal(e.Value)))
+	case *ast.FloatLiteral:
+		c.emit(e.Span, OpConstant, c.addConstant(runtime.FloatVal(e.Value)))
+	case *ast.StringLiteral:
+		c.emit(e.Span, OpConstant, c.addConstant(runtime.StringVal(e.Value)))
+	case *ast.BoolLiteral:
+		if e.Value {
+			c.emit(e.Span, OpTrue)
+		} else {
+			c.emit(e.Span, OpFalse)
+		}
+	case *ast.NullLiteral:
+		c.emit(e.Span, OpNull)
+	case *ast.IdentExpr:
+		c.load(e.Name, e.Span)
+	case *ast.UnaryExpr:
+		c.expr(e.Operand)
+		switch e.Op {
+		case token.BANG:
+			c.emit(e.Span, OpNot)
+		case token.MINUS:
+			c.emit(e.Span, OpNeg)
+		case token.TILDE:
+			c.emit(e.Span, OpBitNot)
+		default:
+			c.fail(e.Span, "unknown unary operator: %s", e.Op)
+		}
+	case *ast.BinaryExpr:
+		c.binary(e)
+	case *ast.AssignExpr:
+		c.assignTo(e.Target, e.Value, e.Op, true, e.Span)
+	case *ast.TernaryExpr:
+		c.expr(e.Condition)
+		els := c.emit(e.Span, OpJumpIfFalse, 0)
+		c.expr(e.Then)
+		end := c.emit(e.Span, OpJump, 0)
+		c.patch(els)
+		c.expr(e.Else)
+		c.patch(end)
+	case *ast.CallExpr:
+		if e.Optional {
+			c.unsupported(e.Span, "optional chaining")
+			return
+		}
+		c.call(e)
+	case *ast.MemberExpr:
+		if e.Optional {
+			c.unsupported(e.Span, "optional chaining")
+			return
+		}
+		c.expr(e.Object)
+		c.emit(e.Span, OpGetMember, c.name(e.Property))
+	case *ast.IndexExpr:
+		if e.Optional {
+			c.unsupported(e.Span, "optional chaining")
+			return
+		}
+		c.expr(e.Object)
+		c.expr(e.Index)
+		c.emit(e.Span, OpIndex)
+	case *ast.ArrayLiteral:
+		for _, elem := range e.Elements {
+			c.expr(elem)
+		}
+		c.emit(e.Span, OpArray, len(e.Elements))
+	case *ast.MapLiteral:
+		for idx, keyExpr := range e.Keys {
+			c.expr(keyExpr)
+			c.expr(e.Values[idx])
+		}
+		c.emit(e.Span, OpMap, len(e.Keys))
+	case *ast.TemplateLiteral:
+		n := 0
+		for idx, part := range e.Parts {
+			if part != "" {
+				c.emit(e.Span, OpConstant, c.addConstant(runtime.StringVal(part)))
+				n++
+			}
+			if idx < len(e.Exprs) {
+				c.expr(e.Exprs[idx])
+				n++
+			}
+		}
+		c.emit(e.Span, OpConcat, n)
+	case *ast.FuncExpr:
+		if e.Generator {
+			c.unsupported(e.Span, "generators")
+			return
+		}
+		if e.Async {
+			c.unsupported(e.Span, "async functions")
+			return
+		}
+		c.function(e.Name, e.Params, e.Rest, e.Body, e.Span)
+	case *ast.YieldExpr:
+		c.unsupported(e.Span, "generators")
+	case *ast.SpawnExpr:
+		c.unsupported(e.Span, "spawn")
+	case *ast.AwaitExpr:
+		c.unsupported(e.Span, "await")
+	case *ast.ThisExpr:
+		c.unsupported(e.Span, "'this'")
+	case *ast.NewExpr:
+		c.unsupported(e.Span, "classes")
+	case *ast.SuperExpr:
+		c.unsupported(e.Span, "'super'")
+	case *ast.BadExpr:
+		c.fail(e.Span, "cannot run code with syntax errors")
+	default:
+		c.fail(expr.GetSpan(), "unhandled expression type: %T", expr)
+	}
+}
+
+func (c *compiler) binary(e *ast.BinaryExpr) {
+	c.expr(e.Left)
+	if e.Op == token.AND || e.Op == token.OR || e.Op == token.QUESTION_QUESTION {
+		op := OpAndJump
+		switch e.Op {
+		case token.OR:
+			op = OpOrJump
+		case token.QUESTION_QUESTION:
+			op = OpNullJump
+		}
+		end := c.emit(e.Span, op, 0)
+		c.expr(e.Right)
+		c.patch(end)
+		return
+	}
+	c.expr(e.Right)
+	c.emit(e.Span, OpBinary, int(e.Op))
+}
+
+// call evaluates the arguments before the callee, like the interpreter.
+func (c *compiler) call(e *ast.CallExpr) {
+	if _, ok := e.Callee.(*ast.SuperExpr); ok {
+		c.unsupported(e.Span, "'super'")
+		return
+	}
+	if len(e.Args) > 0xff {
+		c.fail(e.Span, "too many arguments in call")
+	}
+	for _, arg := range e.Args {
+		if _, ok := arg.(*ast.SpreadExpr); ok {
+			c.unsupported(arg.GetSpan(), "spread arguments")
+			return
+		}
+		c.expr(arg)
+	}
+	if member, ok := e.Callee.(*ast.MemberExpr); ok {
+		c.expr(member.Object)
+		c.emit(e.Span, OpCallMethod, c.name(member.Property), len(e.Args))
+		return
+	}
+	c.expr(e.Callee)
+	c.emit(e.Span, OpCall, len(e.Args))
+}
@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"strings"
+	"testing"
+)
+
+func compileSource(t *testing.T, source string) (*Bytecode, error) {
+	t.Helper()
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	file, diags := parser.New(tokens).ParseFile()
+	if len(diags) > 0 {
+		t.Fatalf("parse errors: %v", diags)
+	}
+	return Compile(file)
+}
+
+func TestMakeAndDisassemble(t *testing.T) {
+	ins := append(Make(OpConstant, 65534), Make(OpClosure, 3, 2)...)
+	ins = append(ins, Make(OpReturn)...)
+	if len(ins) != 3+4+1 {
+		t.Fatalf("encoded %d bytes, want 8", len(ins))
+	}
+	want := "0000 CONSTANT 65534\n0003 CLOSURE 3 2\n0007 RETURN\n"
+	if got := Disassemble(ins); got != want {
+		t.Errorf("disassembly:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCompileScopes(t *testing.T) {
+	bc, err := compileSource(t, `
+var total = 0
+function counter() {
+    var n = 0
+    var step = 1
+    return function() { n += step; return n }
+}
+if (true) { var local = 2; total = local }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := Disassemble(bc.Main.Instructions)
+	for _, want := range []string{"DEFINE_GLOBAL", "SET_LOCAL 0", "SET_GLOBAL"} {
+		if !strings.Contains(main, want) {
+			t.Errorf("main is missing %s:\n%s", want, main)
+		}
+	}
+
+	var counter *Function
+	for _, c := range bc.Constants {
+		if fn, ok := c.(*Function); ok && fn.Name == "counter" {
+			counter = fn
+		}
+	}
+	if counter == nil {
+		t.Fatal("counter not in the constant pool")
+	}
+	code := Disassemble(counter.Instructions)
+	for _, want := range []string{"MAKE_CELL 0", "MAKE_CELL 1", "LOAD_CELL 0", "LOAD_CELL 1", "CLOSURE"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("counter is missing %s:\n%s", want, code)
+		}
+	}
+	if counter.NumLocals != 2 {
+		t.Errorf("counter has %d locals, want 2", counter.NumLocals)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"class A {}", "compile error at 1:1: the bytecode VM does not support classes yet; run without --vm"},
+		{"try { print(1) } catch (e) {}", "does not support try/catch"},
+		{"var [a, b] = [1, 2]", "does not support destructuring"},
+		{"var a = null\nprint(a?.b)", "does not support optional chaining"},
+		{"function g() { yield 1 }", "does not support generators"},
+		{"var g = () => { yield 1 }", "does not support generators"},
+		{"function f() {}\nvar t = spawn f()", "compile error at 2:9: the bytecode VM does not support spawn yet; run without --vm"},
+		{"async function f() {}", "compile error at 1:1: the bytecode VM does not support async functions yet; run without --vm"},
+		{"var x = await 1", "compile error at 1:9: the bytecode VM does not support await yet; run without --vm"},
+		{"break", "break outside of loop"},
+		{"function f() {\n    const c = 1\n    c = 2\n}", "compile error at 3:5: cannot assign to constant 'c'"},
+		{"function f() {\n    var a = 1\n    var a = 2\n}", "variable 'a' already declared in this scope"},
+	}
+	for _, tt := range tests {
+		_, err := compileSource(t, tt.source)
+		if err == nil {
+			t.Errorf("%q compiled, want error %q", tt.source, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.source, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Opcode is the first byte of an instruction. Operands follow it in
+// big-endian order with the widths listed in definitions.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constants[a]
+	OpNull                   // push null
+	OpTrue                   // push true
+	OpFalse                  // push false
+	OpPop                    // discard the top of the stack
+	OpDup                    // push copies of the top a values
+	OpRot                    // move the top value below the a values under it
+
+	OpBinary // pop right and left, push left <token.Kind(a)> right
+	OpNot    // pop v, push !v
+	OpNeg    // pop v, push -v
+	OpBitNot // pop v, push ~v
+
+	OpJump        // jump to a
+	OpJumpIfFalse // pop v, jump to a if v is falsy
+	OpAndJump     // jump to a keeping v if v is falsy, else pop it
+	OpOrJump      // jump to a keeping v if v is truthy, else pop it
+	OpNullJump    // jump to a keeping v if v is not null, else pop it
+
+	OpGetGlobal    // push the global named constants[a]
+	OpSetGlobal    // pop v into the existing global named constants[a]
+	OpDefineGlobal // pop v into a new global named constants[a], const if b is 1
+	OpGetLocal     // push locals[a]
+	OpSetLocal     // pop v into locals[a]
+	OpMakeCell     // box locals[a] in a cell so closures can share it
+	OpNewCell      // put an empty cell in locals[a], for a function declared later
+	OpGetCell      // push the value in the cell at locals[a]
+	OpSetCell      // pop v into the cell at locals[a]
+	OpLoadCell     // push the cell at locals[a] itself, for OpClosure
+	OpGetFree      // push the value in free cell a of the running closure
+	OpSetFree      // pop v into free cell a of the running closure
+	OpLoadFree     // push free cell a itself, for OpClosure
+	OpClosure      // pop b cells, push a closure of the function constants[a]
+
+	OpCall       // pop the callee, then call it with the a arguments below it
+	OpCallMethod // pop the receiver, then call its method constants[a] with the b arguments below it
+	OpReturn     // return the top of the stack
+	OpReturnNull // return null
+
+	OpArray     // pop a values, push them as an array
+	OpMap       // pop a key/value pairs, push them as a map
+	OpConcat    // pop a values, push their strings joined
+	OpIndex     // pop index and object, push object[index]
+	OpSetIndex  // pop index, object and value, assign object[index] = value
+	OpGetMember // pop object, push object.constants[a]
+	OpSetMember // pop object and value, assign object.constants[a] = value
+	OpUnpack    // pop an array of exactly a elements, push them last first
+
+	OpIterStart // pop an array, map, set, range or string, push an iterator over its elements, keys or characters
+	OpIterNext  // push the iterator's next element, or pop it and jump to a
+	OpIterPair  // push the iterator's next index or key and then its element or value, or pop it and jump to a
+)
+
+type definition struct {
+	name   string
+	widths []int // operand widths in bytes
+}
+
+var definitions = map[Opcode]definition{
+	OpConstant:     {"CONSTANT", []int{2}},
+	OpNull:         {"NULL", nil},
+	OpTrue:         {"TRUE", nil},
+	OpFalse:        {"FALSE", nil},
+	OpPop:          {"POP", nil},
+	OpDup:          {"DUP", []int{1}},
+	OpRot:          {"ROT", []int{1}},
+	OpBinary:       {"BINARY", []int{1}},
+	OpNot:          {"NOT", nil},
+	OpNeg:          {"NEG", nil},
+	OpBitNot:       {"BIT_NOT", nil},
+	OpJump:         {"JUMP", []int{2}},
+	OpJumpIfFalse:  {"JUMP_IF_FALSE", []int{2}},
+	OpAndJump:      {"AND_JUMP", []int{2}},
+	OpOrJump:       {"OR_JUMP", []int{2}},
+	OpNullJump:     {"NULL_JUMP", []int{2}},
+	OpGetGlobal:    {"GET_GLOBAL", []int{2}},
+	OpSetGlobal:    {"SET_GLOBAL", []int{2}},
+	OpDefineGlobal: {"DEFINE_GLOBAL", []int{2, 1}},
+	OpGetLocal:     {"GET_LOCAL", []int{1}},
+	OpSetLocal:     {"SET_LOCAL", []int{1}},
+	OpMakeCell:     {"MAKE_CELL", []int{1}},
+	OpNewCell:      {"NEW_CELL", []int{1}},
+	OpGetCell:      {"GET_CELL", []int{1}},
+	OpSetCell:      {"SET_CELL", []int{1}},
+	OpLoadCell:     {"LOAD_CELL", []int{1}},
+	OpGetFree:      {"GET_FREE", []int{1}},
+	OpSetFree:      {"SET_FREE", []int{1}},
+	OpLoadFree:     {"LOAD_FREE", []int{1}},
+	OpClosure:      {"CLOSURE", []int{2, 1}},
+	OpCall:         {"CALL", []int{1}},
+	OpCallMethod:   {"CALL_METHOD", []int{2, 1}},
+	OpReturn:       {"RETURN", nil},
+	OpReturnNull:   {"RETURN_NULL", nil},
+	OpArray:        {"ARRAY", []int{2}},
+	OpMap:          {"MAP", []int{2}},
+	OpConcat:       {"CONCAT", []int{2}},
+	OpIndex:        {"INDEX", nil},
+	OpSetIndex:     {"SET_INDEX", nil},
+	OpGetMember:    {"GET_MEMBER", []int{2}},
+	OpSetMember:    {"SET_MEMBER", []int{2}},
+	OpUnpack:       {"UNPACK", []int{1}},
+	OpIterStart:    {"ITER_START", nil},
+	OpIterNext:     {"ITER_NEXT", []int{2}},
+	OpIterPair:     {"ITER_PAIR", []int{2}},
+}
+
+// widths caches the total operand width of each opcode for the VM's
+// dispatch loop.
+var widths [256]int
+
+func init() {
+	for op, def := range definitions {
+		for _, w := range def.widths {
+			widths[op] += w
+		}
+	}
+}
+
+// Make encodes one instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def := definitions[op]
+	ins := []byte{byte(op)}
+	for idx, w := range def.widths {
+		switch w {
+		case 1:
+			ins = append(ins, byte(operands[idx]))
+		case 2:
+			ins = binary.BigEndian.AppendUint16(ins, uint16(operands[idx]))
+		}
+	}
+	return ins
+}
+
+// Width returns the size in bytes of the operands of op.
+func Width(op Opcode) int {
+	return widths[op]
+}
+
+// ReadUint16 decodes a 2-byte operand.
+func ReadUint16(ins []byte) int {
+	return int(binary.BigEndian.Uint16(ins))
+}
+
+// Disassemble renders instructions one per line as "offset NAME operands".
+func Disassemble(ins []byte) string {
+	var b strings.Builder
+	for pos := 0; pos < len(ins); {
+		op := Opcode(ins[pos])
+		def, ok := definitions[op]
+		if !ok {
+			fmt.Fprintf(&b, "%04d ?%d\n", pos, op)
+			pos++
+			continue
+		}
+		fmt.Fprintf(&b, "%04d %s", pos, def.name)
+		at := pos + 1
+		for _, w := range def.widths {
+			if w == 1 {
+				fmt.Fprintf(&b, " %d", ins[at])
+			} else {
+				fmt.Fprintf(&b, " %d", ReadUint16(ins[at:]))
+			}
+			at += w
+		}
+		b.WriteByte('\n')
+		pos = at
+	}
+	return b.String()
+}
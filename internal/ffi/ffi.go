@@ -0,0 +1,107 @@
+// Package ffi calls simple C functions in shared libraries.
+//
+// Only scalar signatures are supported: arguments may be int, double or
+// string (a NUL-terminated char*), and results may additionally be void.
+// At most MaxArgs arguments are allowed. Calls are made through
+// precompiled trampolines, so no code is generated at run time.
+//
+// The real implementation needs cgo; other builds get a stub whose
+// functions return ErrUnavailable.
+package ffi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxArgs is the largest number of arguments a foreign function may take.
+const MaxArgs = 3
+
+// ErrUnavailable is returned when the binary was built without cgo.
+var ErrUnavailable = errors.New("ffi: not available in this build (requires cgo)")
+
+// Type is a C scalar type usable in signatures.
+type Type int
+
+const (
+	Void Type = iota
+	Int
+	Double
+	String
+)
+
+var typeNames = map[string]Type{
+	"void":   Void,
+	"int":    Int,
+	"double": Double,
+	"string": String,
+}
+
+func (t Type) String() string {
+	for name, typ := range typeNames {
+		if typ == t {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Signature describes a foreign function.
+type Signature struct {
+	Result Type
+	Params []Type
+}
+
+// ParseSignature parses signatures like "double(double, int)" or "void()".
+func ParseSignature(s string) (Signature, error) {
+	var sig Signature
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(strings.TrimSpace(s), ")") {
+		return sig, fmt.Errorf("ffi: malformed signature %q, want e.g. \"double(double, int)\"", s)
+	}
+	result, ok := typeNames[strings.TrimSpace(s[:open])]
+	if !ok {
+		return sig, fmt.Errorf("ffi: unknown result type %q", strings.TrimSpace(s[:open]))
+	}
+	sig.Result = result
+
+	params := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s[open+1:]), ")"))
+	if params == "" || params == "void" {
+		return sig, nil
+	}
+	for _, p := range strings.Split(params, ",") {
+		typ, ok := typeNames[strings.TrimSpace(p)]
+		if !ok || typ == Void {
+			return sig, fmt.Errorf("ffi: invalid parameter type %q", strings.TrimSpace(p))
+		}
+		sig.Params = append(sig.Params, typ)
+	}
+	if len(sig.Params) > MaxArgs {
+		return sig, fmt.Errorf("ffi: at most %d parameters are supported, got %d", MaxArgs, len(sig.Params))
+	}
+	return sig, nil
+}
+
+// checkArgs validates Go arguments against the signature: int64 for Int,
+// float64 for Double and string for String.
+func (sig Signature) checkArgs(args []interface{}) error {
+	if len(args) != len(sig.Params) {
+		return fmt.Errorf("expects %d argument(s), got %d", len(sig.Params), len(args))
+	}
+	for idx, typ := range sig.Params {
+		ok := false
+		switch args[idx].(type) {
+		case int64:
+			ok = typ == Int
+		case float64:
+			ok = typ == Double
+		case string:
+			ok = typ == String
+		}
+		if !ok {
+			return fmt.Errorf("argument %d must be %s, got %T", idx+1, typ, args[idx])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+//go:build cgo && (linux || darwin)
+
+package ffi
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+
+typedef long long ll;
+
+// ffi_word carries one argument or result in whichever register class the
+// C ABI uses for it.
+typedef union { ll i; double d; } ffi_word;
+
+// Every combination of integer (pointer-sized) and double parameters up to
+// three arguments, for both result classes. kinds has one bit per
+// argument: 1 = double.
+#define R_I(...) out.i = ((ll (*)(__VA_ARGS__))fn)
+#define R_D(...) out.d = ((double (*)(__VA_ARGS__))fn)
+
+static ffi_word ffi_call(void *fn, int nargs, unsigned kinds, int double_result, ffi_word *a) {
+	ffi_word out;
+	out.i = 0;
+	#define CALL0() if (double_result) { R_D(void)(); } else { R_I(void)(); }
+	#define CALL1(T0, v0) if (double_result) { R_D(T0)(v0); } else { R_I(T0)(v0); }
+	#define CALL2(T0, T1, v0, v1) if (double_result) { R_D(T0, T1)(v0, v1); } else { R_I(T0, T1)(v0, v1); }
+	#define CALL3(T0, T1, T2, v0, v1, v2) if (double_result) { R_D(T0, T1, T2)(v0, v1, v2); } else { R_I(T0, T1, T2)(v0, v1, v2); }
+	switch (nargs) {
+	case 0:
+		CALL0();
+		break;
+	case 1:
+		switch (kinds) {
+		case 0: CALL1(ll, a[0].i); break;
+		case 1: CALL1(double, a[0].d); break;
+		}
+		break;
+	case 2:
+		switch (kinds) {
+		case 0: CALL2(ll, ll, a[0].i, a[1].i); break;
+		case 1: CALL2(double, ll, a[0].d, a[1].i); break;
+		case 2: CALL2(ll, double, a[0].i, a[1].d); break;
+		case 3: CALL2(double, double, a[0].d, a[1].d); break;
+		}
+		break;
+	case 3:
+		switch (kinds) {
+		case 0: CALL3(ll, ll, ll, a[0].i, a[1].i, a[2].i); break;
+		case 1: CALL3(double, ll, ll, a[0].d, a[1].i, a[2].i); break;
+		case 2: CALL3(ll, double, ll, a[0].i, a[1].d, a[2].i); break;
+		case 3: CALL3(double, double, ll, a[0].d, a[1].d, a[2].i); break;
+		case 4: CALL3(ll, ll, double, a[0].i, a[1].i, a[2].d); break;
+		case 5: CALL3(double, ll, double, a[0].d, a[1].i, a[2].d); break;
+		case 6: CALL3(ll, double, double, a[0].i, a[1].d, a[2].d); break;
+		case 7: CALL3(double, double, double, a[0].d, a[1].d, a[2].d); break;
+		}
+		break;
+	}
+	return out;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Library is an open shared library.
+type Library struct {
+	Path   string
+	handle unsafe.Pointer
+}
+
+// Open loads a shared library with dlopen.
+func Open(path string) (*Library, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	handle := C.dlopen(cpath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("ffi: cannot open %s: %s", path, C.GoString(C.dlerror()))
+	}
+	return &Library{Path: path, handle: handle}, nil
+}
+
+// Func is a foreign function bound to a signature.
+type Func struct {
+	Name string
+	Sig  Signature
+	ptr  unsafe.Pointer
+}
+
+// Func looks up a symbol and binds it to sig.
+func (l *Library) Func(name string, sig Signature) (*Func, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	ptr := C.dlsym(l.handle, cname)
+	if ptr == nil {
+		return nil, fmt.Errorf("ffi: symbol '%s' not found in %s", name, l.Path)
+	}
+	return &Func{Name: name, Sig: sig, ptr: ptr}, nil
+}
+
+// Call invokes the function. Arguments are int64, float64 or string per the
+// signature; the result is int64, float64, string or nil for void.
+// String results are copied; the C memory is not freed.
+func (f *Func) Call(args []interface{}) (interface{}, error) {
+	if err := f.Sig.checkArgs(args); err != nil {
+		return nil, fmt.Errorf("%s(): %v", f.Name, err)
+	}
+
+	var words [MaxArgs]C.ffi_word
+	var kinds C.uint
+	for idx, arg := range args {
+		switch v := arg.(type) {
+		case int64:
+			*(*C.ll)(unsafe.Pointer(&words[idx])) = C.ll(v)
+		case float64:
+			*(*C.double)(unsafe.Pointer(&words[idx])) = C.double(v)
+			kinds |= 1 << idx
+		case string:
+			cs := C.CString(v)
+			defer C.free(unsafe.Pointer(cs))
+			*(*C.ll)(unsafe.Pointer(&words[idx])) = C.ll(uintptr(unsafe.Pointer(cs)))
+		}
+	}
+
+	doubleResult := C.int(0)
+	if f.Sig.Result == Double {
+		doubleResult = 1
+	}
+	out := C.ffi_call(f.ptr, C.int(len(args)), kinds, doubleResult, &words[0])
+
+	switch f.Sig.Result {
+	case Int:
+		// C int results only define the low 32 bits of the register
+		return int64(int32(*(*C.ll)(unsafe.Pointer(&out)))), nil
+	case Double:
+		return float64(*(*C.double)(unsafe.Pointer(&out))), nil
+	case String:
+		p := *(*unsafe.Pointer)(unsafe.Pointer(&out))
+		if p == nil {
+			return nil, nil
+		}
+		return C.GoString((*C.char)(p)), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !cgo || !(linux || darwin)
+
+package ffi
+
+// Library is an open shared library.
+type Library struct {
+	Path string
+}
+
+// Open always fails: this build has no cgo.
+func Open(path string) (*Library, error) {
+	return nil, ErrUnavailable
+}
+
+// Func is a foreign function bound to a signature.
+type Func struct {
+	Name string
+	Sig  Signature
+}
+
+// Func always fails: this build has no cgo.
+func (l *Library) Func(name string, sig Signature) (*Func, error) {
+	return nil, ErrUnavailable
+}
+
+// Call always fails: this build has no cgo.
+func (f *Func) Call(args []interface{}) (interface{}, error) {
+	return nil, ErrUnavailable
+}
@@ -0,0 +1,77 @@
+package ffi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseSignature(t *testing.T) {
+	sig, err := ParseSignature("double(double, int)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Result != Double || len(sig.Params) != 2 || sig.Params[0] != Double || sig.Params[1] != Int {
+		t.Errorf("unexpected signature: %+v", sig)
+	}
+	if sig, err := ParseSignature("void()"); err != nil || sig.Result != Void || len(sig.Params) != 0 {
+		t.Errorf("void(): got %+v, %v", sig, err)
+	}
+	for _, bad := range []string{"double", "float(int)", "int(void, int)", "int(int, int, int, int)"} {
+		if _, err := ParseSignature(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestCallLibc(t *testing.T) {
+	libm, err := Open("libm.so.6")
+	if err == ErrUnavailable {
+		t.Skip("built without cgo")
+	}
+	if err != nil {
+		t.Skipf("libm not available: %v", err)
+	}
+
+	call := func(lib *Library, name, sig string, args ...interface{}) interface{} {
+		t.Helper()
+		s, err := ParseSignature(sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn, err := lib.Func(name, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := fn.Call(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if got := call(libm, "pow", "double(double, double)", 2.0, 10.0); got != 1024.0 {
+		t.Errorf("pow(2, 10) = %v", got)
+	}
+	if got := call(libm, "ldexp", "double(double, int)", 3.0, int64(2)); got != 12.0 {
+		t.Errorf("ldexp(3, 2) = %v", got)
+	}
+	if got := call(libm, "cos", "double(double)", 0.0).(float64); math.Abs(got-1) > 1e-12 {
+		t.Errorf("cos(0) = %v", got)
+	}
+
+	libc, err := Open("libc.so.6")
+	if err != nil {
+		t.Skipf("libc not available: %v", err)
+	}
+	if got := call(libc, "strlen", "int(string)", "hello"); got != int64(5) {
+		t.Errorf("strlen(\"hello\") = %v", got)
+	}
+	if got := call(libc, "abs", "int(int)", int64(-7)); got != int64(7) {
+		t.Errorf("abs(-7) = %v", got)
+	}
+
+	fn, _ := libc.Func("abs", Signature{Result: Int, Params: []Type{Int}})
+	if _, err := fn.Call([]interface{}{"x"}); err == nil {
+		t.Error("expected argument type error")
+	}
+}
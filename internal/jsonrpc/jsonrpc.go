@@ -0,0 +1,223 @@
+// Package jsonrpc implements JSON-RPC 2.0 over a byte stream using
+// LSP-style "Content-Length" framing.
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Standard JSON-RPC error codes.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Request is an incoming call or notification. ID is nil for notifications.
+type Request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the request expects no response.
+func (r *Request) IsNotification() bool {
+	return r.ID == nil
+}
+
+// Response is the reply to a call.
+type Response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object. Handlers may return it to control the
+// code sent to the client; other errors are reported as InternalError.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// Errorf creates an Error with the given code.
+func Errorf(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conn reads and writes framed messages. Writes are safe for concurrent use.
+type Conn struct {
+	r  *bufio.Reader
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConn creates a connection over r and w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+// MaxMessageSize is the largest Content-Length ReadMessage accepts.
+const MaxMessageSize = 8 << 20
+
+// ReadMessage reads the body of the next framed message.
+// It returns io.EOF when the stream ends cleanly between messages, and an
+// *Error with code InvalidRequest when the message is over MaxMessageSize.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if length < 0 {
+				continue // tolerate blank lines between messages
+			}
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+			length = n
+		}
+	}
+	if length > MaxMessageSize {
+		return nil, Errorf(InvalidRequest, "message of %d bytes is over the %d byte limit", length, MaxMessageSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	return body, nil
+}
+
+// WriteMessage writes v as a framed JSON message.
+func (c *Conn) WriteMessage(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+// Notify sends a notification to the peer.
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.WriteMessage(struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{"2.0", method, params})
+}
+
+// ErrStop is returned by a handler to make Serve return nil without
+// replying, as for the LSP "exit" notification.
+var ErrStop = errors.New("jsonrpc: stop serving")
+
+// Handler handles one request. The returned result is sent back for calls
+// and discarded for notifications.
+type Handler func(req *Request) (interface{}, error)
+
+// Serve reads requests from conn and dispatches them to h one at a time
+// until the stream ends or h returns ErrStop. It returns nil on a clean EOF.
+// A message over MaxMessageSize gets an error response and ends the stream,
+// since its body is left unread.
+func Serve(conn *Conn, h Handler) error {
+	for {
+		body, err := conn.ReadMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if rpcErr, ok := err.(*Error); ok {
+			if err := conn.WriteMessage(&Response{JSONRPC: "2.0", Error: rpcErr}); err != nil {
+				return err
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		var req Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := conn.WriteMessage(&Response{JSONRPC: "2.0", Error: Errorf(ParseError, "%v", err)}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "" {
+			if !req.IsNotification() {
+				if err := conn.WriteMessage(&Response{JSONRPC: "2.0", ID: req.ID, Error: Errorf(InvalidRequest, "missing method")}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		result, err := h(&req)
+		if err == ErrStop {
+			return nil
+		}
+		if req.IsNotification() {
+			continue
+		}
+		resp := &Response{JSONRPC: "2.0", ID: req.ID}
+		if err != nil {
+			rpcErr, ok := err.(*Error)
+			if !ok {
+				rpcErr = Errorf(InternalError, "%v", err)
+			}
+			resp.Error = rpcErr
+		} else {
+			if result == nil {
+				result = struct{}{} // calls always carry a result member
+			}
+			resp.Result = result
+		}
+		if err := conn.WriteMessage(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// DecodeParams unmarshals request params into v, reporting InvalidParams on failure.
+func DecodeParams(req *Request, v interface{}) error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return Errorf(InvalidParams, "%v", err)
+	}
+	return nil
+}
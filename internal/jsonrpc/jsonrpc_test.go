@@ -0,0 +1,99 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func frame(body string) string {
+	return "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+func TestServe(t *testing.T) {
+	in := frame(`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"text":"hi"}}`) +
+		frame(`{"jsonrpc":"2.0","method":"echo","params":{"text":"ignored"}}`) +
+		frame(`{"jsonrpc":"2.0","id":2,"method":"missing"}`) +
+		frame(`not json`)
+	var out bytes.Buffer
+	err := Serve(NewConn(strings.NewReader(in), &out), func(req *Request) (interface{}, error) {
+		if req.Method != "echo" {
+			return nil, Errorf(MethodNotFound, "unknown method '%s'", req.Method)
+		}
+		var params struct{ Text string }
+		if err := DecodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		return params.Text, nil
+	})
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	conn := NewConn(&out, nil)
+	var responses []Response
+	for {
+		body, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var resp Response
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("bad response %s: %v", body, err)
+		}
+		responses = append(responses, resp)
+	}
+
+	// The notification gets no response
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(responses))
+	}
+	if responses[0].Result != "hi" {
+		t.Errorf("expected echo result 'hi', got %v", responses[0].Result)
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != MethodNotFound {
+		t.Errorf("expected MethodNotFound, got %+v", responses[1].Error)
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != ParseError {
+		t.Errorf("expected ParseError, got %+v", responses[2].Error)
+	}
+}
+
+func TestServeStop(t *testing.T) {
+	in := frame(`{"jsonrpc":"2.0","method":"exit"}`) +
+		frame(`{"jsonrpc":"2.0","id":1,"method":"never"}`)
+	calls := 0
+	err := Serve(NewConn(strings.NewReader(in), &bytes.Buffer{}), func(req *Request) (interface{}, error) {
+		calls++
+		return nil, ErrStop
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("expected Serve to stop cleanly after one call, got err %v after %d calls", err, calls)
+	}
+}
+
+func TestServeTooLarge(t *testing.T) {
+	in := "Content-Length: " + strconv.Itoa(MaxMessageSize+1) + "\r\n\r\n{"
+	var out bytes.Buffer
+	err := Serve(NewConn(strings.NewReader(in), &out), func(req *Request) (interface{}, error) {
+		t.Errorf("handler called for an oversized message")
+		return nil, nil
+	})
+	if rpcErr, ok := err.(*Error); !ok || rpcErr.Code != InvalidRequest {
+		t.Fatalf("expected an InvalidRequest error, got %v", err)
+	}
+
+	body, err := NewConn(&out, nil).ReadMessage()
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("bad response %s: %v", body, err)
+	}
+	if resp.Error == nil || resp.Error.Code != InvalidRequest {
+		t.Errorf("expected InvalidRequest response, got %s", body)
+	}
+}
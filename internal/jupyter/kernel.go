@@ -0,0 +1,548 @@
+// Package jupyter implements a Jupyter kernel for light-lang on top of the
+// Jupyter messaging protocol (version 5.3).
+//
+// A kernelspec that launches it looks like:
+//
+//	{
+//	  "argv": ["light", "kernel", "--connection-file", "{connection_file}"],
+//	  "display_name": "light-lang",
+//	  "language": "light"
+//	}
+package jupyter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"light-lang/internal/diag"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/runtime"
+	"light-lang/internal/span"
+	"light-lang/internal/zmtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// ProtocolVersion is the Jupyter messaging protocol version implemented.
+const ProtocolVersion = "5.3"
+
+// delimiter separates routing identities from the signed message parts.
+const delimiter = "<IDS|MSG>"
+
+// ConnectionInfo is the contents of a Jupyter connection file.
+type ConnectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	StdinPort       int    `json:"stdin_port"`
+	ControlPort     int    `json:"control_port"`
+	HBPort          int    `json:"hb_port"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+}
+
+// ReadConnectionFile loads and validates a connection file.
+func ReadConnectionFile(path string) (*ConnectionInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info ConnectionInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid connection file %s: %v", path, err)
+	}
+	if info.Transport != "" && info.Transport != "tcp" {
+		return nil, fmt.Errorf("unsupported transport %q (only tcp is supported)", info.Transport)
+	}
+	if info.Key != "" && info.SignatureScheme != "" && info.SignatureScheme != "hmac-sha256" {
+		return nil, fmt.Errorf("unsupported signature scheme %q", info.SignatureScheme)
+	}
+	return &info, nil
+}
+
+func (c *ConnectionInfo) addr(port int) string {
+	return fmt.Sprintf("%s:%d", c.IP, port)
+}
+
+// Message is a decoded Jupyter message.
+type Message struct {
+	Identities   [][]byte
+	Header       Header
+	ParentHeader json.RawMessage
+	Metadata     map[string]interface{}
+	Content      json.RawMessage
+}
+
+// Header is the header of a Jupyter message.
+type Header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// Kernel serves a single notebook session with one persistent interpreter.
+type Kernel struct {
+	info    *ConnectionInfo
+	key     []byte
+	session string
+
+	shell, control, stdin, iopub, hb *zmtp.Socket
+
+	out            bytes.Buffer // stdout captured for the current cell
+	interp         *runtime.Interpreter
+	executionCount int
+}
+
+// Start binds all kernel sockets described by info.
+func Start(info *ConnectionInfo) (*Kernel, error) {
+	k := &Kernel{
+		info:    info,
+		key:     []byte(info.Key),
+		session: newID(),
+	}
+	k.interp = runtime.NewInterpreter(&k.out)
+
+	sockets := []struct {
+		dst  **zmtp.Socket
+		typ  string
+		port int
+	}{
+		{&k.shell, "ROUTER", info.ShellPort},
+		{&k.control, "ROUTER", info.ControlPort},
+		{&k.stdin, "ROUTER", info.StdinPort},
+		{&k.iopub, "PUB", info.IOPubPort},
+		{&k.hb, "REP", info.HBPort},
+	}
+	for _, s := range sockets {
+		sock, err := zmtp.Listen(s.typ, info.addr(s.port))
+		if err != nil {
+			k.Close()
+			return nil, err
+		}
+		*s.dst = sock
+	}
+	return k, nil
+}
+
+// Close shuts down all sockets.
+func (k *Kernel) Close() {
+	for _, s := range []*zmtp.Socket{k.shell, k.control, k.stdin, k.iopub, k.hb} {
+		if s != nil {
+			s.Close()
+		}
+	}
+}
+
+// request is a message received on the shell or control socket.
+type request struct {
+	sock *zmtp.Socket
+	raw  zmtp.Message
+}
+
+// Serve handles requests until a shutdown_request arrives.
+// Shell and control requests are handled one at a time, in arrival order.
+func (k *Kernel) Serve() error {
+	go k.heartbeat()
+
+	requests := make(chan request)
+	for _, sock := range []*zmtp.Socket{k.shell, k.control, k.stdin} {
+		go func(sock *zmtp.Socket) {
+			for {
+				msg, ok := sock.Recv()
+				if !ok {
+					return
+				}
+				requests <- request{sock, msg}
+			}
+		}(sock)
+	}
+
+	k.publishStatus("starting", nil)
+	for req := range requests {
+		msg, err := k.decode(req.raw.Frames)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "light kernel: dropping message: %v\n", err)
+			continue
+		}
+		if done := k.handle(req, msg); done {
+			return nil
+		}
+	}
+	return nil
+}
+
+// heartbeat echoes every ping back unchanged.
+func (k *Kernel) heartbeat() {
+	for {
+		msg, ok := k.hb.Recv()
+		if !ok {
+			return
+		}
+		k.hb.Reply(msg, msg.Frames)
+	}
+}
+
+// handle dispatches one request and reports whether the kernel should exit.
+func (k *Kernel) handle(req request, msg *Message) bool {
+	k.publishStatus("busy", msg)
+	defer k.publishStatus("idle", msg)
+
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		k.reply(req, msg, "kernel_info_reply", k.kernelInfo())
+
+	case "execute_request":
+		var content struct {
+			Code   string `json:"code"`
+			Silent bool   `json:"silent"`
+		}
+		json.Unmarshal(msg.Content, &content)
+		k.reply(req, msg, "execute_reply", k.execute(msg, content.Code, content.Silent))
+
+	case "is_complete_request":
+		var content struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(msg.Content, &content)
+		k.reply(req, msg, "is_complete_reply", isComplete(content.Code))
+
+	case "complete_request":
+		var content struct {
+			Code      string `json:"code"`
+			CursorPos int    `json:"cursor_pos"`
+		}
+		json.Unmarshal(msg.Content, &content)
+		k.reply(req, msg, "complete_reply", k.complete(content.Code, content.CursorPos))
+
+	case "inspect_request":
+		var content struct {
+			Code      string `json:"code"`
+			CursorPos int    `json:"cursor_pos"`
+		}
+		json.Unmarshal(msg.Content, &content)
+		k.reply(req, msg, "inspect_reply", k.inspect(content.Code, content.CursorPos))
+
+	case "comm_info_request":
+		k.reply(req, msg, "comm_info_reply", map[string]interface{}{
+			"status": "ok",
+			"comms":  map[string]interface{}{},
+		})
+
+	case "interrupt_request":
+		// Cells run to completion on the request loop, so there is nothing to interrupt
+		k.reply(req, msg, "interrupt_reply", map[string]interface{}{"status": "ok"})
+
+	case "shutdown_request":
+		var content struct {
+			Restart bool `json:"restart"`
+		}
+		json.Unmarshal(msg.Content, &content)
+		k.reply(req, msg, "shutdown_reply", map[string]interface{}{
+			"status":  "ok",
+			"restart": content.Restart,
+		})
+		return true
+	}
+	return false
+}
+
+func (k *Kernel) kernelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"status":                 "ok",
+		"protocol_version":       ProtocolVersion,
+		"implementation":         "light",
+		"implementation_version": "0.1",
+		"language_info": map[string]interface{}{
+			"name":           "light",
+			"version":        "0.1",
+			"mimetype":       "text/x-light",
+			"file_extension": ".lt",
+		},
+		"banner": "light-lang kernel",
+	}
+}
+
+// execute runs one cell, publishing its input, captured stdout, result and
+// any error on iopub, and returns the execute_reply content.
+func (k *Kernel) execute(parent *Message, code string, silent bool) map[string]interface{} {
+	if !silent {
+		k.executionCount++
+		k.publish(parent, "execute_input", map[string]interface{}{
+			"code":            code,
+			"execution_count": k.executionCount,
+		})
+	}
+
+	ename, evalue, traceback := "", "", []string(nil)
+	var value runtime.Value = runtime.NullVal{}
+
+	k.out.Reset()
+	tokens, lexDiags := lexer.New(code, "<cell>").Tokenize()
+	file, parseDiags := parser.New(tokens).ParseFile()
+	if diags := append(lexDiags, parseDiags...); len(diags) > 0 {
+		ename, evalue = "SyntaxError", diags[0].Message
+		traceback = formatDiagnostics(code, diags)
+	} else {
+		val, err := k.interp.Eval(file)
+		if err == nil {
+			err = k.interp.RunEventLoop()
+		}
+		if err != nil {
+			ename, evalue, traceback = formatRuntimeError(code, err)
+		} else {
+			value = val
+		}
+	}
+
+	if !silent && k.out.Len() > 0 {
+		k.publish(parent, "stream", map[string]interface{}{
+			"name": "stdout",
+			"text": k.out.String(),
+		})
+	}
+
+	if ename != "" {
+		if !silent {
+			k.publish(parent, "error", map[string]interface{}{
+				"ename":     ename,
+				"evalue":    evalue,
+				"traceback": traceback,
+			})
+		}
+		return map[string]interface{}{
+			"status":          "error",
+			"execution_count": k.executionCount,
+			"ename":           ename,
+			"evalue":          evalue,
+			"traceback":       traceback,
+		}
+	}
+
+	if _, isNull := value.(runtime.NullVal); !isNull && !silent {
+		k.publish(parent, "execute_result", map[string]interface{}{
+			"execution_count": k.executionCount,
+			"data":            map[string]interface{}{"text/plain": value.String()},
+			"metadata":        map[string]interface{}{},
+		})
+	}
+	return map[string]interface{}{
+		"status":           "ok",
+		"execution_count":  k.executionCount,
+		"payload":          []interface{}{},
+		"user_expressions": map[string]interface{}{},
+	}
+}
+
+// isComplete reports whether code can be executed or needs more lines.
+func isComplete(code string) map[string]interface{} {
+	if parser.Incomplete(code) {
+		return map[string]interface{}{"status": "incomplete", "indent": "  "}
+	}
+	tokens, lexDiags := lexer.New(code, "<cell>").Tokenize()
+	_, parseDiags := parser.New(tokens).ParseFile()
+	if len(lexDiags)+len(parseDiags) > 0 {
+		return map[string]interface{}{"status": "invalid"}
+	}
+	return map[string]interface{}{"status": "complete"}
+}
+
+// complete offers global names that extend the identifier before the cursor.
+func (k *Kernel) complete(code string, cursor int) map[string]interface{} {
+	if cursor < 0 || cursor > len(code) {
+		cursor = len(code)
+	}
+	start := cursor
+	for start > 0 && isIdentByte(code[start-1]) {
+		start--
+	}
+	prefix := code[start:cursor]
+	matches := []string{}
+	for _, name := range k.interp.Env().Names() {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return map[string]interface{}{
+		"status":       "ok",
+		"matches":      matches,
+		"cursor_start": start,
+		"cursor_end":   cursor,
+		"metadata":     map[string]interface{}{},
+	}
+}
+
+// inspect describes the global name under the cursor, including the doc
+// comment of a user-defined function or class.
+func (k *Kernel) inspect(code string, cursor int) map[string]interface{} {
+	if cursor < 0 || cursor > len(code) {
+		cursor = len(code)
+	}
+	start, end := cursor, cursor
+	for start > 0 && isIdentByte(code[start-1]) {
+		start--
+	}
+	for end < len(code) && isIdentByte(code[end]) {
+		end++
+	}
+	reply := map[string]interface{}{
+		"status":   "ok",
+		"found":    false,
+		"data":     map[string]interface{}{},
+		"metadata": map[string]interface{}{},
+	}
+	if val, ok := k.interp.Env().Get(code[start:end]); ok && start < end {
+		reply["found"] = true
+		reply["data"] = map[string]interface{}{"text/plain": runtime.DocText(val)}
+	}
+	return reply
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// ---- error display ----
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiBold  = "\x1b[1m"
+	ansiReset = "\x1b[0m"
+)
+
+// formatDiagnostics renders diagnostics as traceback lines with source context.
+func formatDiagnostics(code string, diags []diag.Diagnostic) []string {
+	var lines []string
+	for _, d := range diags {
+		lines = append(lines, ansiRed+d.String()+ansiReset)
+		lines = append(lines, sourceContext(code, d.Span)...)
+	}
+	return lines
+}
+
+// formatRuntimeError renders a runtime failure as (ename, evalue, traceback).
+func formatRuntimeError(code string, err error) (string, string, []string) {
+	var rtErr *runtime.RuntimeError
+	var thrown *runtime.ThrownError
+	switch {
+	case errors.As(err, &rtErr):
+		tb := append([]string{ansiBold + ansiRed + "RuntimeError" + ansiReset + ": " + err.Error()}, sourceContext(code, rtErr.Span)...)
+		return "RuntimeError", rtErr.Message, tb
+	case errors.As(err, &thrown):
+		tb := append([]string{ansiBold + ansiRed + "Uncaught" + ansiReset + ": " + err.Error()}, sourceContext(code, thrown.Span)...)
+		tb = append(tb, strings.Split(strings.TrimRight(thrown.StackTrace(), "\n"), "\n")...)
+		return "Uncaught", thrown.Value.String(), tb
+	default:
+		return "Error", err.Error(), []string{ansiBold + ansiRed + "Error" + ansiReset + ": " + err.Error()}
+	}
+}
+
+// sourceContext returns the offending source line with a caret under the column.
+func sourceContext(code string, s span.Span) []string {
+	lines := strings.Split(code, "\n")
+	if s.Start.Line < 1 || s.Start.Line > len(lines) {
+		return nil
+	}
+	text := lines[s.Start.Line-1]
+	col := s.Start.Column
+	if col < 1 {
+		col = 1
+	}
+	return []string{
+		fmt.Sprintf("%4d | %s", s.Start.Line, text),
+		fmt.Sprintf("     | %s%s^%s", strings.Repeat(" ", col-1), ansiRed, ansiReset),
+	}
+}
+
+// ---- wire format ----
+
+// decode verifies and parses the frames of an incoming message.
+func (k *Kernel) decode(frames [][]byte) (*Message, error) {
+	idx := 0
+	for idx < len(frames) && string(frames[idx]) != delimiter {
+		idx++
+	}
+	if len(frames) < idx+6 {
+		return nil, errors.New("message is missing parts")
+	}
+	parts := frames[idx+2 : idx+6]
+	if len(k.key) > 0 {
+		want := k.sign(parts)
+		if !hmac.Equal([]byte(want), frames[idx+1]) {
+			return nil, errors.New("invalid signature")
+		}
+	}
+	msg := &Message{
+		Identities:   frames[:idx],
+		ParentHeader: json.RawMessage(parts[1]),
+		Content:      json.RawMessage(parts[3]),
+	}
+	if err := json.Unmarshal(parts[0], &msg.Header); err != nil {
+		return nil, fmt.Errorf("bad header: %v", err)
+	}
+	json.Unmarshal(parts[2], &msg.Metadata)
+	return msg, nil
+}
+
+// encode builds the signed frames for a message of msgType.
+func (k *Kernel) encode(identities [][]byte, parent *Message, msgType string, content interface{}) [][]byte {
+	header := Header{
+		MsgID:    newID(),
+		Session:  k.session,
+		Username: "kernel",
+		Date:     time.Now().UTC().Format(time.RFC3339Nano),
+		MsgType:  msgType,
+		Version:  ProtocolVersion,
+	}
+	parentHeader := []byte("{}")
+	if parent != nil {
+		parentHeader, _ = json.Marshal(parent.Header)
+	}
+	headerJSON, _ := json.Marshal(header)
+	contentJSON, _ := json.Marshal(content)
+	parts := [][]byte{headerJSON, parentHeader, []byte("{}"), contentJSON}
+
+	frames := append([][]byte{}, identities...)
+	frames = append(frames, []byte(delimiter), []byte(k.sign(parts)))
+	return append(frames, parts...)
+}
+
+// sign returns the hex HMAC-SHA256 of the message parts, or "" without a key.
+func (k *Kernel) sign(parts [][]byte) string {
+	if len(k.key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (k *Kernel) reply(req request, parent *Message, msgType string, content interface{}) {
+	req.sock.Reply(req.raw, k.encode(parent.Identities, parent, msgType, content))
+}
+
+func (k *Kernel) publish(parent *Message, msgType string, content interface{}) {
+	k.iopub.Publish(k.encode([][]byte{[]byte(msgType)}, parent, msgType, content))
+}
+
+func (k *Kernel) publishStatus(state string, parent *Message) {
+	k.publish(parent, "status", map[string]interface{}{"execution_state": state})
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,148 @@
+package jupyter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"light-lang/internal/zmtp"
+)
+
+// testClient plays the notebook side of a kernel session.
+type testClient struct {
+	t      *testing.T
+	k      *Kernel
+	shell  *zmtp.Conn
+	iopub  *zmtp.Conn
+	signer *Kernel // signs requests with the shared key
+}
+
+func startKernel(t *testing.T) *testClient {
+	t.Helper()
+	info := &ConnectionInfo{IP: "127.0.0.1", Key: "secret", SignatureScheme: "hmac-sha256"}
+	k, err := Start(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(k.Close)
+	go k.Serve()
+
+	shell, err := zmtp.Dial(k.shell.Addr().String(), "DEALER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iopub, err := zmtp.Dial(k.iopub.Addr().String(), "SUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { shell.Close(); iopub.Close() })
+
+	// Wait for the subscription to register, or early messages are dropped
+	for k.iopub.Peers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return &testClient{t: t, k: k, shell: shell, iopub: iopub, signer: &Kernel{key: k.key, session: "client"}}
+}
+
+// request sends msgType on the shell socket and returns the decoded reply.
+func (c *testClient) request(msgType string, content interface{}) *Message {
+	c.t.Helper()
+	if err := c.shell.WriteMessage(c.signer.encode(nil, nil, msgType, content)); err != nil {
+		c.t.Fatal(err)
+	}
+	frames, err := c.shell.ReadMessage()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	msg, err := c.k.decode(frames)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// published collects iopub messages until the kernel reports idle.
+func (c *testClient) published() map[string]json.RawMessage {
+	c.t.Helper()
+	got := map[string]json.RawMessage{}
+	for {
+		frames, err := c.iopub.ReadMessage()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		msg, err := c.k.decode(frames)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if msg.Header.MsgType == "status" && strings.Contains(string(msg.Content), "idle") {
+			return got
+		}
+		got[msg.Header.MsgType] = msg.Content
+	}
+}
+
+func TestKernelExecute(t *testing.T) {
+	c := startKernel(t)
+
+	info := c.request("kernel_info_request", map[string]interface{}{})
+	if info.Header.MsgType != "kernel_info_reply" {
+		t.Fatalf("expected kernel_info_reply, got %s", info.Header.MsgType)
+	}
+	c.published()
+
+	reply := c.request("execute_request", map[string]interface{}{"code": "var x = 40\nprint(\"hi\")\nx + 2"})
+	if !strings.Contains(string(reply.Content), `"status":"ok"`) {
+		t.Errorf("expected ok reply, got %s", reply.Content)
+	}
+	pub := c.published()
+	if !strings.Contains(string(pub["stream"]), `"text":"hi\n"`) {
+		t.Errorf("expected captured stdout, got %s", pub["stream"])
+	}
+	if !strings.Contains(string(pub["execute_result"]), `"text/plain":"42"`) {
+		t.Errorf("expected result 42, got %s", pub["execute_result"])
+	}
+
+	// State persists across cells; errors carry the source line
+	reply = c.request("execute_request", map[string]interface{}{"code": "x + y"})
+	if !strings.Contains(string(reply.Content), `"status":"error"`) {
+		t.Errorf("expected error reply, got %s", reply.Content)
+	}
+	pub = c.published()
+	if !strings.Contains(string(pub["error"]), "undefined variable 'y'") || !strings.Contains(string(pub["error"]), "x + y") {
+		t.Errorf("expected error with source context, got %s", pub["error"])
+	}
+}
+
+func TestKernelInspect(t *testing.T) {
+	c := startKernel(t)
+
+	c.request("execute_request", map[string]interface{}{"code": "/// Doubles n.\nfunction double(n) { return n * 2 }"})
+	c.published()
+
+	reply := c.request("inspect_request", map[string]interface{}{"code": "double(4)", "cursor_pos": 3})
+	if !strings.Contains(string(reply.Content), `"found":true`) ||
+		!strings.Contains(string(reply.Content), `function double(n)\n    Doubles n.`) {
+		t.Errorf("expected doc comment in inspect reply, got %s", reply.Content)
+	}
+	c.published()
+
+	reply = c.request("inspect_request", map[string]interface{}{"code": "missing", "cursor_pos": 7})
+	if !strings.Contains(string(reply.Content), `"found":false`) {
+		t.Errorf("expected found=false, got %s", reply.Content)
+	}
+	c.published()
+}
+
+func TestIsComplete(t *testing.T) {
+	cases := map[string]string{
+		"var x = 1":        "complete",
+		"fn f() {":         "incomplete",
+		"var = = 1\nvar x": "invalid",
+	}
+	for code, want := range cases {
+		if got := isComplete(code)["status"]; got != want {
+			t.Errorf("isComplete(%q) = %v, want %s", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package lexer
+
+import (
+	"light-lang/internal/diag"
+	"light-lang/internal/span"
+	"light-lang/internal/token"
+	"strings"
+)
+
+// ============================================================
+// Incremental re-lexing
+// ============================================================
+
+// Edit replaces Source[Start:End] of a snapshot with Text. Offsets are byte
+// offsets into the source before the edit.
+type Edit struct {
+	Start, End int
+	Text       string
+}
+
+// Snapshot is a tokenized source kept so that later edits can be relexed
+// incrementally. Snapshots are immutable; Apply returns a new one.
+type Snapshot struct {
+	Source   string
+	Filename string
+	Tokens   []token.Token
+	Diags    []diag.Diagnostic
+}
+
+// Scan tokenizes source from scratch.
+func Scan(source, filename string) *Snapshot {
+	tokens, diags := New(source, filename).Tokenize()
+	return &Snapshot{Source: source, Filename: filename, Tokens: tokens, Diags: diags}
+}
+
+// Apply returns the snapshot for the source with e applied. Only the lines
+// around the edit are re-tokenized: lexing restarts at the last line break
+// before the edit and stops at the first line break after it where the
+// lexer is back in step with the old tokens, whose positions are then
+// shifted. The result is identical to scanning the new source from scratch.
+func (s *Snapshot) Apply(e Edit) *Snapshot {
+	e.Start = clamp(e.Start, 0, len(s.Source))
+	e.End = clamp(e.End, e.Start, len(s.Source))
+	source := s.Source[:e.Start] + e.Text + s.Source[e.End:]
+	delta := len(e.Text) - (e.End - e.Start)
+	lineDelta := strings.Count(e.Text, "\n") - strings.Count(s.Source[e.Start:e.End], "\n")
+
+	// Line breaks outside template expressions are points where the lexer
+	// carries no state, so lexing can restart or resynchronize there.
+	restart := 0 // index of the first token to relex
+	restartPos := span.Position{Line: 1, Column: 1}
+	resyncAt := make(map[int]int) // old offset of a line break after the edit -> token index
+	depth := 0
+	for idx, tok := range s.Tokens {
+		switch tok.Kind {
+		case token.TEMPLATE_HEAD:
+			depth++
+		case token.TEMPLATE_TAIL:
+			depth--
+		case token.NEWLINE:
+			if depth != 0 {
+				break
+			}
+			if tok.Span.End.Offset <= e.Start {
+				restart, restartPos = idx+1, tok.Span.End
+			} else if tok.Span.Start.Offset >= e.End {
+				resyncAt[tok.Span.Start.Offset] = idx
+			}
+		}
+	}
+
+	l := &Lexer{source: source, filename: s.Filename, pos: restartPos.Offset, line: restartPos.Line, col: restartPos.Column}
+	editEnd := e.Start + len(e.Text)
+	resume := -1
+	relexed, stopped := l.scan(func(tok token.Token) bool {
+		if tok.Kind != token.NEWLINE || len(l.templateStack) != 0 || tok.Span.Start.Offset < editEnd {
+			return false
+		}
+		idx, ok := resyncAt[tok.Span.Start.Offset-delta]
+		if ok {
+			resume = idx + 1
+		}
+		return ok
+	})
+
+	tokens := make([]token.Token, 0, len(s.Tokens)+delta/4+1)
+	tokens = append(tokens, s.Tokens[:restart]...)
+	tokens = append(tokens, relexed...)
+	var diags []diag.Diagnostic
+	for _, d := range s.Diags {
+		if d.Span.Start.Offset < restartPos.Offset {
+			diags = append(diags, d)
+		}
+	}
+	diags = append(diags, l.diags...)
+
+	if stopped {
+		// Diagnostics past the resync line break are unchanged, including
+		// ones such as an unterminated block comment that start between
+		// tokens.
+		resumeOffset := s.Tokens[resume-1].Span.End.Offset
+		for _, tok := range s.Tokens[resume:] {
+			tok.Span = shiftSpan(tok.Span, delta, lineDelta)
+			tokens = append(tokens, tok)
+		}
+		for _, d := range s.Diags {
+			if d.Span.Start.Offset >= resumeOffset {
+				d.Span = shiftSpan(d.Span, delta, lineDelta)
+				diags = append(diags, d)
+			}
+		}
+	}
+	return &Snapshot{Source: source, Filename: s.Filename, Tokens: tokens, Diags: diags}
+}
+
+// shiftSpan moves a span that starts on a line after an edit. Columns are
+// unaffected because such spans start at or after a line break.
+func shiftSpan(s span.Span, delta, lineDelta int) span.Span {
+	s.Start.Offset += delta
+	s.Start.Line += lineDelta
+	s.End.Offset += delta
+	s.End.Line += lineDelta
+	return s
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -6,6 +6,8 @@ import (
 	"light-lang/internal/diag"
 	"light-lang/internal/span"
 	"light-lang/internal/token"
+	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -35,16 +37,34 @@ func New(source, filename string) *Lexer {
 }
 
 // Tokenize scans the entire source and returns all tokens and diagnostics.
+// An internal failure is reported as an E1000 diagnostic rather than a panic.
 func (l *Lexer) Tokenize() ([]token.Token, []diag.Diagnostic) {
-	var tokens []token.Token
+	tokens, _ := l.scan(nil)
+	return tokens, l.diags
+}
+
+// scan reads tokens until EOF, or until stop returns true for a token (which
+// is included). It reports whether it stopped early.
+func (l *Lexer) scan(stop func(tok token.Token) bool) (tokens []token.Token, stopped bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			pos := l.curPos()
+			l.addError("E1000", span.Span{Start: pos, End: pos}, fmt.Sprintf("internal lexer error: %v", r))
+			tokens = append(tokens, token.Token{Kind: token.EOF, Span: span.Span{Start: pos, End: pos}})
+			stopped = false
+		}
+	}()
+
 	for {
 		tok := l.nextToken()
 		tokens = append(tokens, tok)
 		if tok.Kind == token.EOF {
-			break
+			return tokens, false
+		}
+		if stop != nil && stop(tok) {
+			return tokens, true
 		}
 	}
-	return tokens, l.diags
 }
 
 // ---- internal helpers ----
@@ -107,6 +127,32 @@ func (l *Lexer) skipLineComment() {
 	}
 }
 
+// skipBlockComment skips from /* to the next */, which may be on a later
+// line. It reports false if the source ends first.
+func (l *Lexer) skipBlockComment() bool {
+	l.advance() // '/'
+	l.advance() // '*'
+	for l.pos < len(l.source) {
+		if l.peek() == '*' && l.peekNext() == '/' {
+			l.advance()
+			l.advance()
+			return true
+		}
+		l.advance()
+	}
+	return false
+}
+
+// lineBlank reports whether only spaces and tabs precede offset on its line.
+func (l *Lexer) lineBlank(offset int) bool {
+	for idx := offset - 1; idx >= 0 && l.source[idx] != '\n'; idx-- {
+		if ch := l.source[idx]; ch != ' ' && ch != '\t' && ch != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
 // addError records a diagnostic error.
 func (l *Lexer) addError(code string, s span.Span, msg string) {
 	l.diags = append(l.diags, diag.Errorf(code, s, "%s", msg))
@@ -132,8 +178,23 @@ func (l *Lexer) nextToken() token.Token {
 
 	// Line comment: //
 	if ch == '/' && l.peekNext() == '/' {
+		ownLine := l.lineBlank(start.Offset)
 		l.skipLineComment()
-		return l.nextToken() // skip comment, get next token
+		comment := l.source[start.Offset:l.pos]
+		tok := l.nextToken() // skip comment, get next token
+		if ownLine && tok.Kind == token.NEWLINE {
+			tok.Comment = strings.TrimRight(comment, " \t\r")
+		}
+		return tok
+	}
+
+	// Block comment: /* ... */, skipped like whitespace. Line breaks inside
+	// it do not end a statement.
+	if ch == '/' && l.peekNext() == '*' {
+		if !l.skipBlockComment() {
+			l.addError("E1005", l.makeSpan(start), "unterminated block comment")
+		}
+		return l.nextToken()
 	}
 
 	// Hash comment: #
@@ -186,24 +247,7 @@ func (l *Lexer) readString(start span.Position) token.Token {
 			return token.Token{Kind: token.STRING, Lexeme: string(value), Span: l.makeSpan(start)}
 		}
 		if ch == '\\' {
-			l.advance()
-			esc := l.peek()
-			switch esc {
-			case 'n':
-				value = append(value, '\n')
-			case 't':
-				value = append(value, '\t')
-			case '\\':
-				value = append(value, '\\')
-			case '"':
-				value = append(value, '"')
-			case '0':
-				value = append(value, 0)
-			default:
-				l.addError("E1002", l.makeSpan(start), fmt.Sprintf("unknown escape sequence: \\%c", esc))
-				value = append(value, esc)
-			}
-			l.advance()
+			value = l.readEscape(value, "")
 			continue
 		}
 		value = append(value, ch)
@@ -214,32 +258,145 @@ func (l *Lexer) readString(start span.Position) token.Token {
 	return token.Token{Kind: token.STRING, Lexeme: string(value), Span: l.makeSpan(start)}
 }
 
-// readNumber reads an integer or float literal.
+// readEscape reads the escape sequence starting at the backslash and
+// appends its value to buf. Besides \n \t \r \0 \\ \' \" \xNN and
+// \u{...}, the literal's own delimiters, listed in quotes, may be escaped. \xNN and
+// \u{...} give a Unicode code point, encoded as UTF-8. Invalid escapes are
+// reported with the span of the escape alone.
+func (l *Lexer) readEscape(buf []byte, quotes string) []byte {
+	escStart := l.curPos()
+	l.advance() // skip '\'
+	if l.pos >= len(l.source) {
+		return buf
+	}
+	esc := l.advance()
+	switch esc {
+	case 'n':
+		return append(buf, '\n')
+	case 't':
+		return append(buf, '\t')
+	case 'r':
+		return append(buf, '\r')
+	case '0':
+		return append(buf, 0)
+	case '\\', '\'', '"':
+		return append(buf, esc)
+	case 'x':
+		digitsStart := l.pos
+		for l.pos < digitsStart+2 && l.pos < len(l.source) && isHexDigit(l.peek()) {
+			l.advance()
+		}
+		if l.pos-digitsStart < 2 {
+			l.addError("E1002", l.makeSpan(escStart), "invalid escape sequence: \\x needs two hex digits, as in \\x41")
+			return buf
+		}
+		code, _ := strconv.ParseUint(l.source[digitsStart:l.pos], 16, 8)
+		return utf8.AppendRune(buf, rune(code))
+	case 'u':
+		return l.readUnicodeEscape(buf, escStart)
+	}
+	if strings.IndexByte(quotes, esc) >= 0 {
+		return append(buf, esc)
+	}
+	l.addError("E1002", l.makeSpan(escStart), fmt.Sprintf("unknown escape sequence: \\%c", esc))
+	return append(buf, esc)
+}
+
+// readUnicodeEscape reads the {1F600} part of a \u escape.
+func (l *Lexer) readUnicodeEscape(buf []byte, escStart span.Position) []byte {
+	if l.peek() != '{' {
+		l.addError("E1002", l.makeSpan(escStart), "invalid escape sequence: \\u needs a code point in braces, as in \\u{1F600}")
+		return buf
+	}
+	l.advance() // skip '{'
+	digitsStart := l.pos
+	for l.pos < len(l.source) && isHexDigit(l.peek()) {
+		l.advance()
+	}
+	digits := l.source[digitsStart:l.pos]
+	if l.peek() != '}' || len(digits) == 0 || len(digits) > 6 {
+		l.addError("E1002", l.makeSpan(escStart), "invalid escape sequence: \\u needs 1 to 6 hex digits in braces, as in \\u{1F600}")
+		return buf
+	}
+	l.advance() // skip '}'
+	code, _ := strconv.ParseUint(digits, 16, 32)
+	if code > unicode.MaxRune || code >= 0xD800 && code <= 0xDFFF {
+		l.addError("E1002", l.makeSpan(escStart), fmt.Sprintf("invalid escape sequence: \\u{%s} is not a valid code point", digits))
+		return buf
+	}
+	return utf8.AppendRune(buf, rune(code))
+}
+
+// readNumber reads an integer or float literal: 42, 1_000, 0xFF, 0o755,
+// 0b1010, 3.14 or 1.5e9. A malformed literal is reported but still
+// returned as a number token.
 func (l *Lexer) readNumber(start span.Position) token.Token {
 	isFloat := false
 	numStart := l.pos
 
-	for l.pos < len(l.source) && isDigit(l.peek()) {
+	if l.peek() == '0' && strings.IndexByte("xXoObB", l.peekNext()) >= 0 {
+		// Base prefix: take every letter, digit and '_' so a bad digit is
+		// reported as part of the literal
 		l.advance()
-	}
-
-	// Check for decimal point
-	if l.pos < len(l.source) && l.peek() == '.' && isDigit(l.peekNext()) {
-		isFloat = true
-		l.advance() // skip '.'
-		for l.pos < len(l.source) && isDigit(l.peek()) {
+		l.advance()
+		for l.pos < len(l.source) && (isDigit(l.peek()) || l.peek() == '_' || unicode.IsLetter(rune(l.peek()))) {
 			l.advance()
 		}
+	} else {
+		l.readDigits()
+
+		// Check for decimal point
+		if l.pos < len(l.source) && l.peek() == '.' && isDigit(l.peekNext()) {
+			isFloat = true
+			l.advance() // skip '.'
+			l.readDigits()
+		}
+
+		// Exponent: e9, E-3, e+10
+		if l.exponentAhead() {
+			isFloat = true
+			l.advance() // skip 'e'
+			if l.peek() == '+' || l.peek() == '-' {
+				l.advance()
+			}
+			l.readDigits()
+		}
 	}
 
 	lexeme := l.source[numStart:l.pos]
 	kind := token.INT
+	var err error
 	if isFloat {
 		kind = token.FLOAT
+		_, err = FloatValue(lexeme)
+	} else {
+		_, err = IntValue(lexeme)
+	}
+	if err != nil {
+		l.addError("E1006", l.makeSpan(start), err.Error())
 	}
 	return token.Token{Kind: kind, Lexeme: lexeme, Span: l.makeSpan(start)}
 }
 
+// readDigits skips decimal digits and '_' separators.
+func (l *Lexer) readDigits() {
+	for l.pos < len(l.source) && (isDigit(l.peek()) || l.peek() == '_') {
+		l.advance()
+	}
+}
+
+// exponentAhead reports whether an exponent such as e9 or E-3 follows.
+func (l *Lexer) exponentAhead() bool {
+	if l.peek() != 'e' && l.peek() != 'E' {
+		return false
+	}
+	next := l.peekNext()
+	if (next == '+' || next == '-') && l.pos+2 < len(l.source) {
+		next = l.source[l.pos+2]
+	}
+	return isDigit(next)
+}
+
 // readIdentifier reads an identifier or keyword.
 func (l *Lexer) readIdentifier(start span.Position) token.Token {
 	identStart := l.pos
@@ -272,6 +429,10 @@ func (l *Lexer) readOperator(start span.Position) token.Token {
 			// Closing a template expression — continue reading template text
 			l.templateStack = l.templateStack[:len(l.templateStack)-1]
 			text := l.readTemplateText()
+			if l.pos >= len(l.source) {
+				l.addError("E1004", l.makeSpan(start), "unterminated template literal")
+				return token.Token{Kind: token.TEMPLATE_TAIL, Lexeme: text, Span: l.makeSpan(start)}
+			}
 			if l.peek() == '`' {
 				l.advance()
 				return token.Token{Kind: token.TEMPLATE_TAIL, Lexeme: text, Span: l.makeSpan(start)}
@@ -293,6 +454,11 @@ func (l *Lexer) readOperator(start span.Position) token.Token {
 	case ',':
 		return token.Token{Kind: token.COMMA, Lexeme: ",", Span: l.makeSpan(start)}
 	case '.':
+		if l.peek() == '.' && l.peekNext() == '.' {
+			l.advance()
+			l.advance()
+			return token.Token{Kind: token.ELLIPSIS, Lexeme: "...", Span: l.makeSpan(start)}
+		}
 		return token.Token{Kind: token.DOT, Lexeme: ".", Span: l.makeSpan(start)}
 	case ';':
 		return token.Token{Kind: token.SEMICOLON, Lexeme: ";", Span: l.makeSpan(start)}
@@ -311,6 +477,14 @@ func (l *Lexer) readOperator(start span.Position) token.Token {
 		}
 		return token.Token{Kind: token.MINUS, Lexeme: "-", Span: l.makeSpan(start)}
 	case '*':
+		if l.peek() == '*' {
+			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				return token.Token{Kind: token.STAR_STAR_ASSIGN, Lexeme: "**=", Span: l.makeSpan(start)}
+			}
+			return token.Token{Kind: token.STAR_STAR, Lexeme: "**", Span: l.makeSpan(start)}
+		}
 		if l.peek() == '=' {
 			l.advance()
 			return token.Token{Kind: token.STAR_ASSIGN, Lexeme: "*=", Span: l.makeSpan(start)}
@@ -323,18 +497,39 @@ func (l *Lexer) readOperator(start span.Position) token.Token {
 		}
 		return token.Token{Kind: token.SLASH, Lexeme: "/", Span: l.makeSpan(start)}
 	case '%':
+		if l.peek() == '=' {
+			l.advance()
+			return token.Token{Kind: token.PERCENT_ASSIGN, Lexeme: "%=", Span: l.makeSpan(start)}
+		}
 		return token.Token{Kind: token.PERCENT, Lexeme: "%", Span: l.makeSpan(start)}
 	case '!':
 		if l.peek() == '=' {
 			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				return token.Token{Kind: token.STRICT_NEQ, Lexeme: "!==", Span: l.makeSpan(start)}
+			}
 			return token.Token{Kind: token.NEQ, Lexeme: "!=", Span: l.makeSpan(start)}
 		}
 		return token.Token{Kind: token.BANG, Lexeme: "!", Span: l.makeSpan(start)}
 	case '?':
+		if l.peek() == '?' {
+			l.advance()
+			return token.Token{Kind: token.QUESTION_QUESTION, Lexeme: "??", Span: l.makeSpan(start)}
+		}
+		// a ?.5 : b stays a ternary
+		if l.peek() == '.' && !isDigit(l.peekNext()) {
+			l.advance()
+			return token.Token{Kind: token.QUESTION_DOT, Lexeme: "?.", Span: l.makeSpan(start)}
+		}
 		return token.Token{Kind: token.QUESTION, Lexeme: "?", Span: l.makeSpan(start)}
 	case '=':
 		if l.peek() == '=' {
 			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				return token.Token{Kind: token.STRICT_EQ, Lexeme: "===", Span: l.makeSpan(start)}
+			}
 			return token.Token{Kind: token.EQ, Lexeme: "==", Span: l.makeSpan(start)}
 		}
 		if l.peek() == '>' {
@@ -343,12 +538,28 @@ func (l *Lexer) readOperator(start span.Position) token.Token {
 		}
 		return token.Token{Kind: token.ASSIGN, Lexeme: "=", Span: l.makeSpan(start)}
 	case '<':
+		if l.peek() == '<' {
+			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				return token.Token{Kind: token.SHL_ASSIGN, Lexeme: "<<=", Span: l.makeSpan(start)}
+			}
+			return token.Token{Kind: token.SHL, Lexeme: "<<", Span: l.makeSpan(start)}
+		}
 		if l.peek() == '=' {
 			l.advance()
 			return token.Token{Kind: token.LTE, Lexeme: "<=", Span: l.makeSpan(start)}
 		}
 		return token.Token{Kind: token.LT, Lexeme: "<", Span: l.makeSpan(start)}
 	case '>':
+		if l.peek() == '>' {
+			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				return token.Token{Kind: token.SHR_ASSIGN, Lexeme: ">>=", Span: l.makeSpan(start)}
+			}
+			return token.Token{Kind: token.SHR, Lexeme: ">>", Span: l.makeSpan(start)}
+		}
 		if l.peek() == '=' {
 			l.advance()
 			return token.Token{Kind: token.GTE, Lexeme: ">=", Span: l.makeSpan(start)}
@@ -359,15 +570,29 @@ func (l *Lexer) readOperator(start span.Position) token.Token {
 			l.advance()
 			return token.Token{Kind: token.AND, Lexeme: "&&", Span: l.makeSpan(start)}
 		}
-		l.addError("E1003", l.makeSpan(start), fmt.Sprintf("unexpected character: '%c', did you mean '&&'?", ch))
-		return token.Token{Kind: token.ILLEGAL, Lexeme: string(ch), Span: l.makeSpan(start)}
+		if l.peek() == '=' {
+			l.advance()
+			return token.Token{Kind: token.AMP_ASSIGN, Lexeme: "&=", Span: l.makeSpan(start)}
+		}
+		return token.Token{Kind: token.AMP, Lexeme: "&", Span: l.makeSpan(start)}
 	case '|':
 		if l.peek() == '|' {
 			l.advance()
 			return token.Token{Kind: token.OR, Lexeme: "||", Span: l.makeSpan(start)}
 		}
-		l.addError("E1003", l.makeSpan(start), fmt.Sprintf("unexpected character: '%c', did you mean '||'?", ch))
-		return token.Token{Kind: token.ILLEGAL, Lexeme: string(ch), Span: l.makeSpan(start)}
+		if l.peek() == '=' {
+			l.advance()
+			return token.Token{Kind: token.PIPE_ASSIGN, Lexeme: "|=", Span: l.makeSpan(start)}
+		}
+		return token.Token{Kind: token.PIPE, Lexeme: "|", Span: l.makeSpan(start)}
+	case '^':
+		if l.peek() == '=' {
+			l.advance()
+			return token.Token{Kind: token.CARET_ASSIGN, Lexeme: "^=", Span: l.makeSpan(start)}
+		}
+		return token.Token{Kind: token.CARET, Lexeme: "^", Span: l.makeSpan(start)}
+	case '~':
+		return token.Token{Kind: token.TILDE, Lexeme: "~", Span: l.makeSpan(start)}
 	default:
 		l.addError("E1003", l.makeSpan(start), fmt.Sprintf("unexpected character: '%c'", ch))
 		return token.Token{Kind: token.ILLEGAL, Lexeme: string(ch), Span: l.makeSpan(start)}
@@ -382,6 +607,10 @@ func (l *Lexer) readTemplateStart(start span.Position) token.Token {
 	l.advance() // consume opening `
 	text := l.readTemplateText()
 
+	if l.pos >= len(l.source) {
+		l.addError("E1004", l.makeSpan(start), "unterminated template literal")
+		return token.Token{Kind: token.TEMPLATE_LITERAL, Lexeme: text, Span: l.makeSpan(start)}
+	}
 	if l.peek() == '`' {
 		l.advance() // consume closing `
 		return token.Token{Kind: token.TEMPLATE_LITERAL, Lexeme: text, Span: l.makeSpan(start)}
@@ -406,34 +635,11 @@ func (l *Lexer) readTemplateText() string {
 			break
 		}
 		if ch == '\\' {
-			l.advance()
-			if l.pos >= len(l.source) {
-				break
-			}
-			esc := l.peek()
-			switch esc {
-			case 'n':
-				text = append(text, '\n')
-			case 't':
-				text = append(text, '\t')
-			case '\\':
-				text = append(text, '\\')
-			case '`':
-				text = append(text, '`')
-			case '$':
-				text = append(text, '$')
-			default:
-				text = append(text, '\\', esc)
-			}
-			l.advance()
+			text = l.readEscape(text, "`$")
 			continue
 		}
-		if ch == '\n' {
-			l.line++
-			l.col = 0
-		}
 		text = append(text, ch)
-		l.advance()
+		l.advance() // counts lines itself
 	}
 	return string(text)
 }
@@ -444,6 +650,10 @@ func isDigit(ch byte) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
 func isIdentStart(ch byte) bool {
 	if ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') {
 		return true
@@ -2,6 +2,10 @@ package lexer
 
 import (
 	"light-lang/internal/token"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -60,7 +64,7 @@ func TestTokenizeKeywords(t *testing.T) {
 }
 
 func TestTokenizeOperators(t *testing.T) {
-	source := `= == != < <= > >= + - * / % ! && ||`
+	source := `= == != < <= > >= + - * / % ! && || ? ?. ?? ?.5 ** & | ^ ~ << >> %= **= &= |= ^= <<= >>= === !== !=`
 	l := New(source, "test.lt")
 	tokens, diags := l.Tokenize()
 
@@ -73,6 +77,11 @@ func TestTokenizeOperators(t *testing.T) {
 		token.LT, token.LTE, token.GT, token.GTE,
 		token.PLUS, token.MINUS, token.STAR, token.SLASH, token.PERCENT,
 		token.BANG, token.AND, token.OR,
+		token.QUESTION, token.QUESTION_DOT, token.QUESTION_QUESTION, token.QUESTION, token.DOT, token.INT,
+		token.STAR_STAR, token.AMP, token.PIPE, token.CARET, token.TILDE, token.SHL, token.SHR,
+		token.PERCENT_ASSIGN, token.STAR_STAR_ASSIGN, token.AMP_ASSIGN, token.PIPE_ASSIGN,
+		token.CARET_ASSIGN, token.SHL_ASSIGN, token.SHR_ASSIGN,
+		token.STRICT_EQ, token.STRICT_NEQ, token.NEQ,
 		token.EOF,
 	}
 
@@ -88,7 +97,7 @@ func TestTokenizeOperators(t *testing.T) {
 }
 
 func TestTokenizeDelimiters(t *testing.T) {
-	source := `( ) { } [ ] , . ; :`
+	source := `( ) { } [ ] , . ; : ... ..`
 	l := New(source, "test.lt")
 	tokens, diags := l.Tokenize()
 
@@ -99,7 +108,7 @@ func TestTokenizeDelimiters(t *testing.T) {
 	expected := []token.Kind{
 		token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE,
 		token.LBRACKET, token.RBRACKET, token.COMMA, token.DOT,
-		token.SEMICOLON, token.COLON,
+		token.SEMICOLON, token.COLON, token.ELLIPSIS, token.DOT, token.DOT,
 		token.EOF,
 	}
 
@@ -132,6 +141,52 @@ func TestTokenizeString(t *testing.T) {
 	}
 }
 
+func TestTokenizeEscapes(t *testing.T) {
+	cases := map[string]string{
+		`"a\rb"`:              "a\rb",
+		`"it\'s"`:             "it's",
+		`"\x41\x62"`:          "Ab",
+		`"caf\xe9"`:           "café",
+		`"\u{1F600}!"`:        "\U0001F600!",
+		`"\u{48}\u{10FFFF}"`:  "H\U0010FFFF",
+		"`a\\r\\u{e9}\\x41`":  "a\réA",
+		"`\\'\\$\\`\\0`":      "'$`\x00",
+		"`say \\\"hi\\\"`":    "say \"hi\"",
+		`"tab\tnew\nnul\0\\"`: "tab\tnew\nnul\x00\\",
+	}
+	for src, want := range cases {
+		tokens, diags := New(src, "test.lt").Tokenize()
+		if len(diags) > 0 || tokens[0].Lexeme != want {
+			t.Errorf("%s: expected %q, got %q %v", src, want, tokens[0].Lexeme, diags)
+		}
+	}
+
+	// errors point at the escape itself
+	invalid := map[string]struct {
+		msg        string
+		start, end int
+	}{
+		`"ab\q"`:        {"unknown escape sequence: \\q", 3, 5},
+		`"x\x4"`:        {"invalid escape sequence: \\x needs two hex digits, as in \\x41", 2, 5},
+		`"\u0041"`:      {"invalid escape sequence: \\u needs a code point in braces, as in \\u{1F600}", 1, 3},
+		`"\u{}"`:        {"invalid escape sequence: \\u needs 1 to 6 hex digits in braces, as in \\u{1F600}", 1, 4},
+		`"\u{1234567}"`: {"invalid escape sequence: \\u needs 1 to 6 hex digits in braces, as in \\u{1F600}", 1, 11},
+		`"\u{D800}"`:    {"invalid escape sequence: \\u{D800} is not a valid code point", 1, 9},
+		`"\u{110000}"`:  {"invalid escape sequence: \\u{110000} is not a valid code point", 1, 11},
+		"`ok ${x} \\d`": {"unknown escape sequence: \\d", 9, 11},
+	}
+	for src, want := range invalid {
+		_, diags := New(src, "test.lt").Tokenize()
+		if len(diags) != 1 || diags[0].Code != "E1002" || diags[0].Message != want.msg {
+			t.Errorf("%s: expected E1002 %q, got %v", src, want.msg, diags)
+			continue
+		}
+		if s := diags[0].Span; s.Start.Offset != want.start || s.End.Offset != want.end {
+			t.Errorf("%s: expected span %d-%d, got %d-%d", src, want.start, want.end, s.Start.Offset, s.End.Offset)
+		}
+	}
+}
+
 func TestTokenizeNumbers(t *testing.T) {
 	source := `123 3.14 0 42`
 	l := New(source, "test.lt")
@@ -149,6 +204,58 @@ func TestTokenizeNumbers(t *testing.T) {
 	}
 }
 
+func TestTokenizeNumberForms(t *testing.T) {
+	ints := map[string]int64{
+		"0xFF": 255, "0Xff": 255, "0o755": 493, "0b1010": 10, "1_000_000": 1000000,
+		"0xdead_beef": 0xdeadbeef, "010": 10, "9223372036854775807": 9223372036854775807,
+	}
+	for src, want := range ints {
+		tokens, diags := New(src, "test.lt").Tokenize()
+		if len(diags) > 0 || tokens[0].Kind != token.INT || tokens[0].Lexeme != src {
+			t.Errorf("%s: expected one INT token, got %v %v", src, tokens, diags)
+			continue
+		}
+		if got, _ := IntValue(src); got != want {
+			t.Errorf("%s: expected %d, got %d", src, want, got)
+		}
+	}
+	floats := map[string]float64{"1.5e9": 1.5e9, "2E-3": 0.002, "1e+2": 100, "1_000.25": 1000.25}
+	for src, want := range floats {
+		tokens, diags := New(src, "test.lt").Tokenize()
+		if len(diags) > 0 || tokens[0].Kind != token.FLOAT || tokens[0].Lexeme != src {
+			t.Errorf("%s: expected one FLOAT token, got %v %v", src, tokens, diags)
+			continue
+		}
+		if got, _ := FloatValue(src); got != want {
+			t.Errorf("%s: expected %g, got %g", src, want, got)
+		}
+	}
+	// an 'e' not followed by digits is not an exponent
+	if tokens, _ := New("2e", "test.lt").Tokenize(); tokens[0].Kind != token.INT || tokens[1].Kind != token.IDENT {
+		t.Errorf("expected INT then IDENT for 2e, got %v", tokens)
+	}
+
+	malformed := map[string]string{
+		"0x":                   "hexadecimal literal '0x' has no digits",
+		"0b102":                "invalid digit '2' in binary literal '0b102'",
+		"0o8":                  "invalid digit '8' in octal literal '0o8'",
+		"0xFG":                 "invalid digit 'G' in hexadecimal literal '0xFG'",
+		"1__0":                 "'_' must separate digits in number literal '1__0'",
+		"1_":                   "'_' must separate digits in number literal '1_'",
+		"1_.5":                 "'_' must separate digits in number literal '1_.5'",
+		"1_e5":                 "'_' must separate digits in number literal '1_e5'",
+		"0x_1":                 "'_' must separate digits in number literal '0x_1'",
+		"99999999999999999999": "integer literal '99999999999999999999' is out of range",
+		"1e999":                "float literal '1e999' is out of range",
+	}
+	for src, want := range malformed {
+		_, diags := New(src, "test.lt").Tokenize()
+		if len(diags) != 1 || diags[0].Code != "E1006" || diags[0].Message != want {
+			t.Errorf("%s: expected E1006 %q, got %v", src, want, diags)
+		}
+	}
+}
+
 func TestTokenizeNewlines(t *testing.T) {
 	source := "a\nb\n"
 	l := New(source, "test.lt")
@@ -187,6 +294,46 @@ func TestTokenizeComment(t *testing.T) {
 	}
 }
 
+func TestTokenizeBlockComment(t *testing.T) {
+	tokens, diags := New("x /* one */ y\n/*\nvar z = 1 // off\n*/\nw", "test.lt").Tokenize()
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	expected := []token.Kind{
+		token.IDENT, token.IDENT, token.NEWLINE, token.NEWLINE, token.IDENT, token.EOF,
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, exp := range expected {
+		if tokens[i].Kind != exp {
+			t.Errorf("token[%d]: expected %s, got %s", i, exp, tokens[i].Kind)
+		}
+	}
+	// line tracking continues through the comment
+	if w := tokens[4]; w.Span.Start.Line != 5 || w.Span.Start.Column != 1 {
+		t.Errorf("'w' position: expected 5:1, got %d:%d", w.Span.Start.Line, w.Span.Start.Column)
+	}
+
+	_, diags = New("x\n/* open\ny", "test.lt").Tokenize()
+	if len(diags) != 1 || diags[0].Code != "E1005" || diags[0].Message != "unterminated block comment" {
+		t.Fatalf("expected E1005, got %v", diags)
+	}
+	if s := diags[0].Span; s.Start.Line != 2 || s.End.Line != 3 {
+		t.Errorf("expected the error to span lines 2-3, got %d-%d", s.Start.Line, s.End.Line)
+	}
+}
+
+func TestTokenizeCommentLine(t *testing.T) {
+	tokens, _ := New("x // trailing\n  /// doc  \ny", "test.lt").Tokenize()
+	if tokens[1].Comment != "" {
+		t.Errorf("trailing comment should not be recorded, got %q", tokens[1].Comment)
+	}
+	if tokens[2].Kind != token.NEWLINE || tokens[2].Comment != "/// doc" {
+		t.Errorf("expected NEWLINE with comment '/// doc', got %s %q", tokens[2].Kind, tokens[2].Comment)
+	}
+}
+
 func TestTokenizePositions(t *testing.T) {
 	source := "var x = 1"
 	l := New(source, "test.lt")
@@ -201,3 +348,75 @@ func TestTokenizePositions(t *testing.T) {
 		t.Errorf("'x' position: expected 1:5, got %d:%d", tokens[1].Span.Start.Line, tokens[1].Span.Start.Column)
 	}
 }
+
+func TestTokenizeUnterminatedTemplate(t *testing.T) {
+	for _, source := range []string{"`abc", "`a ${x} b", "`a ${x"} {
+		_, diags := New(source, "test.lt").Tokenize()
+		if source == "`a ${x" {
+			// The open expression is left for the parser to report
+			continue
+		}
+		if len(diags) == 0 || diags[0].Code != "E1004" {
+			t.Errorf("%q: expected E1004, got %v", source, diags)
+		}
+	}
+}
+
+func FuzzTokenize(f *testing.F) {
+	for _, seed := range []string{"var x = 1 + 2", "`a ${b} c`", "\"unterminated", "0x", "a // c\n/* b */"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		tokens, diags := New(source, "fuzz.lt").Tokenize()
+		if len(tokens) == 0 || tokens[len(tokens)-1].Kind != token.EOF {
+			t.Fatalf("token stream does not end with EOF: %v", tokens)
+		}
+		for _, d := range diags {
+			if d.Code == "E1000" {
+				t.Fatal(d.Message)
+			}
+		}
+	})
+}
+
+func TestSnapshotApply(t *testing.T) {
+	source := "var a = 1\nvar s = `x ${a\n+ 1} y`\nprint(s)\n"
+	edits := []Edit{
+		{Start: 8, End: 9, Text: "42"},              // change a number
+		{Start: 0, End: 0, Text: "// top\n"},        // insert a line
+		{Start: 20, End: 20, Text: "}`\nvar t = `"}, // split a template
+		{Start: 10, End: 33, Text: ""},              // delete lines
+		{Start: 5, End: 5, Text: "\""},              // open a string
+		{Start: len(source), End: len(source), Text: "`"},
+	}
+	for _, e := range edits {
+		got := Scan(source, "test.lt").Apply(e)
+		want := Scan(got.Source, "test.lt")
+		if !reflect.DeepEqual(got.Tokens, want.Tokens) || !reflect.DeepEqual(got.Diags, want.Diags) {
+			t.Errorf("edit %+v:\ngot  %v %v\nwant %v %v", e, got.Tokens, got.Diags, want.Tokens, want.Diags)
+		}
+	}
+}
+
+func TestSnapshotApplyRandom(t *testing.T) {
+	programs, _ := filepath.Glob(filepath.Join("..", "..", "testdata", "*.lt"))
+	fragments := []string{"", "\n", "x", "}", "{", "`", "${", "\"", "// c\n", "1.5", "\n\n", "/*", "*/"}
+	rng := rand.New(rand.NewSource(1))
+	for _, path := range programs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snap := Scan(string(data), "test.lt")
+		for n := 0; n < 50; n++ {
+			start := rng.Intn(len(snap.Source) + 1)
+			end := start + rng.Intn(min(10, len(snap.Source)-start)+1)
+			e := Edit{Start: start, End: end, Text: fragments[rng.Intn(len(fragments))]}
+			snap = snap.Apply(e)
+			want := Scan(snap.Source, "test.lt")
+			if !reflect.DeepEqual(snap.Tokens, want.Tokens) || !reflect.DeepEqual(snap.Diags, want.Diags) {
+				t.Fatalf("%s: edit %+v diverged from a full scan", path, e)
+			}
+		}
+	}
+}
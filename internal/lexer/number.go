@@ -0,0 +1,85 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Number literals
+// ============================================================
+
+// IntValue returns the value of an integer literal lexeme: 42, 1_000,
+// 0xFF, 0o755 or 0b1010.
+func IntValue(lexeme string) (int64, error) {
+	base, digits, name := 10, lexeme, "integer"
+	if len(lexeme) >= 2 && lexeme[0] == '0' {
+		switch lexeme[1] {
+		case 'x', 'X':
+			base, digits, name = 16, lexeme[2:], "hexadecimal"
+		case 'o', 'O':
+			base, digits, name = 8, lexeme[2:], "octal"
+		case 'b', 'B':
+			base, digits, name = 2, lexeme[2:], "binary"
+		}
+	}
+	if digits == "" {
+		return 0, fmt.Errorf("%s literal '%s' has no digits", name, lexeme)
+	}
+	if err := checkUnderscores(lexeme, digits, base); err != nil {
+		return 0, err
+	}
+	digits = strings.ReplaceAll(digits, "_", "")
+	for _, ch := range digits {
+		if digitValue(ch) >= base {
+			return 0, fmt.Errorf("invalid digit '%c' in %s literal '%s'", ch, name, lexeme)
+		}
+	}
+	val, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("integer literal '%s' is out of range", lexeme)
+	}
+	return val, nil
+}
+
+// FloatValue returns the value of a float literal lexeme: 3.14, 1_000.5 or
+// 1.5e9.
+func FloatValue(lexeme string) (float64, error) {
+	if err := checkUnderscores(lexeme, lexeme, 10); err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseFloat(strings.ReplaceAll(lexeme, "_", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("float literal '%s' is out of range", lexeme)
+	}
+	return val, nil
+}
+
+// checkUnderscores requires every '_' in digits to sit between two digits
+// of base.
+func checkUnderscores(lexeme, digits string, base int) error {
+	for idx := 0; idx < len(digits); idx++ {
+		if digits[idx] != '_' {
+			continue
+		}
+		if idx == 0 || idx == len(digits)-1 || digitValue(rune(digits[idx-1])) >= base || digitValue(rune(digits[idx+1])) >= base {
+			return fmt.Errorf("'_' must separate digits in number literal '%s'", lexeme)
+		}
+	}
+	return nil
+}
+
+// digitValue returns the value of a digit or letter as a digit in bases up
+// to 36, or 99 for any other character.
+func digitValue(ch rune) int {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'z':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'Z':
+		return int(ch-'A') + 10
+	}
+	return 99
+}
@@ -0,0 +1,262 @@
+package lsp
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/check"
+	"light-lang/internal/span"
+	"strings"
+)
+
+// symbol is a declared name.
+type symbol struct {
+	name   string
+	span   span.Span // the declaring node
+	detail string    // the declaration as it would be written, e.g. "function add(a, b)"
+	doc    string
+}
+
+// index resolves the identifiers of a file to the symbols they refer to.
+// Names are resolved by block scope; all declarations in a block are
+// visible throughout it, so functions may call ones declared below them.
+type index struct {
+	refs   map[*ast.IdentExpr]*symbol
+	idents []*ast.IdentExpr
+	kinds  map[*ast.VarDeclStmt]string
+	scopes []map[string]*symbol
+}
+
+func newIndex(file *ast.File) *index {
+	ix := &index{refs: make(map[*ast.IdentExpr]*symbol), kinds: check.VarKinds(file)}
+	ix.push()
+	ix.stmts(file.Body)
+	return ix
+}
+
+// identAt returns the identifier whose span contains offset, or nil.
+func (ix *index) identAt(offset int) *ast.IdentExpr {
+	for _, ident := range ix.idents {
+		if ident.Span.Start.Offset <= offset && offset <= ident.Span.End.Offset {
+			return ident
+		}
+	}
+	return nil
+}
+
+func (ix *index) push() { ix.scopes = append(ix.scopes, make(map[string]*symbol)) }
+func (ix *index) pop()  { ix.scopes = ix.scopes[:len(ix.scopes)-1] }
+
+func (ix *index) declare(sym *symbol) {
+	ix.scopes[len(ix.scopes)-1][sym.name] = sym
+}
+
+func (ix *index) lookup(name string) *symbol {
+	for idx := len(ix.scopes) - 1; idx >= 0; idx-- {
+		if sym, ok := ix.scopes[idx][name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// declareAll declares the names a block's statements introduce.
+func (ix *index) declareAll(stmts []ast.Node) {
+	for _, node := range stmts {
+		switch d := node.(type) {
+		case *ast.VarDeclStmt:
+			keyword := "var"
+			switch {
+			case d.IsConst:
+				keyword = "const"
+			case d.IsLet:
+				keyword = "let"
+			}
+			if len(d.Names) > 0 {
+				for _, name := range d.Names {
+					ix.declare(&symbol{name: name, span: d.Span, detail: keyword + " " + name})
+				}
+				continue
+			}
+			detail := keyword + " " + d.Name
+			if k := ix.kinds[d]; k != "" {
+				detail += ": " + k
+			}
+			ix.declare(&symbol{name: d.Name, span: d.Span, detail: detail})
+		case *ast.FuncDecl:
+			ix.declare(&symbol{name: d.Name, span: d.Span, detail: funcDetail("function "+d.Name, d.Params, d.Rest), doc: d.Doc})
+		case *ast.ClassDecl:
+			ix.declare(&symbol{name: d.Name, span: d.Span, detail: classDetail(d), doc: d.Doc})
+		case *ast.EnumDecl:
+			ix.declare(&symbol{name: d.Name, span: d.Span, detail: fmt.Sprintf("enum %s { %s }", d.Name, strings.Join(d.Variants, ", "))})
+		case *ast.InterfaceDecl:
+			ix.declare(&symbol{name: d.Name, span: d.Span, detail: "interface " + d.Name})
+		case *ast.ImportStmt:
+			if d.Name != "" {
+				ix.declare(&symbol{name: d.Name, span: d.Span, detail: fmt.Sprintf("import %s from %q", d.Name, d.Path)})
+			}
+		}
+	}
+}
+
+func funcDetail(head string, params []string, rest bool) string {
+	return fmt.Sprintf("%s(%s)", head, ast.FormatParams(params, rest))
+}
+
+func classDetail(d *ast.ClassDecl) string {
+	detail := "class " + d.Name
+	if d.Record {
+		detail = funcDetail("record "+d.Name, d.Fields, false)
+	}
+	if d.SuperClass != "" {
+		detail += " extends " + d.SuperClass
+	}
+	if len(d.Implements) > 0 {
+		detail += " implements " + strings.Join(d.Implements, ", ")
+	}
+	return detail
+}
+
+func (ix *index) stmts(stmts []ast.Node) {
+	ix.declareAll(stmts)
+	for _, node := range stmts {
+		ix.node(node)
+	}
+}
+
+func (ix *index) block(b *ast.BlockStmt) {
+	if b == nil {
+		return
+	}
+	ix.push()
+	ix.stmts(b.Stmts)
+	ix.pop()
+}
+
+// function indexes a body whose parameters are declared by the function s.
+func (ix *index) function(params []string, body *ast.BlockStmt, s span.Span) {
+	ix.push()
+	for _, p := range params {
+		ix.declare(&symbol{name: p, span: s, detail: "(parameter) " + p})
+	}
+	ix.block(body)
+	ix.pop()
+}
+
+// bind indexes body with one extra variable, such as a loop variable.
+func (ix *index) bind(name string, s span.Span, body *ast.BlockStmt, extra ...ast.Expr) {
+	ix.push()
+	if name != "" {
+		ix.declare(&symbol{name: name, span: s, detail: "var " + name})
+	}
+	for _, e := range extra {
+		ix.expr(e)
+	}
+	ix.block(body)
+	ix.pop()
+}
+
+func (ix *index) node(n ast.Node) {
+	switch s := n.(type) {
+	case *ast.FuncDecl:
+		ix.function(s.Params, s.Body, s.Span)
+	case *ast.ClassDecl:
+		for _, st := range s.Statics {
+			ix.expr(st.Value)
+		}
+		for _, f := range s.Props {
+			ix.expr(f.Value)
+		}
+		if s.Constructor != nil {
+			ix.function(s.Constructor.Params, s.Constructor.Body, s.Constructor.Span)
+		}
+		for _, m := range s.Methods {
+			ix.function(m.Params, m.Body, m.Span)
+		}
+		for _, m := range s.StaticMethods {
+			ix.function(m.Params, m.Body, m.Span)
+		}
+		for _, m := range s.Getters {
+			ix.function(m.Params, m.Body, m.Span)
+		}
+		for _, m := range s.Setters {
+			ix.function(m.Params, m.Body, m.Span)
+		}
+	case *ast.ExprStmt:
+		ix.expr(s.Expr)
+	case *ast.AssignStmt:
+		ix.expr(s.Target)
+		ix.expr(s.Value)
+	case *ast.VarDeclStmt:
+		ix.expr(s.Init)
+		ix.expr(s.Pattern)
+	case *ast.ReturnStmt:
+		ix.expr(s.Value)
+	case *ast.ThrowStmt:
+		ix.expr(s.Value)
+	case *ast.BlockStmt:
+		ix.block(s)
+	case *ast.IfStmt:
+		ix.expr(s.Condition)
+		ix.block(s.Body)
+		for _, clause := range s.ElseIfs {
+			ix.expr(clause.Condition)
+			ix.block(clause.Body)
+		}
+		ix.block(s.ElseBody)
+	case *ast.WhileStmt:
+		ix.expr(s.Condition)
+		ix.block(s.Body)
+	case *ast.ForStmt:
+		ix.push()
+		if s.Init != nil {
+			ix.stmts([]ast.Node{s.Init})
+		}
+		ix.expr(s.Condition)
+		if s.Update != nil {
+			ix.node(s.Update)
+		}
+		ix.block(s.Body)
+		ix.pop()
+	case *ast.ForOfStmt:
+		ix.expr(s.Iterable)
+		ix.push()
+		if s.KeyName != "" {
+			ix.declare(&symbol{name: s.KeyName, span: s.Span, detail: "var " + s.KeyName})
+		}
+		for _, name := range ast.PatternNames(s.Pattern) {
+			ix.declare(&symbol{name: name, span: s.Span, detail: "var " + name})
+		}
+		ix.bind(s.VarName, s.Span, s.Body, s.Pattern)
+		ix.pop()
+	case *ast.TryStmt:
+		ix.block(s.Body)
+		ix.bind(s.CatchParam, s.Span, s.CatchBody)
+	case *ast.MatchStmt:
+		ix.expr(s.Subject)
+		for _, arm := range s.Arms {
+			for _, p := range arm.Patterns {
+				ix.expr(p)
+			}
+			ix.bind(arm.BindVar, arm.Span, arm.Body, arm.Guard)
+		}
+	}
+}
+
+func (ix *index) expr(e ast.Expr) {
+	if e == nil {
+		return
+	}
+	ast.Walk(e, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.IdentExpr:
+			ix.idents = append(ix.idents, x)
+			if sym := ix.lookup(x.Name); sym != nil {
+				ix.refs[x] = sym
+			}
+		case *ast.FuncExpr:
+			ix.function(x.Params, x.Body, x.Span)
+			return false
+		}
+		return true
+	})
+}
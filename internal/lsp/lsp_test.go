@@ -0,0 +1,295 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"light-lang/internal/jsonrpc"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///tmp/main.lt"
+
+// session queues the messages a client would send, then runs the server
+// over them.
+type session struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (s *session) send(method string, params interface{}, call bool) int {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	id := 0
+	if call {
+		s.nextID++
+		id = s.nextID
+		msg["id"] = id
+	}
+	body, _ := json.Marshal(msg)
+	s.in.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n")
+	s.in.Write(body)
+	return id
+}
+
+func (s *session) call(method string, params interface{}) int {
+	return s.send(method, params, true)
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.send(method, params, false)
+}
+
+type message struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+// run serves the queued messages and returns the server's exit code and
+// the messages it wrote.
+func (s *session) run(t *testing.T) (int, []message) {
+	t.Helper()
+	var out bytes.Buffer
+	server := NewServer(jsonrpc.NewConn(&s.in, &out))
+	if err := server.Serve(); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	conn := jsonrpc.NewConn(&out, nil)
+	var msgs []message
+	for {
+		body, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("bad message %s: %v", body, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return server.ExitCode(), msgs
+}
+
+func result(t *testing.T, msgs []message, id int, v interface{}) {
+	t.Helper()
+	for _, msg := range msgs {
+		if msg.ID == id && msg.Method == "" {
+			if err := json.Unmarshal(msg.Result, v); err != nil {
+				t.Fatalf("bad result %s: %v", msg.Result, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+func diagnostics(t *testing.T, msgs []message) [][]Diagnostic {
+	t.Helper()
+	var all [][]Diagnostic
+	for _, msg := range msgs {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, params.Diagnostics)
+		}
+	}
+	return all
+}
+
+func open(s *session, text string) {
+	s.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "light", "version": 1, "text": text},
+	})
+}
+
+func at(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	var s session
+	id := s.call("initialize", map[string]interface{}{})
+	s.notify("initialized", map[string]interface{}{})
+	s.call("shutdown", nil)
+	s.notify("exit", nil)
+	code, msgs := s.run(t)
+	if code != 0 {
+		t.Errorf("expected exit code 0 after shutdown, got %d", code)
+	}
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	result(t, msgs, id, &init)
+	if init.Capabilities["textDocumentSync"] != 2.0 || init.Capabilities["hoverProvider"] != true {
+		t.Errorf("unexpected capabilities %v", init.Capabilities)
+	}
+
+	var exitOnly session
+	exitOnly.notify("exit", nil)
+	if code, _ := exitOnly.run(t); code != 1 {
+		t.Errorf("expected exit code 1 without shutdown, got %d", code)
+	}
+}
+
+func TestDiagnosticsOnChange(t *testing.T) {
+	var s session
+	open(&s, "var x = 1\nprint(x +)\n")
+	// Fix the error: insert "2" after "+"
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]interface{}{
+			{"range": Range{Start: Position{1, 9}, End: Position{1, 9}}, "text": " 2"},
+		},
+	})
+	// Replace the whole text with a warning
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 3},
+		"contentChanges": []map[string]interface{}{{"text": "print(\"1\" == 1)\n"}},
+	})
+	_, msgs := s.run(t)
+	all := diagnostics(t, msgs)
+	if len(all) != 3 {
+		t.Fatalf("expected 3 publishes, got %d", len(all))
+	}
+	if len(all[0]) != 1 || all[0][0].Severity != severityError || all[0][0].Range.Start.Line != 1 {
+		t.Errorf("expected one error on line 2, got %+v", all[0])
+	}
+	if len(all[1]) != 0 {
+		t.Errorf("expected the edit to clear diagnostics, got %+v", all[1])
+	}
+	if len(all[2]) != 1 || all[2][0].Severity != severityWarning || all[2][0].Code != "W3000" {
+		t.Errorf("expected a W3000 warning, got %+v", all[2])
+	}
+}
+
+const program = `/// Adds two numbers.
+function add(a, b) {
+    return a + b
+}
+class Point {
+    constructor(x) { this.x = x }
+    norm() { return add(this.x, 0) }
+}
+enum Color { Red, Green }
+var total = add(1, 2)
+const p = Point(1)
+print(total, p)
+`
+
+func TestDefinition(t *testing.T) {
+	var s session
+	open(&s, program)
+	fn := s.call("textDocument/definition", at(9, 13))    // add in "total = add(...)"
+	param := s.call("textDocument/definition", at(2, 11)) // a in "return a + b"
+	class := s.call("textDocument/definition", at(10, 11))
+	builtin := s.call("textDocument/definition", at(11, 1))
+	_, msgs := s.run(t)
+
+	var loc Location
+	result(t, msgs, fn, &loc)
+	if loc.URI != uri || loc.Range.Start != (Position{1, 0}) {
+		t.Errorf("add: got %+v", loc)
+	}
+	result(t, msgs, param, &loc)
+	if loc.Range.Start != (Position{1, 0}) {
+		t.Errorf("parameter: got %+v", loc)
+	}
+	result(t, msgs, class, &loc)
+	if loc.Range.Start != (Position{4, 0}) {
+		t.Errorf("Point: got %+v", loc)
+	}
+	var none *Location
+	result(t, msgs, builtin, &none)
+	if none != nil {
+		t.Errorf("print: expected null, got %+v", none)
+	}
+}
+
+func TestHover(t *testing.T) {
+	var s session
+	open(&s, program)
+	fn := s.call("textDocument/hover", at(9, 13))
+	variable := s.call("textDocument/hover", at(11, 7))
+	builtin := s.call("textDocument/hover", at(11, 1))
+	nothing := s.call("textDocument/hover", at(11, 12))
+	_, msgs := s.run(t)
+
+	var hover Hover
+	result(t, msgs, fn, &hover)
+	if hover.Contents.Value != "```light\nfunction add(a, b)\n```\n\nAdds two numbers." {
+		t.Errorf("add: got %q", hover.Contents.Value)
+	}
+	if hover.Range == nil || *hover.Range != (Range{Position{9, 12}, Position{9, 15}}) {
+		t.Errorf("add: got range %+v", hover.Range)
+	}
+	result(t, msgs, variable, &hover)
+	if hover.Contents.Value != "```light\nvar total\n```" {
+		t.Errorf("total: got %q", hover.Contents.Value)
+	}
+	result(t, msgs, builtin, &hover)
+	if !strings.HasPrefix(hover.Contents.Value, "```light\nprint(") {
+		t.Errorf("print: got %q", hover.Contents.Value)
+	}
+	var none *Hover
+	result(t, msgs, nothing, &none)
+	if none != nil {
+		t.Errorf("expected null, got %+v", none)
+	}
+}
+
+func TestHoverInferredKind(t *testing.T) {
+	var s session
+	open(&s, "var name = \"light\"\nconst limit = 10\nprint(name, limit)\n")
+	name := s.call("textDocument/hover", at(2, 7))
+	limit := s.call("textDocument/hover", at(2, 13))
+	_, msgs := s.run(t)
+	var hover Hover
+	result(t, msgs, name, &hover)
+	if hover.Contents.Value != "```light\nvar name: string\n```" {
+		t.Errorf("name: got %q", hover.Contents.Value)
+	}
+	result(t, msgs, limit, &hover)
+	if hover.Contents.Value != "```light\nconst limit: int\n```" {
+		t.Errorf("limit: got %q", hover.Contents.Value)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	var s session
+	open(&s, program)
+	id := s.call("textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]string{"uri": uri}})
+	_, msgs := s.run(t)
+	var symbols []DocumentSymbol
+	result(t, msgs, id, &symbols)
+	var got []string
+	var walk func(prefix string, syms []DocumentSymbol)
+	walk = func(prefix string, syms []DocumentSymbol) {
+		for _, sym := range syms {
+			got = append(got, prefix+sym.Name+":"+strconv.Itoa(sym.Kind))
+			walk(prefix+sym.Name+".", sym.Children)
+		}
+	}
+	walk("", symbols)
+	want := "add:12 Point:5 Point.norm:6 Color:10 Color.Red:22 Color.Green:22 total:13 p:14"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	li := newLineIndex("var s = \"😀é\"; var t = s\n")
+	// 😀 is two UTF-16 units and four bytes; é is one unit and two bytes
+	if off := li.offset(Position{0, 12}); off != 15 {
+		t.Errorf("expected byte offset 15, got %d", off)
+	}
+	if pos := li.position(15); pos != (Position{0, 12}) {
+		t.Errorf("expected character 12, got %+v", pos)
+	}
+}
@@ -0,0 +1,171 @@
+package lsp
+
+import (
+	"light-lang/internal/span"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The subset of the Language Server Protocol types the server uses.
+
+// Position is a zero-based line and UTF-16 character offset.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// Diagnostic severities.
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+// Symbol kinds.
+const (
+	symbolClass      = 5
+	symbolMethod     = 6
+	symbolProperty   = 7
+	symbolField      = 8
+	symbolEnum       = 10
+	symbolInterface  = 11
+	symbolFunction   = 12
+	symbolVariable   = 13
+	symbolConstant   = 14
+	symbolEnumMember = 22
+)
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type contentChange struct {
+	Range *Range `json:"range"` // nil replaces the whole document
+	Text  string `json:"text"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []contentChange        `json:"contentChanges"`
+}
+
+type textDocumentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// lineIndex converts between byte offsets, which spans use, and LSP
+// positions, which count UTF-16 code units.
+type lineIndex struct {
+	source string
+	starts []int // byte offset of each line
+}
+
+func newLineIndex(source string) *lineIndex {
+	starts := []int{0}
+	for idx := 0; idx < len(source); idx++ {
+		if source[idx] == '\n' {
+			starts = append(starts, idx+1)
+		}
+	}
+	return &lineIndex{source: source, starts: starts}
+}
+
+// offset returns the byte offset of pos, clamped to the source.
+func (li *lineIndex) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(li.starts) {
+		return len(li.source)
+	}
+	off := li.starts[pos.Line]
+	for units := 0; units < pos.Character && off < len(li.source) && li.source[off] != '\n'; {
+		r, size := utf8.DecodeRuneInString(li.source[off:])
+		units += utf16Len(r)
+		off += size
+	}
+	return off
+}
+
+// position returns the LSP position of a byte offset.
+func (li *lineIndex) position(offset int) Position {
+	offset = min(max(offset, 0), len(li.source))
+	line := sort.Search(len(li.starts), func(k int) bool { return li.starts[k] > offset }) - 1
+	units := 0
+	for _, r := range li.source[li.starts[line]:offset] {
+		units += utf16Len(r)
+	}
+	return Position{Line: line, Character: units}
+}
+
+func (li *lineIndex) rangeOf(s span.Span) Range {
+	return Range{Start: li.position(s.Start.Offset), End: li.position(s.End.Offset)}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// codeBlock formats source text for a markdown hover.
+func codeBlock(text string) string {
+	return "```light\n" + strings.TrimSpace(text) + "\n```"
+}
@@ -0,0 +1,306 @@
+// Package lsp implements a Language Server Protocol server for light-lang
+// source files: diagnostics as documents change, go-to-definition, hover
+// and document symbols. Documents are kept as parser.Documents and updated
+// incrementally with the edits the client sends.
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"light-lang/internal/ast"
+	"light-lang/internal/check"
+	"light-lang/internal/diag"
+	"light-lang/internal/jsonrpc"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/runtime"
+	"strings"
+)
+
+// Server holds the open documents of one client connection.
+type Server struct {
+	conn     *jsonrpc.Conn
+	docs     map[string]*document
+	builtins *runtime.Environment // for hovering over builtin names
+	shutdown bool                 // the client asked to shut down before exiting
+}
+
+// document is an open file and what the server derived from its text.
+type document struct {
+	parsed *parser.Document
+	lines  *lineIndex
+	index  *index
+}
+
+func newDocument(parsed *parser.Document) *document {
+	return &document{parsed: parsed, lines: newLineIndex(parsed.Lex.Source), index: newIndex(parsed.File)}
+}
+
+// NewServer returns a server that talks to the client over conn.
+func NewServer(conn *jsonrpc.Conn) *Server {
+	return &Server{
+		conn:     conn,
+		docs:     make(map[string]*document),
+		builtins: runtime.NewInterpreter(io.Discard).Env(),
+	}
+}
+
+// Serve handles requests until the client exits or closes the stream.
+func (s *Server) Serve() error {
+	return jsonrpc.Serve(s.conn, s.handle)
+}
+
+// ExitCode is the status to exit with after Serve: 0 if the client shut
+// the server down before exiting, 1 otherwise.
+func (s *Server) ExitCode() int {
+	if s.shutdown {
+		return 0
+	}
+	return 1
+}
+
+// null is sent for requests that have no result, such as a hover over
+// nothing.
+var null = json.RawMessage("null")
+
+func (s *Server) handle(req *jsonrpc.Request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       2, // incremental
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "light"},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return null, nil
+	case "exit":
+		return nil, jsonrpc.ErrStop
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := jsonrpc.DecodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		uri := params.TextDocument.URI
+		s.docs[uri] = newDocument(parser.ParseDocument(params.TextDocument.Text, uriPath(uri)))
+		return nil, s.publishDiagnostics(uri)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := jsonrpc.DecodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		uri := params.TextDocument.URI
+		doc, ok := s.docs[uri]
+		if !ok {
+			return nil, nil
+		}
+		parsed := doc.parsed
+		for _, change := range params.ContentChanges {
+			if change.Range == nil {
+				parsed = parser.ParseDocument(change.Text, uriPath(uri))
+				continue
+			}
+			lines := newLineIndex(parsed.Lex.Source)
+			parsed = parsed.Apply(lexer.Edit{
+				Start: lines.offset(change.Range.Start),
+				End:   lines.offset(change.Range.End),
+				Text:  change.Text,
+			})
+		}
+		s.docs[uri] = newDocument(parsed)
+		return nil, s.publishDiagnostics(uri)
+	case "textDocument/didClose":
+		var params textDocumentParams
+		if err := jsonrpc.DecodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		// Clear the closed file's diagnostics
+		return nil, s.conn.Notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+	case "textDocument/definition":
+		doc, ident, err := s.identAt(req)
+		if err != nil || ident == nil {
+			return null, err
+		}
+		sym := doc.index.refs[ident]
+		if sym == nil {
+			return null, nil
+		}
+		var params positionParams
+		jsonrpc.DecodeParams(req, &params)
+		return Location{URI: params.TextDocument.URI, Range: doc.lines.rangeOf(sym.span)}, nil
+	case "textDocument/hover":
+		doc, ident, err := s.identAt(req)
+		if err != nil || ident == nil {
+			return null, err
+		}
+		text := s.describe(doc, ident)
+		if text == "" {
+			return null, nil
+		}
+		r := doc.lines.rangeOf(ident.Span)
+		return Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}, nil
+	case "textDocument/documentSymbol":
+		var params textDocumentParams
+		if err := jsonrpc.DecodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return []DocumentSymbol{}, nil
+		}
+		return documentSymbols(doc), nil
+
+	default:
+		if req.IsNotification() {
+			return nil, nil
+		}
+		return nil, jsonrpc.Errorf(jsonrpc.MethodNotFound, "unknown method '%s'", req.Method)
+	}
+}
+
+// identAt returns the document and the identifier at the request's
+// position, if any.
+func (s *Server) identAt(req *jsonrpc.Request) (*document, *ast.IdentExpr, error) {
+	var params positionParams
+	if err := jsonrpc.DecodeParams(req, &params); err != nil {
+		return nil, nil, err
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil, nil
+	}
+	return doc, doc.index.identAt(doc.lines.offset(params.Position)), nil
+}
+
+// describe returns the hover text for ident: its declaration and doc
+// comment, or the signature and doc of a builtin.
+func (s *Server) describe(doc *document, ident *ast.IdentExpr) string {
+	if sym := doc.index.refs[ident]; sym != nil {
+		text := codeBlock(sym.detail)
+		if sym.doc != "" {
+			text += "\n\n" + sym.doc
+		}
+		return text
+	}
+	if val, ok := s.builtins.Get(ident.Name); ok {
+		if b, ok := val.(*runtime.BuiltinVal); ok {
+			text := codeBlock(b.Signature)
+			if b.Doc != "" {
+				text += "\n\n" + b.Doc
+			}
+			return text
+		}
+	}
+	return ""
+}
+
+func (s *Server) publishDiagnostics(uri string) error {
+	doc := s.docs[uri]
+	diags := append(doc.parsed.Diagnostics(), check.File(doc.parsed.File)...)
+	out := make([]Diagnostic, 0, len(diags))
+	for _, d := range diags {
+		severity := severityError
+		if d.Severity == diag.Warning {
+			severity = severityWarning
+		}
+		message := d.Message
+		if d.Hint != "" {
+			message += " (hint: " + d.Hint + ")"
+		}
+		out = append(out, Diagnostic{
+			Range:    doc.lines.rangeOf(d.Span),
+			Severity: severity,
+			Code:     d.Code,
+			Source:   "light",
+			Message:  message,
+		})
+	}
+	return s.conn.Notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: out})
+}
+
+// documentSymbols lists the top-level declarations, with the methods of
+// classes and the variants of enums as children.
+func documentSymbols(doc *document) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	add := func(name, detail string, kind int, node ast.Node, children []DocumentSymbol) {
+		r := doc.lines.rangeOf(node.GetSpan())
+		symbols = append(symbols, DocumentSymbol{Name: name, Detail: detail, Kind: kind, Range: r, SelectionRange: r, Children: children})
+	}
+	for _, node := range doc.parsed.File.Body {
+		switch d := node.(type) {
+		case *ast.FuncDecl:
+			add(d.Name, funcDetail("function "+d.Name, d.Params, d.Rest), symbolFunction, d, nil)
+		case *ast.ClassDecl:
+			var children []DocumentSymbol
+			for _, f := range d.Fields {
+				r := doc.lines.rangeOf(d.Span)
+				children = append(children, DocumentSymbol{Name: f, Kind: symbolField, Range: r, SelectionRange: r})
+			}
+			for _, f := range d.Props {
+				r := doc.lines.rangeOf(f.Span)
+				children = append(children, DocumentSymbol{Name: f.Name, Kind: symbolField, Range: r, SelectionRange: r})
+			}
+			for _, st := range d.Statics {
+				r := doc.lines.rangeOf(st.Span)
+				detail := "static"
+				if st.IsConst {
+					detail = "static const"
+				}
+				children = append(children, DocumentSymbol{Name: st.Name, Detail: detail, Kind: symbolField, Range: r, SelectionRange: r})
+			}
+			for _, m := range d.Getters {
+				r := doc.lines.rangeOf(m.Span)
+				children = append(children, DocumentSymbol{Name: m.Name, Detail: "get", Kind: symbolProperty, Range: r, SelectionRange: r})
+			}
+			for _, m := range d.Setters {
+				r := doc.lines.rangeOf(m.Span)
+				children = append(children, DocumentSymbol{Name: m.Name, Detail: "set", Kind: symbolProperty, Range: r, SelectionRange: r})
+			}
+			for _, m := range d.StaticMethods {
+				r := doc.lines.rangeOf(m.Span)
+				children = append(children, DocumentSymbol{Name: m.Name, Detail: "static " + funcDetail(m.Name, m.Params, m.Rest), Kind: symbolMethod, Range: r, SelectionRange: r})
+			}
+			for _, m := range d.Methods {
+				r := doc.lines.rangeOf(m.Span)
+				children = append(children, DocumentSymbol{Name: m.Name, Detail: funcDetail(m.Name, m.Params, m.Rest), Kind: symbolMethod, Range: r, SelectionRange: r})
+			}
+			add(d.Name, classDetail(d), symbolClass, d, children)
+		case *ast.EnumDecl:
+			var children []DocumentSymbol
+			for _, v := range d.Variants {
+				r := doc.lines.rangeOf(d.Span)
+				children = append(children, DocumentSymbol{Name: v, Kind: symbolEnumMember, Range: r, SelectionRange: r})
+			}
+			add(d.Name, "enum", symbolEnum, d, children)
+		case *ast.InterfaceDecl:
+			add(d.Name, "interface", symbolInterface, d, nil)
+		case *ast.VarDeclStmt:
+			kind := symbolVariable
+			if d.IsConst {
+				kind = symbolConstant
+			}
+			names := d.Names
+			if len(names) == 0 {
+				names = []string{d.Name}
+			}
+			for _, name := range names {
+				add(name, "", kind, d, nil)
+			}
+		}
+	}
+	return symbols
+}
+
+// uriPath turns a file:// URI into the path diagnostics are reported for.
+func uriPath(uri string) string {
+	return strings.TrimPrefix(uri, "file://")
+}
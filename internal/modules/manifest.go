@@ -0,0 +1,492 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"light-lang/internal/lexer"
+	"light-lang/internal/token"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// light.toml and light.lock
+// ============================================================
+//
+// A project can declare its dependencies in light.toml instead of naming
+// full remote paths in every import:
+//
+//	[package]
+//	name = "app"
+//
+//	[dependencies]
+//	strutil = "github.com/user/strutil@^1.2.0"
+//
+// An import whose first element is a dependency name, such as
+// import "strutil/case", then reads case.lt from the version of
+// github.com/user/strutil recorded in light.lock. `light get` with no
+// arguments resolves each constraint to the highest matching tag, downloads
+// the files the project imports and records the versions and file checksums
+// in light.lock. Versions already locked are kept while they still satisfy
+// the manifest, so every checkout of a project builds the same code.
+
+// Manifest and lockfile names.
+const (
+	ManifestFile = "light.toml"
+	LockFile     = "light.lock"
+)
+
+// Manifest is a parsed light.toml.
+type Manifest struct {
+	Dir     string // directory holding light.toml
+	Name    string
+	Version string
+	Deps    map[string]Dependency // by import name
+}
+
+// Dependency is a module declared in light.toml.
+type Dependency struct {
+	Name       string // first element of imports that use it
+	Source     string // remote path of the module root, e.g. github.com/user/lib
+	Constraint string // version constraint, see ParseConstraint
+}
+
+// LockedDep is the resolved version of a dependency and the checksums of
+// its files, by path within the dependency.
+type LockedDep struct {
+	Source  string
+	Version string
+	Sums    map[string]string
+}
+
+// Lock maps dependency names to their resolved versions.
+type Lock map[string]*LockedDep
+
+// FindManifest looks for light.toml in dir and its parents. It returns nil
+// if there is none.
+func FindManifest(dir string) (*Manifest, error) {
+	file := findUp(dir, ManifestFile)
+	if file == "" {
+		return nil, nil
+	}
+	return ReadManifest(file)
+}
+
+// ReadManifest parses a light.toml file.
+func ReadManifest(file string) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := parseTOML(file, string(data))
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		Dir:     filepath.Dir(file),
+		Name:    tables["package"]["name"],
+		Version: tables["package"]["version"],
+		Deps:    make(map[string]Dependency),
+	}
+	for name, spec := range tables["dependencies"] {
+		source, constraint, _ := strings.Cut(spec, "@")
+		parts := strings.Split(source, "/")
+		if !IsRemote(source+"/") || parts[0] == "github.com" && len(parts) != 3 {
+			return nil, fmt.Errorf("%s: dependency '%s' must name a remote module like github.com/user/repo@^1.0.0", file, name)
+		}
+		if constraint == "" {
+			constraint = "*"
+		}
+		if _, err := ParseConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("%s: dependency '%s': %v", file, name, err)
+		}
+		m.Deps[name] = Dependency{Name: name, Source: source, Constraint: constraint}
+	}
+	return m, nil
+}
+
+// LockPath returns where the manifest's lockfile lives.
+func (m *Manifest) LockPath() string {
+	return filepath.Join(m.Dir, LockFile)
+}
+
+// ReadLock parses a light.lock file. A missing file yields no entries.
+func ReadLock(file string) (Lock, error) {
+	lock := Lock{}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tables, err := parseTOML(file, string(data))
+	if err != nil {
+		return nil, err
+	}
+	for name, keys := range tables {
+		if name == "" {
+			continue
+		}
+		dep := &LockedDep{Source: keys["source"], Version: keys["version"], Sums: make(map[string]string)}
+		for k, v := range keys {
+			if k != "source" && k != "version" {
+				dep.Sums[k] = v
+			}
+		}
+		lock[name] = dep
+	}
+	return lock, nil
+}
+
+// Write stores the lock, sorted by dependency name and file path.
+func (l Lock) Write(file string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by light get. Do not edit.\n")
+	for _, name := range sortedKeys(l) {
+		dep := l[name]
+		fmt.Fprintf(&b, "\n[%s]\nsource = %q\nversion = %q\n", name, dep.Source, dep.Version)
+		for _, p := range sortedKeys(dep.Sums) {
+			fmt.Fprintf(&b, "%q = %q\n", p, dep.Sums[p])
+		}
+	}
+	return os.WriteFile(file, []byte(b.String()), 0o644)
+}
+
+// splitDependency splits an import path into a dependency name and the file
+// it names within the dependency, or reports false for relative, absolute
+// and remote paths.
+func splitDependency(importPath string) (name, file string, ok bool) {
+	if strings.HasPrefix(importPath, ".") || filepath.IsAbs(importPath) || IsRemote(importPath) {
+		return "", "", false
+	}
+	name, file, ok = strings.Cut(importPath, "/")
+	if !ok || file == "" {
+		return "", "", false
+	}
+	return name, withExt(file), true
+}
+
+// ResolveDependency resolves an import through the light.toml found from
+// projectDir. It reports false, with no error, when there is no manifest or
+// the import does not start with a dependency name; such imports are local.
+// Otherwise it returns the cached file after checking that light.lock pins
+// a version matching the manifest and that the file matches its checksum.
+func ResolveDependency(importPath, projectDir string) (string, bool, error) {
+	name, rel, ok := splitDependency(importPath)
+	if !ok {
+		return "", false, nil
+	}
+	m, err := FindManifest(projectDir)
+	if err != nil {
+		return "", true, err
+	}
+	if m == nil {
+		return "", false, nil
+	}
+	dep, ok := m.Deps[name]
+	if !ok {
+		return "", false, nil
+	}
+
+	lock, err := ReadLock(m.LockPath())
+	if err != nil {
+		return "", true, err
+	}
+	locked := lock[name]
+	if locked == nil || !locked.matches(dep) {
+		return "", true, fmt.Errorf("%s does not pin dependency '%s'; run 'light get'", LockFile, name)
+	}
+	want, ok := locked.Sums[rel]
+	if !ok {
+		return "", true, fmt.Errorf("%s has no checksum for '%s'; run 'light get'", LockFile, importPath)
+	}
+
+	remote := locked.remotePath(rel)
+	file, err := CachePath(remote)
+	if err != nil {
+		return "", true, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", true, fmt.Errorf("module '%s' is not downloaded; run 'light get'", importPath)
+	}
+	if got := Checksum(data); got != want {
+		return "", true, fmt.Errorf("checksum mismatch for module '%s': %s has %s, cache has %s", importPath, LockFile, want, got)
+	}
+	return file, true, nil
+}
+
+// matches reports whether a locked version still satisfies dep.
+func (l *LockedDep) matches(dep Dependency) bool {
+	if l.Source != dep.Source {
+		return false
+	}
+	c, err := ParseConstraint(dep.Constraint)
+	if err != nil {
+		return false
+	}
+	v, err := ParseVersion(l.Version)
+	return err == nil && c.Allows(v)
+}
+
+// remotePath returns the remote import path of a file in the locked
+// version, like github.com/user/repo@v1.2.0/file.lt.
+func (l *LockedDep) remotePath(rel string) string {
+	return l.Source + "@" + l.Version + "/" + rel
+}
+
+// GetDependencies resolves the dependencies in the light.toml found from
+// dir, downloads every dependency file imported by the project's sources
+// and writes light.lock. It returns the updated lock.
+func GetDependencies(dir string) (Lock, error) {
+	m, err := FindManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("no %s found in %s or its parents", ManifestFile, dir)
+	}
+	old, err := ReadLock(m.LockPath())
+	if err != nil {
+		return nil, err
+	}
+
+	lock := Lock{}
+	for _, name := range sortedKeys(m.Deps) {
+		dep := m.Deps[name]
+		if prev := old[name]; prev != nil && prev.matches(dep) {
+			lock[name] = &LockedDep{Source: prev.Source, Version: prev.Version, Sums: make(map[string]string)}
+			continue
+		}
+		tags, err := ListVersions(dep.Source)
+		if err != nil {
+			return nil, err
+		}
+		c, _ := ParseConstraint(dep.Constraint)
+		tag, ok := c.Select(tags)
+		if !ok {
+			return nil, fmt.Errorf("no version of %s matches '%s'", dep.Source, dep.Constraint)
+		}
+		lock[name] = &LockedDep{Source: dep.Source, Version: tag, Sums: make(map[string]string)}
+	}
+
+	imports, err := scanImports(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, importPath := range imports {
+		name, rel, ok := splitDependency(importPath)
+		locked := lock[name]
+		if !ok || locked == nil || locked.Sums[rel] != "" {
+			continue
+		}
+		remote := locked.remotePath(rel)
+		want := ""
+		if prev := old[name]; prev != nil && prev.Version == locked.Version {
+			want = prev.Sums[rel]
+		}
+		if want != "" && cachedSum(remote) == want {
+			locked.Sums[rel] = want
+			continue
+		}
+		data, err := fetch(remote)
+		if err != nil {
+			return nil, err
+		}
+		sum := Checksum(data)
+		if want != "" && want != sum {
+			return nil, fmt.Errorf("checksum mismatch for %s: %s has %s, downloaded %s", importPath, LockFile, want, sum)
+		}
+		if err := store(remote, data); err != nil {
+			return nil, err
+		}
+		locked.Sums[rel] = sum
+	}
+	return lock, lock.Write(m.LockPath())
+}
+
+// cachedSum returns the checksum of a cached remote module, or "" if it is
+// not in the cache.
+func cachedSum(importPath string) string {
+	file, err := CachePath(importPath)
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return Checksum(data)
+}
+
+// scanImports returns the module paths imported by the source files under
+// dir, skipping hidden directories.
+func scanImports(dir string) ([]string, error) {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(p) != SourceExt {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		for _, importPath := range sourceImports(p, data) {
+			seen[importPath] = true
+		}
+		return nil
+	})
+	return sortedKeys(seen), err
+}
+
+// sourceImports returns the module paths imported by a source file.
+func sourceImports(file string, data []byte) []string {
+	var imports []string
+	tokens, _ := lexer.New(string(data), file).Tokenize()
+	for idx := 0; idx+1 < len(tokens); idx++ {
+		if tokens[idx].Kind == token.KW_IMPORT && tokens[idx+1].Kind == token.STRING {
+			imports = append(imports, tokens[idx+1].Lexeme)
+		}
+	}
+	return imports
+}
+
+// ListVersions returns the tags published for a module root: from
+// LIGHT_MODPROXY/<source>/@v/list if set, the GitHub tags API for github.com
+// modules, and https://<source>/@v/list otherwise.
+func ListVersions(source string) ([]string, error) {
+	parts := strings.Split(source, "/")
+	var url string
+	switch {
+	case os.Getenv(ProxyEnv) != "":
+		url = strings.TrimRight(os.Getenv(ProxyEnv), "/") + "/" + source + "/@v/list"
+	case parts[0] == "github.com" && len(parts) == 3:
+		url = fmt.Sprintf("https://api.github.com/repos/%s/%s/tags", parts[1], parts[2])
+	default:
+		url = "https://" + source + "/@v/list"
+	}
+
+	data, err := download(url)
+	if err != nil {
+		return nil, fmt.Errorf("listing versions of %s: %v", source, err)
+	}
+	if strings.HasPrefix(url, "https://api.github.com/") {
+		var tags []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &tags); err != nil {
+			return nil, fmt.Errorf("listing versions of %s: %v", source, err)
+		}
+		names := make([]string, len(tags))
+		for idx, t := range tags {
+			names[idx] = t.Name
+		}
+		return names, nil
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// httpClient fetches modules and version lists, giving up on servers that
+// stall instead of hanging `light get`.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// download returns the body of a successful GET.
+func download(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseTOML reads the subset of TOML used by light.toml and light.lock:
+// [table] headers and key = "string" pairs, with bare or quoted keys and #
+// comments. Keys before the first header belong to table "".
+func parseTOML(file, src string) (map[string]map[string]string, error) {
+	tables := map[string]map[string]string{"": {}}
+	current := ""
+	for n, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			if tables[current] == nil {
+				tables[current] = make(map[string]string)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = \"value\"", file, n+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if strings.HasPrefix(key, "\"") {
+			unquoted, err := strconv.Unquote(key)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: malformed key %s", file, n+1, key)
+			}
+			key = unquoted
+		}
+		if idx := strings.LastIndex(value, "\" #"); idx >= 0 {
+			value = value[:idx+1] // trailing comment
+		}
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: value of '%s' must be a quoted string", file, n+1, key)
+		}
+		tables[current][key] = unquoted
+	}
+	return tables, nil
+}
+
+// findUp looks for name in dir and its parents. It returns "" if there is
+// none.
+func findUp(dir, name string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
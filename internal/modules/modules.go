@@ -0,0 +1,351 @@
+// Package modules resolves import paths to source files and manages the
+// local cache of remote modules.
+//
+// Local imports ("./util.lt", "../lib/x") are resolved relative to the
+// importing file. Remote imports name a host first, like Go import paths:
+//
+//	import "github.com/user/lib/util.lt"        // default branch
+//	import "github.com/user/lib@v1.2.0/util.lt" // tag, branch or commit
+//
+// Remote modules are never fetched while a program runs. `light get`
+// downloads them into the module cache and records their SHA-256 in
+// light.sum; imports then read the cached copy and verify it against the
+// recorded checksum. Relative imports inside a remote module name remote
+// modules too: `light get` downloads them along with it, and they are
+// verified against light.sum the same way.
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SourceExt is the extension of light-lang source files.
+const SourceExt = ".lt"
+
+// SumFile is the name of the checksum file written by `light get`.
+const SumFile = "light.sum"
+
+// Environment variables that configure remote modules.
+const (
+	CacheEnv = "LIGHT_MODCACHE" // cache directory override
+	ProxyEnv = "LIGHT_MODPROXY" // base URL serving modules by import path
+)
+
+// IsRemote reports whether an import path names a remote module, which is
+// the case when its first element looks like a host name.
+func IsRemote(importPath string) bool {
+	if strings.HasPrefix(importPath, ".") || filepath.IsAbs(importPath) {
+		return false
+	}
+	host, _, ok := strings.Cut(importPath, "/")
+	return ok && strings.Contains(host, ".")
+}
+
+// withExt appends SourceExt when the path has no extension.
+func withExt(p string) string {
+	if path.Ext(p) == "" {
+		return p + SourceExt
+	}
+	return p
+}
+
+// ResolveLocal resolves a local import relative to the importing file's directory.
+func ResolveLocal(importPath, fromDir string) string {
+	p := filepath.FromSlash(withExt(importPath))
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(fromDir, p)
+}
+
+// ResolveFS resolves a local import within an fs.FS, where paths are
+// slash-separated and relative to the FS root.
+func ResolveFS(importPath, fromDir string) (string, error) {
+	p := path.Join(fromDir, withExt(importPath))
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("import '%s' escapes the embedded filesystem", importPath)
+	}
+	return p, nil
+}
+
+// CacheDir returns the module cache directory.
+func CacheDir() (string, error) {
+	if dir := os.Getenv(CacheEnv); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate module cache: %v (set %s)", err, CacheEnv)
+	}
+	return filepath.Join(base, "light", "mod"), nil
+}
+
+// CachePath returns where a remote module is stored in the cache. Paths
+// that could name a file outside the cache are rejected.
+func CachePath(importPath string) (string, error) {
+	if err := checkRemotePath(importPath); err != nil {
+		return "", err
+	}
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, filepath.FromSlash(withExt(importPath)))
+	if rel, err := filepath.Rel(dir, p); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("remote module '%s' is outside the module cache", importPath)
+	}
+	return p, nil
+}
+
+// checkRemotePath reports an error for a remote import path with an empty,
+// "." or ".." element or a backslash.
+func checkRemotePath(importPath string) error {
+	for _, elem := range strings.Split(importPath, "/") {
+		if elem == "" || elem == "." || elem == ".." || strings.Contains(elem, `\`) {
+			return fmt.Errorf("invalid remote module path '%s'", importPath)
+		}
+	}
+	return nil
+}
+
+// SourceURL returns the URL a remote module is downloaded from.
+func SourceURL(importPath string) (string, error) {
+	if !IsRemote(importPath) {
+		return "", fmt.Errorf("'%s' is not a remote module path", importPath)
+	}
+	if err := checkRemotePath(importPath); err != nil {
+		return "", err
+	}
+	p := withExt(importPath)
+	if proxy := os.Getenv(ProxyEnv); proxy != "" {
+		return strings.TrimRight(proxy, "/") + "/" + p, nil
+	}
+
+	parts := strings.Split(p, "/")
+	if parts[0] == "github.com" {
+		if len(parts) < 4 {
+			return "", fmt.Errorf("'%s': github modules look like github.com/user/repo/file.lt", importPath)
+		}
+		repo, ref, ok := strings.Cut(parts[2], "@")
+		if !ok {
+			ref = "HEAD"
+		}
+		return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s",
+			parts[1], repo, ref, strings.Join(parts[3:], "/")), nil
+	}
+	return "https://" + p, nil
+}
+
+// Checksum returns the checksum recorded for module contents.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ============================================================
+// light.sum
+// ============================================================
+
+// Sums maps import paths to checksums.
+type Sums map[string]string
+
+// FindSumFile looks for light.sum in dir and its parents. It returns "" if
+// there is none.
+func FindSumFile(dir string) string {
+	return findUp(dir, SumFile)
+}
+
+// ReadSums parses a light.sum file. A missing file yields no entries.
+func ReadSums(file string) (Sums, error) {
+	sums := Sums{}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: malformed line", file, n+1)
+		}
+		sums[fields[0]] = fields[1]
+	}
+	return sums, nil
+}
+
+// Write stores the sums, sorted by import path.
+func (s Sums) Write(file string) error {
+	paths := make([]string, 0, len(s))
+	for p := range s {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s %s\n", p, s[p])
+	}
+	return os.WriteFile(file, []byte(b.String()), 0o644)
+}
+
+// ============================================================
+// Fetching and verification
+// ============================================================
+
+// Get downloads a remote module into the cache and records its checksum in
+// sumFile. If sumFile already has a checksum for the module, the download
+// must match it.
+//
+// Modules it imports by relative path are downloaded and recorded too.
+func Get(importPath, sumFile string) error {
+	sums, err := ReadSums(sumFile)
+	if err != nil {
+		return err
+	}
+	if err := get(importPath, sums, make(map[string]bool)); err != nil {
+		return err
+	}
+	return sums.Write(sumFile)
+}
+
+// get downloads a remote module and the modules it imports by relative
+// path, recording their checksums in sums. done holds the modules already
+// downloaded, so import cycles end.
+func get(importPath string, sums Sums, done map[string]bool) error {
+	if done[importPath] {
+		return nil
+	}
+	done[importPath] = true
+	data, err := fetch(importPath)
+	if err != nil {
+		return err
+	}
+
+	sum := Checksum(data)
+	if want, ok := sums[importPath]; ok && want != sum {
+		return fmt.Errorf("checksum mismatch for %s: %s has %s, downloaded %s", importPath, SumFile, want, sum)
+	}
+	if err := store(importPath, data); err != nil {
+		return err
+	}
+	sums[importPath] = sum
+
+	for _, imported := range sourceImports(importPath, data) {
+		if !strings.HasPrefix(imported, ".") {
+			continue
+		}
+		remote, err := remoteRelative(imported, path.Dir(importPath))
+		if err != nil {
+			return err
+		}
+		if err := get(remote, sums, done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteRelative returns the remote import path of a relative import made
+// by a remote module in fromDir.
+func remoteRelative(importPath, fromDir string) (string, error) {
+	remote := path.Join(fromDir, withExt(importPath))
+	host, _, _ := strings.Cut(fromDir, "/")
+	if !IsRemote(remote) || !strings.HasPrefix(remote, host+"/") {
+		return "", fmt.Errorf("import '%s' in remote module %s escapes its host", importPath, fromDir)
+	}
+	return remote, nil
+}
+
+// fetch downloads a remote module.
+func fetch(importPath string) ([]byte, error) {
+	url, err := SourceURL(importPath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := download(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", importPath, err)
+	}
+	return data, nil
+}
+
+// store writes a downloaded module into the cache.
+func store(importPath string, data []byte) error {
+	dst, err := CachePath(importPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
+
+// ResolveRemote returns the cached file for a remote module after checking
+// it against the checksum recorded in the light.sum found from projectDir,
+// the directory of the program's entry file.
+func ResolveRemote(importPath, projectDir string) (string, error) {
+	file, err := CachePath(importPath)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("module '%s' is not downloaded; run 'light get %s'", importPath, importPath)
+	}
+
+	sumFile := FindSumFile(projectDir)
+	if sumFile == "" {
+		return "", fmt.Errorf("no %s found for module '%s'; run 'light get %s'", SumFile, importPath, importPath)
+	}
+	sums, err := ReadSums(sumFile)
+	if err != nil {
+		return "", err
+	}
+	want, ok := sums[importPath]
+	if !ok {
+		return "", fmt.Errorf("missing checksum for module '%s' in %s; run 'light get %s'", importPath, sumFile, importPath)
+	}
+	if got := Checksum(data); got != want {
+		return "", fmt.Errorf("checksum mismatch for module '%s': %s has %s, cache has %s", importPath, sumFile, want, got)
+	}
+	return file, nil
+}
+
+// ResolveCached resolves a local import made by a module in the module
+// cache, where fromDir is the importing module's directory. It reports
+// false, with no error, when fromDir is outside the cache. Otherwise the
+// import names a remote module, which it resolves with ResolveRemote so
+// that the file is checked against light.sum.
+func ResolveCached(importPath, fromDir, projectDir string) (string, bool, error) {
+	if filepath.IsAbs(importPath) {
+		return "", false, nil
+	}
+	cache, err := CacheDir()
+	if err != nil {
+		return "", false, nil
+	}
+	rel, err := filepath.Rel(cache, fromDir)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false, nil
+	}
+	remote, err := remoteRelative(importPath, filepath.ToSlash(rel))
+	if err != nil {
+		return "", true, err
+	}
+	file, err := ResolveRemote(remote, projectDir)
+	return file, true, err
+}
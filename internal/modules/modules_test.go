@@ -0,0 +1,262 @@
+package modules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsRemote(t *testing.T) {
+	cases := map[string]bool{
+		"github.com/user/lib/util.lt": true,
+		"example.com/x":               true,
+		"./util.lt":                   false,
+		"../lib/util":                 false,
+		"lib/util.lt":                 false,
+	}
+	for path, want := range cases {
+		if got := IsRemote(path); got != want {
+			t.Errorf("IsRemote(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	t.Setenv(ProxyEnv, "")
+	cases := map[string]string{
+		"github.com/user/lib/util.lt":      "https://raw.githubusercontent.com/user/lib/HEAD/util.lt",
+		"github.com/user/lib@v1.2.0/src/a": "https://raw.githubusercontent.com/user/lib/v1.2.0/src/a.lt",
+		"example.com/modules/strings.lt":   "https://example.com/modules/strings.lt",
+	}
+	for path, want := range cases {
+		got, err := SourceURL(path)
+		if err != nil || got != want {
+			t.Errorf("SourceURL(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestCachePathStaysInCache(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv(CacheEnv, cache)
+	for _, path := range []string{
+		"github.com/u/r/../../../../../tmp/pwned.lt",
+		"example.com/../../pwned.lt",
+		"example.com//x.lt",
+		"example.com/./x.lt",
+		`example.com/a\..\..\x.lt`,
+	} {
+		if got, err := CachePath(path); err == nil {
+			t.Errorf("CachePath(%q) = %q, want an error", path, got)
+		}
+		if _, err := SourceURL(path); err == nil {
+			t.Errorf("SourceURL(%q) accepted the path", path)
+		}
+	}
+	got, err := CachePath("example.com/lib/greet")
+	if want := filepath.Join(cache, "example.com", "lib", "greet.lt"); err != nil || got != want {
+		t.Errorf("CachePath = %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestGetAndResolveRemote(t *testing.T) {
+	content := "function greet(n) { return \"hi \" + n }\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/example.com/lib/greet.lt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	project := t.TempDir()
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Setenv(ProxyEnv, srv.URL)
+	sumFile := filepath.Join(project, SumFile)
+	const mod = "example.com/lib/greet.lt"
+
+	if _, err := ResolveRemote(mod, project); err == nil || !strings.Contains(err.Error(), "not downloaded") {
+		t.Fatalf("expected not-downloaded error, got %v", err)
+	}
+	if err := Get(mod, sumFile); err != nil {
+		t.Fatal(err)
+	}
+	file, err := ResolveRemote(mod, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != content {
+		t.Errorf("cached module has wrong contents: %q", data)
+	}
+
+	// A modified cache entry no longer matches light.sum
+	os.WriteFile(file, []byte("tampered"), 0o644)
+	if _, err := ResolveRemote(mod, project); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+
+	// So does a changed upstream
+	content = "changed"
+	if err := Get(mod, sumFile); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch on re-get, got %v", err)
+	}
+}
+
+func TestConstraintSelect(t *testing.T) {
+	tags := []string{"v0.9.0", "v1.0.0", "v1.2.0", "v1.2.5", "v1.3.0", "v2.0.0-beta.1", "v2.0.0", "latest"}
+	cases := map[string]string{
+		"*":             "v2.0.0",
+		"^1.2.0":        "v1.3.0",
+		"~1.2.0":        "v1.2.5",
+		"1.2.0":         "v1.2.0",
+		">=1.0, <1.2.5": "v1.2.0",
+		"^0.9":          "v0.9.0",
+		"=2.0.0-beta.1": "v2.0.0-beta.1",
+		"^3":            "",
+	}
+	for spec, want := range cases {
+		c, err := ParseConstraint(spec)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", spec, err)
+		}
+		if got, _ := c.Select(tags); got != want {
+			t.Errorf("Select(%q) = %q, want %q", spec, got, want)
+		}
+	}
+	if _, err := ParseConstraint("^x.y"); err == nil {
+		t.Error("expected error for malformed constraint")
+	}
+}
+
+func TestGetDependencies(t *testing.T) {
+	files := map[string]string{
+		"/example.com/strutil/@v/list":         "v1.0.0\nv1.1.0\nv2.0.0\n",
+		"/example.com/strutil@v1.1.0/case.lt":  "function shout(s) { return s + \"!\" }\n",
+		"/example.com/strutil@v1.0.0/case.lt":  "old",
+		"/example.com/strutil@v1.1.0/other.lt": "unused",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	project := t.TempDir()
+	t.Setenv(CacheEnv, t.TempDir())
+	t.Setenv(ProxyEnv, srv.URL)
+	os.WriteFile(filepath.Join(project, ManifestFile), []byte(`# app manifest
+[package]
+name = "app"
+
+[dependencies]
+strutil = "example.com/strutil@^1.0.0"
+`), 0o644)
+	os.WriteFile(filepath.Join(project, "main.lt"), []byte("import \"strutil/case\"\nimport \"./local\"\n"), 0o644)
+
+	if _, ok, err := ResolveDependency("strutil/case", project); !ok || err == nil || !strings.Contains(err.Error(), "run 'light get'") {
+		t.Fatalf("expected unpinned error, got ok=%v err=%v", ok, err)
+	}
+	if _, ok, err := ResolveDependency("lib/util", project); ok || err != nil {
+		t.Errorf("expected non-dependency import to stay local, got ok=%v err=%v", ok, err)
+	}
+
+	lock, err := GetDependencies(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep := lock["strutil"]
+	if dep == nil || dep.Version != "v1.1.0" || len(dep.Sums) != 1 || dep.Sums["case.lt"] == "" {
+		t.Fatalf("expected strutil locked at v1.1.0 with case.lt, got %+v", dep)
+	}
+	file, ok, err := ResolveDependency("strutil/case", project)
+	if !ok || err != nil {
+		t.Fatalf("resolve: ok=%v err=%v", ok, err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "shout") {
+		t.Errorf("resolved the wrong file: %q", data)
+	}
+
+	// A newer matching release does not move the locked version
+	files["/example.com/strutil/@v/list"] += "v1.2.0\n"
+	if lock, err = GetDependencies(project); err != nil || lock["strutil"].Version != "v1.1.0" {
+		t.Errorf("expected the lock to keep v1.1.0, got %+v, %v", lock["strutil"], err)
+	}
+
+	// Tampering with the cache is caught
+	os.WriteFile(file, []byte("tampered"), 0o644)
+	if _, _, err := ResolveDependency("strutil/case", project); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestGetRelativeImports(t *testing.T) {
+	files := map[string]string{
+		"/example.com/lib/greet.lt":     "import \"./text/util\"\n",
+		"/example.com/lib/text/util.lt": "import \"../greet.lt\"\nfunction upper(s) { return s }\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	project := t.TempDir()
+	cache := t.TempDir()
+	t.Setenv(CacheEnv, cache)
+	t.Setenv(ProxyEnv, srv.URL)
+	sumFile := filepath.Join(project, SumFile)
+
+	if err := Get("example.com/lib/greet.lt", sumFile); err != nil {
+		t.Fatal(err)
+	}
+	sums, _ := ReadSums(sumFile)
+	if _, ok := sums["example.com/lib/text/util.lt"]; !ok {
+		t.Fatalf("light.sum is missing the relative import: %v", sums)
+	}
+
+	fromDir := filepath.Join(cache, "example.com", "lib")
+	file, ok, err := ResolveCached("./text/util", fromDir, project)
+	if !ok || err != nil || file != filepath.Join(fromDir, "text", "util.lt") {
+		t.Fatalf("ResolveCached = %q, %v, %v", file, ok, err)
+	}
+	if _, ok, _ := ResolveCached("./util", project, project); ok {
+		t.Errorf("expected imports outside the cache to be left to ResolveLocal")
+	}
+	if _, _, err := ResolveCached("../../other.com/x", fromDir, project); err == nil || !strings.Contains(err.Error(), "escapes its host") {
+		t.Errorf("expected an escaping import to fail, got %v", err)
+	}
+
+	// The relative import is verified like the module that makes it
+	os.WriteFile(file, []byte("tampered"), 0o644)
+	if _, _, err := ResolveCached("./text/util", fromDir, project); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stop
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	defer func(timeout time.Duration) { httpClient.Timeout = timeout }(httpClient.Timeout)
+	httpClient.Timeout = 50 * time.Millisecond
+	if _, err := download(srv.URL); err == nil {
+		t.Errorf("expected a stalled download to time out")
+	}
+}
@@ -0,0 +1,168 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Versions and constraints
+// ============================================================
+
+// Version is a semantic version parsed from a tag such as v1.2.3.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // pre-release suffix after '-', if any
+	Tag                 string // the tag as written
+}
+
+// ParseVersion parses tags like v1.2.3, 1.2 or v2.0.0-beta.1. Missing minor
+// and patch numbers count as 0.
+func ParseVersion(tag string) (Version, error) {
+	v := Version{Tag: tag}
+	s := strings.TrimPrefix(tag, "v")
+	s, v.Pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("invalid version '%s'", tag)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for idx, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version '%s'", tag)
+		}
+		*nums[idx] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+// A pre-release sorts before the release it precedes.
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	case v.Pre < o.Pre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// Constraint is a set of version comparisons that must all hold.
+type Constraint []comparison
+
+type comparison struct {
+	op string // "=", ">", ">=", "<", "<="
+	v  Version
+}
+
+// ParseConstraint parses a comma-separated list of comparisons:
+//
+//   - any release
+//     1.2.3      exactly 1.2.3 (also =1.2.3)
+//     ^1.2.3     compatible: >=1.2.3, <2.0.0 (<0.3.0 for 0.2.x)
+//     ~1.2.3     patch updates: >=1.2.3, <1.3.0
+//     >=1.2, <2  explicit bounds with >, >=, < and <=
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" || part == "" {
+			continue
+		}
+		op := ""
+		for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(part, prefix) {
+				op = prefix
+				break
+			}
+		}
+		v, err := ParseVersion(strings.TrimSpace(part[len(op):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint '%s'", s)
+		}
+		switch op {
+		case "":
+			c = append(c, comparison{"=", v})
+		case "^":
+			upper := Version{Major: v.Major + 1}
+			if v.Major == 0 {
+				upper = Version{Minor: v.Minor + 1}
+			}
+			c = append(c, comparison{">=", v}, comparison{"<", upper})
+		case "~":
+			c = append(c, comparison{">=", v}, comparison{"<", Version{Major: v.Major, Minor: v.Minor + 1}})
+		default:
+			c = append(c, comparison{op, v})
+		}
+	}
+	return c, nil
+}
+
+// Allows reports whether v satisfies every comparison. Pre-releases are only
+// allowed when a comparison names one explicitly.
+func (c Constraint) Allows(v Version) bool {
+	if v.Pre != "" {
+		named := false
+		for _, cmp := range c {
+			named = named || cmp.v.Pre != ""
+		}
+		if !named {
+			return false
+		}
+	}
+	for _, cmp := range c {
+		r := v.Compare(cmp.v)
+		ok := false
+		switch cmp.op {
+		case "=":
+			ok = r == 0
+		case ">":
+			ok = r > 0
+		case ">=":
+			ok = r >= 0
+		case "<":
+			ok = r < 0
+		case "<=":
+			ok = r <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the highest tag that the constraint allows. Tags that are
+// not versions are ignored.
+func (c Constraint) Select(tags []string) (string, bool) {
+	var best *Version
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil || !c.Allows(v) {
+			continue
+		}
+		if best == nil || v.Compare(*best) > 0 {
+			best = &v
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.Tag, true
+}
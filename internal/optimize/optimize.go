@@ -0,0 +1,272 @@
+// Package optimize rewrites a parsed file into an equivalent, cheaper one
+// before it runs: it folds operations on constants, drops if branches whose
+// condition is a constant and joins constant parts of template literals.
+//
+// Only operations whose result cannot depend on how the interpreter is
+// configured are folded, so strict modes see the same code. Operands are
+// computed with runtime.BinaryOp, and an operation that would fail at run
+// time is left for the interpreter to report.
+package optimize
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/runtime"
+	"light-lang/internal/span"
+	"light-lang/internal/token"
+	"reflect"
+	"strings"
+)
+
+// File optimizes file in place and returns it.
+func File(file *ast.File) *ast.File {
+	file.Body = stmts(file.Body)
+	return file
+}
+
+var (
+	exprType  = reflect.TypeOf((*ast.Expr)(nil)).Elem()
+	nodeType  = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	nodesType = reflect.TypeOf([]ast.Node(nil))
+)
+
+// stmts optimizes a statement list, leaving out statements that can never
+// run.
+func stmts(nodes []ast.Node) []ast.Node {
+	out := nodes[:0]
+	for _, node := range nodes {
+		children(reflect.ValueOf(node))
+		if s, ok := node.(*ast.IfStmt); ok {
+			if node = ifStmt(s); node == nil {
+				continue
+			}
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// children optimizes every expression and statement list inside the node
+// or struct v.
+func children(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			children(v.Elem())
+		}
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			field := v.Field(idx)
+			switch {
+			case field.Type() == exprType:
+				if !field.IsNil() {
+					field.Set(reflect.ValueOf(expr(field.Interface().(ast.Expr))))
+				}
+			case field.Type() == nodesType:
+				field.Set(reflect.ValueOf(stmts(field.Interface().([]ast.Node))))
+			case field.Type() == nodeType, field.Kind() == reflect.Ptr, field.Kind() == reflect.Slice, field.Kind() == reflect.Struct:
+				children(field)
+			}
+		}
+	case reflect.Slice:
+		for idx := 0; idx < v.Len(); idx++ {
+			elem := v.Index(idx)
+			if elem.Type() == exprType {
+				if !elem.IsNil() {
+					elem.Set(reflect.ValueOf(expr(elem.Interface().(ast.Expr))))
+				}
+				continue
+			}
+			children(elem)
+		}
+	}
+}
+
+// expr optimizes e and returns what replaces it.
+func expr(e ast.Expr) ast.Expr {
+	children(reflect.ValueOf(e))
+	switch e := e.(type) {
+	case *ast.BinaryExpr:
+		return binary(e)
+	case *ast.UnaryExpr:
+		return unary(e)
+	case *ast.TernaryExpr:
+		if cond, ok := constant(e.Condition); ok {
+			if runtime.IsTruthy(cond) {
+				return e.Then
+			}
+			return e.Else
+		}
+	case *ast.TemplateLiteral:
+		return template(e)
+	}
+	return e
+}
+
+// binary folds an operation on two constants of the same type or
+// arithmetic on two numbers, and a logical operator whose left operand is a
+// constant.
+func binary(e *ast.BinaryExpr) ast.Expr {
+	left, ok := constant(e.Left)
+	if !ok {
+		return e
+	}
+	switch e.Op {
+	case token.AND:
+		if !runtime.IsTruthy(left) {
+			return e.Left
+		}
+		return e.Right
+	case token.OR:
+		if runtime.IsTruthy(left) {
+			return e.Left
+		}
+		return e.Right
+	case token.QUESTION_QUESTION:
+		if _, isNull := left.(runtime.NullVal); !isNull {
+			return e.Left
+		}
+		return e.Right
+	}
+	right, ok := constant(e.Right)
+	if !ok || reflect.TypeOf(left) != reflect.TypeOf(right) && !(arithmetic[e.Op] && isNumber(left) && isNumber(right)) {
+		return e
+	}
+	val, err := runtime.BinaryOp(e.Op, left, right)
+	if err != nil {
+		return e
+	}
+	return literal(val, e.Span)
+}
+
+// arithmetic holds the operators that mix ints and floats the same way in
+// every mode.
+var arithmetic = map[token.Kind]bool{
+	token.PLUS: true, token.MINUS: true, token.STAR: true, token.SLASH: true, token.PERCENT: true,
+}
+
+func isNumber(v runtime.Value) bool {
+	_, ok := runtime.ToFloat64(v)
+	return ok
+}
+
+// unary folds !, - and ~ applied to a constant.
+func unary(e *ast.UnaryExpr) ast.Expr {
+	operand, ok := constant(e.Operand)
+	if !ok {
+		return e
+	}
+	switch e.Op {
+	case token.MINUS:
+		if val, err := runtime.Negate(operand); err == nil {
+			return literal(val, e.Span)
+		}
+	case token.TILDE:
+		if v, ok := operand.(runtime.IntVal); ok {
+			return literal(^v, e.Span)
+		}
+	case token.BANG:
+		return literal(runtime.BoolVal(!runtime.IsTruthy(operand)), e.Span)
+	}
+	return e
+}
+
+// template joins the constant interpolations of e into its text, and
+// becomes a string literal when nothing else is left.
+func template(e *ast.TemplateLiteral) ast.Expr {
+	parts := []string{e.Parts[0]}
+	var exprs []ast.Expr
+	for idx, x := range e.Exprs {
+		next := ""
+		if idx+1 < len(e.Parts) {
+			next = e.Parts[idx+1]
+		}
+		if val, ok := constant(x); ok {
+			parts[len(parts)-1] += val.String() + next
+			continue
+		}
+		exprs = append(exprs, x)
+		parts = append(parts, next)
+	}
+	if len(exprs) == 0 {
+		return &ast.StringLiteral{ExprBase: base(e.Span), Value: strings.Join(parts, "")}
+	}
+	e.Parts, e.Exprs = parts, exprs
+	return e
+}
+
+// ifStmt drops the branches of s whose condition is a constant false and
+// those after a constant true. It returns the statement to run instead, a
+// block when a single branch is left, or nil when none is.
+func ifStmt(s *ast.IfStmt) ast.Node {
+	type branch struct {
+		cond ast.Expr
+		body *ast.BlockStmt
+		sp   span.Span
+	}
+	branches := []branch{{s.Condition, s.Body, s.Span}}
+	for _, elseIf := range s.ElseIfs {
+		branches = append(branches, branch{elseIf.Condition, elseIf.Body, elseIf.Span})
+	}
+	var kept []branch
+	elseBody := s.ElseBody
+	for _, b := range branches {
+		cond, ok := constant(b.cond)
+		if !ok {
+			kept = append(kept, b)
+			continue
+		}
+		if runtime.IsTruthy(cond) {
+			elseBody = b.body
+			break
+		}
+	}
+	if len(kept) == 0 {
+		if elseBody == nil {
+			return nil
+		}
+		return elseBody
+	}
+	s.Condition, s.Body = kept[0].cond, kept[0].body
+	s.ElseIfs = s.ElseIfs[:0]
+	for _, b := range kept[1:] {
+		s.ElseIfs = append(s.ElseIfs, ast.ElseIfClause{Span: b.sp, Condition: b.cond, Body: b.body})
+	}
+	s.ElseBody = elseBody
+	return s
+}
+
+// constant returns the value of a literal.
+func constant(e ast.Expr) (runtime.Value, bool) {
+	switch e := e.(type) {
+	case *ast.IntLiteral:
+		return runtime.IntVal(e.Value), true
+	case *ast.FloatLiteral:
+		return runtime.FloatVal(e.Value), true
+	case *ast.StringLiteral:
+		return runtime.StringVal(e.Value), true
+	case *ast.BoolLiteral:
+		return runtime.BoolVal(e.Value), true
+	case *ast.NullLiteral:
+		return runtime.NullVal{}, true
+	}
+	return nil, false
+}
+
+// literal returns the literal for a value constant returns.
+func literal(v runtime.Value, sp span.Span) ast.Expr {
+	switch v := v.(type) {
+	case runtime.IntVal:
+		return &ast.IntLiteral{ExprBase: base(sp), Value: int64(v)}
+	case runtime.FloatVal:
+		return &ast.FloatLiteral{ExprBase: base(sp), Value: float64(v)}
+	case runtime.StringVal:
+		return &ast.StringLiteral{ExprBase: base(sp), Value: string(v)}
+	case runtime.BoolVal:
+		return &ast.BoolLiteral{ExprBase: base(sp), Value: bool(v)}
+	}
+	return &ast.NullLiteral{ExprBase: base(sp)}
+}
+
+func base(sp span.Span) ast.ExprBase {
+	return ast.ExprBase{NodeBase: ast.NodeBase{Span: sp}}
+}
@@ -0,0 +1,113 @@
+package optimize
+
+import (
+	"bytes"
+	"light-lang/internal/ast"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/runtime"
+	"testing"
+)
+
+func parse(t *testing.T, source string) *ast.File {
+	t.Helper()
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	file, diags := parser.New(tokens).ParseFile()
+	if len(diags) > 0 {
+		t.Fatalf("parse error: %v", diags[0])
+	}
+	return file
+}
+
+// run returns what file prints, or its error.
+func run(file *ast.File) string {
+	var buf bytes.Buffer
+	if err := runtime.NewInterpreter(&buf).Run(file); err != nil {
+		return buf.String() + err.Error()
+	}
+	return buf.String()
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string // kind and value of the expression after folding
+	}{
+		{`2 * 3 + 4`, "*ast.IntLiteral 10"},
+		{`1 + 2.5`, "*ast.FloatLiteral 3.5"},
+		{`7 / 2`, "*ast.IntLiteral 3"},
+		{`"light" + "-" + "lang"`, "*ast.StringLiteral light-lang"},
+		{`-(3 - 5)`, "*ast.IntLiteral 2"},
+		{`!(1 < 2)`, "*ast.BoolLiteral false"},
+		{`~0`, "*ast.IntLiteral -1"},
+		{`true ? "yes" : "no"`, "*ast.StringLiteral yes"},
+		{"`${1 + 1} items`", "*ast.StringLiteral 2 items"},
+		{`null ?? 1 + 1`, "*ast.IntLiteral 2"},
+		// Left for the interpreter: not constant, an error, or mode dependent
+		{`x + 1`, "*ast.BinaryExpr"},
+		{`1 / 0`, "*ast.BinaryExpr"},
+		{`"a" + 1`, "*ast.BinaryExpr"},
+		{`1 == 1.0`, "*ast.BinaryExpr"},
+		{`-"a"`, "*ast.UnaryExpr"},
+		{`9223372036854775807 + 1`, "*ast.BinaryExpr"},
+	}
+	for _, tc := range tests {
+		file := File(parse(t, tc.source))
+		got := describe(file.Body[0].(*ast.ExprStmt).Expr)
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.source, got, tc.want)
+		}
+	}
+}
+
+func describe(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.IntLiteral:
+		return "*ast.IntLiteral " + runtime.IntVal(e.Value).String()
+	case *ast.FloatLiteral:
+		return "*ast.FloatLiteral " + runtime.FloatVal(e.Value).String()
+	case *ast.StringLiteral:
+		return "*ast.StringLiteral " + e.Value
+	case *ast.BoolLiteral:
+		return "*ast.BoolLiteral " + runtime.BoolVal(e.Value).String()
+	case *ast.BinaryExpr:
+		return "*ast.BinaryExpr"
+	case *ast.UnaryExpr:
+		return "*ast.UnaryExpr"
+	}
+	return "other"
+}
+
+func TestConstantBranches(t *testing.T) {
+	file := File(parse(t, `var n = 3
+if (false) { print("never") }
+if (false) { print("a") } else if (n > 1) { print("b") } else if (true) { print("c") } else { print("d") }
+if (1 > 2) { print("e") } else { var f = "f"; print(f) }
+`))
+	if len(file.Body) != 3 {
+		t.Fatalf("expected the constant false if to be dropped, got %d statements", len(file.Body))
+	}
+	s, ok := file.Body[1].(*ast.IfStmt)
+	if !ok || len(s.ElseIfs) != 0 || s.ElseBody == nil {
+		t.Errorf("expected if (n > 1) with the true branch as else, got %#v", file.Body[1])
+	}
+	if _, ok := file.Body[2].(*ast.BlockStmt); !ok {
+		t.Errorf("expected the else block alone, got %T", file.Body[2])
+	}
+}
+
+func TestSameOutput(t *testing.T) {
+	source := `
+var a = 2 * 3 + 4
+function label(n) { return ` + "`n=${n} of ${2 * 5}`" + ` }
+print(label(a), "x" + "y", 10 % 4 * 2.5)
+if (a > 5 && true) { print("big") } else if (false) { print("never") }
+var i = 0
+while (i < 3) { if (true) { i = i + 1 } }
+print(i, false || "fallback", 1 / 0)
+`
+	want := run(parse(t, source))
+	if got := run(File(parse(t, source))); got != want {
+		t.Errorf("optimized output differs:\ngot:  %q\nwant: %q", got, want)
+	}
+}
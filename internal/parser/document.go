@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/diag"
+	"light-lang/internal/lexer"
+	"light-lang/internal/span"
+	"light-lang/internal/token"
+)
+
+// ============================================================
+// Incremental parsing
+// ============================================================
+
+// Document is a parsed source that can be updated by edits. Apply reparses
+// only the top-level declarations an edit can affect and reuses the rest,
+// which keeps editor feedback fast on large files.
+type Document struct {
+	Lex   *lexer.Snapshot   // tokens and lexer diagnostics
+	File  *ast.File         // the parsed tree; do not modify
+	Diags []diag.Diagnostic // parser diagnostics
+
+	decls []decl // top-level declarations in File order, or nil to force a full parse
+}
+
+// decl records what a top-level declaration was parsed from. Token indexes
+// are into Lex.Tokens.
+type decl struct {
+	first, end int // first token and one past the last
+	horizon    int // furthest token examined while parsing it
+	behind     int // earliest token examined, reading doc comments before first
+	node       ast.Node
+	diags      []diag.Diagnostic
+}
+
+// parseDecl parses one top-level declaration and records its token range.
+func (p *Parser) parseDecl() decl {
+	d := decl{first: p.pos}
+	p.horizon, p.behind = p.pos, p.pos
+	ndiags := len(p.diags)
+	d.node = p.parseTopLevel()
+	p.skipStalled(d.first)
+	d.end, d.horizon, d.behind = p.pos, max(p.horizon, p.pos), p.behind
+	d.diags = p.diags[ndiags:len(p.diags):len(p.diags)]
+	return d
+}
+
+// ParseDocument lexes and parses source from scratch.
+func ParseDocument(source, filename string) *Document {
+	return newDocument(lexer.Scan(source, filename))
+}
+
+func newDocument(lex *lexer.Snapshot) *Document {
+	doc := &Document{Lex: lex}
+	decls, ok := parseDecls(lex.Tokens, 0, nil)
+	if !ok {
+		// Let ParseFile report the internal error; reparse fully next time
+		doc.File, doc.Diags = New(lex.Tokens).ParseFile()
+		return doc
+	}
+	doc.setDecls(decls)
+	return doc
+}
+
+// parseDecls parses top-level declarations from token index start until
+// EOF or until stop reports true at the start of a declaration. It returns
+// false if the parser panicked.
+func parseDecls(tokens []token.Token, start int, stop func(pos int) bool) (decls []decl, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	p := &Parser{tokens: tokens, pos: start}
+	p.skipSep()
+	for !p.isAtEnd() && (stop == nil || !stop(p.pos)) {
+		decls = append(decls, p.parseDecl())
+		p.skipSep()
+	}
+	return decls, true
+}
+
+func (doc *Document) setDecls(decls []decl) {
+	tokens := doc.Lex.Tokens
+	doc.decls = decls
+	doc.File = &ast.File{}
+	doc.Diags = nil
+	for _, d := range decls {
+		if d.node != nil {
+			doc.File.Body = append(doc.File.Body, d.node)
+		}
+		doc.Diags = append(doc.Diags, d.diags...)
+	}
+	doc.File.Span = span.Span{Start: tokens[0].Span.Start, End: tokens[len(tokens)-1].Span.End}
+}
+
+// Diagnostics returns the lexer diagnostics followed by the parser ones, as
+// a full lex and parse would report them.
+func (doc *Document) Diagnostics() []diag.Diagnostic {
+	return append(append([]diag.Diagnostic(nil), doc.Lex.Diags...), doc.Diags...)
+}
+
+// Apply returns the document for the source with e applied. The result is
+// the same as parsing the new source from scratch: a declaration is reused
+// only if every token it was parsed from, including lookahead, its doc
+// comment and the token before it, is unchanged (or merely moved, for declarations after the edit).
+func (doc *Document) Apply(e lexer.Edit) *Document {
+	lex := doc.Lex.Apply(e)
+	if doc.decls == nil {
+		return newDocument(lex)
+	}
+	oldToks, newToks := doc.Lex.Tokens, lex.Tokens
+	shift := len(newToks) - len(oldToks)
+	oldEOF, newEOF := oldToks[len(oldToks)-1].Span.Start, newToks[len(newToks)-1].Span.Start
+	delta, lineDelta := newEOF.Offset-oldEOF.Offset, newEOF.Line-oldEOF.Line
+
+	// Declarations before the edit whose tokens are untouched
+	prefix := 0
+	for prefix < len(doc.decls) && sameTokens(oldToks, newToks, doc.decls[prefix], 0, 0, 0) {
+		prefix++
+	}
+
+	// Declarations after the edit whose tokens only moved
+	suffix := len(doc.decls)
+	for suffix > prefix && sameTokens(oldToks, newToks, doc.decls[suffix-1], shift, delta, lineDelta) {
+		suffix--
+	}
+	resumeAt := make(map[int]int, len(doc.decls)-suffix) // new first token -> decl index
+	for idx := suffix; idx < len(doc.decls); idx++ {
+		resumeAt[doc.decls[idx].first+shift] = idx
+	}
+
+	start := 0
+	if prefix > 0 {
+		start = doc.decls[prefix-1].end
+	}
+	resume := len(doc.decls)
+	middle, ok := parseDecls(newToks, start, func(pos int) bool {
+		idx, found := resumeAt[pos]
+		if found {
+			resume = idx
+		}
+		return found
+	})
+	if !ok {
+		return newDocument(lex)
+	}
+
+	decls := make([]decl, 0, prefix+len(middle)+len(doc.decls)-resume)
+	decls = append(decls, doc.decls[:prefix]...)
+	decls = append(decls, middle...)
+	for _, d := range doc.decls[resume:] {
+		moved := decl{first: d.first + shift, end: d.end + shift, horizon: d.horizon + shift, behind: d.behind + shift}
+		moved.node = ast.Shift(d.node, delta, lineDelta)
+		for _, dg := range d.diags {
+			dg.Span = shiftSpan(dg.Span, delta, lineDelta)
+			moved.diags = append(moved.diags, dg)
+		}
+		decls = append(decls, moved)
+	}
+
+	next := &Document{Lex: lex}
+	next.setDecls(decls)
+	return next
+}
+
+// sameTokens reports whether the tokens d was parsed from appear in newToks
+// moved by shift tokens, delta bytes and lineDelta lines.
+func sameTokens(oldToks, newToks []token.Token, d decl, shift, delta, lineDelta int) bool {
+	from := max(d.behind-1, 0)
+	to := min(d.horizon, len(oldToks)-1)
+	if from+shift < 0 || to+shift >= len(newToks) {
+		return false
+	}
+	for idx := from; idx <= to; idx++ {
+		tok := oldToks[idx]
+		tok.Span = shiftSpan(tok.Span, delta, lineDelta)
+		if newToks[idx+shift] != tok {
+			return false
+		}
+	}
+	return true
+}
+
+func shiftSpan(s span.Span, delta, lineDelta int) span.Span {
+	s.Start.Offset += delta
+	s.Start.Line += lineDelta
+	s.End.Offset += delta
+	s.End.Line += lineDelta
+	return s
+}
@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"light-lang/internal/lexer"
+	"light-lang/internal/token"
+)
+
+// Incomplete reports whether source fails to parse only because it ends too
+// early, e.g. an unclosed block, call, template literal or block comment. Interactive
+// front ends use it to decide whether to read another line. Source that
+// parses cleanly, or has an error before its end, is not incomplete.
+func Incomplete(source string) bool {
+	tokens, lexDiags := lexer.New(source, "<input>").Tokenize()
+	for _, d := range lexDiags {
+		if d.Code == "E1004" || d.Code == "E1005" { // unterminated template literal or block comment
+			return true
+		}
+	}
+	if len(lexDiags) > 0 {
+		return false
+	}
+	_, parseDiags := New(tokens).ParseFile()
+	if len(parseDiags) == 0 {
+		return false
+	}
+
+	// Errors after the last real token mean the parser ran out of input
+	lastEnd := 0
+	for _, tok := range tokens {
+		if tok.Kind != token.NEWLINE && tok.Kind != token.EOF {
+			lastEnd = tok.Span.End.Offset
+		}
+	}
+	for _, d := range parseDiags {
+		if d.Span.Start.Offset < lastEnd {
+			return false
+		}
+	}
+	return true
+}
@@ -6,9 +6,10 @@ import (
 	"fmt"
 	"light-lang/internal/ast"
 	"light-lang/internal/diag"
+	"light-lang/internal/lexer"
 	"light-lang/internal/span"
 	"light-lang/internal/token"
-	"strconv"
+	"strings"
 )
 
 // ============================================================
@@ -17,15 +18,22 @@ import (
 
 const (
 	bpNone       = 0
+	bpAssign     = 2  // = += -= ... (right-associative, so a = b = 0 is a = (b = 0))
 	bpTernary    = 5  // ?:
+	bpCoalesce   = 8  // ??
 	bpOr         = 10 // ||
 	bpAnd        = 20 // &&
-	bpEquality   = 30 // == !=
-	bpComparison = 40 // < <= > >=
+	bpEquality   = 30 // == != === !==
+	bpComparison = 40 // < <= > >= instanceof
+	bpBitOr      = 42 // |
+	bpBitXor     = 44 // ^
+	bpBitAnd     = 46 // &
+	bpShift      = 48 // << >>
 	bpAdditive   = 50 // + -
 	bpMultiply   = 60 // * / %
-	bpPrefix     = 70 // ! -
-	bpPostfix    = 80 // () [] .
+	bpPrefix     = 70 // ! - ~
+	bpPower      = 75 // ** (right-associative, so -2 ** 2 is -(2 ** 2))
+	bpPostfix    = 80 // () [] . ?.
 )
 
 // infixBP returns the left binding power for an infix/postfix operator.
@@ -33,21 +41,38 @@ func infixBP(kind token.Kind) int {
 	switch kind {
 	case token.QUESTION:
 		return bpTernary
+	case token.QUESTION_QUESTION:
+		return bpCoalesce
 	case token.OR:
 		return bpOr
 	case token.AND:
 		return bpAnd
-	case token.EQ, token.NEQ:
+	case token.EQ, token.NEQ, token.STRICT_EQ, token.STRICT_NEQ:
 		return bpEquality
-	case token.LT, token.LTE, token.GT, token.GTE:
+	case token.LT, token.LTE, token.GT, token.GTE, token.KW_INSTANCEOF:
 		return bpComparison
+	case token.PIPE:
+		return bpBitOr
+	case token.CARET:
+		return bpBitXor
+	case token.AMP:
+		return bpBitAnd
+	case token.SHL, token.SHR:
+		return bpShift
 	case token.PLUS, token.MINUS:
 		return bpAdditive
 	case token.STAR, token.SLASH, token.PERCENT:
 		return bpMultiply
-	case token.LPAREN, token.LBRACKET, token.DOT:
+	case token.STAR_STAR:
+		return bpPower
+	case token.LPAREN, token.LBRACKET, token.DOT, token.QUESTION_DOT:
 		return bpPostfix
+	case token.ASSIGN:
+		return bpAssign
 	default:
+		if _, compound := compoundOps[kind]; compound {
+			return bpAssign
+		}
 		return bpNone
 	}
 }
@@ -58,9 +83,13 @@ func infixBP(kind token.Kind) int {
 
 // Parser performs syntax analysis on a stream of tokens.
 type Parser struct {
-	tokens []token.Token
-	pos    int
-	diags  []diag.Diagnostic
+	tokens  []token.Token
+	pos     int
+	diags   []diag.Diagnostic
+	horizon int   // furthest token index examined, for incremental parsing
+	behind  int   // earliest token index examined, for doc comments
+	yields  *bool // set by a yield in the function being parsed; nil outside functions
+	async   bool  // the function being parsed is async, so it may await
 }
 
 // New creates a new parser from a token slice.
@@ -69,15 +98,25 @@ func New(tokens []token.Token) *Parser {
 }
 
 // ParseFile parses the entire file and returns the AST root and diagnostics.
-func (p *Parser) ParseFile() (*ast.File, []diag.Diagnostic) {
-	file := &ast.File{}
+// An internal failure is reported as an E2000 diagnostic rather than a panic;
+// the returned file then holds the statements parsed before it.
+func (p *Parser) ParseFile() (file *ast.File, diags []diag.Diagnostic) {
+	file = &ast.File{}
 	startPos := p.peek().Span.Start
 
+	defer func() {
+		if r := recover(); r != nil {
+			tok := p.peek()
+			p.error("E2000", tok.Span, fmt.Sprintf("internal parser error near '%s': %v", tok.Lexeme, r))
+			file.Span = span.Span{Start: startPos, End: tok.Span.End}
+			diags = p.diags
+		}
+	}()
+
 	p.skipSep()
 	for !p.isAtEnd() {
-		node := p.parseTopLevel()
-		if node != nil {
-			file.Body = append(file.Body, node)
+		if d := p.parseDecl(); d.node != nil {
+			file.Body = append(file.Body, d.node)
 		}
 		p.skipSep()
 	}
@@ -93,9 +132,39 @@ func (p *Parser) peek() token.Token {
 	if p.pos >= len(p.tokens) {
 		return token.Token{Kind: token.EOF}
 	}
+	p.horizon = max(p.horizon, p.pos)
 	return p.tokens[p.pos]
 }
 
+// kindAt returns the kind of the token at index i, or EOF past the end.
+// Lookahead must go through it (or peek) so incremental parsing knows which
+// tokens a declaration depended on.
+func (p *Parser) kindAt(i int) token.Kind {
+	if i >= len(p.tokens) {
+		return token.EOF
+	}
+	p.horizon = max(p.horizon, i)
+	return p.tokens[i].Kind
+}
+
+// docComment returns the doc comment ending right before the token at
+// index i: consecutive lines holding only a /// or // comment, with the
+// slashes and one following space removed.
+func (p *Parser) docComment(i int) string {
+	first := i
+	for first > 0 && p.tokens[first-1].Kind == token.NEWLINE && p.tokens[first-1].Comment != "" {
+		first--
+	}
+	p.behind = min(p.behind, max(first-1, 0))
+	var lines []string
+	for _, tok := range p.tokens[first:i] {
+		line := strings.TrimPrefix(tok.Comment, "//")
+		line = strings.TrimPrefix(line, "/")
+		lines = append(lines, strings.TrimPrefix(line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (p *Parser) peekKind() token.Kind {
 	return p.peek().Kind
 }
@@ -170,14 +239,25 @@ func (p *Parser) synchronize() {
 		}
 		// Stop at statement-starting keywords
 		if p.match(token.KW_IF, token.KW_WHILE, token.KW_FOR, token.KW_FUNCTION, token.KW_CLASS,
-			token.KW_VAR, token.KW_CONST, token.KW_RETURN, token.KW_BREAK, token.KW_CONTINUE,
-			token.KW_TRY, token.KW_THROW, token.KW_MATCH, token.KW_ENUM, token.KW_INTERFACE) {
+			token.KW_VAR, token.KW_LET, token.KW_CONST, token.KW_RETURN, token.KW_BREAK, token.KW_CONTINUE,
+			token.KW_TRY, token.KW_THROW, token.KW_MATCH, token.KW_ENUM, token.KW_INTERFACE, token.KW_IMPORT,
+			token.KW_EXPORT) {
 			return
 		}
 		p.advance()
 	}
 }
 
+// skipStalled advances past the current token when nothing was consumed
+// since before, e.g. because synchronize stopped on a statement keyword that
+// the enclosing rule cannot start with. Loops over a body call it so they
+// always terminate.
+func (p *Parser) skipStalled(before int) {
+	if p.pos == before && !p.isAtEnd() {
+		p.advance()
+	}
+}
+
 // ============================================================
 // Top-level parsing
 // ============================================================
@@ -186,13 +266,26 @@ func (p *Parser) parseTopLevel() ast.Node {
 	switch p.peekKind() {
 	case token.KW_FUNCTION:
 		return p.parseFuncDecl()
+	case token.KW_ASYNC:
+		if p.kindAt(p.pos+1) == token.KW_FUNCTION {
+			return p.parseFuncDecl()
+		}
+		return p.parseStmt()
 	case token.KW_CLASS:
 		return p.parseClassDecl()
 	case token.KW_ENUM:
 		return p.parseEnumDecl()
 	case token.KW_INTERFACE:
 		return p.parseInterfaceDecl()
+	case token.KW_EXPORT:
+		return p.parseExport()
 	default:
+		// 'record' is contextual: record Name(...) starts a declaration, any
+		// other use is an ordinary identifier.
+		if p.check(token.IDENT) && p.peek().Lexeme == "record" &&
+			p.kindAt(p.pos+1) == token.IDENT && p.kindAt(p.pos+2) == token.LPAREN {
+			return p.parseRecordDecl()
+		}
 		return p.parseStmt()
 	}
 }
@@ -215,7 +308,7 @@ func (p *Parser) parseStmt() ast.Stmt {
 		return p.parseBreakStmt()
 	case token.KW_CONTINUE:
 		return p.parseContinueStmt()
-	case token.KW_VAR, token.KW_CONST:
+	case token.KW_VAR, token.KW_CONST, token.KW_LET:
 		return p.parseVarDecl()
 	case token.KW_TRY:
 		return p.parseTryStmt()
@@ -223,7 +316,12 @@ func (p *Parser) parseStmt() ast.Stmt {
 		return p.parseThrowStmt()
 	case token.KW_MATCH:
 		return p.parseMatchStmt()
+	case token.KW_IMPORT:
+		return p.parseImportStmt()
 	case token.LBRACE:
+		if p.isPatternAssign() || p.isMapLiteralStart() {
+			return p.parseSimpleStmt()
+		}
 		return p.parseBlock()
 	default:
 		return p.parseSimpleStmt()
@@ -231,15 +329,14 @@ func (p *Parser) parseStmt() ast.Stmt {
 }
 
 // parseIfStmt parses: if (expr) block { else if (expr) block } [ else block ]
-func (p *Parser) parseIfStmt() *ast.IfStmt {
+func (p *Parser) parseIfStmt() ast.Stmt {
 	start := p.advance() // consume 'if'
 	stmt := &ast.IfStmt{}
 
 	// condition
 	if _, ok := p.expect(token.LPAREN); !ok {
 		p.synchronize()
-		stmt.Span = p.makeSpan(start.Span.Start)
-		return stmt
+		return p.badStmt(start.Span.Start)
 	}
 	stmt.Condition = p.parseExpr(bpNone)
 	p.expect(token.RPAREN)
@@ -273,14 +370,13 @@ func (p *Parser) parseIfStmt() *ast.IfStmt {
 }
 
 // parseWhileStmt parses: while (expr) block
-func (p *Parser) parseWhileStmt() *ast.WhileStmt {
+func (p *Parser) parseWhileStmt() ast.Stmt {
 	start := p.advance() // consume 'while'
 	stmt := &ast.WhileStmt{}
 
 	if _, ok := p.expect(token.LPAREN); !ok {
 		p.synchronize()
-		stmt.Span = p.makeSpan(start.Span.Start)
-		return stmt
+		return p.badStmt(start.Span.Start)
 	}
 	stmt.Condition = p.parseExpr(bpNone)
 	p.expect(token.RPAREN)
@@ -289,7 +385,7 @@ func (p *Parser) parseWhileStmt() *ast.WhileStmt {
 	return stmt
 }
 
-// parseReturnStmt parses: return [expr]
+// parseReturnStmt parses: return [expr {, expr}]
 func (p *Parser) parseReturnStmt() *ast.ReturnStmt {
 	start := p.advance() // consume 'return'
 	stmt := &ast.ReturnStmt{}
@@ -299,6 +395,20 @@ func (p *Parser) parseReturnStmt() *ast.ReturnStmt {
 		stmt.Value = p.parseExpr(bpNone)
 	}
 
+	// Multiple results are returned as an array: return a, b
+	if stmt.Value != nil && p.check(token.COMMA) {
+		values := []ast.Expr{stmt.Value}
+		for p.check(token.COMMA) {
+			p.advance() // consume ','
+			p.skipNewlines()
+			values = append(values, p.parseExpr(bpNone))
+		}
+		stmt.Value = &ast.ArrayLiteral{
+			ExprBase: makeExprBase(values[0].GetSpan().Start, p.prevEnd()),
+			Elements: values,
+		}
+	}
+
 	stmt.Span = p.makeSpan(start.Span.Start)
 	return stmt
 }
@@ -313,20 +423,56 @@ func (p *Parser) parseContinueStmt() *ast.ContinueStmt {
 	return &ast.ContinueStmt{StmtBase: makeStmtBase(start.Span.Start, p.prevEnd())}
 }
 
-// parseVarDecl parses: (var | const) IDENT [ = expr ]
-func (p *Parser) parseVarDecl() *ast.VarDeclStmt {
-	start := p.advance() // consume 'var' or 'const'
+// parseVarDecl parses: (var | let | const) IDENT {, IDENT} [ = expr ]
+// or (var | let | const) pattern = expr
+func (p *Parser) parseVarDecl() ast.Stmt {
+	start := p.advance() // consume 'var', 'let' or 'const'
 	isConst := start.Kind == token.KW_CONST
-	stmt := &ast.VarDeclStmt{IsConst: isConst}
+	stmt := &ast.VarDeclStmt{IsConst: isConst, IsLet: start.Kind == token.KW_LET}
+
+	// var [a, b] = expr and var {x, y} = expr destructure
+	if p.match(token.LBRACKET, token.LBRACE) {
+		stmt.Pattern = p.parsePattern(true)
+		stmt.Names = ast.PatternNames(stmt.Pattern)
+		if len(stmt.Names) > 0 {
+			stmt.Name = stmt.Names[0]
+		}
+		if p.check(token.ASSIGN) {
+			p.advance()
+			stmt.Init = p.parseExpr(bpNone)
+		} else {
+			tok := p.peek()
+			p.error("E2001", tok.Span, fmt.Sprintf("expected '=' after destructuring pattern, got '%s'", tok.Kind))
+		}
+		stmt.Span = p.makeSpan(start.Span.Start)
+		return stmt
+	}
 
 	nameTok, ok := p.expect(token.IDENT)
 	if !ok {
 		p.synchronize()
-		stmt.Span = p.makeSpan(start.Span.Start)
-		return stmt
+		return p.badStmt(start.Span.Start)
 	}
 	stmt.Name = nameTok.Lexeme
 
+	// var a, b = expr unpacks an array
+	if p.check(token.COMMA) {
+		stmt.Names = []string{stmt.Name}
+		for p.check(token.COMMA) {
+			p.advance() // consume ','
+			nameTok, ok := p.expect(token.IDENT)
+			if !ok {
+				p.synchronize()
+				return p.badStmt(start.Span.Start)
+			}
+			stmt.Names = append(stmt.Names, nameTok.Lexeme)
+		}
+		if !p.check(token.ASSIGN) {
+			tok := p.peek()
+			p.error("E2001", tok.Span, fmt.Sprintf("expected '=' after variable list, got '%s'", tok.Kind))
+		}
+	}
+
 	// optional initializer
 	if p.check(token.ASSIGN) {
 		p.advance()
@@ -339,17 +485,35 @@ func (p *Parser) parseVarDecl() *ast.VarDeclStmt {
 
 // parseSimpleStmt parses an expression statement or assignment.
 func (p *Parser) parseSimpleStmt() ast.Stmt {
-	expr := p.parseExpr(bpNone)
-	if expr == nil {
-		// couldn't parse expression; synchronize
-		tok := p.peek()
-		p.error("E2002", tok.Span, fmt.Sprintf("unexpected token: '%s'", tok.Lexeme))
-		p.synchronize()
-		return &ast.ExprStmt{
-			StmtBase: makeStmtBase(tok.Span.Start, tok.Span.End),
+	if p.match(token.LBRACKET, token.LBRACE) && p.isPatternAssign() {
+		target := p.parsePattern(false)
+		p.expect(token.ASSIGN)
+		value := p.parseExpr(bpNone)
+		return &ast.AssignStmt{
+			StmtBase: makeStmtBase(target.GetSpan().Start, p.prevEnd()),
+			Target:   target,
+			Value:    value,
 		}
 	}
 
+	start := p.peek().Span.Start
+	expr := p.parseExpr(bpAssign) // stop before '=', which makes an AssignStmt
+	if _, bad := expr.(*ast.BadExpr); bad {
+		// couldn't parse expression (nud reported it); synchronize
+		p.synchronize()
+		return p.badStmt(start)
+	}
+
+	// a, b = b, a assigns several targets at once
+	if p.check(token.COMMA) {
+		return p.parseTupleAssign(expr)
+	}
+
+	binOp, compound := compoundOps[p.peek().Kind]
+	if (p.check(token.ASSIGN) || compound) && optionalChain(expr) {
+		p.error("E2001", expr.GetSpan(), "cannot assign to an optional chain")
+	}
+
 	// Check for assignment: expr = value
 	if p.check(token.ASSIGN) {
 		p.advance()
@@ -361,14 +525,14 @@ func (p *Parser) parseSimpleStmt() ast.Stmt {
 		}
 	}
 
-	// Check for compound assignment: expr += / -= / *= / /= value
-	if p.match(token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.STAR_ASSIGN, token.SLASH_ASSIGN) {
+	// Check for compound assignment: expr += value, expr <<= value, ...
+	if compound {
 		opTok := p.advance()
 		rhs := p.parseExpr(bpNone)
-		// Desugar: target op= rhs → target = target op rhs
-		binOp := compoundToOp(opTok.Kind)
+		// Desugar: target op= rhs → target = target op rhs. Op keeps the
+		// compound token so the target's object and index are evaluated once.
 		value := &ast.BinaryExpr{
-			ExprBase: makeExprBase(expr.GetSpan().Start, rhs.GetSpan().End),
+			ExprBase: makeExprBase(expr.GetSpan().Start, p.endOf(rhs)),
 			Op:       binOp,
 			Left:     expr,
 			Right:    rhs,
@@ -377,6 +541,7 @@ func (p *Parser) parseSimpleStmt() ast.Stmt {
 			StmtBase: makeStmtBase(expr.GetSpan().Start, p.prevEnd()),
 			Target:   expr,
 			Value:    value,
+			Op:       opTok.Kind,
 		}
 	}
 
@@ -386,6 +551,73 @@ func (p *Parser) parseSimpleStmt() ast.Stmt {
 	}
 }
 
+// parseTupleAssign parses the rest of a, b = x, y after its first target.
+// It becomes [a, b] = [x, y], so every value is computed before any target
+// is assigned; a single value is unpacked like in var a, b = pair.
+func (p *Parser) parseTupleAssign(first ast.Expr) ast.Stmt {
+	pattern := &ast.ArrayPattern{Elements: []ast.Expr{first}}
+	for p.check(token.COMMA) {
+		p.advance() // consume ','
+		target := p.parseExpr(bpAssign)
+		if optionalChain(target) {
+			p.error("E2001", target.GetSpan(), "cannot assign to an optional chain")
+		}
+		pattern.Elements = append(pattern.Elements, target)
+	}
+	pattern.ExprBase = makeExprBase(first.GetSpan().Start, p.prevEnd())
+	if _, ok := p.expect(token.ASSIGN); !ok {
+		p.synchronize()
+		return p.badStmt(first.GetSpan().Start)
+	}
+	value := p.parseExpr(bpNone)
+	if p.check(token.COMMA) {
+		values := &ast.ArrayLiteral{Elements: []ast.Expr{value}}
+		for p.check(token.COMMA) {
+			p.advance() // consume ','
+			values.Elements = append(values.Elements, p.parseExpr(bpNone))
+		}
+		values.ExprBase = makeExprBase(value.GetSpan().Start, p.prevEnd())
+		if len(values.Elements) != len(pattern.Elements) {
+			p.error("E2001", values.Span, fmt.Sprintf("cannot assign %d values to %d targets", len(values.Elements), len(pattern.Elements)))
+		}
+		value = values
+	}
+	return &ast.AssignStmt{
+		StmtBase: makeStmtBase(first.GetSpan().Start, p.prevEnd()),
+		Target:   pattern,
+		Value:    value,
+	}
+}
+
+// parseAssignExpr parses the rest of an assignment used as a value, as in
+// while (x = next()) or f(a = 4), after its target. The value may itself be
+// an assignment: a = b = 0 stores 0 in b and then in a.
+func (p *Parser) parseAssignExpr(target ast.Expr) ast.Expr {
+	if optionalChain(target) {
+		p.error("E2001", target.GetSpan(), "cannot assign to an optional chain")
+	}
+	opTok := p.advance() // consume '=' or the compound operator
+	p.skipNewlines()
+	value := p.parseExpr(bpNone)
+	op := token.ILLEGAL
+	if binOp, ok := compoundOps[opTok.Kind]; ok {
+		// Desugared like a compound assignment statement
+		value = &ast.BinaryExpr{
+			ExprBase: makeExprBase(target.GetSpan().Start, p.endOf(value)),
+			Op:       binOp,
+			Left:     target,
+			Right:    value,
+		}
+		op = opTok.Kind
+	}
+	return &ast.AssignExpr{
+		ExprBase: makeExprBase(target.GetSpan().Start, p.prevEnd()),
+		Target:   target,
+		Value:    value,
+		Op:       op,
+	}
+}
+
 // parseBlock parses: { stmts }
 func (p *Parser) parseBlock() *ast.BlockStmt {
 	start := p.peek()
@@ -399,10 +631,16 @@ func (p *Parser) parseBlock() *ast.BlockStmt {
 
 	p.skipSep()
 	for !p.check(token.RBRACE) && !p.isAtEnd() {
+		before := p.pos
+		if p.check(token.KW_EXPORT) {
+			tok := p.advance()
+			p.error("E2008", tok.Span, "'export' is only allowed at the top level")
+		}
 		node := p.parseTopLevel()
 		if node != nil {
 			block.Stmts = append(block.Stmts, node)
 		}
+		p.skipStalled(before)
 		p.skipSep()
 	}
 
@@ -415,35 +653,116 @@ func (p *Parser) parseBlock() *ast.BlockStmt {
 // Declaration parsing
 // ============================================================
 
-// parseFuncDecl parses: function IDENT ( params ) block
-func (p *Parser) parseFuncDecl() *ast.FuncDecl {
-	start := p.advance() // consume 'function'
-	decl := &ast.FuncDecl{}
+// parseFuncDecl parses: [async] function IDENT ( params ) block
+func (p *Parser) parseFuncDecl() ast.Stmt {
+	decl := &ast.FuncDecl{Doc: p.docComment(p.pos)}
+	start := p.advance() // consume 'function' or 'async'
+	if start.Kind == token.KW_ASYNC {
+		decl.Async = true
+		p.advance() // consume 'function'
+	}
 
 	nameTok, ok := p.expect(token.IDENT)
 	if !ok {
 		p.synchronize()
-		decl.Span = p.makeSpan(start.Span.Start)
-		return decl
+		return p.badStmt(start.Span.Start)
 	}
 	decl.Name = nameTok.Lexeme
 
-	decl.Params = p.parseParamList()
-	decl.Body = p.parseBlock()
+	decl.Params, decl.Rest = p.parseParamList()
+	decl.Body, decl.Generator = p.parseFuncBody(decl.Async)
 	decl.Span = p.makeSpan(start.Span.Start)
 	return decl
 }
 
+// parseFuncBody parses the block of a function, reporting whether it
+// contains a yield of its own, which makes the function a generator.
+// async says whether the function may await.
+func (p *Parser) parseFuncBody(async bool) (body *ast.BlockStmt, generator bool) {
+	prev, prevAsync := p.yields, p.async
+	p.yields, p.async = &generator, async
+	body = p.parseBlock()
+	p.yields, p.async = prev, prevAsync
+	return body, generator
+}
+
+// parseYield parses: yield [expr]
+func (p *Parser) parseYield() ast.Expr {
+	tok := p.advance() // consume 'yield'
+	if p.yields == nil {
+		p.error("E2011", tok.Span, "yield outside a function")
+	} else if p.async {
+		p.error("E2013", tok.Span, "an async function cannot yield")
+	} else {
+		*p.yields = true
+	}
+	expr := &ast.YieldExpr{}
+	switch p.peekKind() {
+	case token.NEWLINE, token.SEMICOLON, token.COMMA, token.COLON,
+		token.RPAREN, token.RBRACE, token.RBRACKET, token.EOF:
+	default:
+		expr.Value = p.parseExpr(bpNone)
+	}
+	expr.ExprBase = makeExprBase(tok.Span.Start, p.prevEnd())
+	return expr
+}
+
+// parseAwait parses: await expr. It is allowed in async functions and at
+// the top level, outside any function.
+func (p *Parser) parseAwait() ast.Expr {
+	tok := p.advance() // consume 'await'
+	if p.yields != nil && !p.async {
+		p.error("E2013", tok.Span, "await is only allowed in an async function or at the top level")
+	}
+	value := p.parseExpr(bpPrefix)
+	return &ast.AwaitExpr{ExprBase: makeExprBase(tok.Span.Start, p.endOf(value)), Value: value}
+}
+
+// parseAsync parses the function expressions that can follow async:
+// async function ..., async (params) => body and async name => body.
+func (p *Parser) parseAsync() ast.Expr {
+	tok := p.peek()
+	switch {
+	case p.kindAt(p.pos+1) == token.KW_FUNCTION:
+		return p.parseFuncExpr()
+	case p.kindAt(p.pos+1) == token.IDENT && p.kindAt(p.pos+2) == token.ARROW:
+		p.advance() // consume 'async'
+		param := p.advance()
+		return p.parseArrowBody(tok.Span.Start, []string{param.Lexeme}, true)
+	case p.kindAt(p.pos+1) == token.LPAREN:
+		p.advance() // consume 'async'
+		if p.isArrowFunction() {
+			params, rest := p.parseParamList()
+			fn := p.parseArrowBody(tok.Span.Start, params, true)
+			fn.Rest = rest
+			return fn
+		}
+	default:
+		p.advance() // consume 'async'
+	}
+	p.error("E2013", tok.Span, "async must be followed by a function or an arrow function")
+	return &ast.BadExpr{ExprBase: makeExprBase(tok.Span.Start, tok.Span.End)}
+}
+
+// parseSpawn parses: spawn call
+func (p *Parser) parseSpawn() ast.Expr {
+	tok := p.advance() // consume 'spawn'
+	call := p.parseExpr(bpPrefix)
+	if _, ok := call.(*ast.CallExpr); !ok {
+		p.error("E2012", tok.Span, "spawn expects a function call, e.g. spawn work(x)")
+	}
+	return &ast.SpawnExpr{ExprBase: makeExprBase(tok.Span.Start, p.endOf(call)), Call: call}
+}
+
 // parseClassDecl parses: class IDENT { constructor / methods }
-func (p *Parser) parseClassDecl() *ast.ClassDecl {
+func (p *Parser) parseClassDecl() ast.Stmt {
+	decl := &ast.ClassDecl{Doc: p.docComment(p.pos)}
 	start := p.advance() // consume 'class'
-	decl := &ast.ClassDecl{}
 
 	nameTok, ok := p.expect(token.IDENT)
 	if !ok {
 		p.synchronize()
-		decl.Span = p.makeSpan(start.Span.Start)
-		return decl
+		return p.badStmt(start.Span.Start)
 	}
 	decl.Name = nameTok.Lexeme
 
@@ -457,39 +776,100 @@ func (p *Parser) parseClassDecl() *ast.ClassDecl {
 	}
 
 	// Optional: implements Interface1, Interface2, ...
-	if p.check(token.IDENT) && p.peek().Lexeme == "implements" {
-		p.advance() // consume 'implements'
-		ifaceTok, ok := p.expect(token.IDENT)
-		if ok {
-			decl.Implements = append(decl.Implements, ifaceTok.Lexeme)
+	decl.Implements = p.parseImplements()
+
+	if _, ok := p.expect(token.LBRACE); !ok {
+		p.synchronize()
+		return p.badStmt(start.Span.Start)
+	}
+
+	p.skipSep()
+	for !p.check(token.RBRACE) && !p.isAtEnd() {
+		before := p.pos
+		if p.check(token.KW_CONSTRUCTOR) {
+			decl.Constructor = p.parseConstructorDecl()
+		} else if p.check(token.KW_STATIC) {
+			p.parseStaticMember(decl)
+		} else if p.isAccessor() {
+			p.parseAccessor(decl)
+		} else if p.check(token.IDENT) && p.kindAt(p.pos+1) != token.LPAREN {
+			decl.Props = append(decl.Props, p.parseFieldDecl())
+		} else if p.check(token.IDENT) || p.isAsyncMethod(p.pos) {
+			decl.Methods = append(decl.Methods, p.parseMethodDecl())
+		} else {
+			tok := p.peek()
+			p.error("E2003", tok.Span, fmt.Sprintf("expected field, method, constructor or static field, got '%s'", tok.Lexeme))
+			p.synchronize()
 		}
-		for p.check(token.COMMA) {
-			p.advance()
-			p.skipNewlines()
-			ifaceTok, ok = p.expect(token.IDENT)
-			if ok {
-				decl.Implements = append(decl.Implements, ifaceTok.Lexeme)
-			}
+		p.skipStalled(before)
+		p.skipSep()
+	}
+
+	p.expect(token.RBRACE)
+	decl.Span = p.makeSpan(start.Span.Start)
+	return decl
+}
+
+// parseImplements parses an optional: implements IDENT {, IDENT}
+func (p *Parser) parseImplements() []string {
+	if !p.check(token.IDENT) || p.peek().Lexeme != "implements" {
+		return nil
+	}
+	p.advance() // consume 'implements'
+	var names []string
+	ifaceTok, ok := p.expect(token.IDENT)
+	if ok {
+		names = append(names, ifaceTok.Lexeme)
+	}
+	for p.check(token.COMMA) {
+		p.advance()
+		p.skipNewlines()
+		ifaceTok, ok = p.expect(token.IDENT)
+		if ok {
+			names = append(names, ifaceTok.Lexeme)
 		}
 	}
+	return names
+}
 
-	if _, ok := p.expect(token.LBRACE); !ok {
-		p.synchronize()
+// parseRecordDecl parses: record IDENT ( params ) [implements ...] [ { members } ]
+// A record is a class whose constructor, fields, equality and string form
+// are derived from the parameter list; the body may add methods and statics.
+func (p *Parser) parseRecordDecl() ast.Stmt {
+	doc := p.docComment(p.pos)
+	start := p.advance() // consume 'record'
+	nameTok := p.advance()
+	decl := &ast.ClassDecl{Name: nameTok.Lexeme, Record: true, Doc: doc}
+	fieldsTok := p.peek()
+	fields, rest := p.parseParamList()
+	if rest {
+		p.error("E2010", fieldsTok.Span, "record fields cannot include a rest parameter")
+	}
+	decl.Fields = fields
+
+	decl.Implements = p.parseImplements()
+
+	if !p.check(token.LBRACE) {
 		decl.Span = p.makeSpan(start.Span.Start)
 		return decl
 	}
+	p.advance() // consume '{'
 
 	p.skipSep()
 	for !p.check(token.RBRACE) && !p.isAtEnd() {
-		if p.check(token.KW_CONSTRUCTOR) {
-			decl.Constructor = p.parseConstructorDecl()
-		} else if p.check(token.IDENT) {
+		before := p.pos
+		if p.check(token.KW_STATIC) {
+			p.parseStaticMember(decl)
+		} else if p.isAccessor() {
+			p.parseAccessor(decl)
+		} else if p.check(token.IDENT) || p.isAsyncMethod(p.pos) {
 			decl.Methods = append(decl.Methods, p.parseMethodDecl())
 		} else {
 			tok := p.peek()
-			p.error("E2003", tok.Span, fmt.Sprintf("expected method or constructor, got '%s'", tok.Lexeme))
+			p.error("E2003", tok.Span, fmt.Sprintf("expected method or static field in record, got '%s'", tok.Lexeme))
 			p.synchronize()
 		}
+		p.skipStalled(before)
 		p.skipSep()
 	}
 
@@ -501,46 +881,190 @@ func (p *Parser) parseClassDecl() *ast.ClassDecl {
 func (p *Parser) parseConstructorDecl() *ast.ConstructorDecl {
 	start := p.advance() // consume 'constructor'
 	decl := &ast.ConstructorDecl{}
-	decl.Params = p.parseParamList()
-	decl.Body = p.parseBlock()
+	decl.Params, decl.Rest = p.parseParamList()
+	body, generator := p.parseFuncBody(false)
+	if generator {
+		p.error("E2011", start.Span, "a constructor cannot yield")
+	}
+	decl.Body = body
 	decl.Span = p.makeSpan(start.Span.Start)
 	return decl
 }
 
 func (p *Parser) parseMethodDecl() *ast.MethodDecl {
-	start := p.advance() // consume method name (IDENT)
-	decl := &ast.MethodDecl{Name: start.Lexeme}
-	decl.Params = p.parseParamList()
-	decl.Body = p.parseBlock()
+	doc := p.docComment(p.pos)
+	start := p.advance() // consume method name (IDENT) or 'async'
+	decl := &ast.MethodDecl{Name: start.Lexeme, Doc: doc}
+	if start.Kind == token.KW_ASYNC {
+		decl.Name, decl.Async = p.advance().Lexeme, true
+	}
+	decl.Params, decl.Rest = p.parseParamList()
+	decl.Body, decl.Generator = p.parseFuncBody(decl.Async)
 	decl.Span = p.makeSpan(start.Span.Start)
 	return decl
 }
 
-// parseParamList parses: ( ident, ident, ... )
-func (p *Parser) parseParamList() []string {
-	var params []string
+// isAsyncMethod reports whether an async method, async IDENT ( ..., starts
+// at token index at.
+func (p *Parser) isAsyncMethod(at int) bool {
+	return p.kindAt(at) == token.KW_ASYNC && p.kindAt(at+1) == token.IDENT && p.kindAt(at+2) == token.LPAREN
+}
+
+// isAccessor reports whether a class member starts here with get or set
+// followed by a method: 'get' and 'set' are only keywords in that position,
+// so methods named get(...) and set(...) still parse as methods.
+func (p *Parser) isAccessor() bool {
+	if !p.check(token.IDENT) || (p.peek().Lexeme != "get" && p.peek().Lexeme != "set") {
+		return false
+	}
+	return p.kindAt(p.pos+1) == token.IDENT && p.kindAt(p.pos+2) == token.LPAREN
+}
+
+// parseAccessor parses get IDENT () block or set IDENT ( param ) block and
+// adds it to decl.
+func (p *Parser) parseAccessor(decl *ast.ClassDecl) {
+	doc := p.docComment(p.pos)
+	start := p.advance() // consume 'get' or 'set'
+	method := p.parseMethodDecl()
+	method.Doc = doc
+	method.Span = p.makeSpan(start.Span.Start)
+	if method.Generator {
+		p.error("E2011", start.Span, fmt.Sprintf("%ster '%s' cannot yield", start.Lexeme, method.Name))
+	}
+	if start.Lexeme == "get" {
+		if len(method.Params) != 0 {
+			p.error("E2003", method.Span, fmt.Sprintf("getter '%s' must not take parameters", method.Name))
+		}
+		decl.Getters = append(decl.Getters, method)
+		return
+	}
+	if len(method.Params) != 1 || method.Rest {
+		p.error("E2003", method.Span, fmt.Sprintf("setter '%s' must take exactly one parameter", method.Name))
+	}
+	decl.Setters = append(decl.Setters, method)
+}
+
+// parseFieldDecl parses an instance field: IDENT [ = expr ]
+func (p *Parser) parseFieldDecl() *ast.FieldDecl {
+	doc := p.docComment(p.pos)
+	start := p.advance() // consume field name (IDENT)
+	decl := &ast.FieldDecl{Name: start.Lexeme, Doc: doc}
+	if p.check(token.ASSIGN) {
+		p.advance()
+		p.skipNewlines()
+		decl.Value = p.parseExpr(bpNone)
+	}
+	decl.Span = p.makeSpan(start.Span.Start)
+	return decl
+}
+
+// parseStaticMember parses a static method, static IDENT ( params ) block,
+// or a static field, and adds it to decl.
+func (p *Parser) parseStaticMember(decl *ast.ClassDecl) {
+	if (p.kindAt(p.pos+1) == token.IDENT && p.kindAt(p.pos+2) == token.LPAREN) || p.isAsyncMethod(p.pos+1) {
+		doc := p.docComment(p.pos)
+		start := p.advance() // consume 'static'
+		method := p.parseMethodDecl()
+		method.Doc = doc
+		method.Span = p.makeSpan(start.Span.Start)
+		decl.StaticMethods = append(decl.StaticMethods, method)
+		return
+	}
+	decl.Statics = append(decl.Statics, p.parseStaticFieldDecl())
+}
 
+// parseStaticFieldDecl parses: static [const] IDENT [ = expr ]
+// A const field must have an initializer.
+func (p *Parser) parseStaticFieldDecl() *ast.StaticFieldDecl {
+	start := p.advance() // consume 'static'
+	decl := &ast.StaticFieldDecl{}
+	if p.check(token.KW_CONST) {
+		p.advance()
+		decl.IsConst = true
+	}
+
+	nameTok, ok := p.expect(token.IDENT)
+	if !ok {
+		p.synchronize()
+		decl.Span = p.makeSpan(start.Span.Start)
+		return decl
+	}
+	decl.Name = nameTok.Lexeme
+
+	if p.check(token.ASSIGN) {
+		p.advance()
+		p.skipNewlines()
+		decl.Value = p.parseExpr(bpNone)
+	} else if decl.IsConst {
+		p.error("E2001", nameTok.Span, fmt.Sprintf("expected '=' after static const '%s'", decl.Name))
+	}
+
+	decl.Span = p.makeSpan(start.Span.Start)
+	return decl
+}
+
+// parseParamList parses: ( ident, ident, ... ), where the last parameter
+// may be a rest parameter, ...ident. rest reports whether it is.
+func (p *Parser) parseParamList() (params []string, rest bool) {
 	if _, ok := p.expect(token.LPAREN); !ok {
-		return params
+		return params, false
 	}
 
 	if !p.check(token.RPAREN) {
-		nameTok, ok := p.expect(token.IDENT)
-		if ok {
-			params = append(params, nameTok.Lexeme)
-		}
-		for p.check(token.COMMA) {
-			p.advance() // consume ','
-			p.skipNewlines()
-			nameTok, ok = p.expect(token.IDENT)
+		for {
+			if rest {
+				p.error("E2010", p.peek().Span, "a rest parameter must be the last parameter")
+			}
+			if p.check(token.ELLIPSIS) {
+				p.advance() // consume '...'
+				rest = true
+			}
+			nameTok, ok := p.expect(token.IDENT)
 			if ok {
 				params = append(params, nameTok.Lexeme)
 			}
+			if !p.check(token.COMMA) {
+				break
+			}
+			p.advance() // consume ','
+			p.skipNewlines()
 		}
 	}
 
 	p.expect(token.RPAREN)
-	return params
+	return params, rest
+}
+
+// parseArgList parses call arguments after the opening '(' up to and
+// including the closing ')'. An argument written ...expr is a SpreadExpr.
+func (p *Parser) parseArgList() []ast.Expr {
+	var args []ast.Expr
+	p.skipNewlines()
+	if !p.check(token.RPAREN) {
+		for {
+			args = append(args, p.parseArg())
+			if !p.check(token.COMMA) {
+				break
+			}
+			p.advance() // consume ','
+			p.skipNewlines()
+		}
+	}
+	p.skipNewlines()
+	p.expect(token.RPAREN)
+	return args
+}
+
+func (p *Parser) parseArg() ast.Expr {
+	if !p.check(token.ELLIPSIS) {
+		return p.parseExpr(bpNone)
+	}
+	start := p.advance() // consume '...'
+	operand := p.parseExpr(bpNone)
+	return &ast.SpreadExpr{
+		ExprBase: makeExprBase(start.Span.Start, p.endOf(operand)),
+		Operand:  operand,
+	}
 }
 
 // ============================================================
@@ -550,13 +1074,13 @@ func (p *Parser) parseParamList() []string {
 // parseExpr parses an expression with the given minimum binding power.
 func (p *Parser) parseExpr(minBP int) ast.Expr {
 	left := p.nud()
-	if left == nil {
-		return nil
+	if _, bad := left.(*ast.BadExpr); bad {
+		return left
 	}
 
 	// Check for single-param arrow function: ident => body
 	if ident, ok := left.(*ast.IdentExpr); ok && p.check(token.ARROW) {
-		return p.parseArrowBody(left.GetSpan().Start, []string{ident.Name})
+		return p.parseArrowBody(left.GetSpan().Start, []string{ident.Name}, false)
 	}
 
 	for {
@@ -578,7 +1102,7 @@ func (p *Parser) nud() ast.Expr {
 	switch tok.Kind {
 	case token.INT:
 		p.advance()
-		val, _ := strconv.ParseInt(tok.Lexeme, 10, 64)
+		val, _ := lexer.IntValue(tok.Lexeme) // malformed literals are reported by the lexer
 		return &ast.IntLiteral{
 			ExprBase: makeExprBase(tok.Span.Start, tok.Span.End),
 			Value:    val,
@@ -586,7 +1110,7 @@ func (p *Parser) nud() ast.Expr {
 
 	case token.FLOAT:
 		p.advance()
-		val, _ := strconv.ParseFloat(tok.Lexeme, 64)
+		val, _ := lexer.FloatValue(tok.Lexeme)
 		return &ast.FloatLiteral{
 			ExprBase: makeExprBase(tok.Span.Start, tok.Span.End),
 			Value:    val,
@@ -629,6 +1153,18 @@ func (p *Parser) nud() ast.Expr {
 			ExprBase: makeExprBase(tok.Span.Start, tok.Span.End),
 		}
 
+	case token.KW_YIELD:
+		return p.parseYield()
+
+	case token.KW_SPAWN:
+		return p.parseSpawn()
+
+	case token.KW_AWAIT:
+		return p.parseAwait()
+
+	case token.KW_ASYNC:
+		return p.parseAsync()
+
 	case token.KW_THIS:
 		p.advance()
 		return &ast.ThisExpr{
@@ -671,7 +1207,7 @@ func (p *Parser) nud() ast.Expr {
 		p.skipNewlines()
 		operand := p.parseExpr(bpPrefix)
 		return &ast.UnaryExpr{
-			ExprBase: makeExprBase(tok.Span.Start, operand.GetSpan().End),
+			ExprBase: makeExprBase(tok.Span.Start, p.endOf(operand)),
 			Op:       token.BANG,
 			Operand:  operand,
 		}
@@ -682,11 +1218,22 @@ func (p *Parser) nud() ast.Expr {
 		p.skipNewlines()
 		operand := p.parseExpr(bpPrefix)
 		return &ast.UnaryExpr{
-			ExprBase: makeExprBase(tok.Span.Start, operand.GetSpan().End),
+			ExprBase: makeExprBase(tok.Span.Start, p.endOf(operand)),
 			Op:       token.MINUS,
 			Operand:  operand,
 		}
 
+	case token.TILDE:
+		// Unary: ~expr
+		p.advance()
+		p.skipNewlines()
+		operand := p.parseExpr(bpPrefix)
+		return &ast.UnaryExpr{
+			ExprBase: makeExprBase(tok.Span.Start, p.endOf(operand)),
+			Op:       token.TILDE,
+			Operand:  operand,
+		}
+
 	case token.KW_NEW:
 		return p.parseNewExpr()
 
@@ -697,7 +1244,9 @@ func (p *Parser) nud() ast.Expr {
 		return p.parseArrayLiteral()
 
 	default:
-		return nil
+		// Leave the token for the caller's recovery to skip
+		p.error("E2002", tok.Span, fmt.Sprintf("unexpected token: '%s'", tok.Lexeme))
+		return &ast.BadExpr{ExprBase: makeExprBase(tok.Span.Start, tok.Span.End)}
 	}
 }
 
@@ -716,22 +1265,27 @@ func (p *Parser) led(left ast.Expr) ast.Expr {
 		p.skipNewlines()
 		elseExpr := p.parseExpr(bpNone)
 		return &ast.TernaryExpr{
-			ExprBase:  makeExprBase(left.GetSpan().Start, elseExpr.GetSpan().End),
+			ExprBase:  makeExprBase(left.GetSpan().Start, p.endOf(elseExpr)),
 			Condition: left,
 			Then:      thenExpr,
 			Else:      elseExpr,
 		}
 
 	case token.PLUS, token.MINUS, token.STAR, token.SLASH, token.PERCENT,
-		token.EQ, token.NEQ, token.LT, token.LTE, token.GT, token.GTE,
-		token.AND, token.OR:
-		// Binary infix operator (left-associative)
+		token.EQ, token.NEQ, token.STRICT_EQ, token.STRICT_NEQ,
+		token.LT, token.LTE, token.GT, token.GTE, token.AND, token.OR, token.QUESTION_QUESTION, token.KW_INSTANCEOF,
+		token.STAR_STAR, token.AMP, token.PIPE, token.CARET, token.SHL, token.SHR:
+		// Binary infix operator (left-associative, except **)
 		bp := infixBP(tok.Kind)
 		p.advance()
 		p.skipNewlines() // allow continuation on next line after operator
-		right := p.parseExpr(bp)
+		rightBP := bp
+		if tok.Kind == token.STAR_STAR {
+			rightBP = bp - 1
+		}
+		right := p.parseExpr(rightBP)
 		return &ast.BinaryExpr{
-			ExprBase: makeExprBase(left.GetSpan().Start, right.GetSpan().End),
+			ExprBase: makeExprBase(left.GetSpan().Start, p.endOf(right)),
 			Op:       tok.Kind,
 			Left:     left,
 			Right:    right,
@@ -765,6 +1319,34 @@ func (p *Parser) led(left ast.Expr) ast.Expr {
 			Property: propTok.Lexeme,
 		}
 
+	case token.QUESTION_DOT:
+		// Optional chaining: object?.property, object?.[index], callee?.(args)
+		p.advance() // consume '?.'
+		switch {
+		case p.check(token.LPAREN):
+			call := p.parseCallExpr(left)
+			call.Optional = true
+			return call
+		case p.check(token.LBRACKET):
+			index := p.led(left).(*ast.IndexExpr)
+			index.Optional = true
+			return index
+		}
+		p.skipNewlines()
+		propTok, _ := p.expect(token.IDENT)
+		return &ast.MemberExpr{
+			ExprBase: makeExprBase(left.GetSpan().Start, propTok.Span.End),
+			Object:   left,
+			Property: propTok.Lexeme,
+			Optional: true,
+		}
+
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.STAR_ASSIGN, token.SLASH_ASSIGN,
+		token.PERCENT_ASSIGN, token.STAR_STAR_ASSIGN, token.AMP_ASSIGN, token.PIPE_ASSIGN,
+		token.CARET_ASSIGN, token.SHL_ASSIGN, token.SHR_ASSIGN:
+		// Assignment used as a value: a = b, a += b
+		return p.parseAssignExpr(left)
+
 	default:
 		return left
 	}
@@ -773,22 +1355,10 @@ func (p *Parser) led(left ast.Expr) ast.Expr {
 // parseCallExpr parses: callee ( args )
 func (p *Parser) parseCallExpr(callee ast.Expr) *ast.CallExpr {
 	p.advance() // consume '('
-	var args []ast.Expr
-
-	p.skipNewlines()
-	if !p.check(token.RPAREN) {
-		args = append(args, p.parseExpr(bpNone))
-		for p.check(token.COMMA) {
-			p.advance() // consume ','
-			p.skipNewlines()
-			args = append(args, p.parseExpr(bpNone))
-		}
-	}
-	p.skipNewlines()
-	end, _ := p.expect(token.RPAREN)
+	args := p.parseArgList()
 
 	return &ast.CallExpr{
-		ExprBase: makeExprBase(callee.GetSpan().Start, end.Span.End),
+		ExprBase: makeExprBase(callee.GetSpan().Start, p.prevEnd()),
 		Callee:   callee,
 		Args:     args,
 	}
@@ -807,17 +1377,7 @@ func (p *Parser) parseNewExpr() *ast.NewExpr {
 
 	var args []ast.Expr
 	if _, ok := p.expect(token.LPAREN); ok {
-		p.skipNewlines()
-		if !p.check(token.RPAREN) {
-			args = append(args, p.parseExpr(bpNone))
-			for p.check(token.COMMA) {
-				p.advance()
-				p.skipNewlines()
-				args = append(args, p.parseExpr(bpNone))
-			}
-		}
-		p.skipNewlines()
-		p.expect(token.RPAREN)
+		args = p.parseArgList()
 	}
 
 	return &ast.NewExpr{
@@ -837,42 +1397,60 @@ func (p *Parser) parseForStmt() ast.Stmt {
 
 	if _, ok := p.expect(token.LPAREN); !ok {
 		p.synchronize()
-		return &ast.ExprStmt{StmtBase: makeStmtBase(start.Span.Start, p.prevEnd())}
+		return p.badStmt(start.Span.Start)
 	}
 
 	p.skipNewlines()
 
-	// Detect for-of: for (var IDENT of expr)
-	if p.check(token.KW_VAR) && p.pos+2 < len(p.tokens) &&
-		p.tokens[p.pos+1].Kind == token.IDENT &&
-		p.tokens[p.pos+2].Kind == token.KW_OF {
-		return p.parseForOfBody(start)
+	// Detect for-of: for (var IDENT of expr), for (var IDENT, IDENT of expr)
+	// or for (var pattern of expr), or the same with let
+	if p.match(token.KW_VAR, token.KW_LET) {
+		switch p.kindAt(p.pos + 1) {
+		case token.IDENT:
+			if p.kindAt(p.pos+2) == token.KW_OF ||
+				p.kindAt(p.pos+2) == token.COMMA && p.kindAt(p.pos+3) == token.IDENT && p.kindAt(p.pos+4) == token.KW_OF {
+				return p.parseForOfBody(start)
+			}
+		case token.LBRACKET, token.LBRACE:
+			if p.kindAt(p.skipGroup(p.pos+1)) == token.KW_OF {
+				return p.parseForOfBody(start)
+			}
+		}
 	}
 
 	// C-style for loop: for (init; cond; update)
 	return p.parseCStyleFor(start)
 }
 
-// parseForOfBody parses the rest of: for ( var IDENT of expr ) block
+// parseForOfBody parses the rest of: for ( (var | let) (IDENT [, IDENT] | pattern) of expr ) block
 func (p *Parser) parseForOfBody(start token.Token) *ast.ForOfStmt {
-	p.advance() // consume 'var'
-	nameTok := p.advance() // consume IDENT
+	stmt := &ast.ForOfStmt{}
+	stmt.IsLet = p.advance().Kind == token.KW_LET // consume 'var' or 'let'
+	if p.match(token.LBRACKET, token.LBRACE) {
+		stmt.Pattern = p.parsePattern(true)
+	} else {
+		nameTok := p.advance() // consume IDENT
+		if p.check(token.COMMA) {
+			p.advance()
+			stmt.KeyName = nameTok.Lexeme
+			nameTok = p.advance() // consume the second IDENT
+			if nameTok.Lexeme == stmt.KeyName {
+				p.error("E2009", nameTok.Span, fmt.Sprintf("for-of declares '%s' twice", stmt.KeyName))
+			}
+		}
+		stmt.VarName = nameTok.Lexeme
+	}
 	p.advance() // consume 'of'
 	p.skipNewlines()
 
-	iterable := p.parseExpr(bpNone)
+	stmt.Iterable = p.parseExpr(bpNone)
 
 	p.skipNewlines()
 	p.expect(token.RPAREN)
 
-	body := p.parseBlock()
-
-	return &ast.ForOfStmt{
-		StmtBase: makeStmtBase(start.Span.Start, p.prevEnd()),
-		VarName:  nameTok.Lexeme,
-		Iterable: iterable,
-		Body:     body,
-	}
+	stmt.Body = p.parseBlock()
+	stmt.Span = p.makeSpan(start.Span.Start)
+	return stmt
 }
 
 // parseCStyleFor parses: for ( [init]; [cond]; [update] ) block
@@ -882,7 +1460,7 @@ func (p *Parser) parseCStyleFor(start token.Token) *ast.ForStmt {
 	// Init (optional)
 	p.skipNewlines()
 	if !p.check(token.SEMICOLON) {
-		if p.match(token.KW_VAR, token.KW_CONST) {
+		if p.match(token.KW_VAR, token.KW_LET, token.KW_CONST) {
 			stmt.Init = p.parseVarDecl()
 		} else {
 			stmt.Init = p.parseSimpleStmt()
@@ -909,18 +1487,22 @@ func (p *Parser) parseCStyleFor(start token.Token) *ast.ForStmt {
 	return stmt
 }
 
-// parseFuncExpr parses: function [name] ( params ) block
+// parseFuncExpr parses: [async] function [name] ( params ) block
 func (p *Parser) parseFuncExpr() *ast.FuncExpr {
-	start := p.advance() // consume 'function'
+	start := p.advance() // consume 'function' or 'async'
 	expr := &ast.FuncExpr{}
+	if start.Kind == token.KW_ASYNC {
+		expr.Async = true
+		p.advance() // consume 'function'
+	}
 
 	// Optional name
 	if p.check(token.IDENT) {
 		expr.Name = p.advance().Lexeme
 	}
 
-	expr.Params = p.parseParamList()
-	expr.Body = p.parseBlock()
+	expr.Params, expr.Rest = p.parseParamList()
+	expr.Body, expr.Generator = p.parseFuncBody(expr.Async)
 	expr.ExprBase = makeExprBase(start.Span.Start, p.prevEnd())
 	return expr
 }
@@ -951,6 +1533,152 @@ func (p *Parser) parseArrayLiteral() *ast.ArrayLiteral {
 	}
 }
 
+// ============================================================
+// Destructuring patterns
+// ============================================================
+
+// skipGroup returns the index of the token after the bracket, brace or
+// parenthesis that closes the one at index i.
+func (p *Parser) skipGroup(i int) int {
+	depth := 0
+	for {
+		switch p.kindAt(i) {
+		case token.LBRACKET, token.LBRACE, token.LPAREN:
+			depth++
+		case token.RBRACKET, token.RBRACE, token.RPAREN:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case token.EOF:
+			return i
+		}
+		i++
+	}
+}
+
+// isPatternAssign does lookahead to detect [ ... ] = or { ... } = at the
+// start of a statement.
+func (p *Parser) isPatternAssign() bool {
+	return p.kindAt(p.skipGroup(p.pos)) == token.ASSIGN
+}
+
+// parsePattern parses: [ target {, target} [, ...target] ] or
+// { key [: target] {, key [: target]} }. In declarations a target is a
+// name or a nested pattern; in assignments it may be any assignable
+// expression.
+func (p *Parser) parsePattern(decl bool) ast.Expr {
+	start := p.advance() // consume '[' or '{'
+	if start.Kind == token.LBRACKET {
+		pattern := &ast.ArrayPattern{}
+		p.skipNewlines()
+		for !p.match(token.RBRACKET, token.EOF) {
+			if p.check(token.ELLIPSIS) {
+				dots := p.advance()
+				target := p.parsePatternTarget(decl)
+				pattern.Elements = append(pattern.Elements, &ast.SpreadExpr{
+					ExprBase: makeExprBase(dots.Span.Start, p.endOf(target)),
+					Operand:  target,
+				})
+				p.skipNewlines()
+				if !p.check(token.RBRACKET) {
+					p.error("E2010", dots.Span, "a rest element must be the last element of a pattern")
+				}
+			} else {
+				pattern.Elements = append(pattern.Elements, p.parsePatternTarget(decl))
+			}
+			p.skipNewlines()
+			if !p.check(token.COMMA) {
+				break
+			}
+			p.advance() // consume ','
+			p.skipNewlines()
+		}
+		end, _ := p.expect(token.RBRACKET)
+		pattern.ExprBase = makeExprBase(start.Span.Start, end.Span.End)
+		return pattern
+	}
+
+	pattern := &ast.MapPattern{}
+	p.skipNewlines()
+	for !p.match(token.RBRACE, token.EOF) {
+		keyTok, ok := p.expect(token.IDENT)
+		if !ok {
+			break
+		}
+		var target ast.Expr = &ast.IdentExpr{
+			ExprBase: makeExprBase(keyTok.Span.Start, keyTok.Span.End),
+			Name:     keyTok.Lexeme,
+		}
+		if p.check(token.COLON) {
+			p.advance()
+			p.skipNewlines()
+			target = p.parsePatternTarget(decl)
+		}
+		pattern.Keys = append(pattern.Keys, keyTok.Lexeme)
+		pattern.Values = append(pattern.Values, target)
+		p.skipNewlines()
+		if !p.check(token.COMMA) {
+			break
+		}
+		p.advance() // consume ','
+		p.skipNewlines()
+	}
+	end, _ := p.expect(token.RBRACE)
+	pattern.ExprBase = makeExprBase(start.Span.Start, end.Span.End)
+	return pattern
+}
+
+// parsePatternTarget parses one target of a destructuring pattern.
+func (p *Parser) parsePatternTarget(decl bool) ast.Expr {
+	if p.match(token.LBRACKET, token.LBRACE) {
+		return p.parsePattern(decl)
+	}
+	if decl {
+		tok, ok := p.expect(token.IDENT)
+		if !ok {
+			return &ast.BadExpr{ExprBase: makeExprBase(tok.Span.Start, tok.Span.End)}
+		}
+		return &ast.IdentExpr{ExprBase: makeExprBase(tok.Span.Start, tok.Span.End), Name: tok.Lexeme}
+	}
+	target := p.parseExpr(bpAssign)
+	switch target.(type) {
+	case *ast.IdentExpr, *ast.MemberExpr, *ast.IndexExpr, *ast.BadExpr:
+		if optionalChain(target) {
+			p.error("E2001", target.GetSpan(), "cannot assign to an optional chain")
+		}
+	default:
+		p.error("E2001", target.GetSpan(), "expected a variable, member or index to assign to")
+	}
+	return target
+}
+
+// optionalChain reports whether e is a member, index or call chain with an
+// optional link, such as a?.b.c.
+func optionalChain(e ast.Expr) bool {
+	for {
+		switch x := e.(type) {
+		case *ast.MemberExpr:
+			if x.Optional {
+				return true
+			}
+			e = x.Object
+		case *ast.IndexExpr:
+			if x.Optional {
+				return true
+			}
+			e = x.Object
+		case *ast.CallExpr:
+			if x.Optional {
+				return true
+			}
+			e = x.Callee
+		default:
+			return false
+		}
+	}
+}
+
 // ============================================================
 // Arrow function parsing
 // ============================================================
@@ -958,71 +1686,79 @@ func (p *Parser) parseArrayLiteral() *ast.ArrayLiteral {
 // isArrowFunction does lookahead to detect (params) => pattern.
 func (p *Parser) isArrowFunction() bool {
 	i := p.pos
-	if i >= len(p.tokens) || p.tokens[i].Kind != token.LPAREN {
+	if p.kindAt(i) != token.LPAREN {
 		return false
 	}
 	i++ // skip '('
 
 	// Skip IDENT, COMMA pairs (and newlines)
-	for i < len(p.tokens) && p.tokens[i].Kind != token.RPAREN {
-		if p.tokens[i].Kind == token.NEWLINE {
+	for p.kindAt(i) != token.RPAREN {
+		if p.kindAt(i) == token.NEWLINE {
 			i++
 			continue
 		}
-		if p.tokens[i].Kind != token.IDENT {
-			return false
+		if p.kindAt(i) == token.ELLIPSIS {
+			i++
+		}
+		if p.kindAt(i) != token.IDENT {
+			return false // includes EOF
 		}
 		i++
-		if i < len(p.tokens) && p.tokens[i].Kind == token.COMMA {
+		if p.kindAt(i) == token.COMMA {
 			i++
 		}
 	}
-
-	if i >= len(p.tokens) || p.tokens[i].Kind != token.RPAREN {
-		return false
-	}
 	i++ // skip ')'
 
 	// Skip newlines
-	for i < len(p.tokens) && p.tokens[i].Kind == token.NEWLINE {
+	for p.kindAt(i) == token.NEWLINE {
 		i++
 	}
 
-	return i < len(p.tokens) && p.tokens[i].Kind == token.ARROW
+	return p.kindAt(i) == token.ARROW
 }
 
 // parseArrowFromParen parses: (params) => body
 func (p *Parser) parseArrowFromParen() *ast.FuncExpr {
 	start := p.peek()
-	params := p.parseParamList()
-	return p.parseArrowBody(start.Span.Start, params)
+	params, rest := p.parseParamList()
+	fn := p.parseArrowBody(start.Span.Start, params, false)
+	fn.Rest = rest
+	return fn
 }
 
 // parseArrowBody parses: => body (expression or block)
-func (p *Parser) parseArrowBody(start span.Position, params []string) *ast.FuncExpr {
+func (p *Parser) parseArrowBody(start span.Position, params []string, async bool) *ast.FuncExpr {
 	p.advance() // consume '=>'
 	p.skipNewlines()
 
 	var body *ast.BlockStmt
+	var generator bool
 	if p.check(token.LBRACE) {
-		body = p.parseBlock()
+		body, generator = p.parseFuncBody(async)
 	} else {
 		// Expression body: wrap in implicit return
+		exprStart := p.peek().Span.Start
+		prev, prevAsync := p.yields, p.async
+		p.yields, p.async = &generator, async
 		expr := p.parseExpr(bpNone)
+		p.yields, p.async = prev, prevAsync
 		retStmt := &ast.ReturnStmt{
-			StmtBase: makeStmtBase(expr.GetSpan().Start, expr.GetSpan().End),
+			StmtBase: makeStmtBase(exprStart, p.endOf(expr)),
 			Value:    expr,
 		}
 		body = &ast.BlockStmt{
-			StmtBase: makeStmtBase(expr.GetSpan().Start, expr.GetSpan().End),
+			StmtBase: makeStmtBase(exprStart, p.endOf(expr)),
 			Stmts:    []ast.Node{retStmt},
 		}
 	}
 
 	return &ast.FuncExpr{
-		ExprBase: makeExprBase(start, p.prevEnd()),
-		Params:   params,
-		Body:     body,
+		ExprBase:  makeExprBase(start, p.prevEnd()),
+		Params:    params,
+		Body:      body,
+		Generator: generator,
+		Async:     async,
 	}
 }
 
@@ -1037,13 +1773,13 @@ func (p *Parser) parseTemplateLiteral() *ast.TemplateLiteral {
 	var exprs []ast.Expr
 
 	// Parse first expression
-	exprs = append(exprs, p.parseExpr(bpNone))
+	exprs = append(exprs, p.parseTemplateExpr())
 
 	// Continue with TEMPLATE_MIDDLE / TEMPLATE_TAIL
 	for p.check(token.TEMPLATE_MIDDLE) {
 		mid := p.advance()
 		parts = append(parts, mid.Lexeme)
-		exprs = append(exprs, p.parseExpr(bpNone))
+		exprs = append(exprs, p.parseTemplateExpr())
 	}
 
 	// Expect TEMPLATE_TAIL
@@ -1062,10 +1798,38 @@ func (p *Parser) parseTemplateLiteral() *ast.TemplateLiteral {
 	}
 }
 
+// parseTemplateExpr parses the expression inside ${ }, which may span
+// several lines.
+func (p *Parser) parseTemplateExpr() ast.Expr {
+	p.skipNewlines()
+	if p.check(token.TEMPLATE_MIDDLE) || p.check(token.TEMPLATE_TAIL) {
+		tok := p.peek()
+		p.error("E2005", tok.Span, "empty ${} in template literal, expected an expression")
+		return &ast.BadExpr{ExprBase: makeExprBase(tok.Span.Start, tok.Span.Start)}
+	}
+	expr := p.parseExpr(bpNone)
+	p.skipNewlines()
+	return expr
+}
+
 // ============================================================
 // Map literal parsing
 // ============================================================
 
+// isMapLiteralStart does lookahead to detect { name: or { "key": at the
+// start of a statement, which opens a map literal rather than a block.
+func (p *Parser) isMapLiteralStart() bool {
+	i := p.pos + 1
+	for p.kindAt(i) == token.NEWLINE {
+		i++
+	}
+	switch p.kindAt(i) {
+	case token.IDENT, token.STRING:
+		return p.kindAt(i+1) == token.COLON
+	}
+	return false
+}
+
 // parseMapLiteral parses: { key: val, key: val, ... }
 func (p *Parser) parseMapLiteral() *ast.MapLiteral {
 	start := p.advance() // consume '{'
@@ -1098,6 +1862,8 @@ func (p *Parser) parseMapLiteral() *ast.MapLiteral {
 	}
 }
 
+// parseMapEntry parses one entry: name: val, "key": val, [expr]: val, or
+// the shorthand name, which stands for name: name.
 func (p *Parser) parseMapEntry() (ast.Expr, ast.Expr) {
 	p.skipNewlines()
 	var key ast.Expr
@@ -1115,9 +1881,23 @@ func (p *Parser) parseMapEntry() (ast.Expr, ast.Expr) {
 			ExprBase: makeExprBase(tok.Span.Start, tok.Span.End),
 			Value:    tok.Lexeme,
 		}
+		if !p.check(token.COLON) {
+			// Shorthand: { x } is { x: x }
+			return key, &ast.IdentExpr{
+				ExprBase: makeExprBase(tok.Span.Start, tok.Span.End),
+				Name:     tok.Lexeme,
+			}
+		}
+	} else if p.check(token.LBRACKET) {
+		// Computed key: { [expr]: val }
+		p.advance()
+		p.skipNewlines()
+		key = p.parseExpr(bpNone)
+		p.skipNewlines()
+		p.expect(token.RBRACKET)
 	} else {
 		tok := p.peek()
-		p.error("E2004", tok.Span, fmt.Sprintf("expected map key (string or identifier), got '%s'", tok.Lexeme))
+		p.error("E2004", tok.Span, fmt.Sprintf("expected map key (identifier, string or [expression]), got '%s'", tok.Lexeme))
 		p.synchronize()
 		key = &ast.StringLiteral{ExprBase: makeExprBase(tok.Span.Start, tok.Span.End), Value: ""}
 	}
@@ -1167,33 +1947,124 @@ func (p *Parser) parseThrowStmt() *ast.ThrowStmt {
 	}
 }
 
+// ============================================================
+// Import parsing
+// ============================================================
+
+// parseExport parses: export (function | class | record | enum | interface | var | const) ...
+// and marks the declaration as visible to importers.
+func (p *Parser) parseExport() ast.Node {
+	doc := p.docComment(p.pos)
+	start := p.advance() // consume 'export'
+
+	node := p.parseTopLevel()
+	switch decl := node.(type) {
+	case *ast.FuncDecl:
+		decl.Exported = true
+		decl.Doc = doc
+		decl.Span.Start = start.Span.Start
+	case *ast.ClassDecl:
+		decl.Exported = true
+		decl.Doc = doc
+		decl.Span.Start = start.Span.Start
+	case *ast.EnumDecl:
+		decl.Exported = true
+		decl.Span.Start = start.Span.Start
+	case *ast.InterfaceDecl:
+		decl.Exported = true
+		decl.Span.Start = start.Span.Start
+	case *ast.VarDeclStmt:
+		decl.Exported = true
+		decl.Span.Start = start.Span.Start
+	case *ast.BadStmt:
+	default:
+		p.error("E2008", node.GetSpan(), "expected a declaration after 'export'")
+	}
+	return node
+}
+
+// parseImportStmt parses: import [native] "path" | import IDENT from "path" [as IDENT]
+func (p *Parser) parseImportStmt() ast.Stmt {
+	start := p.advance() // consume 'import'
+	stmt := &ast.ImportStmt{}
+
+	if p.check(token.IDENT) && p.kindAt(p.pos+1) == token.IDENT && p.tokens[p.pos+1].Lexeme == "from" {
+		return p.parseDataImport(start, stmt)
+	}
+
+	if p.check(token.IDENT) && p.peek().Lexeme == "native" {
+		p.advance() // consume 'native'
+		stmt.Native = true
+	}
+
+	if !p.check(token.STRING) {
+		tok := p.peek()
+		p.error("E2006", tok.Span, fmt.Sprintf("expected module path string after 'import', got '%s'", tok.Lexeme))
+		p.synchronize()
+		return p.badStmt(start.Span.Start)
+	}
+	stmt.Path = p.advance().Lexeme
+
+	stmt.Span = p.makeSpan(start.Span.Start)
+	return stmt
+}
+
+// parseDataImport parses the rest of: import IDENT from "path" [as text|json]
+func (p *Parser) parseDataImport(start token.Token, stmt *ast.ImportStmt) ast.Stmt {
+	stmt.Name = p.advance().Lexeme // consume IDENT
+	p.advance()                    // consume 'from'
+
+	if !p.check(token.STRING) {
+		tok := p.peek()
+		p.error("E2006", tok.Span, fmt.Sprintf("expected file path string after 'from', got '%s'", tok.Lexeme))
+		p.synchronize()
+		return p.badStmt(start.Span.Start)
+	}
+	stmt.Path = p.advance().Lexeme
+
+	if p.check(token.IDENT) && p.peek().Lexeme == "as" {
+		p.advance() // consume 'as'
+		if formatTok, ok := p.expect(token.IDENT); ok {
+			if formatTok.Lexeme != "text" && formatTok.Lexeme != "json" {
+				p.error("E2007", formatTok.Span, fmt.Sprintf("unknown import format '%s', expected 'text' or 'json'", formatTok.Lexeme))
+			}
+			stmt.As = formatTok.Lexeme
+		}
+	}
+
+	stmt.Span = p.makeSpan(start.Span.Start)
+	return stmt
+}
+
 // ============================================================
 // Match statement parsing
 // ============================================================
 
 // parseMatchStmt parses: match (subject) { arms... }
-func (p *Parser) parseMatchStmt() *ast.MatchStmt {
+func (p *Parser) parseMatchStmt() ast.Stmt {
 	start := p.advance() // consume 'match'
 	stmt := &ast.MatchStmt{}
 
 	if _, ok := p.expect(token.LPAREN); !ok {
 		p.synchronize()
-		stmt.StmtBase = makeStmtBase(start.Span.Start, p.prevEnd())
-		return stmt
+		return p.badStmt(start.Span.Start)
 	}
 	stmt.Subject = p.parseExpr(bpNone)
 	p.expect(token.RPAREN)
 
 	if _, ok := p.expect(token.LBRACE); !ok {
 		p.synchronize()
-		stmt.StmtBase = makeStmtBase(start.Span.Start, p.prevEnd())
-		return stmt
+		return p.badStmt(start.Span.Start)
 	}
 
 	p.skipSep()
 	for !p.check(token.RBRACE) && !p.isAtEnd() {
+		before := p.pos
 		arm := p.parseMatchArm()
-		stmt.Arms = append(stmt.Arms, arm)
+		if arm.Body != nil {
+			stmt.Arms = append(stmt.Arms, arm)
+		}
+		p.skipStalled(before)
 		p.skipSep()
 	}
 	p.expect(token.RBRACE)
@@ -1262,10 +2133,10 @@ func (p *Parser) isBindingPattern() bool {
 	}
 	// Look ahead past newlines for 'if'
 	nextPos := p.pos + 1
-	for nextPos < len(p.tokens) && p.tokens[nextPos].Kind == token.NEWLINE {
+	for p.kindAt(nextPos) == token.NEWLINE {
 		nextPos++
 	}
-	return nextPos < len(p.tokens) && p.tokens[nextPos].Kind == token.KW_IF
+	return p.kindAt(nextPos) == token.KW_IF
 }
 
 // ============================================================
@@ -1273,22 +2144,20 @@ func (p *Parser) isBindingPattern() bool {
 // ============================================================
 
 // parseEnumDecl parses: enum Name { Variant1, Variant2, ... }
-func (p *Parser) parseEnumDecl() *ast.EnumDecl {
+func (p *Parser) parseEnumDecl() ast.Stmt {
 	start := p.advance() // consume 'enum'
 	decl := &ast.EnumDecl{}
 
 	nameTok, ok := p.expect(token.IDENT)
 	if !ok {
 		p.synchronize()
-		decl.StmtBase = makeStmtBase(start.Span.Start, p.prevEnd())
-		return decl
+		return p.badStmt(start.Span.Start)
 	}
 	decl.Name = nameTok.Lexeme
 
 	if _, ok := p.expect(token.LBRACE); !ok {
 		p.synchronize()
-		decl.StmtBase = makeStmtBase(start.Span.Start, p.prevEnd())
-		return decl
+		return p.badStmt(start.Span.Start)
 	}
 
 	p.skipSep()
@@ -1321,29 +2190,29 @@ func (p *Parser) parseEnumDecl() *ast.EnumDecl {
 // ============================================================
 
 // parseInterfaceDecl parses: interface Name { method1(params), method2(params), ... }
-func (p *Parser) parseInterfaceDecl() *ast.InterfaceDecl {
+func (p *Parser) parseInterfaceDecl() ast.Stmt {
 	start := p.advance() // consume 'interface'
 	decl := &ast.InterfaceDecl{}
 
 	nameTok, ok := p.expect(token.IDENT)
 	if !ok {
 		p.synchronize()
-		decl.StmtBase = makeStmtBase(start.Span.Start, p.prevEnd())
-		return decl
+		return p.badStmt(start.Span.Start)
 	}
 	decl.Name = nameTok.Lexeme
 
 	if _, ok := p.expect(token.LBRACE); !ok {
 		p.synchronize()
-		decl.StmtBase = makeStmtBase(start.Span.Start, p.prevEnd())
-		return decl
+		return p.badStmt(start.Span.Start)
 	}
 
 	p.skipSep()
 	for !p.check(token.RBRACE) && !p.isAtEnd() {
+		before := p.pos
 		methodTok, ok := p.expect(token.IDENT)
 		if !ok {
 			p.synchronize()
+			p.skipStalled(before)
 			continue
 		}
 		sig := ast.InterfaceMethodSig{Name: methodTok.Lexeme}
@@ -1372,20 +2241,19 @@ func (p *Parser) parseInterfaceDecl() *ast.InterfaceDecl {
 	return decl
 }
 
-// compoundToOp maps compound assignment token to binary operator.
-func compoundToOp(kind token.Kind) token.Kind {
-	switch kind {
-	case token.PLUS_ASSIGN:
-		return token.PLUS
-	case token.MINUS_ASSIGN:
-		return token.MINUS
-	case token.STAR_ASSIGN:
-		return token.STAR
-	case token.SLASH_ASSIGN:
-		return token.SLASH
-	default:
-		return token.PLUS
-	}
+// compoundOps maps each compound assignment token to its binary operator.
+var compoundOps = map[token.Kind]token.Kind{
+	token.PLUS_ASSIGN:      token.PLUS,
+	token.MINUS_ASSIGN:     token.MINUS,
+	token.STAR_ASSIGN:      token.STAR,
+	token.SLASH_ASSIGN:     token.SLASH,
+	token.PERCENT_ASSIGN:   token.PERCENT,
+	token.STAR_STAR_ASSIGN: token.STAR_STAR,
+	token.AMP_ASSIGN:       token.AMP,
+	token.PIPE_ASSIGN:      token.PIPE,
+	token.CARET_ASSIGN:     token.CARET,
+	token.SHL_ASSIGN:       token.SHL,
+	token.SHR_ASSIGN:       token.SHR,
 }
 
 // ============================================================
@@ -1399,6 +2267,25 @@ func (p *Parser) prevEnd() span.Position {
 	return p.peek().Span.Start
 }
 
+// badStmt returns a placeholder for a statement that failed to parse,
+// spanning from start over the tokens consumed while recovering.
+func (p *Parser) badStmt(start span.Position) *ast.BadStmt {
+	end := p.prevEnd()
+	if end.Offset < start.Offset {
+		end = start
+	}
+	return &ast.BadStmt{StmtBase: makeStmtBase(start, end)}
+}
+
+// endOf returns where n ends, falling back to the end of the previous token
+// when n is nil because it failed to parse.
+func (p *Parser) endOf(n ast.Node) span.Position {
+	if n == nil {
+		return p.prevEnd()
+	}
+	return n.GetSpan().End
+}
+
 func (p *Parser) makeSpan(start span.Position) span.Span {
 	return span.Span{Start: start, End: p.prevEnd()}
 }
@@ -4,6 +4,12 @@ import (
 	"encoding/json"
 	"light-lang/internal/ast"
 	"light-lang/internal/lexer"
+	"light-lang/internal/token"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -66,6 +72,42 @@ func TestParseConstDecl(t *testing.T) {
 	}
 }
 
+func TestParseLetDecl(t *testing.T) {
+	file := parseOK(t, "let x = 1\nfor (let i = 0; i < 3; i += 1) {}\nfor (let k, v of m) {}")
+	decl := file.Body[0].(*ast.VarDeclStmt)
+	if !decl.IsLet || decl.IsConst || decl.Name != "x" {
+		t.Errorf("expected let x, got %#v", decl)
+	}
+	if init, ok := file.Body[1].(*ast.ForStmt).Init.(*ast.VarDeclStmt); !ok || !init.IsLet {
+		t.Errorf("expected a let initializer, got %#v", file.Body[1].(*ast.ForStmt).Init)
+	}
+	if loop := file.Body[2].(*ast.ForOfStmt); !loop.IsLet || loop.KeyName != "k" || loop.VarName != "v" {
+		t.Errorf("expected for (let k, v of m), got %#v", loop)
+	}
+}
+
+func TestParseMultipleAssign(t *testing.T) {
+	file := parseOK(t, "function f() { return 1, 2 }\nvar a, b = f()")
+	decl, ok := file.Body[1].(*ast.VarDeclStmt)
+	if !ok {
+		t.Fatalf("expected VarDeclStmt, got %T", file.Body[1])
+	}
+	if decl.Name != "a" || len(decl.Names) != 2 || decl.Names[1] != "b" {
+		t.Errorf("expected names [a b], got %q %v", decl.Name, decl.Names)
+	}
+	ret := file.Body[0].(*ast.FuncDecl).Body.Stmts[0].(*ast.ReturnStmt)
+	arr, ok := ret.Value.(*ast.ArrayLiteral)
+	if !ok || len(arr.Elements) != 2 {
+		t.Fatalf("expected 2-element ArrayLiteral, got %#v", ret.Value)
+	}
+
+	tokens, _ := lexer.New(`var a, b`, "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 || diags[0].Code != "E2001" {
+		t.Errorf("expected E2001 for a variable list without initializer, got %v", diags)
+	}
+}
+
 func TestParseBinaryExpr(t *testing.T) {
 	file := parseOK(t, `var z = 1 + 2 * 3`)
 	decl := file.Body[0].(*ast.VarDeclStmt)
@@ -87,6 +129,132 @@ func TestParseBinaryExpr(t *testing.T) {
 	}
 }
 
+func TestParseTemplateLiteral(t *testing.T) {
+	file := parseOK(t, "`plain`\n`a ${x} b ${`in ${y}`} c`\n`line1\nline2 ${\n  x +\n  1\n}`")
+	if str, ok := file.Body[0].(*ast.ExprStmt).Expr.(*ast.StringLiteral); !ok || str.Value != "plain" {
+		t.Errorf("expected a template without ${} to be a string literal, got %+v", file.Body[0])
+	}
+	lit := file.Body[1].(*ast.ExprStmt).Expr.(*ast.TemplateLiteral)
+	if !reflect.DeepEqual(lit.Parts, []string{"a ", " b ", " c"}) || len(lit.Exprs) != 2 {
+		t.Fatalf("expected three parts around two expressions, got %+v", lit)
+	}
+	if inner, ok := lit.Exprs[1].(*ast.TemplateLiteral); !ok || len(inner.Exprs) != 1 {
+		t.Errorf("expected a nested template, got %+v", lit.Exprs[1])
+	}
+	lit = file.Body[2].(*ast.ExprStmt).Expr.(*ast.TemplateLiteral)
+	if lit.Parts[0] != "line1\nline2 " || len(lit.Exprs) != 1 {
+		t.Errorf("expected a multi-line template, got %+v", lit)
+	}
+	if bin, ok := lit.Exprs[0].(*ast.BinaryExpr); !ok || bin.Op != token.PLUS {
+		t.Errorf("expected x + 1 across lines, got %+v", lit.Exprs[0])
+	}
+
+	tokens, _ := lexer.New("`a ${} b`", "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) != 1 || diags[0].Message != "empty ${} in template literal, expected an expression" {
+		t.Errorf("expected one empty ${} error, got %v", diags)
+	}
+}
+
+func TestParseMapLiteral(t *testing.T) {
+	file := parseOK(t, "var m = { name: 1, \"key\": 2, x, [k + 1]: 3 }\n{ a: 1 }.a\n{\n  \"b\": 2\n}\n{ a }")
+	lit := file.Body[0].(*ast.VarDeclStmt).Init.(*ast.MapLiteral)
+	if len(lit.Keys) != 4 {
+		t.Fatalf("expected four entries, got %+v", lit)
+	}
+	for idx, want := range []string{"name", "key", "x"} {
+		if key, ok := lit.Keys[idx].(*ast.StringLiteral); !ok || key.Value != want {
+			t.Errorf("entry %d: expected key %q, got %+v", idx, want, lit.Keys[idx])
+		}
+	}
+	if value, ok := lit.Values[2].(*ast.IdentExpr); !ok || value.Name != "x" {
+		t.Errorf("expected shorthand x to stand for x: x, got %+v", lit.Values[2])
+	}
+	if _, ok := lit.Keys[3].(*ast.BinaryExpr); !ok {
+		t.Errorf("expected a computed key, got %+v", lit.Keys[3])
+	}
+	if _, ok := file.Body[1].(*ast.ExprStmt).Expr.(*ast.MemberExpr); !ok {
+		t.Errorf("expected { a: 1 }.a to be a map literal, got %+v", file.Body[1])
+	}
+	if _, ok := file.Body[2].(*ast.ExprStmt).Expr.(*ast.MapLiteral); !ok {
+		t.Errorf("expected a multi-line map literal statement, got %+v", file.Body[2])
+	}
+	if _, ok := file.Body[3].(*ast.BlockStmt); !ok {
+		t.Errorf("expected { a } to stay a block, got %+v", file.Body[3])
+	}
+}
+
+func TestParseNumberLiterals(t *testing.T) {
+	file := parseOK(t, "[0xFF, 0b11, 1_000, 1.5e3]")
+	arr := file.Body[0].(*ast.ExprStmt).Expr.(*ast.ArrayLiteral)
+	for idx, want := range []int64{255, 3, 1000} {
+		if lit, ok := arr.Elements[idx].(*ast.IntLiteral); !ok || lit.Value != want {
+			t.Errorf("element %d: expected IntLiteral %d, got %+v", idx, want, arr.Elements[idx])
+		}
+	}
+	if lit, ok := arr.Elements[3].(*ast.FloatLiteral); !ok || lit.Value != 1500 {
+		t.Errorf("expected FloatLiteral 1500, got %+v", arr.Elements[3])
+	}
+}
+
+func TestParseCompoundAssign(t *testing.T) {
+	ops := map[string]token.Kind{
+		"+=": token.PLUS, "%=": token.PERCENT, "**=": token.STAR_STAR, "&=": token.AMP,
+		"|=": token.PIPE, "^=": token.CARET, "<<=": token.SHL, ">>=": token.SHR,
+	}
+	for lexeme, op := range ops {
+		file := parseOK(t, "a[i] "+lexeme+" 2")
+		assign := file.Body[0].(*ast.AssignStmt)
+		if assign.Op.String() != lexeme {
+			t.Errorf("%s: expected Op %s, got %s", lexeme, lexeme, assign.Op)
+		}
+		bin, ok := assign.Value.(*ast.BinaryExpr)
+		if !ok || bin.Op != op || bin.Left != assign.Target {
+			t.Errorf("%s: expected a[i] %s 2, got %+v", lexeme, op, assign.Value)
+		}
+	}
+	if assign := parseOK(t, "a = 1").Body[0].(*ast.AssignStmt); assign.Op != token.ILLEGAL {
+		t.Errorf("expected no Op on a plain assignment, got %s", assign.Op)
+	}
+}
+
+func TestParsePowerAndBitwise(t *testing.T) {
+	file := parseOK(t, "2 ** 3 ** 2\n-2 ** 2\na | b ^ c & d\n1 + 2 << 3 < 4\n~x & y")
+	expr := func(i int) ast.Expr { return file.Body[i].(*ast.ExprStmt).Expr }
+
+	// ** is right-associative
+	bin := expr(0).(*ast.BinaryExpr)
+	if right, ok := bin.Right.(*ast.BinaryExpr); bin.Op != token.STAR_STAR || !ok || right.Op != token.STAR_STAR {
+		t.Errorf("expected 2 ** (3 ** 2), got %+v", bin)
+	}
+	// ** binds tighter than a prefix minus
+	if unary, ok := expr(1).(*ast.UnaryExpr); !ok || unary.Op != token.MINUS {
+		t.Errorf("expected -(2 ** 2), got %T", expr(1))
+	}
+	// | is loosest, then ^, then &
+	bin = expr(2).(*ast.BinaryExpr)
+	xor, ok := bin.Right.(*ast.BinaryExpr)
+	if bin.Op != token.PIPE || !ok || xor.Op != token.CARET {
+		t.Fatalf("expected a | (b ^ (c & d)), got %+v", bin)
+	}
+	if and, ok := xor.Right.(*ast.BinaryExpr); !ok || and.Op != token.AMP {
+		t.Errorf("expected b ^ (c & d), got %+v", xor)
+	}
+	// shifts sit between comparison and addition
+	bin = expr(3).(*ast.BinaryExpr)
+	shift, ok := bin.Left.(*ast.BinaryExpr)
+	if bin.Op != token.LT || !ok || shift.Op != token.SHL {
+		t.Fatalf("expected ((1 + 2) << 3) < 4, got %+v", bin)
+	}
+	if sum, ok := shift.Left.(*ast.BinaryExpr); !ok || sum.Op != token.PLUS {
+		t.Errorf("expected (1 + 2) << 3, got %+v", shift)
+	}
+	bin = expr(4).(*ast.BinaryExpr)
+	if unary, ok := bin.Left.(*ast.UnaryExpr); bin.Op != token.AMP || !ok || unary.Op != token.TILDE {
+		t.Errorf("expected (~x) & y, got %+v", bin)
+	}
+}
+
 func TestParseIfStmt(t *testing.T) {
 	source := `if (x > 0) {
   print(x)
@@ -145,6 +313,33 @@ func TestParseFuncDecl(t *testing.T) {
 	}
 }
 
+func TestParseDocComment(t *testing.T) {
+	source := `/// Adds two numbers.
+///
+/// Works for floats too.
+function add(a, b) { return a + b }
+
+// Not attached: a blank line follows.
+
+function sub(a, b) { return a - b }
+// Shapes.
+class Shape {
+  // Area in square units.
+  area() { return 0 }
+}`
+	file := parseOK(t, source)
+	if doc := file.Body[0].(*ast.FuncDecl).Doc; doc != "Adds two numbers.\n\nWorks for floats too." {
+		t.Errorf("unexpected doc for add: %q", doc)
+	}
+	if doc := file.Body[1].(*ast.FuncDecl).Doc; doc != "" {
+		t.Errorf("expected no doc for sub, got %q", doc)
+	}
+	cls := file.Body[2].(*ast.ClassDecl)
+	if cls.Doc != "Shapes." || cls.Methods[0].Doc != "Area in square units." {
+		t.Errorf("unexpected class docs: %q, %q", cls.Doc, cls.Methods[0].Doc)
+	}
+}
+
 func TestParseClassDecl(t *testing.T) {
 	source := `class Point {
   constructor(x, y) {
@@ -174,6 +369,158 @@ func TestParseClassDecl(t *testing.T) {
 	}
 }
 
+func TestParseStaticField(t *testing.T) {
+	source := `class Config {
+  static MAX = 100
+  static label
+}`
+	file := parseOK(t, source)
+	cls := file.Body[0].(*ast.ClassDecl)
+	if len(cls.Statics) != 2 {
+		t.Fatalf("expected 2 static fields, got %d", len(cls.Statics))
+	}
+	if cls.Statics[0].Name != "MAX" || cls.Statics[0].Value == nil {
+		t.Errorf("expected MAX with initializer, got %q", cls.Statics[0].Name)
+	}
+	if cls.Statics[1].Name != "label" || cls.Statics[1].Value != nil {
+		t.Errorf("expected label without initializer, got %q", cls.Statics[1].Name)
+	}
+}
+
+func TestParseInstanceFields(t *testing.T) {
+	source := `class Point {
+  x = 0  y = 0
+  /// Free-form label.
+  label
+  constructor() {}
+  norm() { return this.x + this.y }
+}`
+	file := parseOK(t, source)
+	cls := file.Body[0].(*ast.ClassDecl)
+	if len(cls.Props) != 3 || cls.Constructor == nil || len(cls.Methods) != 1 {
+		t.Fatalf("expected 3 fields, a constructor and 1 method, got %+v", cls)
+	}
+	if cls.Props[0].Name != "x" || cls.Props[1].Name != "y" || cls.Props[1].Value == nil {
+		t.Errorf("expected x and y with initializers, got %+v %+v", cls.Props[0], cls.Props[1])
+	}
+	if f := cls.Props[2]; f.Name != "label" || f.Value != nil || f.Doc != "Free-form label." {
+		t.Errorf("expected documented label without initializer, got %+v", f)
+	}
+}
+
+func TestParseAccessors(t *testing.T) {
+	source := `class Rect {
+  get area() { return this.w * this.h }
+  set width(v) { this.w = v }
+  get(key) { return key }
+  set(key, v) {}
+}`
+	file := parseOK(t, source)
+	cls := file.Body[0].(*ast.ClassDecl)
+	if len(cls.Getters) != 1 || cls.Getters[0].Name != "area" {
+		t.Errorf("expected getter area, got %+v", cls.Getters)
+	}
+	if len(cls.Setters) != 1 || cls.Setters[0].Name != "width" || len(cls.Setters[0].Params) != 1 {
+		t.Errorf("expected setter width(v), got %+v", cls.Setters)
+	}
+	if len(cls.Methods) != 2 || cls.Methods[0].Name != "get" || cls.Methods[1].Name != "set" {
+		t.Errorf("expected methods get and set, got %+v", cls.Methods)
+	}
+
+	for _, src := range []string{"class A { get x(v) {} }", "class A { set x() {} }", "class A { set x(...v) {} }"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2003" {
+			t.Errorf("%q: expected E2003, got %v", src, diags)
+		}
+	}
+}
+
+func TestParseGenerators(t *testing.T) {
+	source := `function count(n) {
+  var sent = yield
+  yield n + 1
+  var inner = function() { return 1 }
+}
+function plain() { var f = () => { yield 2 } }
+class Tree { iter() { yield this } }`
+	file := parseOK(t, source)
+	count := file.Body[0].(*ast.FuncDecl)
+	if !count.Generator {
+		t.Errorf("expected count to be a generator")
+	}
+	sent := count.Body.Stmts[0].(*ast.VarDeclStmt).Init.(*ast.YieldExpr)
+	if sent.Value != nil {
+		t.Errorf("expected bare yield, got %+v", sent.Value)
+	}
+	if y := count.Body.Stmts[1].(*ast.ExprStmt).Expr.(*ast.YieldExpr); y.Value == nil {
+		t.Errorf("expected yield with a value")
+	}
+	if inner := count.Body.Stmts[2].(*ast.VarDeclStmt).Init.(*ast.FuncExpr); inner.Generator {
+		t.Errorf("expected inner function not to be a generator")
+	}
+	plain := file.Body[1].(*ast.FuncDecl)
+	if arrow := plain.Body.Stmts[0].(*ast.VarDeclStmt).Init.(*ast.FuncExpr); plain.Generator || !arrow.Generator {
+		t.Errorf("expected only the arrow function to be a generator")
+	}
+	if !file.Body[2].(*ast.ClassDecl).Methods[0].Generator {
+		t.Errorf("expected generator method")
+	}
+
+	for _, src := range []string{"yield 1", "class A { constructor() { yield 1 } }", "class A { get x() { yield 1 } }"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2011" {
+			t.Errorf("%q: expected E2011, got %v", src, diags)
+		}
+	}
+}
+
+func TestParseSpawn(t *testing.T) {
+	file := parseOK(t, "var t = spawn work(1, 2)\nspawn obj.run()")
+	spawn := file.Body[0].(*ast.VarDeclStmt).Init.(*ast.SpawnExpr)
+	if call, ok := spawn.Call.(*ast.CallExpr); !ok || len(call.Args) != 2 {
+		t.Errorf("expected spawn of a call with 2 arguments, got %+v", spawn.Call)
+	}
+	if _, ok := file.Body[1].(*ast.ExprStmt).Expr.(*ast.SpawnExpr).Call.(*ast.CallExpr).Callee.(*ast.MemberExpr); !ok {
+		t.Errorf("expected spawn of a method call")
+	}
+
+	for _, src := range []string{"spawn work", "spawn 1 + 2"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2012" {
+			t.Errorf("%q: expected E2012, got %v", src, diags)
+		}
+	}
+}
+
+func TestParseStaticMethod(t *testing.T) {
+	source := `record Point(x, y) {
+  static const ORIGIN = new Point(0, 0)
+  /// Build a point on the diagonal.
+  static diagonal(n) { return new Point(n, n) }
+  norm() { return this.x + this.y }
+}`
+	file := parseOK(t, source)
+	cls := file.Body[0].(*ast.ClassDecl)
+	if len(cls.Statics) != 1 || !cls.Statics[0].IsConst || cls.Statics[0].Name != "ORIGIN" {
+		t.Errorf("expected static const ORIGIN, got %+v", cls.Statics)
+	}
+	if len(cls.StaticMethods) != 1 || len(cls.Methods) != 1 {
+		t.Fatalf("expected 1 static and 1 instance method, got %d and %d", len(cls.StaticMethods), len(cls.Methods))
+	}
+	if m := cls.StaticMethods[0]; m.Name != "diagonal" || len(m.Params) != 1 || m.Doc != "Build a point on the diagonal." {
+		t.Errorf("unexpected static method %+v", m)
+	}
+
+	tokens, _ := lexer.New("class A { static const MAX }", "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 || diags[0].Code != "E2001" {
+		t.Errorf("expected E2001 for static const without a value, got %v", diags)
+	}
+}
+
 func TestParseCallExpr(t *testing.T) {
 	file := parseOK(t, `print(1, 2, 3)`)
 	stmt, ok := file.Body[0].(*ast.ExprStmt)
@@ -231,6 +578,59 @@ func TestParseAssignment(t *testing.T) {
 	}
 }
 
+func TestParseAssignExpr(t *testing.T) {
+	file := parseOK(t, "a = b = 0\nwhile ((n -= 1) > 0) {}\na, b = b, a\na, b = pair")
+	chain := file.Body[0].(*ast.AssignStmt)
+	inner, ok := chain.Value.(*ast.AssignExpr)
+	if !ok {
+		t.Fatalf("expected AssignExpr value, got %T", chain.Value)
+	}
+	if inner.Target.(*ast.IdentExpr).Name != "b" || inner.Op != token.ILLEGAL {
+		t.Errorf("expected b = 0, got %#v", inner)
+	}
+
+	cond := file.Body[1].(*ast.WhileStmt).Condition.(*ast.BinaryExpr)
+	compound, ok := cond.Left.(*ast.AssignExpr)
+	if !ok || compound.Op != token.MINUS_ASSIGN {
+		t.Fatalf("expected n -= 1 as an AssignExpr, got %#v", cond.Left)
+	}
+	if bin, ok := compound.Value.(*ast.BinaryExpr); !ok || bin.Op != token.MINUS {
+		t.Errorf("expected the value desugared to n - 1, got %#v", compound.Value)
+	}
+
+	swap := file.Body[2].(*ast.AssignStmt)
+	pattern, ok := swap.Target.(*ast.ArrayPattern)
+	if !ok || len(pattern.Elements) != 2 {
+		t.Fatalf("expected a 2-element ArrayPattern target, got %#v", swap.Target)
+	}
+	if values, ok := swap.Value.(*ast.ArrayLiteral); !ok || len(values.Elements) != 2 {
+		t.Errorf("expected a 2-element ArrayLiteral value, got %#v", swap.Value)
+	}
+	if _, ok := file.Body[3].(*ast.AssignStmt).Value.(*ast.IdentExpr); !ok {
+		t.Errorf("expected a single value to be unpacked, got %#v", file.Body[3])
+	}
+
+	file = parseOK(t, "while (x = next()) {}\nf(a = 4)\nvar w = q = 5")
+	if _, ok := file.Body[0].(*ast.WhileStmt).Condition.(*ast.AssignExpr); !ok {
+		t.Errorf("expected x = next() as the while condition, got %#v", file.Body[0])
+	}
+	call := file.Body[1].(*ast.ExprStmt).Expr.(*ast.CallExpr)
+	if _, ok := call.Args[0].(*ast.AssignExpr); !ok {
+		t.Errorf("expected a = 4 as the argument, got %#v", call.Args[0])
+	}
+	if _, ok := file.Body[2].(*ast.VarDeclStmt).Init.(*ast.AssignExpr); !ok {
+		t.Errorf("expected q = 5 as the initializer, got %#v", file.Body[2])
+	}
+
+	for _, source := range []string{"a, b = 1, 2, 3", "x = (a?.b = 1)", "f(a?.b = 1)"} {
+		tokens, _ := lexer.New(source, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2001" {
+			t.Errorf("%s: expected E2001, got %v", source, diags)
+		}
+	}
+}
+
 func TestParseJSONOutput(t *testing.T) {
 	jsonStr := parseToJSON(t, `var x = 1`)
 	// Just make sure it's valid JSON and has the right structure
@@ -260,3 +660,397 @@ var y = 3`
 		t.Fatal("file is nil")
 	}
 }
+
+func TestParseImport(t *testing.T) {
+	file := parseOK(t, `import native "ext"`)
+	stmt, ok := file.Body[0].(*ast.ImportStmt)
+	if !ok {
+		t.Fatalf("expected ImportStmt, got %T", file.Body[0])
+	}
+	if !stmt.Native || stmt.Path != "ext" {
+		t.Errorf("expected native import of 'ext', got native=%v path=%q", stmt.Native, stmt.Path)
+	}
+
+	file = parseOK(t, `import "./util.lt"`)
+	stmt = file.Body[0].(*ast.ImportStmt)
+	if stmt.Native || stmt.Path != "./util.lt" {
+		t.Errorf("expected module import of './util.lt', got native=%v path=%q", stmt.Native, stmt.Path)
+	}
+
+	tokens, _ := lexer.New(`import util`, "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 || diags[0].Code != "E2006" {
+		t.Errorf("expected E2006 for import without a path string, got %v", diags)
+	}
+
+	file = parseOK(t, `import notes from "notes.txt" as text`)
+	stmt = file.Body[0].(*ast.ImportStmt)
+	if stmt.Name != "notes" || stmt.Path != "notes.txt" || stmt.As != "text" {
+		t.Errorf("expected data import of notes.txt as text, got name=%q path=%q as=%q", stmt.Name, stmt.Path, stmt.As)
+	}
+
+	tokens, _ = lexer.New(`import cfg from "cfg.yaml" as yaml`, "test.lt").Tokenize()
+	_, diags = New(tokens).ParseFile()
+	if len(diags) == 0 || diags[0].Code != "E2007" {
+		t.Errorf("expected E2007 for an unknown import format, got %v", diags)
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	file := parseOK(t, "record Point(x, y) implements Shape {\n  area() { return 0 }\n}\nrecord Unit()")
+	decl, ok := file.Body[0].(*ast.ClassDecl)
+	if !ok {
+		t.Fatalf("expected ClassDecl, got %T", file.Body[0])
+	}
+	if !decl.Record || decl.Name != "Point" || len(decl.Fields) != 2 || decl.Fields[1] != "y" {
+		t.Errorf("expected record Point(x, y), got record=%v name=%q fields=%v", decl.Record, decl.Name, decl.Fields)
+	}
+	if len(decl.Implements) != 1 || len(decl.Methods) != 1 {
+		t.Errorf("expected 1 interface and 1 method, got %v and %d", decl.Implements, len(decl.Methods))
+	}
+	if unit := file.Body[1].(*ast.ClassDecl); !unit.Record || len(unit.Fields) != 0 {
+		t.Errorf("expected empty record Unit, got %+v", unit)
+	}
+
+	tokens, _ := lexer.New("record P(x) {\n  constructor() {}\n}", "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 || diags[0].Code != "E2003" {
+		t.Errorf("expected E2003 for a constructor in a record, got %v", diags)
+	}
+}
+
+func TestParseForOfPair(t *testing.T) {
+	file := parseOK(t, "for (var i, v of xs) {}\nfor (var x of xs) {}")
+	if loop := file.Body[0].(*ast.ForOfStmt); loop.KeyName != "i" || loop.VarName != "v" {
+		t.Errorf("expected i, v, got %+v", loop)
+	}
+	if loop := file.Body[1].(*ast.ForOfStmt); loop.KeyName != "" || loop.VarName != "x" {
+		t.Errorf("expected x, got %+v", loop)
+	}
+
+	tokens, _ := lexer.New("for (var k, k of xs) {}", "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 || diags[0].Code != "E2009" {
+		t.Errorf("expected E2009 for a repeated name, got %v", diags)
+	}
+}
+
+func TestParseRestAndSpread(t *testing.T) {
+	file := parseOK(t, "function f(a, ...rest) {}\nvar g = (...xs) => xs\nf(1, ...[2, 3])\nnew P(...args)")
+	if fn := file.Body[0].(*ast.FuncDecl); !fn.Rest || len(fn.Params) != 2 || ast.FormatParams(fn.Params, fn.Rest) != "a, ...rest" {
+		t.Errorf("expected rest parameter, got %+v", fn)
+	}
+	if fn := file.Body[1].(*ast.VarDeclStmt).Init.(*ast.FuncExpr); !fn.Rest || len(fn.Params) != 1 {
+		t.Errorf("expected arrow rest parameter, got %+v", fn)
+	}
+	call := file.Body[2].(*ast.ExprStmt).Expr.(*ast.CallExpr)
+	if _, ok := call.Args[1].(*ast.SpreadExpr); !ok || len(call.Args) != 2 {
+		t.Errorf("expected spread argument, got %+v", call.Args)
+	}
+	if _, ok := file.Body[3].(*ast.ExprStmt).Expr.(*ast.NewExpr).Args[0].(*ast.SpreadExpr); !ok {
+		t.Errorf("expected spread constructor argument")
+	}
+
+	for _, src := range []string{"function f(...a, b) {}", "record R(...xs)"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2010" {
+			t.Errorf("%q: expected E2010, got %v", src, diags)
+		}
+	}
+}
+
+func TestParseDestructuring(t *testing.T) {
+	file := parseOK(t, "var [a, [b, c], ...rest] = xs\nconst {x, y: why} = point\n[a, m.k, arr[0]] = [1, 2, 3]\n{x} = point\nfor (var [k, v] of pairs) {}\nfor (var [i] = [0]; i < 1; i += 1) {}\n{ print(1) }")
+	decl := file.Body[0].(*ast.VarDeclStmt)
+	if _, ok := decl.Pattern.(*ast.ArrayPattern); !ok || strings.Join(decl.Names, ",") != "a,b,c,rest" || decl.Name != "a" {
+		t.Errorf("expected array pattern declaring a, b, c, rest, got %+v", decl)
+	}
+	mp, ok := file.Body[1].(*ast.VarDeclStmt).Pattern.(*ast.MapPattern)
+	if !ok || strings.Join(mp.Keys, ",") != "x,y" || mp.Values[1].(*ast.IdentExpr).Name != "why" {
+		t.Errorf("expected map pattern {x, y: why}, got %+v", mp)
+	}
+	if target, ok := file.Body[2].(*ast.AssignStmt).Target.(*ast.ArrayPattern); !ok || len(target.Elements) != 3 {
+		t.Errorf("expected array pattern assignment, got %+v", file.Body[2])
+	}
+	if _, ok := file.Body[3].(*ast.AssignStmt).Target.(*ast.MapPattern); !ok {
+		t.Errorf("expected map pattern assignment, got %+v", file.Body[3])
+	}
+	if loop, ok := file.Body[4].(*ast.ForOfStmt); !ok || loop.Pattern == nil {
+		t.Errorf("expected for-of with a pattern, got %+v", file.Body[4])
+	}
+	if loop, ok := file.Body[5].(*ast.ForStmt); !ok || loop.Init.(*ast.VarDeclStmt).Pattern == nil {
+		t.Errorf("expected C-style for with a pattern, got %+v", file.Body[5])
+	}
+	if _, ok := file.Body[6].(*ast.BlockStmt); !ok {
+		t.Errorf("expected a block, got %T", file.Body[6])
+	}
+
+	for _, tc := range []struct{ src, code string }{
+		{"var [...a, b] = xs", "E2010"},
+		{"var [a, b]", "E2001"},
+		{"[a + 1] = xs", "E2001"},
+	} {
+		tokens, _ := lexer.New(tc.src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != tc.code {
+			t.Errorf("%q: expected %s, got %v", tc.src, tc.code, diags)
+		}
+	}
+}
+
+func TestParseOptionalChaining(t *testing.T) {
+	file := parseOK(t, "a?.b.c\nf?.(1)\nxs?.[0]\nx ?? y || z\na instanceof B == true")
+	member := file.Body[0].(*ast.ExprStmt).Expr.(*ast.MemberExpr)
+	if inner, ok := member.Object.(*ast.MemberExpr); member.Optional || !ok || !inner.Optional {
+		t.Errorf("expected a?.b.c with an optional first link, got %+v", member)
+	}
+	if call := file.Body[1].(*ast.ExprStmt).Expr.(*ast.CallExpr); !call.Optional || len(call.Args) != 1 {
+		t.Errorf("expected optional call, got %+v", call)
+	}
+	if index := file.Body[2].(*ast.ExprStmt).Expr.(*ast.IndexExpr); !index.Optional {
+		t.Errorf("expected optional index, got %+v", index)
+	}
+	// ?? binds looser than ||, instanceof as tightly as <
+	bin := file.Body[3].(*ast.ExprStmt).Expr.(*ast.BinaryExpr)
+	if right, ok := bin.Right.(*ast.BinaryExpr); bin.Op != token.QUESTION_QUESTION || !ok || right.Op != token.OR {
+		t.Errorf("expected x ?? (y || z), got %+v", bin)
+	}
+	bin = file.Body[4].(*ast.ExprStmt).Expr.(*ast.BinaryExpr)
+	if left, ok := bin.Left.(*ast.BinaryExpr); bin.Op != token.EQ || !ok || left.Op != token.KW_INSTANCEOF {
+		t.Errorf("expected (a instanceof B) == true, got %+v", bin)
+	}
+
+	for _, src := range []string{"a?.b = 1", "a?.b.c += 1", "[a?.b] = [1]"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Message != "cannot assign to an optional chain" {
+			t.Errorf("%q: expected an optional chain assignment error, got %v", src, diags)
+		}
+	}
+}
+
+func TestParseExport(t *testing.T) {
+	file := parseOK(t, "/// Adds one.\nexport function inc(x) { return x + 1 }\nexport var a, b = [1, 2]\nexport record P(x)\nvar hidden = 0")
+	fn, ok := file.Body[0].(*ast.FuncDecl)
+	if !ok || !fn.Exported || fn.Doc != "Adds one." || fn.Span.Start.Column != 1 {
+		t.Errorf("expected exported inc with doc, got %+v", file.Body[0])
+	}
+	if v := file.Body[1].(*ast.VarDeclStmt); !v.Exported || len(v.Names) != 2 {
+		t.Errorf("expected exported a, b, got %+v", v)
+	}
+	if rec := file.Body[2].(*ast.ClassDecl); !rec.Exported || !rec.Record {
+		t.Errorf("expected exported record, got %+v", rec)
+	}
+	if v := file.Body[3].(*ast.VarDeclStmt); v.Exported {
+		t.Errorf("expected hidden not to be exported")
+	}
+
+	for _, src := range []string{"export print(1)", "function f() {\n  export var x = 1\n}"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2008" {
+			t.Errorf("%q: expected E2008, got %v", src, diags)
+		}
+	}
+}
+
+func TestBinaryASTRoundTrip(t *testing.T) {
+	// Programs with golden output are known to parse cleanly
+	expected, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*.expected"))
+	if err != nil || len(expected) == 0 {
+		t.Fatalf("no testdata programs found: %v", err)
+	}
+	for _, exp := range expected {
+		path := strings.TrimSuffix(exp, ".expected") + ".lt"
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := parseOK(t, string(source))
+		data, err := ast.EncodeBinary(file)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", path, err)
+		}
+		decoded, err := ast.DecodeBinary(data)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", path, err)
+		}
+		want, _ := json.Marshal(ast.NodeToMap(file))
+		got, _ := json.Marshal(ast.NodeToMap(decoded))
+		if string(want) != string(got) {
+			t.Errorf("%s: AST changed after binary round trip", path)
+		}
+		if _, err := ast.DecodeBinary(data[:len(data)-1]); err == nil {
+			t.Errorf("%s: expected error decoding truncated data", path)
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	cases := map[string]bool{
+		"var x = 1\n":         false,
+		"function f() {\n":    true,
+		"print(1,\n":          true,
+		"var s = \"{\"\n":     false, // brace inside a string
+		"var t = `a ${x} {\n": true,  // unterminated template
+		"var t = `}`\n":       false,
+		"class A {\n  m() {\n    return 1\n  }\n": true,
+		"var = 1\n":           false, // error before the end
+		"x +\n":               true,
+		"/* off\nvar y = 2\n": true, // unterminated block comment
+		"var x = 1 /* c */\n": false,
+	}
+	for source, want := range cases {
+		if got := Incomplete(source); got != want {
+			t.Errorf("Incomplete(%q) = %v, want %v", source, got, want)
+		}
+	}
+}
+
+func TestParseDanglingOperator(t *testing.T) {
+	// A dangling operator once dereferenced a nil operand
+	tokens, _ := lexer.New("x +", "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 {
+		t.Fatal("expected diagnostics for dangling operator")
+	}
+}
+
+func TestParseMatchArmRecovery(t *testing.T) {
+	// An arm that starts with a statement keyword used to stall the parser
+	source := "match (1) {\n  if\n  case 1 => print(1)\n}\n"
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	_, diags := New(tokens).ParseFile()
+	if len(diags) == 0 {
+		t.Fatal("expected diagnostics for malformed arm")
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	programs, _ := filepath.Glob(filepath.Join("..", "..", "testdata", "*.lt"))
+	for _, path := range programs {
+		if data, err := os.ReadFile(path); err == nil {
+			f.Add(string(data))
+		}
+	}
+	f.Add("match (x) { case a => b\n _ => c }")
+	f.Add("var t = `a ${b + `c ${d}`} e`")
+
+	f.Fuzz(func(t *testing.T, source string) {
+		tokens, _ := lexer.New(source, "fuzz.lt").Tokenize()
+		file, diags := New(tokens).ParseFile()
+		if file == nil {
+			t.Fatal("ParseFile returned a nil file")
+		}
+		for _, d := range diags {
+			if d.Code == "E2000" {
+				t.Fatal(d.Message)
+			}
+		}
+	})
+}
+
+func TestDocumentApplyReusesDeclarations(t *testing.T) {
+	source := "function a() {\n  return 1\n}\n\nfunction b() {\n  return 2\n}\n\nfunction c() {\n  return 3\n}\n"
+	doc := ParseDocument(source, "test.lt")
+	edit := strings.Index(source, "2")
+	next := doc.Apply(lexer.Edit{Start: edit, End: edit + 1, Text: "20 +\n    2"})
+
+	if next.File.Body[0] != doc.File.Body[0] {
+		t.Error("declaration before the edit was reparsed")
+	}
+	if next.File.Body[1] == doc.File.Body[1] {
+		t.Error("edited declaration was reused")
+	}
+	want, _ := New(next.Lex.Tokens).ParseFile()
+	if !reflect.DeepEqual(next.File, want) {
+		t.Errorf("incremental tree differs from a full parse")
+	}
+}
+
+func TestDocumentApplyDocComment(t *testing.T) {
+	source := "// Old.\nfunction a() {}\n"
+	doc := ParseDocument(source, "test.lt")
+	next := doc.Apply(lexer.Edit{Start: 3, End: 6, Text: "New"})
+	if fn := next.File.Body[0].(*ast.FuncDecl); fn.Doc != "New." {
+		t.Errorf("expected the edited doc comment, got %q", fn.Doc)
+	}
+}
+
+func TestDocumentApplyRandom(t *testing.T) {
+	programs, _ := filepath.Glob(filepath.Join("..", "..", "testdata", "*.lt"))
+	fragments := []string{"", "\n", "x", "}", "{", "(", ")", "`", "${", "\"", "else", "if (a) {", "=>", "\n\n", "class", "// "}
+	rng := rand.New(rand.NewSource(1))
+	for _, path := range programs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := ParseDocument(string(data), "test.lt")
+		for n := 0; n < 30; n++ {
+			source := doc.Lex.Source
+			start := rng.Intn(len(source) + 1)
+			end := start + rng.Intn(min(10, len(source)-start)+1)
+			e := lexer.Edit{Start: start, End: end, Text: fragments[rng.Intn(len(fragments))]}
+			doc = doc.Apply(e)
+			want, diags := New(lexer.Scan(doc.Lex.Source, "test.lt").Tokens).ParseFile()
+			if !reflect.DeepEqual(doc.File, want) || !reflect.DeepEqual(doc.Diags, diags) {
+				t.Fatalf("%s: edit %+v diverged from a full parse", path, e)
+			}
+		}
+	}
+}
+
+func TestParseBadNodes(t *testing.T) {
+	cases := map[string]string{
+		"print(1 +)\n":   "BadExpr",
+		"var = 1\n":      "BadStmt",
+		"if x { }\n":     "BadStmt",
+		"function () {}": "BadStmt",
+		") + 1\n":        "BadStmt",
+	}
+	for source, kind := range cases {
+		tokens, _ := lexer.New(source, "test.lt").Tokenize()
+		file, diags := New(tokens).ParseFile()
+		if len(diags) == 0 {
+			t.Errorf("%q: expected diagnostics", source)
+		}
+		data, _ := json.Marshal(ast.NodeToMap(file))
+		if !strings.Contains(string(data), `"kind":"`+kind+`"`) {
+			t.Errorf("%q: expected a %s node, got %s", source, kind, data)
+		}
+	}
+}
+
+func TestParseAsync(t *testing.T) {
+	file := parseOK(t, "async function f(x) { return await g(x) }\nvar h = async (a, b) => await a\nvar k = async x => x\nclass C { async m() { await 1 } static async s() {} }\nawait f(1)")
+	decl := file.Body[0].(*ast.FuncDecl)
+	if !decl.Async || decl.Generator {
+		t.Errorf("expected an async function, got %+v", decl)
+	}
+	ret := decl.Body.Stmts[0].(*ast.ReturnStmt)
+	if _, ok := ret.Value.(*ast.AwaitExpr).Value.(*ast.CallExpr); !ok {
+		t.Errorf("expected await of a call, got %+v", ret.Value)
+	}
+	for idx := 1; idx <= 2; idx++ {
+		if fn := file.Body[idx].(*ast.VarDeclStmt).Init.(*ast.FuncExpr); !fn.Async {
+			t.Errorf("statement %d: expected an async arrow", idx)
+		}
+	}
+	class := file.Body[3].(*ast.ClassDecl)
+	if !class.Methods[0].Async || class.Methods[0].Name != "m" || !class.StaticMethods[0].Async {
+		t.Errorf("expected async methods, got %+v", class)
+	}
+	if _, ok := file.Body[4].(*ast.ExprStmt).Expr.(*ast.AwaitExpr); !ok {
+		t.Errorf("expected a top-level await")
+	}
+
+	for _, src := range []string{"function f() { await g() }", "async function f() { yield 1 }", "var x = async 5"} {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		_, diags := New(tokens).ParseFile()
+		if len(diags) == 0 || diags[0].Code != "E2013" {
+			t.Errorf("%q: expected E2013, got %v", src, diags)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+)
+
+// ============================================================
+// Getters and setters
+// ============================================================
+
+// findAccessor walks the class inheritance chain to find the getter, or
+// with setter set the setter, for property name.
+func findAccessor(cls *ClassVal, name string, setter bool) (*ast.MethodDecl, *ClassVal) {
+	for cls != nil {
+		accessors := cls.Decl.Getters
+		if setter {
+			accessors = cls.Decl.Setters
+		}
+		for _, m := range accessors {
+			if m.Name == name {
+				return m, cls
+			}
+		}
+		cls = cls.Super
+	}
+	return nil, nil
+}
+
+// getter reads obj.name through a getter. ok is false if obj is not an
+// object whose class declares one, and the property should be read as usual.
+func (i *Interpreter) getter(obj Value, name string, s span.Span) (val Value, ok bool, err error) {
+	o, isObj := obj.(*ObjectVal)
+	if !isObj {
+		return nil, false, nil
+	}
+	method, cls := findAccessor(o.Class, name, false)
+	if method == nil {
+		return nil, false, nil
+	}
+	val, err = i.runMethod(o, cls, method, nil, s)
+	return val, true, err
+}
+
+// setter assigns obj.name = val through a setter. ok is false if obj is not
+// an object whose class declares an accessor for name, and the property
+// should be assigned as usual; a property with only a getter is read-only.
+func (i *Interpreter) setter(obj Value, name string, val Value, s span.Span) (ok bool, err error) {
+	o, isObj := obj.(*ObjectVal)
+	if !isObj {
+		return false, nil
+	}
+	method, cls := findAccessor(o.Class, name, true)
+	if method == nil {
+		if getter, _ := findAccessor(o.Class, name, false); getter != nil {
+			return true, runtimeErr(s, "property '%s' of class '%s' has a getter but no setter", name, o.Class.Decl.Name)
+		}
+		return false, nil
+	}
+	_, err = i.runMethod(o, cls, method, []Value{val}, s)
+	return true, err
+}
@@ -0,0 +1,91 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"strings"
+)
+
+// ============================================================
+// Assertions (assert / assertEquals / fail)
+// ============================================================
+
+// AssertionError is what a failing assert(), assertEquals() or fail()
+// returns. The call that ran it throws it as an AssertionError object at the
+// call site, so scripts can catch it and uncaught failures show a position.
+type AssertionError struct {
+	Message string
+}
+
+func (e *AssertionError) Error() string { return "AssertionError: " + e.Message }
+
+// ThrowAssertion turns failed, returned by a builtin called at s with
+// the calls in stack active, into a thrown AssertionError.
+func (i *Interpreter) ThrowAssertion(failed *AssertionError, s span.Span, stack []Frame) *ThrownError {
+	return throwValue(i.newError("AssertionError", failed.Message, ""), s, stack)
+}
+
+// throwValue makes the error for throwing val at s, filling in the stack
+// of an Error object that has none yet.
+func throwValue(val Value, s span.Span, stack []Frame) *ThrownError {
+	thrown := &ThrownError{Value: val, Span: s, Stack: append([]Frame(nil), stack...)}
+	if obj, ok := val.(*ObjectVal); ok && isError(obj) && obj.Props["stack"] == StringVal("") {
+		obj.Props["stack"] = StringVal(strings.TrimSuffix(thrown.StackTrace(), "\n"))
+	}
+	return thrown
+}
+
+// registerAssertBuiltins adds assert(), assertEquals() and fail().
+func (i *Interpreter) registerAssertBuiltins() {
+	i.global.Define("assert", &BuiltinVal{
+		Name:      "assert",
+		Signature: "assert(condition, message?)",
+		Doc:       "Throw an AssertionError with message if condition is falsy.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("assert() expects 1-2 arguments, got %d", len(args))
+			}
+			if IsTruthy(args[0]) {
+				return NullVal{}, nil
+			}
+			if len(args) == 2 {
+				return nil, &AssertionError{Message: args[1].String()}
+			}
+			return nil, &AssertionError{Message: "assertion failed"}
+		},
+	}, true)
+
+	i.global.Define("assertEquals", &BuiltinVal{
+		Name:      "assertEquals",
+		Signature: "assertEquals(actual, expected, message?)",
+		Doc:       "Throw an AssertionError unless actual equals expected, comparing arrays, maps, sets and objects by content.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("assertEquals() expects 2-3 arguments, got %d", len(args))
+			}
+			if deepEqual(args[0], args[1], make(map[[2]Value]bool)) {
+				return NullVal{}, nil
+			}
+			msg := fmt.Sprintf("expected %s, got %s", formatElement(args[1], make(map[Value]bool)), formatElement(args[0], make(map[Value]bool)))
+			if len(args) == 3 {
+				msg = args[2].String() + ": " + msg
+			}
+			return nil, &AssertionError{Message: msg}
+		},
+	}, true)
+
+	i.global.Define("fail", &BuiltinVal{
+		Name:      "fail",
+		Signature: "fail(message?)",
+		Doc:       "Throw an AssertionError with message, for code that should not be reached.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) > 1 {
+				return nil, fmt.Errorf("fail() expects 0-1 arguments, got %d", len(args))
+			}
+			if len(args) == 1 {
+				return nil, &AssertionError{Message: args[0].String()}
+			}
+			return nil, &AssertionError{Message: "fail() called"}
+		},
+	}, true)
+}
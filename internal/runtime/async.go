@@ -0,0 +1,502 @@
+package runtime
+
+import (
+	"container/heap"
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Promises, async functions and the event loop
+// ============================================================
+//
+// Calling an async function returns a promise and starts the body the way
+// a generator runs: on its own goroutine, in lockstep with the caller, up
+// to the first await of a pending promise. await hands that promise back
+// and the body is resumed by a job once the promise settles. Jobs, the
+// completions of I/O running on other goroutines (delay, fs.readFileAsync,
+// http.fetch) and timers all run on the event loop, one at a time, so
+// script code never runs concurrently with itself. At the top level,
+// outside any function, await runs the event loop until its promise
+// settles; RunEventLoop runs it until nothing is left to do.
+
+// PromiseVal is the eventual result of an async function or async builtin.
+type PromiseVal struct {
+	state   promiseState
+	value   Value // once fulfilled
+	err     error // once rejected
+	handled bool  // awaited or chained, so a rejection is not lost
+	waiters []func() error
+	loop    *eventLoop
+}
+
+func (v *PromiseVal) TypeName() string { return "promise" }
+func (v *PromiseVal) String() string {
+	switch v.state {
+	case promiseFulfilled:
+		return fmt.Sprintf("<promise fulfilled: %s>", v.value)
+	case promiseRejected:
+		return "<promise rejected>"
+	}
+	return "<promise pending>"
+}
+
+type promiseState int
+
+const (
+	promisePending promiseState = iota
+	promiseFulfilled
+	promiseRejected
+)
+
+// resolve fulfills p with v, or when v is a promise, settles p the same
+// way once v settles.
+func (p *PromiseVal) resolve(v Value) {
+	if q, ok := v.(*PromiseVal); ok {
+		q.onSettle(func() error {
+			p.settle(q.value, q.err)
+			return nil
+		})
+		return
+	}
+	p.settle(v, nil)
+}
+
+// reject settles p with err.
+func (p *PromiseVal) reject(err error) {
+	p.settle(nil, err)
+}
+
+// settle records the outcome of p and queues the jobs waiting for it.
+// Only the first call has an effect.
+func (p *PromiseVal) settle(v Value, err error) {
+	if p.state != promisePending {
+		return
+	}
+	if err != nil {
+		p.state, p.err = promiseRejected, err
+		if !p.handled {
+			p.loop.rejected = append(p.loop.rejected, p)
+		}
+	} else {
+		p.state, p.value = promiseFulfilled, v
+	}
+	for _, job := range p.waiters {
+		p.loop.queue(job)
+	}
+	p.waiters = nil
+}
+
+// onSettle queues job once p has settled, right away if it already has.
+func (p *PromiseVal) onSettle(job func() error) {
+	p.handled = true
+	if p.state == promisePending {
+		p.waiters = append(p.waiters, job)
+		return
+	}
+	p.loop.queue(job)
+}
+
+// eventLoop holds the work waiting to run on the interpreter's goroutine.
+// Operations running elsewhere call start before they begin and post
+// their completion, which wakes the loop.
+type eventLoop struct {
+	mu       sync.Mutex
+	jobs     []func() error
+	pending  int           // operations started but not yet posted
+	wake     chan struct{} // signalled by post
+	rejected []*PromiseVal // promises rejected before anything handled them
+}
+
+func newEventLoop() *eventLoop {
+	return &eventLoop{wake: make(chan struct{}, 1)}
+}
+
+func (l *eventLoop) newPromise() *PromiseVal {
+	return &PromiseVal{loop: l}
+}
+
+// queue adds a job to run after the ones already queued.
+func (l *eventLoop) queue(job func() error) {
+	l.mu.Lock()
+	l.jobs = append(l.jobs, job)
+	l.mu.Unlock()
+}
+
+// start records an operation that will finish with post.
+func (l *eventLoop) start() {
+	l.mu.Lock()
+	l.pending++
+	l.mu.Unlock()
+}
+
+// post queues the completion of an operation from any goroutine.
+func (l *eventLoop) post(job func() error) {
+	l.mu.Lock()
+	l.pending--
+	l.jobs = append(l.jobs, job)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes the first queued job, returning nil if there is none, and
+// reports how many operations are still running.
+func (l *eventLoop) next() (job func() error, pending int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.jobs) > 0 {
+		job = l.jobs[0]
+		l.jobs = l.jobs[1:]
+	}
+	return job, l.pending
+}
+
+// unhandledRejection returns the error of the first rejected promise that
+// nothing awaited or chained.
+func (l *eventLoop) unhandledRejection() error {
+	for _, p := range l.rejected {
+		if !p.handled {
+			return p.err
+		}
+	}
+	return nil
+}
+
+// runLoop runs jobs and timers until done reports true, exit() is called,
+// or nothing is left to run. A nil done runs until idle.
+func (i *Interpreter) runLoop(done func() bool) error {
+	for !i.exited && (done == nil || !done()) {
+		if err := i.interrupted(span.Span{}); err != nil {
+			return err
+		}
+		job, pending := i.loop.next()
+		if job != nil {
+			if err := job(); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(i.timers) == 0 && pending == 0 {
+			return nil
+		}
+
+		// Nothing to run yet: fire the next timer, or sleep until it is
+		// due, an operation posts, or the deadline passes
+		wait := time.Duration(-1)
+		if len(i.timers) > 0 {
+			next := i.timers[0]
+			if pending == 0 && !i.deadline.IsZero() && next.due.After(i.deadline) {
+				return runtimeErr(span.Span{}, "timeout of %s exceeded", i.limits.Timeout)
+			}
+			if wait = time.Until(next.due); wait <= 0 {
+				if err := i.fireTimer(heap.Pop(&i.timers).(*timer)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !i.deadline.IsZero() && (wait < 0 || time.Until(i.deadline) < wait) {
+			wait = max(time.Until(i.deadline), 0)
+		}
+		if err := i.sleepUntilWoken(wait); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepUntilWoken waits for an operation to post or for wait to pass. A
+// negative wait has no limit. It fails once the deadline has passed or the
+// run is interrupted.
+func (i *Interpreter) sleepUntilWoken(wait time.Duration) error {
+	var timeout <-chan time.Time
+	if wait >= 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-i.loop.wake:
+	case <-timeout:
+	case <-i.interrupt.Done():
+		return i.interrupted(span.Span{})
+	}
+	if !i.deadline.IsZero() && !time.Now().Before(i.deadline) {
+		return runtimeErr(span.Span{}, "timeout of %s exceeded", i.limits.Timeout)
+	}
+	return nil
+}
+
+// startAsync runs an async function body in env until it first waits and
+// returns the promise of its result.
+func (i *Interpreter) startAsync(name string, body *ast.BlockStmt, env *Environment) (Value, error) {
+	p := i.loop.newPromise()
+	g := i.newGenerator(name, body, env)
+	return p, i.stepAsync(g, p, generatorResume{})
+}
+
+// stepAsync resumes the body of an async function with msg. When the body
+// waits on another promise, the next step is queued for when that settles;
+// when it ends, p settles with its result.
+func (i *Interpreter) stepAsync(g *GeneratorVal, p *PromiseVal, msg generatorResume) error {
+	y, err := i.resumeGenerator(g, msg, span.Span{})
+	switch {
+	case err != nil:
+		if uncatchable(err) {
+			return err
+		}
+		p.reject(err)
+	case y.done:
+		p.resolve(y.value)
+	default:
+		awaited := y.value.(*PromiseVal)
+		awaited.onSettle(func() error {
+			return i.stepAsync(g, p, generatorResume{value: awaited.value, err: awaited.err})
+		})
+	}
+	return nil
+}
+
+// evalAwait waits for a promise and evaluates to its value, or fails with
+// its error. Awaiting any other value evaluates to the value.
+func (i *Interpreter) evalAwait(e *ast.AwaitExpr) (Value, error) {
+	val, err := i.evalExpr(e.Value)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := val.(*PromiseVal)
+	if !ok {
+		return val, nil
+	}
+	p.handled = true
+	if p.state == promisePending {
+		if g := i.generator; g != nil {
+			// Inside an async function: suspend until stepAsync resumes us
+			g.yield <- generatorYield{value: p}
+			msg := <-g.resume
+			if msg.close {
+				return nil, generatorClosed{}
+			}
+			return msg.value, msg.err
+		}
+		if err := i.runLoop(func() bool { return p.state != promisePending }); err != nil {
+			return nil, err
+		}
+		if p.state == promisePending {
+			if i.exited {
+				return nil, &ExitError{Code: i.exitCode}
+			}
+			return nil, runtimeErr(e.GetSpan(), "await on a promise that can never settle: nothing else is left to run")
+		}
+	}
+	return p.value, p.err
+}
+
+// goAsync runs fn on its own goroutine and returns a promise of its result.
+// fn must not touch script values that the script can still change.
+func (i *Interpreter) goAsync(fn func() (Value, error)) *PromiseVal {
+	p := i.loop.newPromise()
+	i.loop.start()
+	go func() {
+		val, err := fn()
+		i.loop.post(func() error {
+			if err != nil {
+				p.reject(err)
+			} else {
+				p.resolve(val)
+			}
+			return nil
+		})
+	}()
+	return p
+}
+
+// registerAsyncBuiltins adds delay and the Promise namespace.
+func (i *Interpreter) registerAsyncBuiltins() {
+	i.global.Define("delay", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "delay",
+			Signature: "delay(ms, value?)",
+			Doc:       "Return a promise fulfilled with value (default null) after ms milliseconds, e.g. await delay(100).",
+			Fn: func(args []Value) (Value, error) {
+				if len(args) < 1 || len(args) > 2 {
+					return nil, fmt.Errorf("delay() expects 1-2 arguments, got %d", len(args))
+				}
+				ms, ok := args[0].(IntVal)
+				if !ok {
+					return nil, fmt.Errorf("delay() expects an integer number of milliseconds, got '%s'", args[0].TypeName())
+				}
+				var val Value = NullVal{}
+				if len(args) == 2 {
+					val = args[1]
+				}
+				p := i.loop.newPromise()
+				i.loop.start()
+				time.AfterFunc(time.Duration(max(ms, 0))*time.Millisecond, func() {
+					i.loop.post(func() error {
+						p.resolve(val)
+						return nil
+					})
+				})
+				return p, nil
+			},
+		}
+	}), true)
+
+	i.defineNamespace("Promise", "Functions combining promises, e.g. await Promise.all([a(), b()]).", map[string]Value{
+		"all": perInterp(i, func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      "Promise.all",
+				Signature: "Promise.all(promises)",
+				Doc:       "Return a promise of the array of the values of promises, rejected as soon as one of them is.",
+				Fn: func(args []Value) (Value, error) {
+					items, err := promiseArgs("Promise.all", args)
+					if err != nil {
+						return nil, err
+					}
+					all := i.loop.newPromise()
+					values := make([]Value, len(items))
+					left := len(items)
+					if left == 0 {
+						all.resolve(&ArrayVal{Elements: values})
+					}
+					for idx, item := range items {
+						p, ok := item.(*PromiseVal)
+						if !ok {
+							p = i.loop.newPromise()
+							p.resolve(item)
+						}
+						p.onSettle(func() error {
+							if p.err != nil {
+								all.reject(p.err)
+								return nil
+							}
+							values[idx] = p.value
+							if left--; left == 0 {
+								all.resolve(&ArrayVal{Elements: values})
+							}
+							return nil
+						})
+					}
+					return all, nil
+				},
+			}
+		}),
+		"race": perInterp(i, func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      "Promise.race",
+				Signature: "Promise.race(promises)",
+				Doc:       "Return a promise that settles like the first of promises to settle.",
+				Fn: func(args []Value) (Value, error) {
+					items, err := promiseArgs("Promise.race", args)
+					if err != nil {
+						return nil, err
+					}
+					first := i.loop.newPromise()
+					for _, item := range items {
+						first.resolve(item)
+					}
+					return first, nil
+				},
+			}
+		}),
+		"resolve": perInterp(i, func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      "Promise.resolve",
+				Signature: "Promise.resolve(value)",
+				Doc:       "Return a promise fulfilled with value, or value itself if it is a promise.",
+				Fn: func(args []Value) (Value, error) {
+					if len(args) != 1 {
+						return nil, fmt.Errorf("Promise.resolve() expects 1 argument, got %d", len(args))
+					}
+					if p, ok := args[0].(*PromiseVal); ok {
+						return p, nil
+					}
+					p := i.loop.newPromise()
+					p.resolve(args[0])
+					return p, nil
+				},
+			}
+		}),
+	})
+}
+
+// promiseArgs checks that fn got a single array and returns its elements.
+func promiseArgs(fn string, args []Value) ([]Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s() expects 1 argument, got %d", fn, len(args))
+	}
+	arr, ok := args[0].(*ArrayVal)
+	if !ok {
+		return nil, fmt.Errorf("%s() expects an array of promises, got '%s'", fn, args[0].TypeName())
+	}
+	return append([]Value(nil), arr.Elements...), nil
+}
+
+// callPromiseMethod dispatches methods on a promise.
+func (i *Interpreter) callPromiseMethod(p *PromiseVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "then":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, runtimeErr(s, "then() expects 1-2 arguments, got %d", len(args))
+		}
+		// Either handler may be null to pass that outcome through
+		handlers := [2]Value{}
+		for idx, fn := range args {
+			switch fn.(type) {
+			case NullVal:
+			case *FuncVal, *BuiltinVal, Callable:
+				handlers[idx] = fn
+			default:
+				return nil, runtimeErr(s, "then() expects functions or null, got '%s'", fn.TypeName())
+			}
+		}
+		return i.chainPromise(p, handlers[0], handlers[1], s), nil
+
+	case "done":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "done() expects 0 arguments, got %d", len(args))
+		}
+		return BoolVal(p.state != promisePending), nil
+
+	default:
+		return nil, runtimeErr(s, "promise has no method '%s'", name)
+	}
+}
+
+// chainPromise returns a promise of the result of calling onFulfilled with
+// p's value or onRejected with its caught error. A missing handler passes
+// the outcome through.
+func (i *Interpreter) chainPromise(p *PromiseVal, onFulfilled, onRejected Value, s span.Span) *PromiseVal {
+	next := i.loop.newPromise()
+	p.onSettle(func() error {
+		handler, arg := onFulfilled, p.value
+		if p.err != nil {
+			handler = onRejected
+			if handler != nil {
+				arg = i.caughtValue(p.err)
+			}
+		}
+		if handler == nil {
+			next.settle(p.value, p.err)
+			return nil
+		}
+		val, err := i.callValue(handler, []Value{arg}, s)
+		if err != nil {
+			if uncatchable(err) {
+				return err
+			}
+			next.reject(err)
+			return nil
+		}
+		next.resolve(val)
+		return nil
+	})
+	return next
+}
@@ -0,0 +1,358 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// ============================================================
+// Binary data (readBytes / writeBytes / pack / unpack)
+// ============================================================
+
+// Byte strings are arrays of ints in 0..255, so the array methods and
+// indexing work on them directly.
+
+// registerBinaryBuiltins adds the byte-oriented file functions and the
+// struct-style pack() and unpack().
+func (i *Interpreter) registerBinaryBuiltins() {
+	i.global.Define("readBytes", &BuiltinVal{
+		Name:      "readBytes",
+		Signature: "readBytes(path)",
+		Doc:       "Return the contents of the file at path as an array of bytes.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("readBytes() expects 1 argument, got %d", len(args))
+			}
+			path, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("readBytes() argument must be a file path, got '%s'", args[0].TypeName())
+			}
+			if err := i.checkFS("readBytes"); err != nil {
+				return nil, err
+			}
+			data, err := os.ReadFile(string(path))
+			if err != nil {
+				return nil, fmt.Errorf("readBytes(): %v", err)
+			}
+			return bytesToArray(data), nil
+		},
+	}, true)
+
+	i.global.Define("writeBytes", &BuiltinVal{
+		Name:      "writeBytes",
+		Signature: "writeBytes(path, bytes)",
+		Doc:       "Write an array of bytes to the file at path, replacing it.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("writeBytes() expects 2 arguments, got %d", len(args))
+			}
+			path, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("writeBytes() first argument must be a file path, got '%s'", args[0].TypeName())
+			}
+			data, err := arrayToBytes("writeBytes", args[1])
+			if err != nil {
+				return nil, err
+			}
+			if err := i.checkFS("writeBytes"); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(string(path), data, 0o644); err != nil {
+				return nil, fmt.Errorf("writeBytes(): %v", err)
+			}
+			return IntVal(len(data)), nil
+		},
+	}, true)
+
+	i.global.Define("pack", &BuiltinVal{
+		Name:      "pack",
+		Signature: "pack(format, values)",
+		Doc:       "Encode an array of values as bytes laid out by format, e.g. \"<HHi4s\".",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("pack() expects 2 arguments, got %d", len(args))
+			}
+			format, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("pack() format must be a string, got '%s'", args[0].TypeName())
+			}
+			values, ok := args[1].(*ArrayVal)
+			if !ok {
+				return nil, fmt.Errorf("pack() values must be an array, got '%s'", args[1].TypeName())
+			}
+			data, err := pack(string(format), values.Elements)
+			if err != nil {
+				return nil, fmt.Errorf("pack(): %v", err)
+			}
+			return bytesToArray(data), nil
+		},
+	}, true)
+
+	i.global.Define("unpack", &BuiltinVal{
+		Name:      "unpack",
+		Signature: "unpack(format, bytes, offset?)",
+		Doc:       "Decode the values laid out by format from bytes, starting at offset (default 0).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("unpack() expects 2-3 arguments, got %d", len(args))
+			}
+			format, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("unpack() format must be a string, got '%s'", args[0].TypeName())
+			}
+			data, err := arrayToBytes("unpack", args[1])
+			if err != nil {
+				return nil, err
+			}
+			if len(args) == 3 {
+				offset, ok := args[2].(IntVal)
+				if !ok || offset < 0 || int(offset) > len(data) {
+					return nil, fmt.Errorf("unpack() offset must be an integer between 0 and %d", len(data))
+				}
+				data = data[offset:]
+			}
+			values, err := unpack(string(format), data)
+			if err != nil {
+				return nil, fmt.Errorf("unpack(): %v", err)
+			}
+			return &ArrayVal{Elements: values}, nil
+		},
+	}, true)
+}
+
+func bytesToArray(data []byte) *ArrayVal {
+	elements := make([]Value, len(data))
+	for idx, b := range data {
+		elements[idx] = IntVal(b)
+	}
+	return &ArrayVal{Elements: elements}
+}
+
+// arrayToBytes converts an array of ints in 0..255 to bytes.
+func arrayToBytes(name string, v Value) ([]byte, error) {
+	arr, ok := v.(*ArrayVal)
+	if !ok {
+		return nil, fmt.Errorf("%s() expects an array of bytes, got '%s'", name, v.TypeName())
+	}
+	data := make([]byte, len(arr.Elements))
+	for idx, elem := range arr.Elements {
+		n, ok := elem.(IntVal)
+		if !ok || n < 0 || n > 255 {
+			return nil, fmt.Errorf("%s() element %d is not a byte: %s", name, idx, elem)
+		}
+		data[idx] = byte(n)
+	}
+	return data, nil
+}
+
+// packField is one item of a format string: a type code and its count.
+type packField struct {
+	code  byte
+	count int
+}
+
+// packSizes is the width in bytes of each fixed-size type code.
+var packSizes = map[byte]int{
+	'x': 1, '?': 1, 'b': 1, 'B': 1, 'h': 2, 'H': 2,
+	'i': 4, 'I': 4, 'q': 8, 'Q': 8, 'f': 4, 'd': 8, 's': 1,
+}
+
+// parseFormat parses a format string in the style of Python's struct module:
+// an optional byte order ('<' or '=' little-endian, the default; '>' or '!'
+// big-endian) followed by type codes, each optionally preceded by a count.
+//
+//	x pad byte      ? bool       b/B int8/uint8    h/H int16/uint16
+//	i/I int32/uint32             q/Q int64/uint64  f float32  d float64
+//	Ns string of N bytes, zero-padded when packing and with trailing zero
+//	   bytes dropped when unpacking
+//
+// Q values above the int range unpack as negative ints.
+func parseFormat(format string) (binary.ByteOrder, []packField, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if format != "" {
+		switch format[0] {
+		case '<', '=':
+			format = format[1:]
+		case '>', '!':
+			order = binary.BigEndian
+			format = format[1:]
+		}
+	}
+	var fields []packField
+	for pos := 0; pos < len(format); pos++ {
+		if format[pos] == ' ' {
+			continue
+		}
+		start := pos
+		for pos < len(format) && format[pos] >= '0' && format[pos] <= '9' {
+			pos++
+		}
+		count := 1
+		if pos > start {
+			count, _ = strconv.Atoi(format[start:pos])
+		}
+		if pos == len(format) {
+			return nil, nil, fmt.Errorf("format '%s' ends with a count", format)
+		}
+		if _, ok := packSizes[format[pos]]; !ok {
+			return nil, nil, fmt.Errorf("unknown format code '%c'", format[pos])
+		}
+		fields = append(fields, packField{format[pos], count})
+	}
+	return order, fields, nil
+}
+
+func pack(format string, values []Value) ([]byte, error) {
+	order, fields, err := parseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	next := 0
+	take := func() (Value, error) {
+		if next >= len(values) {
+			return nil, fmt.Errorf("format '%s' needs more than %d values", format, len(values))
+		}
+		next++
+		return values[next-1], nil
+	}
+	for _, f := range fields {
+		if f.code == 's' {
+			v, err := take()
+			if err != nil {
+				return nil, err
+			}
+			str, ok := v.(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("value %d for '%ds' must be a string, got '%s'", next-1, f.count, v.TypeName())
+			}
+			buf := make([]byte, f.count)
+			copy(buf, str)
+			out = append(out, buf...)
+			continue
+		}
+		for k := 0; k < f.count; k++ {
+			if f.code == 'x' {
+				out = append(out, 0)
+				continue
+			}
+			v, err := take()
+			if err != nil {
+				return nil, err
+			}
+			buf, err := packValue(order, f.code, v)
+			if err != nil {
+				return nil, fmt.Errorf("value %d for '%c': %v", next-1, f.code, err)
+			}
+			out = append(out, buf...)
+		}
+	}
+	if next != len(values) {
+		return nil, fmt.Errorf("format '%s' takes %d values, got %d", format, next, len(values))
+	}
+	return out, nil
+}
+
+// packValue encodes a single value, checking that integers fit the field.
+func packValue(order binary.ByteOrder, code byte, v Value) ([]byte, error) {
+	buf := make([]byte, packSizes[code])
+	switch code {
+	case '?':
+		b, ok := v.(BoolVal)
+		if !ok {
+			return nil, fmt.Errorf("expected bool, got '%s'", v.TypeName())
+		}
+		if b {
+			buf[0] = 1
+		}
+	case 'f', 'd':
+		f, ok := ToFloat64(v)
+		if !ok {
+			return nil, fmt.Errorf("expected number, got '%s'", v.TypeName())
+		}
+		if code == 'f' {
+			order.PutUint32(buf, math.Float32bits(float32(f)))
+		} else {
+			order.PutUint64(buf, math.Float64bits(f))
+		}
+	default:
+		n, ok := v.(IntVal)
+		if !ok {
+			return nil, fmt.Errorf("expected int, got '%s'", v.TypeName())
+		}
+		bits := uint(len(buf) * 8)
+		signed := code >= 'a'
+		if signed && bits < 64 && (n < -(1<<(bits-1)) || n >= 1<<(bits-1)) ||
+			!signed && (n < 0 || bits < 64 && n >= 1<<bits) {
+			return nil, fmt.Errorf("%d does not fit in %d bits", n, bits)
+		}
+		switch len(buf) {
+		case 1:
+			buf[0] = byte(n)
+		case 2:
+			order.PutUint16(buf, uint16(n))
+		case 4:
+			order.PutUint32(buf, uint32(n))
+		case 8:
+			order.PutUint64(buf, uint64(n))
+		}
+	}
+	return buf, nil
+}
+
+func unpack(format string, data []byte) ([]Value, error) {
+	order, fields, err := parseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, f := range fields {
+		size += packSizes[f.code] * f.count
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("format '%s' needs %d bytes, got %d", format, size, len(data))
+	}
+	var values []Value
+	for _, f := range fields {
+		if f.code == 's' {
+			values = append(values, StringVal(bytes.TrimRight(data[:f.count], "\x00")))
+			data = data[f.count:]
+			continue
+		}
+		for k := 0; k < f.count; k++ {
+			n := packSizes[f.code]
+			buf := data[:n]
+			data = data[n:]
+			switch f.code {
+			case 'x':
+			case '?':
+				values = append(values, BoolVal(buf[0] != 0))
+			case 'b':
+				values = append(values, IntVal(int8(buf[0])))
+			case 'B':
+				values = append(values, IntVal(buf[0]))
+			case 'h':
+				values = append(values, IntVal(int16(order.Uint16(buf))))
+			case 'H':
+				values = append(values, IntVal(order.Uint16(buf)))
+			case 'i':
+				values = append(values, IntVal(int32(order.Uint32(buf))))
+			case 'I':
+				values = append(values, IntVal(order.Uint32(buf)))
+			case 'q':
+				values = append(values, IntVal(int64(order.Uint64(buf))))
+			case 'Q':
+				values = append(values, IntVal(int64(order.Uint64(buf))))
+			case 'f':
+				values = append(values, FloatVal(math.Float32frombits(order.Uint32(buf))))
+			case 'd':
+				values = append(values, FloatVal(math.Float64frombits(order.Uint64(buf))))
+			}
+		}
+	}
+	return values, nil
+}
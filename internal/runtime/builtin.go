@@ -3,12 +3,16 @@ package runtime
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 )
 
 // RegisterBuiltins adds built-in functions to the given environment.
 func RegisterBuiltins(env *Environment, w io.Writer) {
 	env.Define("print", &BuiltinVal{
-		Name: "print",
+		Name:      "print",
+		Signature: "print(values...)",
+		Doc:       "Print values separated by spaces, followed by a newline.",
 		Fn: func(args []Value) (Value, error) {
 			fmt.Fprintln(w, ValuesString(args, " "))
 			return NullVal{}, nil
@@ -16,7 +20,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 	}, true)
 
 	env.Define("println", &BuiltinVal{
-		Name: "println",
+		Name:      "println",
+		Signature: "println(values...)",
+		Doc:       "Same as print.",
 		Fn: func(args []Value) (Value, error) {
 			fmt.Fprintln(w, ValuesString(args, " "))
 			return NullVal{}, nil
@@ -24,7 +30,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 	}, true)
 
 	env.Define("typeOf", &BuiltinVal{
-		Name: "typeOf",
+		Name:      "typeOf",
+		Signature: "typeOf(value)",
+		Doc:       "Return the type name of value as a string.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("typeOf() expects 1 argument, got %d", len(args))
@@ -34,7 +42,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 	}, true)
 
 	env.Define("toString", &BuiltinVal{
-		Name: "toString",
+		Name:      "toString",
+		Signature: "toString(value)",
+		Doc:       "Convert value to its string representation.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("toString() expects 1 argument, got %d", len(args))
@@ -43,19 +53,84 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 		},
 	}, true)
 
+	env.Define("format", &BuiltinVal{
+		Name:      "format",
+		Signature: "format(pattern, values...)",
+		Doc:       "Return pattern with its printf-style verbs (%d, %.2f, %-10s, %v, ...) filled in by values.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("format() expects a pattern")
+			}
+			pattern, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("format() pattern must be a string, got '%s'", args[0].TypeName())
+			}
+			s, err := formatValues(string(pattern), args[1:])
+			if err != nil {
+				return nil, err
+			}
+			return StringVal(s), nil
+		},
+	}, true)
+
+	env.Define("pprint", &BuiltinVal{
+		Name:      "pprint",
+		Signature: "pprint(value, indent?)",
+		Doc:       "Print value with nested arrays, maps and objects indented (default 2 spaces).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("pprint() expects 1-2 arguments, got %d", len(args))
+			}
+			indent := int64(2)
+			if len(args) == 2 {
+				n, ok := args[1].(IntVal)
+				if !ok || n < 0 {
+					return nil, fmt.Errorf("pprint() indent must be a non-negative integer")
+				}
+				indent = int64(n)
+			}
+			fmt.Fprintln(w, PrettyString(args[0], int(indent)))
+			return NullVal{}, nil
+		},
+	}, true)
+
+	env.Define("dedent", &BuiltinVal{
+		Name:      "dedent",
+		Signature: "dedent(string)",
+		Doc:       "Remove common leading indentation and blank first/last lines from a multi-line string.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("dedent() expects 1 argument, got %d", len(args))
+			}
+			str, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("dedent() expects a string argument, got '%s'", args[0].TypeName())
+			}
+			return StringVal(Dedent(string(str))), nil
+		},
+	}, true)
+
 	env.Define("len", &BuiltinVal{
-		Name: "len",
+		Name:      "len",
+		Signature: "len(value)",
+		Doc:       "Return the number of characters in a string, or of elements in an array, map, set or range.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("len() expects 1 argument, got %d", len(args))
 			}
 			switch v := args[0].(type) {
 			case StringVal:
-				return IntVal(len(string(v))), nil
+				return IntVal(runeLen(string(v))), nil
 			case *ArrayVal:
 				return IntVal(len(v.Elements)), nil
 			case *MapVal:
 				return IntVal(len(v.Keys)), nil
+			case *SetVal:
+				return IntVal(len(v.Items)), nil
+			case *StringBuilderVal:
+				return IntVal(v.runes), nil
+			case *RangeVal:
+				return IntVal(v.Len()), nil
 			default:
 				return nil, fmt.Errorf("len() not supported for type '%s'", args[0].TypeName())
 			}
@@ -63,7 +138,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 	}, true)
 
 	env.Define("push", &BuiltinVal{
-		Name: "push",
+		Name:      "push",
+		Signature: "push(array, value)",
+		Doc:       "Append value to array.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 2 {
 				return nil, fmt.Errorf("push() expects 2 arguments, got %d", len(args))
@@ -72,13 +149,18 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 			if !ok {
 				return nil, fmt.Errorf("push() first argument must be an array, got '%s'", args[0].TypeName())
 			}
+			if err := mutable(arr); err != nil {
+				return nil, err
+			}
 			arr.Elements = append(arr.Elements, args[1])
 			return IntVal(len(arr.Elements)), nil
 		},
 	}, true)
 
 	env.Define("pop", &BuiltinVal{
-		Name: "pop",
+		Name:      "pop",
+		Signature: "pop(array)",
+		Doc:       "Remove and return the last element of array.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("pop() expects 1 argument, got %d", len(args))
@@ -87,6 +169,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 			if !ok {
 				return nil, fmt.Errorf("pop() first argument must be an array, got '%s'", args[0].TypeName())
 			}
+			if err := mutable(arr); err != nil {
+				return nil, err
+			}
 			if len(arr.Elements) == 0 {
 				return nil, fmt.Errorf("pop() on empty array")
 			}
@@ -97,7 +182,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 	}, true)
 
 	env.Define("keys", &BuiltinVal{
-		Name: "keys",
+		Name:      "keys",
+		Signature: "keys(map)",
+		Doc:       "Return the keys of map in insertion order.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("keys() expects 1 argument, got %d", len(args))
@@ -115,7 +202,9 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 	}, true)
 
 	env.Define("implements", &BuiltinVal{
-		Name: "implements",
+		Name:      "implements",
+		Signature: "implements(value, Interface)",
+		Doc:       "Report whether value's class implements Interface.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 2 {
 				return nil, fmt.Errorf("implements() expects 2 arguments, got %d", len(args))
@@ -138,8 +227,100 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 		},
 	}, true)
 
+	env.Define("className", &BuiltinVal{
+		Name:      "className",
+		Signature: "className(value)",
+		Doc:       "Return the class name of an object or class.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("className() expects 1 argument, got %d", len(args))
+			}
+			cls, ok := classOf(args[0])
+			if !ok {
+				return nil, fmt.Errorf("className() expects an object or class, got '%s'", args[0].TypeName())
+			}
+			return StringVal(cls.Decl.Name), nil
+		},
+	}, true)
+
+	env.Define("methodsOf", &BuiltinVal{
+		Name:      "methodsOf",
+		Signature: "methodsOf(classOrObject)",
+		Doc:       "Return the sorted method names of a class, including inherited ones.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("methodsOf() expects 1 argument, got %d", len(args))
+			}
+			cls, ok := classOf(args[0])
+			if !ok {
+				return nil, fmt.Errorf("methodsOf() expects an object or class, got '%s'", args[0].TypeName())
+			}
+			var names []string
+			seen := make(map[string]bool)
+			for c := cls; c != nil; c = c.Super {
+				for _, m := range c.Decl.Methods {
+					if !seen[m.Name] {
+						seen[m.Name] = true
+						names = append(names, m.Name)
+					}
+				}
+			}
+			sort.Strings(names)
+			elements := make([]Value, len(names))
+			for i, name := range names {
+				elements[i] = StringVal(name)
+			}
+			return &ArrayVal{Elements: elements}, nil
+		},
+	}, true)
+
+	env.Define("propsOf", &BuiltinVal{
+		Name:      "propsOf",
+		Signature: "propsOf(object)",
+		Doc:       "Return a map of an object's properties, sorted by name.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("propsOf() expects 1 argument, got %d", len(args))
+			}
+			obj, ok := args[0].(*ObjectVal)
+			if !ok {
+				return nil, fmt.Errorf("propsOf() expects an object, got '%s'", args[0].TypeName())
+			}
+			m := &MapVal{Values: make(map[string]Value, len(obj.Props))}
+			for name, val := range obj.Props {
+				m.Keys = append(m.Keys, name)
+				m.Values[name] = val
+			}
+			sort.Strings(m.Keys)
+			return m, nil
+		},
+	}, true)
+
+	env.Define("hasMethod", &BuiltinVal{
+		Name:      "hasMethod",
+		Signature: "hasMethod(value, name)",
+		Doc:       "Report whether value's class defines or inherits method name.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("hasMethod() expects 2 arguments, got %d", len(args))
+			}
+			name, ok := args[1].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("hasMethod() second argument must be a string, got '%s'", args[1].TypeName())
+			}
+			cls, ok := classOf(args[0])
+			if !ok {
+				return BoolVal(false), nil
+			}
+			method, _ := findMethod(cls, string(name))
+			return BoolVal(method != nil), nil
+		},
+	}, true)
+
 	env.Define("values", &BuiltinVal{
-		Name: "values",
+		Name:      "values",
+		Signature: "values(map)",
+		Doc:       "Return the values of map in insertion order.",
 		Fn: func(args []Value) (Value, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("values() expects 1 argument, got %d", len(args))
@@ -156,3 +337,60 @@ func RegisterBuiltins(env *Environment, w io.Writer) {
 		},
 	}, true)
 }
+
+// classOf returns the class of an object, or the class itself.
+func classOf(v Value) (*ClassVal, bool) {
+	switch val := v.(type) {
+	case *ObjectVal:
+		return val.Class, true
+	case *ClassVal:
+		return val, true
+	default:
+		return nil, false
+	}
+}
+
+// Dedent removes the longest common leading whitespace from every non-blank
+// line of s. A blank first or last line is dropped and whitespace-only lines
+// become empty, so an indented text block such as
+//
+//	dedent(`
+//	    first
+//	      second
+//	    `)
+//
+// yields "first\n  second".
+func Dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) > 1 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	margin := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			margin, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, margin) {
+			margin = margin[:len(margin)-1]
+		}
+	}
+
+	for idx, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[idx] = ""
+		} else {
+			lines[idx] = line[len(margin):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
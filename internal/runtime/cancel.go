@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+	"sync"
+	"sync/atomic"
+)
+
+// ============================================================
+// Cancellation (RunContext / EvalContext)
+// ============================================================
+//
+// While RunContext or EvalContext runs, a done context sets a flag that
+// the interpreter checks where it already counts work: at every step, so
+// at each loop iteration, and on entering a call. The event loop checks it
+// between callbacks and wakes up for it. Builtins that block, such as
+// time.sleep and http.serve, wait on the interruption's done channel too.
+
+// CancelledError reports that the context passed to RunContext or
+// EvalContext was done. try/catch does not catch it.
+type CancelledError struct {
+	Span  span.Span
+	Cause error // context.Canceled, context.DeadlineExceeded or the context's cause
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("runtime error at %d:%d: script cancelled: %v", e.Span.Start.Line, e.Span.Start.Column, e.Cause)
+}
+
+func (e *CancelledError) Unwrap() error { return e.Cause }
+
+// interruption holds why the running script must stop, or nil. Modules,
+// workers and tasks share their parent's.
+type interruption struct {
+	cause atomic.Pointer[error]
+	mu    sync.Mutex
+	done  chan struct{} // closed when raised; nil until first needed
+}
+
+// raise records cause and closes the done channel.
+func (r *interruption) raise(cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cause.Store(&cause)
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	close(r.done)
+}
+
+// clear forgets the cause so the interpreter can run again.
+func (r *interruption) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cause.Load() != nil {
+		r.cause.Store(nil)
+		r.done = nil
+	}
+}
+
+// Done returns a channel closed once the interruption is raised, for
+// builtins that block to select on.
+func (r *interruption) Done() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	return r.done
+}
+
+// RunContext runs file like Run, stopping it with a *CancelledError once
+// ctx is done. errors.Is(err, context.Canceled) holds for that error.
+func (i *Interpreter) RunContext(ctx context.Context, file *ast.File) error {
+	defer i.watchContext(ctx)()
+	return i.Run(file)
+}
+
+// EvalContext evaluates file like Eval, stopping it once ctx is done.
+func (i *Interpreter) EvalContext(ctx context.Context, file *ast.File) (Value, error) {
+	defer i.watchContext(ctx)()
+	return i.Eval(file)
+}
+
+// RunEventLoopContext runs pending timers and promise jobs like
+// RunEventLoop, stopping once ctx is done.
+func (i *Interpreter) RunEventLoopContext(ctx context.Context) error {
+	defer i.watchContext(ctx)()
+	return i.RunEventLoop()
+}
+
+// watchContext raises the interruption when ctx is done. The returned func
+// stops watching and clears it, so the interpreter can run again.
+func (i *Interpreter) watchContext(ctx context.Context) (unwatch func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		i.interrupt.raise(context.Cause(ctx))
+		// Wake an event loop waiting for timers or I/O
+		select {
+		case i.loop.wake <- struct{}{}:
+		default:
+		}
+		close(fired)
+	})
+	return func() {
+		if !stop() {
+			<-fired
+		}
+		i.interrupt.clear()
+	}
+}
+
+// interrupted returns a *CancelledError at s once the context being
+// watched is done.
+func (i *Interpreter) interrupted(s span.Span) error {
+	if cause := i.interrupt.cause.Load(); cause != nil {
+		return &CancelledError{Span: s, Cause: *cause}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Tasks and channels (spawn / channel / select)
+// ============================================================
+//
+// Memory model: spawn f(args) runs the call on another goroutine in its own
+// interpreter, with deep copies of f (and everything its closure reaches)
+// and of the arguments, the way parallelMap copies its callback. A task
+// therefore never sees later changes made by its spawner and its own
+// assignments stay local to it. Values sent on a channel are deep-copied
+// too. Channels and task handles are the only values shared between tasks;
+// they are how tasks communicate. Output from print() is written whole
+// lines at a time. A script does not wait for tasks it has not joined.
+// Timers and promises a task starts run on its own event loop, and the
+// task finishes once they have.
+
+// TaskVal is a handle to a call started with spawn.
+type TaskVal struct {
+	Name   string
+	done   chan struct{}
+	result Value // set before done is closed
+	err    error
+}
+
+func (v *TaskVal) TypeName() string { return "task" }
+func (v *TaskVal) String() string   { return fmt.Sprintf("<task %s>", v.Name) }
+
+// ChannelVal is a queue of values for tasks to pass between them. Sends
+// block while a buffered channel is full, or until a receiver takes the
+// value when the channel is unbuffered.
+type ChannelVal struct {
+	ch        chan Value
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (v *ChannelVal) TypeName() string { return "channel" }
+func (v *ChannelVal) String() string   { return fmt.Sprintf("<channel %d/%d>", len(v.ch), cap(v.ch)) }
+
+// NewChannel returns a channel that buffers up to capacity values.
+func NewChannel(capacity int) *ChannelVal {
+	return &ChannelVal{ch: make(chan Value, capacity), closed: make(chan struct{})}
+}
+
+// Send queues v, failing if the channel is or becomes closed.
+func (v *ChannelVal) Send(val Value) (err error) {
+	select {
+	case <-v.closed:
+		return fmt.Errorf("send() on closed channel")
+	default:
+	}
+	defer func() {
+		if recover() != nil { // closed while this send was blocked
+			err = fmt.Errorf("send() on closed channel")
+		}
+	}()
+	v.ch <- val
+	return nil
+}
+
+// Recv waits for the next value; ok is false once the channel is closed
+// and drained.
+func (v *ChannelVal) Recv() (val Value, ok bool) {
+	val, ok = <-v.ch
+	return val, ok
+}
+
+// Close stops further sends; receivers still get the values queued.
+// Closing twice does nothing.
+func (v *ChannelVal) Close() {
+	v.closeOnce.Do(func() {
+		close(v.closed)
+		close(v.ch)
+	})
+}
+
+// evalSpawn starts e.Call on a new goroutine and returns its task. The
+// callee, receiver and arguments are evaluated here, then copied into the
+// task's interpreter before it starts.
+func (i *Interpreter) evalSpawn(e *ast.SpawnExpr) (Value, error) {
+	call := e.Call.(*ast.CallExpr)
+	args, err := i.evalArgs(call.Args)
+	if err != nil {
+		return nil, err
+	}
+	var recv, callee Value
+	name := "<anonymous>"
+	if member, ok := call.Callee.(*ast.MemberExpr); ok {
+		if recv, err = i.evalExpr(member.Object); err != nil {
+			return nil, err
+		}
+		name = member.Property
+	} else {
+		if callee, err = i.evalExpr(call.Callee); err != nil {
+			return nil, err
+		}
+		switch fn := callee.(type) {
+		case *FuncVal:
+			name = fn.Name
+		case *BuiltinVal:
+			name = fn.Name
+		}
+	}
+
+	sub := i.worker()
+	c := newCopier(sub)
+	args = c.copyValue(&ArrayVal{Elements: args}).(*ArrayVal).Elements
+	if recv != nil {
+		recv = c.copyValue(recv)
+	} else {
+		callee = c.copyValue(callee)
+	}
+	task := &TaskVal{Name: name, done: make(chan struct{})}
+	s := call.GetSpan()
+	go func() {
+		defer close(task.done)
+		if recv != nil {
+			task.result, task.err = sub.drain(sub.callMember(recv, name, args, s))
+		} else {
+			task.result, task.err = sub.drain(sub.callValue(callee, args, s))
+		}
+	}()
+	return task, nil
+}
+
+// registerConcurrencyBuiltins adds channel() and select().
+func (i *Interpreter) registerConcurrencyBuiltins() {
+	i.global.Define("channel", &BuiltinVal{
+		Name:      "channel",
+		Signature: "channel(capacity?)",
+		Doc:       "Return a channel buffering up to capacity values (default 0: each send waits for a receiver).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) > 1 {
+				return nil, fmt.Errorf("channel() expects 0-1 arguments, got %d", len(args))
+			}
+			capacity := IntVal(0)
+			if len(args) == 1 {
+				n, ok := args[0].(IntVal)
+				if !ok || n < 0 {
+					return nil, fmt.Errorf("channel() capacity must be a non-negative integer")
+				}
+				capacity = n
+			}
+			return NewChannel(int(capacity)), nil
+		},
+	}, true)
+
+	i.global.Define("select", &BuiltinVal{
+		Name:      "select",
+		Signature: "select(channels, timeoutMs?)",
+		Doc: "Wait until one of the channels has a value or is closed and return [index, value], " +
+			"with value null for a closed channel; return null if timeoutMs passes first.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("select() expects 1-2 arguments, got %d", len(args))
+			}
+			arr, ok := args[0].(*ArrayVal)
+			if !ok || len(arr.Elements) == 0 {
+				return nil, fmt.Errorf("select() expects a non-empty array of channels")
+			}
+			cases := make([]reflect.SelectCase, 0, len(arr.Elements)+1)
+			for _, elem := range arr.Elements {
+				ch, ok := elem.(*ChannelVal)
+				if !ok {
+					return nil, fmt.Errorf("select() expects channels, got '%s'", elem.TypeName())
+				}
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.ch)})
+			}
+			if len(args) == 2 {
+				ms, ok := ToFloat64(args[1])
+				if !ok || ms < 0 {
+					return nil, fmt.Errorf("select() timeout must be a non-negative number of milliseconds")
+				}
+				timer := time.NewTimer(time.Duration(ms * float64(time.Millisecond)))
+				defer timer.Stop()
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+			}
+			chosen, recv, ok := reflect.Select(cases)
+			if chosen == len(arr.Elements) {
+				return NullVal{}, nil // timed out
+			}
+			var val Value = NullVal{}
+			if ok {
+				val = recv.Interface().(Value)
+			}
+			return &ArrayVal{Elements: []Value{IntVal(chosen), val}}, nil
+		},
+	}, true)
+}
+
+// callTaskMethod dispatches methods on a task handle.
+func (i *Interpreter) callTaskMethod(task *TaskVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "join":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "join() expects 0 arguments, got %d", len(args))
+		}
+		<-task.done
+		return task.result, task.err
+
+	case "done":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "done() expects 0 arguments, got %d", len(args))
+		}
+		select {
+		case <-task.done:
+			return BoolVal(true), nil
+		default:
+			return BoolVal(false), nil
+		}
+
+	default:
+		return nil, runtimeErr(s, "task has no method '%s'", name)
+	}
+}
+
+// callChannelMethod dispatches methods on a channel.
+func (i *Interpreter) callChannelMethod(ch *ChannelVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "send":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "send() expects 1 argument, got %d", len(args))
+		}
+		if err := ch.Send(newCopier(i).copyValue(args[0])); err != nil {
+			return nil, runtimeErr(s, "%s", err)
+		}
+		return NullVal{}, nil
+
+	case "recv":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "recv() expects 0 arguments, got %d", len(args))
+		}
+		val, ok := ch.Recv()
+		if !ok {
+			return NullVal{}, nil
+		}
+		return val, nil
+
+	case "close":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "close() expects 0 arguments, got %d", len(args))
+		}
+		ch.Close()
+		return NullVal{}, nil
+
+	default:
+		return nil, runtimeErr(s, "channel has no method '%s'", name)
+	}
+}
@@ -0,0 +1,203 @@
+package runtime
+
+// ============================================================
+// Deep copying of values and environments
+// ============================================================
+
+// copier deep-copies runtime values, preserving sharing and cycles within a
+// single copy operation. Environments reachable through closures and classes
+// are copied too, so the result shares no mutable state with the original.
+type copier struct {
+	values map[Value]Value
+	envs   map[*Environment]*Environment
+	interp *Interpreter // runs the copied classes' toString() methods
+
+	dataOnly bool // share functions and classes instead of copying them
+}
+
+// newCopier returns a copier for values that interp will use.
+func newCopier(interp *Interpreter) *copier {
+	return &copier{
+		values: make(map[Value]Value),
+		envs:   make(map[*Environment]*Environment),
+		interp: interp,
+	}
+}
+
+// copyValue returns a deep copy of v. Immutable values are returned as-is.
+func (c *copier) copyValue(v Value) Value {
+	switch val := v.(type) {
+	case *ArrayVal:
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		arr := &ArrayVal{Elements: make([]Value, len(val.Elements))}
+		c.values[val] = arr
+		for idx, elem := range val.Elements {
+			arr.Elements[idx] = c.copyValue(elem)
+		}
+		return arr
+
+	case *MapVal:
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		m := &MapVal{
+			Keys:   append([]string(nil), val.Keys...),
+			Values: make(map[string]Value, len(val.Values)),
+		}
+		c.values[val] = m
+		for k, elem := range val.Values {
+			m.Values[k] = c.copyValue(elem)
+		}
+		return m
+
+	case *SetVal:
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		set := NewSet(nil)
+		c.values[val] = set
+		for _, item := range val.Items {
+			set.Add(c.copyValue(item))
+		}
+		return set
+
+	case *StringBuilderVal:
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		sb := &StringBuilderVal{}
+		sb.WriteString(val.String())
+		c.values[val] = sb
+		return sb
+
+	case *ObjectVal:
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		obj := &ObjectVal{Props: make(map[string]Value, len(val.Props))}
+		c.values[val] = obj
+		obj.Class = c.copyValue(val.Class).(*ClassVal)
+		for k, prop := range val.Props {
+			obj.Props[k] = c.copyValue(prop)
+		}
+		return obj
+
+	case *FuncVal:
+		if c.dataOnly {
+			return val
+		}
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		fn := &FuncVal{Name: val.Name, Params: val.Params, Body: val.Body, Doc: val.Doc, Rest: val.Rest, Generator: val.Generator, Async: val.Async, scope: val.scope}
+		c.values[val] = fn
+		fn.Closure = c.copyEnv(val.Closure)
+		return fn
+
+	case *BoundFuncVal:
+		if c.dataOnly {
+			return val
+		}
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		bound := &BoundFuncVal{method: val.method, interp: c.interp}
+		c.values[val] = bound
+		bound.This = c.copyValue(val.This)
+		bound.Args = make([]Value, len(val.Args))
+		for idx, arg := range val.Args {
+			bound.Args[idx] = c.copyValue(arg)
+		}
+		if val.class != nil {
+			bound.class = c.copyValue(val.class).(*ClassVal)
+		}
+		if val.fn != nil {
+			bound.fn = c.copyValue(val.fn)
+		}
+		return bound
+
+	case *BuiltinVal:
+		if val.rebind == nil || c.dataOnly {
+			return val
+		}
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		// Registered first: the values rebind copies may lead back here
+		b := &BuiltinVal{}
+		c.values[val] = b
+		*b = *val.rebind(c)
+		return b
+
+	case *ClassVal:
+		if val == nil || c.dataOnly {
+			return val
+		}
+		if done, ok := c.values[val]; ok {
+			return done
+		}
+		cls := &ClassVal{Decl: val.Decl, Statics: make(map[string]Value, len(val.Statics)), Consts: val.Consts, interp: c.interp}
+		c.values[val] = cls
+		cls.Env = c.copyEnv(val.Env)
+		if val.Super != nil {
+			cls.Super = c.copyValue(val.Super).(*ClassVal)
+		}
+		for k, s := range val.Statics {
+			cls.Statics[k] = c.copyValue(s)
+		}
+		return cls
+
+	default:
+		// Primitives, enums and interfaces are immutable
+		return v
+	}
+}
+
+// copyValues returns a slice of deep copies of vals.
+func (c *copier) copyValues(vals []Value) []Value {
+	dup := make([]Value, len(vals))
+	for idx, val := range vals {
+		dup[idx] = c.copyValue(val)
+	}
+	return dup
+}
+
+// copyEnv returns a deep copy of env and its parent chain.
+func (c *copier) copyEnv(env *Environment) *Environment {
+	if env == nil {
+		return nil
+	}
+	if done, ok := c.envs[env]; ok {
+		return done
+	}
+	dup := &Environment{
+		names:  env.names[:len(env.names):len(env.names)],
+		values: make([]Value, len(env.values)),
+		consts: append([]bool(nil), env.consts...),
+		index:  env.index,
+		scope:  env.scope,
+		extra:  env.extra,
+	}
+	if env.index != nil && (env.scope == nil || env.extra) {
+		dup.index = copyIndex(env.index)
+	}
+	c.envs[env] = dup
+	dup.parent = c.copyEnv(env.parent)
+	for k, val := range env.values {
+		if val != nil {
+			dup.values[k] = c.copyValue(val)
+		}
+	}
+	return dup
+}
+
+// perInterp returns the builtin build returns for i. Copies made for another
+// interpreter call build for that one, so a builtin that calls back into
+// the interpreter running it stays on its own goroutine's interpreter.
+func perInterp(i *Interpreter, build func(i *Interpreter) *BuiltinVal) *BuiltinVal {
+	b := build(i)
+	b.rebind = func(c *copier) *BuiltinVal { return perInterp(c.interp, build) }
+	return b
+}
@@ -0,0 +1,104 @@
+package runtime
+
+import "fmt"
+
+// ============================================================
+// Deep copy and deep equality builtins
+// ============================================================
+
+// registerDeepBuiltins adds clone() and deepEquals().
+func (i *Interpreter) registerDeepBuiltins() {
+	i.global.Define("clone", &BuiltinVal{
+		Name:      "clone",
+		Signature: "clone(value)",
+		Doc:       "Return a deep copy of the arrays, maps, sets and objects in value; functions and classes are shared.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("clone() expects 1 argument, got %d", len(args))
+			}
+			c := newCopier(i)
+			c.dataOnly = true
+			return c.copyValue(args[0]), nil
+		},
+	}, true)
+
+	i.global.Define("deepEquals", &BuiltinVal{
+		Name:      "deepEquals",
+		Signature: "deepEquals(a, b)",
+		Doc:       "Report whether a and b are equal, comparing arrays, maps, sets and objects by their contents.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("deepEquals() expects 2 arguments, got %d", len(args))
+			}
+			return BoolVal(deepEqual(args[0], args[1], make(map[[2]Value]bool))), nil
+		},
+	}, true)
+}
+
+// deepEqual compares a and b by content: arrays element by element, maps by
+// their keys and values in any order, sets by their members, and objects of
+// the same class by their properties. Anything else compares with ==. seen
+// holds the pairs being compared further up, which count as equal so cyclic
+// values terminate.
+func deepEqual(a, b Value, seen map[[2]Value]bool) bool {
+	pair := [2]Value{a, b}
+	if seen[pair] {
+		return true
+	}
+	switch av := a.(type) {
+	case *ArrayVal:
+		bv, ok := b.(*ArrayVal)
+		if !ok || len(av.Elements) != len(bv.Elements) {
+			return false
+		}
+		seen[pair] = true
+		defer delete(seen, pair)
+		for idx := range av.Elements {
+			if !deepEqual(av.Elements[idx], bv.Elements[idx], seen) {
+				return false
+			}
+		}
+		return true
+	case *MapVal:
+		bv, ok := b.(*MapVal)
+		if !ok || len(av.Keys) != len(bv.Keys) {
+			return false
+		}
+		seen[pair] = true
+		defer delete(seen, pair)
+		for _, k := range av.Keys {
+			other, exists := bv.Values[k]
+			if !exists || !deepEqual(av.Values[k], other, seen) {
+				return false
+			}
+		}
+		return true
+	case *SetVal:
+		bv, ok := b.(*SetVal)
+		if !ok || len(av.Items) != len(bv.Items) {
+			return false
+		}
+		for _, item := range av.Items {
+			if !bv.Has(item) {
+				return false
+			}
+		}
+		return true
+	case *ObjectVal:
+		bv, ok := b.(*ObjectVal)
+		if !ok || av.Class != bv.Class || len(av.Props) != len(bv.Props) {
+			return false
+		}
+		seen[pair] = true
+		defer delete(seen, pair)
+		for k, prop := range av.Props {
+			other, exists := bv.Props[k]
+			if !exists || !deepEqual(prop, other, seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return valuesEqual(a, b)
+	}
+}
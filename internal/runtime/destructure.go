@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"light-lang/internal/ast"
+)
+
+// ============================================================
+// Destructuring
+// ============================================================
+
+// bindPattern destructures val into the targets of an ArrayPattern or
+// MapPattern, calling bind with each target that is not itself a pattern
+// and the value it receives. Arrays must have one element per target, or
+// at least as many when the pattern ends with a rest element. Maps and
+// objects are read like member expressions, so a missing key is null
+// unless strict index mode is on.
+func (i *Interpreter) bindPattern(pattern ast.Expr, val Value, bind func(target ast.Expr, val Value) error) error {
+	switch p := pattern.(type) {
+	case *ast.ArrayPattern:
+		arr, ok := val.(*ArrayVal)
+		if !ok {
+			return runtimeErr(p.Span, "cannot destructure value of type '%s' as an array", val.TypeName())
+		}
+		targets := p.Elements
+		var rest *ast.SpreadExpr
+		if n := len(targets); n > 0 {
+			if spread, ok := targets[n-1].(*ast.SpreadExpr); ok {
+				rest, targets = spread, targets[:n-1]
+			}
+		}
+		switch {
+		case rest != nil && len(arr.Elements) < len(targets):
+			return runtimeErr(p.Span, "cannot destructure %d values into at least %d variables", len(arr.Elements), len(targets))
+		case rest == nil && len(arr.Elements) != len(targets):
+			return runtimeErr(p.Span, "cannot destructure %d values into %d variables", len(arr.Elements), len(targets))
+		}
+		for idx, target := range targets {
+			if err := i.bindPattern(target, arr.Elements[idx], bind); err != nil {
+				return err
+			}
+		}
+		if rest != nil {
+			remaining := append([]Value(nil), arr.Elements[len(targets):]...)
+			return i.bindPattern(rest.Operand, &ArrayVal{Elements: remaining}, bind)
+		}
+		return nil
+	case *ast.MapPattern:
+		switch val.(type) {
+		case *MapVal, *ObjectVal:
+		default:
+			return runtimeErr(p.Span, "cannot destructure value of type '%s' as a map", val.TypeName())
+		}
+		for idx, key := range p.Keys {
+			elem, ok, err := i.getter(val, key, p.Values[idx].GetSpan())
+			if ok && err != nil {
+				return err
+			}
+			if !ok {
+				if err := i.requireKey(val, key); err != nil {
+					return runtimeErr(p.Values[idx].GetSpan(), "%s", err)
+				}
+				if elem, err = GetMember(val, key); err != nil {
+					return runtimeErr(p.Values[idx].GetSpan(), "%s", err)
+				}
+			}
+			if err := i.bindPattern(p.Values[idx], elem, bind); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return bind(pattern, val)
+	}
+}
+
+// definePattern declares the names of a declaration pattern in env.
+func (i *Interpreter) definePattern(env *Environment, pattern ast.Expr, val Value, isConst bool) error {
+	return i.bindPattern(pattern, val, func(target ast.Expr, val Value) error {
+		ident, ok := target.(*ast.IdentExpr)
+		if !ok {
+			return runtimeErr(target.GetSpan(), "invalid destructuring target")
+		}
+		if err := env.Define(ident.Name, val, isConst); err != nil {
+			return runtimeErr(ident.Span, "%s", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,177 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Introspection (doc)
+// ============================================================
+
+// registerDocBuiltins adds doc(), which needs access to the interpreter's scope.
+func (i *Interpreter) registerDocBuiltins() {
+	i.global.Define("doc", &BuiltinVal{
+		Name:      "doc",
+		Signature: "doc(name?)",
+		Doc:       "Describe a builtin, function or class; with no argument, list all builtins.",
+		Fn: func(args []Value) (Value, error) {
+			switch len(args) {
+			case 0:
+				fmt.Fprint(i.output, BuiltinsHelp(i.env))
+			case 1:
+				text, err := i.docFor(args[0])
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintln(i.output, text)
+			default:
+				return nil, fmt.Errorf("doc() expects 0-1 arguments, got %d", len(args))
+			}
+			return NullVal{}, nil
+		},
+	}, true)
+}
+
+// docFor accepts either a name or the value itself.
+func (i *Interpreter) docFor(arg Value) (string, error) {
+	if name, ok := arg.(StringVal); ok {
+		val, found := i.env.Get(string(name))
+		if !found {
+			return "", fmt.Errorf("doc(): '%s' is not defined", name)
+		}
+		arg = val
+	}
+	return DocText(arg), nil
+}
+
+// DocText describes a callable or class: its signature followed by the
+// builtin's description or the declaration's doc comment.
+func DocText(v Value) string {
+	switch val := v.(type) {
+	case *BuiltinVal:
+		sig := val.Signature
+		if sig == "" {
+			sig = val.Name + "(...)"
+		}
+		if val.Doc == "" {
+			return sig
+		}
+		return sig + "\n    " + val.Doc
+	case *FuncVal:
+		return fmt.Sprintf("function %s(%s)", val.Name, ast.FormatParams(val.Params, val.Rest)) + indentDoc(val.Doc, "    ")
+	case *ClassVal:
+		return ClassDoc(val.Decl)
+	default:
+		return fmt.Sprintf("%s (%s)", v.String(), v.TypeName())
+	}
+}
+
+// FuncDoc describes a function declaration: its signature and doc comment.
+func FuncDoc(decl *ast.FuncDecl) string {
+	return fmt.Sprintf("function %s(%s)", decl.Name, ast.FormatParams(decl.Params, decl.Rest)) + indentDoc(decl.Doc, "    ")
+}
+
+// ClassDoc lists a class's doc comment, constructor, methods (with their
+// doc comments) and static fields.
+func ClassDoc(decl *ast.ClassDecl) string {
+	var b strings.Builder
+	if decl.Record {
+		fmt.Fprintf(&b, "record %s(%s)", decl.Name, strings.Join(decl.Fields, ", "))
+	} else {
+		fmt.Fprintf(&b, "class %s", decl.Name)
+	}
+	if decl.SuperClass != "" {
+		fmt.Fprintf(&b, " extends %s", decl.SuperClass)
+	}
+	b.WriteString(indentDoc(decl.Doc, "    "))
+	for _, f := range decl.Props {
+		fmt.Fprintf(&b, "\n    %s", f.Name)
+		b.WriteString(indentDoc(f.Doc, "        "))
+	}
+	if ctor := decl.Constructor; ctor != nil {
+		fmt.Fprintf(&b, "\n    constructor(%s)", ast.FormatParams(ctor.Params, ctor.Rest))
+	}
+	for _, m := range decl.Getters {
+		fmt.Fprintf(&b, "\n    get %s()", m.Name)
+		b.WriteString(indentDoc(m.Doc, "        "))
+	}
+	for _, m := range decl.Setters {
+		fmt.Fprintf(&b, "\n    set %s(%s)", m.Name, ast.FormatParams(m.Params, m.Rest))
+		b.WriteString(indentDoc(m.Doc, "        "))
+	}
+	for _, m := range decl.Methods {
+		fmt.Fprintf(&b, "\n    %s(%s)", m.Name, ast.FormatParams(m.Params, m.Rest))
+		b.WriteString(indentDoc(m.Doc, "        "))
+	}
+	for _, m := range decl.StaticMethods {
+		fmt.Fprintf(&b, "\n    static %s(%s)", m.Name, ast.FormatParams(m.Params, m.Rest))
+		b.WriteString(indentDoc(m.Doc, "        "))
+	}
+	for _, s := range decl.Statics {
+		if s.IsConst {
+			fmt.Fprintf(&b, "\n    static const %s", s.Name)
+		} else {
+			fmt.Fprintf(&b, "\n    static %s", s.Name)
+		}
+	}
+	return b.String()
+}
+
+// indentDoc renders a doc comment as lines following a signature, each
+// starting with prefix. An empty doc renders as nothing.
+func indentDoc(doc, prefix string) string {
+	if doc == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(doc, "\n") {
+		b.WriteString("\n")
+		if line != "" {
+			b.WriteString(prefix + line)
+		}
+	}
+	return b.String()
+}
+
+// BuiltinsHelp lists every builtin visible from env with its signature and
+// description, sorted by name.
+func BuiltinsHelp(env *Environment) string {
+	var b strings.Builder
+	for _, name := range env.Names() {
+		val, _ := env.Get(name)
+		builtin, ok := val.(*BuiltinVal)
+		if !ok {
+			continue
+		}
+		sig := builtin.Signature
+		if sig == "" {
+			sig = name + "(...)"
+		}
+		fmt.Fprintf(&b, "  %-36s %s\n", sig, builtin.Doc)
+	}
+	return b.String()
+}
+
+// UserDefinitions returns the user-defined functions and classes visible
+// from env, sorted by name, as one-line signatures.
+func UserDefinitions(env *Environment) []string {
+	var defs []string
+	for _, name := range env.Names() {
+		val, _ := env.Get(name)
+		switch v := val.(type) {
+		case *FuncVal:
+			defs = append(defs, DocText(v))
+		case *ClassVal:
+			line := "class " + v.Decl.Name
+			if v.Decl.SuperClass != "" {
+				line += " extends " + v.Decl.SuperClass
+			}
+			defs = append(defs, line)
+		}
+	}
+	sort.Strings(defs)
+	return defs
+}
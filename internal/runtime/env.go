@@ -1,39 +1,179 @@
 package runtime
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 // Environment represents a variable scope with a parent chain.
+//
+// Bindings live in slots: names[k] is bound to values[k]. An environment
+// created for a resolved scope starts with a slot for every name the scope
+// declares, nil until the declaration runs, so resolved identifiers can
+// read their slot directly (see resolve.go). Other names are appended as
+// they are defined.
 type Environment struct {
-	values map[string]Value
-	consts map[string]bool // tracks which names are const
+	names  []string
+	values []Value        // nil while the name is declared but not yet defined
+	consts []bool         // parallel to names, nil until a constant is defined
+	index  map[string]int // slot by name, once the scope outgrows a linear scan
+	scope  *scope         // the resolver's layout for this environment, or nil
+	extra  bool           // holds a name its scope does not declare
 	parent *Environment
+	inline [4]Value // backs values for small scopes, saving an allocation
 }
 
+// indexAfter is the number of bindings above which an environment keeps a
+// name index instead of scanning its names.
+const indexAfter = 8
+
 // NewEnvironment creates a new environment with an optional parent scope.
 func NewEnvironment(parent *Environment) *Environment {
-	return &Environment{
-		values: make(map[string]Value),
-		consts: make(map[string]bool),
+	return &Environment{parent: parent}
+}
+
+// newScopeEnv creates an environment laid out for sc, which may be nil.
+func newScopeEnv(parent *Environment, sc *scope) *Environment {
+	if sc == nil {
+		return &Environment{parent: parent}
+	}
+	n := len(sc.names)
+	env := &Environment{
+		names:  sc.names[:n:n], // appending must not write to the scope
+		scope:  sc,
 		parent: parent,
 	}
+	if n <= len(env.inline) {
+		env.values = env.inline[:n]
+	} else {
+		env.values = make([]Value, n)
+	}
+	if n > indexAfter {
+		env.index = sc.index
+	}
+	return env
+}
+
+// next returns a copy of this environment's own bindings under the same
+// parent. A for loop runs each iteration in a copy so a closure created in
+// one iteration keeps that iteration's values.
+func (e *Environment) next() *Environment {
+	n := len(e.values)
+	env := &Environment{
+		names:  e.names[:n:n],
+		scope:  e.scope,
+		extra:  e.extra,
+		parent: e.parent,
+		index:  e.index,
+	}
+	if n <= len(env.inline) {
+		env.values = env.inline[:n]
+	} else {
+		env.values = make([]Value, n)
+	}
+	copy(env.values, e.values)
+	if e.consts != nil {
+		env.consts = append(make([]bool, 0, cap(e.consts)), e.consts...)
+	}
+	if e.index != nil && (e.scope == nil || e.extra) {
+		env.index = copyIndex(e.index) // only a scope's own index is shared
+	}
+	return env
+}
+
+// slot returns the slot of name in this environment alone, or -1.
+func (e *Environment) slot(name string) int {
+	if e.index != nil {
+		if k, ok := e.index[name]; ok {
+			return k
+		}
+		return -1
+	}
+	for k, n := range e.names {
+		if n == name {
+			return k
+		}
+	}
+	return -1
 }
 
 // Define declares a new variable in the current scope.
 func (e *Environment) Define(name string, value Value, isConst bool) error {
-	if _, exists := e.values[name]; exists {
+	k := e.slot(name)
+	if k >= 0 && e.values[k] != nil {
 		return fmt.Errorf("variable '%s' already declared in this scope", name)
 	}
-	e.values[name] = value
+	if k < 0 {
+		k = e.add(name)
+	}
+	e.values[k] = value
 	if isConst {
-		e.consts[name] = true
+		e.markConst(name)
 	}
 	return nil
 }
 
+// add appends a slot for name and returns it.
+func (e *Environment) add(name string) int {
+	k := len(e.names)
+	e.names = append(e.names, name)
+	e.values = append(e.values, nil)
+	if e.consts != nil {
+		e.consts = append(e.consts, false)
+	}
+	if e.scope != nil {
+		if !e.extra && e.index != nil {
+			e.index = copyIndex(e.index) // shared with the scope until now
+		}
+		e.extra = true
+	}
+	if e.index != nil {
+		e.index[name] = k
+	} else if len(e.names) > indexAfter {
+		e.index = make(map[string]int, len(e.names))
+		for idx := len(e.names) - 1; idx >= 0; idx-- {
+			e.index[e.names[idx]] = idx // the first slot wins for a repeated name
+		}
+	}
+	return k
+}
+
+func copyIndex(index map[string]int) map[string]int {
+	dup := make(map[string]int, len(index)+1)
+	for name, k := range index {
+		dup[name] = k
+	}
+	return dup
+}
+
+// lookup returns the value bound to name in this environment alone.
+func (e *Environment) lookup(name string) (Value, bool) {
+	if k := e.slot(name); k >= 0 && e.values[k] != nil {
+		return e.values[k], true
+	}
+	return nil, false
+}
+
+// isConst reports whether name is a constant of this environment alone.
+func (e *Environment) isConst(name string) bool {
+	k := e.slot(name)
+	return k >= 0 && e.consts != nil && e.consts[k]
+}
+
+// markConst makes the defined name of this environment a constant.
+func (e *Environment) markConst(name string) {
+	if k := e.slot(name); k >= 0 {
+		if e.consts == nil {
+			e.consts = make([]bool, len(e.names), cap(e.names))
+		}
+		e.consts[k] = true
+	}
+}
+
 // Get looks up a variable by walking the scope chain.
 func (e *Environment) Get(name string) (Value, bool) {
 	for env := e; env != nil; env = env.parent {
-		if val, exists := env.values[name]; exists {
+		if val, ok := env.lookup(name); ok {
 			return val, true
 		}
 	}
@@ -43,13 +183,44 @@ func (e *Environment) Get(name string) (Value, bool) {
 // Set assigns to an existing variable. Returns an error if not found or const.
 func (e *Environment) Set(name string, value Value) error {
 	for env := e; env != nil; env = env.parent {
-		if _, exists := env.values[name]; exists {
-			if env.consts[name] {
-				return fmt.Errorf("cannot assign to constant '%s'", name)
-			}
-			env.values[name] = value
-			return nil
+		if k := env.slot(name); k >= 0 && env.values[k] != nil {
+			return env.setSlot(k, value)
 		}
 	}
 	return fmt.Errorf("undefined variable '%s'", name)
 }
+
+// setSlot assigns to the defined slot k.
+func (e *Environment) setSlot(k int, value Value) error {
+	if e.consts != nil && e.consts[k] {
+		return fmt.Errorf("cannot assign to constant '%s'", e.names[k])
+	}
+	e.values[k] = value
+	return nil
+}
+
+// bindings calls fn for each name defined in this environment alone, in
+// the order of their slots.
+func (e *Environment) bindings(fn func(name string, val Value)) {
+	for k, name := range e.names {
+		if e.values[k] != nil {
+			fn(name, e.values[k])
+		}
+	}
+}
+
+// Names returns every name visible from this scope, sorted.
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for env := e; env != nil; env = env.parent {
+		env.bindings(func(name string, _ Value) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		})
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"sync"
+)
+
+// ============================================================
+// Error classes
+// ============================================================
+
+// errorClassesSource declares the built-in error classes. Each takes an
+// optional message; name is the class's own name and stack is filled in
+// when the error is thrown.
+const errorClassesSource = `class Error {
+    constructor(...args) {
+        this.name = "Error"
+        this.message = len(args) > 0 ? "" + args[0] : ""
+        this.stack = ""
+    }
+}
+class TypeError extends Error {
+    constructor(...args) {
+        super(...args)
+        this.name = "TypeError"
+    }
+}
+class RangeError extends Error {
+    constructor(...args) {
+        super(...args)
+        this.name = "RangeError"
+    }
+}
+class AssertionError extends Error {
+    constructor(...args) {
+        super(...args)
+        this.name = "AssertionError"
+    }
+}
+`
+
+// errorClasses parses errorClassesSource once; every interpreter declares
+// its classes from the same nodes, so instanceof matches errors made by
+// modules and workers too.
+var errorClasses = sync.OnceValue(func() *ast.File {
+	tokens, _ := lexer.New(errorClassesSource, "<builtin>").Tokenize()
+	file, diags := parser.New(tokens).ParseFile()
+	if len(diags) > 0 {
+		panic("builtin error classes: " + diags[0].String())
+	}
+	return file
+})
+
+// registerErrorClasses declares Error, TypeError, RangeError and
+// AssertionError as constants.
+func (i *Interpreter) registerErrorClasses() {
+	for _, node := range errorClasses().Body {
+		if _, err := i.execNode(node); err != nil {
+			panic("builtin error classes: " + err.Error())
+		}
+		i.global.markConst(node.(*ast.ClassDecl).Name)
+	}
+}
+
+// isError reports whether obj is an instance of Error or a subclass.
+func isError(obj *ObjectVal) bool {
+	return extendsDecl(obj.Class, errorClasses().Body[0].(*ast.ClassDecl))
+}
+
+// errorString formats an error as "name: message", or just the name when
+// the message is empty.
+func errorString(obj *ObjectVal) string {
+	name := "Error"
+	if n, ok := obj.Props["name"]; ok {
+		name = n.String()
+	}
+	msg, ok := obj.Props["message"]
+	if !ok || msg == StringVal("") {
+		return name
+	}
+	return name + ": " + msg.String()
+}
+
+// newError makes an instance of a built-in error class without running its
+// constructor, for values the interpreter wraps in an error.
+func (i *Interpreter) newError(class, message, stack string) *ObjectVal {
+	cls, _ := i.global.Get(class)
+	return &ObjectVal{Class: cls.(*ClassVal), Props: map[string]Value{
+		"name":    StringVal(class),
+		"message": StringVal(message),
+		"stack":   StringVal(stack),
+	}}
+}
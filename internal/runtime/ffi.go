@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ffi"
+)
+
+// ============================================================
+// C interop (ffiOpen / ffiFunc)
+// ============================================================
+
+// LibraryVal is a shared library opened with ffiOpen.
+type LibraryVal struct {
+	lib *ffi.Library
+}
+
+func (v *LibraryVal) TypeName() string { return "library" }
+func (v *LibraryVal) String() string   { return fmt.Sprintf("<library %s>", v.lib.Path) }
+
+// AllowFFI enables ffiOpen and ffiFunc. Foreign calls bypass every safety
+// guarantee of the interpreter, so hosts must opt in explicitly.
+func (i *Interpreter) AllowFFI() {
+	i.ffiAllowed = true
+}
+
+// registerFFIBuiltins adds the FFI functions, which check the interpreter's opt-in.
+func (i *Interpreter) registerFFIBuiltins() {
+	i.global.Define("ffiOpen", &BuiltinVal{
+		Name:      "ffiOpen",
+		Signature: "ffiOpen(path)",
+		Doc:       "Open a shared library (requires --allow-ffi).",
+		Fn: func(args []Value) (Value, error) {
+			if !i.ffiAllowed {
+				return nil, fmt.Errorf("ffiOpen(): FFI is disabled; run with --allow-ffi to enable it")
+			}
+			if len(args) != 1 {
+				return nil, fmt.Errorf("ffiOpen() expects 1 argument, got %d", len(args))
+			}
+			path, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("ffiOpen() argument must be a library path, got '%s'", args[0].TypeName())
+			}
+			lib, err := ffi.Open(string(path))
+			if err != nil {
+				return nil, err
+			}
+			return &LibraryVal{lib: lib}, nil
+		},
+	}, true)
+
+	i.global.Define("ffiFunc", &BuiltinVal{
+		Name:      "ffiFunc",
+		Signature: "ffiFunc(library, name, signature)",
+		Doc:       "Bind a C function, e.g. ffiFunc(lib, \"cos\", \"double(double)\").",
+		Fn: func(args []Value) (Value, error) {
+			if !i.ffiAllowed {
+				return nil, fmt.Errorf("ffiFunc(): FFI is disabled; run with --allow-ffi to enable it")
+			}
+			if len(args) != 3 {
+				return nil, fmt.Errorf("ffiFunc() expects 3 arguments, got %d", len(args))
+			}
+			lib, ok := args[0].(*LibraryVal)
+			if !ok {
+				return nil, fmt.Errorf("ffiFunc() first argument must be a library, got '%s'", args[0].TypeName())
+			}
+			name, ok1 := args[1].(StringVal)
+			sigText, ok2 := args[2].(StringVal)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("ffiFunc() expects a symbol name and a signature string")
+			}
+			sig, err := ffi.ParseSignature(string(sigText))
+			if err != nil {
+				return nil, err
+			}
+			fn, err := lib.lib.Func(string(name), sig)
+			if err != nil {
+				return nil, err
+			}
+			return &BuiltinVal{
+				Name:      string(name),
+				Signature: fmt.Sprintf("%s %s", name, sigText),
+				Doc:       fmt.Sprintf("C function from %s.", lib.lib.Path),
+				Fn: func(args []Value) (Value, error) {
+					return callForeign(fn, args)
+				},
+			}, nil
+		},
+	}, true)
+}
+
+// callForeign converts arguments to the foreign signature, calls fn and
+// converts the result back.
+func callForeign(fn *ffi.Func, args []Value) (Value, error) {
+	if len(args) != len(fn.Sig.Params) {
+		return nil, fmt.Errorf("%s() expects %d argument(s), got %d", fn.Name, len(fn.Sig.Params), len(args))
+	}
+	cargs := make([]interface{}, len(args))
+	for idx, typ := range fn.Sig.Params {
+		switch typ {
+		case ffi.Int:
+			n, ok := args[idx].(IntVal)
+			if !ok {
+				return nil, fmt.Errorf("%s() argument %d must be int, got '%s'", fn.Name, idx+1, args[idx].TypeName())
+			}
+			cargs[idx] = int64(n)
+		case ffi.Double:
+			f, ok := ToFloat64(args[idx])
+			if !ok {
+				return nil, fmt.Errorf("%s() argument %d must be a number, got '%s'", fn.Name, idx+1, args[idx].TypeName())
+			}
+			cargs[idx] = f
+		case ffi.String:
+			s, ok := args[idx].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("%s() argument %d must be string, got '%s'", fn.Name, idx+1, args[idx].TypeName())
+			}
+			cargs[idx] = string(s)
+		}
+	}
+
+	out, err := fn.Call(cargs)
+	if err != nil {
+		return nil, err
+	}
+	switch v := out.(type) {
+	case int64:
+		return IntVal(v), nil
+	case float64:
+		return FloatVal(v), nil
+	case string:
+		return StringVal(v), nil
+	default:
+		return NullVal{}, nil
+	}
+}
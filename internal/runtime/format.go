@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================
+// printf-style formatting (format() and string.format())
+// ============================================================
+
+// A format pattern holds text and verbs of the form
+// %[flags][width][.precision]verb, with flags from "-+ 0#":
+//
+//	%d        integer            %x %X %o %b  integer in base 16, 8 or 2
+//	%f %e %g  number             %s           string
+//	%q        quoted string      %v           any value, as print() shows it
+//	%%        a literal percent sign
+//
+// Widths count characters, so "%-8s" lines up columns of non-ASCII text.
+// A verb given the wrong type, or a pattern given too few or too many
+// arguments, is an error naming the verb and argument.
+
+// formatValues fills the verbs of pattern with args.
+func formatValues(pattern string, args []Value) (string, error) {
+	var b strings.Builder
+	next := 0
+	for idx := 0; idx < len(pattern); idx++ {
+		c := pattern[idx]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		start := idx
+		idx++
+		for idx < len(pattern) && strings.IndexByte("-+ 0#", pattern[idx]) >= 0 {
+			idx++
+		}
+		for idx < len(pattern) && '0' <= pattern[idx] && pattern[idx] <= '9' {
+			idx++
+		}
+		if idx < len(pattern) && pattern[idx] == '.' {
+			idx++
+			for idx < len(pattern) && '0' <= pattern[idx] && pattern[idx] <= '9' {
+				idx++
+			}
+		}
+		if idx >= len(pattern) {
+			return "", fmt.Errorf("format(): incomplete verb '%s' at the end of the pattern", pattern[start:])
+		}
+		spec, verb := pattern[start:idx+1], pattern[idx]
+		if verb == '%' {
+			if spec != "%%" {
+				return "", fmt.Errorf("format(): '%s' takes no flags, width or precision", spec)
+			}
+			b.WriteByte('%')
+			continue
+		}
+		if strings.IndexByte("dxXobfFeEgGsqv", verb) < 0 {
+			return "", fmt.Errorf("format(): unknown verb '%s'", spec)
+		}
+		if next >= len(args) {
+			return "", fmt.Errorf("format(): verb '%s' has no argument; %d given", spec, len(args))
+		}
+		arg := args[next]
+		next++
+		operand, err := formatOperand(verb, arg)
+		if err != nil {
+			return "", fmt.Errorf("format(): verb '%s' %s, got '%s' (argument %d)", spec, err, arg.TypeName(), next)
+		}
+		fmt.Fprintf(&b, spec, operand)
+	}
+	if extra := len(args) - next; extra > 0 {
+		return "", fmt.Errorf("format(): %d argument%s left over; the pattern has %d verb%s", extra, pluralS(extra), next, pluralS(next))
+	}
+	return b.String(), nil
+}
+
+// formatOperand converts arg to the Go value verb prints, or reports what
+// verb expects.
+func formatOperand(verb byte, arg Value) (any, error) {
+	switch verb {
+	case 'd', 'x', 'X', 'o', 'b':
+		if n, ok := arg.(IntVal); ok {
+			return int64(n), nil
+		}
+		return nil, fmt.Errorf("expects an integer")
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		if f, ok := ToFloat64(arg); ok {
+			return f, nil
+		}
+		return nil, fmt.Errorf("expects a number")
+	case 's', 'q':
+		if s, ok := arg.(StringVal); ok {
+			return string(s), nil
+		}
+		return nil, fmt.Errorf("expects a string")
+	default: // 'v'
+		return arg.String(), nil
+	}
+}
+
+// pluralS returns "s" unless n is 1.
+func pluralS(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import "fmt"
+
+// ============================================================
+// Frozen values
+// ============================================================
+//
+// const only stops a name from being reassigned: const xs = [1, 2] can
+// still be changed with xs.push(3). freeze(v) makes the arrays, maps, sets
+// and objects in v read-only, so assigning to an element, key or property
+// of one, or calling a method that changes it, is a catchable error.
+// clone() of a frozen value returns a copy that can be changed.
+
+// registerFreezeBuiltins adds freeze() and isFrozen().
+func (i *Interpreter) registerFreezeBuiltins() {
+	i.global.Define("freeze", &BuiltinVal{
+		Name:      "freeze",
+		Signature: "freeze(value)",
+		Doc: "Make the arrays, maps, sets and objects in value read-only, including those nested in it, and return value. " +
+			"Changing them afterwards is an error.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("freeze() expects 1 argument, got %d", len(args))
+			}
+			freeze(args[0])
+			return args[0], nil
+		},
+	}, true)
+
+	i.global.Define("isFrozen", &BuiltinVal{
+		Name:      "isFrozen",
+		Signature: "isFrozen(value)",
+		Doc:       "Report whether value is an array, map, set or object made read-only by freeze().",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("isFrozen() expects 1 argument, got %d", len(args))
+			}
+			return BoolVal(isFrozen(args[0])), nil
+		},
+	}, true)
+}
+
+// freeze makes v and the containers reachable from it read-only. A value
+// that is already frozen is skipped, so cycles terminate.
+func freeze(v Value) {
+	switch val := v.(type) {
+	case *ArrayVal:
+		if !val.frozen {
+			val.frozen = true
+			for _, elem := range val.Elements {
+				freeze(elem)
+			}
+		}
+	case *MapVal:
+		if !val.frozen {
+			val.frozen = true
+			for _, elem := range val.Values {
+				freeze(elem)
+			}
+		}
+	case *SetVal:
+		if !val.frozen {
+			val.frozen = true
+			for _, item := range val.Items {
+				freeze(item)
+			}
+		}
+	case *ObjectVal:
+		if !val.frozen {
+			val.frozen = true
+			for _, prop := range val.Props {
+				freeze(prop)
+			}
+		}
+	}
+}
+
+func isFrozen(v Value) bool {
+	switch val := v.(type) {
+	case *ArrayVal:
+		return val.frozen
+	case *MapVal:
+		return val.frozen
+	case *SetVal:
+		return val.frozen
+	case *ObjectVal:
+		return val.frozen
+	}
+	return false
+}
+
+// mutable returns an error when v is frozen.
+func mutable(v Value) error {
+	if isFrozen(v) {
+		return fmt.Errorf("cannot modify a frozen %s", v.TypeName())
+	}
+	return nil
+}
+
+// mutators holds, by type name, the methods that change their receiver.
+var mutators = map[string]map[string]bool{
+	"array": {
+		"push": true, "pop": true, "shift": true, "unshift": true, "insert": true, "splice": true,
+		"fill": true, "reverse": true, "sort": true, "sortBy": true, "sortDesc": true,
+	},
+	"map": {"delete": true},
+	"set": {"add": true, "delete": true},
+}
@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// File system (fs namespace)
+// ============================================================
+
+// DisableFS turns off the fs namespace and readBytes/writeBytes, for hosts
+// embedding scripts that must not touch the file system. Their calls then
+// fail with a catchable error. Modules, workers and parallel tasks started
+// afterwards inherit the setting.
+func (i *Interpreter) DisableFS() {
+	i.fsDisabled = true
+}
+
+// checkFS fails when the host has disabled file system access.
+func (i *Interpreter) checkFS(fn string) error {
+	if i.fsDisabled {
+		return fmt.Errorf("%s(): file system access is disabled", fn)
+	}
+	return nil
+}
+
+// registerFSBuiltins adds the fs namespace. Paths are relative to the
+// working directory, and failures are errors that try/catch can handle.
+func (i *Interpreter) registerFSBuiltins() {
+	members := make(map[string]Value)
+	// strArgs checks the capability and that full got nargs strings.
+	strArgs := func(full string, nargs int, args []Value) ([]string, error) {
+		if len(args) != nargs {
+			plural := "s"
+			if nargs == 1 {
+				plural = ""
+			}
+			return nil, fmt.Errorf("%s() expects %d argument%s, got %d", full, nargs, plural, len(args))
+		}
+		strs := make([]string, nargs)
+		for idx, arg := range args {
+			s, ok := arg.(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("%s() expects string arguments, got '%s'", full, arg.TypeName())
+			}
+			strs[idx] = string(s)
+		}
+		return strs, i.checkFS(full)
+	}
+	type fsFunc struct {
+		sig   string
+		nargs int
+		fn    func(args []string) (Value, error)
+	}
+	funcs := make(map[string]fsFunc)
+	// define adds fs.name, which checks its arguments with strArgs before
+	// running fn.
+	define := func(name, sig, doc string, nargs int, fn func(args []string) (Value, error)) {
+		full := "fs." + name
+		funcs[name] = fsFunc{sig, nargs, fn}
+		members[name] = &BuiltinVal{Name: full, Signature: "fs." + sig, Doc: doc, Fn: func(args []Value) (Value, error) {
+			strs, err := strArgs(full, nargs, args)
+			if err != nil {
+				return nil, err
+			}
+			val, err := fn(strs)
+			if err != nil {
+				return nil, fmt.Errorf("%s(): %v", full, err)
+			}
+			return val, nil
+		}}
+	}
+
+	define("readFile", "readFile(path)", "Return the contents of the file at path as a string.", 1, func(args []string) (Value, error) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return StringVal(data), nil
+	})
+	define("writeFile", "writeFile(path, text)", "Write text to the file at path, replacing it, and return the number of bytes written.", 2, func(args []string) (Value, error) {
+		if err := os.WriteFile(args[0], []byte(args[1]), 0o644); err != nil {
+			return nil, err
+		}
+		return IntVal(len(args[1])), nil
+	})
+	define("appendFile", "appendFile(path, text)", "Append text to the file at path, creating it if needed, and return the number of bytes written.", 2, func(args []string) (Value, error) {
+		f, err := os.OpenFile(args[0], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		n, err := f.WriteString(args[1])
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return IntVal(n), nil
+	})
+	define("exists", "exists(path)", "Report whether a file or directory exists at path.", 1, func(args []string) (Value, error) {
+		_, err := os.Stat(args[0])
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return BoolVal(err == nil), nil
+	})
+	define("listDir", "listDir(path)", "Return the sorted names of the entries in the directory at path.", 1, func(args []string) (Value, error) {
+		entries, err := os.ReadDir(args[0])
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(entries))
+		for idx, entry := range entries {
+			names[idx] = entry.Name()
+		}
+		sort.Strings(names)
+		elements := make([]Value, len(names))
+		for idx, name := range names {
+			elements[idx] = StringVal(name)
+		}
+		return &ArrayVal{Elements: elements}, nil
+	})
+	define("remove", "remove(path)", "Delete the file or empty directory at path.", 1, func(args []string) (Value, error) {
+		return NullVal{}, os.Remove(args[0])
+	})
+	define("mkdir", "mkdir(path)", "Create the directory at path along with any missing parents.", 1, func(args []string) (Value, error) {
+		return NullVal{}, os.MkdirAll(args[0], 0o755)
+	})
+
+	// Async versions run on their own goroutine and return a promise, so
+	// an async function can await them while other work goes on
+	for _, name := range []string{"readFile", "writeFile", "appendFile", "listDir"} {
+		full, f := "fs."+name+"Async", funcs[name]
+		members[name+"Async"] = perInterp(i, func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      full,
+				Signature: full + strings.TrimPrefix(f.sig, name),
+				Doc:       "Like fs." + name + ", but return a promise of the result.",
+				Fn: func(args []Value) (Value, error) {
+					strs, err := strArgs(full, f.nargs, args)
+					if err != nil {
+						return nil, err
+					}
+					return i.goAsync(func() (Value, error) {
+						val, err := f.fn(strs)
+						if err != nil {
+							return nil, fmt.Errorf("%s(): %v", full, err)
+						}
+						return val, nil
+					}), nil
+				},
+			}
+		})
+	}
+
+	i.defineNamespace("fs", "File system functions, e.g. fs.readFile(path). Hosts can turn them off.", members)
+}
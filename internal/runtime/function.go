@@ -0,0 +1,208 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+	"strings"
+)
+
+// ============================================================
+// Function values
+// ============================================================
+//
+// Reading a method without calling it, as in var f = obj.method, returns
+// the method bound to obj, so f(x) runs it with 'this' set to obj like
+// obj.method(x) does. Bound methods can be passed to map(), forEach() and
+// anything else that takes a callback. fn.bind(obj, args...) binds 'this'
+// in a function the same way, and args go before those of each call.
+//
+// Functions, builtins and bound functions also have fn.call(args...) and
+// fn.apply(array), which call them with the given arguments, fn.name and
+// fn.arity, the number of arguments they require.
+
+// BoundFuncVal is a method bound to its object or a function made by bind().
+type BoundFuncVal struct {
+	This Value
+	Args []Value // passed before the arguments of each call
+
+	method *ast.MethodDecl // the method bound, declared by class
+	class  *ClassVal
+	fn     Value // the function bound, when method is nil
+	interp *Interpreter
+}
+
+func (v *BoundFuncVal) TypeName() string { return "function" }
+func (v *BoundFuncVal) String() string {
+	if v.method != nil {
+		return fmt.Sprintf("<bound method %s.%s>", v.class.Decl.Name, v.method.Name)
+	}
+	return fmt.Sprintf("<bound function %s>", v.Name())
+}
+
+// Name returns the name of the method or function bound.
+func (v *BoundFuncVal) Name() string {
+	if v.method != nil {
+		return v.method.Name
+	}
+	name, _ := callableName("bind", v.fn)
+	return name
+}
+
+// Params returns the parameters left after the bound arguments.
+func (v *BoundFuncVal) Params() []string {
+	var params []string
+	switch fn := v.fn.(type) {
+	case nil:
+		params = v.method.Params
+	case *FuncVal:
+		params = fn.Params
+	case Callable:
+		params = fn.Params()
+	}
+	bound := len(v.Args)
+	if required := len(params); v.Variadic() && bound >= required {
+		bound = required - 1 // the rest parameter takes any number
+	} else if bound > required {
+		bound = required
+	}
+	return params[bound:]
+}
+
+// Variadic reports whether the last parameter collects the remaining
+// arguments.
+func (v *BoundFuncVal) Variadic() bool {
+	if v.method != nil {
+		return v.method.Rest
+	}
+	return isVariadic(v.fn)
+}
+
+// Call calls the function with the bound 'this' and arguments.
+func (v *BoundFuncVal) Call(args []Value) (Value, error) {
+	return v.interp.callBound(v, args, span.Span{})
+}
+
+// boundMethod returns obj's method name bound to obj, or nil if its class
+// has no such method.
+func (i *Interpreter) boundMethod(obj *ObjectVal, name string) *BoundFuncVal {
+	method, cls := findMethod(obj.Class, name)
+	if method == nil {
+		return nil
+	}
+	return &BoundFuncVal{This: obj, method: method, class: cls, interp: i}
+}
+
+func (i *Interpreter) callBound(b *BoundFuncVal, args []Value, s span.Span) (Value, error) {
+	if len(b.Args) > 0 {
+		args = append(append([]Value(nil), b.Args...), args...)
+	}
+	switch fn := b.fn.(type) {
+	case nil:
+		return i.runMethod(b.This.(*ObjectVal), b.class, b.method, args, s)
+	case *FuncVal:
+		// Run it in an environment defining 'this' between the call and the closure
+		env := NewEnvironment(fn.Closure)
+		env.Define("this", b.This, true)
+		bound := *fn
+		bound.Closure = env
+		return i.callFunc(&bound, args, s)
+	default:
+		return i.callValue(fn, args, s)
+	}
+}
+
+// callFunctionMethod calls a method of a function, builtin or bound function.
+func (i *Interpreter) callFunctionMethod(fn Value, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "call":
+		return i.callValue(fn, args, s)
+	case "apply":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "apply() expects 1 argument, got %d", len(args))
+		}
+		arr, ok := args[0].(*ArrayVal)
+		if !ok {
+			return nil, runtimeErr(s, "apply() argument must be an array, got '%s'", args[0].TypeName())
+		}
+		return i.callValue(fn, append([]Value(nil), arr.Elements...), s)
+	case "bind":
+		if len(args) == 0 {
+			return nil, runtimeErr(s, "bind() expects at least 1 argument, got 0")
+		}
+		return &BoundFuncVal{This: args[0], Args: append([]Value(nil), args[1:]...), fn: fn, interp: i}, nil
+	default:
+		return nil, runtimeErr(s, "function has no method '%s'", name)
+	}
+}
+
+// variadic is implemented by a Callable that can take a rest parameter.
+type variadic interface {
+	Variadic() bool
+}
+
+func isVariadic(fn Value) bool {
+	switch f := fn.(type) {
+	case *FuncVal:
+		return f.Rest
+	case variadic:
+		return f.Variadic()
+	}
+	return false
+}
+
+// requiredArgs returns the number of arguments a function requires, or -1
+// for a builtin, whose parameters only its signature describes.
+func requiredArgs(fn Value) int {
+	var n int
+	switch f := fn.(type) {
+	case *FuncVal:
+		n = len(f.Params)
+	case Callable:
+		n = len(f.Params())
+	default:
+		return -1
+	}
+	if isVariadic(fn) {
+		n-- // not counting the rest parameter
+	}
+	return n
+}
+
+// functionProp reads fn.name or fn.arity.
+func functionProp(fn Value, name string) (Value, error) {
+	switch name {
+	case "name":
+		fnName, err := callableName("name", fn)
+		return StringVal(fnName), err
+	case "arity":
+		if builtin, ok := fn.(*BuiltinVal); ok {
+			return IntVal(signatureArity(builtin.Signature)), nil
+		}
+		return IntVal(requiredArgs(fn)), nil
+	}
+	return nil, fmt.Errorf("function has no property '%s'", name)
+}
+
+// signatureArity counts the required parameters in a builtin's signature,
+// leaving out optional ones like "message?" and variadic ones like
+// "values...". Only the first form of a signature such as
+// "range(end) or range(start, end, step?)" is counted.
+func signatureArity(sig string) int {
+	open := strings.IndexByte(sig, '(')
+	if open < 0 {
+		return 0
+	}
+	params := sig[open+1:]
+	if end := strings.IndexByte(params, ')'); end >= 0 {
+		params = params[:end]
+	}
+	n := 0
+	for _, param := range strings.Split(params, ",") {
+		param = strings.TrimSpace(param)
+		if param != "" && !strings.HasSuffix(param, "?") && !strings.HasSuffix(param, "...") {
+			n++
+		}
+	}
+	return n
+}
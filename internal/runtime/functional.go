@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"strings"
+)
+
+// ============================================================
+// Function combinators (curry / compose / pipe)
+// ============================================================
+
+// registerFunctionalBuiltins adds curry(), compose() and pipe(), whose
+// results call back into the interpreter.
+func (i *Interpreter) registerFunctionalBuiltins() {
+	i.global.Define("curry", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "curry",
+			Signature: "curry(fn, arity?)",
+			Doc:       "Return fn taking its arguments one or more at a time; builtins need an explicit arity.",
+			Fn: func(args []Value) (Value, error) {
+				if len(args) < 1 || len(args) > 2 {
+					return nil, fmt.Errorf("curry() expects 1-2 arguments, got %d", len(args))
+				}
+				name, err := callableName("curry", args[0])
+				if err != nil {
+					return nil, err
+				}
+				arity := requiredArgs(args[0]) // curry up to the required arguments
+				if len(args) == 2 {
+					n, ok := args[1].(IntVal)
+					if !ok || n < 0 {
+						return nil, fmt.Errorf("curry() arity must be a non-negative integer")
+					}
+					arity = int(n)
+				}
+				if arity < 0 {
+					return nil, fmt.Errorf("curry() needs an arity for builtin '%s'", name)
+				}
+				return i.curry(args[0], name, arity, nil), nil
+			},
+		}
+	}), true)
+
+	i.global.Define("compose", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "compose",
+			Signature: "compose(fns...)",
+			Doc:       "Return a function applying fns right to left: compose(f, g)(x) is f(g(x)).",
+			Fn: func(args []Value) (Value, error) {
+				fns := make([]Value, len(args))
+				for idx, fn := range args {
+					fns[len(args)-1-idx] = fn
+				}
+				return i.chain("compose", fns)
+			},
+		}
+	}), true)
+
+	i.global.Define("pipe", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "pipe",
+			Signature: "pipe(fns...)",
+			Doc:       "Return a function applying fns left to right: pipe(f, g)(x) is g(f(x)).",
+			Fn: func(args []Value) (Value, error) {
+				return i.chain("pipe", append([]Value(nil), args...))
+			},
+		}
+	}), true)
+}
+
+// callableName returns the name of a function or builtin, or an error naming
+// the combinator that was given something else.
+func callableName(combinator string, v Value) (string, error) {
+	switch fn := v.(type) {
+	case *FuncVal:
+		return fn.Name, nil
+	case *BuiltinVal:
+		return fn.Name, nil
+	case Callable:
+		return fn.Name(), nil
+	default:
+		return "", fmt.Errorf("%s() expects functions, got '%s'", combinator, v.TypeName())
+	}
+}
+
+// curry returns a builtin that collects arguments for fn until it has arity
+// of them and then calls it. Each partial application gets its own copy of
+// the collected arguments, so a partial can be reused.
+func (i *Interpreter) curry(fn Value, name string, arity int, collected []Value) *BuiltinVal {
+	return &BuiltinVal{
+		Name:      name,
+		Signature: fmt.Sprintf("%s(%d more)", name, arity-len(collected)),
+		Doc:       fmt.Sprintf("Curried %s.", name),
+		Fn: func(args []Value) (Value, error) {
+			if len(args) == 0 && arity > len(collected) {
+				return nil, fmt.Errorf("curried %s() expects at least 1 argument", name)
+			}
+			all := append(append([]Value(nil), collected...), args...)
+			if len(all) < arity {
+				return i.curry(fn, name, arity, all), nil
+			}
+			return i.callValue(fn, all, span.Span{})
+		},
+		rebind: func(c *copier) *BuiltinVal {
+			return c.interp.curry(c.copyValue(fn), name, arity, c.copyValues(collected))
+		},
+	}
+}
+
+// chain returns a builtin that passes its arguments to fns[0] and each
+// result on to the next function. With no functions it returns its single
+// argument unchanged.
+func (i *Interpreter) chain(combinator string, fns []Value) (Value, error) {
+	names := make([]string, len(fns))
+	for idx, fn := range fns {
+		name, err := callableName(combinator, fn)
+		if err != nil {
+			return nil, err
+		}
+		names[idx] = name
+	}
+	return &BuiltinVal{
+		Name:      combinator,
+		Signature: combinator + "(args...)",
+		Doc:       fmt.Sprintf("Calls %s in turn.", strings.Join(names, ", ")),
+		rebind: func(c *copier) *BuiltinVal {
+			b, _ := c.interp.chain(combinator, c.copyValues(fns)) // fns were checked above
+			return b.(*BuiltinVal)
+		},
+		Fn: func(args []Value) (Value, error) {
+			if len(fns) == 0 {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("empty %s() expects 1 argument, got %d", combinator, len(args))
+				}
+				return args[0], nil
+			}
+			result, err := i.callValue(fns[0], args, span.Span{})
+			for _, fn := range fns[1:] {
+				if err != nil {
+					return nil, err
+				}
+				result, err = i.callValue(fn, []Value{result}, span.Span{})
+			}
+			return result, err
+		},
+	}, nil
+}
@@ -0,0 +1,184 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+)
+
+// ============================================================
+// Generators
+// ============================================================
+//
+// Calling a function whose body contains yield returns a generator instead
+// of running the body. The body runs on its own goroutine, handing control
+// back and forth with the caller over two channels so that only one side
+// runs at a time: next() sends a resume and waits for the next yield or for
+// the body to finish. A generator that is dropped while suspended keeps its
+// goroutine parked until the program exits; for-of closes the generators it
+// leaves early.
+
+// GeneratorVal is a suspended function body producing values with yield.
+type GeneratorVal struct {
+	Name  string
+	body  *ast.BlockStmt
+	env   *Environment // parameters and 'this' of the call that made it
+	sub   *Interpreter // runs body, so its env and call stack stay separate
+	state generatorState
+
+	resume chan generatorResume // caller -> body
+	yield  chan generatorYield  // body -> caller
+}
+
+func (v *GeneratorVal) TypeName() string { return "generator" }
+func (v *GeneratorVal) String() string   { return fmt.Sprintf("<generator %s>", v.Name) }
+
+type generatorState int
+
+const (
+	generatorNew generatorState = iota
+	generatorSuspended
+	generatorRunning
+	generatorDone
+)
+
+// generatorResume carries the value yield evaluates to, or asks the body to
+// unwind. The body of an async function is resumed with err set when the
+// promise it awaits was rejected.
+type generatorResume struct {
+	value Value
+	err   error
+	close bool
+}
+
+// generatorYield carries a yielded value, or with done set the body's
+// return value or error.
+type generatorYield struct {
+	value Value
+	done  bool
+	err   error
+}
+
+// generatorClosed unwinds the body of a closed generator from the yield it
+// is suspended at. try/catch does not catch it.
+type generatorClosed struct{}
+
+func (generatorClosed) Error() string { return "generator closed" }
+
+// newGenerator returns a generator that will run body in env.
+func (i *Interpreter) newGenerator(name string, body *ast.BlockStmt, env *Environment) *GeneratorVal {
+	g := &GeneratorVal{
+		Name:   name,
+		body:   body,
+		env:    env,
+		sub:    i.fork(),
+		resume: make(chan generatorResume),
+		yield:  make(chan generatorYield),
+	}
+	g.sub.generator = g
+	return g
+}
+
+// resumeGenerator runs g until its next yield or its end, passing msg to the
+// yield it is suspended at. Steps count against the caller's budget.
+func (i *Interpreter) resumeGenerator(g *GeneratorVal, msg generatorResume, s span.Span) (generatorYield, error) {
+	switch g.state {
+	case generatorDone:
+		return generatorYield{value: NullVal{}, done: true}, nil
+	case generatorRunning:
+		return generatorYield{}, runtimeErr(s, "generator '%s' is already running", g.Name)
+	case generatorNew:
+		if msg.close {
+			g.state = generatorDone
+			return generatorYield{value: NullVal{}, done: true}, nil
+		}
+		g.state = generatorRunning
+		g.sub.steps = i.steps
+		go g.run()
+	default:
+		g.state = generatorRunning
+		g.sub.steps = i.steps
+		g.resume <- msg
+	}
+	y := <-g.yield
+	i.steps = g.sub.steps
+	g.state = generatorSuspended
+	if y.done {
+		g.state = generatorDone
+	}
+	if _, closed := y.err.(generatorClosed); closed {
+		y.err = nil
+	}
+	return y, y.err
+}
+
+// run executes the body on the generator's goroutine and reports how it
+// ended.
+func (g *GeneratorVal) run() {
+	result, err := g.sub.execBlock(g.body, g.env)
+	var val Value = NullVal{}
+	if err == nil && result.Signal == SigReturn {
+		val = result.Value
+	}
+	g.yield <- generatorYield{value: val, done: true, err: err}
+}
+
+// evalYield hands a value to the caller of next() and waits to be resumed.
+func (i *Interpreter) evalYield(e *ast.YieldExpr) (Value, error) {
+	g := i.generator
+	if g == nil {
+		return nil, runtimeErr(e.GetSpan(), "yield outside a generator")
+	}
+	var val Value = NullVal{}
+	if e.Value != nil {
+		v, err := i.evalExpr(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		val = v
+	}
+	g.yield <- generatorYield{value: val}
+	msg := <-g.resume
+	if msg.close {
+		return nil, generatorClosed{}
+	}
+	return msg.value, nil
+}
+
+// closeGenerator stops a suspended generator, unwinding its body.
+func (i *Interpreter) closeGenerator(g *GeneratorVal, s span.Span) error {
+	if g.state == generatorRunning {
+		return runtimeErr(s, "generator '%s' is already running", g.Name)
+	}
+	_, err := i.resumeGenerator(g, generatorResume{close: true}, s)
+	return err
+}
+
+// callGeneratorMethod dispatches methods on a generator.
+func (i *Interpreter) callGeneratorMethod(g *GeneratorVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "next":
+		if len(args) > 1 {
+			return nil, runtimeErr(s, "next() expects 0-1 arguments, got %d", len(args))
+		}
+		var sent Value = NullVal{}
+		if len(args) == 1 {
+			sent = args[0]
+		}
+		y, err := i.resumeGenerator(g, generatorResume{value: sent}, s)
+		if err != nil {
+			return nil, err
+		}
+		return &MapVal{
+			Keys:   []string{"value", "done"},
+			Values: map[string]Value{"value": y.value, "done": BoolVal(y.done)},
+		}, nil
+	case "close":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "close() expects 0 arguments, got %d", len(args))
+		}
+		return NullVal{}, i.closeGenerator(g, s)
+	default:
+		return nil, runtimeErr(s, "generator has no method '%s'", name)
+	}
+}
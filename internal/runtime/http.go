@@ -0,0 +1,303 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"light-lang/internal/span"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// HTTP server (http namespace)
+// ============================================================
+
+// http.serve(port, handler) answers each request by calling handler with a
+// request map and turning what it returns into the response. Go serves
+// connections concurrently, but handler calls take turns on the
+// interpreter, one request at a time, so handlers may share script state
+// such as counters or caches. serve returns only when a handler calls
+// exit(), the run's timeout passes or the run is cancelled.
+
+// registerHTTPBuiltins adds the http namespace.
+func (i *Interpreter) registerHTTPBuiltins() {
+	i.defineNamespace("http", "A small HTTP server for webhooks and demos, and an async client.", map[string]Value{
+		"serve": perInterp(i, func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      "http.serve",
+				Signature: "http.serve(port, handler)",
+				Doc: "Serve HTTP on port (or a \"host:port\" string), calling handler(request) for each request. " +
+					"request has method, path, query, headers and body; handler returns a body string or a map of " +
+					"status, headers and body, where a body that is not a string is sent as JSON.",
+				Fn: i.httpServe,
+			}
+		}),
+		"fetch": perInterp(i, func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      "http.fetch",
+				Signature: "http.fetch(url, options?)",
+				Doc: "Send a request and return a promise of a response map with status, headers and body. " +
+					"options may give method (default \"GET\"), headers and body, where a body that is not a string is sent as JSON.",
+				Fn: i.httpFetch,
+			}
+		}),
+	})
+}
+
+// httpFetch implements http.fetch(). The request is built right away, so
+// bad arguments are errors; sending it happens on its own goroutine and
+// network failures reject the promise.
+func (i *Interpreter) httpFetch(args []Value) (Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("http.fetch() expects 1-2 arguments, got %d", len(args))
+	}
+	url, ok := args[0].(StringVal)
+	if !ok {
+		return nil, fmt.Errorf("http.fetch() url must be a string, got '%s'", args[0].TypeName())
+	}
+	method, headers, body := "GET", map[string]string{}, ""
+	if len(args) == 2 {
+		opts, ok := args[1].(*MapVal)
+		if !ok {
+			return nil, fmt.Errorf("http.fetch() options must be a map, got '%s'", args[1].TypeName())
+		}
+		if v, ok := opts.Values["method"]; ok {
+			m, ok := v.(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("http.fetch() method must be a string, got '%s'", v.TypeName())
+			}
+			method = strings.ToUpper(string(m))
+		}
+		if v, ok := opts.Values["headers"]; ok {
+			h, ok := v.(*MapVal)
+			if !ok {
+				return nil, fmt.Errorf("http.fetch() headers must be a map, got '%s'", v.TypeName())
+			}
+			for _, name := range h.Keys {
+				headers[http.CanonicalHeaderKey(name)] = h.Values[name].String()
+			}
+		}
+		switch b := opts.Values["body"].(type) {
+		case nil, NullVal:
+		case StringVal:
+			body = string(b)
+		default:
+			enc := &jsonEncoder{interp: i, path: make(map[Value]bool)}
+			if err := enc.write(b, 0); err != nil {
+				return nil, fmt.Errorf("http.fetch() body: %v", err)
+			}
+			body = enc.b.String()
+			if _, set := headers["Content-Type"]; !set {
+				headers["Content-Type"] = "application/json"
+			}
+		}
+	}
+	req, err := http.NewRequest(method, string(url), strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("http.fetch(): %v", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	client := &http.Client{}
+	if !i.deadline.IsZero() {
+		client.Timeout = time.Until(i.deadline)
+	}
+	return i.goAsync(func() (Value, error) {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("http.fetch(): %v", err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("http.fetch(): %v", err)
+		}
+		respHeaders := &MapVal{Values: make(map[string]Value)}
+		for _, name := range sortedKeys(resp.Header) {
+			key := strings.ToLower(name)
+			respHeaders.Keys = append(respHeaders.Keys, key)
+			respHeaders.Values[key] = StringVal(strings.Join(resp.Header[name], ", "))
+		}
+		return &MapVal{
+			Keys: []string{"status", "headers", "body"},
+			Values: map[string]Value{
+				"status":  IntVal(resp.StatusCode),
+				"headers": respHeaders,
+				"body":    StringVal(data),
+			},
+		}, nil
+	}), nil
+}
+
+// httpServe implements http.serve().
+func (i *Interpreter) httpServe(args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("http.serve() expects 2 arguments, got %d", len(args))
+	}
+	var addr string
+	switch port := args[0].(type) {
+	case IntVal:
+		addr = ":" + strconv.FormatInt(int64(port), 10)
+	case StringVal:
+		addr = string(port)
+	default:
+		return nil, fmt.Errorf("http.serve() port must be an integer or a \"host:port\" string, got '%s'", args[0].TypeName())
+	}
+	handler := args[1]
+	switch handler.(type) {
+	case *FuncVal, *BuiltinVal, Callable:
+	default:
+		return nil, fmt.Errorf("http.serve() handler must be a function, got '%s'", handler.TypeName())
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("http.serve(): %v", err)
+	}
+	var mu sync.Mutex           // one handler call at a time
+	stop := make(chan error, 1) // the exit() that ends serving
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := httpRequestMap(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		result, err := i.callValue(handler, []Value{req}, span.Span{})
+		if err == nil {
+			err = i.writeHTTPResponse(w, result)
+		}
+		mu.Unlock()
+		var exit *ExitError
+		if errors.As(err, &exit) {
+			select {
+			case stop <- err:
+			default:
+			}
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	var timeout <-chan time.Time
+	if !i.deadline.IsZero() {
+		timeout = time.After(time.Until(i.deadline))
+	}
+	select {
+	case err = <-stop:
+	case <-timeout:
+		err = fmt.Errorf("timeout of %s exceeded", i.limits.Timeout)
+	case <-i.interrupt.Done():
+		err = i.interrupted(span.Span{})
+	case err = <-served:
+		err = fmt.Errorf("http.serve(): %v", err)
+	}
+	srv.Close()
+	return nil, err
+}
+
+// httpRequestMap describes r for a handler. Header names are lower case
+// and repeated headers are joined with ", "; query holds the first value
+// of each parameter.
+func httpRequestMap(r *http.Request) (*MapVal, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	query := &MapVal{Values: make(map[string]Value)}
+	params := r.URL.Query()
+	for _, name := range sortedKeys(params) {
+		query.Keys = append(query.Keys, name)
+		query.Values[name] = StringVal(params.Get(name))
+	}
+	headers := &MapVal{Values: make(map[string]Value)}
+	for _, name := range sortedKeys(r.Header) {
+		key := strings.ToLower(name)
+		headers.Keys = append(headers.Keys, key)
+		headers.Values[key] = StringVal(strings.Join(r.Header[name], ", "))
+	}
+	return &MapVal{
+		Keys: []string{"method", "path", "query", "headers", "body"},
+		Values: map[string]Value{
+			"method":  StringVal(r.Method),
+			"path":    StringVal(r.URL.Path),
+			"query":   query,
+			"headers": headers,
+			"body":    StringVal(body),
+		},
+	}, nil
+}
+
+// writeHTTPResponse sends what a handler returned: a string is a 200
+// text/plain body, null an empty 204, and a map gives status (default
+// 200), headers and body.
+func (i *Interpreter) writeHTTPResponse(w http.ResponseWriter, result Value) error {
+	status := http.StatusOK
+	body := result
+	switch res := result.(type) {
+	case NullVal:
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case *MapVal:
+		body = res.Values["body"]
+		if v, ok := res.Values["status"]; ok {
+			n, ok := v.(IntVal)
+			if !ok || n < 100 || n > 999 {
+				return fmt.Errorf("http.serve() response status must be an integer from 100 to 999, got %s", v)
+			}
+			status = int(n)
+		}
+		if v, ok := res.Values["headers"]; ok {
+			headers, ok := v.(*MapVal)
+			if !ok {
+				return fmt.Errorf("http.serve() response headers must be a map, got '%s'", v.TypeName())
+			}
+			for _, name := range headers.Keys {
+				w.Header().Set(name, headers.Values[name].String())
+			}
+		}
+	}
+
+	var text string
+	switch b := body.(type) {
+	case nil, NullVal:
+	case StringVal:
+		text = string(b)
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	default:
+		enc := &jsonEncoder{interp: i, path: make(map[Value]bool)}
+		if err := enc.write(b, 0); err != nil {
+			return fmt.Errorf("http.serve() response body: %v", err)
+		}
+		text = enc.b.String()
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, text) // a client that hung up is not the script's error
+	return nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
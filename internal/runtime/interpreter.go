@@ -3,11 +3,16 @@ package runtime
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"light-lang/internal/ast"
 	"light-lang/internal/span"
 	"light-lang/internal/token"
+	"math"
+	"slices"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // ============================================================
@@ -54,43 +59,170 @@ func runtimeErr(s span.Span, format string, args ...interface{}) *RuntimeError {
 type ThrownError struct {
 	Value Value
 	Span  span.Span
+	Stack []Frame // calls active at the throw, innermost last
 }
 
 func (e *ThrownError) Error() string {
 	return fmt.Sprintf("uncaught throw at %d:%d: %s", e.Span.Start.Line, e.Span.Start.Column, e.Value.String())
 }
 
+// stackTraceEdge is how many lines a long stack trace keeps at each end.
+const stackTraceEdge = 10
+
+// StackTrace lists where the throw happened and the calls leading to it,
+// innermost first, one "at name (line:col)" line each. The middle of a
+// very deep stack, such as runaway recursion, is left out.
+func (e *ThrownError) StackTrace() string {
+	lines := make([]string, 0, len(e.Stack)+1)
+	at := e.Span
+	for idx := len(e.Stack) - 1; idx >= 0; idx-- {
+		lines = append(lines, fmt.Sprintf("  at %s (%d:%d)\n", e.Stack[idx].Name, at.Start.Line, at.Start.Column))
+		at = e.Stack[idx].Span
+	}
+	lines = append(lines, fmt.Sprintf("  at <script> (%d:%d)\n", at.Start.Line, at.Start.Column))
+	if omitted := len(lines) - 2*stackTraceEdge; omitted > 1 {
+		kept := append(lines[:stackTraceEdge:stackTraceEdge], fmt.Sprintf("  ... %d more calls\n", omitted))
+		lines = append(kept, lines[len(lines)-stackTraceEdge:]...)
+	}
+	return strings.Join(lines, "")
+}
+
+// Frame is an active call: the function, method or constructor called and
+// the span of the call expression.
+type Frame struct {
+	Name string
+	Span span.Span
+}
+
 // ============================================================
 // Interpreter
 // ============================================================
 
 // Interpreter walks the AST and executes it.
 type Interpreter struct {
-	global *Environment
-	env    *Environment
-	output io.Writer
+	global   *Environment
+	env      *Environment
+	res      *resolution // slots of the code running, see resolve.go
+	output   io.Writer
+	builtins *Environment // scope of the builtins, the parent of global
+
+	timers   timerQueue // pending setTimeout/setInterval callbacks
+	timerSeq int64
+	firing   *timer     // timer whose callback is currently running
+	loop     *eventLoop // promise jobs and async I/O, shared with forks and modules
+
+	dir        string          // directory relative imports resolve from
+	projectDir string          // entry file directory, where light.sum is looked up
+	modules    *moduleCache    // loaded modules, shared with imported modules
+	imported   map[string]bool // global names bound by import statements
+	fsys       fs.FS           // embedded filesystem imports read from, or nil for disk
+	ffiAllowed bool            // host opted in to ffiOpen/ffiFunc
+	fsDisabled bool            // host turned off the fs namespace and readBytes/writeBytes
+	args       []string        // script arguments returned by args()
+	random     *randomSource   // generator for random(), shared with imported modules
+
+	strictIndex    bool // reading a missing map key or property is an error
+	strictEquality bool // == and != never treat an int and a float as equal
+	strict         bool // implicit conversions are errors, see SetStrict
+
+	limits     Limits        // execution budget set by SetLimits
+	heapValues *atomic.Int64 // values charged against limits.MaxHeapValues
+	interrupt  *interruption // set when the context of RunContext is done
+	deadline   time.Time     // when limits.Timeout runs out, or zero
+	steps      int64         // work done so far, checked against limits.MaxSteps
+	frames     []Frame       // active calls, innermost last; checked against limits.MaxCallDepth
+
+	exited   bool // the script ended with a top-level return or exit()
+	exitCode int  // its exit code, reported by ExitCode
+
+	generator *GeneratorVal // generator whose body this interpreter runs, for yield
 }
 
 // NewInterpreter creates a new interpreter with built-in functions registered.
-func NewInterpreter(output io.Writer) *Interpreter {
+func NewInterpreter(output io.Writer, opts ...Option) *Interpreter {
+	// Output may be written from parallel workers, so serialize it
+	output = &lockedWriter{w: output}
 	global := NewEnvironment(nil)
 	RegisterBuiltins(global, output)
-	return &Interpreter{
-		global: global,
-		env:    global,
-		output: output,
-	}
+	interp := &Interpreter{
+		global:    global,
+		env:       global,
+		output:    output,
+		modules:   &moduleCache{byPath: make(map[string]*module)},
+		imported:  make(map[string]bool),
+		loop:      newEventLoop(),
+		interrupt: new(interruption),
+	}
+	interp.registerTimerBuiltins()
+	interp.registerParallelBuiltins()
+	interp.registerWorkerBuiltins()
+	interp.registerFFIBuiltins()
+	interp.registerRandomBuiltins()
+	interp.registerMathBuiltins()
+	interp.registerMemoizeBuiltins()
+	interp.registerFunctionalBuiltins()
+	interp.registerBinaryBuiltins()
+	interp.registerFSBuiltins()
+	interp.registerTimeBuiltins()
+	interp.registerNumberBuiltins()
+	interp.registerRangeBuiltins()
+	interp.registerAssertBuiltins()
+	interp.registerHTTPBuiltins()
+	interp.registerConcurrencyBuiltins()
+	interp.registerAsyncBuiltins()
+	interp.registerProcessBuiltins()
+	interp.registerTextBuiltins()
+	interp.registerSetBuiltins()
+	interp.registerBuilderBuiltins()
+	interp.registerFreezeBuiltins()
+	interp.registerDeepBuiltins()
+	interp.registerJSONBuiltins()
+	interp.registerDocBuiltins()
+	interp.registerIntrospectBuiltins()
+	interp.registerDynamicBuiltins()
+	interp.registerErrorClasses()
+	// The script declares into a scope of its own below the builtins, so
+	// var set = ... or function format() { ... } shadows a builtin
+	interp.builtins = global
+	interp.global = NewEnvironment(global)
+	interp.env = interp.global
+	for _, opt := range opts {
+		opt(interp)
+	}
+	return interp
+}
+
+// Run executes the entire AST file. An internal failure is returned as a
+// runtime error rather than a panic.
+func (i *Interpreter) Run(file *ast.File) (err error) {
+	defer i.useResolution(resolve(file))()
+	return i.run(file)
 }
 
-// Run executes the entire AST file.
-func (i *Interpreter) Run(file *ast.File) error {
-	for _, node := range file.Body {
+// run executes file with the current resolution.
+func (i *Interpreter) run(file *ast.File) (err error) {
+	var node ast.Node
+	defer recoverInternal(&node, &err)
+
+	if hasDirective(file, strictIndexDirective) {
+		i.strictIndex = true
+	}
+	if hasDirective(file, strictEqualityDirective) {
+		i.strictEquality = true
+	}
+	if hasDirective(file, strictDirective) {
+		i.strict = true
+	}
+	for _, node = range file.Body {
 		result, err := i.execNode(node)
 		if err != nil {
+			if i.exitRequested(err) {
+				return nil
+			}
 			return err
 		}
 		if result.Signal == SigReturn {
-			return runtimeErr(node.GetSpan(), "return outside of function")
+			return i.exit(result.Value, node.GetSpan())
 		}
 		if result.Signal == SigBreak {
 			return runtimeErr(node.GetSpan(), "break outside of loop")
@@ -102,6 +234,65 @@ func (i *Interpreter) Run(file *ast.File) error {
 	return nil
 }
 
+// exit ends the script for a top-level return of val, which must be an
+// integer exit code or absent.
+func (i *Interpreter) exit(val Value, s span.Span) error {
+	code := 0
+	switch v := val.(type) {
+	case nil, NullVal:
+	case IntVal:
+		code = int(v)
+	default:
+		return runtimeErr(s, "top-level return value must be an integer exit code, got '%s'", val.TypeName())
+	}
+	i.exited, i.exitCode = true, code
+	return nil
+}
+
+// ExitCode returns the exit code set by a top-level return or exit(), or 0.
+func (i *Interpreter) ExitCode() int {
+	return i.exitCode
+}
+
+// Eval executes file like Run and returns the value of its final statement
+// when that statement is an expression, or null otherwise. Hosts such as
+// the RPC server use it to report a result for each evaluated snippet.
+func (i *Interpreter) Eval(file *ast.File) (val Value, err error) {
+	body := file.Body
+	var last *ast.ExprStmt
+	if n := len(body); n > 0 {
+		if es, ok := body[n-1].(*ast.ExprStmt); ok {
+			last = es
+			body = body[:n-1]
+		}
+	}
+	defer i.useResolution(resolve(file))()
+	if err := i.run(&ast.File{Body: body}); err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return NullVal{}, nil
+	}
+	var node ast.Node = last
+	defer recoverInternal(&node, &err)
+	return i.evalExpr(last.Expr)
+}
+
+// recoverInternal converts a panic inside the interpreter into a runtime
+// error at *node, so a bug or malformed tree cannot crash the host. It must
+// be deferred directly.
+func recoverInternal(node *ast.Node, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	var s span.Span
+	if *node != nil {
+		s = (*node).GetSpan()
+	}
+	*err = runtimeErr(s, "internal error: %v", r)
+}
+
 // Env returns the current environment (useful for REPL).
 func (i *Interpreter) Env() *Environment {
 	return i.env
@@ -112,6 +303,9 @@ func (i *Interpreter) Env() *Environment {
 // ============================================================
 
 func (i *Interpreter) execNode(node ast.Node) (ExecResult, error) {
+	if err := i.step(node.GetSpan()); err != nil {
+		return resultNone, err
+	}
 	switch n := node.(type) {
 	case *ast.FuncDecl:
 		return i.execFuncDecl(n)
@@ -183,7 +377,7 @@ func (i *Interpreter) execStmt(stmt ast.Stmt) (ExecResult, error) {
 		return i.execMatch(s)
 
 	case *ast.BlockStmt:
-		return i.execBlock(s, NewEnvironment(i.env))
+		return i.execBlock(s, i.blockEnv(s))
 
 	case *ast.FuncDecl:
 		return i.execFuncDecl(s)
@@ -191,6 +385,12 @@ func (i *Interpreter) execStmt(stmt ast.Stmt) (ExecResult, error) {
 	case *ast.ClassDecl:
 		return i.execClassDecl(s)
 
+	case *ast.ImportStmt:
+		return i.execImport(s)
+
+	case *ast.BadStmt:
+		return resultNone, runtimeErr(s.Span, "cannot run code with syntax errors")
+
 	default:
 		return resultNone, runtimeErr(stmt.GetSpan(), "unhandled statement type: %T", stmt)
 	}
@@ -205,100 +405,218 @@ func (i *Interpreter) execVarDecl(s *ast.VarDeclStmt) (ExecResult, error) {
 		}
 		val = v
 	}
+	if s.Pattern != nil {
+		return resultNone, i.definePattern(i.env, s.Pattern, val, s.IsConst)
+	}
+	if len(s.Names) > 0 {
+		return resultNone, i.defineUnpacked(s, val)
+	}
 	if err := i.env.Define(s.Name, val, s.IsConst); err != nil {
 		return resultNone, runtimeErr(s.GetSpan(), "%s", err)
 	}
 	return resultNone, nil
 }
 
+// defineUnpacked declares var a, b = val, which needs an array with one
+// element per name.
+func (i *Interpreter) defineUnpacked(s *ast.VarDeclStmt, val Value) error {
+	arr, ok := val.(*ArrayVal)
+	if !ok {
+		return runtimeErr(s.GetSpan(), "cannot unpack value of type '%s' into %d variables", val.TypeName(), len(s.Names))
+	}
+	if len(arr.Elements) != len(s.Names) {
+		return runtimeErr(s.GetSpan(), "cannot unpack %d values into %d variables", len(arr.Elements), len(s.Names))
+	}
+	for idx, name := range s.Names {
+		if err := i.env.Define(name, arr.Elements[idx], s.IsConst); err != nil {
+			return runtimeErr(s.GetSpan(), "%s", err)
+		}
+	}
+	return nil
+}
+
 func (i *Interpreter) execAssign(s *ast.AssignStmt) (ExecResult, error) {
-	val, err := i.evalExpr(s.Value)
+	switch s.Target.(type) {
+	case *ast.ArrayPattern, *ast.MapPattern:
+		val, err := i.evalExpr(s.Value)
+		if err != nil {
+			return resultNone, err
+		}
+		// Each target is assigned in turn after the whole value is computed,
+		// so [a, b] = [b, a] swaps.
+		return resultNone, i.bindPattern(s.Target, val, func(target ast.Expr, val Value) error {
+			return i.assign(target, val, target.GetSpan())
+		})
+	}
+	_, err := i.assignment(s.Target, s.Value, s.Op, s.GetSpan())
+	return resultNone, err
+}
+
+// assignment runs target = value, or target op= rhs when op is a compound
+// token, and returns the value stored.
+func (i *Interpreter) assignment(target, value ast.Expr, op token.Kind, sp span.Span) (Value, error) {
+	if op != token.ILLEGAL {
+		return i.compoundAssign(target, value.(*ast.BinaryExpr), sp)
+	}
+	val, err := i.evalExpr(value)
 	if err != nil {
-		return resultNone, err
+		return nil, err
 	}
+	return val, i.assign(target, val, sp)
+}
 
-	switch target := s.Target.(type) {
+// assign stores val in an identifier, member or index target, reporting
+// errors at sp.
+func (i *Interpreter) assign(target ast.Expr, val Value, sp span.Span) error {
+	switch target := target.(type) {
 	case *ast.IdentExpr:
-		if err := i.env.Set(target.Name, val); err != nil {
-			return resultNone, runtimeErr(s.GetSpan(), "%s", err)
+		if err := i.assignVar(target, val); err != nil {
+			return runtimeErr(sp, "%s", err)
 		}
 	case *ast.MemberExpr:
 		obj, err := i.evalExpr(target.Object)
 		if err != nil {
-			return resultNone, err
+			return err
 		}
-		switch o := obj.(type) {
-		case *ObjectVal:
-			o.Props[target.Property] = val
-		case *MapVal:
-			key := target.Property
-			if _, exists := o.Values[key]; !exists {
-				o.Keys = append(o.Keys, key)
-			}
-			o.Values[key] = val
-		default:
-			return resultNone, runtimeErr(s.GetSpan(), "cannot set property on value of type '%s'", obj.TypeName())
+		return i.storeMember(obj, target.Property, val, sp)
+	case *ast.IndexExpr:
+		obj, err := i.evalExpr(target.Object)
+		if err != nil {
+			return err
+		}
+		idx, err := i.evalExpr(target.Index)
+		if err != nil {
+			return err
+		}
+		return i.storeIndex(obj, idx, val, sp)
+	default:
+		return runtimeErr(sp, "invalid assignment target")
+	}
+	return nil
+}
+
+// compoundAssign runs target op= rhs. A member or index target's object
+// and index are evaluated once, before rhs, so a[next()] += 1 calls next()
+// a single time.
+func (i *Interpreter) compoundAssign(target ast.Expr, bin *ast.BinaryExpr, sp span.Span) (Value, error) {
+	switch target := target.(type) {
+	case *ast.MemberExpr:
+		obj, err := i.evalExpr(target.Object)
+		if err != nil {
+			return nil, err
 		}
+		cur, err := i.member(obj, target.Property, target.GetSpan())
+		if err != nil {
+			return nil, err
+		}
+		val, err := i.applyCompound(bin, cur)
+		if err != nil {
+			return nil, err
+		}
+		return val, i.storeMember(obj, target.Property, val, sp)
 	case *ast.IndexExpr:
 		obj, err := i.evalExpr(target.Object)
 		if err != nil {
-			return resultNone, err
+			return nil, err
 		}
 		idx, err := i.evalExpr(target.Index)
 		if err != nil {
-			return resultNone, err
+			return nil, err
 		}
-		switch o := obj.(type) {
-		case *ArrayVal:
-			idxInt, ok := ToInt64(idx)
-			if !ok {
-				return resultNone, runtimeErr(s.GetSpan(), "array index must be an integer")
-			}
-			if idxInt < 0 || int(idxInt) >= len(o.Elements) {
-				return resultNone, runtimeErr(s.GetSpan(), "array index %d out of range (length %d)", idxInt, len(o.Elements))
-			}
-			o.Elements[idxInt] = val
-		case *MapVal:
-			keyStr, ok := idx.(StringVal)
-			if !ok {
-				return resultNone, runtimeErr(s.GetSpan(), "map key must be a string, got '%s'", idx.TypeName())
-			}
-			key := string(keyStr)
-			if _, exists := o.Values[key]; !exists {
-				o.Keys = append(o.Keys, key)
-			}
-			o.Values[key] = val
-		default:
-			return resultNone, runtimeErr(s.GetSpan(), "cannot index-assign value of type '%s'", obj.TypeName())
+		cur, err := i.index(obj, idx, target.GetSpan())
+		if err != nil {
+			return nil, err
 		}
-	default:
-		return resultNone, runtimeErr(s.GetSpan(), "invalid assignment target")
+		val, err := i.applyCompound(bin, cur)
+		if err != nil {
+			return nil, err
+		}
+		return val, i.storeIndex(obj, idx, val, sp)
 	}
-	return resultNone, nil
+	val, err := i.evalExpr(bin)
+	if err != nil {
+		return nil, err
+	}
+	return val, i.assign(target, val, sp)
+}
+
+// applyCompound evaluates the right operand of a desugared compound
+// assignment and combines it with the target's current value.
+func (i *Interpreter) applyCompound(bin *ast.BinaryExpr, cur Value) (Value, error) {
+	right, err := i.evalExpr(bin.Right)
+	if err != nil {
+		return nil, err
+	}
+	return i.applyBinary(bin, cur, right)
+}
+
+// storeMember assigns obj.name = val, through a setter if the class has one.
+func (i *Interpreter) storeMember(obj Value, name string, val Value, sp span.Span) error {
+	if ok, err := i.setter(obj, name, val, sp); ok {
+		return err
+	}
+	if err := i.allocate(newKeys(obj, StringVal(name)), sp); err != nil {
+		return err
+	}
+	if err := SetMember(obj, name, val); err != nil {
+		return runtimeErr(sp, "%s", err)
+	}
+	return nil
+}
+
+// storeIndex assigns obj[idx] = val.
+func (i *Interpreter) storeIndex(obj, idx, val Value, sp span.Span) error {
+	if err := i.allocate(newKeys(obj, idx), sp); err != nil {
+		return err
+	}
+	if err := SetIndex(obj, idx, val); err != nil {
+		return runtimeErr(sp, "%s", err)
+	}
+	return nil
+}
+
+// newKeys reports whether storing key in obj adds a map key or object
+// property, as 1 or 0.
+func newKeys(obj, key Value) int {
+	name, ok := key.(StringVal)
+	if !ok {
+		return 0
+	}
+	switch o := obj.(type) {
+	case *MapVal:
+		if _, exists := o.Values[string(name)]; !exists {
+			return 1
+		}
+	case *ObjectVal:
+		if _, exists := o.Props[string(name)]; !exists {
+			return 1
+		}
+	}
+	return 0
 }
 
 func (i *Interpreter) execIf(s *ast.IfStmt) (ExecResult, error) {
-	cond, err := i.evalExpr(s.Condition)
+	cond, err := i.condition(s.Condition)
 	if err != nil {
 		return resultNone, err
 	}
 
-	if IsTruthy(cond) {
-		return i.execBlock(s.Body, NewEnvironment(i.env))
+	if cond {
+		return i.execBlock(s.Body, i.blockEnv(s.Body))
 	}
 
 	for _, elseIf := range s.ElseIfs {
-		cond, err := i.evalExpr(elseIf.Condition)
+		cond, err := i.condition(elseIf.Condition)
 		if err != nil {
 			return resultNone, err
 		}
-		if IsTruthy(cond) {
-			return i.execBlock(elseIf.Body, NewEnvironment(i.env))
+		if cond {
+			return i.execBlock(elseIf.Body, i.blockEnv(elseIf.Body))
 		}
 	}
 
 	if s.ElseBody != nil {
-		return i.execBlock(s.ElseBody, NewEnvironment(i.env))
+		return i.execBlock(s.ElseBody, i.blockEnv(s.ElseBody))
 	}
 
 	return resultNone, nil
@@ -306,15 +624,15 @@ func (i *Interpreter) execIf(s *ast.IfStmt) (ExecResult, error) {
 
 func (i *Interpreter) execWhile(s *ast.WhileStmt) (ExecResult, error) {
 	for {
-		cond, err := i.evalExpr(s.Condition)
+		cond, err := i.condition(s.Condition)
 		if err != nil {
 			return resultNone, err
 		}
-		if !IsTruthy(cond) {
+		if !cond {
 			break
 		}
 
-		result, err := i.execBlock(s.Body, NewEnvironment(i.env))
+		result, err := i.execBlock(s.Body, i.blockEnv(s.Body))
 		if err != nil {
 			return resultNone, err
 		}
@@ -330,6 +648,10 @@ func (i *Interpreter) execWhile(s *ast.WhileStmt) (ExecResult, error) {
 }
 
 func (i *Interpreter) execBlock(block *ast.BlockStmt, blockEnv *Environment) (ExecResult, error) {
+	// Count the block itself so empty loop bodies still use up steps
+	if err := i.step(block.Span); err != nil {
+		return resultNone, err
+	}
 	prevEnv := i.env
 	i.env = blockEnv
 	defer func() { i.env = prevEnv }()
@@ -352,7 +674,13 @@ func (i *Interpreter) execFuncDecl(s *ast.FuncDecl) (ExecResult, error) {
 		Params:  s.Params,
 		Body:    s.Body,
 		Closure: i.env,
+		Doc:     s.Doc,
+		Rest:    s.Rest,
+
+		Generator: s.Generator,
+		Async:     s.Async,
 	}
+	fn.scope, _ = i.scopeOf(s.Body)
 	if err := i.env.Define(s.Name, fn, false); err != nil {
 		return resultNone, runtimeErr(s.GetSpan(), "%s", err)
 	}
@@ -360,7 +688,7 @@ func (i *Interpreter) execFuncDecl(s *ast.FuncDecl) (ExecResult, error) {
 }
 
 func (i *Interpreter) execClassDecl(s *ast.ClassDecl) (ExecResult, error) {
-	cls := &ClassVal{Decl: s, Env: i.env}
+	cls := &ClassVal{Decl: s, Env: i.env, Statics: make(map[string]Value, len(s.Statics)+len(s.StaticMethods)), Consts: make(map[string]bool), interp: i}
 
 	// Resolve super class if extends is specified
 	if s.SuperClass != "" {
@@ -372,6 +700,9 @@ func (i *Interpreter) execClassDecl(s *ast.ClassDecl) (ExecResult, error) {
 		if !ok {
 			return resultNone, runtimeErr(s.GetSpan(), "'%s' is not a class", s.SuperClass)
 		}
+		if superCls.Decl.Record {
+			return resultNone, runtimeErr(s.GetSpan(), "cannot extend record '%s'", s.SuperClass)
+		}
 		cls.Super = superCls
 	}
 
@@ -403,9 +734,55 @@ func (i *Interpreter) execClassDecl(s *ast.ClassDecl) (ExecResult, error) {
 	if err := i.env.Define(s.Name, cls, false); err != nil {
 		return resultNone, runtimeErr(s.GetSpan(), "%s", err)
 	}
+
+	// Static methods are functions whose 'this' is the class itself
+	staticEnv := NewEnvironment(i.env)
+	staticEnv.Define("this", cls, true)
+	for _, m := range s.StaticMethods {
+		cls.Statics[m.Name] = &FuncVal{
+			Name:    s.Name + "." + m.Name,
+			Params:  m.Params,
+			Body:    m.Body,
+			Closure: staticEnv,
+			Doc:     m.Doc,
+			Rest:    m.Rest,
+
+			Generator: m.Generator,
+			Async:     m.Async,
+		}
+		cls.Consts[m.Name] = true
+	}
+
+	// Static initializers run after the class is bound so they can refer to it
+	for _, field := range s.Statics {
+		var val Value = NullVal{}
+		if field.Value != nil {
+			v, err := i.evalExpr(field.Value)
+			if err != nil {
+				return resultNone, err
+			}
+			val = v
+		}
+		cls.Statics[field.Name] = val
+		if field.IsConst {
+			cls.Consts[field.Name] = true
+		}
+	}
 	return resultNone, nil
 }
 
+// findStatic walks the class inheritance chain to find a static field.
+// It returns the class that owns the field so assignments update the right one.
+func findStatic(cls *ClassVal, name string) (Value, *ClassVal) {
+	for cls != nil {
+		if val, exists := cls.Statics[name]; exists {
+			return val, cls
+		}
+		cls = cls.Super
+	}
+	return nil, nil
+}
+
 func (i *Interpreter) execEnumDecl(s *ast.EnumDecl) (ExecResult, error) {
 	enumType := &EnumTypeVal{
 		Name:     s.Name,
@@ -457,26 +834,33 @@ func (i *Interpreter) evalExpr(expr ast.Expr) (Value, error) {
 		return i.evalUnary(e)
 	case *ast.BinaryExpr:
 		return i.evalBinary(e)
-	case *ast.CallExpr:
-		return i.evalCall(e)
-	case *ast.MemberExpr:
-		return i.evalMember(e)
-	case *ast.IndexExpr:
-		return i.evalIndex(e)
+	case *ast.CallExpr, *ast.MemberExpr, *ast.IndexExpr:
+		val, _, err := i.evalChain(e)
+		return val, err
 	case *ast.NewExpr:
 		return i.evalNew(e)
 	case *ast.ArrayLiteral:
 		return i.evalArrayLiteral(e)
 	case *ast.FuncExpr:
 		return i.evalFuncExpr(e)
+	case *ast.YieldExpr:
+		return i.evalYield(e)
+	case *ast.SpawnExpr:
+		return i.evalSpawn(e)
+	case *ast.AwaitExpr:
+		return i.evalAwait(e)
 	case *ast.TernaryExpr:
 		return i.evalTernary(e)
+	case *ast.AssignExpr:
+		return i.assignment(e.Target, e.Value, e.Op, e.Span)
 	case *ast.MapLiteral:
 		return i.evalMapLiteral(e)
 	case *ast.TemplateLiteral:
 		return i.evalTemplateLiteral(e)
 	case *ast.SuperExpr:
 		return nil, runtimeErr(e.GetSpan(), "super can only be used as super() or super.method()")
+	case *ast.BadExpr:
+		return nil, runtimeErr(e.Span, "cannot run code with syntax errors")
 	default:
 		return nil, runtimeErr(expr.GetSpan(), "unhandled expression type: %T", expr)
 	}
@@ -491,7 +875,7 @@ func (i *Interpreter) evalThis(e *ast.ThisExpr) (Value, error) {
 }
 
 func (i *Interpreter) evalIdent(e *ast.IdentExpr) (Value, error) {
-	val, ok := i.env.Get(e.Name)
+	val, ok := i.lookupVar(e)
 	if !ok {
 		return nil, runtimeErr(e.GetSpan(), "undefined variable '%s'", e.Name)
 	}
@@ -508,14 +892,17 @@ func (i *Interpreter) evalUnary(e *ast.UnaryExpr) (Value, error) {
 	case token.BANG:
 		return BoolVal(!IsTruthy(operand)), nil
 	case token.MINUS:
-		switch v := operand.(type) {
-		case IntVal:
-			return IntVal(-int64(v)), nil
-		case FloatVal:
-			return FloatVal(-float64(v)), nil
-		default:
-			return nil, runtimeErr(e.GetSpan(), "cannot negate value of type '%s'", operand.TypeName())
+		val, err := Negate(operand)
+		if err != nil {
+			return nil, runtimeErr(e.GetSpan(), "%s", err)
 		}
+		return val, nil
+	case token.TILDE:
+		v, ok := operand.(IntVal)
+		if !ok {
+			return nil, runtimeErr(e.GetSpan(), "'~' requires an integer operand, got '%s'", operand.TypeName())
+		}
+		return ^v, nil
 	default:
 		return nil, runtimeErr(e.GetSpan(), "unknown unary operator: %s", e.Op)
 	}
@@ -523,7 +910,7 @@ func (i *Interpreter) evalUnary(e *ast.UnaryExpr) (Value, error) {
 
 func (i *Interpreter) evalBinary(e *ast.BinaryExpr) (Value, error) {
 	// Short-circuit for logical operators
-	if e.Op == token.AND || e.Op == token.OR {
+	if e.Op == token.AND || e.Op == token.OR || e.Op == token.QUESTION_QUESTION {
 		return i.evalLogical(e)
 	}
 
@@ -535,9 +922,34 @@ func (i *Interpreter) evalBinary(e *ast.BinaryExpr) (Value, error) {
 	if err != nil {
 		return nil, err
 	}
+	return i.applyBinary(e, left, right)
+}
 
-	// String concatenation (auto-convert if one side is string)
+// applyBinary applies e's operator to already evaluated operands.
+func (i *Interpreter) applyBinary(e *ast.BinaryExpr, left, right Value) (Value, error) {
+	if i.strict {
+		if err := strictOperands(e.Op, left, right); err != nil {
+			return nil, runtimeErr(e.GetSpan(), "%s", err)
+		}
+	}
 	if e.Op == token.PLUS {
+		var err error
+		if left, right, err = i.stringOperands(left, right, e.GetSpan()); err != nil {
+			return nil, err
+		}
+	}
+	val, err := BinaryOp(i.equalityOp(e.Op), left, right)
+	if err != nil {
+		return nil, runtimeErr(e.GetSpan(), "%s", err)
+	}
+	return val, nil
+}
+
+// BinaryOp applies a non-short-circuit binary operator to two values. The
+// bytecode VM shares it so both backends compute the same results.
+func BinaryOp(op token.Kind, left, right Value) (Value, error) {
+	// String concatenation (auto-convert if one side is string)
+	if op == token.PLUS {
 		_, leftIsStr := left.(StringVal)
 		_, rightIsStr := right.(StringVal)
 		if leftIsStr || rightIsStr {
@@ -546,57 +958,56 @@ func (i *Interpreter) evalBinary(e *ast.BinaryExpr) (Value, error) {
 	}
 
 	// Equality (works for all types)
-	if e.Op == token.EQ {
+	if op == token.EQ {
 		return BoolVal(valuesEqual(left, right)), nil
 	}
-	if e.Op == token.NEQ {
+	if op == token.NEQ {
 		return BoolVal(!valuesEqual(left, right)), nil
 	}
+	if op == token.STRICT_EQ {
+		return BoolVal(strictEqual(left, right)), nil
+	}
+	if op == token.STRICT_NEQ {
+		return BoolVal(!strictEqual(left, right)), nil
+	}
+	if op == token.KW_INSTANCEOF {
+		return instanceOf(left, right)
+	}
+
+	// Bitwise operators and shifts work on integers only
+	switch op {
+	case token.AMP, token.PIPE, token.CARET, token.SHL, token.SHR:
+		return bitwiseOp(op, left, right)
+	}
 
 	// Numeric operations
 	leftF, leftOk := ToFloat64(left)
 	rightF, rightOk := ToFloat64(right)
 	if !leftOk || !rightOk {
-		return nil, runtimeErr(e.GetSpan(), "cannot apply '%s' to '%s' and '%s'", e.Op, left.TypeName(), right.TypeName())
+		return nil, fmt.Errorf("cannot apply '%s' to '%s' and '%s'", op, left.TypeName(), right.TypeName())
+	}
+	if l, ok := left.(IntVal); ok {
+		if r, ok := right.(IntVal); ok {
+			return intOp(op, l, r)
+		}
 	}
 
-	// Check if both are ints (for integer arithmetic)
-	_, leftIsInt := left.(IntVal)
-	_, rightIsInt := right.(IntVal)
-	bothInt := leftIsInt && rightIsInt
-
-	switch e.Op {
+	switch op {
 	case token.PLUS:
-		if bothInt {
-			return IntVal(int64(leftF) + int64(rightF)), nil
-		}
 		return FloatVal(leftF + rightF), nil
 	case token.MINUS:
-		if bothInt {
-			return IntVal(int64(leftF) - int64(rightF)), nil
-		}
 		return FloatVal(leftF - rightF), nil
 	case token.STAR:
-		if bothInt {
-			return IntVal(int64(leftF) * int64(rightF)), nil
-		}
 		return FloatVal(leftF * rightF), nil
 	case token.SLASH:
 		if rightF == 0 {
-			return nil, runtimeErr(e.GetSpan(), "division by zero")
-		}
-		if bothInt {
-			return IntVal(int64(leftF) / int64(rightF)), nil
+			return nil, fmt.Errorf("division by zero")
 		}
 		return FloatVal(leftF / rightF), nil
 	case token.PERCENT:
-		if !bothInt {
-			return nil, runtimeErr(e.GetSpan(), "modulo requires integer operands")
-		}
-		if int64(rightF) == 0 {
-			return nil, runtimeErr(e.GetSpan(), "division by zero")
-		}
-		return IntVal(int64(leftF) % int64(rightF)), nil
+		return nil, fmt.Errorf("modulo requires integer operands")
+	case token.STAR_STAR:
+		return FloatVal(math.Pow(leftF, rightF)), nil
 	case token.LT:
 		return BoolVal(leftF < rightF), nil
 	case token.LTE:
@@ -606,7 +1017,148 @@ func (i *Interpreter) evalBinary(e *ast.BinaryExpr) (Value, error) {
 	case token.GTE:
 		return BoolVal(leftF >= rightF), nil
 	default:
-		return nil, runtimeErr(e.GetSpan(), "unknown binary operator: %s", e.Op)
+		return nil, fmt.Errorf("unknown binary operator: %s", op)
+	}
+}
+
+// bitwiseOp applies &, |, ^, << or >> to two integers. >> is an arithmetic
+// shift, keeping the sign of a negative left operand. A << that loses bits
+// of the left operand is an overflow, like the arithmetic operators.
+func bitwiseOp(op token.Kind, left, right Value) (Value, error) {
+	l, leftOk := left.(IntVal)
+	r, rightOk := right.(IntVal)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("'%s' requires integer operands, got '%s' and '%s'", op, left.TypeName(), right.TypeName())
+	}
+	switch op {
+	case token.AMP:
+		return l & r, nil
+	case token.PIPE:
+		return l | r, nil
+	case token.CARET:
+		return l ^ r, nil
+	}
+	if r < 0 {
+		return nil, fmt.Errorf("negative shift count %d", r)
+	}
+	if op == token.SHL {
+		shifted := l << uint64(r)
+		if shifted>>uint64(r) != l {
+			return nil, fmt.Errorf("integer overflow: %d << %d does not fit in 64 bits", l, r)
+		}
+		return shifted, nil
+	}
+	return l >> uint64(r), nil
+}
+
+// intOp applies an arithmetic or comparison operator to two ints. A result
+// that does not fit in 64 bits is an error rather than wrapping around.
+func intOp(op token.Kind, l, r IntVal) (Value, error) {
+	a, b := int64(l), int64(r)
+	switch op {
+	case token.PLUS:
+		sum := a + b
+		if b > 0 && sum < a || b < 0 && sum > a {
+			return nil, overflow(op, l, r)
+		}
+		return IntVal(sum), nil
+	case token.MINUS:
+		diff := a - b
+		if b > 0 && diff > a || b < 0 && diff < a {
+			return nil, overflow(op, l, r)
+		}
+		return IntVal(diff), nil
+	case token.STAR:
+		product, ok := mulInt(a, b)
+		if !ok {
+			return nil, overflow(op, l, r)
+		}
+		return IntVal(product), nil
+	case token.SLASH, token.PERCENT:
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == token.PERCENT {
+			return IntVal(a % b), nil
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, overflow(op, l, r)
+		}
+		return IntVal(a / b), nil
+	case token.STAR_STAR:
+		// An int raised to a non-negative int stays an int; a negative
+		// exponent gives a float.
+		if b < 0 {
+			return FloatVal(math.Pow(float64(a), float64(b))), nil
+		}
+		result, ok := intPow(a, b)
+		if !ok {
+			return nil, overflow(op, l, r)
+		}
+		return IntVal(result), nil
+	case token.LT:
+		return BoolVal(a < b), nil
+	case token.LTE:
+		return BoolVal(a <= b), nil
+	case token.GT:
+		return BoolVal(a > b), nil
+	case token.GTE:
+		return BoolVal(a >= b), nil
+	default:
+		return nil, fmt.Errorf("unknown binary operator: %s", op)
+	}
+}
+
+// overflow reports an int operation whose result does not fit in 64 bits.
+func overflow(op token.Kind, l, r IntVal) error {
+	return fmt.Errorf("integer overflow: %d %s %d does not fit in 64 bits (convert an operand with toFloat() to compute approximately)", l, op, r)
+}
+
+// mulInt multiplies a and b, reporting whether the product fits.
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	if product/b != a || a == -1 && b == math.MinInt64 || b == -1 && a == math.MinInt64 {
+		return 0, false
+	}
+	return product, true
+}
+
+// intPow raises base to a non-negative exponent by repeated squaring,
+// reporting whether the result fits.
+func intPow(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for {
+		var ok bool
+		if exp&1 == 1 {
+			if result, ok = mulInt(result, base); !ok {
+				return 0, false
+			}
+		}
+		if exp >>= 1; exp == 0 {
+			return result, true
+		}
+		if base, ok = mulInt(base, base); !ok {
+			return 0, false
+		}
+	}
+}
+
+// Negate returns -v for a number. Negating the smallest int is an overflow
+// error. The bytecode VM shares it with the interpreter.
+func Negate(v Value) (Value, error) {
+	switch n := v.(type) {
+	case IntVal:
+		if n == math.MinInt64 {
+			return nil, fmt.Errorf("integer overflow: -(%d) does not fit in 64 bits", n)
+		}
+		return -n, nil
+	case FloatVal:
+		return -n, nil
+	default:
+		return nil, fmt.Errorf("cannot negate value of type '%s'", v.TypeName())
 	}
 }
 
@@ -621,6 +1173,12 @@ func (i *Interpreter) evalLogical(e *ast.BinaryExpr) (Value, error) {
 		}
 		return i.evalExpr(e.Right)
 	}
+	if e.Op == token.QUESTION_QUESTION {
+		if _, isNull := left.(NullVal); !isNull {
+			return left, nil // short-circuit
+		}
+		return i.evalExpr(e.Right)
+	}
 	// AND
 	if !IsTruthy(left) {
 		return left, nil // short-circuit
@@ -628,53 +1186,215 @@ func (i *Interpreter) evalLogical(e *ast.BinaryExpr) (Value, error) {
 	return i.evalExpr(e.Right)
 }
 
-func (i *Interpreter) evalCall(e *ast.CallExpr) (Value, error) {
-	// Evaluate arguments
-	args := make([]Value, len(e.Args))
-	for idx, argExpr := range e.Args {
+// evalArgs evaluates call arguments, passing the elements of a spread
+// array, ...arr, as separate arguments.
+func (i *Interpreter) evalArgs(exprs []ast.Expr) ([]Value, error) {
+	args := make([]Value, 0, len(exprs))
+	for _, argExpr := range exprs {
+		spread, isSpread := argExpr.(*ast.SpreadExpr)
+		if isSpread {
+			argExpr = spread.Operand
+		}
 		val, err := i.evalExpr(argExpr)
 		if err != nil {
 			return nil, err
 		}
-		args[idx] = val
+		if !isSpread {
+			args = append(args, val)
+			continue
+		}
+		arr, ok := val.(*ArrayVal)
+		if !ok {
+			return nil, runtimeErr(spread.GetSpan(), "cannot spread value of type '%s' into arguments, expected an array", val.TypeName())
+		}
+		args = append(args, arr.Elements...)
+	}
+	return args, nil
+}
+
+// arityOK reports whether got arguments suit params, the last of which
+// collects any further arguments when rest is set.
+func arityOK(params []string, rest bool, got int) bool {
+	if rest {
+		return got >= len(params)-1
+	}
+	return got == len(params)
+}
+
+// arity describes how many arguments params take, for error messages.
+func arity(params []string, rest bool) string {
+	if rest {
+		return fmt.Sprintf("at least %d arguments", len(params)-1)
+	}
+	return fmt.Sprintf("%d arguments", len(params))
+}
+
+// bindParams defines params in env from args, which arityOK accepted. A
+// rest parameter gets the remaining arguments as an array.
+func bindParams(env *Environment, params []string, rest bool, args []Value) {
+	for idx, param := range params {
+		if rest && idx == len(params)-1 {
+			env.Define(param, &ArrayVal{Elements: append([]Value{}, args[idx:]...)}, false)
+			break
+		}
+		env.Define(param, args[idx], false)
+	}
+}
+
+// evalChain evaluates a call, member or index expression. short reports
+// that an optional link of the chain found null: the result is then null,
+// and the links around it evaluate to null without running.
+func (i *Interpreter) evalChain(e ast.Expr) (val Value, short bool, err error) {
+	switch x := e.(type) {
+	case *ast.CallExpr:
+		return i.evalCall(x)
+	case *ast.MemberExpr:
+		return i.evalMember(x)
+	case *ast.IndexExpr:
+		return i.evalIndex(x)
+	default:
+		val, err := i.evalExpr(e)
+		return val, false, err
+	}
+}
+
+// evalChainObject evaluates the object of an optional chain link,
+// reporting short when the chain stops there: an earlier link short
+// circuited, or the link is optional and the object is null.
+func (i *Interpreter) evalChainObject(object ast.Expr, optional bool) (Value, bool, error) {
+	obj, short, err := i.evalChain(object)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, isNull := obj.(NullVal); short || optional && isNull {
+		return NullVal{}, true, nil
+	}
+	return obj, false, nil
+}
+
+func (i *Interpreter) evalCall(e *ast.CallExpr) (Value, bool, error) {
+	args, err := i.evalArgs(e.Args)
+	if err != nil {
+		return nil, false, err
 	}
 
 	// Check for super() or super.method() calls
 	if _, isSuper := e.Callee.(*ast.SuperExpr); isSuper {
-		return i.callSuperConstructor(args, e.GetSpan())
+		val, err := i.callSuperConstructor(args, e.GetSpan())
+		return val, false, err
 	}
 	if member, ok := e.Callee.(*ast.MemberExpr); ok {
 		if _, isSuper := member.Object.(*ast.SuperExpr); isSuper {
-			return i.callSuperMethod(member.Property, args, e.GetSpan())
+			val, err := i.callSuperMethod(member.Property, args, e.GetSpan())
+			return val, false, err
 		}
 	}
 
 	// Check for method call: obj.method(args)
 	if member, ok := e.Callee.(*ast.MemberExpr); ok {
-		obj, err := i.evalExpr(member.Object)
-		if err != nil {
-			return nil, err
-		}
-
-		switch o := obj.(type) {
-		case *ObjectVal:
-			return i.callMethod(o, member.Property, args, e.GetSpan())
-		case *ArrayVal:
-			return i.callArrayMethod(o, member.Property, args, e.GetSpan())
-		case StringVal:
-			return i.callStringMethod(string(o), member.Property, args, e.GetSpan())
-		default:
-			return nil, runtimeErr(e.GetSpan(), "cannot call method on value of type '%s'", obj.TypeName())
+		obj, short, err := i.evalChainObject(member.Object, member.Optional)
+		if err != nil || short {
+			return obj, short, err
+		}
+		// obj.method?.(args) skips objects with no such method or property
+		if o, ok := obj.(*ObjectVal); ok && e.Optional {
+			if method, _ := findMethod(o.Class, member.Property); method == nil {
+				if prop, exists := o.Props[member.Property]; !exists || prop == (NullVal{}) {
+					return NullVal{}, true, nil
+				}
+			}
 		}
+		val, err := i.callMember(obj, member.Property, args, e.GetSpan())
+		return val, false, err
 	}
 
 	// Regular call
-	callee, err := i.evalExpr(e.Callee)
-	if err != nil {
-		return nil, err
+	callee, short, err := i.evalChainObject(e.Callee, e.Optional)
+	if err != nil || short {
+		return callee, short, err
 	}
 
-	return i.callValue(callee, args, e.GetSpan())
+	val, err := i.callValue(callee, args, e.GetSpan())
+	return val, false, err
+}
+
+// CallMember calls obj.name(args) using the built-in methods of arrays,
+// strings, maps, objects and workers. Errors carry no source position.
+func (i *Interpreter) CallMember(obj Value, name string, args []Value) (Value, error) {
+	return i.callMember(obj, name, args, span.Span{})
+}
+
+// callMember calls obj.name(args) for method call expressions and invoke().
+func (i *Interpreter) callMember(obj Value, name string, args []Value, s span.Span) (Value, error) {
+	switch o := obj.(type) {
+	case *ObjectVal:
+		return i.callMethod(o, name, args, s)
+	case *ArrayVal, *MapVal, *SetVal, *RangeVal, StringVal:
+		val, err := i.callBuiltinMethod(obj, name, args, s)
+		if err != nil || val == obj {
+			return val, err
+		}
+		return val, i.allocated(val, args, s)
+	case IntVal, FloatVal:
+		return i.callNumberMethod(o, name, args, s)
+	case *StringBuilderVal:
+		return i.callStringBuilderMethod(o, name, args, s)
+	case *WorkerVal:
+		return i.callWorkerMethod(o, name, args, s)
+	case *TaskVal:
+		return i.callTaskMethod(o, name, args, s)
+	case *ChannelVal:
+		return i.callChannelMethod(o, name, args, s)
+	case *GeneratorVal:
+		return i.callGeneratorMethod(o, name, args, s)
+	case *PromiseVal:
+		return i.callPromiseMethod(o, name, args, s)
+	case *ClassVal:
+		fn, _ := findStatic(o, name)
+		if fn == nil {
+			return nil, runtimeErr(s, "class '%s' has no static method '%s'", o.Decl.Name, name)
+		}
+		return i.callValue(fn, args, s)
+	case *FuncVal, *BuiltinVal, Callable:
+		return i.callFunctionMethod(obj, name, args, s)
+	default:
+		return nil, runtimeErr(s, "cannot call method on value of type '%s'", obj.TypeName())
+	}
+}
+
+// callBuiltinMethod calls a method of a built-in array, map, set, range or
+// string value. Elements a method adds count against the heap budget.
+func (i *Interpreter) callBuiltinMethod(obj Value, name string, args []Value, s span.Span) (Value, error) {
+	if isFrozen(obj) && mutators[obj.TypeName()][name] {
+		return nil, runtimeErr(s, "cannot modify a frozen %s with %s()", obj.TypeName(), name)
+	}
+	switch o := obj.(type) {
+	case *ArrayVal:
+		before := len(o.Elements)
+		val, err := i.callArrayMethod(o, name, args, s)
+		if err == nil {
+			err = i.allocate(len(o.Elements)-before, s)
+		}
+		return val, err
+	case *MapVal:
+		before := len(o.Keys)
+		val, err := i.callMapMethod(o, name, args, s)
+		if err == nil {
+			err = i.allocate(len(o.Keys)-before, s)
+		}
+		return val, err
+	case *SetVal:
+		before := len(o.Items)
+		val, err := i.callSetMethod(o, name, args, s)
+		if err == nil {
+			err = i.allocate(len(o.Items)-before, s)
+		}
+		return val, err
+	case *RangeVal:
+		return i.callRangeMethod(o, name, args, s)
+	default:
+		return i.callStringMethod(string(obj.(StringVal)), name, args, s)
+	}
 }
 
 func (i *Interpreter) callValue(callee Value, args []Value, s span.Span) (Value, error) {
@@ -682,21 +1402,47 @@ func (i *Interpreter) callValue(callee Value, args []Value, s span.Span) (Value,
 	case *FuncVal:
 		return i.callFunc(fn, args, s)
 	case *BuiltinVal:
-		return fn.Fn(args)
+		val, err := fn.Fn(args)
+		if failed, ok := err.(*AssertionError); ok {
+			return nil, i.ThrowAssertion(failed, s, i.frames)
+		}
+		if cancelled, ok := err.(*CancelledError); ok && cancelled.Span == (span.Span{}) {
+			cancelled.Span = s // interrupted while the builtin blocked
+		}
+		if err != nil {
+			return nil, err
+		}
+		return val, i.allocated(val, args, s)
+	case *BoundFuncVal:
+		return i.callBound(fn, args, s)
+	case Callable:
+		return fn.Call(args)
 	default:
 		return nil, runtimeErr(s, "cannot call value of type '%s'", callee.TypeName())
 	}
 }
 
 func (i *Interpreter) callFunc(fn *FuncVal, args []Value, s span.Span) (Value, error) {
-	if len(args) != len(fn.Params) {
-		return nil, runtimeErr(s, "%s() expects %d arguments, got %d", fn.Name, len(fn.Params), len(args))
+	if !arityOK(fn.Params, fn.Rest, len(args)) {
+		return nil, runtimeErr(s, "%s() expects %s, got %d", fn.Name, arity(fn.Params, fn.Rest), len(args))
 	}
 
+	if err := i.enterCall(fn.Name, s); err != nil {
+		return nil, err
+	}
+	defer i.exitCall()
+
 	// Create new scope from closure
-	funcEnv := NewEnvironment(fn.Closure)
-	for idx, param := range fn.Params {
-		funcEnv.Define(param, args[idx], false)
+	funcEnv := newScopeEnv(fn.Closure, fn.scope)
+	if fn.scope != nil && fn.scope.res != i.res {
+		defer i.useResolution(fn.scope.res)()
+	}
+	bindParams(funcEnv, fn.Params, fn.Rest, args)
+	if fn.Generator {
+		return i.newGenerator(fn.Name, fn.Body, funcEnv), nil
+	}
+	if fn.Async {
+		return i.startAsync(fn.Name, fn.Body, funcEnv)
 	}
 
 	result, err := i.execBlock(fn.Body, funcEnv)
@@ -712,28 +1458,8 @@ func (i *Interpreter) callFunc(fn *FuncVal, args []Value, s span.Span) (Value, e
 
 func (i *Interpreter) callMethod(obj *ObjectVal, methodName string, args []Value, s span.Span) (Value, error) {
 	// Walk the prototype chain to find the method
-	method, methodClass := findMethod(obj.Class, methodName)
-	if method != nil {
-		if len(args) != len(method.Params) {
-			return nil, runtimeErr(s, "%s.%s() expects %d arguments, got %d",
-				obj.Class.Decl.Name, methodName, len(method.Params), len(args))
-		}
-
-		methodEnv := NewEnvironment(methodClass.Env)
-		methodEnv.Define("this", obj, true)
-		methodEnv.Define("__class__", methodClass, true)
-		for idx, param := range method.Params {
-			methodEnv.Define(param, args[idx], false)
-		}
-
-		result, err := i.execBlock(method.Body, methodEnv)
-		if err != nil {
-			return nil, err
-		}
-		if result.Signal == SigReturn {
-			return result.Value, nil
-		}
-		return NullVal{}, nil
+	if method, methodClass := findMethod(obj.Class, methodName); method != nil {
+		return i.runMethod(obj, methodClass, method, args, s)
 	}
 
 	// Check if it's a property that's callable
@@ -744,6 +1470,38 @@ func (i *Interpreter) callMethod(obj *ObjectVal, methodName string, args []Value
 	return nil, runtimeErr(s, "undefined method '%s' on class '%s'", methodName, obj.Class.Decl.Name)
 }
 
+// runMethod runs method, declared by methodClass, with 'this' bound to obj.
+func (i *Interpreter) runMethod(obj *ObjectVal, methodClass *ClassVal, method *ast.MethodDecl, args []Value, s span.Span) (Value, error) {
+	if !arityOK(method.Params, method.Rest, len(args)) {
+		return nil, runtimeErr(s, "%s.%s() expects %s, got %d",
+			obj.Class.Decl.Name, method.Name, arity(method.Params, method.Rest), len(args))
+	}
+	if err := i.enterCall(obj.Class.Decl.Name+"."+method.Name, s); err != nil {
+		return nil, err
+	}
+	defer i.exitCall()
+
+	methodEnv := NewEnvironment(methodClass.Env)
+	methodEnv.Define("this", obj, true)
+	methodEnv.Define("__class__", methodClass, true)
+	bindParams(methodEnv, method.Params, method.Rest, args)
+	if method.Generator {
+		return i.newGenerator(methodClass.Decl.Name+"."+method.Name, method.Body, methodEnv), nil
+	}
+	if method.Async {
+		return i.startAsync(methodClass.Decl.Name+"."+method.Name, method.Body, methodEnv)
+	}
+
+	result, err := i.execBlock(method.Body, methodEnv)
+	if err != nil {
+		return nil, err
+	}
+	if result.Signal == SigReturn {
+		return result.Value, nil
+	}
+	return NullVal{}, nil
+}
+
 // findMethod walks the class inheritance chain to find a method.
 func findMethod(cls *ClassVal, name string) (*ast.MethodDecl, *ClassVal) {
 	for cls != nil {
@@ -757,6 +1515,30 @@ func findMethod(cls *ClassVal, name string) (*ast.MethodDecl, *ClassVal) {
 	return nil, nil
 }
 
+// instanceOf reports whether obj is an instance of cls or of a class that
+// extends it. Anything but an object is an instance of no class.
+func instanceOf(obj, cls Value) (Value, error) {
+	c, ok := cls.(*ClassVal)
+	if !ok {
+		return nil, fmt.Errorf("right side of 'instanceof' must be a class, got '%s'", cls.TypeName())
+	}
+	o, ok := obj.(*ObjectVal)
+	return BoolVal(ok && extendsDecl(o.Class, c.Decl)), nil
+}
+
+// extendsDecl reports whether cls or one of its superclasses was declared
+// by decl. Classes are compared by declaration, so a class declared again,
+// as it is in each module, worker and call of an enclosing function,
+// matches its other copies.
+func extendsDecl(cls *ClassVal, decl *ast.ClassDecl) bool {
+	for ; cls != nil; cls = cls.Super {
+		if cls.Decl == decl {
+			return true
+		}
+	}
+	return false
+}
+
 // findConstructor walks the chain to find the nearest constructor.
 func findConstructor(cls *ClassVal) (*ast.ConstructorDecl, *ClassVal) {
 	for cls != nil {
@@ -768,88 +1550,203 @@ func findConstructor(cls *ClassVal) (*ast.ConstructorDecl, *ClassVal) {
 	return nil, nil
 }
 
-func (i *Interpreter) evalMember(e *ast.MemberExpr) (Value, error) {
-	obj, err := i.evalExpr(e.Object)
+func (i *Interpreter) evalMember(e *ast.MemberExpr) (Value, bool, error) {
+	obj, short, err := i.evalChainObject(e.Object, e.Optional)
+	if err != nil || short {
+		return obj, short, err
+	}
+	val, err := i.member(obj, e.Property, e.GetSpan())
+	return val, false, err
+}
+
+// member reads obj.name, through a getter if the class has one.
+func (i *Interpreter) member(obj Value, name string, sp span.Span) (Value, error) {
+	if val, ok, err := i.getter(obj, name, sp); ok {
+		return val, err
+	}
+	if o, ok := obj.(*ObjectVal); ok {
+		if _, isProp := o.Props[name]; !isProp {
+			if bound := i.boundMethod(o, name); bound != nil {
+				return bound, nil
+			}
+		}
+	}
+	if err := i.requireKey(obj, name); err != nil {
+		return nil, runtimeErr(sp, "%s", err)
+	}
+	val, err := GetMember(obj, name)
 	if err != nil {
-		return nil, err
+		return nil, runtimeErr(sp, "%s", err)
 	}
+	return val, nil
+}
 
+// GetMember reads obj.name for member expressions and getProp().
+func GetMember(obj Value, name string) (Value, error) {
 	switch o := obj.(type) {
 	case *ObjectVal:
-		if val, exists := o.Props[e.Property]; exists {
+		if val, exists := o.Props[name]; exists {
 			return val, nil
 		}
 		return NullVal{}, nil
 	case *ArrayVal:
-		if e.Property == "length" {
+		if name == "length" {
 			return IntVal(len(o.Elements)), nil
 		}
-		return nil, runtimeErr(e.GetSpan(), "array has no property '%s'", e.Property)
+		return nil, fmt.Errorf("array has no property '%s'", name)
 	case *MapVal:
-		if val, exists := o.Values[e.Property]; exists {
+		if val, exists := o.Values[name]; exists {
 			return val, nil
 		}
 		return NullVal{}, nil
 	case StringVal:
-		if e.Property == "length" {
-			return IntVal(len(string(o))), nil
+		if name == "length" {
+			return IntVal(runeLen(string(o))), nil
 		}
-		return nil, runtimeErr(e.GetSpan(), "string has no property '%s'", e.Property)
+		return nil, fmt.Errorf("string has no property '%s'", name)
 	case *EnumTypeVal:
-		if variant, exists := o.Variants[e.Property]; exists {
+		if variant, exists := o.Variants[name]; exists {
 			return variant, nil
 		}
-		return nil, runtimeErr(e.GetSpan(), "enum '%s' has no variant '%s'", o.Name, e.Property)
+		return nil, fmt.Errorf("enum '%s' has no variant '%s'", o.Name, name)
+	case *ClassVal:
+		if val, _ := findStatic(o, name); val != nil {
+			return val, nil
+		}
+		return nil, fmt.Errorf("class '%s' has no static field '%s'", o.Decl.Name, name)
+	case *FuncVal, *BuiltinVal, Callable:
+		return functionProp(obj, name)
 	default:
-		return nil, runtimeErr(e.GetSpan(), "cannot access property '%s' on value of type '%s'",
-			e.Property, obj.TypeName())
+		return nil, fmt.Errorf("cannot access property '%s' on value of type '%s'", name, obj.TypeName())
 	}
 }
 
-func (i *Interpreter) evalIndex(e *ast.IndexExpr) (Value, error) {
-	obj, err := i.evalExpr(e.Object)
-	if err != nil {
-		return nil, err
+// SetMember assigns obj.name = val for assignments and setProp().
+func SetMember(obj Value, name string, val Value) error {
+	if err := mutable(obj); err != nil {
+		return err
+	}
+	switch o := obj.(type) {
+	case *ObjectVal:
+		o.Props[name] = val
+	case *MapVal:
+		if _, exists := o.Values[name]; !exists {
+			o.Keys = append(o.Keys, name)
+		}
+		o.Values[name] = val
+	case *ClassVal:
+		_, owner := findStatic(o, name)
+		if owner == nil {
+			return fmt.Errorf("class '%s' has no static field '%s'", o.Decl.Name, name)
+		}
+		if owner.Consts[name] {
+			return fmt.Errorf("cannot assign to constant '%s.%s'", owner.Decl.Name, name)
+		}
+		owner.Statics[name] = val
+	default:
+		return fmt.Errorf("cannot set property on value of type '%s'", obj.TypeName())
+	}
+	return nil
+}
+
+func (i *Interpreter) evalIndex(e *ast.IndexExpr) (Value, bool, error) {
+	obj, short, err := i.evalChainObject(e.Object, e.Optional)
+	if err != nil || short {
+		return obj, short, err
 	}
 	idx, err := i.evalExpr(e.Index)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	val, err := i.index(obj, idx, e.GetSpan())
+	return val, false, err
+}
 
+// index reads obj[idx].
+func (i *Interpreter) index(obj, idx Value, sp span.Span) (Value, error) {
+	if key, ok := idx.(StringVal); ok {
+		if m, ok := obj.(*MapVal); ok {
+			if err := i.requireKey(m, string(key)); err != nil {
+				return nil, runtimeErr(sp, "%s", err)
+			}
+		}
+	}
+	val, err := IndexValue(obj, idx)
+	if err != nil {
+		return nil, runtimeErr(sp, "%s", err)
+	}
+	return val, nil
+}
+
+// IndexValue reads obj[idx] for strings, arrays and maps. A missing map key
+// reads as null.
+func IndexValue(obj, idx Value) (Value, error) {
 	switch o := obj.(type) {
 	case StringVal:
 		idxInt, ok := ToInt64(idx)
 		if !ok {
-			return nil, runtimeErr(e.GetSpan(), "string index must be an integer")
+			return nil, fmt.Errorf("string index must be an integer")
 		}
 		s := string(o)
-		if idxInt < 0 || int(idxInt) >= len(s) {
-			return nil, runtimeErr(e.GetSpan(), "string index %d out of range (length %d)", idxInt, len(s))
+		if n := runeLen(s); idxInt < 0 || int(idxInt) >= n {
+			return nil, fmt.Errorf("string index %d out of range (length %d)", idxInt, n)
 		}
-		return StringVal(string(s[idxInt])), nil
+		return StringVal(string(runeAt(s, int(idxInt)))), nil
 	case *ArrayVal:
 		idxInt, ok := ToInt64(idx)
 		if !ok {
-			return nil, runtimeErr(e.GetSpan(), "array index must be an integer")
+			return nil, fmt.Errorf("array index must be an integer")
 		}
 		if idxInt < 0 || int(idxInt) >= len(o.Elements) {
-			return nil, runtimeErr(e.GetSpan(), "array index %d out of range (length %d)", idxInt, len(o.Elements))
+			return nil, fmt.Errorf("array index %d out of range (length %d)", idxInt, len(o.Elements))
 		}
 		return o.Elements[idxInt], nil
 	case *MapVal:
 		keyStr, ok := idx.(StringVal)
 		if !ok {
-			return nil, runtimeErr(e.GetSpan(), "map key must be a string, got '%s'", idx.TypeName())
+			return nil, fmt.Errorf("map key must be a string, got '%s'", idx.TypeName())
 		}
 		if val, exists := o.Values[string(keyStr)]; exists {
 			return val, nil
 		}
 		return NullVal{}, nil
 	default:
-		return nil, runtimeErr(e.GetSpan(), "cannot index value of type '%s'", obj.TypeName())
+		return nil, fmt.Errorf("cannot index value of type '%s'", obj.TypeName())
 	}
 }
 
+// SetIndex assigns obj[idx] = val for arrays and maps. A new map key is
+// appended to the key order.
+func SetIndex(obj, idx, val Value) error {
+	if err := mutable(obj); err != nil {
+		return err
+	}
+	switch o := obj.(type) {
+	case *ArrayVal:
+		idxInt, ok := ToInt64(idx)
+		if !ok {
+			return fmt.Errorf("array index must be an integer")
+		}
+		if idxInt < 0 || int(idxInt) >= len(o.Elements) {
+			return fmt.Errorf("array index %d out of range (length %d)", idxInt, len(o.Elements))
+		}
+		o.Elements[idxInt] = val
+	case *MapVal:
+		keyStr, ok := idx.(StringVal)
+		if !ok {
+			return fmt.Errorf("map key must be a string, got '%s'", idx.TypeName())
+		}
+		key := string(keyStr)
+		if _, exists := o.Values[key]; !exists {
+			o.Keys = append(o.Keys, key)
+		}
+		o.Values[key] = val
+	default:
+		return fmt.Errorf("cannot index-assign value of type '%s'", obj.TypeName())
+	}
+	return nil
+}
+
 func (i *Interpreter) evalNew(e *ast.NewExpr) (Value, error) {
 	// Look up class
 	classVal, ok := i.env.Get(e.ClassName)
@@ -861,35 +1758,51 @@ func (i *Interpreter) evalNew(e *ast.NewExpr) (Value, error) {
 		return nil, runtimeErr(e.GetSpan(), "'%s' is not a class", e.ClassName)
 	}
 
-	// Evaluate arguments
-	args := make([]Value, len(e.Args))
-	for idx, argExpr := range e.Args {
-		val, err := i.evalExpr(argExpr)
-		if err != nil {
-			return nil, err
-		}
-		args[idx] = val
+	args, err := i.evalArgs(e.Args)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create new object
+	if err := i.allocate(1, e.GetSpan()); err != nil {
+		return nil, err
+	}
 	obj := &ObjectVal{
 		Class: cls,
 		Props: make(map[string]Value),
 	}
 
+	// Records take their fields positionally
+	if cls.Decl.Record {
+		if len(args) != len(cls.Decl.Fields) {
+			return nil, runtimeErr(e.GetSpan(), "%s expects %d arguments, got %d",
+				e.ClassName, len(cls.Decl.Fields), len(args))
+		}
+		for idx, field := range cls.Decl.Fields {
+			obj.Props[field] = args[idx]
+		}
+		return obj, nil
+	}
+
+	if err := i.initProps(obj, cls); err != nil {
+		return nil, err
+	}
+
 	// Find constructor (walk inheritance chain)
 	ctor, ctorClass := findConstructor(cls)
 	if ctor != nil {
-		if len(args) != len(ctor.Params) {
-			return nil, runtimeErr(e.GetSpan(), "%s constructor expects %d arguments, got %d",
-				e.ClassName, len(ctor.Params), len(args))
+		if !arityOK(ctor.Params, ctor.Rest, len(args)) {
+			return nil, runtimeErr(e.GetSpan(), "%s constructor expects %s, got %d",
+				e.ClassName, arity(ctor.Params, ctor.Rest), len(args))
+		}
+		if err := i.enterCall(e.ClassName+" constructor", e.GetSpan()); err != nil {
+			return nil, err
 		}
+		defer i.exitCall()
 		ctorEnv := NewEnvironment(ctorClass.Env)
 		ctorEnv.Define("this", obj, true)
 		ctorEnv.Define("__class__", ctorClass, true)
-		for idx, param := range ctor.Params {
-			ctorEnv.Define(param, args[idx], false)
-		}
+		bindParams(ctorEnv, ctor.Params, ctor.Rest, args)
 
 		result, err := i.execBlock(ctor.Body, ctorEnv)
 		if err != nil {
@@ -906,16 +1819,49 @@ func (i *Interpreter) evalNew(e *ast.NewExpr) (Value, error) {
 	return obj, nil
 }
 
+// initProps sets the declared fields of cls and its super classes on obj,
+// super class fields first, evaluating each initializer with 'this' bound
+// to obj.
+func (i *Interpreter) initProps(obj *ObjectVal, cls *ClassVal) error {
+	if cls.Super != nil {
+		if err := i.initProps(obj, cls.Super); err != nil {
+			return err
+		}
+	}
+	if len(cls.Decl.Props) == 0 {
+		return nil
+	}
+	env := NewEnvironment(cls.Env)
+	env.Define("this", obj, true)
+	env.Define("__class__", cls, true)
+	prevEnv := i.env
+	i.env = env
+	defer func() { i.env = prevEnv }()
+	for _, field := range cls.Decl.Props {
+		var val Value = NullVal{}
+		if field.Value != nil {
+			v, err := i.evalExpr(field.Value)
+			if err != nil {
+				return err
+			}
+			val = v
+		}
+		obj.Props[field.Name] = val
+	}
+	return nil
+}
+
 // ============================================================
 // For loop execution
 // ============================================================
 
 func (i *Interpreter) execFor(s *ast.ForStmt) (ExecResult, error) {
 	// Create scope for the for loop (init vars are scoped to the loop)
-	forEnv := NewEnvironment(i.env)
+	forEnv := i.scopeEnv(s)
 	prevEnv := i.env
 	i.env = forEnv
 	defer func() { i.env = prevEnv }()
+	fresh := i.freshIterations(s)
 
 	// Execute init
 	if s.Init != nil {
@@ -931,17 +1877,17 @@ func (i *Interpreter) execFor(s *ast.ForStmt) (ExecResult, error) {
 	for {
 		// Check condition
 		if s.Condition != nil {
-			cond, err := i.evalExpr(s.Condition)
+			cond, err := i.condition(s.Condition)
 			if err != nil {
 				return resultNone, err
 			}
-			if !IsTruthy(cond) {
+			if !cond {
 				break
 			}
 		}
 
 		// Execute body (new scope for each iteration)
-		result, err := i.execBlock(s.Body, NewEnvironment(i.env))
+		result, err := i.execBlock(s.Body, i.blockEnv(s.Body))
 		if err != nil {
 			return resultNone, err
 		}
@@ -953,6 +1899,13 @@ func (i *Interpreter) execFor(s *ast.ForStmt) (ExecResult, error) {
 		}
 		// SigContinue: skip to update
 
+		// Closures created so far keep this iteration's variables; the
+		// next iteration updates a copy
+		if fresh {
+			forEnv = forEnv.next()
+			i.env = forEnv
+		}
+
 		// Execute update
 		if s.Update != nil {
 			_, err := i.execNode(s.Update)
@@ -965,45 +1918,113 @@ func (i *Interpreter) execFor(s *ast.ForStmt) (ExecResult, error) {
 	return resultNone, nil
 }
 
-func (i *Interpreter) execForOf(s *ast.ForOfStmt) (ExecResult, error) {
-	iterable, err := i.evalExpr(s.Iterable)
-	if err != nil {
-		return resultNone, err
-	}
-
-	var items []Value
-	switch it := iterable.(type) {
+// ForOfItems returns what for-of visits in v. items holds what the
+// one-variable form binds: the elements of an array, the keys of a map, the
+// members of a set or the characters of a string, one per code point.
+// values holds the map values the two-variable form binds with the keys,
+// and is nil otherwise.
+func ForOfItems(v Value) (items, values []Value, err error) {
+	switch it := v.(type) {
 	case *ArrayVal:
-		items = it.Elements
+		return it.Elements, nil, nil
 	case *MapVal:
 		items = make([]Value, len(it.Keys))
+		values = make([]Value, len(it.Keys))
 		for idx, k := range it.Keys {
 			items[idx] = StringVal(k)
+			values[idx] = it.Values[k]
 		}
+		return items, values, nil
+	case *SetVal:
+		return append([]Value{}, it.Items...), nil, nil
+	case *RangeVal:
+		return it.Items(), nil, nil
+	case StringVal:
+		for _, r := range string(it) {
+			items = append(items, StringVal(string(r)))
+		}
+		return items, nil, nil
 	default:
-		return resultNone, runtimeErr(s.GetSpan(), "for-of requires an array or map, got '%s'", iterable.TypeName())
+		return nil, nil, fmt.Errorf("for-of requires an array, map, set, range or string, got '%s'", v.TypeName())
 	}
+}
 
-	for _, elem := range items {
-		loopEnv := NewEnvironment(i.env)
-		loopEnv.Define(s.VarName, elem, false)
-
-		result, err := i.execBlock(s.Body, loopEnv)
-		if err != nil {
+func (i *Interpreter) execForOf(s *ast.ForOfStmt) (ExecResult, error) {
+	iterable, err := i.evalExpr(s.Iterable)
+	if err != nil {
+		return resultNone, err
+	}
+	if obj, ok := iterable.(*ObjectVal); ok {
+		if iterable, err = i.iterator(obj, s.GetSpan()); err != nil {
 			return resultNone, err
 		}
-		if result.Signal == SigBreak {
-			break
+	}
+	switch it := iterable.(type) {
+	case *ObjectVal, *GeneratorVal:
+		return i.execForOfIterator(s, iterable)
+	case *RangeVal:
+		for idx := int64(0); idx < it.Len(); idx++ {
+			result, stop, err := i.forOfStep(s, int(idx), it.At(idx), nil)
+			if err != nil || stop {
+				return result, err
+			}
+		}
+		return resultNone, nil
+	}
+
+	items, values, err := ForOfItems(iterable)
+	if err != nil {
+		return resultNone, runtimeErr(s.GetSpan(), "%s", err)
+	}
+
+	for idx, elem := range items {
+		var value Value
+		if values != nil {
+			value = values[idx]
 		}
-		if result.Signal == SigReturn {
-			return result, nil
+		result, stop, err := i.forOfStep(s, idx, elem, value)
+		if err != nil || stop {
+			return result, err
 		}
-		// SigContinue: continue
 	}
 
 	return resultNone, nil
 }
 
+// forOfStep binds the idx-th item of a for-of loop, elem, and for maps its
+// value, then runs the body. stop reports whether the loop ends early; result
+// holds the return signal if the body returned.
+func (i *Interpreter) forOfStep(s *ast.ForOfStmt, idx int, elem, value Value) (result ExecResult, stop bool, err error) {
+	loopEnv := i.scopeEnv(s.Body)
+	switch {
+	case s.Pattern != nil:
+		if err := i.definePattern(loopEnv, s.Pattern, elem, false); err != nil {
+			return resultNone, true, err
+		}
+	case s.KeyName == "":
+		loopEnv.Define(s.VarName, elem, false)
+	case value != nil:
+		loopEnv.Define(s.KeyName, elem, false)
+		loopEnv.Define(s.VarName, value, false)
+	default:
+		loopEnv.Define(s.KeyName, IntVal(idx), false)
+		loopEnv.Define(s.VarName, elem, false)
+	}
+
+	result, err = i.execBlock(s.Body, loopEnv)
+	if err != nil {
+		return resultNone, true, err
+	}
+	switch result.Signal {
+	case SigBreak:
+		return resultNone, true, nil
+	case SigReturn:
+		return result, true, nil
+	}
+	// SigContinue: continue
+	return resultNone, false, nil
+}
+
 // ============================================================
 // Array methods
 // ============================================================
@@ -1017,15 +2038,18 @@ func (i *Interpreter) evalArrayLiteral(e *ast.ArrayLiteral) (Value, error) {
 		}
 		elements[idx] = val
 	}
+	if err := i.allocate(1+len(elements), e.Span); err != nil {
+		return nil, err
+	}
 	return &ArrayVal{Elements: elements}, nil
 }
 
 func (i *Interpreter) evalTernary(e *ast.TernaryExpr) (Value, error) {
-	cond, err := i.evalExpr(e.Condition)
+	cond, err := i.condition(e.Condition)
 	if err != nil {
 		return nil, err
 	}
-	if IsTruthy(cond) {
+	if cond {
 		return i.evalExpr(e.Then)
 	}
 	return i.evalExpr(e.Else)
@@ -1037,11 +2061,15 @@ func (i *Interpreter) evalMapLiteral(e *ast.MapLiteral) (Value, error) {
 		Values: make(map[string]Value, len(e.Keys)),
 	}
 	for idx, keyExpr := range e.Keys {
-		keyStr, ok := keyExpr.(*ast.StringLiteral)
+		keyVal, err := i.evalExpr(keyExpr)
+		if err != nil {
+			return nil, err
+		}
+		keyStr, ok := keyVal.(StringVal)
 		if !ok {
-			return nil, runtimeErr(keyExpr.GetSpan(), "map key must be a string")
+			return nil, runtimeErr(e.Span, "map key must be a string, got '%s'", keyVal.TypeName())
 		}
-		key := keyStr.Value
+		key := string(keyStr)
 		val, err := i.evalExpr(e.Values[idx])
 		if err != nil {
 			return nil, err
@@ -1051,29 +2079,26 @@ func (i *Interpreter) evalMapLiteral(e *ast.MapLiteral) (Value, error) {
 		}
 		m.Values[key] = val
 	}
+	if err := i.allocate(1+len(m.Keys), e.Span); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
 func (i *Interpreter) execTry(s *ast.TryStmt) (ExecResult, error) {
-	result, err := i.execBlock(s.Body, NewEnvironment(i.env))
+	result, err := i.execBlock(s.Body, i.blockEnv(s.Body))
 	if err == nil {
 		return result, nil
 	}
 
 	// Error occurred - catch it
 	if s.CatchBody != nil {
-		catchEnv := NewEnvironment(i.env)
-		var errVal Value
-		switch e := err.(type) {
-		case *ThrownError:
-			errVal = e.Value
-		case *RuntimeError:
-			errVal = StringVal(e.Message)
-		default:
-			errVal = StringVal(err.Error())
+		if uncatchable(err) {
+			return resultNone, err
 		}
+		catchEnv := i.scopeEnv(s.CatchBody)
 		if s.CatchParam != "" {
-			catchEnv.Define(s.CatchParam, errVal, false)
+			catchEnv.Define(s.CatchParam, i.caughtValue(err), false)
 		}
 		return i.execBlock(s.CatchBody, catchEnv)
 	}
@@ -1081,12 +2106,38 @@ func (i *Interpreter) execTry(s *ast.TryStmt) (ExecResult, error) {
 	return resultNone, err // re-throw if no catch
 }
 
+// uncatchable reports whether err unwinds past catch blocks: a closed
+// generator's body, exit() or cancellation.
+func uncatchable(err error) bool {
+	switch err.(type) {
+	case generatorClosed, *ExitError, *CancelledError:
+		return true
+	}
+	return false
+}
+
+// caughtValue is what catch binds for err. Thrown strings and runtime
+// errors are caught as Error objects.
+func (i *Interpreter) caughtValue(err error) Value {
+	switch e := err.(type) {
+	case *ThrownError:
+		if msg, ok := e.Value.(StringVal); ok {
+			return i.newError("Error", string(msg), strings.TrimSuffix(e.StackTrace(), "\n"))
+		}
+		return e.Value
+	case *RuntimeError:
+		return i.newError("Error", e.Message, "")
+	default:
+		return i.newError("Error", err.Error(), "")
+	}
+}
+
 func (i *Interpreter) execThrow(s *ast.ThrowStmt) (ExecResult, error) {
 	val, err := i.evalExpr(s.Value)
 	if err != nil {
 		return resultNone, err
 	}
-	return resultNone, &ThrownError{Value: val, Span: s.GetSpan()}
+	return resultNone, throwValue(val, s.GetSpan(), i.frames)
 }
 
 // ============================================================
@@ -1101,22 +2152,22 @@ func (i *Interpreter) execMatch(s *ast.MatchStmt) (ExecResult, error) {
 
 	for _, arm := range s.Arms {
 		if arm.IsDefault {
-			return i.execBlock(arm.Body, NewEnvironment(i.env))
+			return i.execBlock(arm.Body, i.blockEnv(arm.Body))
 		}
 
 		if arm.BindVar != "" {
 			// Binding pattern with guard: case x if guard => body
-			bindEnv := NewEnvironment(i.env)
+			bindEnv := i.scopeEnv(arm.Body)
 			bindEnv.Define(arm.BindVar, subject, false)
 
 			prevEnv := i.env
 			i.env = bindEnv
-			guardVal, err := i.evalExpr(arm.Guard)
+			guard, err := i.condition(arm.Guard)
 			i.env = prevEnv
 			if err != nil {
 				return resultNone, err
 			}
-			if IsTruthy(guardVal) {
+			if guard {
 				return i.execBlock(arm.Body, bindEnv)
 			}
 			continue
@@ -1129,7 +2180,7 @@ func (i *Interpreter) execMatch(s *ast.MatchStmt) (ExecResult, error) {
 				return resultNone, err
 			}
 			if valuesEqual(subject, patVal) {
-				return i.execBlock(arm.Body, NewEnvironment(i.env))
+				return i.execBlock(arm.Body, i.blockEnv(arm.Body))
 			}
 		}
 	}
@@ -1154,17 +2205,19 @@ func (i *Interpreter) callSuperConstructor(args []Value, s span.Span) (Value, er
 		}
 		return NullVal{}, nil
 	}
-	if len(args) != len(ctor.Params) {
-		return nil, runtimeErr(s, "super constructor expects %d arguments, got %d", len(ctor.Params), len(args))
+	if !arityOK(ctor.Params, ctor.Rest, len(args)) {
+		return nil, runtimeErr(s, "super constructor expects %s, got %d", arity(ctor.Params, ctor.Rest), len(args))
+	}
+	if err := i.enterCall(ctorClass.Decl.Name+" constructor", s); err != nil {
+		return nil, err
 	}
+	defer i.exitCall()
 
 	thisVal, _ := i.env.Get("this")
 	ctorEnv := NewEnvironment(ctorClass.Env)
 	ctorEnv.Define("this", thisVal, true)
 	ctorEnv.Define("__class__", ctorClass, true)
-	for idx, param := range ctor.Params {
-		ctorEnv.Define(param, args[idx], false)
-	}
+	bindParams(ctorEnv, ctor.Params, ctor.Rest, args)
 
 	_, err := i.execBlock(ctor.Body, ctorEnv)
 	return NullVal{}, err
@@ -1187,15 +2240,23 @@ func (i *Interpreter) callSuperMethod(methodName string, args []Value, s span.Sp
 	if method == nil {
 		return nil, runtimeErr(s, "super class has no method '%s'", methodName)
 	}
-	if len(args) != len(method.Params) {
-		return nil, runtimeErr(s, "super.%s() expects %d arguments, got %d", methodName, len(method.Params), len(args))
+	if !arityOK(method.Params, method.Rest, len(args)) {
+		return nil, runtimeErr(s, "super.%s() expects %s, got %d", methodName, arity(method.Params, method.Rest), len(args))
 	}
+	if err := i.enterCall(methodClass.Decl.Name+"."+methodName, s); err != nil {
+		return nil, err
+	}
+	defer i.exitCall()
 
 	methodEnv := NewEnvironment(methodClass.Env)
 	methodEnv.Define("this", obj, true)
 	methodEnv.Define("__class__", methodClass, true)
-	for idx, param := range method.Params {
-		methodEnv.Define(param, args[idx], false)
+	bindParams(methodEnv, method.Params, method.Rest, args)
+	if method.Generator {
+		return i.newGenerator(methodClass.Decl.Name+"."+method.Name, method.Body, methodEnv), nil
+	}
+	if method.Async {
+		return i.startAsync(methodClass.Decl.Name+"."+method.Name, method.Body, methodEnv)
 	}
 
 	result, err := i.execBlock(method.Body, methodEnv)
@@ -1218,7 +2279,12 @@ func (i *Interpreter) evalFuncExpr(e *ast.FuncExpr) (Value, error) {
 		Params:  e.Params,
 		Body:    e.Body,
 		Closure: i.env,
+		Rest:    e.Rest,
+
+		Generator: e.Generator,
+		Async:     e.Async,
 	}
+	fn.scope, _ = i.scopeOf(e.Body)
 	return fn, nil
 }
 
@@ -1235,7 +2301,11 @@ func (i *Interpreter) evalTemplateLiteral(e *ast.TemplateLiteral) (Value, error)
 			if err != nil {
 				return nil, err
 			}
-			sb.WriteString(val.String())
+			str, err := i.stringOf(val, e.Exprs[idx].GetSpan())
+			if err != nil {
+				return nil, err
+			}
+			sb.WriteString(str)
 		}
 	}
 	return StringVal(sb.String()), nil
@@ -1262,6 +2332,13 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 		}
 		return &ArrayVal{Elements: elements}, nil
 
+	case "format":
+		formatted, err := formatValues(s, args)
+		if err != nil {
+			return nil, runtimeErr(sp, "%s", err)
+		}
+		return StringVal(formatted), nil
+
 	case "trim":
 		if len(args) != 0 {
 			return nil, runtimeErr(sp, "trim() expects 0 arguments, got %d", len(args))
@@ -1276,7 +2353,7 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 		if !ok {
 			return nil, runtimeErr(sp, "indexOf() argument must be a string")
 		}
-		return IntVal(strings.Index(s, string(sub))), nil
+		return IntVal(runeIndex(s, string(sub))), nil
 
 	case "slice":
 		if len(args) < 1 || len(args) > 2 {
@@ -1286,7 +2363,8 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 		if !ok {
 			return nil, runtimeErr(sp, "slice() start must be an integer")
 		}
-		end := int64(len(s))
+		n := int64(runeLen(s))
+		end := n
 		if len(args) == 2 {
 			end, ok = ToInt64(args[1])
 			if !ok {
@@ -1294,21 +2372,21 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 			}
 		}
 		if start < 0 {
-			start = int64(len(s)) + start
+			start = n + start
 		}
 		if end < 0 {
-			end = int64(len(s)) + end
+			end = n + end
 		}
 		if start < 0 {
 			start = 0
 		}
-		if end > int64(len(s)) {
-			end = int64(len(s))
+		if end > n {
+			end = n
 		}
 		if start >= end {
 			return StringVal(""), nil
 		}
-		return StringVal(s[start:end]), nil
+		return StringVal(runeSlice(s, int(start), int(end))), nil
 
 	case "toUpperCase":
 		return StringVal(strings.ToUpper(s)), nil
@@ -1376,10 +2454,75 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 		if !ok {
 			return nil, runtimeErr(sp, "charAt() argument must be an integer")
 		}
-		if idx < 0 || int(idx) >= len(s) {
+		if idx < 0 || int(idx) >= runeLen(s) {
 			return StringVal(""), nil
 		}
-		return StringVal(string(s[idx])), nil
+		return StringVal(string(runeAt(s, int(idx)))), nil
+
+	case "codePointAt":
+		if len(args) != 1 {
+			return nil, runtimeErr(sp, "codePointAt() expects 1 argument, got %d", len(args))
+		}
+		idx, ok := ToInt64(args[0])
+		if !ok {
+			return nil, runtimeErr(sp, "codePointAt() argument must be an integer")
+		}
+		if idx < 0 || int(idx) >= runeLen(s) {
+			return NullVal{}, nil
+		}
+		return IntVal(runeAt(s, int(idx))), nil
+
+	case "lastIndexOf":
+		if len(args) != 1 {
+			return nil, runtimeErr(sp, "lastIndexOf() expects 1 argument, got %d", len(args))
+		}
+		sub, ok := args[0].(StringVal)
+		if !ok {
+			return nil, runtimeErr(sp, "lastIndexOf() argument must be a string")
+		}
+		return IntVal(runeLastIndex(s, string(sub))), nil
+
+	case "bytes", "chars":
+		if len(args) != 0 {
+			return nil, runtimeErr(sp, "%s() expects 0 arguments, got %d", name, len(args))
+		}
+		var elements []Value
+		if name == "bytes" {
+			elements = make([]Value, len(s))
+			for idx := range len(s) {
+				elements[idx] = IntVal(s[idx])
+			}
+		} else {
+			elements = make([]Value, 0, len(s))
+			for _, r := range s {
+				elements = append(elements, StringVal(string(r)))
+			}
+		}
+		return &ArrayVal{Elements: elements}, nil
+
+	case "reverse":
+		if len(args) != 0 {
+			return nil, runtimeErr(sp, "reverse() expects 0 arguments, got %d", len(args))
+		}
+		runes := []rune(s)
+		slices.Reverse(runes)
+		return StringVal(string(runes)), nil
+
+	case "padStart", "padEnd":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, runtimeErr(sp, "%s() expects 1-2 arguments, got %d", name, len(args))
+		}
+		width, ok := args[0].(IntVal)
+		if !ok {
+			return nil, runtimeErr(sp, "%s() length must be an integer", name)
+		}
+		fill := StringVal(" ")
+		if len(args) == 2 {
+			if fill, ok = args[1].(StringVal); !ok {
+				return nil, runtimeErr(sp, "%s() fill must be a string", name)
+			}
+		}
+		return StringVal(padString(s, int(width), string(fill), name == "padStart")), nil
 
 	case "substring":
 		if len(args) < 1 || len(args) > 2 {
@@ -1389,7 +2532,8 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 		if !ok {
 			return nil, runtimeErr(sp, "substring() start must be an integer")
 		}
-		end := int64(len(s))
+		n := int64(runeLen(s))
+		end := n
 		if len(args) == 2 {
 			end, ok = ToInt64(args[1])
 			if !ok {
@@ -1399,13 +2543,13 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 		if start < 0 {
 			start = 0
 		}
-		if end > int64(len(s)) {
-			end = int64(len(s))
+		if end > n {
+			end = n
 		}
 		if start > end {
 			start, end = end, start
 		}
-		return StringVal(s[start:end]), nil
+		return StringVal(runeSlice(s, int(start), int(end))), nil
 
 	case "repeat":
 		if len(args) != 1 {
@@ -1423,6 +2567,12 @@ func (i *Interpreter) callStringMethod(s string, name string, args []Value, sp s
 	case "trimEnd":
 		return StringVal(strings.TrimRight(s, " \t\n\r")), nil
 
+	case "dedent":
+		if len(args) != 0 {
+			return nil, runtimeErr(sp, "dedent() expects 0 arguments, got %d", len(args))
+		}
+		return StringVal(Dedent(s)), nil
+
 	default:
 		return nil, runtimeErr(sp, "string has no method '%s'", name)
 	}
@@ -1541,36 +2691,36 @@ func (i *Interpreter) callArrayMethod(arr *ArrayVal, name string, args []Value,
 		}
 		return NullVal{}, nil
 
-	case "sort":
+	case "sort", "sorted":
 		if len(args) > 1 {
-			return nil, runtimeErr(s, "sort() expects 0-1 arguments, got %d", len(args))
+			return nil, runtimeErr(s, "%s() expects 0-1 arguments, got %d", name, len(args))
 		}
-		if len(args) == 0 {
-			sort.SliceStable(arr.Elements, func(a, b int) bool {
-				return compareValues(arr.Elements[a], arr.Elements[b]) < 0
-			})
-		} else {
-			fn := args[0]
-			var sortErr error
-			sort.SliceStable(arr.Elements, func(a, b int) bool {
-				if sortErr != nil {
-					return false
-				}
-				result, err := i.callValue(fn, []Value{arr.Elements[a], arr.Elements[b]}, s)
-				if err != nil {
-					sortErr = err
-					return false
-				}
-				n, ok := ToFloat64(result)
-				if !ok {
-					sortErr = runtimeErr(s, "sort comparator must return a number")
-					return false
-				}
-				return n < 0
-			})
-			if sortErr != nil {
-				return nil, sortErr
-			}
+		target := arr
+		if name == "sorted" {
+			target = &ArrayVal{Elements: append([]Value{}, arr.Elements...)}
+		}
+		var comparator Value
+		if len(args) == 1 {
+			comparator = args[0]
+		}
+		if err := i.sortElements(target.Elements, comparator, s); err != nil {
+			return nil, err
+		}
+		return target, nil
+
+	case "sortBy", "sortDesc":
+		if name == "sortBy" && len(args) != 1 {
+			return nil, runtimeErr(s, "sortBy() expects 1 argument, got %d", len(args))
+		}
+		if len(args) > 1 {
+			return nil, runtimeErr(s, "sortDesc() expects 0-1 arguments, got %d", len(args))
+		}
+		var keyFn Value
+		if len(args) == 1 {
+			keyFn = args[0]
+		}
+		if err := i.sortElementsByKey(arr.Elements, keyFn, name == "sortDesc", s); err != nil {
+			return nil, err
 		}
 		return arr, nil
 
@@ -1667,25 +2817,368 @@ func (i *Interpreter) callArrayMethod(arr *ArrayVal, name string, args []Value,
 		copy(newElems[len(arr.Elements):], other.Elements)
 		return &ArrayVal{Elements: newElems}, nil
 
-	case "flat":
-		var result []Value
+	case "flat", "flatDeep":
+		// flat(depth) flattens depth levels, all of them for a negative
+		// depth; flatDeep() is flat(-1)
+		depth := int64(1)
+		if name == "flatDeep" {
+			if len(args) != 0 {
+				return nil, runtimeErr(s, "flatDeep() expects 0 arguments, got %d", len(args))
+			}
+			depth = -1
+		} else if len(args) > 1 {
+			return nil, runtimeErr(s, "flat() expects 0-1 arguments, got %d", len(args))
+		} else if len(args) == 1 {
+			n, ok := args[0].(IntVal)
+			if !ok {
+				return nil, runtimeErr(s, "flat() depth must be an integer")
+			}
+			depth = int64(n)
+		}
+		result, err := flatten([]Value{}, arr, depth, make(map[*ArrayVal]bool))
+		if err != nil {
+			return nil, runtimeErr(s, "%s() %s", name, err)
+		}
+		return &ArrayVal{Elements: result}, nil
+
+	case "shift":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "shift() expects 0 arguments, got %d", len(args))
+		}
+		if len(arr.Elements) == 0 {
+			return nil, runtimeErr(s, "shift() on empty array")
+		}
+		first := arr.Elements[0]
+		arr.Elements = append([]Value{}, arr.Elements[1:]...)
+		return first, nil
+
+	case "unshift":
+		arr.Elements = append(append([]Value{}, args...), arr.Elements...)
+		return IntVal(len(arr.Elements)), nil
+
+	case "insert":
+		if len(args) != 2 {
+			return nil, runtimeErr(s, "insert() expects 2 arguments, got %d", len(args))
+		}
+		idx, ok := ToInt64(args[0])
+		if !ok {
+			return nil, runtimeErr(s, "insert() index must be an integer")
+		}
+		at := clampIndex(idx, len(arr.Elements))
+		arr.Elements = append(arr.Elements[:at], append([]Value{args[1]}, arr.Elements[at:]...)...)
+		return IntVal(len(arr.Elements)), nil
+
+	case "splice":
+		if len(args) < 1 {
+			return nil, runtimeErr(s, "splice() expects at least 1 argument, got 0")
+		}
+		start, ok := ToInt64(args[0])
+		if !ok {
+			return nil, runtimeErr(s, "splice() start must be an integer")
+		}
+		from := clampIndex(start, len(arr.Elements))
+		to := len(arr.Elements)
+		if len(args) > 1 {
+			count, ok := ToInt64(args[1])
+			if !ok {
+				return nil, runtimeErr(s, "splice() delete count must be an integer")
+			}
+			to = from + int(max(0, min(count, int64(len(arr.Elements)-from))))
+		}
+		removed := append([]Value{}, arr.Elements[from:to]...)
+		rest := append(append([]Value{}, args[min(len(args), 2):]...), arr.Elements[to:]...)
+		arr.Elements = append(arr.Elements[:from], rest...)
+		return &ArrayVal{Elements: removed}, nil
+
+	case "fill":
+		if len(args) < 1 || len(args) > 3 {
+			return nil, runtimeErr(s, "fill() expects 1-3 arguments, got %d", len(args))
+		}
+		from, to := 0, len(arr.Elements)
+		for idx, bound := range args[1:] {
+			n, ok := ToInt64(bound)
+			if !ok {
+				return nil, runtimeErr(s, "fill() %s must be an integer", [2]string{"start", "end"}[idx])
+			}
+			if idx == 0 {
+				from = clampIndex(n, len(arr.Elements))
+			} else {
+				to = clampIndex(n, len(arr.Elements))
+			}
+		}
+		for idx := from; idx < to; idx++ {
+			arr.Elements[idx] = args[0]
+		}
+		return arr, nil
+
+	case "flatMap":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "flatMap() expects 1 argument, got %d", len(args))
+		}
+		result := []Value{}
 		for _, elem := range arr.Elements {
-			if inner, ok := elem.(*ArrayVal); ok {
+			val, err := i.callValue(args[0], []Value{elem}, s)
+			if err != nil {
+				return nil, err
+			}
+			if inner, ok := val.(*ArrayVal); ok {
 				result = append(result, inner.Elements...)
 			} else {
-				result = append(result, elem)
+				result = append(result, val)
 			}
 		}
-		if result == nil {
-			result = []Value{}
-		}
 		return &ArrayVal{Elements: result}, nil
 
+	case "findIndex", "every", "some", "count":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "%s() expects 1 argument, got %d", name, len(args))
+		}
+		matches := 0
+		for idx, elem := range arr.Elements {
+			val, err := i.callValue(args[0], []Value{elem}, s)
+			if err != nil {
+				return nil, err
+			}
+			truthy := IsTruthy(val)
+			switch {
+			case name == "findIndex" && truthy:
+				return IntVal(idx), nil
+			case name == "every" && !truthy:
+				return BoolVal(false), nil
+			case name == "some" && truthy:
+				return BoolVal(true), nil
+			case truthy:
+				matches++
+			}
+		}
+		switch name {
+		case "findIndex":
+			return IntVal(-1), nil
+		case "every":
+			return BoolVal(true), nil
+		case "some":
+			return BoolVal(false), nil
+		}
+		return IntVal(matches), nil
+
+	case "lastIndexOf":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "lastIndexOf() expects 1 argument, got %d", len(args))
+		}
+		for idx := len(arr.Elements) - 1; idx >= 0; idx-- {
+			if valuesEqual(arr.Elements[idx], args[0]) {
+				return IntVal(idx), nil
+			}
+		}
+		return IntVal(-1), nil
+
 	default:
 		return nil, runtimeErr(s, "array has no method '%s'", name)
 	}
 }
 
+// flatten appends the elements of arr to dst, splicing in nested arrays
+// depth levels down, or all the way for a negative depth. path holds the
+// arrays being flattened, so flattening all the way through an array that
+// contains itself is an error rather than endless recursion.
+func flatten(dst []Value, arr *ArrayVal, depth int64, path map[*ArrayVal]bool) ([]Value, error) {
+	if path[arr] && depth < 0 {
+		return nil, fmt.Errorf("cannot flatten an array that contains itself")
+	}
+	path[arr] = true
+	defer delete(path, arr)
+	for _, elem := range arr.Elements {
+		inner, ok := elem.(*ArrayVal)
+		if !ok || depth == 0 {
+			dst = append(dst, elem)
+			continue
+		}
+		var err error
+		if dst, err = flatten(dst, inner, depth-1, path); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// clampIndex turns an array position into an index within [0, n]: negative
+// positions count back from the end, as in slice().
+func clampIndex(idx int64, n int) int {
+	if idx < 0 {
+		idx += int64(n)
+	}
+	return int(max(0, min(idx, int64(n))))
+}
+
+// ============================================================
+// Map methods
+// ============================================================
+
+func (i *Interpreter) callMapMethod(m *MapVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "get":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, runtimeErr(s, "get() expects 1-2 arguments, got %d", len(args))
+		}
+		key, ok := args[0].(StringVal)
+		if !ok {
+			return nil, runtimeErr(s, "map key must be a string, got '%s'", args[0].TypeName())
+		}
+		if val, exists := m.Values[string(key)]; exists {
+			return val, nil
+		}
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return NullVal{}, nil
+
+	case "has":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "has() expects 1 argument, got %d", len(args))
+		}
+		key, ok := args[0].(StringVal)
+		if !ok {
+			return nil, runtimeErr(s, "map key must be a string, got '%s'", args[0].TypeName())
+		}
+		_, exists := m.Values[string(key)]
+		return BoolVal(exists), nil
+
+	case "delete":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "delete() expects 1 argument, got %d", len(args))
+		}
+		key, ok := args[0].(StringVal)
+		if !ok {
+			return nil, runtimeErr(s, "map key must be a string, got '%s'", args[0].TypeName())
+		}
+		if _, exists := m.Values[string(key)]; !exists {
+			return BoolVal(false), nil
+		}
+		delete(m.Values, string(key))
+		for idx, k := range m.Keys {
+			if k == string(key) {
+				m.Keys = append(m.Keys[:idx], m.Keys[idx+1:]...)
+				break
+			}
+		}
+		return BoolVal(true), nil
+
+	case "entries":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "entries() expects 0 arguments, got %d", len(args))
+		}
+		entries := make([]Value, len(m.Keys))
+		for idx, k := range m.Keys {
+			entries[idx] = &ArrayVal{Elements: []Value{StringVal(k), m.Values[k]}}
+		}
+		return &ArrayVal{Elements: entries}, nil
+
+	case "merge":
+		// merge returns a new map; keys of later maps override earlier ones
+		if len(args) == 0 {
+			return nil, runtimeErr(s, "merge() expects at least 1 argument, got 0")
+		}
+		result := &MapVal{
+			Keys:   append([]string{}, m.Keys...),
+			Values: make(map[string]Value, len(m.Values)),
+		}
+		for k, v := range m.Values {
+			result.Values[k] = v
+		}
+		for _, arg := range args {
+			other, ok := arg.(*MapVal)
+			if !ok {
+				return nil, runtimeErr(s, "merge() arguments must be maps, got '%s'", arg.TypeName())
+			}
+			for _, k := range other.Keys {
+				if _, exists := result.Values[k]; !exists {
+					result.Keys = append(result.Keys, k)
+				}
+				result.Values[k] = other.Values[k]
+			}
+		}
+		return result, nil
+
+	default:
+		return nil, runtimeErr(s, "map has no method '%s'", name)
+	}
+}
+
+// sortElements stably sorts elements in place, by compareValues or, when
+// comparator is not nil, by calling it on pairs of elements.
+func (i *Interpreter) sortElements(elements []Value, comparator Value, s span.Span) error {
+	if comparator == nil {
+		sort.SliceStable(elements, func(a, b int) bool {
+			return compareValues(elements[a], elements[b]) < 0
+		})
+		return nil
+	}
+	var sortErr error
+	sort.SliceStable(elements, func(a, b int) bool {
+		if sortErr != nil {
+			return false
+		}
+		result, err := i.callValue(comparator, []Value{elements[a], elements[b]}, s)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		n, ok := ToFloat64(result)
+		if !ok {
+			sortErr = runtimeErr(s, "sort comparator must return a number")
+			return false
+		}
+		return n < 0
+	})
+	return sortErr
+}
+
+// sortElementsByKey stably sorts elements in place by the key keyFn
+// returns for each of them, or by the elements themselves when keyFn is
+// nil, ascending or descending. keyFn is called once per element. Keys
+// compare by compareKeys.
+func (i *Interpreter) sortElementsByKey(elements []Value, keyFn Value, desc bool, s span.Span) error {
+	type keyed struct{ key, elem Value }
+	pairs := make([]keyed, len(elements))
+	for idx, elem := range elements {
+		key := elem
+		if keyFn != nil {
+			var err error
+			if key, err = i.callValue(keyFn, []Value{elem}, s); err != nil {
+				return err
+			}
+		}
+		pairs[idx] = keyed{key, elem}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		if desc {
+			return compareKeys(pairs[a].key, pairs[b].key) > 0
+		}
+		return compareKeys(pairs[a].key, pairs[b].key) < 0
+	})
+	for idx, pair := range pairs {
+		elements[idx] = pair.elem
+	}
+	return nil
+}
+
+// compareKeys compares sort keys like compareValues, except that two
+// arrays compare element by element, so [last, first] keys sort by last
+// name and then first name.
+func compareKeys(a, b Value) int {
+	aa, aOk := a.(*ArrayVal)
+	ba, bOk := b.(*ArrayVal)
+	if !aOk || !bOk {
+		return compareValues(a, b)
+	}
+	for idx := 0; idx < len(aa.Elements) && idx < len(ba.Elements); idx++ {
+		if c := compareKeys(aa.Elements[idx], ba.Elements[idx]); c != 0 {
+			return c
+		}
+	}
+	return len(aa.Elements) - len(ba.Elements)
+}
+
 // compareValues compares two values for sorting.
 func compareValues(a, b Value) int {
 	af, aOk := ToFloat64(a)
@@ -1713,20 +3206,30 @@ func compareValues(a, b Value) int {
 // Value equality
 // ============================================================
 
+// valuesEqual implements ==, under which 1 == 1.0.
 func valuesEqual(a, b Value) bool {
+	return equalValues(a, b, false)
+}
+
+// strictEqual implements ===, under which an int never equals a float.
+func strictEqual(a, b Value) bool {
+	return equalValues(a, b, true)
+}
+
+func equalValues(a, b Value, strict bool) bool {
 	switch av := a.(type) {
 	case IntVal:
 		if bv, ok := b.(IntVal); ok {
 			return int64(av) == int64(bv)
 		}
-		if bv, ok := b.(FloatVal); ok {
+		if bv, ok := b.(FloatVal); ok && !strict {
 			return float64(int64(av)) == float64(bv)
 		}
 	case FloatVal:
 		if bv, ok := b.(FloatVal); ok {
 			return float64(av) == float64(bv)
 		}
-		if bv, ok := b.(IntVal); ok {
+		if bv, ok := b.(IntVal); ok && !strict {
 			return float64(av) == float64(int64(bv))
 		}
 	case StringVal:
@@ -1744,6 +3247,16 @@ func valuesEqual(a, b Value) bool {
 		if bv, ok := b.(*EnumVariantVal); ok {
 			return av.EnumName == bv.EnumName && av.VariantName == bv.VariantName
 		}
+	case *ObjectVal:
+		// Records compare by value, field by field
+		if bv, ok := b.(*ObjectVal); ok && av.Class.Decl.Record && av.Class == bv.Class && av != bv {
+			for _, field := range av.Class.Decl.Fields {
+				if !equalValues(av.Props[field], bv.Props[field], strict) {
+					return false
+				}
+			}
+			return true
+		}
 	}
 	// Reference equality for objects/functions
 	return a == b
@@ -2,10 +2,23 @@ package runtime
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"light-lang/internal/ast"
 	"light-lang/internal/lexer"
 	"light-lang/internal/parser"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // runSource parses and executes source code, returning captured stdout and any error.
@@ -18,6 +31,9 @@ func runSource(source string) (string, error) {
 	var buf bytes.Buffer
 	interp := NewInterpreter(&buf)
 	err := interp.Run(file)
+	if err == nil {
+		err = interp.RunEventLoop()
+	}
 	return buf.String(), err
 }
 
@@ -61,6 +77,74 @@ func TestArithmetic(t *testing.T) {
 	expectOutput(t, `print(10.0 / 3.0)`, "3.3333333333333335\n")
 }
 
+func TestCompoundAssign(t *testing.T) {
+	expectOutput(t, `
+var x = 2
+x **= 10
+x %= 1000
+x &= 15
+x |= 64
+x ^= 1
+x <<= 2
+x >>= 1
+print(x)
+`, "146\n")
+	// the target's object and index are evaluated once
+	expectOutput(t, `
+var calls = 0
+var xs = [1, 2, 3]
+var m = {n: 7}
+function at() { calls += 1; return 1 }
+function box() { calls += 1; return m }
+xs[at()] += 10
+box().n *= 3
+box()["n"] -= 1
+print(xs, m.n, calls)
+`, "[1, 12, 3] 20 3\n")
+	// the target is evaluated before the value, which is not evaluated when
+	// reading the target fails
+	expectOutput(t, `
+var log = []
+function t(name, v) { log.push(name); return v }
+var xs = [1, 2]
+var o = {a: {n: 1}}
+t("xs", xs)[t("idx", 0)] += t("rhs", 5)
+t("o", o).a.n -= t("rhs", 1)
+try { t("null", null).n += t("never", 1) } catch (e) { print(e.message) }
+print(log, xs, o.a.n)
+`, "cannot access property 'n' on value of type 'null'\n"+
+		`["xs", "idx", "rhs", "o", "rhs", "null"] [6, 2] 0`+"\n")
+	expectOutput(t, `
+class Temp {
+    c = 0
+    get f() { return this.c * 2 }
+    set f(v) { this.c = v / 2 }
+}
+var t = new Temp()
+t.f += 10
+print(t.c)
+`, "5\n")
+	expectError(t, `
+var xs = [1]
+xs[3] += 1
+`, "out of range")
+}
+
+func TestPowerAndBitwise(t *testing.T) {
+	expectOutput(t, `print(2 ** 10, 2 ** 3 ** 2, -2 ** 2)`, "1024 512 -4\n")
+	expectOutput(t, `print(2 ** -1, 2.5 ** 2, 4 ** 0.5)`, "0.5 6.25 2\n")
+	expectOutput(t, `print(6 & 3, 6 | 3, 6 ^ 3, ~5)`, "2 7 5 -6\n")
+	expectOutput(t, `print(1 << 4, -16 >> 2, 1 + 1 << 2)`, "16 -4 8\n")
+	expectOutput(t, `print(5 & 1 == 1, 1 | 2 ^ 3 & 4)`, "true 3\n")
+	expectError(t, `print(1.5 & 1)`, "'&' requires integer operands, got 'float' and 'int'")
+	expectError(t, `print(1 << -1)`, "negative shift count -1")
+	expectOutput(t, `print(0 << 64, -1 << 63, 1 << 62, 3 >> 64)`, "0 -9223372036854775808 4611686018427387904 0\n")
+	expectError(t, `print(1 << 64)`, "integer overflow: 1 << 64 does not fit in 64 bits")
+	expectError(t, `print(1 << 63)`, "integer overflow: 1 << 63 does not fit in 64 bits")
+	expectError(t, "var n = 3\nn <<= 62", "at 2:1: integer overflow: 3 << 62 does not fit in 64 bits")
+	expectError(t, `print(~"a")`, "'~' requires an integer operand, got 'string'")
+}
+
 func TestVarDecl(t *testing.T) {
 	expectOutput(t, `
 var x = 10
@@ -213,6 +297,242 @@ print(p.y)
 `, "4\n6\n")
 }
 
+func TestStaticFields(t *testing.T) {
+	expectOutput(t, `
+class Limits {
+  static MAX = 100
+  static DOUBLE = Limits.MAX * 2
+  static count = 0
+  constructor() {
+    Limits.count += 1
+  }
+}
+class Child extends Limits {}
+new Limits()
+new Limits()
+print(Limits.MAX, Limits.DOUBLE, Limits.count)
+print(Child.MAX)
+`, "100 200 2\n100\n")
+	expectError(t, `
+class A {}
+print(A.missing)
+`, "class 'A' has no static field 'missing'")
+}
+
+func TestInstanceFields(t *testing.T) {
+	expectOutput(t, `
+class Point { x = 0  y = 0  constructor() {} }
+var p = new Point()
+print(p.x, p.y)
+class Bag {
+  items = []
+  count
+  label = "bag of " + this.items.length
+  add(v) { this.items.push(v) }
+}
+var a = new Bag()
+var b = new Bag()
+a.add(1)
+print(a.items, b.items, a.count, a.label)
+class Named extends Bag {
+  name = "unnamed"
+  constructor(name) {
+    print(this.name, this.label)
+    super()
+    this.name = name
+  }
+}
+var n = new Named("z")
+print(n.name, n.items)
+`, "0 0\n[1] [] null bag of 0\nunnamed bag of 0\nz []\n")
+	expectError(t, `
+class A { x = 1 / 0 }
+new A()
+`, "division by zero")
+}
+
+func TestAccessors(t *testing.T) {
+	expectOutput(t, `
+class Rect {
+  constructor(w, h) {
+    this._w = w
+    this.h = h
+  }
+  get area() { return this._w * this.h }
+  get width() { return this._w }
+  set width(v) {
+    if (v < 0) { throw new RangeError("negative width") }
+    this._w = v
+  }
+}
+var r = new Rect(2, 3)
+print(r.area, r.width)
+r.width = 5
+r.width += 1
+print(r.area, r?.width)
+try { r.width = -1 } catch (e) { print(e) }
+class Square extends Rect {
+  constructor(side) { super(side, side) }
+}
+var sq = new Square(4)
+setProp(sq, "width", 2)
+var {area} = sq
+print(getProp(sq, "area"), area)
+`, "6 2\n18 6\nRangeError: negative width\n8 8\n")
+	expectError(t, `
+class A { get x() { return 1 } }
+var a = new A()
+a.x = 2
+`, "property 'x' of class 'A' has a getter but no setter")
+}
+
+func TestToStringProtocol(t *testing.T) {
+	expectOutput(t, `
+class Point {
+  constructor(x, y) {
+    this.x = x
+    this.y = y
+  }
+  toString() { return "(" + this.x + ", " + this.y + ")" }
+}
+var p = new Point(1, 2)
+print(p, [p], {at: p})
+print("p = " + p, p + "!", `+"`at ${p}`"+`, toString(p))
+record Money(cents) {
+  toString() { return "$" + this.cents / 100.0 }
+}
+print(new Money(250), [new Money(5)])
+class Quiet extends Error {
+  toString() { return "quiet " + this.message }
+}
+print(new Quiet("x"), new Error("y"))
+print(parallelMap([1, 2], function(n) { return "" + new Point(n, n) }))
+class Bad { toString() { return 1 } }
+print(new Bad())
+`, "(1, 2) [(1, 2)] {\"at\": (1, 2)}\np = (1, 2) (1, 2)! at (1, 2) (1, 2)\n$2.5 [$0.05]\nquiet x Error: y\n[\"(1, 1)\", \"(2, 2)\"]\n<object Bad>\n")
+	expectError(t, `
+class Bad { toString() { return 1 } }
+print("" + new Bad())
+`, "Bad.toString() must return a string, got 'int'")
+}
+
+func TestStaticMethods(t *testing.T) {
+	expectOutput(t, `
+class Temp {
+  static const FREEZING = 32
+  static created = 0
+  static fromCelsius(c) {
+    this.created += 1
+    return new Temp(c * 9 / 5 + Temp.FREEZING)
+  }
+  constructor(f) { this.f = f }
+}
+class Reading extends Temp {}
+print(Temp.fromCelsius(100).f, Reading.fromCelsius(0).f, Temp.created)
+var convert = Temp.fromCelsius
+print(convert(10).f, Temp.FREEZING)
+record Point(x, y) {
+  static const ORIGIN = Point.at(0)
+  static at(n) { return new Point(n, n) }
+}
+print(Point.ORIGIN, Point.at(2))
+`, "212 32 2\n50 32\nPoint(x: 0, y: 0) Point(x: 2, y: 2)\n")
+	expectError(t, `
+class A { static const MAX = 1 }
+A.MAX = 2
+`, "cannot assign to constant 'A.MAX'")
+	expectError(t, `
+class A { static make() { return 1 } }
+A.make = null
+`, "cannot assign to constant 'A.make'")
+	expectError(t, `
+class A {}
+A.make()
+`, "class 'A' has no static method 'make'")
+}
+
+func TestTimers(t *testing.T) {
+	expectOutput(t, `
+setTimeout(() => print("late"), 20)
+setTimeout(() => print("early"), 5)
+setTimeout((a, b) => print("args", a, b), 5, 1, 2)
+var ticks = 0
+var id = 0
+id = setInterval(function() {
+  ticks += 1
+  print("tick", ticks)
+  if (ticks == 3) {
+    clearInterval(id)
+  }
+}, 1)
+var cancelled = setTimeout(() => print("never"), 1)
+clearTimeout(cancelled)
+print("sync")
+`, "sync\ntick 1\ntick 2\ntick 3\nearly\nargs 1 2\nlate\n")
+}
+
+func TestParallelMap(t *testing.T) {
+	expectOutput(t, `
+var base = 10
+function work(n) {
+  var total = 0
+  for (var k = 0; k < 100; k += 1) {
+    total += k
+  }
+  return total + n * base
+}
+print(parallelMap([1, 2, 3, 4, 5, 6, 7, 8], work, 3))
+print(parallelMap([], work))
+`, "[4960, 4970, 4980, 4990, 5000, 5010, 5020, 5030]\n[]\n")
+
+	// Workers are isolated: mutations of captured state do not leak back
+	expectOutput(t, `
+var hits = [0]
+var out = parallelMap([1, 2, 3], function(x) {
+  hits.push(x)
+  return len(hits)
+}, 1)
+print(out, hits)
+`, "[2, 3, 4] [0]\n")
+
+	expectError(t, `parallelMap([1, 0], x => 10 / x, 2)`, "division by zero")
+}
+
+func TestWorker(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "square.lt")
+	err := os.WriteFile(script, []byte(`
+var msg = receive()
+while (msg != null) {
+  msg.values.push(msg.n * msg.n)
+  send(msg)
+  msg = receive()
+}
+send("bye")
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectOutput(t, `
+var w = worker("`+filepath.ToSlash(script)+`")
+var job = {n: 7, values: []}
+w.send(job)
+var reply = w.receive()
+print(reply.values, job.values)
+w.close()
+print(w.receive())
+w.join()
+print(w.receive())
+`, "[49] []\nbye\nnull\n")
+
+	bad := filepath.Join(dir, "bad.lt")
+	if err := os.WriteFile(bad, []byte(`throw "boom"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, `worker("`+filepath.ToSlash(bad)+`").join()`, "boom")
+}
+
 func TestStringConcat(t *testing.T) {
 	expectOutput(t, `print("hello" + " " + "world")`, "hello world\n")
 }
@@ -257,6 +577,18 @@ print(s[4])
 `, "h\no\n")
 }
 
+func TestStringCharacters(t *testing.T) {
+	expectOutput(t, `
+var s = "héllo, 世界!"
+print(len(s), s.length, s[1], s.charAt(7), s.indexOf("世"), s.indexOf("x"))
+print(s.slice(7, 9), s.slice(-3), s.substring(1, 3), s.substring(20))
+print(s.codePointAt(1), s.codePointAt(99), fromCodePoint(72, 233, 0x1F600), fromCodePoint())
+`, "10 10 é 世 7 -1\n世界 世界! él \n233 null Hé\U0001F600 \n")
+	expectError(t, `print("héllo"[5])`, "string index 5 out of range (length 5)")
+	expectError(t, `fromCodePoint(0xD800)`, "fromCodePoint(): 55296 is not a valid code point")
+	expectError(t, `fromCodePoint("a")`, "fromCodePoint() arguments must be integers, got 'string'")
+}
+
 func TestNullEquality(t *testing.T) {
 	expectOutput(t, `print(null == null)`, "true\n")
 	expectOutput(t, `print(null != 1)`, "true\n")
@@ -300,3 +632,1871 @@ while (i < 10) {
 `
 	expectOutput(t, source, "0\n1\n1\n2\n3\n5\n8\n13\n21\n34\n")
 }
+
+func TestImportNativeNotFound(t *testing.T) {
+	t.Setenv("LIGHT_PLUGIN_PATH", t.TempDir())
+	_, err := runSource(`import native "no_such_ext"`)
+	if err == nil || !strings.Contains(err.Error(), "native extension 'no_such_ext' not found") {
+		t.Errorf("expected not-found error, got %v", err)
+	}
+}
+
+func TestEvalReturnsLastExpression(t *testing.T) {
+	interp := NewInterpreter(&bytes.Buffer{})
+	eval := func(source string) Value {
+		t.Helper()
+		tokens, _ := lexer.New(source, "test.lt").Tokenize()
+		file, _ := parser.New(tokens).ParseFile()
+		val, err := interp.Eval(file)
+		if err != nil {
+			t.Fatalf("eval %q: %v", source, err)
+		}
+		return val
+	}
+
+	if v := eval("var x = 40"); v != (NullVal{}) {
+		t.Errorf("expected null for declaration, got %v", v)
+	}
+	if v := eval("x + 2"); v != IntVal(42) {
+		t.Errorf("expected 42, got %v", v)
+	}
+}
+
+func TestImportModule(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lib"), 0o755)
+	os.WriteFile(filepath.Join(dir, "lib", "util.lt"), []byte(`
+println("loading util")
+function double(x) { return x * 2 }
+const NAME = "util"
+`), 0o644)
+	os.WriteFile(filepath.Join(dir, "other.lt"), []byte(`import "./lib/util"
+function quad(x) { return double(double(x)) }
+`), 0o644)
+
+	tokens, _ := lexer.New(`
+import "./lib/util"
+import "./other.lt"
+println(double(21), NAME, quad(2))
+`, "main.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.SetScriptPath(filepath.Join(dir, "main.lt"))
+	if err := interp.Run(file); err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	// util runs once even though it is imported twice
+	if got, want := buf.String(), "loading util\n42 util 8\n"; got != want {
+		t.Errorf("output mismatch:\nexpected: %q\ngot:      %q", want, got)
+	}
+}
+
+func TestImportExports(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.lt": {Data: []byte(`import "./shapes"
+print(area(new Square(3)), UNIT, typeOf(Kind.Flat))
+print(scale)
+`)},
+		"app/shapes.lt": {Data: []byte(`var scale = 2
+function scaled(x) { return x * scale }
+export class Square { constructor(side) { this.side = side } }
+export function area(sq) { return scaled(sq.side * sq.side) }
+export const UNIT = "cm2"
+export enum Kind { Flat, Solid }
+`)},
+		"app/a.lt": {Data: []byte("import \"./b\"\nexport var A = 1\n")},
+		"app/b.lt": {Data: []byte("import \"./a\"\nexport var B = 2\n")},
+	}
+	var buf bytes.Buffer
+	err := NewInterpreter(&buf).RunFS(fsys, "app/main.lt")
+	if buf.String() != "18 cm2 Kind\n" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+	if err == nil || !strings.Contains(err.Error(), "undefined variable 'scale'") {
+		t.Errorf("expected unexported 'scale' to be undefined, got %v", err)
+	}
+
+	err = NewInterpreter(&buf).RunFS(fsys, "app/a.lt")
+	if err == nil || !strings.Contains(err.Error(), "import cycle through app/b.lt") {
+		t.Errorf("expected import cycle error, got %v", err)
+	}
+}
+
+func TestRunFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.lt":     {Data: []byte("import \"./lib/util\"\nprintln(double(4))\n")},
+		"app/lib/util.lt": {Data: []byte("function double(x) { return x * 2 }\n")},
+		"app/escape.lt":   {Data: []byte("import \"../../etc/passwd\"\n")},
+	}
+	var buf bytes.Buffer
+	if err := NewInterpreter(&buf).RunFS(fsys, "app/main.lt"); err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	if buf.String() != "8\n" {
+		t.Errorf("expected 8, got %q", buf.String())
+	}
+
+	err := NewInterpreter(&buf).RunFS(fsys, "app/escape.lt")
+	if err == nil || !strings.Contains(err.Error(), "escapes the embedded filesystem") {
+		t.Errorf("expected escape error, got %v", err)
+	}
+}
+
+func TestFFI(t *testing.T) {
+	source := `var m = ffiOpen("libm.so.6")
+var pow = ffiFunc(m, "pow", "double(double, double)")
+println(pow(2, 8))`
+
+	_, err := runSource(source)
+	if err == nil || !strings.Contains(err.Error(), "FFI is disabled") {
+		t.Fatalf("expected FFI to be disabled by default, got %v", err)
+	}
+
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.AllowFFI()
+	if err := interp.Run(file); err != nil {
+		if strings.Contains(err.Error(), "not available") || strings.Contains(err.Error(), "cannot open") {
+			t.Skipf("FFI unavailable here: %v", err)
+		}
+		t.Fatalf("runtime error: %v", err)
+	}
+	if buf.String() != "256\n" {
+		t.Errorf("expected 256, got %q", buf.String())
+	}
+}
+
+func TestDoc(t *testing.T) {
+	expectOutput(t, `doc("push")`, "push(array, value)\n    Append value to array.\n")
+	expectOutput(t, `
+function add(a, b) { return a + b }
+doc(add)`, "function add(a, b)\n")
+	expectOutput(t, `
+class Point {
+  constructor(x, y) { this.x = x }
+  norm() { return 0 }
+}
+doc(Point)`, "class Point\n    constructor(x, y)\n    norm()\n")
+
+	out, err := runSource(`doc()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "setTimeout(fn, ms, args...)") {
+		t.Errorf("expected builtin listing, got:\n%s", out)
+	}
+}
+
+func TestRunRecoversFromPanic(t *testing.T) {
+	// A hand-built tree with a missing expression cannot come from the parser
+	file := &ast.File{Body: []ast.Node{&ast.ExprStmt{}}}
+	err := NewInterpreter(&bytes.Buffer{}).Run(file)
+	if err == nil || !strings.Contains(err.Error(), "internal error") {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+}
+
+func TestRunBadNodes(t *testing.T) {
+	// runSource ignores parse errors, so the tree holds error placeholders
+	for _, source := range []string{"print(1 +)", "var = 1"} {
+		_, err := runSource(source)
+		if err == nil || !strings.Contains(err.Error(), "syntax errors") {
+			t.Errorf("%q: expected syntax error, got %v", source, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		limits Limits
+		want   string
+	}{
+		{"steps", "while (true) {}", Limits{MaxSteps: 1000}, "step limit of 1000 exceeded"},
+		{"timeout", "while (true) {}", Limits{Timeout: 50 * time.Millisecond}, "timeout of 50ms exceeded"},
+		{"depth", "function f(n) { return f(n + 1) }\nf(0)", Limits{MaxCallDepth: 100}, "call depth limit of 100 exceeded"},
+		{"methods", "class A { m() { return this.m() } }\nnew A().m()", Limits{MaxCallDepth: 100}, "call depth limit of 100 exceeded"},
+		{"heap push", "var rows = []\nwhile (true) { rows.push([1, 2, 3]) }", Limits{MaxHeapValues: 1000}, "heap limit of 1000 values exceeded"},
+		{"heap keys", "var m = {}\nvar k = 0\nwhile (true) { m[\"k\" + k] = k; k += 1 }", Limits{MaxHeapValues: 500}, "heap limit of 500 values exceeded"},
+		{"heap builtins", "var a = [1, 2, 3]\nwhile (true) { a = a.concat(a) }", Limits{MaxHeapValues: 5000}, "heap limit of 5000 values exceeded"},
+		{"heap objects", "class P { constructor() { this.x = 1 } }\nvar ps = []\nwhile (true) { ps.push(new P()) }", Limits{MaxHeapValues: 300}, "heap limit of 300 values exceeded"},
+	}
+	for _, tc := range cases {
+		tokens, _ := lexer.New(tc.source, "test.lt").Tokenize()
+		file, _ := parser.New(tokens).ParseFile()
+		interp := NewInterpreter(&bytes.Buffer{}, WithLimits(tc.limits))
+		err := interp.Run(file)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected %q, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// Limits that are not reached leave the script alone
+	tokens, _ := lexer.New("function f(n) { if (n > 0) { return f(n - 1) } return 0 }\nprint(f(10), [1, 2].concat([3]))", "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.SetLimits(Limits{MaxSteps: 10000, MaxCallDepth: 20, MaxHeapValues: 20, Timeout: time.Second})
+	if err := interp.Run(file); err != nil || strings.TrimSpace(buf.String()) != "0 [1, 2, 3]" {
+		t.Errorf("expected 0, got %q (%v)", buf.String(), err)
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+	// Self-references print as markers instead of recursing forever
+	expectOutput(t, `
+var a = [1, 2]
+a.push(a)
+var m = {x: 1}
+m.self = m
+print(a, m)
+`, "[1, 2, [...]] {\"x\": 1, \"self\": {...}}\n")
+
+	expectOutput(t, `
+class Node {
+  constructor(name) {
+    this.name = name
+    this.next = this
+  }
+}
+pprint({tags: ["a", "b"], node: new Node("n")})
+pprint([[1, 2], "x"], 4)
+`, `{
+  "tags": ["a", "b"],
+  "node": Node {
+    name: "n",
+    next: <cycle Node>
+  }
+}
+[[1, 2], "x"]
+`)
+	expectError(t, `pprint(1, "x")`, "indent must be a non-negative integer")
+}
+
+func TestIntrospection(t *testing.T) {
+	expectOutput(t, `
+var count = 1
+function f(a) {
+  var b = a + 1
+  if (b > 0) {
+    var c = 3
+    print(locals())
+  }
+}
+f(1)
+print(globals())
+`, "{\"a\": 1, \"b\": 2, \"c\": 3}\n{\"count\": 1, \"f\": <function f>}\n")
+
+	expectOutput(t, `
+class Base { greet() { return "hi" } }
+class Point extends Base {
+  static ORIGIN = 0
+  constructor() { this.x = 1 }
+  norm() { return 0 }
+}
+enum Color { Red, Green }
+print(dir(new Point()), dir(Point), dir({b: 1, a: 2}), dir(Color))
+`, `["greet", "norm", "x"] ["ORIGIN"] ["a", "b"] ["Green", "Red"]`)
+	expectError(t, `dir(1)`, "dir() not supported for type 'int'")
+}
+
+func TestReflection(t *testing.T) {
+	expectOutput(t, `
+class Animal { speak() { return "..." } eat() {} }
+class Dog extends Animal {
+  constructor(name) { this.name = name; this.age = 3 }
+  speak() { return "woof" }
+  fetch() {}
+}
+var d = new Dog("rex")
+print(className(d), className(Animal))
+print(methodsOf(Dog), methodsOf(d))
+print(propsOf(d))
+print(hasMethod(d, "eat"), hasMethod(Dog, "fly"), hasMethod(1, "eat"))
+`, `Dog Animal
+["eat", "fetch", "speak"] ["eat", "fetch", "speak"]
+{"age": 3, "name": "rex"}
+true false false
+`)
+	expectError(t, `className([1])`, "className() expects an object or class, got 'array'")
+}
+
+func TestDynamicAccess(t *testing.T) {
+	expectOutput(t, `
+class Point {
+  constructor(x, y) { this.x = x; this.y = y }
+  scale(k) { return new Point(this.x * k, this.y * k) }
+}
+var p = new Point(1, 2)
+var field = "x"
+setProp(p, field, 10)
+print(getProp(p, field), getProp(p, "missing"))
+var q = invoke(p, "scale", [3])
+print(q.x, q.y)
+print(invoke("a,b", "split", [","]), invoke([3, 1, 2], "sort"))
+var m = {}
+setProp(m, "k", 1)
+print(m, getProp([1, 2], "length"))
+`, "10 null\n30 6\n[\"a\", \"b\"] [1, 2, 3]\n{\"k\": 1} 2\n")
+	expectError(t, `
+class A {}
+invoke(new A(), "nope")`, "undefined method 'nope' on class 'A'")
+	expectError(t, `setProp(1, "x", 2)`, "cannot set property on value of type 'int'")
+}
+
+func TestImportData(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.lt": {Data: []byte(`import config from "./config.json"
+import readme from "./README.md" as text
+import raw from "./data.txt" as json
+println(config.name, config.ports, config.debug, config.ratio, config.extra)
+println(keys(config))
+println(len(readme), raw[1])
+`)},
+		"app/config.json": {Data: []byte(`{"name": "svc", "ports": [80, 443], "debug": false, "ratio": 0.5, "extra": null}`)},
+		"app/README.md":   {Data: []byte("hello\n")},
+		"app/data.txt":    {Data: []byte(`[1, {"k": "v"}]`)},
+		"app/bad.lt":      {Data: []byte(`import notes from "./README.md"`)},
+		"app/broken.lt":   {Data: []byte(`import cfg from "./broken.json"`)},
+		"app/broken.json": {Data: []byte(`{"a": }`)},
+	}
+	var buf bytes.Buffer
+	if err := NewInterpreter(&buf).RunFS(fsys, "app/main.lt"); err != nil {
+		t.Fatalf("runtime error: %v", err)
+	}
+	want := "svc [80, 443] false 0.5 null\n[\"name\", \"ports\", \"debug\", \"ratio\", \"extra\"]\n6 {\"k\": \"v\"}\n"
+	if buf.String() != want {
+		t.Errorf("output mismatch:\nexpected: %q\ngot:      %q", want, buf.String())
+	}
+
+	err := NewInterpreter(&buf).RunFS(fsys, "app/bad.lt")
+	if err == nil || !strings.Contains(err.Error(), "add 'as text' or 'as json'") {
+		t.Errorf("expected format error, got %v", err)
+	}
+	err = NewInterpreter(&buf).RunFS(fsys, "app/broken.lt")
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected JSON error, got %v", err)
+	}
+}
+
+func TestDedent(t *testing.T) {
+	expectOutput(t, `
+function usage(name) {
+  return dedent(`+"`"+`
+    Usage: ${name} [options]
+
+      -h    show help
+    `+"`"+`)
+}
+print(usage("light"))
+print("  a\n    b".dedent())
+print(dedent("x"), dedent(""))
+`, "Usage: light [options]\n\n  -h    show help\na\n  b\nx \n")
+}
+
+func TestMultipleReturn(t *testing.T) {
+	expectOutput(t, `
+function divmod(a, b) {
+  return a / b, a % b
+}
+var q, r = divmod(17, 5)
+print(q, r)
+const first, second = [1, "two"]
+print(first, second)
+print(divmod(9, 2))
+`, "3 2\n1 two\n[4, 1]\n")
+	expectError(t, `var a, b = [1, 2, 3]`, "cannot unpack 3 values into 2 variables")
+	expectError(t, `var a, b = 5`, "cannot unpack value of type 'int' into 2 variables")
+	expectError(t, `
+const a, b = [1, 2]
+a = 3`, "const")
+}
+
+func TestRecord(t *testing.T) {
+	expectOutput(t, `
+record Point(x, y) {
+  static ORIGIN = new Point(0, 0)
+  norm() { return this.x * this.x + this.y * this.y }
+}
+var p = new Point(3, 4)
+print(p, p.x, p.y, p.norm())
+print(p == new Point(3, 4), p == new Point(4, 3), p != Point.ORIGIN)
+record Label(text, at)
+print(new Label("home", p))
+print(toString(new Label("x", null)))
+var record = "still a name"
+print(record)
+`, "Point(x: 3, y: 4) 3 4 25\ntrue false true\nLabel(text: \"home\", at: Point(x: 3, y: 4))\nLabel(text: \"x\", at: null)\nstill a name\n")
+	expectError(t, `
+record Pair(a, b)
+new Pair(1)`, "Pair expects 2 arguments, got 1")
+	expectError(t, `
+record Pair(a, b)
+class Triple extends Pair {}`, "cannot extend record 'Pair'")
+}
+
+func TestDocComments(t *testing.T) {
+	expectOutput(t, `
+/// Doubles n.
+function double(n) { return n * 2 }
+// A counter.
+class Counter {
+  /// Adds one.
+  inc() {}
+}
+doc(double)
+doc("Counter")
+`, "function double(n)\n    Doubles n.\nclass Counter\n    A counter.\n    inc()\n        Adds one.\n")
+}
+
+func TestRandomSeed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.lt": {Data: []byte(`import "./dice"
+var xs = [1, 2, 3, 4, 5]
+println(random() < 1, roll(), shuffle(xs), len(xs))
+`)},
+		"app/dice.lt": {Data: []byte("function roll() { return randomInt(1, 6) }\n")},
+	}
+	run := func(seed int64) string {
+		var buf bytes.Buffer
+		interp := NewInterpreter(&buf)
+		interp.SetSeed(seed)
+		if err := interp.RunFS(fsys, "app/main.lt"); err != nil {
+			t.Fatalf("runtime error: %v", err)
+		}
+		return buf.String()
+	}
+	first := run(42)
+	if again := run(42); again != first {
+		t.Errorf("same seed gave different output: %q vs %q", first, again)
+	}
+	if !strings.HasPrefix(first, "true ") || !strings.HasSuffix(first, " 5\n") {
+		t.Errorf("unexpected output %q", first)
+	}
+
+	expectOutput(t, `
+var n = randomInt(3, 3)
+var ok = true
+for (var k = 0; k < 100; k += 1) {
+  var r = randomInt(-2, 2)
+  if (r < -2 || r > 2) { ok = false }
+}
+print(n, ok)
+`, "3 true\n")
+	expectError(t, `randomInt(5, 1)`, "min 5 is greater than max 1")
+}
+
+func TestMemoize(t *testing.T) {
+	expectOutput(t, `
+var calls = 0
+var fib = memoize(function(n) {
+  calls += 1
+  if (n < 2) { return n }
+  return fib(n - 1) + fib(n - 2)
+})
+print(fib(60), calls)
+print(fib(60), calls)
+`, "1548008755920 61\n1548008755920 61\n")
+
+	expectOutput(t, `
+var calls = 0
+function total(xs, opts) {
+  calls += 1
+  var sum = 0
+  for (var k = 0; k < len(xs); k += 1) { sum += xs[k] }
+  return sum * opts["scale"]
+}
+var cached = memoize(total)
+var xs = [1, 2, 3]
+print(cached(xs, {"scale": 2}), cached([1, 2, 3], {"scale": 2}), calls)
+push(xs, 4)
+print(cached(xs, {"scale": 2}), cached([], {"scale": 1.0}), calls)
+print(cached)
+`, "12 12 1\n20 0 3\n<builtin total>\n")
+
+	expectError(t, `memoize(1)`, "memoize() expects a function, got 'int'")
+}
+
+func TestCurryCompose(t *testing.T) {
+	expectOutput(t, `
+function add3(a, b, c) { return a + b + c }
+var add = curry(add3)
+var add1 = add(1)
+print(add(1)(2)(3), add1(2, 3), add(1, 2, 3), add1(10)(20))
+var pushTo = curry(push, 2)
+var xs = []
+pushTo(xs)(7)
+print(xs)
+
+function double(x) { return x * 2 }
+function inc(x) { return x + 1 }
+print(compose(double, inc)(5), pipe(double, inc)(5), pipe(add3, double)(1, 2, 3))
+print(compose()(4), [1, 2, 3].map(pipe(inc, toString)))
+`, "6 6 6 31\n[7]\n12 11 12\n4 [\"2\", \"3\", \"4\"]\n")
+
+	expectError(t, `curry(len)`, "curry() needs an arity for builtin 'len'")
+	expectError(t, `compose(print, 3)`, "compose() expects functions, got 'int'")
+	expectError(t, `function f(a, b) { return a } curry(f)()`, "curried f() expects at least 1 argument")
+}
+
+// TestCombinatorsInWorkers runs the wrappers memoize(), curry(), compose()
+// and pipe() return on parallel workers and tasks. Run with -race: each
+// worker must call back into its own interpreter.
+func TestCombinatorsInWorkers(t *testing.T) {
+	expectOutput(t, `
+function inc(v) { return v + 1 }
+function add(a, b) { return a + b }
+var double = memoize(function(v) { return v * 2 })
+var add10 = curry(add)(10)
+var both = pipe(inc, double)
+print(parallelMap(range(8).toArray(), function(x) {
+    var m = memoize(inc)
+    return m(x) + double(x)
+}, 8))
+print(parallelMap(range(8).toArray(), function(x) {
+    return curry(add)(x)(1) + compose(inc, inc)(x) + add10(x) + both(x)
+}, 8))
+var task = spawn double(4)
+var chained = spawn both(4)
+print(task.join(), chained.join())
+`, "[1, 4, 7, 10, 13, 16, 19, 22]\n[15, 20, 25, 30, 35, 40, 45, 50]\n8 10\n")
+}
+
+// TestAsyncInWorkers uses timers and promises on parallel workers and
+// tasks. Run with -race: each worker schedules on its own event loop.
+func TestAsyncInWorkers(t *testing.T) {
+	expectOutput(t, `
+async function later(x) {
+    await delay(5)
+    return x + 1
+}
+print(parallelMap([1, 2, 3, 4], function(x) {
+    var out = []
+    setTimeout(() => out.push(x * 10), 5)
+    var id = setInterval(() => {
+        out.push(x)
+        if (len(out) == 3) { clearInterval(id) }
+    }, 1)
+    clearTimeout(setTimeout(() => out.push(0), 1))
+    return out
+}, 4))
+var task = spawn later(1)
+var all = spawn (async function() { return await Promise.all([later(1), Promise.resolve(5)]) })()
+print(await task.join(), await all.join())
+`, "[[1, 1, 1, 10], [2, 2, 2, 20], [3, 3, 3, 30], [4, 4, 4, 40]]\n2 [2, 5]\n")
+}
+
+func TestPackUnpack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "header.bin")
+	expectOutput(t, `
+var header = pack(">4sHhI?xd", ["LT", 258, -2, 70000, true, 1.5])
+print(len(header), header[0], header[1], header[2], header[4], header[5])
+print(unpack(">4sHhI?xd", header))
+print(writeBytes(`+"`"+path+"`"+`, header))
+var data = readBytes(`+"`"+path+"`"+`)
+print(unpack("<2B", pack("<H", [513])), unpack(">H", data, 4), unpack("3b", [255, 128, 1]))
+`, "22 76 84 0 1 2\n[\"LT\", 258, -2, 70000, true, 1.5]\n22\n[1, 2] [258] [-1, -128, 1]\n")
+
+	expectError(t, `pack("B", [256])`, "256 does not fit in 8 bits")
+	expectError(t, `pack("HH", [1])`, "needs more than 1 values")
+	expectError(t, `pack("H", [1, 2])`, "takes 1 values, got 2")
+	expectError(t, `unpack("I", [1, 2])`, "needs 4 bytes, got 2")
+	expectError(t, `pack("z", [])`, "unknown format code 'z'")
+	expectError(t, `writeBytes("x.bin", [1, 300])`, "element 1 is not a byte")
+}
+
+func TestStrictIndex(t *testing.T) {
+	expectOutput(t, `
+var m = {"name": "light", "tags": null}
+print(m["nmae"], m.nmae, m.get("name"), m.get("port", 8080), m.get("tags", 1))
+`, "null null light 8080 null\n")
+
+	expectOutput(t, `"use strict index"
+var m = {"name": "light", "tags": null}
+class P { constructor() { this.x = 1 } }
+var p = new P()
+print(m["name"], m.tags, m.get("port", 8080), p.x, getProp(p, "x"))
+`, "light null 8080 1 1\n")
+	expectError(t, "\"use strict index\"\nvar m = {\"name\": 1}\nprint(m[\"nmae\"])", "map has no key 'nmae'")
+	expectError(t, "\"use strict index\"\nvar m = {\"name\": 1}\nprint(m.nmae)", "map has no key 'nmae'")
+	expectError(t, "\"use strict index\"\nclass P {}\nprint(getProp(new P(), \"y\"))", "object 'P' has no property 'y'")
+	expectError(t, `var m = {} m.size()`, "map has no method 'size'")
+
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.SetStrictIndex(true)
+	tokens, _ := lexer.New("var m = {}\nprint(m.missing)", "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	if err := interp.Run(file); err == nil || !strings.Contains(err.Error(), "map has no key 'missing'") {
+		t.Errorf("expected strict index error, got %v", err)
+	}
+}
+
+func TestStrictEquality(t *testing.T) {
+	expectOutput(t, `
+var r = [1 == 1.0, 1 === 1.0, 1 !== 1.0, 2.0 === 2.0, "a" === "a", null === null, [1] === [1]]
+print(r)
+record P(x)
+print(new P(1) == new P(1.0), new P(1) === new P(1.0), new P(1) === new P(1))
+`, "[true, false, true, true, true, true, false]\ntrue false true\n")
+
+	expectOutput(t, `"use strict index"
+"use strict equality"
+print(1 == 1.0, 1 != 1.0, 1 == 1, {a: 1}.a)
+`, "false true true 1\n")
+
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.SetStrictEquality(true)
+	tokens, _ := lexer.New("print(2 == 2.0)", "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	if err := interp.Run(file); err != nil || buf.String() != "false\n" {
+		t.Errorf("expected false under strict equality, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	expectOutput(t, `"use strict"
+var n = 3
+var log = []
+while (n > 0) { n -= 1 }
+for (var k = 0; k < 2; k += 1) { log.push("k" + toString(k)) }
+print(log, n == 0 ? "done" : "not yet", `+"`n=${n}`"+`, 1.5 < 2.5, 1 === 1.0)
+`, "[\"k0\", \"k1\"] done n=0 true false\n")
+
+	expectError(t, "\"use strict\"\nprint(\"n=\" + 1)", "cannot join 'string' and 'int' with '+' in strict mode")
+	expectError(t, "\"use strict\"\nvar s = \"a\"\ns += null", "cannot join 'string' and 'null' with '+' in strict mode")
+	expectError(t, "\"use strict\"\nif (1) { print(1) }", "condition must be a bool in strict mode, got 'int'")
+	expectError(t, "\"use strict\"\nvar xs = []\nwhile (xs) {}", "condition must be a bool in strict mode, got 'array'")
+	expectError(t, "\"use strict\"\nprint(null ? 1 : 2)", "condition must be a bool in strict mode, got 'null'")
+	expectError(t, "\"use strict\"\nprint(1 < 1.5)", "cannot compare 'int' and 'float' with '<' in strict mode")
+	expectError(t, "\"use strict\"\nprint(2.0 == 2)", "cannot compare 'float' and 'int' with '==' in strict mode")
+
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.SetStrict(true)
+	tokens, _ := lexer.New("if (\"yes\") { print(1) }", "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	if err := interp.Run(file); err == nil || !strings.Contains(err.Error(), "condition must be a bool in strict mode, got 'string'") {
+		t.Errorf("expected strict condition error, got %v", err)
+	}
+}
+
+func TestForOfPair(t *testing.T) {
+	expectOutput(t, `
+for (var i, v of ["a", "b"]) { print(i, v) }
+var m = {x: 1, y: [2]}
+for (var k, v of m) { print(k, v) }
+for (var k of m) { print(k) }
+for (var i, v of []) { print("never") }
+`, "0 a\n1 b\nx 1\ny [2]\nx\ny\n")
+	expectError(t, "for (var k, v of 3) {}", "for-of requires an array, map, set, range or string, got 'int'")
+}
+
+func TestForOfString(t *testing.T) {
+	expectOutput(t, `
+var out = []
+for (var ch of "héllo😀") { out.push(ch) }
+print(out.length, out.join("|"))
+for (var i, ch of "aé") { print(i, ch) }
+for (var ch of "") { print("never") }
+`, "6 h|é|l|l|o|😀\n0 a\n1 é\n")
+}
+
+func TestRestAndSpread(t *testing.T) {
+	expectOutput(t, `
+function sum(label, ...nums) {
+    var total = 0
+    for (var n of nums) { total += n }
+    return label + total
+}
+print(sum("none:"), sum("some:", 1, 2, 3))
+var parts = [4, 5]
+print(sum("spread:", ...parts, 6, ...[]), sum(...["all:", 1]))
+var tail = (first, ...others) => others
+print(tail(1), tail(1, 2, 3), ...["x", "y"])
+class Logger {
+    constructor(...tags) { this.tags = tags }
+    log(msg, ...args) { return msg + " " + len(args) + " " + this.tags.join(",") }
+}
+print(new Logger("a", "b").log("hi", 1, 2))
+`, "none:0 some:6\nspread:15 all:1\n[] [2, 3] x y\nhi 2 a,b\n")
+	expectError(t, "function f(a, b, ...rest) {}\nf(1)", "f() expects at least 2 arguments, got 1")
+	expectError(t, "function f(a) {}\nf(...[1, 2])", "f() expects 1 arguments, got 2")
+	expectError(t, "print(...3)", "cannot spread value of type 'int' into arguments, expected an array")
+}
+
+func TestDestructuring(t *testing.T) {
+	expectOutput(t, `
+var [a, b] = [1, 2]
+[a, b] = [b, a]
+print(a, b)
+const {x, y: why} = {x: 3, y: 4}
+var [head, ...tail] = [1, 2, 3]
+var [[p, q], {name}] = [[5, 6], {name: "n"}]
+print(x, why, head, tail, p, q, name)
+var m = {k: 0}
+var arr = [0, 0]
+{k: m.k} = {k: 9}
+[arr[0], arr[1]] = [7, 8]
+print(m.k, arr)
+record Point(x, y)
+for (var {x, y} of [new Point(1, 2), new Point(3, 4)]) {
+    print(x * y)
+}
+for (var [key, ...rest] of [["a", 1, 2], ["b"]]) {
+    print(key, rest)
+}
+var {missing} = {}
+print(missing)
+`, "2 1\n3 4 1 [2, 3] 5 6 n\n9 [7, 8]\n2\n12\na [1, 2]\nb []\nnull\n")
+	expectError(t, "var [a, b] = [1]", "cannot destructure 1 values into 2 variables")
+	expectError(t, "var [a, b, ...c] = [1]", "cannot destructure 1 values into at least 2 variables")
+	expectError(t, "var [a] = {}", "cannot destructure value of type 'map' as an array")
+	expectError(t, "var {a} = [1]", "cannot destructure value of type 'array' as a map")
+	expectError(t, "const [a] = [1]\n[a] = [2]", "cannot assign to constant 'a'")
+	expectError(t, "var [a, a] = [1, 2]", "variable 'a' already declared in this scope")
+	expectError(t, "\"use strict index\"\nvar {a} = {}", "map has no key 'a'")
+}
+
+func TestOptionalChaining(t *testing.T) {
+	expectOutput(t, `
+var user = {name: "ann", address: null, tags: ["a"]}
+var none = null
+print(user?.name, none?.name, none?.address.city, user.address?.city)
+print(none?.[0], user.tags?.[0], none?.tags[0].x, none?.missing())
+var f = null
+print(f?.(1))
+class Greeter { hi() { return "hi" } }
+var g = new Greeter()
+print(g.hi?.(), g.bye?.())
+print(null ?? "default", 0 ?? 1, false ?? true, none?.x ?? "fallback")
+var calls = 0
+function side() { calls += 1; return 1 }
+print(1 ?? side(), null ?? side(), calls)
+`, "ann null null null\nnull a null null\nnull\nhi null\ndefault 0 false fallback\n1 1 1\n")
+	expectError(t, "var a = {b: null}\nprint(a?.b.c)", "cannot access property 'c' on value of type 'null'")
+	expectError(t, "var f = 1\nf?.()", "cannot call value of type 'int'")
+}
+
+func TestErrorClasses(t *testing.T) {
+	expectOutput(t, `
+try { throw "oops" } catch (e) { print(e, e.message, e.name, e instanceof Error, e instanceof TypeError) }
+try { var y = 1 / 0 } catch (e) { print(e instanceof Error, e.message) }
+function check(n) {
+    if (n < 0) { throw new RangeError("negative: " + n) }
+    return n
+}
+try { check(-1) } catch (e) {
+    print(e instanceof RangeError, e instanceof Error, e.name, e.message)
+    print(e.stack)
+}
+class NotFound extends Error {
+    constructor(what) {
+        super(what + " not found")
+        this.name = "NotFound"
+    }
+}
+try { throw new NotFound("user") } catch (e) { print(e, e instanceof NotFound, e instanceof TypeError) }
+try { throw 42 } catch (e) { print(e, e instanceof Error) }
+print(new Error(), new TypeError("bad"), "x" instanceof Error)
+`, "Error: oops oops Error true false\ntrue division by zero\ntrue true RangeError negative: -1\n  at check (5:18)\n  at <script> (8:7)\nNotFound: user not found true false\n42 false\nError TypeError: bad false\n")
+	expectError(t, "throw new TypeError(\"boom\")", "uncaught throw at 1:1: TypeError: boom")
+	expectError(t, "print(1 instanceof 2)", "right side of 'instanceof' must be a class, got 'int'")
+	expectError(t, "Error = 1", "cannot assign to constant 'Error'")
+}
+
+func TestIteratorProtocol(t *testing.T) {
+	expectOutput(t, `
+class Node {
+  constructor(value, next) {
+    this.value = value
+    this.next = next
+  }
+}
+class ListIter {
+  constructor(node) { this.node = node }
+  next() {
+    if (this.node == null) { return {done: true} }
+    var value = this.node.value
+    this.node = this.node.next
+    return {value: value, done: false}
+  }
+}
+class List {
+  constructor() { this.head = null }
+  push(v) { this.head = new Node(v, this.head) }
+  iter() { return new ListIter(this.head) }
+}
+var list = new List()
+list.push("a")
+list.push("b")
+for (var item of list) { print(item) }
+for (var i, item of list) { print(i, item) }
+class Naturals {
+  constructor() { this.n = 0 }
+  next() {
+    this.n += 1
+    return {value: this.n, done: false}
+  }
+}
+for (var n of new Naturals()) {
+  if (n > 2) { break }
+  print(n)
+}
+class Bag {
+  constructor() { this.items = [1, 2] }
+  iter() { return this.items }
+}
+for (var x of new Bag()) { print(x) }
+`, "b\na\n0 b\n1 a\n1\n2\n1\n2\n")
+	expectError(t, `
+class Plain {}
+for (var x of new Plain()) {}
+`, "object of class 'Plain' is not iterable: it has no iter() or next() method")
+	expectError(t, `
+class Bad { next() { return 1 } }
+for (var x of new Bad()) {}
+`, "Bad.next() must return a map with 'value' and 'done', got 'int'")
+}
+
+func TestGenerators(t *testing.T) {
+	expectOutput(t, `
+function count(n) {
+  for (var i = 0; i < n; i += 1) { yield i }
+  return "end"
+}
+for (var x of count(3)) { print(x) }
+var g = count(1)
+print(g, g.next(), g.next(), g.next())
+function naturals() {
+  var n = 0
+  while (true) {
+    n += 1
+    yield n
+  }
+}
+for (var i, n of naturals()) {
+  if (n > 2) { break }
+  print(i, n)
+}
+function doubler() {
+  var got = yield "ready"
+  while (true) { got = yield got * 2 }
+}
+var d = doubler()
+print(d.next().value, d.next(5).value, d.next(7).value)
+class Tree {
+  constructor(value, kids) {
+    this.value = value
+    this.kids = kids
+  }
+  iter() {
+    yield this.value
+    for (var kid of this.kids) {
+      for (var v of kid) { yield v }
+    }
+  }
+}
+for (var v of new Tree(1, [new Tree(2, []), new Tree(3, [])])) { print("tree", v) }
+function guarded() {
+  try {
+    yield 1
+    yield 2
+  } catch (e) { print("caught", e) }
+  print("never")
+}
+for (var v of guarded()) {
+  print(v)
+  break
+}
+`, "0\n1\n2\n<generator count> {\"value\": 0, \"done\": false} {\"value\": \"end\", \"done\": true} {\"value\": null, \"done\": true}\n0 1\n1 2\nready 10 14\ntree 1\ntree 2\ntree 3\n1\n")
+	expectOutput(t, `
+function fails() {
+  yield 1
+  throw new TypeError("bad")
+}
+var f = fails()
+print(f.next().value)
+try { f.next() } catch (e) { print(e) }
+print(f.next().done)
+`, "1\nTypeError: bad\ntrue\n")
+	expectError(t, `
+function selfish() { yield me.next() }
+var me = selfish()
+me.next()
+`, "generator 'selfish' is already running")
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	run := func(source string) (*Interpreter, string, error) {
+		tokens, _ := lexer.New(source, "test.lt").Tokenize()
+		file, _ := parser.New(tokens).ParseFile()
+		var buf bytes.Buffer
+		interp := NewInterpreter(&buf)
+		err := interp.Run(file)
+		if err == nil {
+			err = interp.RunEventLoop()
+		}
+		return interp, buf.String(), err
+	}
+
+	interp, out, err := run(`
+setTimeout(() => print("timer"), 0)
+for (var k = 0; k < 10; k += 1) {
+  if (k == 2) { return 3 }
+  print(k)
+}
+print("unreachable")
+`)
+	if err != nil || out != "0\n1\n" || interp.ExitCode() != 3 {
+		t.Errorf("expected exit code 3 after printing 0 and 1, got code=%d out=%q err=%v", interp.ExitCode(), out, err)
+	}
+
+	interp, _, err = run("print(1)\nreturn")
+	if err != nil || interp.ExitCode() != 0 {
+		t.Errorf("expected exit code 0, got %d, err=%v", interp.ExitCode(), err)
+	}
+	expectError(t, `return "oops"`, "top-level return value must be an integer exit code, got 'string'")
+}
+
+func TestThrowStackTrace(t *testing.T) {
+	_, err := runSource(`
+class Svc {
+  run(x) { return check(x) }
+}
+function check(x) {
+  if (x > 2) { throw "too big" }
+  return x
+}
+new Svc().run(5)
+`)
+	thrown, ok := err.(*ThrownError)
+	if !ok {
+		t.Fatalf("expected ThrownError, got %v", err)
+	}
+	want := "  at check (6:16)\n  at Svc.run (3:19)\n  at <script> (9:1)\n"
+	if got := thrown.StackTrace(); got != want {
+		t.Errorf("stack trace mismatch:\nexpected: %q\ngot:      %q", want, got)
+	}
+}
+
+func TestMapLiteralKeys(t *testing.T) {
+	expectOutput(t, `
+var x = 1
+var y = "two"
+var prefix = "k"
+var m = {
+  x,
+  y,
+  "quoted key": 3,
+  [prefix + "1"]: 4,
+  [prefix + "1"]: 5
+}
+print(m)
+print({ [y]: x }[y], m.k1)
+`, "{\"x\": 1, \"y\": \"two\", \"quoted key\": 3, \"k1\": 5}\n1 5\n")
+	expectError(t, "var m = { [1]: 2 }", "map key must be a string, got 'int'")
+}
+
+func TestSet(t *testing.T) {
+	expectOutput(t, `
+var s = set([3, 1, 3, 2, 1.0])
+print(s, s.size(), len(s), typeOf(s))
+print(s.has(2), s.has(5), s.delete(3), s.delete(3), s)
+s.add(7).add(7)
+for (var x of s) { print(x) }
+var t = set([2, 9])
+print(s.union(t), s.intersection(t), s.difference(t))
+print(set("abca"), set({a: 1}).toArray(), set())
+record P(x, y)
+print(set([new P(1, 2), new P(1, 2), [1], [1]]).size())
+`, "set([3, 1, 2]) 3 3 set\ntrue false true false set([1, 2])\n1\n2\n7\nset([1, 2, 7, 9]) set([2]) set([1, 7])\nset([\"a\", \"b\", \"c\"]) [\"a\"] set([])\n3\n")
+	expectError(t, "set([1]).union([2])", "union() argument must be a set, got 'array'")
+	expectError(t, "set(5)", "set() argument must be an array, map, string or set, got 'int'")
+	expectError(t, "set().push(1)", "set has no method 'push'")
+}
+
+func TestMapMethods(t *testing.T) {
+	expectOutput(t, `
+var m = {a: 1, b: 2, c: 3}
+print(m.has("a"), m.has("z"), m.get("a"), m.get("z"), m.get("z", 0))
+print(m.delete("b"), m.delete("b"), m, keys(m))
+print(m.entries())
+var n = m.merge({c: 30, d: 4}, {e: 5})
+print(n, m)
+for (var [k, v] of n.entries()) { print(k, v) }
+`, "true false 1 null 0\ntrue false {\"a\": 1, \"c\": 3} [\"a\", \"c\"]\n[[\"a\", 1], [\"c\", 3]]\n{\"a\": 1, \"c\": 30, \"d\": 4, \"e\": 5} {\"a\": 1, \"c\": 3}\na 1\nc 30\nd 4\ne 5\n")
+	expectError(t, "({}).has(1)", "map key must be a string, got 'int'")
+	expectError(t, "({}).merge([1])", "merge() arguments must be maps, got 'array'")
+	expectError(t, "({}).merge()", "merge() expects at least 1 argument, got 0")
+}
+
+func TestArrayHelpers(t *testing.T) {
+	expectOutput(t, `
+var a = [1, 2, 3, 4, 5]
+print(a.splice(1, 2), a)
+print(a.splice(-1, 1, "x", "y"), a)
+print(a.splice(1), a, a.splice(0, 0, "z"), a)
+var b = [1, 2, 3]
+print(b.shift(), toString(b), b.unshift(0, 0.5), toString(b))
+print(b.insert(1, "i"), toString(b), b.insert(-1, "j"), b.insert(99, "k"), b)
+print([1, 2, 3, 4].fill(0, 1, -1), [1, 2].fill(9), [1, 2].fill(0, 5))
+print([1, 2].flatMap((x) => [x, x * 10]), [1, 2].flatMap((x) => x))
+print([1, 2, 3].findIndex((x) => x > 1), [1, 2, 3].findIndex((x) => x > 5), [1, 2, 1].lastIndexOf(1), [1].lastIndexOf(7))
+print([1, 2, 3].every((x) => x > 0), [1, 2, 3].some((x) => x > 2), [1, 2, 3, 4].count((x) => x % 2 == 0))
+print([].every((x) => false), [].some((x) => true), [].count((x) => true))
+`, "[2, 3] [1, 4, 5]\n[5] [1, 4, \"x\", \"y\"]\n[4, \"x\", \"y\"] [\"z\", 1] [] [\"z\", 1]\n"+
+		"1 [2, 3] 4 [0, 0.5, 2, 3]\n5 [0, \"i\", 0.5, 2, 3] 6 7 [0, \"i\", 0.5, 2, \"j\", 3, \"k\"]\n"+
+		"[1, 0, 0, 4] [9, 9] [1, 2]\n[1, 10, 2, 20] [1, 2]\n1 -1 2 -1\ntrue true 2\ntrue false 0\n")
+	expectError(t, "[].shift()", "shift() on empty array")
+	expectError(t, "[1].splice()", "splice() expects at least 1 argument, got 0")
+	expectError(t, "[1].splice(\"a\")", "splice() start must be an integer")
+	expectError(t, "[1].insert(0)", "insert() expects 2 arguments, got 1")
+	expectError(t, "[1].fill(0, 0, \"x\")", "fill() end must be an integer")
+	expectError(t, "[1].every()", "every() expects 1 argument, got 0")
+}
+
+func TestFlatDepth(t *testing.T) {
+	expectOutput(t, `
+var a = [1, [2, [3, [4]]], 5]
+print(a.flat(), a.flat(0), a.flat(2), a.flat(-1), a.flatDeep(), a)
+var c = [1]
+c.push(c)
+print(c.flat())
+`, "[1, 2, [3, [4]], 5] [1, [2, [3, [4]]], 5] [1, 2, 3, [4], 5] [1, 2, 3, 4, 5] [1, 2, 3, 4, 5] [1, [2, [3, [4]]], 5]\n[1, 1, [1, [...]]]\n")
+	expectError(t, "var c = [1]\nc.push(c)\nc.flatDeep()", "flatDeep() cannot flatten an array that contains itself")
+	expectError(t, "[1].flat(\"x\")", "flat() depth must be an integer")
+	expectError(t, "[1].flatDeep(1)", "flatDeep() expects 0 arguments, got 1")
+}
+
+func TestCloneAndDeepEquals(t *testing.T) {
+	expectOutput(t, `
+class P {
+  constructor(x) { this.x = x; this.tags = [x] }
+  show() { return "P" + this.x }
+}
+var a = {list: [1, [2, 3]], s: set([1, 2]), p: new P(1), f: (x) => x + 1}
+var b = clone(a)
+b.list[1].push(4)
+b.p.tags.push(9)
+print(a.list, b.list, a.p.tags, b.p.tags, b.p.show(), b.f == a.f, b.p instanceof P)
+print(deepEquals(a, b), deepEquals(a, clone(a)), deepEquals([1, 2.0], [1, 2]), deepEquals({x: 1, y: 2}, {y: 2, x: 1}))
+print(deepEquals(set([1, 2]), set([2, 1])), deepEquals([1], [1, 2]), deepEquals(new P(1), new P(1)), deepEquals(1, "1"))
+var c = [1]
+c.push(c)
+var d = clone(c)
+print(d[1] == d, d[1] == c, deepEquals(c, d))
+`, "[1, [2, 3]] [1, [2, 3, 4]] [1] [1, 9] P1 true true\nfalse true true true\ntrue false true false\ntrue false true\n")
+	expectError(t, "clone()", "clone() expects 1 argument, got 0")
+	expectError(t, "deepEquals(1)", "deepEquals() expects 2 arguments, got 1")
+}
+
+func TestMath(t *testing.T) {
+	expectOutput(t, `
+print(Math.sqrt(16), Math.pow(2, 10), Math.pow(2, 0.5), Math.abs(-3), Math.abs(-2.5))
+print(Math.floor(2.7), Math.ceil(2.1), Math.round(2.5), Math.round(-2.5), Math.trunc(-1.5), Math.floor(7), Math.floor(1e300))
+print(Math.min(3, 1, 2), Math.max([1, 5.5, 2]), Math.max(2, 2.0), Math.sign(-4), Math.sign(0.0))
+print(Math.log(Math.E), Math.exp(0), Math.sin(0), Math.atan2(1, 1) * 4 == Math.PI, Math.hypot(3, 4))
+print(typeOf(Math.random()), Math.randomInt(3, 3))
+`, "4 1024 1.4142135623730951 3 2.5\n2 3 3 -3 -1 7 1e+300\n1 5.5 2 -1 0\n1 1 0 true 5\nfloat 3\n")
+	expectError(t, "Math.PI = 3", "cannot assign to constant 'Math.PI'")
+	expectError(t, "Math.sqrt(\"4\")", "Math.sqrt() expects numbers, got 'string'")
+	expectError(t, "Math.pow(2)", "Math.pow() expects 2 arguments, got 1")
+	expectError(t, "Math.max()", "Math.max() expects at least 1 number")
+	expectError(t, "Math.cube(2)", "class 'Math' has no static method 'cube'")
+
+	interp := NewInterpreter(&bytes.Buffer{})
+	math, _ := interp.global.Get("Math")
+	interp.SetSeed(7)
+	first, _ := interp.CallMember(math, "random", nil)
+	interp.SetSeed(7)
+	second, _ := interp.CallMember(math, "random", nil)
+	if first != second {
+		t.Errorf("expected Math.random() to follow SetSeed, got %v and %v", first, second)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	expectOutput(t, `
+var v = jsonParse("{\"a\": [1, 2.5, \"x\\\"y\", true, null], \"b\": {\"c\": {}}, \"d\": []}")
+print(v, typeOf(v.a[0]), typeOf(v.a[1]))
+print(jsonStringify(v))
+print(jsonStringify({list: [1, {}], m: {k: "v"}}, 2))
+class P {
+  constructor(x) { this.y = [x]; this.x = x }
+}
+class Q {
+  toString() { return "Q!" }
+}
+record R(b, a)
+enum Color { Red }
+print(jsonStringify([new P(1), new Q(), new R(1, 2.0), Color.Red, set([1, 1]), "<&>\n"]))
+print(typeOf(jsonParse(jsonStringify(2.0))), jsonStringify([[1]], "\t"))
+`, `{"a": [1, 2.5, "x"y", true, null], "b": {"c": {}}, "d": []} int float
+{"a":[1,2.5,"x\"y",true,null],"b":{"c":{}},"d":[]}
+{
+  "list": [
+    1,
+    {}
+  ],
+  "m": {
+    "k": "v"
+  }
+}
+[{"x":1,"y":[1]},"Q!",{"b":1,"a":2.0},"Color.Red",[1],"<&>\n"]
+float [
+	[
+		1
+	]
+]
+`)
+	expectError(t, "var c = [1]\nc.push(c)\njsonStringify(c)", "jsonStringify() cannot encode a value that contains itself")
+	expectError(t, "jsonStringify(print)", "jsonStringify() cannot encode a value of type 'builtin'")
+	expectError(t, "jsonStringify(Math.sqrt(-1))", "jsonStringify() cannot encode NaN")
+	expectError(t, `jsonParse("[1,")`, "jsonParse(): invalid JSON")
+	expectError(t, `jsonParse("[1] 2")`, "jsonParse(): invalid JSON: unexpected data after the top-level value")
+}
+
+func TestFS(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	expectOutput(t, strings.ReplaceAll(`
+var d = "DIR/sub/inner"
+print(fs.exists(d), fs.mkdir(d), fs.exists(d))
+print(fs.writeFile("DIR/sub/a.txt", "héllo"), fs.appendFile("DIR/sub/a.txt", "!"), fs.readFile("DIR/sub/a.txt"))
+print(fs.listDir("DIR/sub"), fs.remove("DIR/sub/a.txt"), fs.listDir("DIR/sub"))
+try { fs.readFile("DIR/missing.txt") } catch (e) { print(e.message.startsWith("fs.readFile(): open")) }
+`, "DIR", dir), "false null true\n6 1 héllo!\n[\"a.txt\", \"inner\"] null [\"inner\"]\ntrue\n")
+	expectError(t, `fs.writeFile("x")`, "fs.writeFile() expects 2 arguments, got 1")
+	expectError(t, `fs.readFile(1)`, "fs.readFile() expects string arguments, got 'int'")
+
+	path := filepath.Join(dir, "blocked.txt")
+	for _, src := range []string{`fs.writeFile(PATH, "x")`, `writeBytes(PATH, [1])`} {
+		tokens, _ := lexer.New(strings.ReplaceAll(src, "PATH", strconv.Quote(filepath.ToSlash(path))), "test.lt").Tokenize()
+		file, _ := parser.New(tokens).ParseFile()
+		interp := NewInterpreter(&bytes.Buffer{})
+		interp.DisableFS()
+		if err := interp.Run(file); err == nil || !strings.Contains(err.Error(), "file system access is disabled") {
+			t.Errorf("%s: expected a disabled error, got %v", src, err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+}
+
+func TestProcessBuiltins(t *testing.T) {
+	t.Setenv("LIGHT_TEST_VAR", "set")
+	wd, _ := os.Getwd()
+	expectOutput(t, `
+print(env("LIGHT_TEST_VAR"), env("LIGHT_NO_SUCH_VAR"), args())
+setEnv("LIGHT_TEST_VAR", "changed")
+print(env("LIGHT_TEST_VAR"))
+setEnv("LIGHT_TEST_VAR", null)
+print(env("LIGHT_TEST_VAR"), cwd() == `+strconv.Quote(wd)+`)
+`, "set null []\nchanged\nnull true\n")
+	expectError(t, `env(1)`, "env() argument must be a string, got 'int'")
+	expectError(t, `setEnv("X", 1)`, "setEnv() value must be a string or null, got 'int'")
+	expectError(t, `exit("1")`, "exit() code must be an integer, got 'string'")
+
+	tokens, _ := lexer.New(`
+setTimeout(() => print("dropped"), 0)
+print(args())
+try { exit(2) } catch (e) { print("caught") }
+print("unreachable")
+`, "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	interp.SetArgs([]string{"a", "--vm"})
+	err := interp.Run(file)
+	if err == nil {
+		err = interp.RunEventLoop()
+	}
+	if err != nil || buf.String() != "[\"a\", \"--vm\"]\n" || interp.ExitCode() != 2 {
+		t.Errorf("expected exit code 2 after printing the args, got code=%d out=%q err=%v", interp.ExitCode(), buf.String(), err)
+	}
+}
+
+func TestTime(t *testing.T) {
+	expectOutput(t, `
+var L = "2006-01-02 15:04:05"
+var ts = time.parse(L, "2024-03-01 12:30:45")
+var d = time.date(ts)
+print(time.format(ts, L), time.format(d, "Jan 2"), d.year, d.month, d.day, d.hour, d.weekday, d.unixMillis == ts)
+print(time.parse(time.ISO, "2024-03-01T12:00:00.250Z"), time.format(time.parse(time.ISO, "2024-03-01T12:00:00.250+02:00"), "2006") == "2024")
+var t0 = time.monotonic()
+time.sleep(5)
+print(time.monotonic() - t0 >= 5, time.now().year >= 2024, time.now().unixMillis <= time.unixMillis())
+try { time.parse(L, "nope") } catch (e) { print(e.message.startsWith("time.parse(): parsing time")) }
+`, "2024-03-01 12:30:45 Mar 1 2024 3 1 12 5 true\n1709294400250 true\ntrue true true\ntrue\n")
+	expectError(t, `time.format("x", "2006")`, "time.format() expects a timestamp in milliseconds or a date map")
+	expectError(t, `time.sleep("1")`, "time.sleep() expects a number, got 'string'")
+}
+
+func TestFormat(t *testing.T) {
+	expectOutput(t, `
+print(format("x=%d y=%.2f name=%s", 3, 2.5, "bob"))
+print(format("|%-6s|%6s|%05d|%x|%+.1e|%v|%q|100%%", "héllo", "ab", 42, 255, 1234.5, [1, "a"], "q"))
+print("%s has %d items".format("cart", 3), format("%.1f", 2))
+`, "x=3 y=2.50 name=bob\n|héllo |    ab|00042|ff|+1.2e+03|[1, \"a\"]|\"q\"|100%\ncart has 3 items 2.0\n")
+	expectError(t, `format("%d", "x")`, "format(): verb '%d' expects an integer, got 'string' (argument 1)")
+	expectError(t, `"%d".format(1.5)`, "format(): verb '%d' expects an integer, got 'float' (argument 1)")
+	expectError(t, `format("%d %d", 1)`, "format(): verb '%d' has no argument; 1 given")
+	expectError(t, `format("%d", 1, 2, 3)`, "format(): 2 arguments left over; the pattern has 1 verb")
+	expectError(t, `format("%z", 1)`, "format(): unknown verb '%z'")
+	expectError(t, `format("50%")`, "format(): incomplete verb '%' at the end of the pattern")
+}
+
+func TestNumberConversion(t *testing.T) {
+	expectOutput(t, `
+print(toInt("  42 "), toInt(3.9), toInt(-3.9), typeOf(toFloat(2)), toFloat("1e3"), toFloat(" 2.5"))
+print(parseInt("ff", 16), parseInt("0x1F", 0), parseInt("-101", 2), parseFloat("-inf"), parseFloat("1e400"))
+print(toInt("x", null), toInt("1.5", -1), parseInt("12a", 10, 0), parseFloat("", null), toFloat([1], 0))
+print(isNaN(Math.sqrt(-1)), isNaN(1), isFinite(1), isFinite(parseFloat("inf")))
+`, "42 3 -3 float 1000 2.5\n255 31 -5 -Inf +Inf\nnull -1 0 null 0\ntrue false true false\n")
+	expectError(t, `toInt("abc")`, `toInt(): cannot convert "abc" to an int`)
+	expectError(t, `toFloat([1])`, "toFloat(): cannot convert array '[1]' to a float")
+	expectError(t, `parseInt("1", 1)`, "parseInt() base must be 0 or an integer from 2 to 36, got 1")
+	expectError(t, `parseInt(1, 10, null)`, "parseInt() text must be a string, got 'int'")
+	expectError(t, `isNaN("x")`, "isNaN() expects a number, got 'string'")
+}
+
+func TestCharUtilities(t *testing.T) {
+	expectOutput(t, `
+print(ord("A"), ord("é"), chr(97), chr(0x1F600))
+print("héllo".bytes(), "héllo".chars(), "héllo".reverse(), "abcabc".lastIndexOf("bc"), "éab".lastIndexOf("z"))
+print("7".padStart(3, "0"), "ab".padEnd(7, "xy") + "|", "abc".padStart(2), "é".padStart(3) + "|")
+function caesar(s, k) {
+  return s.chars().map((c) => chr((ord(c) - 97 + k) % 26 + 97)).join("")
+}
+print(caesar("xyz", 3))
+`, "65 233 a 😀\n[104, 195, 169, 108, 108, 111] [\"h\", \"é\", \"l\", \"l\", \"o\"] olléh 4 -1\n007 abxyxyx| abc   é|\nabc\n")
+	expectError(t, `ord("ab")`, `ord() expects a one-character string, got "ab"`)
+	expectError(t, `chr(-1)`, "chr(): -1 is not a valid code point")
+	expectError(t, `"a".padStart("3")`, "padStart() length must be an integer")
+}
+
+func TestSortHelpers(t *testing.T) {
+	expectOutput(t, `
+var people = [{n: "bo", age: 30}, {n: "al", age: 25}, {n: "cy", age: 30}, {n: "di", age: 25}]
+print(people.sortBy((p) => p.age).map((p) => p.n))
+print(people.sortDesc((p) => p.age).map((p) => p.n))
+print(people.sortBy((p) => [-p.age, p.n]).map((p) => p.n))
+var a = [3, 1, 2]
+var b = a.sorted()
+print(a, b, a.sorted((x, y) => y - x), [2, 10, 1].sortDesc())
+`, "[\"al\", \"di\", \"bo\", \"cy\"]\n[\"bo\", \"cy\", \"al\", \"di\"]\n[\"bo\", \"cy\", \"al\", \"di\"]\n[3, 1, 2] [1, 2, 3] [3, 2, 1] [10, 2, 1]\n")
+	expectError(t, "[1].sortBy()", "sortBy() expects 1 argument, got 0")
+	expectError(t, "[1, 2].sorted((a, b) => \"x\")", "sort comparator must return a number")
+}
+
+func TestRange(t *testing.T) {
+	expectOutput(t, `
+var total = 0
+for (var k of range(1000000)) { total += k }
+print(total, range(5), range(1, 10, 3), len(range(10, 0, -3)), range(10, 0, -3).toArray(), len(range(5, 1)))
+for (var idx, v of range(3, 6)) { print(idx, v) }
+print(range(5).map((x) => x * x), range(0, 10, 2).includes(4), range(0, 10, 2).includes(5), set(range(3)))
+for (var k of range(100)) { if (k == 2) { break } print("k", k) }
+`, "499999500000 range(0, 5) range(1, 10, 3) 4 [10, 7, 4, 1] 0\n0 3\n1 4\n2 5\n[0, 1, 4, 9, 16] true false set([0, 1, 2])\nk 0\nk 1\n")
+	expectError(t, "range(1, 5, 0)", "range() step must not be zero")
+	expectError(t, "range(1.5)", "range() arguments must be integers, got 'float'")
+
+	for _, tc := range []struct {
+		r    RangeVal
+		want int64
+	}{
+		{RangeVal{Start: math.MinInt64, End: math.MaxInt64, Step: 1}, math.MaxInt64},
+		{RangeVal{Start: math.MinInt64, End: math.MaxInt64, Step: math.MaxInt64}, 3},
+		{RangeVal{Start: math.MaxInt64, End: math.MinInt64, Step: math.MinInt64}, 2},
+	} {
+		if got := tc.r.Len(); got != tc.want {
+			t.Errorf("%s: expected length %d, got %d", tc.r.String(), tc.want, got)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	expectOutput(t, `
+assert(1 + 1 == 2)
+assertEquals([1, {a: "x"}], [1, {a: "x"}])
+try { assertEquals([1, 2], [1, 3], "lists") } catch (e) { print(e instanceof AssertionError, e instanceof Error, e.name, e.message) }
+try { assert(false) } catch (e) { print(e.message) }
+try { fail("nope") } catch (e) { print(e) }
+function check(x) { assert(x > 0, "x must be positive") }
+try { check(-1) } catch (e) { print(e.stack) }
+`, "true true AssertionError lists: expected [1, 3], got [1, 2]\nassertion failed\nAssertionError: nope\n  at check (7:21)\n  at <script> (8:7)\n")
+	expectError(t, "\nassertEquals(\"a\", \"b\")", `uncaught throw at 2:1: AssertionError: expected "b", got "a"`)
+	expectError(t, "assert()", "assert() expects 1-2 arguments, got 0")
+}
+
+func TestHTTPServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	tokens, _ := lexer.New(`
+var count = 0
+http.serve(`+strconv.Quote(addr)+`, (req) => {
+  count += 1
+  if (req.path == "/stop") { exit(3) }
+  if (req.path == "/json") { return {status: 201, headers: {"X-Count": count}, body: {n: count, q: req.query.name}} }
+  if (req.path == "/fail") { throw new Error("boom") }
+  return req.method + " " + req.path + " " + req.body + " " + req.headers["x-a"]
+})
+print("unreachable")
+`, "test.lt").Tokenize()
+	file, _ := parser.New(tokens).ParseFile()
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+	done := make(chan error, 1)
+	go func() { done <- interp.Run(file) }()
+
+	get := func(method, path, body string) (int, string, http.Header) {
+		t.Helper()
+		for attempt := 0; ; attempt++ {
+			req, _ := http.NewRequest(method, "http://"+addr+path, strings.NewReader(body))
+			req.Header.Set("X-A", "1")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				if attempt < 50 {
+					time.Sleep(20 * time.Millisecond)
+					continue
+				}
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return resp.StatusCode, string(data), resp.Header
+		}
+	}
+	if code, body, _ := get("POST", "/echo", "hi"); code != 200 || body != "POST /echo hi 1" {
+		t.Errorf("expected 200 \"POST /echo hi 1\", got %d %q", code, body)
+	}
+	if code, body, header := get("GET", "/json?name=bo", ""); code != 201 || body != `{"n":2,"q":"bo"}` || header.Get("X-Count") != "2" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected JSON response %d %q %v", code, body, header)
+	}
+	if code, body, _ := get("GET", "/fail", ""); code != 500 || !strings.Contains(body, "Error: boom") {
+		t.Errorf("expected a 500 naming the error, got %d %q", code, body)
+	}
+	get("GET", "/stop", "")
+	select {
+	case err := <-done:
+		if err != nil || interp.ExitCode() != 3 || buf.String() != "" {
+			t.Errorf("expected exit code 3 and no output, got code=%d out=%q err=%v", interp.ExitCode(), buf.String(), err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("http.serve() did not return after exit()")
+	}
+
+	expectError(t, `http.serve(0, 1)`, "http.serve() handler must be a function, got 'int'")
+	expectError(t, `http.serve(true, () => "")`, `http.serve() port must be an integer or a "host:port" string, got 'bool'`)
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	expectOutput(t, `
+function produce(ch, n) {
+  for (var k of range(n)) { ch.send(k * k) }
+  ch.close()
+  return "produced " + n
+}
+var ch = channel(2)
+var t = spawn produce(ch, 5)
+var got = []
+while (true) {
+  var v = ch.recv()
+  if (v == null) { break }
+  got.push(v)
+}
+print(got, t.join(), t.done(), t)
+
+var counter = {n: 0}
+function bump(c) { c.n += 1; return c.n }
+var tasks = [spawn bump(counter), spawn bump(counter)]
+print(tasks.map((t) => t.join()), counter.n)
+
+var a = channel()
+var b = channel(1)
+b.send("from b")
+print(select([a, b]), select([a], 10))
+b.close()
+print(select([a, b]))
+function boom() { throw new Error("task failed") }
+try { (spawn boom()).join() } catch (e) { print(e.message) }
+try { b.send(1) } catch (e) { print(e.message) }
+class Acc { constructor() { this.total = 1 } add(x) { this.total += x; return this.total } }
+var acc = new Acc()
+print((spawn acc.add(41)).join(), acc.total)
+`, "[0, 1, 4, 9, 16] produced 5 true <task produce>\n[1, 1] 0\n[1, \"from b\"] null\n[1, null]\ntask failed\nsend() on closed channel\n42 1\n")
+	expectError(t, "select([1])", "select() expects channels, got 'int'")
+	expectError(t, "channel(-1)", "channel() capacity must be a non-negative integer")
+}
+
+func TestAsyncAwait(t *testing.T) {
+	expectOutput(t, `
+async function fetchNum(n, ms) {
+  await delay(ms)
+  print("got " + n)
+  return n * 10
+}
+async function failing() {
+  await delay(1)
+  throw "boom"
+}
+async function main() {
+  var both = await Promise.all([fetchNum(1, 30), fetchNum(2, 5)])
+  try { await failing() } catch (e) { print("caught: " + e.message) }
+  return both
+}
+print(await main())
+var square = async (x) => x * x
+print(await square(7), await 5)
+setTimeout(() => print("timer"), 5)
+await delay(30)
+var p = fetchNum(3, 1).then((v) => v + 1)
+print(await p, p.done(), p)
+print(await Promise.race([delay(200, "slow"), delay(5, "fast")]))
+class Store {
+  async get(key) { await delay(1); return key + "!" }
+  static async open() { return new Store() }
+}
+var store = await Store.open()
+print(await store.get("k"), typeOf(store.get("j")))
+`, "got 2\ngot 1\ncaught: boom\n[10, 20]\n49 5\ntimer\ngot 3\n31 true <promise fulfilled: 31>\nfast\nk! promise\n")
+
+	expectError(t, "async function bad() { throw \"lost\" }\nbad()", "lost")
+	expectError(t, "var p\nasync function f() { await delay(1); await p }\np = f()\nawait p", "await on a promise that can never settle")
+	expectError(t, "delay(\"1\")", "delay() expects an integer number of milliseconds, got 'string'")
+	expectError(t, "Promise.all(1)", "Promise.all() expects an array of promises, got 'int'")
+
+	out, err := runSource("async function quit() { await delay(1); exit(3) }\nquit()\nawait delay(200)\nprint(\"not reached\")")
+	if err != nil || out != "" {
+		t.Errorf("exit() in an async function: got %q, %v", out, err)
+	}
+}
+
+func TestAsyncIO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Echo", r.Method)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	expectOutput(t, `
+var path = `+strconv.Quote(path)+`
+var url = `+strconv.Quote(srv.URL)+`
+await fs.writeFileAsync(path, "hello")
+await fs.appendFileAsync(path, " world")
+print(await fs.readFileAsync(path))
+try { await fs.readFileAsync(path + ".missing") } catch (e) { print(e.message.startsWith("fs.readFileAsync():")) }
+var res = await http.fetch(url, {method: "post", body: {n: 1}})
+print(res.status, res.headers["x-echo"], res.body)
+`, "hello world\ntrue\n201 POST {\"n\":1}\n")
+	expectError(t, "fs.readFileAsync(1)", "fs.readFileAsync() expects string arguments, got 'int'")
+	expectError(t, "http.fetch(\"http://x\", 1)", "http.fetch() options must be a map, got 'int'")
+}
+
+func TestRunContext(t *testing.T) {
+	parse := func(src string) *ast.File {
+		tokens, _ := lexer.New(src, "test.lt").Tokenize()
+		file, _ := parser.New(tokens).ParseFile()
+		return file
+	}
+	var buf bytes.Buffer
+	interp := NewInterpreter(&buf)
+
+	cases := []struct{ name, source string }{
+		{"loop", "while (true) {}"},
+		{"catch", "while (true) { try { while (true) {} } catch (e) { print(\"caught\") } }"},
+		{"calls", "function spin() { return spin2() }\nfunction spin2() { return spin() }\nvar n = 0\nwhile (true) { try { spin() } catch (e) { n += 1 } }"},
+		{"sleep", "try { time.sleep(60000) } catch (e) { print(\"caught\") }"},
+		{"serve", "http.serve(\"127.0.0.1:0\", req => \"\")"},
+	}
+	for _, tc := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		err := interp.RunContext(ctx, parse(tc.source))
+		var cancelled *CancelledError
+		if !errors.As(err, &cancelled) || !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected a cancellation, got %v", tc.name, err)
+		} else if cancelled.Span.Start.Line == 0 {
+			t.Errorf("%s: expected the cancellation to have a position, got %v", tc.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: cancellation took %s", tc.name, elapsed)
+		}
+		cancel()
+	}
+	if buf.Len() != 0 {
+		t.Errorf("cancellation should not be caught, got %q", buf.String())
+	}
+
+	// The event loop stops too, and the interpreter can run again afterwards
+	if err := interp.Run(parse("setInterval(() => {}, 1)")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := interp.RunEventLoopContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the event loop to stop at the deadline, got %v", err)
+	}
+	if val, err := interp.EvalContext(context.Background(), parse("1 + 2")); err != nil || val.String() != "3" {
+		t.Errorf("expected 3, got %v, %v", val, err)
+	}
+}
+
+func TestCallDepthGuard(t *testing.T) {
+	expectOutput(t, `
+function down(n) { return n == 0 ? 0 : 1 + down(n - 1) }
+try { down(1000000) } catch (e) { print(e instanceof RangeError, e.message) }
+print(down(5000))
+class Walker { step(n) { return this.step(n + 1) } }
+try { new Walker().step(0) } catch (e) { print(e.stack.split("\n").length, e.stack.includes("more calls")) }
+`, "true maximum call depth exceeded (10000 nested calls)\n5000\n21 true\n")
+
+	_, err := runSource("function loop() { return loop() }\nloop()")
+	var thrown *ThrownError
+	if !errors.As(err, &thrown) {
+		t.Fatalf("expected a thrown RangeError, got %v", err)
+	}
+	if trace := thrown.StackTrace(); !strings.Contains(trace, "  ... 9981 more calls\n") || !strings.HasSuffix(trace, "  at <script> (2:1)\n") {
+		t.Errorf("unexpected stack trace:\n%s", trace)
+	}
+}
+
+func TestResolvedScopes(t *testing.T) {
+	// A closure sees a block variable only once its declaration has run
+	expectOutput(t, `
+var x = "global"
+{
+  var f = () => x
+  print(f())
+  var x = "block"
+  print(f())
+  x = "set"
+  print(f())
+}
+print(x)
+`, "global\nblock\nset\nglobal\n")
+
+	// Loops, catch, match and functions keep their own bindings
+	expectOutput(t, `
+function sum(n) {
+  var total = 0
+  for (var i = 0; i < n; i = i + 1) {
+    var sq = i * i
+    if (sq % 2 == 0) { total = total + sq }
+  }
+  return total
+}
+print(sum(10))
+var seen = []
+for (var k, v of {a: 1, b: 2}) { seen.push(k + v) }
+print(seen)
+try { throw "boom" } catch (e) { var msg = e.message; print(msg) }
+match (7) { case n if n > 3 => { var big = n * 2; print(big) } _ => { print("small") } }
+function shadow(a) { { var b = a + 1; { var a = 10; print(a, b) } } return a }
+print(shadow(1))
+`, "120\n[\"a1\", \"b2\"]\nboom\n14\n10 2\n1\n")
+
+	// Method bodies and locals() still see every binding
+	expectOutput(t, `
+class Acc {
+  constructor() { this.n = 0 }
+  add(k) { for (var j = 0; j < k; j = j + 1) { this.n = this.n + j } return this.n }
+}
+print(new Acc().add(4))
+function outer() { var hidden = 1; { print(locals()) } }
+outer()
+`, "6\n{\"hidden\": 1}\n")
+}
+
+func TestStringBuilder(t *testing.T) {
+	expectOutput(t, `
+var sb = StringBuilder("héllo")
+sb.append(", ", 42, " ", [1, 2]).append("!")
+print(sb.toString(), sb.length(), len(sb), typeOf(sb))
+print("got: " + sb, `+"`${sb}`"+`)
+class Point { constructor(x) { this.x = x } toString() { return "P" + this.x } }
+print(StringBuilder().append(new Point(3)).toString())
+print(sb.clear().length(), sb.toString() == "")
+`, "héllo, 42 [1, 2]! 17 17 StringBuilder\ngot: héllo, 42 [1, 2]! héllo, 42 [1, 2]!\nP3\n0 true\n")
+
+	expectError(t, `StringBuilder(1)`, "StringBuilder() argument must be a string, got 'int'")
+	expectError(t, `StringBuilder().toString(1)`, "toString() expects 0 arguments, got 1")
+	expectError(t, `StringBuilder().push("a")`, "StringBuilder has no method 'push'")
+}
+
+// BenchmarkStringBuilding compares building a string with s = s + part,
+// which copies s each time, to appending to a StringBuilder.
+func BenchmarkStringBuilding(b *testing.B) {
+	scripts := map[string]string{
+		"concat":  `var s = "" for (var i = 0; i < 5000; i = i + 1) { s = s + "part " }`,
+		"builder": `var sb = StringBuilder() for (var i = 0; i < 5000; i = i + 1) { sb.append("part ") } var s = sb.toString()`,
+	}
+	for _, name := range []string{"concat", "builder"} {
+		tokens, _ := lexer.New(scripts[name], "bench.lt").Tokenize()
+		file, _ := parser.New(tokens).ParseFile()
+		b.Run(name, func(b *testing.B) {
+			for range b.N {
+				if err := NewInterpreter(io.Discard).Run(file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestIntOverflow(t *testing.T) {
+	expectOutput(t, `
+var max = 9223372036854775807
+var min = -max - 1
+print(max - 1 + 1, min + 0, 3037000499 * 3037000499, 2 ** 62, min % -1, 9007199254740993 > 9007199254740992)
+for (var expr of [() => max + 1, () => min - 1, () => max * 2, () => min / -1, () => 2 ** 63, () => -min, () => Math.abs(min)]) {
+  try { expr() } catch (e) { print(e.message) }
+}
+print(toFloat(max) + 1, max + 1.0)
+`, `9223372036854775807 -9223372036854775808 9223372030926249001 4611686018427387904 0 true
+integer overflow: 9223372036854775807 + 1 does not fit in 64 bits (convert an operand with toFloat() to compute approximately)
+integer overflow: -9223372036854775808 - 1 does not fit in 64 bits (convert an operand with toFloat() to compute approximately)
+integer overflow: 9223372036854775807 * 2 does not fit in 64 bits (convert an operand with toFloat() to compute approximately)
+integer overflow: -9223372036854775808 / -1 does not fit in 64 bits (convert an operand with toFloat() to compute approximately)
+integer overflow: 2 ** 63 does not fit in 64 bits (convert an operand with toFloat() to compute approximately)
+integer overflow: -(-9223372036854775808) does not fit in 64 bits
+integer overflow: -(-9223372036854775808) does not fit in 64 bits
+9223372036854776000 9223372036854776000
+`)
+	expectError(t, "var n = 9223372036854775807\nn += 1", "at 2:1: integer overflow")
+}
+
+func TestNumberFormatting(t *testing.T) {
+	expectOutput(t, `
+var x = 10 / 3.0
+print(x, 1e6 * 1.0, 1.5e21, 0.0000001, 0.000001, -0.5, 2.0)
+print(x.toFixed(2), (2).toFixed(3), (2.5).toFixed(0), (1.005).toFixed(2), (9.99).toPrecision(2), x.toPrecision(3), (123456.0).toPrecision(2), (0.00000123).toPrecision(2))
+print((255).toString(16), (-255).toString(2), (8.0).toString(8), x.toString(), (7).toString())
+print(jsonStringify([1e6 * 1.0, 0.1]))
+`, "3.3333333333333335 1000000 1.5e+21 1e-07 0.000001 -0.5 2\n"+
+		"3.33 2.000 3 1.00 10 3.33 1.2e+05 0.0000012\n"+
+		"ff -11111111 10 3.3333333333333335 7\n"+
+		"[1000000.0,0.1]\n")
+
+	expectError(t, `(1.5).toFixed(-1)`, "toFixed() digits must be an integer from 0 to 100, got -1")
+	expectError(t, `(1.5).toPrecision(0)`, "toPrecision() digits must be an integer from 1 to 100, got 0")
+	expectError(t, `(1.5).toString(16)`, "toString() can only write whole numbers in base 16, got 1.5")
+	expectError(t, `(1).toString(37)`, "toString() base must be an integer from 2 to 36, got 37")
+	expectError(t, `(1).round()`, "int has no method 'round'")
+}
+
+func TestAssignExpr(t *testing.T) {
+	expectOutput(t, `
+var a = 1
+var b = 2
+a, b = b, a
+print(a, b)
+var m = {n: 0}
+var xs = [0, 0]
+a = m.n = xs[1] = 5
+print(a, m.n, xs)
+var queue = [3, 1, 2]
+var next
+while ((next = queue.pop()) != null && next > 1) { print(next) }
+var n = 3
+print((n *= 2) + 1, n, (m.n -= 1), m.n, (xs[0] += 4), xs)
+m.n, xs[0] = "p", "q"
+var pair = [7, 8]
+var l
+var r
+l, r = pair
+print(m.n, xs, l, r)
+`, "2 1\n5 5 [0, 5]\n2\n7 6 4 4 4 [4, 5]\np [\"q\", 5] 7 8\n")
+	expectOutput(t, `
+var lines = ["a", "b", null]
+var line
+var at = 0
+function next() { at += 1; return lines[at - 1] }
+while (line = next()) { print(line) }
+function twice(v) { return v * 2 }
+var k
+var q
+var w = q = 5
+if (k = 3) { print(twice(k = 4), k, w, q) }
+`, "a\nb\n8 4 5 5\n")
+	expectError(t, `
+const c = 1
+var x = (c = 2)
+`, "cannot assign to constant 'c'")
+	expectError(t, `
+var a = 1
+var b = 2
+a, b = [1, 2, 3]
+`, "cannot destructure 3 values into 2 variables")
+}
+
+func TestLet(t *testing.T) {
+	expectOutput(t, `
+let n = 1
+if (true) {
+    let n = 2
+    n += 1
+    print(n)
+}
+let total = 0
+for (let i = 0; i < 3; i += 1) { total += i }
+for (let x of [10, 20]) { total += x }
+print(n, total)
+`, "3\n1 33\n")
+	expectError(t, `
+let a = 1
+let a = 2
+`, "already declared")
+}
+
+func TestLoopClosures(t *testing.T) {
+	// each iteration of a for loop has its own copy of the loop variables
+	expectOutput(t, `
+var callbacks = []
+for (var i = 0; i < 3; i += 1) {
+    callbacks.push(function() { return i })
+}
+print(callbacks.map((f) => f()))
+var counters = []
+for (let k = 0; k < 2; k += 1) {
+    if (k == 0) { counters.push(() => { k += 10; return k }) ; continue }
+    counters.push(() => k)
+}
+print(counters[0](), counters[0](), counters[1]())
+var shared = []
+var n = 0
+for (n = 0; n < 2; n += 1) { shared.push(() => n) }
+print(shared[0](), shared[1]())
+`, "[0, 1, 2]\n10 20 1\n2 2\n")
+}
+
+func TestFreeze(t *testing.T) {
+	expectOutput(t, `
+const config = freeze({name: "app", ports: [80, 443], seen: set([1])})
+print(isFrozen(config), isFrozen(config.ports), isFrozen(config.seen), isFrozen([1]), isFrozen(1))
+print(config.ports.sorted(), config.ports.map((p) => p + 1), config.seen.has(1))
+var copy = clone(config)
+copy.ports.push(8080)
+print(copy.ports, isFrozen(copy))
+var cyc = [1]
+cyc.push(cyc)
+freeze(cyc)
+print(isFrozen(cyc[1]))
+`, "true true true false false\n[80, 443] [81, 444] true\n[80, 443, 8080] false\ntrue\n")
+	expectError(t, `
+const m = freeze({a: 1})
+m.a = 2
+`, "cannot modify a frozen map")
+	expectError(t, `freeze([1])[0] = 2`, "cannot modify a frozen array")
+	expectError(t, `freeze([1]).push(2)`, "cannot modify a frozen array with push()")
+	expectError(t, `push(freeze([1]), 2)`, "cannot modify a frozen array")
+	expectError(t, `freeze(set()).add(1)`, "cannot modify a frozen set with add()")
+	expectError(t, `
+class Counter {
+    n = 0
+    inc() { this.n += 1 }
+}
+freeze(new Counter()).inc()
+`, "cannot modify a frozen object")
+	expectOutput(t, `
+var xs = freeze([1])
+try { xs.pop() } catch (e) { print(e.message) }
+print(xs)
+`, "cannot modify a frozen array with pop()\n[1]\n")
+}
+
+func TestBoundMethods(t *testing.T) {
+	expectOutput(t, `
+class Counter {
+    constructor(step) { this.step = step; this.total = 0 }
+    add(x) { this.total += x; return x + this.step }
+}
+var c = new Counter(10)
+print([1, 2, 3].map(c.add), c.total)
+var add = c.add
+print(add(5), c.total, add)
+[4, 5].forEach(c.add)
+print(c.total, c.missing)
+`, "[11, 12, 13] 6\n15 11 <bound method Counter.add>\n20 null\n")
+	expectOutput(t, `
+function greet(greeting, name) { return greeting + ", " + name + " from " + this.who }
+var hi = greet.bind({who: "light"}, "hi")
+print(hi("ann"), hi, hi.bind({who: "other"})("bob"))
+var tagged = print.bind(null, "log:")
+tagged(1, 2)
+print(curry(hi)("cy"))
+`, "hi, ann from light <bound function greet> hi, bob from light\nlog: 1 2\nhi, cy from light\n")
+	expectError(t, `
+class A { m(x) { return x } }
+var m = new A().m
+m()
+`, "A.m() expects 1 arguments, got 0")
+	expectError(t, `print.bind()`, "bind() expects at least 1 argument, got 0")
+	expectError(t, `print.toString()`, "function has no method 'toString'")
+}
+
+func TestFunctionMethods(t *testing.T) {
+	expectOutput(t, `
+function add(a, b) { return a + b }
+function sum(first, ...rest) { return first + rest.length }
+var sq = (x) => x * x
+print(add.call(1, 2), add.apply([3, 4]), add.name, add.arity, sum.arity, sq.arity)
+print(print.arity, push.arity, range.arity, assert.arity, print.name)
+var inc = add.bind(null, 1)
+print(inc.name, inc.arity, inc.call(2), sum.bind(null, 1, 2).arity)
+function cached(fn) {
+    var cache = {}
+    return function(...args) {
+        var key = jsonStringify(args)
+        if (!cache.has(key)) { cache[key] = fn.apply(args) }
+        return cache[key]
+    }
+}
+var calls = 0
+var slow = cached(function(n) { calls += 1; return n * 2 })
+print(slow(2), slow(2), calls)
+`, "3 7 add 2 1 1\n0 2 1 1 print\nadd 1 3 0\n4 4 1\n")
+	expectError(t, `print.apply(1)`, "apply() argument must be an array, got 'int'")
+	expectError(t, `print.apply()`, "apply() expects 1 argument, got 0")
+	expectError(t, `print.source`, "function has no property 'source'")
+}
+
+func TestShadowBuiltins(t *testing.T) {
+	expectOutput(t, `
+var set = [1, 2]
+function count() { return len(set) }
+print(set, count(), keys(globals()))
+`, "[1, 2] 2 [\"count\", \"set\"]\n")
+	expectOutput(t, `
+function f() { var set = "local"; return set }
+print(f(), set([1]).size())
+`, "local 1\n")
+	expectError(t, `
+var set = 1
+var set = 2
+`, "variable 'set' already declared in this scope")
+	expectOutput(t, `
+const env = "prod"
+var args = {verbose: true}
+print(env, args.verbose)
+`, "prod true\n")
+	expectOutput(t, `
+function format(x) { return "<" + x + ">" }
+print(format(1), "%d".format(2))
+`, "<1> 2\n")
+}
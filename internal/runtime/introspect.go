@@ -0,0 +1,209 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Environment introspection and dynamic access
+// ============================================================
+
+// registerIntrospectBuiltins adds globals(), locals() and dir(), which need
+// access to the interpreter's scope.
+func (i *Interpreter) registerIntrospectBuiltins() {
+	i.global.Define("globals", &BuiltinVal{
+		Name:      "globals",
+		Signature: "globals()",
+		Doc:       "Return a map of the script's global variables, functions and classes.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("globals() expects 0 arguments, got %d", len(args))
+			}
+			return i.Globals(), nil
+		},
+	}, true)
+
+	i.global.Define("locals", &BuiltinVal{
+		Name:      "locals",
+		Signature: "locals()",
+		Doc:       "Return a map of the variables in the enclosing function and blocks.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("locals() expects 0 arguments, got %d", len(args))
+			}
+			if i.env == i.global {
+				return i.Globals(), nil
+			}
+			return i.locals(), nil
+		},
+	}, true)
+
+	i.global.Define("dir", &BuiltinVal{
+		Name:      "dir",
+		Signature: "dir(value)",
+		Doc:       "Return the sorted property and method names of an object, class, map or enum.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("dir() expects 1 argument, got %d", len(args))
+			}
+			names, err := dirNames(args[0])
+			if err != nil {
+				return nil, err
+			}
+			elements := make([]Value, len(names))
+			for idx, name := range names {
+				elements[idx] = StringVal(name)
+			}
+			return &ArrayVal{Elements: elements}, nil
+		},
+	}, true)
+}
+
+// registerDynamicBuiltins adds getProp(), setProp() and invoke(), which take
+// property and method names computed at runtime.
+func (i *Interpreter) registerDynamicBuiltins() {
+	i.global.Define("getProp", &BuiltinVal{
+		Name:      "getProp",
+		Signature: "getProp(value, name)",
+		Doc:       "Read property name of value, like value.name.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("getProp() expects 2 arguments, got %d", len(args))
+			}
+			name, ok := args[1].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("getProp() name must be a string, got '%s'", args[1].TypeName())
+			}
+			if val, ok, err := i.getter(args[0], string(name), span.Span{}); ok {
+				return val, err
+			}
+			if err := i.requireKey(args[0], string(name)); err != nil {
+				return nil, err
+			}
+			return GetMember(args[0], string(name))
+		},
+	}, true)
+
+	i.global.Define("setProp", &BuiltinVal{
+		Name:      "setProp",
+		Signature: "setProp(value, name, v)",
+		Doc:       "Assign v to property name of value, like value.name = v.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 3 {
+				return nil, fmt.Errorf("setProp() expects 3 arguments, got %d", len(args))
+			}
+			name, ok := args[1].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("setProp() name must be a string, got '%s'", args[1].TypeName())
+			}
+			if ok, err := i.setter(args[0], string(name), args[2], span.Span{}); ok {
+				return args[2], err
+			}
+			if err := SetMember(args[0], string(name), args[2]); err != nil {
+				return nil, err
+			}
+			return args[2], nil
+		},
+	}, true)
+
+	i.global.Define("invoke", &BuiltinVal{
+		Name:      "invoke",
+		Signature: "invoke(value, method, args?)",
+		Doc:       "Call method on value with the elements of args, like value.method(...).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("invoke() expects 2-3 arguments, got %d", len(args))
+			}
+			name, ok := args[1].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("invoke() method name must be a string, got '%s'", args[1].TypeName())
+			}
+			var callArgs []Value
+			if len(args) == 3 {
+				arr, ok := args[2].(*ArrayVal)
+				if !ok {
+					return nil, fmt.Errorf("invoke() args must be an array, got '%s'", args[2].TypeName())
+				}
+				callArgs = append(callArgs, arr.Elements...)
+			}
+			return i.callMember(args[0], string(name), callArgs, span.Span{})
+		},
+	}, true)
+}
+
+// Globals returns the global bindings defined by the script itself, without
+// builtins, as a map sorted by name.
+func (i *Interpreter) Globals() *MapVal {
+	m := &MapVal{Values: make(map[string]Value)}
+	i.global.bindings(func(name string, val Value) {
+		m.Keys = append(m.Keys, name)
+		m.Values[name] = val
+	})
+	sort.Strings(m.Keys)
+	return m
+}
+
+// locals returns the bindings visible from the current scope below the
+// global one. Inner scopes shadow outer ones; internal names are skipped.
+func (i *Interpreter) locals() *MapVal {
+	m := &MapVal{Values: make(map[string]Value)}
+	for env := i.env; env != nil && env != i.global; env = env.parent {
+		env.bindings(func(name string, val Value) {
+			if _, shadowed := m.Values[name]; shadowed || strings.HasPrefix(name, "__") {
+				return
+			}
+			m.Keys = append(m.Keys, name)
+			m.Values[name] = val
+		})
+	}
+	sort.Strings(m.Keys)
+	return m
+}
+
+// dirNames lists the names reachable with '.' on v.
+func dirNames(v Value) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	switch val := v.(type) {
+	case *ObjectVal:
+		for name := range val.Props {
+			add(name)
+		}
+		for cls := val.Class; cls != nil; cls = cls.Super {
+			for _, m := range cls.Decl.Getters {
+				add(m.Name)
+			}
+			for _, m := range cls.Decl.Methods {
+				add(m.Name)
+			}
+		}
+	case *ClassVal:
+		for cls := val; cls != nil; cls = cls.Super {
+			for name := range cls.Statics {
+				add(name)
+			}
+		}
+	case *MapVal:
+		for _, k := range val.Keys {
+			add(k)
+		}
+	case *EnumTypeVal:
+		for _, variant := range val.Order {
+			add(variant)
+		}
+	default:
+		return nil, fmt.Errorf("dir() not supported for type '%s'", v.TypeName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
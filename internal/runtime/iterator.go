@@ -0,0 +1,74 @@
+package runtime
+
+import (
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+)
+
+// ============================================================
+// Iterator protocol
+// ============================================================
+//
+// for-of visits an object through its iter() method, which returns an
+// array, map or string to loop over, or an iterator: an object whose next()
+// method returns {"value": v, "done": false} for each item and a map with
+// done set once there are no more. An object with next() but no iter() is
+// its own iterator, and so is a generator.
+
+// iterator returns what for-of loops over for obj.
+func (i *Interpreter) iterator(obj *ObjectVal, s span.Span) (Value, error) {
+	if method, cls := findMethod(obj.Class, "iter"); method != nil {
+		return i.runMethod(obj, cls, method, nil, s)
+	}
+	if method, _ := findMethod(obj.Class, "next"); method != nil {
+		return obj, nil
+	}
+	return nil, runtimeErr(s, "object of class '%s' is not iterable: it has no iter() or next() method", obj.Class.Decl.Name)
+}
+
+// iterNext calls it.next() and unpacks the value and done fields of the
+// map or object it returns.
+func (i *Interpreter) iterNext(it Value, s span.Span) (val Value, done bool, err error) {
+	result, err := i.callMember(it, "next", nil, s)
+	if err != nil {
+		return nil, false, err
+	}
+	switch result.(type) {
+	case *MapVal, *ObjectVal:
+	default:
+		return nil, false, runtimeErr(s, "%s.next() must return a map with 'value' and 'done', got '%s'", it.(*ObjectVal).Class.Decl.Name, result.TypeName())
+	}
+	doneVal, err := GetMember(result, "done")
+	if err != nil {
+		return nil, false, runtimeErr(s, "%s", err)
+	}
+	if IsTruthy(doneVal) {
+		return nil, true, nil
+	}
+	val, err = GetMember(result, "value")
+	if err != nil {
+		return nil, false, runtimeErr(s, "%s", err)
+	}
+	return val, false, nil
+}
+
+// execForOfIterator runs a for-of loop over an iterator, asking for each
+// item only once the body has run for the one before, so iterators may be
+// endless as long as the loop breaks. A generator left early is closed.
+func (i *Interpreter) execForOfIterator(s *ast.ForOfStmt, it Value) (ExecResult, error) {
+	for idx := 0; ; idx++ {
+		elem, done, err := i.iterNext(it, s.GetSpan())
+		if err != nil || done {
+			return resultNone, err
+		}
+		result, stop, err := i.forOfStep(s, idx, elem, nil)
+		if err != nil || stop {
+			if g, ok := it.(*GeneratorVal); ok && g.state == generatorSuspended {
+				if closeErr := i.closeGenerator(g, s.GetSpan()); err == nil {
+					err = closeErr
+				}
+			}
+			return result, err
+		}
+	}
+}
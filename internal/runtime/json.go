@@ -0,0 +1,272 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"light-lang/internal/span"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// JSON encoding and decoding
+// ============================================================
+
+// registerJSONBuiltins adds jsonParse() and jsonStringify().
+func (i *Interpreter) registerJSONBuiltins() {
+	i.global.Define("jsonParse", &BuiltinVal{
+		Name:      "jsonParse",
+		Signature: "jsonParse(text)",
+		Doc:       "Parse JSON text into maps, arrays, strings, numbers, bools and null.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("jsonParse() expects 1 argument, got %d", len(args))
+			}
+			text, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("jsonParse() expects a string argument, got '%s'", args[0].TypeName())
+			}
+			val, err := decodeJSON([]byte(text))
+			if err != nil {
+				return nil, fmt.Errorf("jsonParse(): %v", err)
+			}
+			return val, nil
+		},
+	}, true)
+
+	i.global.Define("jsonStringify", &BuiltinVal{
+		Name:      "jsonStringify",
+		Signature: "jsonStringify(value, indent?)",
+		Doc:       "Encode value as JSON, on one line or indented by indent spaces (or the indent string).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("jsonStringify() expects 1-2 arguments, got %d", len(args))
+			}
+			enc := &jsonEncoder{interp: i, path: make(map[Value]bool)}
+			if len(args) == 2 {
+				switch indent := args[1].(type) {
+				case IntVal:
+					enc.indent = strings.Repeat(" ", int(max(0, min(indent, 10))))
+				case StringVal:
+					enc.indent = string(indent)
+				default:
+					return nil, fmt.Errorf("jsonStringify() indent must be an integer or a string, got '%s'", args[1].TypeName())
+				}
+			}
+			if err := enc.write(args[0], 0); err != nil {
+				return nil, err
+			}
+			return StringVal(enc.b.String()), nil
+		},
+	}, true)
+}
+
+// jsonEncoder writes runtime values as JSON. Arrays and sets become arrays,
+// maps keep their key order, and objects become their toString() result if
+// their class declares one, and otherwise an object of their properties
+// (record fields in declaration order, other properties sorted). path holds
+// the collections being written, so cycles are reported rather than
+// followed.
+type jsonEncoder struct {
+	interp *Interpreter
+	indent string
+	path   map[Value]bool
+	b      strings.Builder
+}
+
+func (e *jsonEncoder) write(v Value, depth int) error {
+	switch val := v.(type) {
+	case NullVal:
+		e.b.WriteString("null")
+	case BoolVal, IntVal:
+		e.b.WriteString(val.String())
+	case FloatVal:
+		f := float64(val)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("jsonStringify() cannot encode %s", val)
+		}
+		s := val.String()
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0" // keep it a float when parsed back
+		}
+		e.b.WriteString(s)
+	case StringVal:
+		e.writeString(string(val))
+	case *EnumVariantVal:
+		e.writeString(val.String())
+	case *ArrayVal:
+		return e.writeList(val, val.Elements, depth)
+	case *SetVal:
+		return e.writeList(val, val.Items, depth)
+	case *StringBuilderVal:
+		e.writeString(val.String())
+	case *MapVal:
+		return e.writeObject(val, val.Keys, func(k string) Value { return val.Values[k] }, depth)
+	case *ObjectVal:
+		if str, ok, err := e.interp.callToString(val, span.Span{}); ok {
+			if err != nil {
+				return err
+			}
+			e.writeString(str)
+			return nil
+		}
+		keys := val.Class.Decl.Fields
+		if !val.Class.Decl.Record {
+			keys = make([]string, 0, len(val.Props))
+			for k := range val.Props {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+		}
+		return e.writeObject(val, keys, func(k string) Value { return val.Props[k] }, depth)
+	default:
+		return fmt.Errorf("jsonStringify() cannot encode a value of type '%s'", v.TypeName())
+	}
+	return nil
+}
+
+func (e *jsonEncoder) writeString(s string) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.b.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// enter marks the collection v as being written, failing if it already is.
+func (e *jsonEncoder) enter(v Value) error {
+	if e.path[v] {
+		return fmt.Errorf("jsonStringify() cannot encode a value that contains itself")
+	}
+	e.path[v] = true
+	return nil
+}
+
+func (e *jsonEncoder) writeList(v Value, elems []Value, depth int) error {
+	if err := e.enter(v); err != nil {
+		return err
+	}
+	defer delete(e.path, v)
+	e.b.WriteByte('[')
+	for idx, elem := range elems {
+		e.writeSep(idx, depth+1)
+		if err := e.write(elem, depth+1); err != nil {
+			return err
+		}
+	}
+	e.writeClose(len(elems), depth, ']')
+	return nil
+}
+
+func (e *jsonEncoder) writeObject(v Value, keys []string, get func(string) Value, depth int) error {
+	if err := e.enter(v); err != nil {
+		return err
+	}
+	defer delete(e.path, v)
+	e.b.WriteByte('{')
+	for idx, k := range keys {
+		e.writeSep(idx, depth+1)
+		e.writeString(k)
+		e.b.WriteByte(':')
+		if e.indent != "" {
+			e.b.WriteByte(' ')
+		}
+		if err := e.write(get(k), depth+1); err != nil {
+			return err
+		}
+	}
+	e.writeClose(len(keys), depth, '}')
+	return nil
+}
+
+// writeSep starts element idx of a collection, on its own line when
+// indenting.
+func (e *jsonEncoder) writeSep(idx, depth int) {
+	if idx > 0 {
+		e.b.WriteByte(',')
+	}
+	if e.indent != "" {
+		e.b.WriteString("\n" + strings.Repeat(e.indent, depth))
+	}
+}
+
+// writeClose ends a collection of n elements with the closing bracket.
+func (e *jsonEncoder) writeClose(n, depth int, bracket byte) {
+	if e.indent != "" && n > 0 {
+		e.b.WriteString("\n" + strings.Repeat(e.indent, depth))
+	}
+	e.b.WriteByte(bracket)
+}
+
+// decodeJSON parses JSON text into runtime values. Objects become maps that
+// keep their keys in document order, and integral numbers become ints.
+func decodeJSON(data []byte) (Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	val, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the top-level value")
+	}
+	return val, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			arr := &ArrayVal{Elements: []Value{}}
+			for dec.More() {
+				elem, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr.Elements = append(arr.Elements, elem)
+			}
+			_, err := dec.Token() // consume ']'
+			return arr, err
+		}
+		m := &MapVal{Keys: []string{}, Values: make(map[string]Value)}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON: %v", err)
+			}
+			key := keyTok.(string)
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := m.Values[key]; !exists {
+				m.Keys = append(m.Keys, key)
+			}
+			m.Values[key] = val
+		}
+		_, err := dec.Token() // consume '}'
+		return m, err
+	case string:
+		return StringVal(t), nil
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return IntVal(n), nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON number %s", t)
+		}
+		return FloatVal(f), nil
+	case bool:
+		return BoolVal(t), nil
+	default:
+		return NullVal{}, nil
+	}
+}
@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Execution limits
+// ============================================================
+
+// Limits bounds how much work a script may do, so hosts can run untrusted
+// code safely. A zero field means no limit.
+type Limits struct {
+	Timeout       time.Duration // wall-clock budget, counted from SetLimits
+	MaxSteps      int64         // statements and loop iterations executed
+	MaxCallDepth  int           // nested function, method and constructor calls
+	MaxHeapValues int64         // arrays, maps, sets and objects created, plus the elements stored in them
+}
+
+// Option configures an interpreter made by NewInterpreter.
+type Option func(*Interpreter)
+
+// WithLimits makes NewInterpreter apply l, as SetLimits does.
+func WithLimits(l Limits) Option {
+	return func(i *Interpreter) { i.SetLimits(l) }
+}
+
+// defaultMaxCallDepth stops runaway recursion when the host set no
+// MaxCallDepth, long before the Go stack would overflow and crash it.
+const defaultMaxCallDepth = 10000
+
+// deadlineCheckInterval is how many steps run between clock reads.
+const deadlineCheckInterval = 1024
+
+// SetLimits applies l to this interpreter and to the modules, workers and
+// parallel tasks it starts. Exceeding a limit stops the script with a
+// runtime error.
+func (i *Interpreter) SetLimits(l Limits) {
+	i.limits = l
+	i.deadline = time.Time{}
+	if l.Timeout > 0 {
+		i.deadline = time.Now().Add(l.Timeout)
+	}
+	i.heapValues = new(atomic.Int64)
+}
+
+// inheritLimits gives a sub-interpreter the limits and deadline of parent.
+// Step counts are kept per interpreter; the heap budget is shared.
+func (i *Interpreter) inheritLimits(parent *Interpreter) {
+	i.limits = parent.limits
+	i.deadline = parent.deadline
+	i.heapValues = parent.heapValues
+	i.interrupt = parent.interrupt
+}
+
+// step counts one unit of work at s and checks the step and time budgets
+// and for cancellation.
+func (i *Interpreter) step(s span.Span) error {
+	i.steps++
+	if err := i.interrupted(s); err != nil {
+		return err
+	}
+	if max := i.limits.MaxSteps; max > 0 && i.steps > max {
+		return runtimeErr(s, "step limit of %d exceeded", max)
+	}
+	if !i.deadline.IsZero() && i.steps%deadlineCheckInterval == 0 && time.Now().After(i.deadline) {
+		return runtimeErr(s, "timeout of %s exceeded", i.limits.Timeout)
+	}
+	return nil
+}
+
+// enterCall records a call of name at s, failing when it would exceed the
+// call depth limit. Without one, recursing past defaultMaxCallDepth throws
+// a RangeError that the script can catch. Every successful enterCall must
+// be paired with exitCall.
+func (i *Interpreter) enterCall(name string, s span.Span) error {
+	if err := i.CheckCall(len(i.frames), s); err != nil {
+		return err
+	}
+	if i.limits.MaxCallDepth <= 0 && len(i.frames) >= defaultMaxCallDepth {
+		msg := fmt.Sprintf("maximum call depth exceeded (%d nested calls)", defaultMaxCallDepth)
+		return throwValue(i.newError("RangeError", msg, ""), s, i.frames)
+	}
+	i.frames = append(i.frames, Frame{Name: name, Span: s})
+	return nil
+}
+
+// Step counts one unit of work at s like a statement or loop iteration,
+// checking the step and time budgets and for cancellation. Backends that
+// run scripts without the tree walker, like the bytecode VM, call it to
+// share the interpreter's limits.
+func (i *Interpreter) Step(s span.Span) error {
+	return i.step(s)
+}
+
+// CheckCall reports an error when a call at s, made with depth calls
+// already active, would exceed the call depth limit or the run is
+// cancelled.
+func (i *Interpreter) CheckCall(depth int, s span.Span) error {
+	if err := i.interrupted(s); err != nil {
+		return err
+	}
+	if max := i.limits.MaxCallDepth; max > 0 && depth >= max {
+		return runtimeErr(s, "call depth limit of %d exceeded", max)
+	}
+	return nil
+}
+
+func (i *Interpreter) exitCall() {
+	i.frames = i.frames[:len(i.frames)-1]
+}
+
+// allocate charges n values against the heap budget.
+func (i *Interpreter) allocate(n int, s span.Span) error {
+	max := i.limits.MaxHeapValues
+	if max <= 0 || n <= 0 {
+		return nil
+	}
+	if i.heapValues.Add(int64(n)) > max {
+		return runtimeErr(s, "heap limit of %d values exceeded", max)
+	}
+	return nil
+}
+
+// allocated charges the heap budget for a container that a builtin or
+// built-in method returned, unless it is one of the values it was given.
+func (i *Interpreter) allocated(result Value, given []Value, s span.Span) error {
+	if i.limits.MaxHeapValues <= 0 {
+		return nil
+	}
+	var n int
+	switch v := result.(type) {
+	case *ArrayVal:
+		n = len(v.Elements)
+	case *MapVal:
+		n = len(v.Keys)
+	case *SetVal:
+		n = len(v.Items)
+	default:
+		return nil
+	}
+	for _, g := range given {
+		if g == result {
+			return nil
+		}
+	}
+	return i.allocate(1+n, s)
+}
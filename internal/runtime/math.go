@@ -0,0 +1,198 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/token"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Math namespace
+// ============================================================
+
+// Math is a built-in class holding mathematical functions and constants as
+// statics, so Math.sqrt(2) and Math.PI read like any static member and
+// cannot be reassigned.
+
+// floatFuncs are the Math functions that take one number and return a
+// float.
+var floatFuncs = map[string]struct {
+	fn  func(float64) float64
+	doc string
+}{
+	"sqrt":  {math.Sqrt, "Return the square root of x."},
+	"cbrt":  {math.Cbrt, "Return the cube root of x."},
+	"exp":   {math.Exp, "Return e raised to the power x."},
+	"log":   {math.Log, "Return the natural logarithm of x."},
+	"log2":  {math.Log2, "Return the base-2 logarithm of x."},
+	"log10": {math.Log10, "Return the base-10 logarithm of x."},
+	"sin":   {math.Sin, "Return the sine of x radians."},
+	"cos":   {math.Cos, "Return the cosine of x radians."},
+	"tan":   {math.Tan, "Return the tangent of x radians."},
+	"asin":  {math.Asin, "Return the arcsine of x, in radians."},
+	"acos":  {math.Acos, "Return the arccosine of x, in radians."},
+	"atan":  {math.Atan, "Return the arctangent of x, in radians."},
+}
+
+// roundFuncs are the Math functions that round a number to an integer. An
+// int is returned as it is, and a float too large for an int stays a float.
+var roundFuncs = map[string]struct {
+	fn  func(float64) float64
+	doc string
+}{
+	"floor": {math.Floor, "Return the largest integer less than or equal to x."},
+	"ceil":  {math.Ceil, "Return the smallest integer greater than or equal to x."},
+	"round": {math.Round, "Return x rounded to the nearest integer, halves away from zero."},
+	"trunc": {math.Trunc, "Return x with its fractional part removed."},
+}
+
+// registerMathBuiltins adds the Math class. It follows the random builtins,
+// so Math.random() and Math.randomInt() draw from the same seedable source.
+func (i *Interpreter) registerMathBuiltins() {
+	statics := map[string]Value{
+		"PI": FloatVal(math.Pi),
+		"E":  FloatVal(math.E),
+	}
+	define := func(name, sig, doc string, fn BuiltinFn) {
+		statics[name] = &BuiltinVal{Name: "Math." + name, Signature: "Math." + sig, Doc: doc, Fn: fn}
+	}
+
+	for name, f := range floatFuncs {
+		define(name, name+"(x)", f.doc, func(args []Value) (Value, error) {
+			x, err := mathArgs("Math."+name, args, 1)
+			if err != nil {
+				return nil, err
+			}
+			return FloatVal(f.fn(x[0])), nil
+		})
+	}
+	for name, f := range roundFuncs {
+		define(name, name+"(x)", f.doc, func(args []Value) (Value, error) {
+			if _, err := mathArgs("Math."+name, args, 1); err != nil {
+				return nil, err
+			}
+			if n, ok := args[0].(IntVal); ok {
+				return n, nil
+			}
+			r := f.fn(float64(args[0].(FloatVal)))
+			if r >= -(1<<63) && r < 1<<63 {
+				return IntVal(int64(r)), nil
+			}
+			return FloatVal(r), nil
+		})
+	}
+
+	define("abs", "abs(x)", "Return the absolute value of x, keeping its type.", func(args []Value) (Value, error) {
+		if _, err := mathArgs("Math.abs", args, 1); err != nil {
+			return nil, err
+		}
+		if n, ok := args[0].(IntVal); ok {
+			if n < 0 {
+				return Negate(n)
+			}
+			return n, nil
+		}
+		return FloatVal(math.Abs(float64(args[0].(FloatVal)))), nil
+	})
+	define("sign", "sign(x)", "Return -1, 0 or 1 as x is negative, zero or positive.", func(args []Value) (Value, error) {
+		x, err := mathArgs("Math.sign", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case x[0] < 0:
+			return IntVal(-1), nil
+		case x[0] > 0:
+			return IntVal(1), nil
+		}
+		return IntVal(0), nil
+	})
+	define("pow", "pow(x, y)", "Return x raised to the power y, like x ** y.", func(args []Value) (Value, error) {
+		if _, err := mathArgs("Math.pow", args, 2); err != nil {
+			return nil, err
+		}
+		return BinaryOp(token.STAR_STAR, args[0], args[1])
+	})
+	define("atan2", "atan2(y, x)", "Return the angle in radians from the x axis to the point (x, y).", func(args []Value) (Value, error) {
+		yx, err := mathArgs("Math.atan2", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return FloatVal(math.Atan2(yx[0], yx[1])), nil
+	})
+	define("hypot", "hypot(x, y)", "Return the square root of x*x + y*y.", func(args []Value) (Value, error) {
+		xy, err := mathArgs("Math.hypot", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return FloatVal(math.Hypot(xy[0], xy[1])), nil
+	})
+	for name, which := range map[string]string{"min": "smallest", "max": "largest"} {
+		define(name, name+"(numbers...)", "Return the "+which+" of the numbers, or of the numbers in one array argument.", func(args []Value) (Value, error) {
+			if len(args) == 1 {
+				if arr, ok := args[0].(*ArrayVal); ok {
+					args = arr.Elements
+				}
+			}
+			if len(args) == 0 {
+				return nil, fmt.Errorf("Math.%s() expects at least 1 number", name)
+			}
+			x, err := mathArgs("Math."+name, args, len(args))
+			if err != nil {
+				return nil, err
+			}
+			best := 0
+			for idx := range x {
+				if (name == "min" && x[idx] < x[best]) || (name == "max" && x[idx] > x[best]) {
+					best = idx
+				}
+			}
+			return args[best], nil
+		})
+	}
+	for _, name := range []string{"random", "randomInt"} {
+		fn, _ := i.global.Get(name)
+		builtin := fn.(*BuiltinVal)
+		define(name, builtin.Signature, builtin.Doc, builtin.Fn)
+	}
+
+	i.defineNamespace("Math", "Mathematical functions and constants, e.g. Math.sqrt(2) and Math.PI.", statics)
+}
+
+// defineNamespace defines a built-in class named name whose statics are
+// members, constant so scripts cannot replace them. doc() lists them.
+func (i *Interpreter) defineNamespace(name, doc string, members map[string]Value) {
+	consts := make(map[string]bool, len(members))
+	names := make([]string, 0, len(members))
+	for member := range members {
+		consts[member] = true
+		names = append(names, member)
+	}
+	sort.Strings(names)
+	decl := &ast.ClassDecl{Name: name, Doc: doc + "\nMembers: " + strings.Join(names, ", ")}
+	i.global.Define(name, &ClassVal{Decl: decl, Env: i.global, Statics: members, Consts: consts, interp: i}, true)
+}
+
+// mathArgs checks that fn got n numeric arguments and returns them as
+// floats.
+func mathArgs(fn string, args []Value, n int) ([]float64, error) {
+	if len(args) != n {
+		plural := "s"
+		if n == 1 {
+			plural = ""
+		}
+		return nil, fmt.Errorf("%s() expects %d argument%s, got %d", fn, n, plural, len(args))
+	}
+	x := make([]float64, n)
+	for idx, arg := range args {
+		f, ok := ToFloat64(arg)
+		if !ok {
+			return nil, fmt.Errorf("%s() expects numbers, got '%s'", fn, arg.TypeName())
+		}
+		x[idx] = f
+	}
+	return x, nil
+}
@@ -0,0 +1,159 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ============================================================
+// Memoization
+// ============================================================
+
+// registerMemoizeBuiltins adds memoize(), which calls back into the
+// interpreter from the wrapper it returns.
+func (i *Interpreter) registerMemoizeBuiltins() {
+	i.global.Define("memoize", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "memoize",
+			Signature: "memoize(fn)",
+			Doc:       "Return a wrapper around fn that caches results by argument values.",
+			Fn: func(args []Value) (Value, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("memoize() expects 1 argument, got %d", len(args))
+				}
+				switch fn := args[0].(type) {
+				case *FuncVal:
+					return i.memoize(fn, fn.Name, fmt.Sprintf("%s(%s)", fn.Name, ast.FormatParams(fn.Params, fn.Rest)), fn.Doc), nil
+				case *BuiltinVal:
+					return i.memoize(fn, fn.Name, fn.Signature, fn.Doc), nil
+				case Callable:
+					return i.memoize(fn, fn.Name(), fmt.Sprintf("%s(%s)", fn.Name(), strings.Join(fn.Params(), ", ")), ""), nil
+				default:
+					return nil, fmt.Errorf("memoize() expects a function, got '%s'", args[0].TypeName())
+				}
+			},
+		}
+	}), true)
+}
+
+// memoize wraps fn in a builtin that remembers the result for each list of
+// arguments. Arguments are keyed by value, so equal arrays, maps and records
+// share an entry; calls that fail are not cached. The cache is locked because
+// parallel tasks may call the same wrapper. A copy made for another
+// interpreter wraps a copy of fn and starts with an empty cache.
+func (i *Interpreter) memoize(fn Value, name, signature, doc string) *BuiltinVal {
+	var mu sync.Mutex
+	cache := make(map[string]Value)
+	return &BuiltinVal{
+		Name:      name,
+		Signature: signature,
+		Doc:       doc,
+		Fn: func(args []Value) (Value, error) {
+			var key strings.Builder
+			for _, arg := range args {
+				writeValueKey(&key, arg, make(map[Value]int))
+				key.WriteByte(';')
+			}
+			mu.Lock()
+			result, ok := cache[key.String()]
+			mu.Unlock()
+			if ok {
+				return result, nil
+			}
+			result, err := i.callValue(fn, args, span.Span{})
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			cache[key.String()] = result
+			mu.Unlock()
+			return result, nil
+		},
+		rebind: func(c *copier) *BuiltinVal {
+			return c.interp.memoize(c.copyValue(fn), name, signature, doc)
+		},
+	}
+}
+
+// writeValueKey writes a string that is the same for values that are equal
+// by content, following valuesEqual for scalars: 1 and 1.0 share a key.
+// Arrays, maps and records are keyed by their contents; other objects,
+// functions and classes by identity. seen numbers the containers on the
+// current path so cyclic values still produce a finite key.
+func writeValueKey(b *strings.Builder, v Value, seen map[Value]int) {
+	switch val := v.(type) {
+	case IntVal:
+		fmt.Fprintf(b, "i%d", int64(val))
+	case FloatVal:
+		f := float64(val)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			fmt.Fprintf(b, "i%d", int64(f))
+		} else {
+			b.WriteString("f" + strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case StringVal:
+		b.WriteString("s" + strconv.Quote(string(val)))
+	case BoolVal:
+		fmt.Fprintf(b, "b%t", bool(val))
+	case NullVal:
+		b.WriteString("n")
+	case *EnumVariantVal:
+		fmt.Fprintf(b, "e%s.%s", val.EnumName, val.VariantName)
+	case *ArrayVal:
+		if writeCycleKey(b, v, seen) {
+			return
+		}
+		b.WriteByte('[')
+		for _, elem := range val.Elements {
+			writeValueKey(b, elem, seen)
+			b.WriteByte(',')
+		}
+		b.WriteByte(']')
+		delete(seen, v)
+	case *MapVal:
+		if writeCycleKey(b, v, seen) {
+			return
+		}
+		b.WriteByte('{')
+		for _, k := range val.Keys {
+			b.WriteString(strconv.Quote(k) + ":")
+			writeValueKey(b, val.Values[k], seen)
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+		delete(seen, v)
+	case *ObjectVal:
+		if !val.Class.Decl.Record {
+			fmt.Fprintf(b, "p%p", val)
+			return
+		}
+		if writeCycleKey(b, v, seen) {
+			return
+		}
+		fmt.Fprintf(b, "r%p(", val.Class)
+		for _, field := range val.Class.Decl.Fields {
+			writeValueKey(b, val.Props[field], seen)
+			b.WriteByte(',')
+		}
+		b.WriteByte(')')
+		delete(seen, v)
+	default:
+		fmt.Fprintf(b, "p%p", v)
+	}
+}
+
+// writeCycleKey writes a back-reference if v is already on the current path,
+// and otherwise marks it as entered.
+func writeCycleKey(b *strings.Builder, v Value, seen map[Value]int) bool {
+	if depth, ok := seen[v]; ok {
+		fmt.Fprintf(b, "^%d", depth)
+		return true
+	}
+	seen[v] = len(seen)
+	return false
+}
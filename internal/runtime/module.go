@@ -0,0 +1,271 @@
+package runtime
+
+import (
+	"fmt"
+	"io/fs"
+	"light-lang/internal/ast"
+	"light-lang/internal/lexer"
+	"light-lang/internal/modules"
+	"light-lang/internal/parser"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ============================================================
+// Module imports
+// ============================================================
+
+// module is a loaded source module.
+type module struct {
+	path    string
+	env     *Environment
+	names   []string // top-level names the module defined itself
+	loading bool
+}
+
+// moduleCache is shared by an interpreter and every module it loads, so
+// each file runs at most once per program.
+type moduleCache struct {
+	byPath map[string]*module
+}
+
+// SetScriptPath records the file being run. Relative imports resolve from
+// its directory, and remote imports are verified against the light.sum or
+// light.toml and light.lock found from there.
+func (i *Interpreter) SetScriptPath(path string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	i.dir = filepath.Dir(abs)
+	i.projectDir = i.dir
+}
+
+// importModule loads the module at importPath and binds its top-level names
+// in the current scope.
+func (i *Interpreter) importModule(s *ast.ImportStmt) (ExecResult, error) {
+	file, err := i.resolveImport(s.Path)
+	if err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+
+	mod, err := i.loadModule(file)
+	if err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+	for _, name := range mod.names {
+		val, _ := mod.env.Get(name)
+		if existing, ok := i.env.lookup(name); ok && existing == val {
+			continue // already imported, e.g. through another module
+		}
+		if err := i.env.Define(name, val, mod.env.isConst(name)); err != nil {
+			return resultNone, runtimeErr(s.Span, "import of '%s' from %s: %s", name, s.Path, err)
+		}
+		if i.env == i.global {
+			i.imported[name] = true
+		}
+	}
+	return resultNone, nil
+}
+
+// resolveImport maps an import path to the file it names: within the
+// embedded filesystem if there is one, in the remote module cache for remote
+// paths, light.toml dependencies and relative imports made by cached
+// modules, or on disk relative to the importing file.
+func (i *Interpreter) resolveImport(importPath string) (string, error) {
+	if i.fsys != nil {
+		if modules.IsRemote(importPath) {
+			return "", fmt.Errorf("remote module '%s' cannot be imported from an embedded filesystem", importPath)
+		}
+		return modules.ResolveFS(importPath, i.dir)
+	}
+	if modules.IsRemote(importPath) {
+		return modules.ResolveRemote(importPath, i.projectDir)
+	}
+	if file, ok, err := modules.ResolveDependency(importPath, i.projectDir); ok {
+		return file, err
+	}
+	if file, ok, err := modules.ResolveCached(importPath, i.dir, i.projectDir); ok {
+		return file, err
+	}
+	return modules.ResolveLocal(importPath, i.dir), nil
+}
+
+// importData binds the contents of a data file to s.Name: parsed as JSON for
+// .json files or 'as json', or as a string for 'as text'.
+func (i *Interpreter) importData(s *ast.ImportStmt) (ExecResult, error) {
+	format := s.As
+	if format == "" {
+		if path.Ext(s.Path) != ".json" {
+			return resultNone, runtimeErr(s.Span, "cannot import '%s' as data; add 'as text' or 'as json'", s.Path)
+		}
+		format = "json"
+	}
+	file, err := i.resolveImport(s.Path)
+	if err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+	_, source, err := i.readModule(file)
+	if err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+
+	var val Value = StringVal(source)
+	if format == "json" {
+		if val, err = decodeJSON(source); err != nil {
+			return resultNone, runtimeErr(s.Span, "%s: %s", s.Path, err)
+		}
+	}
+	if err := i.env.Define(s.Name, val, true); err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+	if i.env == i.global {
+		i.imported[s.Name] = true
+	}
+	return resultNone, nil
+}
+
+// loadModule runs a module file once and returns its cached result.
+func (i *Interpreter) loadModule(file string) (*module, error) {
+	key, source, err := i.readModule(file)
+	if err != nil {
+		return nil, err
+	}
+	if mod, ok := i.modules.byPath[key]; ok {
+		if mod.loading {
+			return nil, fmt.Errorf("import cycle through %s", key)
+		}
+		return mod, nil
+	}
+
+	parsed, err := parseModule(key, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each module gets a fresh global scope holding only the builtins
+	sub := NewInterpreter(i.output)
+	sub.modules = i.modules
+	sub.fsys = i.fsys
+	sub.ffiAllowed = i.ffiAllowed
+	sub.fsDisabled = i.fsDisabled
+	sub.args = i.args
+	sub.projectDir = i.projectDir
+	sub.random = i.random
+	sub.loop = i.loop
+	sub.strictIndex = i.strictIndex
+	sub.strictEquality = i.strictEquality
+	sub.strict = i.strict
+	sub.inheritLimits(i)
+	if i.fsys != nil {
+		sub.dir = path.Dir(key)
+	} else {
+		sub.dir = filepath.Dir(key)
+	}
+
+	mod := &module{path: key, env: sub.global, loading: true}
+	i.modules.byPath[key] = mod
+	if err := sub.Run(parsed); err != nil {
+		delete(i.modules.byPath, key)
+		return nil, fmt.Errorf("in module %s: %v", file, err)
+	}
+	mod.loading = false
+
+	// A module that exports anything exposes only its exports; otherwise
+	// all of its own definitions are visible to importers
+	if mod.names = exportedNames(parsed); mod.names == nil {
+		sub.global.bindings(func(name string, _ Value) {
+			if !sub.imported[name] {
+				mod.names = append(mod.names, name)
+			}
+		})
+	}
+	return mod, nil
+}
+
+// exportedNames returns the names declared with 'export' in file, or nil if
+// there are none.
+func exportedNames(file *ast.File) []string {
+	var names []string
+	for _, node := range file.Body {
+		switch d := node.(type) {
+		case *ast.FuncDecl:
+			if d.Exported {
+				names = append(names, d.Name)
+			}
+		case *ast.ClassDecl:
+			if d.Exported {
+				names = append(names, d.Name)
+			}
+		case *ast.EnumDecl:
+			if d.Exported {
+				names = append(names, d.Name)
+			}
+		case *ast.InterfaceDecl:
+			if d.Exported {
+				names = append(names, d.Name)
+			}
+		case *ast.VarDeclStmt:
+			if d.Exported && d.Names != nil {
+				names = append(names, d.Names...)
+			} else if d.Exported {
+				names = append(names, d.Name)
+			}
+		}
+	}
+	return names
+}
+
+// readModule reads a module from the embedded filesystem, or from disk when
+// there is none. The returned key identifies the file in the module cache.
+func (i *Interpreter) readModule(file string) (string, []byte, error) {
+	if i.fsys != nil {
+		source, err := fs.ReadFile(i.fsys, file)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read %s: %v", file, err)
+		}
+		return file, source, nil
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	source, err := os.ReadFile(abs)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot read %s: %v", file, err)
+	}
+	return abs, source, nil
+}
+
+// parseModule lexes and parses module source, reporting the first diagnostic.
+func parseModule(file string, source []byte) (*ast.File, error) {
+	tokens, lexDiags := lexer.New(string(source), file).Tokenize()
+	if len(lexDiags) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, lexDiags[0])
+	}
+	parsed, parseDiags := parser.New(tokens).ParseFile()
+	if len(parseDiags) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, parseDiags[0])
+	}
+	return parsed, nil
+}
+
+// RunFS runs the entry file from fsys, including any timers it schedules.
+// Imports are resolved within fsys rather than on disk.
+func (i *Interpreter) RunFS(fsys fs.FS, entry string) error {
+	source, err := fs.ReadFile(fsys, entry)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseModule(entry, source)
+	if err != nil {
+		return err
+	}
+	i.fsys = fsys
+	i.dir = path.Dir(entry)
+	if err := i.Run(parsed); err != nil {
+		return err
+	}
+	return i.RunEventLoop()
+}
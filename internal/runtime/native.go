@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"os"
+	"path/filepath"
+	"plugin"
+	"strings"
+)
+
+// ============================================================
+// Native extensions (Go plugins)
+// ============================================================
+
+// NativeRegisterSymbol is the symbol a native extension must export:
+//
+//	func Register(env *runtime.Environment)
+//
+// Register is called with the environment the extension is loaded into and
+// typically defines BuiltinVal entries on it. Extensions must be built with
+// `go build -buildmode=plugin` against the same light-lang sources and Go
+// toolchain as the host binary.
+const NativeRegisterSymbol = "Register"
+
+// nativePathEnv lists extra directories searched by `import native "name"`,
+// separated like PATH.
+const nativePathEnv = "LIGHT_PLUGIN_PATH"
+
+// LoadNative opens the Go plugin at path and registers it into env.
+func LoadNative(path string, env *Environment) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot load native extension %s: %v", path, err)
+	}
+	sym, err := p.Lookup(NativeRegisterSymbol)
+	if err != nil {
+		return fmt.Errorf("native extension %s does not export %s", path, NativeRegisterSymbol)
+	}
+	switch register := sym.(type) {
+	case func(*Environment):
+		register(env)
+	case *func(*Environment):
+		(*register)(env)
+	default:
+		return fmt.Errorf("native extension %s: %s has type %T, want func(*runtime.Environment)", path, NativeRegisterSymbol, sym)
+	}
+	return nil
+}
+
+// LoadNative loads a native extension into the interpreter's global scope.
+func (i *Interpreter) LoadNative(path string) error {
+	return LoadNative(path, i.global)
+}
+
+// resolveNative maps the name in `import native "name"` to a plugin file.
+// Names containing a path separator or ending in ".so" are used as given;
+// otherwise "<name>.so" is searched for in $LIGHT_PLUGIN_PATH, then the
+// current directory.
+func resolveNative(name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".so") {
+		return name, nil
+	}
+	dirs := filepath.SplitList(os.Getenv(nativePathEnv))
+	dirs = append(dirs, ".")
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, name+".so")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("native extension '%s' not found (searched %s and the current directory)", name, nativePathEnv)
+}
+
+// execImport runs an import statement. Native extensions register into the
+// current scope; data imports bind a single name.
+func (i *Interpreter) execImport(s *ast.ImportStmt) (ExecResult, error) {
+	if s.Name != "" {
+		return i.importData(s)
+	}
+	if !s.Native {
+		return i.importModule(s)
+	}
+	path, err := resolveNative(s.Path)
+	if err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+	if err := LoadNative(path, i.env); err != nil {
+		return resultNone, runtimeErr(s.Span, "%s", err)
+	}
+	return resultNone, nil
+}
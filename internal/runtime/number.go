@@ -0,0 +1,323 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Number parsing and conversion
+// ============================================================
+
+// The converters throw when a value cannot be converted, unless they are
+// given a default as their last argument, which is returned instead:
+// toInt("12") is 12, toInt("x") throws and toInt("x", null) is null.
+// Surrounding whitespace in strings is ignored.
+
+// converter describes a conversion builtin. params counts the arguments
+// before the optional default, of which required must be given; target
+// names the result type in errors. convert reports a value it cannot
+// convert with ok false.
+type converter struct {
+	name, sig, doc string
+	params         int
+	required       int
+	target         string
+	convert        func(args []Value) (result Value, ok bool, err error)
+}
+
+// registerNumberBuiltins adds toInt(), toFloat(), parseInt(), parseFloat(),
+// isNaN() and isFinite().
+func (i *Interpreter) registerNumberBuiltins() {
+	for _, c := range []converter{
+		{"toInt", "toInt(value, default?)", "Convert an int, float (truncated) or decimal string to an int.", 1, 1, "an int", toInt},
+		{"toFloat", "toFloat(value, default?)", "Convert an int, float or numeric string to a float.", 1, 1, "a float", toFloat},
+		{"parseInt", "parseInt(text, base?, default?)", "Parse text as an integer in base 2-36 (default 10); base 0 reads a 0x, 0o or 0b prefix.", 2, 1, "an int", parseIntArgs},
+		{"parseFloat", "parseFloat(text, default?)", "Parse text as a float, e.g. \"2.5\", \"1e3\" or \"-inf\".", 1, 1, "a float", parseFloatArgs},
+	} {
+		i.global.Define(c.name, &BuiltinVal{
+			Name:      c.name,
+			Signature: c.sig,
+			Doc:       c.doc + " Fails, or returns default when one is given, if the value cannot be converted.",
+			Fn: func(args []Value) (Value, error) {
+				if len(args) < c.required || len(args) > c.params+1 {
+					return nil, fmt.Errorf("%s() expects %d-%d arguments, got %d", c.name, c.required, c.params+1, len(args))
+				}
+				params := args
+				if len(args) > c.params {
+					params = args[:c.params]
+				}
+				result, ok, err := c.convert(params)
+				if err != nil {
+					return nil, fmt.Errorf("%s() %v", c.name, err)
+				}
+				if !ok {
+					if len(args) > c.params {
+						return args[c.params], nil
+					}
+					return nil, fmt.Errorf("%s(): cannot convert %s to %s", c.name, describeForConversion(params[0]), c.target)
+				}
+				return result, nil
+			},
+		}, true)
+	}
+
+	for _, name := range []string{"isNaN", "isFinite"} {
+		i.global.Define(name, &BuiltinVal{
+			Name:      name,
+			Signature: name + "(x)",
+			Doc:       map[string]string{"isNaN": "Report whether x is the float NaN.", "isFinite": "Report whether x is a number other than NaN or an infinity."}[name],
+			Fn: func(args []Value) (Value, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("%s() expects 1 argument, got %d", name, len(args))
+				}
+				f, ok := ToFloat64(args[0])
+				if !ok {
+					return nil, fmt.Errorf("%s() expects a number, got '%s'", name, args[0].TypeName())
+				}
+				if name == "isNaN" {
+					return BoolVal(math.IsNaN(f)), nil
+				}
+				return BoolVal(!math.IsNaN(f) && !math.IsInf(f, 0)), nil
+			},
+		}, true)
+	}
+}
+
+func toInt(args []Value) (Value, bool, error) {
+	switch v := args[0].(type) {
+	case IntVal:
+		return v, true, nil
+	case FloatVal:
+		if f := math.Trunc(float64(v)); f >= -(1<<63) && f < 1<<63 {
+			return IntVal(int64(f)), true, nil
+		}
+	case StringVal:
+		if n, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64); err == nil {
+			return IntVal(n), true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func toFloat(args []Value) (Value, bool, error) {
+	switch v := args[0].(type) {
+	case IntVal:
+		return FloatVal(float64(v)), true, nil
+	case FloatVal:
+		return v, true, nil
+	case StringVal:
+		return parseFloatArgs(args)
+	}
+	return nil, false, nil
+}
+
+func parseIntArgs(args []Value) (Value, bool, error) {
+	text, ok := args[0].(StringVal)
+	if !ok {
+		return nil, false, fmt.Errorf("text must be a string, got '%s'", args[0].TypeName())
+	}
+	base := IntVal(10)
+	if len(args) > 1 {
+		if base, ok = args[1].(IntVal); !ok || base == 1 || base < 0 || base > 36 {
+			return nil, false, fmt.Errorf("base must be 0 or an integer from 2 to 36, got %s", args[1])
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(text)), int(base), 64)
+	if err != nil {
+		return nil, false, nil
+	}
+	return IntVal(n), true, nil
+}
+
+func parseFloatArgs(args []Value) (Value, bool, error) {
+	text, ok := args[0].(StringVal)
+	if !ok {
+		return nil, false, fmt.Errorf("text must be a string, got '%s'", args[0].TypeName())
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(string(text)), 64)
+	if err != nil && !isRangeErr(err) {
+		return nil, false, nil
+	}
+	return FloatVal(f), true, nil
+}
+
+// isRangeErr reports whether err is strconv's out-of-range error, which
+// ParseFloat returns along with an infinity or zero.
+func isRangeErr(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+// describeForConversion names v in a failed conversion message: strings
+// are quoted, other values are shown with their type.
+func describeForConversion(v Value) string {
+	if s, ok := v.(StringVal); ok {
+		return strconv.Quote(string(s))
+	}
+	return fmt.Sprintf("%s '%s'", v.TypeName(), v)
+}
+
+// ============================================================
+// Number formatting
+// ============================================================
+
+// formatFloat returns f with the fewest digits that read back as f, in
+// decimal notation from 1e-6 up to 1e21 and in exponent notation outside,
+// like 0.1, 1234567.5 and 1e+21.
+func formatFloat(f float64) string {
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) || math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// maxDigits bounds the digits toFixed() and toPrecision() accept.
+const maxDigits = 100
+
+func (i *Interpreter) callNumberMethod(n Value, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "toFixed", "toPrecision":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "%s() expects 1 argument, got %d", name, len(args))
+		}
+		digits, ok := args[0].(IntVal)
+		low := IntVal(0)
+		if name == "toPrecision" {
+			low = 1
+		}
+		if !ok || digits < low || digits > maxDigits {
+			return nil, runtimeErr(s, "%s() digits must be an integer from %d to %d, got %s", name, low, maxDigits, args[0])
+		}
+		if name == "toFixed" {
+			return StringVal(toFixed(n, int(digits))), nil
+		}
+		return StringVal(toPrecision(n, int(digits))), nil
+
+	case "toString":
+		if len(args) == 0 {
+			return StringVal(n.String()), nil
+		}
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "toString() expects 0-1 arguments, got %d", len(args))
+		}
+		base, ok := args[0].(IntVal)
+		if !ok || base < 2 || base > 36 {
+			return nil, runtimeErr(s, "toString() base must be an integer from 2 to 36, got %s", args[0])
+		}
+		if base == 10 {
+			return StringVal(n.String()), nil
+		}
+		switch v := n.(type) {
+		case IntVal:
+			return StringVal(strconv.FormatInt(int64(v), int(base))), nil
+		case FloatVal:
+			if f := float64(v); f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+				return StringVal(strconv.FormatInt(int64(f), int(base))), nil
+			}
+			return nil, runtimeErr(s, "toString() can only write whole numbers in base %d, got %s", base, v)
+		}
+	}
+	return nil, runtimeErr(s, "%s has no method '%s'", n.TypeName(), name)
+}
+
+// toFixed writes n with digits digits after the decimal point. A value
+// halfway between two results rounds away from zero, so (2.5).toFixed(0)
+// is "3".
+func toFixed(n Value, digits int) string {
+	if f, ok := n.(FloatVal); ok && (math.IsInf(float64(f), 0) || math.IsNaN(float64(f))) {
+		return f.String()
+	}
+	all, point := decimalDigits(n)
+	rounded, grew := roundDigits(all, point+digits)
+	if grew {
+		point++
+	}
+	str := rounded[:point]
+	if digits > 0 {
+		str += "." + rounded[point:]
+	}
+	return sign(n) + str
+}
+
+// toPrecision writes n rounded to digits significant digits, in exponent
+// notation when the exponent is below -6 or not below digits.
+func toPrecision(n Value, digits int) string {
+	if f, ok := n.(FloatVal); ok && (math.IsInf(float64(f), 0) || math.IsNaN(float64(f))) {
+		return f.String()
+	}
+	all, point := decimalDigits(n)
+	lead := strings.IndexFunc(all, func(r rune) bool { return r != '0' })
+	if lead < 0 {
+		return toFixed(n, digits-1) // zero
+	}
+	exp := point - lead - 1
+	rounded, grew := roundDigits(all[lead:], digits)
+	if grew {
+		exp++
+		rounded = rounded[:digits]
+	}
+	mantissa := rounded[:1]
+	if digits > 1 {
+		mantissa += "." + rounded[1:]
+	}
+	switch {
+	case exp < -6 || exp >= digits:
+		return sign(n) + mantissa + fmt.Sprintf("e%+03d", exp)
+	case exp < 0:
+		return sign(n) + "0." + strings.Repeat("0", -exp-1) + rounded
+	case exp+1 < digits:
+		return sign(n) + rounded[:exp+1] + "." + rounded[exp+1:]
+	}
+	return sign(n) + rounded
+}
+
+// decimalDigits returns the exact decimal digits of the magnitude of the
+// number n, with the decimal point after the first point of them.
+func decimalDigits(n Value) (digits string, point int) {
+	if v, ok := n.(IntVal); ok {
+		u := uint64(v)
+		if v < 0 {
+			u = -u
+		}
+		digits = strconv.FormatUint(u, 10)
+		return digits, len(digits)
+	}
+	// Every float64 has an exact expansion with at most 1074 decimals
+	exact := new(big.Float).SetFloat64(math.Abs(float64(n.(FloatVal)))).Text('f', 1100)
+	intPart, frac, _ := strings.Cut(exact, ".")
+	return intPart + strings.TrimRight(frac, "0"), len(intPart)
+}
+
+// roundDigits returns the first n of digits, rounded half up by the digits
+// after them and padded with zeros. grew reports that rounding carried
+// into a new leading digit, making the result n+1 digits long.
+func roundDigits(digits string, n int) (rounded string, grew bool) {
+	if n >= len(digits) {
+		return digits + strings.Repeat("0", n-len(digits)), false
+	}
+	kept := []byte(digits[:n])
+	if digits[n] >= '5' {
+		idx := n - 1
+		for ; idx >= 0 && kept[idx] == '9'; idx-- {
+			kept[idx] = '0'
+		}
+		if idx < 0 {
+			return "1" + string(kept), true
+		}
+		kept[idx]++
+	}
+	return string(kept), false
+}
+
+// sign returns "-" for a negative number.
+func sign(n Value) string {
+	if f, _ := ToFloat64(n); f < 0 {
+		return "-"
+	}
+	return ""
+}
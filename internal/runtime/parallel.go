@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"light-lang/internal/span"
+	goruntime "runtime"
+	"sync"
+)
+
+// ============================================================
+// Parallel evaluation
+// ============================================================
+
+// lockedWriter serializes writes so output from concurrent workers does not interleave mid-line.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// registerParallelBuiltins adds parallelMap, which needs access to the interpreter.
+func (i *Interpreter) registerParallelBuiltins() {
+	i.global.Define("parallelMap", &BuiltinVal{
+		Name:      "parallelMap",
+		Signature: "parallelMap(array, fn, workers?)",
+		Doc:       "Map fn over array on parallel isolated workers.",
+		Fn:        i.parallelMap,
+	}, true)
+}
+
+// parallelMap implements parallelMap(arr, fn, workers).
+//
+// Each worker runs in its own sub-interpreter holding a deep copy of the
+// callback (including everything its closure can reach) and of the input
+// elements, so callbacks never share mutable state: assignments to captured
+// variables are local to the worker and are not visible afterwards.
+// Results are collected in input order; the first failing element's error is returned.
+func (i *Interpreter) parallelMap(args []Value) (Value, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("parallelMap() expects 2-3 arguments, got %d", len(args))
+	}
+	arr, ok := args[0].(*ArrayVal)
+	if !ok {
+		return nil, fmt.Errorf("parallelMap() first argument must be an array, got '%s'", args[0].TypeName())
+	}
+	switch args[1].(type) {
+	case *FuncVal, *BuiltinVal, Callable:
+	default:
+		return nil, fmt.Errorf("parallelMap() second argument must be a function, got '%s'", args[1].TypeName())
+	}
+	workers := goruntime.NumCPU()
+	if len(args) == 3 {
+		n, ok := args[2].(IntVal)
+		if !ok || n < 1 {
+			return nil, fmt.Errorf("parallelMap() worker count must be a positive integer")
+		}
+		workers = int(n)
+	}
+	if workers > len(arr.Elements) {
+		workers = len(arr.Elements)
+	}
+
+	results := make([]Value, len(arr.Elements))
+	errs := make([]error, len(arr.Elements))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		// Copy on the calling goroutine: the originals must not be read concurrently
+		sub := i.worker()
+		c := newCopier(sub)
+		fn := c.copyValue(args[1])
+		items := c.copyValue(arr).(*ArrayVal).Elements
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx], errs[idx] = sub.drain(sub.callValue(fn, []Value{items[idx]}, span.Span{}))
+			}
+		}()
+	}
+	for idx := range arr.Elements {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ArrayVal{Elements: results}, nil
+}
+
+// fork returns a sub-interpreter that shares output with i but has its own
+// execution state, for running callbacks on another goroutine. Values
+// copied for it with newCopier(sub) get builtins that call back into sub
+// instead of i (see perInterp).
+func (i *Interpreter) fork() *Interpreter {
+	return &Interpreter{
+		global:         i.global,
+		env:            i.global,
+		output:         i.output,
+		dir:            i.dir,
+		projectDir:     i.projectDir,
+		modules:        &moduleCache{byPath: make(map[string]*module)},
+		imported:       make(map[string]bool),
+		fsys:           i.fsys,
+		ffiAllowed:     i.ffiAllowed,
+		fsDisabled:     i.fsDisabled,
+		args:           i.args,
+		strictIndex:    i.strictIndex,
+		strictEquality: i.strictEquality,
+		strict:         i.strict,
+		limits:         i.limits,
+		deadline:       i.deadline,
+		heapValues:     i.heapValues,
+		interrupt:      i.interrupt,
+		loop:           i.loop,
+		res:            i.res,
+	}
+}
+
+// worker returns a fork for a call that runs alongside i, as in
+// parallelMap and spawn. It gets an event loop of its own, since i's runs
+// on i's goroutine; a generator's fork takes turns with i and shares it.
+func (i *Interpreter) worker() *Interpreter {
+	sub := i.fork()
+	sub.loop = newEventLoop()
+	return sub
+}
+
+// drain finishes a call made on a worker by running the worker's event
+// loop, so timers and promises the call started settle before its result
+// is used.
+func (i *Interpreter) drain(val Value, err error) (Value, error) {
+	if err == nil {
+		err = i.RunEventLoop()
+	}
+	return val, err
+}
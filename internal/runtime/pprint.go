@@ -0,0 +1,249 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Value formatting (String and pprint)
+// ============================================================
+
+// pprintWidth is the line width pprint tries to stay within: a collection
+// whose one-line form fits on the current line is printed inline.
+const pprintWidth = 80
+
+// formatCompact renders v on one line the way String() does. Collections
+// and records already being printed further up (seen) are shown as [...],
+// {...} or Name(...), so self-referencing values terminate.
+func formatCompact(v Value, seen map[Value]bool) string {
+	switch val := v.(type) {
+	case *ArrayVal:
+		if seen[val] {
+			return "[...]"
+		}
+		seen[val] = true
+		defer delete(seen, val)
+		parts := make([]string, len(val.Elements))
+		for idx, elem := range val.Elements {
+			parts[idx] = formatElement(elem, seen)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *MapVal:
+		if seen[val] {
+			return "{...}"
+		}
+		seen[val] = true
+		defer delete(seen, val)
+		parts := make([]string, len(val.Keys))
+		for idx, k := range val.Keys {
+			parts[idx] = fmt.Sprintf("\"%s\": %s", k, formatElement(val.Values[k], seen))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *SetVal:
+		if seen[val] {
+			return "set(...)"
+		}
+		seen[val] = true
+		defer delete(seen, val)
+		parts := make([]string, len(val.Items))
+		for idx, item := range val.Items {
+			parts[idx] = formatElement(item, seen)
+		}
+		return "set([" + strings.Join(parts, ", ") + "])"
+	case *ObjectVal:
+		if !val.Class.Decl.Record {
+			return v.String()
+		}
+		if s, ok := val.userString(); ok {
+			return s
+		}
+		name := val.Class.Decl.Name
+		if seen[val] {
+			return name + "(...)"
+		}
+		seen[val] = true
+		defer delete(seen, val)
+		parts := make([]string, len(val.Class.Decl.Fields))
+		for idx, field := range val.Class.Decl.Fields {
+			parts[idx] = field + ": " + formatElement(val.Props[field], seen)
+		}
+		return name + "(" + strings.Join(parts, ", ") + ")"
+	default:
+		return v.String()
+	}
+}
+
+// formatElement renders a value nested inside a collection, quoting strings.
+func formatElement(v Value, seen map[Value]bool) string {
+	if s, ok := v.(StringVal); ok {
+		return fmt.Sprintf("\"%s\"", string(s))
+	}
+	return formatCompact(v, seen)
+}
+
+// prettyPrinter renders values across several lines with indentation.
+type prettyPrinter struct {
+	indent string
+	seen   map[Value]bool
+	b      strings.Builder
+}
+
+// PrettyString renders v with nested arrays, maps and objects indented by
+// indent spaces per level. Collections that fit on one line stay inline and
+// self-references are shown as [...], {...} or <cycle Name>.
+func PrettyString(v Value, indent int) string {
+	pp := &prettyPrinter{indent: strings.Repeat(" ", indent), seen: make(map[Value]bool)}
+	pp.write(v, 0)
+	return pp.b.String()
+}
+
+// write renders v at the given nesting depth; the current line already holds
+// the indentation for that depth.
+func (pp *prettyPrinter) write(v Value, depth int) {
+	if pp.seen[v] {
+		pp.b.WriteString(pp.cycleMarker(v))
+		return
+	}
+	switch val := v.(type) {
+	case *ArrayVal:
+		if pp.fits(val, depth) {
+			break
+		}
+		pp.seen[val] = true
+		defer delete(pp.seen, val)
+		pp.b.WriteString("[\n")
+		for idx, elem := range val.Elements {
+			pp.writeIndent(depth + 1)
+			pp.writeElement(elem, depth+1)
+			pp.writeSep(idx, len(val.Elements))
+		}
+		pp.writeIndent(depth)
+		pp.b.WriteString("]")
+		return
+	case *MapVal:
+		if pp.fits(val, depth) {
+			break
+		}
+		pp.seen[val] = true
+		defer delete(pp.seen, val)
+		pp.b.WriteString("{\n")
+		for idx, k := range val.Keys {
+			pp.writeIndent(depth + 1)
+			fmt.Fprintf(&pp.b, "\"%s\": ", k)
+			pp.writeElement(val.Values[k], depth+1)
+			pp.writeSep(idx, len(val.Keys))
+		}
+		pp.writeIndent(depth)
+		pp.b.WriteString("}")
+		return
+	case *ObjectVal:
+		if val.Class.Decl.Record && pp.fits(val, depth) {
+			break
+		}
+		pp.seen[val] = true
+		defer delete(pp.seen, val)
+		if len(val.Props) == 0 {
+			fmt.Fprintf(&pp.b, "%s {}", val.Class.Decl.Name)
+			return
+		}
+		names := make([]string, 0, len(val.Props))
+		for name := range val.Props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&pp.b, "%s {\n", val.Class.Decl.Name)
+		for idx, name := range names {
+			pp.writeIndent(depth + 1)
+			pp.b.WriteString(name + ": ")
+			pp.writeElement(val.Props[name], depth+1)
+			pp.writeSep(idx, len(names))
+		}
+		pp.writeIndent(depth)
+		pp.b.WriteString("}")
+		return
+	}
+	pp.b.WriteString(formatCompact(v, pp.seen))
+}
+
+// writeElement renders a value nested inside a collection, quoting strings.
+func (pp *prettyPrinter) writeElement(v Value, depth int) {
+	if s, ok := v.(StringVal); ok {
+		fmt.Fprintf(&pp.b, "\"%s\"", string(s))
+		return
+	}
+	pp.write(v, depth)
+}
+
+// fits reports whether a collection can be printed inline at depth. Values
+// containing cycles or objects other than records are always expanded.
+func (pp *prettyPrinter) fits(v Value, depth int) bool {
+	if !pp.inlineable(v, make(map[Value]bool)) {
+		return false
+	}
+	return len(pp.indent)*depth+len(formatCompact(v, pp.seen)) <= pprintWidth
+}
+
+func (pp *prettyPrinter) inlineable(v Value, visiting map[Value]bool) bool {
+	switch val := v.(type) {
+	case *ArrayVal:
+		if visiting[val] || pp.seen[val] {
+			return false
+		}
+		visiting[val] = true
+		defer delete(visiting, val)
+		for _, elem := range val.Elements {
+			if !pp.inlineable(elem, visiting) {
+				return false
+			}
+		}
+	case *MapVal:
+		if visiting[val] || pp.seen[val] {
+			return false
+		}
+		visiting[val] = true
+		defer delete(visiting, val)
+		for _, elem := range val.Values {
+			if !pp.inlineable(elem, visiting) {
+				return false
+			}
+		}
+	case *ObjectVal:
+		if !val.Class.Decl.Record || visiting[val] || pp.seen[val] {
+			return false
+		}
+		visiting[val] = true
+		defer delete(visiting, val)
+		for _, field := range val.Class.Decl.Fields {
+			if !pp.inlineable(val.Props[field], visiting) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (pp *prettyPrinter) cycleMarker(v Value) string {
+	switch val := v.(type) {
+	case *ArrayVal:
+		return "[...]"
+	case *MapVal:
+		return "{...}"
+	case *ObjectVal:
+		return fmt.Sprintf("<cycle %s>", val.Class.Decl.Name)
+	default:
+		return v.String()
+	}
+}
+
+func (pp *prettyPrinter) writeIndent(depth int) {
+	pp.b.WriteString(strings.Repeat(pp.indent, depth))
+}
+
+func (pp *prettyPrinter) writeSep(idx, n int) {
+	if idx < n-1 {
+		pp.b.WriteString(",")
+	}
+	pp.b.WriteString("\n")
+}
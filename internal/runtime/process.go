@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+)
+
+// ============================================================
+// Process access (env / setEnv / args / exit / cwd)
+// ============================================================
+
+// ExitError unwinds a script that called exit(). try/catch does not catch
+// it; Run and RunEventLoop return nil for it and ExitCode reports Code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit(%d)", e.Code) }
+
+// SetArgs sets the script arguments returned by args().
+func (i *Interpreter) SetArgs(args []string) {
+	i.args = args
+}
+
+// registerProcessBuiltins adds env(), setEnv(), args(), exit() and cwd().
+func (i *Interpreter) registerProcessBuiltins() {
+	i.global.Define("env", &BuiltinVal{
+		Name:      "env",
+		Signature: "env(name)",
+		Doc:       "Return the environment variable name, or null if it is not set.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("env() expects 1 argument, got %d", len(args))
+			}
+			name, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("env() argument must be a string, got '%s'", args[0].TypeName())
+			}
+			if val, ok := os.LookupEnv(string(name)); ok {
+				return StringVal(val), nil
+			}
+			return NullVal{}, nil
+		},
+	}, true)
+
+	i.global.Define("setEnv", &BuiltinVal{
+		Name:      "setEnv",
+		Signature: "setEnv(name, value)",
+		Doc:       "Set the environment variable name to the string value, or unset it if value is null.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("setEnv() expects 2 arguments, got %d", len(args))
+			}
+			name, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("setEnv() name must be a string, got '%s'", args[0].TypeName())
+			}
+			var err error
+			switch val := args[1].(type) {
+			case StringVal:
+				err = os.Setenv(string(name), string(val))
+			case NullVal:
+				err = os.Unsetenv(string(name))
+			default:
+				return nil, fmt.Errorf("setEnv() value must be a string or null, got '%s'", args[1].TypeName())
+			}
+			if err != nil {
+				return nil, fmt.Errorf("setEnv(): %v", err)
+			}
+			return NullVal{}, nil
+		},
+	}, true)
+
+	i.global.Define("args", &BuiltinVal{
+		Name:      "args",
+		Signature: "args()",
+		Doc:       "Return the script arguments, given after -- in light run script.lt -- a b c.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("args() expects 0 arguments, got %d", len(args))
+			}
+			elements := make([]Value, len(i.args))
+			for idx, arg := range i.args {
+				elements[idx] = StringVal(arg)
+			}
+			return &ArrayVal{Elements: elements}, nil
+		},
+	}, true)
+
+	i.global.Define("exit", &BuiltinVal{
+		Name:      "exit",
+		Signature: "exit(code?)",
+		Doc:       "End the script at once with the integer exit code (default 0); pending timers are dropped.",
+		Fn: func(args []Value) (Value, error) {
+			code := IntVal(0)
+			switch len(args) {
+			case 0:
+			case 1:
+				n, ok := args[0].(IntVal)
+				if !ok {
+					return nil, fmt.Errorf("exit() code must be an integer, got '%s'", args[0].TypeName())
+				}
+				code = n
+			default:
+				return nil, fmt.Errorf("exit() expects 0-1 arguments, got %d", len(args))
+			}
+			i.exited, i.exitCode = true, int(code)
+			return nil, &ExitError{Code: int(code)}
+		},
+	}, true)
+
+	i.global.Define("cwd", &BuiltinVal{
+		Name:      "cwd",
+		Signature: "cwd()",
+		Doc:       "Return the current working directory.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("cwd() expects 0 arguments, got %d", len(args))
+			}
+			dir, err := os.Getwd()
+			if err != nil {
+				return nil, fmt.Errorf("cwd(): %v", err)
+			}
+			return StringVal(dir), nil
+		},
+	}, true)
+}
+
+// exitRequested reports whether err unwinds from exit(), recording the exit
+// code if so.
+func (i *Interpreter) exitRequested(err error) bool {
+	exit, ok := err.(*ExitError)
+	if ok {
+		i.exited, i.exitCode = true, exit.Code
+	}
+	return ok
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Random numbers
+// ============================================================
+
+// randomSource is the generator behind random(), randomInt() and shuffle().
+// Imported modules share their importer's source, so a seeded run draws one
+// reproducible sequence. It is locked because parallel tasks may draw from it.
+type randomSource struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newRandomSource(seed int64) *randomSource {
+	return &randomSource{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (r *randomSource) seed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rng = rand.New(rand.NewSource(seed))
+}
+
+func (r *randomSource) float() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Float64()
+}
+
+// intn returns a number in [0, n).
+func (r *randomSource) intn(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Int63n(n)
+}
+
+// SetSeed makes random(), randomInt() and shuffle() produce the same
+// sequence on every run with the same seed, including in imported modules
+// and workers started afterwards. Without it the generator is seeded from
+// the clock.
+func (i *Interpreter) SetSeed(seed int64) {
+	i.random.seed(seed)
+}
+
+// registerRandomBuiltins adds random(), randomInt() and shuffle(), which
+// draw from the interpreter's seedable generator.
+func (i *Interpreter) registerRandomBuiltins() {
+	i.random = newRandomSource(time.Now().UnixNano())
+
+	i.global.Define("random", &BuiltinVal{
+		Name:      "random",
+		Signature: "random()",
+		Doc:       "Return a random float in [0, 1).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("random() expects 0 arguments, got %d", len(args))
+			}
+			return FloatVal(i.random.float()), nil
+		},
+	}, true)
+
+	i.global.Define("randomInt", &BuiltinVal{
+		Name:      "randomInt",
+		Signature: "randomInt(min, max)",
+		Doc:       "Return a random integer between min and max, inclusive.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("randomInt() expects 2 arguments, got %d", len(args))
+			}
+			lo, ok1 := args[0].(IntVal)
+			hi, ok2 := args[1].(IntVal)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("randomInt() expects integer arguments, got '%s' and '%s'", args[0].TypeName(), args[1].TypeName())
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("randomInt() min %d is greater than max %d", lo, hi)
+			}
+			return lo + IntVal(i.random.intn(int64(hi-lo)+1)), nil
+		},
+	}, true)
+
+	i.global.Define("shuffle", &BuiltinVal{
+		Name:      "shuffle",
+		Signature: "shuffle(array)",
+		Doc:       "Shuffle array in place and return it.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("shuffle() expects 1 argument, got %d", len(args))
+			}
+			arr, ok := args[0].(*ArrayVal)
+			if !ok {
+				return nil, fmt.Errorf("shuffle() expects an array argument, got '%s'", args[0].TypeName())
+			}
+			if err := mutable(arr); err != nil {
+				return nil, err
+			}
+			for idx := len(arr.Elements) - 1; idx > 0; idx-- {
+				j := i.random.intn(int64(idx) + 1)
+				arr.Elements[idx], arr.Elements[j] = arr.Elements[j], arr.Elements[idx]
+			}
+			return arr, nil
+		},
+	}, true)
+}
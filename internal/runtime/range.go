@@ -0,0 +1,110 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"math"
+)
+
+// ============================================================
+// Ranges
+// ============================================================
+
+// RangeVal is the lazy sequence of ints range() returns: Start, then
+// Start+Step, and so on while short of End. for-of counts through it
+// without building an array, so range(1000000) costs no memory; other
+// array methods run on its elements collected with toArray().
+type RangeVal struct {
+	Start, End, Step int64
+}
+
+func (v *RangeVal) TypeName() string { return "range" }
+func (v *RangeVal) String() string {
+	if v.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", v.Start, v.End)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", v.Start, v.End, v.Step)
+}
+
+// Len returns how many ints the range holds, at most math.MaxInt64.
+func (v *RangeVal) Len() int64 {
+	var n uint64
+	switch {
+	case v.Step > 0 && v.Start < v.End:
+		n = (uint64(v.End)-uint64(v.Start)-1)/uint64(v.Step) + 1
+	case v.Step < 0 && v.Start > v.End:
+		n = (uint64(v.Start)-uint64(v.End)-1)/(uint64(-(v.Step+1))+1) + 1
+	}
+	return int64(min(n, math.MaxInt64))
+}
+
+// At returns the int at position idx, which must be below Len.
+func (v *RangeVal) At(idx int64) IntVal {
+	return IntVal(v.Start + idx*v.Step)
+}
+
+// Items returns the ints of the range as a slice.
+func (v *RangeVal) Items() []Value {
+	items := make([]Value, v.Len())
+	for idx := range items {
+		items[idx] = v.At(int64(idx))
+	}
+	return items
+}
+
+// registerRangeBuiltins adds range().
+func (i *Interpreter) registerRangeBuiltins() {
+	i.global.Define("range", &BuiltinVal{
+		Name:      "range",
+		Signature: "range(end) or range(start, end, step?)",
+		Doc:       "Return the ints from start (default 0) up to but not including end, counting by step (default 1, may be negative), produced lazily.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) < 1 || len(args) > 3 {
+				return nil, fmt.Errorf("range() expects 1-3 arguments, got %d", len(args))
+			}
+			bounds := make([]int64, len(args))
+			for idx, arg := range args {
+				n, ok := arg.(IntVal)
+				if !ok {
+					return nil, fmt.Errorf("range() arguments must be integers, got '%s'", arg.TypeName())
+				}
+				bounds[idx] = int64(n)
+			}
+			r := &RangeVal{End: bounds[0], Step: 1}
+			if len(bounds) > 1 {
+				r.Start, r.End = bounds[0], bounds[1]
+			}
+			if len(bounds) > 2 {
+				if bounds[2] == 0 {
+					return nil, fmt.Errorf("range() step must not be zero")
+				}
+				r.Step = bounds[2]
+			}
+			return r, nil
+		},
+	}, true)
+}
+
+// callRangeMethod runs toArray() and includes() on the range itself and
+// any other method as an array method on its elements.
+func (i *Interpreter) callRangeMethod(r *RangeVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "toArray":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "toArray() expects 0 arguments, got %d", len(args))
+		}
+		return &ArrayVal{Elements: r.Items()}, nil
+	case "includes":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "includes() expects 1 argument, got %d", len(args))
+		}
+		n, ok := args[0].(IntVal)
+		if !ok {
+			return BoolVal(false), nil
+		}
+		offset := int64(n) - r.Start
+		return BoolVal(offset%r.Step == 0 && offset/r.Step >= 0 && offset/r.Step < r.Len()), nil
+	default:
+		return i.callArrayMethod(&ArrayVal{Elements: r.Items()}, name, args, s)
+	}
+}
@@ -0,0 +1,395 @@
+package runtime
+
+import (
+	"light-lang/internal/ast"
+)
+
+// ============================================================
+// Variable resolution
+// ============================================================
+//
+// Before a file runs, resolve works out the scopes the interpreter will
+// create for it and gives every name a scope declares a slot. Each
+// identifier gets a slotRef: how many environments up its binding lives and
+// in which slot. Blocks that declare nothing get no environment at all.
+//
+// A slotRef is a shortcut, not the rule. Reading one checks that every
+// environment on the way was made for the scope the resolver expected and
+// that none gained a name its scope does not declare, and that the slot is
+// already defined. When any check fails the lookup falls back to searching
+// by name, so code the resolver does not model, such as class bodies, runs
+// exactly as before, only without the shortcut.
+
+// scope is the layout of the environments created for one block, function
+// or loop header: names[k] is the name in slot k.
+type scope struct {
+	names  []string
+	index  map[string]int // slot by name, for scopes with many names
+	parent *scope         // nil for the top level and for code not modeled
+	res    *resolution
+
+	// captured is set on the header scope of a for loop that declares
+	// variables and creates closures, which must see each iteration's own
+	// copy of them.
+	captured bool
+}
+
+// slot returns the slot of name in sc, or -1.
+func (sc *scope) slot(name string) int {
+	if sc.index != nil {
+		if k, ok := sc.index[name]; ok {
+			return k
+		}
+		return -1
+	}
+	for k, n := range sc.names {
+		if n == name {
+			return k
+		}
+	}
+	return -1
+}
+
+// slotRef locates the binding an identifier refers to.
+type slotRef struct {
+	from  *scope // scope the identifier appears in
+	depth int    // environments to walk up from there
+	slot  int    // slot in that environment, or -1 to look the name up from it
+}
+
+// resolution holds what resolve found for one file.
+type resolution struct {
+	// scopes maps a block, or the header of a for loop, to its layout. A
+	// block mapped to nil declares nothing and runs in the enclosing
+	// environment.
+	scopes map[ast.Node]*scope
+	refs   map[*ast.IdentExpr]slotRef
+}
+
+// resolve computes the resolution of file.
+func resolve(file *ast.File) *resolution {
+	r := &resolver{res: &resolution{
+		scopes: make(map[ast.Node]*scope),
+		refs:   make(map[*ast.IdentExpr]slotRef),
+	}}
+	r.stmts(file.Body)
+	return r.res
+}
+
+type resolver struct {
+	res *resolution
+	cur *scope
+}
+
+// enter makes a scope declaring names under the current one, records it
+// for key and makes it current. It returns the scope to go back to.
+func (r *resolver) enter(key ast.Node, names []string) (outer *scope) {
+	sc := &scope{names: names, parent: r.cur, res: r.res}
+	if len(names) > indexAfter {
+		sc.index = make(map[string]int, len(names))
+		for k := len(names) - 1; k >= 0; k-- {
+			sc.index[names[k]] = k
+		}
+	}
+	r.res.scopes[key] = sc
+	outer, r.cur = r.cur, sc
+	return outer
+}
+
+// block resolves a block run in an environment of its own, whose header
+// binds names.
+func (r *resolver) block(b *ast.BlockStmt, names ...string) {
+	if b == nil {
+		return
+	}
+	decls, closed := declared(b.Stmts)
+	if len(names) == 0 && len(decls) == 0 && closed {
+		r.res.scopes[b] = nil
+		r.stmts(b.Stmts)
+		return
+	}
+	outer := r.enter(b, append(names, decls...))
+	r.stmts(b.Stmts)
+	r.cur = outer
+}
+
+// declared returns the names stmts declare directly. closed reports that
+// they cannot define any other name, as a module import can.
+func declared(stmts []ast.Node) (names []string, closed bool) {
+	closed = true
+	for _, node := range stmts {
+		switch s := node.(type) {
+		case *ast.VarDeclStmt:
+			if s.Names != nil {
+				names = append(names, s.Names...)
+			} else {
+				names = append(names, s.Name)
+			}
+		case *ast.FuncDecl:
+			names = append(names, s.Name)
+		case *ast.ClassDecl:
+			names = append(names, s.Name)
+		case *ast.EnumDecl:
+			names = append(names, s.Name)
+		case *ast.InterfaceDecl:
+			names = append(names, s.Name)
+		case *ast.ExprStmt, *ast.AssignStmt, *ast.ReturnStmt, *ast.BreakStmt,
+			*ast.ContinueStmt, *ast.BlockStmt, *ast.IfStmt, *ast.WhileStmt,
+			*ast.ForStmt, *ast.ForOfStmt, *ast.TryStmt, *ast.ThrowStmt,
+			*ast.MatchStmt:
+		default:
+			closed = false
+		}
+	}
+	return names, closed
+}
+
+func (r *resolver) stmts(stmts []ast.Node) {
+	for _, node := range stmts {
+		r.node(node)
+	}
+}
+
+// node resolves n in the current scope.
+func (r *resolver) node(n ast.Node) {
+	ast.Walk(n, r.visit)
+}
+
+func (r *resolver) visit(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.IdentExpr:
+		r.ident(n)
+	case *ast.BlockStmt:
+		r.block(n)
+	case *ast.FuncDecl:
+		r.function(n.Body, n.Params)
+	case *ast.FuncExpr:
+		r.function(n.Body, n.Params)
+	case *ast.IfStmt:
+		r.node(n.Condition)
+		r.block(n.Body)
+		for _, elseIf := range n.ElseIfs {
+			r.node(elseIf.Condition)
+			r.block(elseIf.Body)
+		}
+		r.block(n.ElseBody)
+	case *ast.WhileStmt:
+		r.node(n.Condition)
+		r.block(n.Body)
+	case *ast.ForStmt:
+		var names []string
+		if decl, ok := n.Init.(*ast.VarDeclStmt); ok {
+			names, _ = declared([]ast.Node{decl})
+		}
+		outer := r.enter(n, names)
+		r.cur.captured = len(names) > 0 && createsClosures(n)
+		r.node(n.Init)
+		r.node(n.Condition)
+		r.node(n.Update)
+		r.block(n.Body)
+		r.cur = outer
+	case *ast.ForOfStmt:
+		r.node(n.Iterable)
+		names := []string{n.VarName}
+		switch {
+		case n.Pattern != nil:
+			names = ast.PatternNames(n.Pattern)
+		case n.KeyName != "":
+			names = []string{n.KeyName, n.VarName}
+		}
+		r.scoped(n.Body, names)
+	case *ast.TryStmt:
+		r.block(n.Body)
+		if n.CatchParam != "" {
+			r.scoped(n.CatchBody, []string{n.CatchParam})
+		} else {
+			r.block(n.CatchBody)
+		}
+	case *ast.MatchStmt:
+		r.node(n.Subject)
+		for _, arm := range n.Arms {
+			if arm.BindVar == "" {
+				for _, pattern := range arm.Patterns {
+					r.node(pattern)
+				}
+				r.block(arm.Body)
+				continue
+			}
+			outer := r.enter(arm.Body, r.withDecls(arm.Body, arm.BindVar))
+			r.node(arm.Guard)
+			r.stmts(arm.Body.Stmts)
+			r.cur = outer
+		}
+	case *ast.ClassDecl:
+		r.class(n)
+	default:
+		return true
+	}
+	return false
+}
+
+// createsClosures reports whether n contains code that can keep a
+// reference to the environment it runs in: a function or a class.
+func createsClosures(n ast.Node) bool {
+	found := false
+	ast.Walk(n, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncExpr, *ast.ClassDecl:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// withDecls returns names followed by the names b declares.
+func (r *resolver) withDecls(b *ast.BlockStmt, names ...string) []string {
+	decls, _ := declared(b.Stmts)
+	return append(names, decls...)
+}
+
+// scoped resolves a block that always gets an environment, binding names.
+func (r *resolver) scoped(b *ast.BlockStmt, names []string) {
+	outer := r.enter(b, r.withDecls(b, names...))
+	r.stmts(b.Stmts)
+	r.cur = outer
+}
+
+// function resolves a function body, which runs in one environment with
+// its parameters.
+func (r *resolver) function(body *ast.BlockStmt, params []string) {
+	r.scoped(body, append([]string(nil), params...))
+}
+
+// class resolves the code in a class body. Its methods run in environments
+// the resolver does not model, so their identifiers are looked up by name
+// from there.
+func (r *resolver) class(c *ast.ClassDecl) {
+	outer := r.cur
+	r.cur = nil
+	for _, field := range c.Statics {
+		r.node(field.Value)
+	}
+	for _, field := range c.Props {
+		r.node(field.Value)
+	}
+	if c.Constructor != nil {
+		r.stmts(c.Constructor.Body.Stmts)
+	}
+	for _, group := range [][]*ast.MethodDecl{c.Methods, c.StaticMethods, c.Getters, c.Setters} {
+		for _, m := range group {
+			r.stmts(m.Body.Stmts)
+		}
+	}
+	r.cur = outer
+}
+
+// ident records where id's binding is expected to live.
+func (r *resolver) ident(id *ast.IdentExpr) {
+	ref := slotRef{from: r.cur, slot: -1}
+	for sc := r.cur; sc != nil; sc = sc.parent {
+		if k := sc.slot(id.Name); k >= 0 {
+			ref.slot = k
+			break
+		}
+		ref.depth++
+	}
+	r.res.refs[id] = ref
+}
+
+// ============================================================
+// Using the resolution
+// ============================================================
+
+// scopeOf returns the layout resolve gave node, and whether it gave one.
+func (i *Interpreter) scopeOf(node ast.Node) (*scope, bool) {
+	if i.res == nil {
+		return nil, false
+	}
+	sc, ok := i.res.scopes[node]
+	return sc, ok
+}
+
+// freshIterations reports whether the for loop s must run each iteration
+// in its own copy of the loop variables.
+func (i *Interpreter) freshIterations(s *ast.ForStmt) bool {
+	sc, ok := i.scopeOf(s)
+	return !ok || sc.captured
+}
+
+// blockEnv returns the environment to run b in: the current one when b
+// declares nothing, otherwise a new one below it.
+func (i *Interpreter) blockEnv(b *ast.BlockStmt) *Environment {
+	sc, ok := i.scopeOf(b)
+	if ok && sc == nil {
+		return i.env
+	}
+	return newScopeEnv(i.env, sc)
+}
+
+// scopeEnv returns a new environment below the current one for node, laid
+// out as resolved.
+func (i *Interpreter) scopeEnv(node ast.Node) *Environment {
+	sc, _ := i.scopeOf(node)
+	return newScopeEnv(i.env, sc)
+}
+
+// binding returns the environment and slot holding the variable id refers
+// to from the current environment. ok is false when id was not resolved
+// or its slotRef does not hold here; slot is -1 when the name must be
+// looked up from env.
+func (i *Interpreter) binding(id *ast.IdentExpr) (env *Environment, slot int, ok bool) {
+	if i.res == nil {
+		return nil, 0, false
+	}
+	ref, ok := i.res.refs[id]
+	if !ok {
+		return nil, 0, false
+	}
+	env, sc := i.env, ref.from
+	for d := 0; d < ref.depth; d++ {
+		if env.scope != sc || env.extra {
+			return nil, 0, false
+		}
+		env, sc = env.parent, sc.parent
+	}
+	if env.scope != sc {
+		return nil, 0, false
+	}
+	if ref.slot >= 0 && env.values[ref.slot] == nil {
+		return nil, 0, false // not defined yet: an outer binding may be meant
+	}
+	return env, ref.slot, true
+}
+
+// lookupVar returns the value of the variable id.
+func (i *Interpreter) lookupVar(id *ast.IdentExpr) (Value, bool) {
+	env, slot, ok := i.binding(id)
+	switch {
+	case !ok:
+		return i.env.Get(id.Name)
+	case slot < 0:
+		return env.Get(id.Name)
+	}
+	return env.values[slot], true
+}
+
+// assignVar assigns to the existing variable id.
+func (i *Interpreter) assignVar(id *ast.IdentExpr, val Value) error {
+	env, slot, ok := i.binding(id)
+	switch {
+	case !ok:
+		return i.env.Set(id.Name, val)
+	case slot < 0:
+		return env.Set(id.Name, val)
+	}
+	return env.setSlot(slot, val)
+}
+
+// useResolution makes res the resolution of the code about to run and
+// returns a func restoring the previous one.
+func (i *Interpreter) useResolution(res *resolution) (restore func()) {
+	prev := i.res
+	i.res = res
+	return func() { i.res = prev }
+}
@@ -0,0 +1,164 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"math"
+	"strings"
+)
+
+// ============================================================
+// Sets
+// ============================================================
+
+// SetVal is a collection of distinct values in insertion order, created
+// with set(). Members compare like ==, so 1 and 1.0 are the same member and
+// so are records with equal fields; arrays, maps and objects are members by
+// identity.
+type SetVal struct {
+	Items   []Value
+	members map[any]bool
+	frozen  bool // set by freeze()
+}
+
+func (v *SetVal) TypeName() string { return "set" }
+func (v *SetVal) String() string {
+	return formatCompact(v, make(map[Value]bool))
+}
+
+// NewSet returns a set holding items without duplicates.
+func NewSet(items []Value) *SetVal {
+	s := &SetVal{Items: []Value{}, members: make(map[any]bool, len(items))}
+	for _, item := range items {
+		s.Add(item)
+	}
+	return s
+}
+
+// setKey returns the key v is stored under.
+func setKey(v Value) any {
+	switch val := v.(type) {
+	case FloatVal:
+		if f := float64(val); f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return IntVal(int64(f))
+		}
+	case *ObjectVal:
+		if val.Class.Decl.Record {
+			var b strings.Builder
+			writeValueKey(&b, val, make(map[Value]int))
+			return b.String()
+		}
+	}
+	return v
+}
+
+// Add inserts v, reporting whether it was not already a member.
+func (v *SetVal) Add(item Value) bool {
+	key := setKey(item)
+	if v.members[key] {
+		return false
+	}
+	v.members[key] = true
+	v.Items = append(v.Items, item)
+	return true
+}
+
+// Has reports whether item is a member.
+func (v *SetVal) Has(item Value) bool {
+	return v.members[setKey(item)]
+}
+
+// Delete removes item, reporting whether it was a member.
+func (v *SetVal) Delete(item Value) bool {
+	key := setKey(item)
+	if !v.members[key] {
+		return false
+	}
+	delete(v.members, key)
+	for idx, member := range v.Items {
+		if setKey(member) == key {
+			v.Items = append(v.Items[:idx], v.Items[idx+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// registerSetBuiltins adds set().
+func (i *Interpreter) registerSetBuiltins() {
+	i.global.Define("set", &BuiltinVal{
+		Name:      "set",
+		Signature: "set(items?)",
+		Doc:       "Return a set of the distinct values for-of visits in items, or an empty set.",
+		Fn: func(args []Value) (Value, error) {
+			switch len(args) {
+			case 0:
+				return NewSet(nil), nil
+			case 1:
+				items, _, err := ForOfItems(args[0])
+				if err != nil {
+					return nil, fmt.Errorf("set() argument must be an array, map, string or set, got '%s'", args[0].TypeName())
+				}
+				return NewSet(items), nil
+			default:
+				return nil, fmt.Errorf("set() expects 0-1 arguments, got %d", len(args))
+			}
+		},
+	}, true)
+}
+
+func (i *Interpreter) callSetMethod(set *SetVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "add":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "add() expects 1 argument, got %d", len(args))
+		}
+		set.Add(args[0])
+		return set, nil
+
+	case "has", "delete":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "%s() expects 1 argument, got %d", name, len(args))
+		}
+		if name == "has" {
+			return BoolVal(set.Has(args[0])), nil
+		}
+		return BoolVal(set.Delete(args[0])), nil
+
+	case "size":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "size() expects 0 arguments, got %d", len(args))
+		}
+		return IntVal(len(set.Items)), nil
+
+	case "toArray":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "toArray() expects 0 arguments, got %d", len(args))
+		}
+		return &ArrayVal{Elements: append([]Value{}, set.Items...)}, nil
+
+	case "union", "intersection", "difference":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "%s() expects 1 argument, got %d", name, len(args))
+		}
+		other, ok := args[0].(*SetVal)
+		if !ok {
+			return nil, runtimeErr(s, "%s() argument must be a set, got '%s'", name, args[0].TypeName())
+		}
+		result := NewSet(nil)
+		for _, item := range set.Items {
+			if name == "union" || other.Has(item) == (name == "intersection") {
+				result.Add(item)
+			}
+		}
+		if name == "union" {
+			for _, item := range other.Items {
+				result.Add(item)
+			}
+		}
+		return result, nil
+
+	default:
+		return nil, runtimeErr(s, "set has no method '%s'", name)
+	}
+}
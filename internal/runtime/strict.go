@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/token"
+)
+
+// ============================================================
+// Strict indexing, equality and conversions
+// ============================================================
+
+// strictIndexDirective turns on strict indexing when it is the first
+// statement of a script, like the --strict-index flag.
+const strictIndexDirective = "use strict index"
+
+// strictEqualityDirective turns on strict equality like the
+// --strict-equality flag.
+const strictEqualityDirective = "use strict equality"
+
+// SetStrictIndex makes reading a missing map key or object property a
+// runtime error instead of null, in this script and the modules, workers and
+// parallel tasks it starts. m.get(key, default) still reads optional keys.
+func (i *Interpreter) SetStrictIndex(on bool) {
+	i.strictIndex = on
+}
+
+// strictDirective turns on strict mode like the --strict flag.
+const strictDirective = "use strict"
+
+// SetStrict turns implicit conversions into runtime errors, in this script
+// and the modules, workers and parallel tasks it starts: + joining a string
+// with a non-string, a condition that is not a bool, and comparing an int
+// with a float. Template strings and === still convert and compare freely.
+func (i *Interpreter) SetStrict(on bool) {
+	i.strict = on
+}
+
+// SetStrictEquality makes == and != behave like === and !==, so an int
+// never equals a float, in this script and the modules, workers and
+// parallel tasks it starts.
+func (i *Interpreter) SetStrictEquality(on bool) {
+	i.strictEquality = on
+}
+
+// hasDirective reports whether text is one of the string statements that
+// start file, so several directives can be combined.
+func hasDirective(file *ast.File, text string) bool {
+	for _, node := range file.Body {
+		stmt, ok := node.(*ast.ExprStmt)
+		if !ok {
+			return false
+		}
+		lit, ok := stmt.Expr.(*ast.StringLiteral)
+		if !ok {
+			return false
+		}
+		if lit.Value == text {
+			return true
+		}
+	}
+	return false
+}
+
+// condition evaluates the condition of an if, loop, ternary or match guard,
+// which must be a bool in strict mode.
+func (i *Interpreter) condition(e ast.Expr) (bool, error) {
+	val, err := i.evalExpr(e)
+	if err != nil {
+		return false, err
+	}
+	if b, ok := val.(BoolVal); ok {
+		return bool(b), nil
+	}
+	if i.strict {
+		return false, runtimeErr(e.GetSpan(), "condition must be a bool in strict mode, got '%s'", val.TypeName())
+	}
+	return IsTruthy(val), nil
+}
+
+// strictOperands rejects the implicit conversions strict mode forbids in a
+// binary operation.
+func strictOperands(op token.Kind, left, right Value) error {
+	switch op {
+	case token.PLUS:
+		_, leftIsStr := left.(StringVal)
+		_, rightIsStr := right.(StringVal)
+		if leftIsStr != rightIsStr {
+			return fmt.Errorf("cannot join '%s' and '%s' with '+' in strict mode; convert with toString() or use a template string", left.TypeName(), right.TypeName())
+		}
+	case token.EQ, token.NEQ, token.LT, token.LTE, token.GT, token.GTE:
+		_, leftIsInt := left.(IntVal)
+		_, rightIsInt := right.(IntVal)
+		_, leftIsFloat := left.(FloatVal)
+		_, rightIsFloat := right.(FloatVal)
+		if leftIsInt && rightIsFloat || leftIsFloat && rightIsInt {
+			return fmt.Errorf("cannot compare '%s' and '%s' with '%s' in strict mode", left.TypeName(), right.TypeName(), op)
+		}
+	}
+	return nil
+}
+
+// equalityOp maps == and != to their strict forms in strict equality mode.
+func (i *Interpreter) equalityOp(op token.Kind) token.Kind {
+	if !i.strictEquality {
+		return op
+	}
+	switch op {
+	case token.EQ:
+		return token.STRICT_EQ
+	case token.NEQ:
+		return token.STRICT_NEQ
+	}
+	return op
+}
+
+// requireKey fails in strict mode when obj is a map or object without key.
+func (i *Interpreter) requireKey(obj Value, key string) error {
+	if !i.strictIndex {
+		return nil
+	}
+	switch o := obj.(type) {
+	case *ObjectVal:
+		if _, ok := o.Props[key]; !ok {
+			return fmt.Errorf("object '%s' has no property '%s'", o.Class.Decl.Name, key)
+		}
+	case *MapVal:
+		if _, ok := o.Values[key]; !ok {
+			return fmt.Errorf("map has no key '%s'", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package runtime
+
+import "light-lang/internal/span"
+
+// ============================================================
+// toString() protocol
+// ============================================================
+
+// callToString converts obj with its class's toString() method. ok is false
+// if the class declares none; a method that fails or returns something other
+// than a string is reported in err.
+func (i *Interpreter) callToString(obj *ObjectVal, s span.Span) (str string, ok bool, err error) {
+	method, cls := findMethod(obj.Class, "toString")
+	if method == nil {
+		return "", false, nil
+	}
+	val, err := i.runMethod(obj, cls, method, nil, s)
+	if err != nil {
+		return "", true, err
+	}
+	result, isStr := val.(StringVal)
+	if !isStr {
+		return "", true, runtimeErr(s, "%s.toString() must return a string, got '%s'", obj.Class.Decl.Name, val.TypeName())
+	}
+	return string(result), true, nil
+}
+
+// userString converts obj with its toString() method for String(), on the
+// interpreter that declared its class. ok is false if there is no method or
+// it failed, and obj should be formatted as usual.
+func (obj *ObjectVal) userString() (string, bool) {
+	if obj.Class.interp == nil {
+		return "", false
+	}
+	str, ok, err := obj.Class.interp.callToString(obj, span.Span{})
+	return str, ok && err == nil
+}
+
+// stringOf converts v for template literals, calling toString() on objects
+// that declare it and reporting its errors at s.
+func (i *Interpreter) stringOf(v Value, s span.Span) (string, error) {
+	if obj, isObj := v.(*ObjectVal); isObj {
+		if str, ok, err := i.callToString(obj, s); ok {
+			return str, err
+		}
+	}
+	return v.String(), nil
+}
+
+// stringOperands converts the object side of string + object to a string
+// with its toString() method, so its errors are reported at s rather than
+// hidden by String().
+func (i *Interpreter) stringOperands(left, right Value, s span.Span) (Value, Value, error) {
+	convert := func(v, other Value) (Value, error) {
+		if _, isStr := other.(StringVal); !isStr {
+			return v, nil
+		}
+		if _, isObj := v.(*ObjectVal); !isObj {
+			return v, nil
+		}
+		str, err := i.stringOf(v, s)
+		if err != nil {
+			return nil, err
+		}
+		return StringVal(str), nil
+	}
+	left, err := convert(left, right)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err = convert(right, left)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
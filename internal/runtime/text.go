@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================
+// Unicode text
+// ============================================================
+
+// Strings are stored as UTF-8, but lengths, indexes and slices count
+// characters (Unicode code points), so "héllo"[1] is "é" and its length is
+// 5. Code points are found by scanning from the start of the string.
+
+// runeLen returns the number of characters in s.
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// runeOffset returns the byte offset of character idx of s, or len(s) if s
+// has idx characters or fewer.
+func runeOffset(s string, idx int) int {
+	n := 0
+	for offset := range s {
+		if n == idx {
+			return offset
+		}
+		n++
+	}
+	return len(s)
+}
+
+// runeAt returns character idx of s; idx must be in range.
+func runeAt(s string, idx int) rune {
+	r, _ := utf8.DecodeRuneInString(s[runeOffset(s, idx):])
+	return r
+}
+
+// runeSlice returns characters start up to end of s, both already clamped
+// to 0..runeLen(s) with start <= end.
+func runeSlice(s string, start, end int) string {
+	from := runeOffset(s, start)
+	return s[from : from+runeOffset(s[from:], end-start)]
+}
+
+// runeIndex returns the character index of the first sub in s, or -1.
+func runeIndex(s, sub string) int {
+	offset := strings.Index(s, sub)
+	if offset < 0 {
+		return -1
+	}
+	return runeLen(s[:offset])
+}
+
+// runeLastIndex returns the character index of the last sub in s, or -1.
+func runeLastIndex(s, sub string) int {
+	offset := strings.LastIndex(s, sub)
+	if offset < 0 {
+		return -1
+	}
+	return runeLen(s[:offset])
+}
+
+// padString pads s with repetitions of fill, cut to fit, until it is width
+// characters long; atStart puts the padding before s. Strings already that
+// long, or an empty fill, leave s as it is.
+func padString(s string, width int, fill string, atStart bool) string {
+	missing := width - runeLen(s)
+	if missing <= 0 || fill == "" {
+		return s
+	}
+	n := runeLen(fill)
+	pad := strings.Repeat(fill, missing/n) + runeSlice(fill, 0, missing%n)
+	if atStart {
+		return pad + s
+	}
+	return s + pad
+}
+
+// registerTextBuiltins adds fromCodePoint(), ord() and chr().
+func (i *Interpreter) registerTextBuiltins() {
+	i.global.Define("fromCodePoint", &BuiltinVal{
+		Name:      "fromCodePoint",
+		Signature: "fromCodePoint(codes...)",
+		Doc:       "Return the string made of the given Unicode code points, e.g. fromCodePoint(72, 105) is \"Hi\".",
+		Fn: func(args []Value) (Value, error) {
+			var b strings.Builder
+			for _, arg := range args {
+				code, ok := arg.(IntVal)
+				if !ok {
+					return nil, fmt.Errorf("fromCodePoint() arguments must be integers, got '%s'", arg.TypeName())
+				}
+				if code < 0 || code > utf8.MaxRune || code >= 0xD800 && code <= 0xDFFF {
+					return nil, fmt.Errorf("fromCodePoint(): %d is not a valid code point", code)
+				}
+				b.WriteRune(rune(code))
+			}
+			return StringVal(b.String()), nil
+		},
+	}, true)
+
+	i.global.Define("ord", &BuiltinVal{
+		Name:      "ord",
+		Signature: "ord(ch)",
+		Doc:       "Return the Unicode code point of the one-character string ch, e.g. ord(\"A\") is 65.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("ord() expects 1 argument, got %d", len(args))
+			}
+			ch, ok := args[0].(StringVal)
+			if !ok || runeLen(string(ch)) != 1 {
+				return nil, fmt.Errorf("ord() expects a one-character string, got %s", describeForConversion(args[0]))
+			}
+			return IntVal(runeAt(string(ch), 0)), nil
+		},
+	}, true)
+
+	i.global.Define("chr", &BuiltinVal{
+		Name:      "chr",
+		Signature: "chr(n)",
+		Doc:       "Return the one-character string for the Unicode code point n, e.g. chr(65) is \"A\".",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("chr() expects 1 argument, got %d", len(args))
+			}
+			code, ok := args[0].(IntVal)
+			if !ok {
+				return nil, fmt.Errorf("chr() argument must be an integer, got '%s'", args[0].TypeName())
+			}
+			if code < 0 || code > utf8.MaxRune || code >= 0xD800 && code <= 0xDFFF {
+				return nil, fmt.Errorf("chr(): %d is not a valid code point", code)
+			}
+			return StringVal(string(rune(code))), nil
+		},
+	}, true)
+}
@@ -0,0 +1,146 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/span"
+	"time"
+)
+
+// ============================================================
+// Time and dates (time namespace)
+// ============================================================
+
+// Timestamps are ints counting milliseconds since the Unix epoch. Layouts
+// for time.format and time.parse are Go reference layouts, written as the
+// time 2006-01-02 15:04:05 would appear, e.g. "2006-01-02 15:04". Dates are
+// shown and read in the local time zone unless the layout gives a zone.
+
+// monotonicStart anchors time.monotonic().
+var monotonicStart = time.Now()
+
+// registerTimeBuiltins adds the time namespace.
+func (i *Interpreter) registerTimeBuiltins() {
+	members := map[string]Value{
+		"ISO": StringVal("2006-01-02T15:04:05.000Z07:00"),
+	}
+	define := func(name, sig, doc string, fn BuiltinFn) {
+		members[name] = &BuiltinVal{Name: "time." + name, Signature: "time." + sig, Doc: doc, Fn: fn}
+	}
+
+	define("now", "now()", "Return the current local date as a map of year, month, day, hour, minute, second, millisecond, weekday (0 is Sunday) and unixMillis.", func(args []Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("time.now() expects 0 arguments, got %d", len(args))
+		}
+		return dateMap(time.Now()), nil
+	})
+	define("date", "date(ts)", "Return the local date of timestamp ts as a map like time.now().", func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("time.date() expects 1 argument, got %d", len(args))
+		}
+		t, err := timeArg("time.date", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return dateMap(t), nil
+	})
+	define("unixMillis", "unixMillis()", "Return the current time in milliseconds since the Unix epoch.", func(args []Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("time.unixMillis() expects 0 arguments, got %d", len(args))
+		}
+		return IntVal(time.Now().UnixMilli()), nil
+	})
+	define("monotonic", "monotonic()", "Return milliseconds, as a float, on a clock that never goes back; subtract two readings to time code.", func(args []Value) (Value, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("time.monotonic() expects 0 arguments, got %d", len(args))
+		}
+		return FloatVal(float64(time.Since(monotonicStart).Nanoseconds()) / 1e6), nil
+	})
+	define("sleep", "sleep(ms)", "Block for ms milliseconds; timers do not fire meanwhile.", func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("time.sleep() expects 1 argument, got %d", len(args))
+		}
+		ms, ok := ToFloat64(args[0])
+		if !ok {
+			return nil, fmt.Errorf("time.sleep() expects a number, got '%s'", args[0].TypeName())
+		}
+		d := time.Duration(ms * float64(time.Millisecond))
+		if !i.deadline.IsZero() && time.Now().Add(d).After(i.deadline) {
+			return nil, fmt.Errorf("timeout of %s exceeded", i.limits.Timeout)
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return NullVal{}, nil
+		case <-i.interrupt.Done():
+			return nil, i.interrupted(span.Span{})
+		}
+	})
+	define("format", "format(ts, layout)", "Return timestamp ts (or a date map) written in the Go reference layout, e.g. time.format(ts, \"2006-01-02 15:04\").", func(args []Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("time.format() expects 2 arguments, got %d", len(args))
+		}
+		t, err := timeArg("time.format", args[0])
+		if err != nil {
+			return nil, err
+		}
+		layout, ok := args[1].(StringVal)
+		if !ok {
+			return nil, fmt.Errorf("time.format() layout must be a string, got '%s'", args[1].TypeName())
+		}
+		return StringVal(t.Format(string(layout))), nil
+	})
+	define("parse", "parse(layout, text)", "Return the timestamp of text read with the Go reference layout; text without a zone is local time.", func(args []Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("time.parse() expects 2 arguments, got %d", len(args))
+		}
+		layout, ok1 := args[0].(StringVal)
+		text, ok2 := args[1].(StringVal)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("time.parse() expects string arguments")
+		}
+		t, err := time.ParseInLocation(string(layout), string(text), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("time.parse(): %v", err)
+		}
+		return IntVal(t.UnixMilli()), nil
+	})
+
+	i.defineNamespace("time", "Clock, date formatting and parsing; timestamps are milliseconds since the Unix epoch.", members)
+}
+
+// dateMap describes t as a map of its local calendar fields.
+func dateMap(t time.Time) *MapVal {
+	t = t.Local()
+	m := &MapVal{Values: make(map[string]Value)}
+	for _, field := range []struct {
+		key string
+		val int64
+	}{
+		{"year", int64(t.Year())},
+		{"month", int64(t.Month())},
+		{"day", int64(t.Day())},
+		{"hour", int64(t.Hour())},
+		{"minute", int64(t.Minute())},
+		{"second", int64(t.Second())},
+		{"millisecond", int64(t.Nanosecond() / 1e6)},
+		{"weekday", int64(t.Weekday())},
+		{"unixMillis", t.UnixMilli()},
+	} {
+		m.Keys = append(m.Keys, field.key)
+		m.Values[field.key] = IntVal(field.val)
+	}
+	return m
+}
+
+// timeArg reads a timestamp, or a date map by its unixMillis, for fn.
+func timeArg(fn string, v Value) (time.Time, error) {
+	if m, ok := v.(*MapVal); ok {
+		v = m.Values["unixMillis"]
+	}
+	ms, ok := v.(IntVal)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s() expects a timestamp in milliseconds or a date map", fn)
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
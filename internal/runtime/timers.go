@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"container/heap"
+	"fmt"
+	"light-lang/internal/ast"
+	"light-lang/internal/span"
+	"time"
+)
+
+// ============================================================
+// Timers (setTimeout / setInterval)
+// ============================================================
+
+// timer is a pending callback scheduled by setTimeout or setInterval.
+type timer struct {
+	id       int64
+	due      time.Time
+	interval time.Duration // zero for one-shot timers
+	fn       Value
+	args     []Value
+	seq      int64 // scheduling order, breaks ties between equal due times
+}
+
+// timerQueue is a min-heap of timers ordered by due time, then scheduling order.
+type timerQueue []*timer
+
+func (q timerQueue) Len() int { return len(q) }
+func (q timerQueue) Less(a, b int) bool {
+	if q[a].due.Equal(q[b].due) {
+		return q[a].seq < q[b].seq
+	}
+	return q[a].due.Before(q[b].due)
+}
+func (q timerQueue) Swap(a, b int)       { q[a], q[b] = q[b], q[a] }
+func (q *timerQueue) Push(x interface{}) { *q = append(*q, x.(*timer)) }
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+// registerTimerBuiltins adds the timer functions, which need access to the
+// interpreter. Each interpreter keeps its own timers, so workers get
+// copies that schedule on the worker.
+func (i *Interpreter) registerTimerBuiltins() {
+	i.global.Define("setTimeout", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "setTimeout",
+			Signature: "setTimeout(fn, ms, args...)",
+			Doc:       "Call fn once after ms milliseconds; returns a timer id.",
+			Fn: func(args []Value) (Value, error) {
+				return i.scheduleTimer("setTimeout", args, false)
+			},
+		}
+	}), true)
+
+	i.global.Define("setInterval", perInterp(i, func(i *Interpreter) *BuiltinVal {
+		return &BuiltinVal{
+			Name:      "setInterval",
+			Signature: "setInterval(fn, ms, args...)",
+			Doc:       "Call fn every ms milliseconds; returns a timer id.",
+			Fn: func(args []Value) (Value, error) {
+				return i.scheduleTimer("setInterval", args, true)
+			},
+		}
+	}), true)
+
+	clear := func(name string) func(i *Interpreter) *BuiltinVal {
+		return func(i *Interpreter) *BuiltinVal {
+			return &BuiltinVal{
+				Name:      name,
+				Signature: name + "(id)",
+				Doc:       "Cancel a pending timer by id.",
+				Fn: func(args []Value) (Value, error) {
+					if len(args) != 1 {
+						return nil, fmt.Errorf("%s() expects 1 argument, got %d", name, len(args))
+					}
+					id, ok := args[0].(IntVal)
+					if !ok {
+						return nil, fmt.Errorf("%s() argument must be a timer id, got '%s'", name, args[0].TypeName())
+					}
+					i.cancelTimer(int64(id))
+					return NullVal{}, nil
+				},
+			}
+		}
+	}
+	i.global.Define("clearTimeout", perInterp(i, clear("clearTimeout")), true)
+	i.global.Define("clearInterval", perInterp(i, clear("clearInterval")), true)
+}
+
+// scheduleTimer validates setTimeout/setInterval arguments and queues the timer.
+func (i *Interpreter) scheduleTimer(name string, args []Value, repeat bool) (Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%s() expects at least 1 argument, got %d", name, len(args))
+	}
+	switch args[0].(type) {
+	case *FuncVal, *BuiltinVal, Callable:
+	default:
+		return nil, fmt.Errorf("%s() first argument must be a function, got '%s'", name, args[0].TypeName())
+	}
+	var ms int64
+	if len(args) >= 2 {
+		n, ok := args[1].(IntVal)
+		if !ok {
+			return nil, fmt.Errorf("%s() delay must be an integer number of milliseconds", name)
+		}
+		ms = int64(n)
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	delay := time.Duration(ms) * time.Millisecond
+	if repeat && delay == 0 {
+		// A zero-length interval would starve the loop; clamp like browsers do
+		delay = time.Millisecond
+	}
+
+	i.timerSeq++
+	t := &timer{
+		id:   i.timerSeq,
+		due:  time.Now().Add(delay),
+		fn:   args[0],
+		seq:  i.timerSeq,
+		args: append([]Value(nil), args[min(len(args), 2):]...),
+	}
+	if repeat {
+		t.interval = delay
+	}
+	heap.Push(&i.timers, t)
+	return IntVal(t.id), nil
+}
+
+// cancelTimer removes a pending timer. Unknown ids are ignored.
+func (i *Interpreter) cancelTimer(id int64) {
+	for idx, t := range i.timers {
+		if t.id == id {
+			heap.Remove(&i.timers, idx)
+			return
+		}
+	}
+	if i.firing != nil && i.firing.id == id {
+		// clearInterval from inside its own callback: do not reschedule
+		i.firing.interval = 0
+	}
+}
+
+// PendingTimers reports how many timers are waiting to fire.
+func (i *Interpreter) PendingTimers() int {
+	return len(i.timers)
+}
+
+// RunEventLoop fires pending timers in due order and runs promise jobs
+// and async completions until none remain. Each callback runs to
+// completion before the next one starts. A script that ended with a
+// top-level return or exit() drops its pending timers. A promise that was
+// rejected without anything awaiting it fails the run.
+func (i *Interpreter) RunEventLoop() (err error) {
+	var node ast.Node
+	defer recoverInternal(&node, &err)
+
+	if err := i.runLoop(nil); err != nil {
+		if i.exitRequested(err) {
+			return nil
+		}
+		return err
+	}
+	if i.exited {
+		return nil
+	}
+	return i.loop.unhandledRejection()
+}
+
+// fireTimer calls the callback of t, which is due, and reschedules it if
+// it repeats.
+func (i *Interpreter) fireTimer(t *timer) error {
+	i.firing = t
+	_, err := i.callValue(t.fn, t.args, span.Span{})
+	i.firing = nil
+	if err != nil {
+		return err
+	}
+	if t.interval > 0 {
+		i.timerSeq++
+		t.seq = i.timerSeq
+		t.due = t.due.Add(t.interval)
+		heap.Push(&i.timers, t)
+	}
+	return nil
+}
@@ -25,7 +25,7 @@ func (v IntVal) String() string   { return fmt.Sprintf("%d", int64(v)) }
 type FloatVal float64
 
 func (v FloatVal) TypeName() string { return "float" }
-func (v FloatVal) String() string   { return fmt.Sprintf("%g", float64(v)) }
+func (v FloatVal) String() string   { return formatFloat(float64(v)) }
 
 // StringVal represents a string value.
 type StringVal string
@@ -53,6 +53,13 @@ type FuncVal struct {
 	Params  []string
 	Body    *ast.BlockStmt
 	Closure *Environment
+	Doc     string // doc comment of a declared function
+	Rest    bool   // the last parameter collects the remaining arguments
+
+	Generator bool // calling it returns a generator running Body
+	Async     bool // calling it returns a promise of Body's result
+
+	scope *scope // layout of the environment a call runs in, if resolved
 }
 
 func (v *FuncVal) TypeName() string { return "function" }
@@ -63,20 +70,40 @@ type BuiltinFn func(args []Value) (Value, error)
 
 // BuiltinVal represents a built-in (native) function.
 type BuiltinVal struct {
-	Name string
-	Fn   BuiltinFn
+	Name      string
+	Signature string // how to call it, e.g. "push(array, value)"
+	Doc       string // one-line description shown by doc() and :help
+	Fn        BuiltinFn
+
+	// rebind returns the builtin for the interpreter c copies values for,
+	// when Fn calls back into the interpreter that made it. Nil for
+	// builtins that any interpreter can share.
+	rebind func(c *copier) *BuiltinVal
 }
 
 func (v *BuiltinVal) TypeName() string { return "builtin" }
 func (v *BuiltinVal) String() string   { return fmt.Sprintf("<builtin %s>", v.Name) }
 
+// Callable is a function value the interpreter does not run directly, such
+// as a closure compiled for the bytecode VM or a bound method. Builtins that
+// take callbacks call it like any other function.
+type Callable interface {
+	Value
+	Name() string
+	Params() []string
+	Call(args []Value) (Value, error)
+}
+
 // ---- OOP values ----
 
 // ClassVal represents a class definition stored in the environment.
 type ClassVal struct {
-	Decl  *ast.ClassDecl
-	Env   *Environment // environment where the class was defined
-	Super *ClassVal    // parent class (for extends), may be nil
+	Decl    *ast.ClassDecl
+	Env     *Environment     // environment where the class was defined
+	Super   *ClassVal        // parent class (for extends), may be nil
+	Statics map[string]Value // static fields and methods declared on this class
+	Consts  map[string]bool  // statics that cannot be reassigned: const fields and methods
+	interp  *Interpreter     // runs toString() when an instance is converted with String()
 }
 
 func (v *ClassVal) TypeName() string { return "class" }
@@ -84,12 +111,22 @@ func (v *ClassVal) String() string   { return fmt.Sprintf("<class %s>", v.Decl.N
 
 // ObjectVal represents an instance of a class.
 type ObjectVal struct {
-	Class *ClassVal
-	Props map[string]Value
+	Class  *ClassVal
+	Props  map[string]Value
+	frozen bool // set by freeze()
 }
 
 func (v *ObjectVal) TypeName() string { return "object" }
 func (v *ObjectVal) String() string {
+	if s, ok := v.userString(); ok {
+		return s
+	}
+	if isError(v) {
+		return errorString(v)
+	}
+	if v.Class.Decl.Record {
+		return formatCompact(v, make(map[Value]bool))
+	}
 	return fmt.Sprintf("<object %s>", v.Class.Decl.Name)
 }
 
@@ -98,19 +135,12 @@ func (v *ObjectVal) String() string {
 // ArrayVal represents an array value.
 type ArrayVal struct {
 	Elements []Value
+	frozen   bool // set by freeze()
 }
 
 func (v *ArrayVal) TypeName() string { return "array" }
 func (v *ArrayVal) String() string {
-	parts := make([]string, len(v.Elements))
-	for i, elem := range v.Elements {
-		if s, ok := elem.(StringVal); ok {
-			parts[i] = fmt.Sprintf("\"%s\"", string(s))
-		} else {
-			parts[i] = elem.String()
-		}
-	}
-	return "[" + strings.Join(parts, ", ") + "]"
+	return formatCompact(v, make(map[Value]bool))
 }
 
 // ---- Map value ----
@@ -119,20 +149,12 @@ func (v *ArrayVal) String() string {
 type MapVal struct {
 	Keys   []string
 	Values map[string]Value
+	frozen bool // set by freeze()
 }
 
 func (v *MapVal) TypeName() string { return "map" }
 func (v *MapVal) String() string {
-	parts := make([]string, len(v.Keys))
-	for i, k := range v.Keys {
-		val := v.Values[k]
-		if s, ok := val.(StringVal); ok {
-			parts[i] = fmt.Sprintf("\"%s\": \"%s\"", k, string(s))
-		} else {
-			parts[i] = fmt.Sprintf("\"%s\": %s", k, val.String())
-		}
-	}
-	return "{" + strings.Join(parts, ", ") + "}"
+	return formatCompact(v, make(map[Value]bool))
 }
 
 // ---- Enum values ----
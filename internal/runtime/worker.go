@@ -0,0 +1,181 @@
+package runtime
+
+import (
+	"fmt"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/span"
+	"os"
+)
+
+// ============================================================
+// Worker isolates
+// ============================================================
+
+// workerMailboxSize bounds how many messages may be queued in each direction
+// before send() blocks.
+const workerMailboxSize = 256
+
+// WorkerVal is a handle to a script running in its own interpreter on another
+// goroutine. Values crossing the boundary are deep-copied, so the two sides
+// never share mutable state.
+type WorkerVal struct {
+	Path   string
+	inbox  chan Value // parent -> worker
+	outbox chan Value // worker -> parent
+	done   chan struct{}
+	err    error        // set before done is closed
+	closed bool         // parent closed the inbox
+	interp *Interpreter // runs the worker script
+}
+
+func (v *WorkerVal) TypeName() string { return "worker" }
+func (v *WorkerVal) String() string   { return fmt.Sprintf("<worker %s>", v.Path) }
+
+// registerWorkerBuiltins adds worker(), which needs access to the interpreter.
+func (i *Interpreter) registerWorkerBuiltins() {
+	i.global.Define("worker", &BuiltinVal{
+		Name:      "worker",
+		Signature: "worker(path)",
+		Doc:       "Start the script at path in an isolated worker.",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("worker() expects 1 argument, got %d", len(args))
+			}
+			path, ok := args[0].(StringVal)
+			if !ok {
+				return nil, fmt.Errorf("worker() argument must be a file path, got '%s'", args[0].TypeName())
+			}
+			return i.spawnWorker(string(path))
+		},
+	}, true)
+}
+
+// spawnWorker parses the worker script and starts it on a new goroutine.
+func (i *Interpreter) spawnWorker(path string) (*WorkerVal, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("worker(): cannot read %s: %v", path, err)
+	}
+	tokens, lexDiags := lexer.New(string(source), path).Tokenize()
+	if len(lexDiags) > 0 {
+		return nil, fmt.Errorf("worker(): %s: %s", path, lexDiags[0])
+	}
+	file, parseDiags := parser.New(tokens).ParseFile()
+	if len(parseDiags) > 0 {
+		return nil, fmt.Errorf("worker(): %s: %s", path, parseDiags[0])
+	}
+
+	w := &WorkerVal{
+		Path:   path,
+		inbox:  make(chan Value, workerMailboxSize),
+		outbox: make(chan Value, workerMailboxSize),
+		done:   make(chan struct{}),
+	}
+
+	sub := NewInterpreter(i.output)
+	w.interp = sub
+	sub.SetScriptPath(path)
+	sub.ffiAllowed = i.ffiAllowed
+	sub.fsDisabled = i.fsDisabled
+	sub.args = i.args
+	sub.SetSeed(i.random.intn(1 << 62)) // reproducible when the parent is seeded
+	sub.inheritLimits(i)
+	sub.strictIndex = i.strictIndex
+	sub.strictEquality = i.strictEquality
+	sub.strict = i.strict
+	sub.builtins.Define("send", &BuiltinVal{
+		Name:      "send",
+		Signature: "send(value)",
+		Doc:       "Send a copy of value to the parent (worker scripts only).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("send() expects 1 argument, got %d", len(args))
+			}
+			w.outbox <- newCopier(i).copyValue(args[0])
+			return NullVal{}, nil
+		},
+	}, true)
+	sub.builtins.Define("receive", &BuiltinVal{
+		Name:      "receive",
+		Signature: "receive()",
+		Doc:       "Wait for the next message from the parent; null once closed (worker scripts only).",
+		Fn: func(args []Value) (Value, error) {
+			if len(args) != 0 {
+				return nil, fmt.Errorf("receive() expects 0 arguments, got %d", len(args))
+			}
+			msg, ok := <-w.inbox
+			if !ok {
+				return NullVal{}, nil // parent closed the worker
+			}
+			return msg, nil
+		},
+	}, true)
+
+	go func() {
+		defer close(w.done)
+		defer close(w.outbox)
+		if err := sub.Run(file); err != nil {
+			w.err = err
+			return
+		}
+		w.err = sub.RunEventLoop()
+	}()
+	return w, nil
+}
+
+// callWorkerMethod dispatches methods on a worker handle.
+func (i *Interpreter) callWorkerMethod(w *WorkerVal, name string, args []Value, s span.Span) (Value, error) {
+	switch name {
+	case "send":
+		if len(args) != 1 {
+			return nil, runtimeErr(s, "send() expects 1 argument, got %d", len(args))
+		}
+		if w.closed {
+			return nil, runtimeErr(s, "send() on closed worker")
+		}
+		select {
+		case w.inbox <- newCopier(w.interp).copyValue(args[0]):
+			return NullVal{}, nil
+		case <-w.done:
+			return nil, runtimeErr(s, "send() to finished worker '%s'", w.Path)
+		}
+
+	case "receive":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "receive() expects 0 arguments, got %d", len(args))
+		}
+		msg, ok := <-w.outbox
+		if !ok {
+			// Worker finished and all its messages were consumed
+			if w.err != nil {
+				return nil, runtimeErr(s, "worker '%s' failed: %s", w.Path, w.err)
+			}
+			return NullVal{}, nil
+		}
+		return msg, nil
+
+	case "close":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "close() expects 0 arguments, got %d", len(args))
+		}
+		if !w.closed {
+			w.closed = true
+			close(w.inbox)
+		}
+		return NullVal{}, nil
+
+	case "join":
+		if len(args) != 0 {
+			return nil, runtimeErr(s, "join() expects 0 arguments, got %d", len(args))
+		}
+		<-w.done
+		if w.err != nil {
+			return nil, runtimeErr(s, "worker '%s' failed: %s", w.Path, w.err)
+		}
+		return NullVal{}, nil
+
+	default:
+		return nil, runtimeErr(s, "worker has no method '%s'", name)
+	}
+}
@@ -30,25 +30,45 @@ const (
 	PERCENT // %
 	BANG    // !
 
-	EQ  // ==
-	NEQ // !=
-	LT  // <
-	LTE // <=
-	GT  // >
-	GTE // >=
+	// Bitwise and exponent
+	STAR_STAR // **
+	AMP       // &
+	PIPE      // |
+	CARET     // ^
+	TILDE     // ~
+	SHL       // <<
+	SHR       // >>
+
+	EQ         // ==
+	NEQ        // !=
+	STRICT_EQ  // ===
+	STRICT_NEQ // !==
+	LT         // <
+	LTE        // <=
+	GT         // >
+	GTE        // >=
 
 	AND // &&
 	OR  // ||
 
 	// Compound assignment
-	PLUS_ASSIGN  // +=
-	MINUS_ASSIGN // -=
-	STAR_ASSIGN  // *=
-	SLASH_ASSIGN // /=
+	PLUS_ASSIGN      // +=
+	MINUS_ASSIGN     // -=
+	STAR_ASSIGN      // *=
+	SLASH_ASSIGN     // /=
+	PERCENT_ASSIGN   // %=
+	STAR_STAR_ASSIGN // **=
+	AMP_ASSIGN       // &=
+	PIPE_ASSIGN      // |=
+	CARET_ASSIGN     // ^=
+	SHL_ASSIGN       // <<=
+	SHR_ASSIGN       // >>=
 
 	// Misc operators
-	QUESTION // ?
-	ARROW    // =>
+	QUESTION          // ?
+	QUESTION_DOT      // ?.
+	QUESTION_QUESTION // ??
+	ARROW             // =>
 
 	// Template string tokens
 	TEMPLATE_LITERAL // `text` (no expressions)
@@ -65,6 +85,7 @@ const (
 	RBRACKET  // ]
 	COMMA     // ,
 	DOT       // .
+	ELLIPSIS  // ...
 	SEMICOLON // ;
 	COLON     // :
 
@@ -96,6 +117,15 @@ const (
 	KW_CASE
 	KW_ENUM
 	KW_INTERFACE
+	KW_STATIC
+	KW_IMPORT
+	KW_EXPORT
+	KW_INSTANCEOF
+	KW_YIELD
+	KW_SPAWN
+	KW_ASYNC
+	KW_AWAIT
+	KW_LET
 )
 
 var kindNames = map[Kind]string{
@@ -108,31 +138,49 @@ var kindNames = map[Kind]string{
 	FLOAT:  "FLOAT",
 	STRING: "STRING",
 
-	ASSIGN:  "=",
-	PLUS:    "+",
-	MINUS:   "-",
-	STAR:    "*",
-	SLASH:   "/",
-	PERCENT: "%",
-	BANG:    "!",
-	EQ:      "==",
-	NEQ:     "!=",
-	LT:      "<",
-	LTE:     "<=",
-	GT:      ">",
-	GTE:     ">=",
-	AND:          "&&",
-	OR:           "||",
-	PLUS_ASSIGN:  "+=",
-	MINUS_ASSIGN: "-=",
-	STAR_ASSIGN:  "*=",
-	SLASH_ASSIGN: "/=",
-	QUESTION:         "?",
-	ARROW:            "=>",
-	TEMPLATE_LITERAL: "TEMPLATE_LITERAL",
-	TEMPLATE_HEAD:    "TEMPLATE_HEAD",
-	TEMPLATE_MIDDLE:  "TEMPLATE_MIDDLE",
-	TEMPLATE_TAIL:    "TEMPLATE_TAIL",
+	ASSIGN:            "=",
+	PLUS:              "+",
+	MINUS:             "-",
+	STAR:              "*",
+	SLASH:             "/",
+	PERCENT:           "%",
+	BANG:              "!",
+	STAR_STAR:         "**",
+	AMP:               "&",
+	PIPE:              "|",
+	CARET:             "^",
+	TILDE:             "~",
+	SHL:               "<<",
+	SHR:               ">>",
+	EQ:                "==",
+	NEQ:               "!=",
+	STRICT_EQ:         "===",
+	STRICT_NEQ:        "!==",
+	LT:                "<",
+	LTE:               "<=",
+	GT:                ">",
+	GTE:               ">=",
+	AND:               "&&",
+	OR:                "||",
+	PLUS_ASSIGN:       "+=",
+	MINUS_ASSIGN:      "-=",
+	STAR_ASSIGN:       "*=",
+	SLASH_ASSIGN:      "/=",
+	PERCENT_ASSIGN:    "%=",
+	STAR_STAR_ASSIGN:  "**=",
+	AMP_ASSIGN:        "&=",
+	PIPE_ASSIGN:       "|=",
+	CARET_ASSIGN:      "^=",
+	SHL_ASSIGN:        "<<=",
+	SHR_ASSIGN:        ">>=",
+	QUESTION:          "?",
+	QUESTION_DOT:      "?.",
+	QUESTION_QUESTION: "??",
+	ARROW:             "=>",
+	TEMPLATE_LITERAL:  "TEMPLATE_LITERAL",
+	TEMPLATE_HEAD:     "TEMPLATE_HEAD",
+	TEMPLATE_MIDDLE:   "TEMPLATE_MIDDLE",
+	TEMPLATE_TAIL:     "TEMPLATE_TAIL",
 
 	LPAREN:    "(",
 	RPAREN:    ")",
@@ -142,6 +190,7 @@ var kindNames = map[Kind]string{
 	RBRACKET:  "]",
 	COMMA:     ",",
 	DOT:       ".",
+	ELLIPSIS:  "...",
 	SEMICOLON: ";",
 	COLON:     ":",
 
@@ -172,6 +221,15 @@ var kindNames = map[Kind]string{
 	KW_CASE:        "case",
 	KW_ENUM:        "enum",
 	KW_INTERFACE:   "interface",
+	KW_STATIC:      "static",
+	KW_IMPORT:      "import",
+	KW_EXPORT:      "export",
+	KW_INSTANCEOF:  "instanceof",
+	KW_YIELD:       "yield",
+	KW_SPAWN:       "spawn",
+	KW_ASYNC:       "async",
+	KW_AWAIT:       "await",
+	KW_LET:         "let",
 }
 
 // String returns the human-readable name for a token kind.
@@ -184,7 +242,7 @@ func (k Kind) String() string {
 
 // IsKeyword returns true if the kind is a keyword.
 func (k Kind) IsKeyword() bool {
-	return k >= KW_IF && k <= KW_INTERFACE
+	return k >= KW_IF && k <= KW_LET
 }
 
 // IsLiteral returns true if the kind is a literal (ident/int/float/string).
@@ -220,6 +278,15 @@ var keywords = map[string]Kind{
 	"case":        KW_CASE,
 	"enum":        KW_ENUM,
 	"interface":   KW_INTERFACE,
+	"static":      KW_STATIC,
+	"import":      KW_IMPORT,
+	"export":      KW_EXPORT,
+	"instanceof":  KW_INSTANCEOF,
+	"yield":       KW_YIELD,
+	"spawn":       KW_SPAWN,
+	"async":       KW_ASYNC,
+	"await":       KW_AWAIT,
+	"let":         KW_LET,
 }
 
 // LookupIdent returns the keyword Kind for ident, or IDENT if it is not a keyword.
@@ -235,6 +302,11 @@ type Token struct {
 	Kind   Kind      `json:"kind"`
 	Lexeme string    `json:"lexeme"`
 	Span   span.Span `json:"span"`
+
+	// Comment is set on the NEWLINE ending a line that holds only a //
+	// comment, to the comment text including the slashes. The parser reads
+	// doc comments from it.
+	Comment string `json:"comment,omitempty"`
 }
 
 // String returns a human-readable representation of the token.
@@ -0,0 +1,531 @@
+// Package vm runs bytecode from package compiler on a stack machine. It
+// shares values, operators, methods and builtins with the tree-walking
+// interpreter, so a script behaves the same on either backend.
+package vm
+
+import (
+	"fmt"
+	"light-lang/internal/compiler"
+	"light-lang/internal/runtime"
+	"light-lang/internal/span"
+	"light-lang/internal/token"
+	"strings"
+)
+
+// maxFrames bounds nested calls so runaway recursion fails cleanly.
+const maxFrames = 10000
+
+// Cell holds a variable shared between a function and the closures
+// created in it.
+type Cell struct {
+	Value runtime.Value // nil until the variable is defined
+}
+
+func (c *Cell) TypeName() string { return "cell" }
+func (c *Cell) String() string   { return "<cell>" }
+
+// Closure is a compiled function with the variables it captured. Builtins
+// that take callbacks call it through runtime.Callable.
+type Closure struct {
+	Fn   *compiler.Function
+	Free []*Cell
+	prog *program
+}
+
+func (cl *Closure) TypeName() string { return "function" }
+func (cl *Closure) String() string   { return fmt.Sprintf("<function %s>", cl.Fn.Name) }
+func (cl *Closure) Name() string     { return cl.Fn.Name }
+func (cl *Closure) Params() []string { return cl.Fn.LocalNames[:cl.Fn.NumParams] }
+func (cl *Closure) Variadic() bool   { return cl.Fn.Rest }
+
+// Call runs the closure on a fresh stack, so callbacks may come from
+// builtins, timers or other goroutines.
+func (cl *Closure) Call(args []runtime.Value) (runtime.Value, error) {
+	vm := &VM{prog: cl.prog}
+	vm.stack = append(vm.stack, args...)
+	if !vm.bindArgs(cl.Fn, len(args)) {
+		return nil, &runtime.RuntimeError{Message: arityMessage(cl.Fn, len(args))}
+	}
+	if err := vm.enter(cl, span.Span{}); err != nil {
+		return nil, err
+	}
+	return vm.run()
+}
+
+func arityMessage(fn *compiler.Function, got int) string {
+	if fn.Rest {
+		return fmt.Sprintf("%s() expects at least %d arguments, got %d", fn.Name, fn.NumParams-1, got)
+	}
+	return fmt.Sprintf("%s() expects %d arguments, got %d", fn.Name, fn.NumParams, got)
+}
+
+// bindArgs checks the argc arguments on top of the stack against fn's
+// parameters and replaces those a rest parameter collects with an array of
+// them. It reports false if the count is wrong.
+func (vm *VM) bindArgs(fn *compiler.Function, argc int) bool {
+	if !fn.Rest {
+		return argc == fn.NumParams
+	}
+	fixed := fn.NumParams - 1
+	if argc < fixed {
+		return false
+	}
+	vm.push(&runtime.ArrayVal{Elements: vm.popN(argc - fixed)})
+	return true
+}
+
+// iterator walks the elements of an array or the keys of a map for for-of.
+type iterator struct {
+	items  []runtime.Value // elements, keys of a map or characters of a string
+	values []runtime.Value // the values of a map's keys, nil for an array
+	rng    *runtime.RangeVal
+	pos    int
+}
+
+// more reports whether the iterator has an item at pos.
+func (it *iterator) more() bool {
+	if it.rng != nil {
+		return int64(it.pos) < it.rng.Len()
+	}
+	return it.pos < len(it.items)
+}
+
+// item returns the item at pos; a range is counted through without
+// collecting its ints.
+func (it *iterator) item() runtime.Value {
+	if it.rng != nil {
+		return it.rng.At(int64(it.pos))
+	}
+	return it.items[it.pos]
+}
+
+func (it *iterator) TypeName() string { return "iterator" }
+func (it *iterator) String() string   { return "<iterator>" }
+
+// program is what every VM running the same bytecode shares.
+type program struct {
+	constants []runtime.Value
+	main      *compiler.Function
+	interp    *runtime.Interpreter
+	globals   *runtime.Environment
+}
+
+type frame struct {
+	cl   *Closure
+	ip   int
+	base int // stack index of local slot 0
+}
+
+// VM executes compiled bytecode. Globals and builtins live in the
+// interpreter's environment, so timers and other callbacks the script sets
+// up run with interp.RunEventLoop afterwards.
+type VM struct {
+	prog     *program
+	stack    []runtime.Value
+	frames   []frame
+	exitCode int
+}
+
+// New returns a VM for bc that uses interp's globals, builtins and methods.
+func New(bc *compiler.Bytecode, interp *runtime.Interpreter) *VM {
+	return &VM{prog: &program{
+		constants: bc.Constants,
+		main:      bc.Main,
+		interp:    interp,
+		globals:   interp.Env(),
+	}}
+}
+
+// Run executes the top-level code. An internal failure is returned as a
+// runtime error rather than a panic.
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &runtime.RuntimeError{Message: fmt.Sprintf("internal error: %v", r), Span: vm.span()}
+		}
+	}()
+	if err := vm.enter(&Closure{Fn: vm.prog.main, prog: vm.prog}, span.Span{}); err != nil {
+		return err
+	}
+	_, err = vm.run()
+	if exit, ok := err.(*runtime.ExitError); ok {
+		vm.exitCode = exit.Code
+		return nil
+	}
+	return err
+}
+
+// ExitCode returns the exit code set by a top-level return or exit(), or 0.
+func (vm *VM) ExitCode() int {
+	return vm.exitCode
+}
+
+// enter pushes a frame for cl, whose arguments are on top of the stack.
+// Calls count against the interpreter's step, depth and time limits; the
+// frame of the top-level code is not a call.
+func (vm *VM) enter(cl *Closure, s span.Span) error {
+	if len(vm.frames) >= maxFrames {
+		return &runtime.RuntimeError{Message: "stack overflow", Span: s}
+	}
+	if cl.Fn != vm.prog.main {
+		depth := len(vm.frames)
+		if depth > 0 && vm.frames[0].cl.Fn == vm.prog.main {
+			depth--
+		}
+		if err := vm.prog.interp.CheckCall(depth, s); err != nil {
+			return err
+		}
+		if err := vm.prog.interp.Step(s); err != nil {
+			return err
+		}
+	}
+	base := len(vm.stack) - cl.Fn.NumParams
+	for n := cl.Fn.NumParams; n < cl.Fn.NumLocals; n++ {
+		vm.stack = append(vm.stack, nil)
+	}
+	vm.frames = append(vm.frames, frame{cl: cl, base: base})
+	return nil
+}
+
+// span returns the source span of the instruction being executed.
+func (vm *VM) span() span.Span {
+	if len(vm.frames) == 0 {
+		return span.Span{}
+	}
+	fr := vm.frames[len(vm.frames)-1]
+	return fr.cl.Fn.SpanAt(fr.ip)
+}
+
+func (vm *VM) push(v runtime.Value) { vm.stack = append(vm.stack, v) }
+
+func (vm *VM) pop() runtime.Value {
+	v := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return v
+}
+
+// popN removes the top n values and returns a copy of them, bottom first.
+func (vm *VM) popN(n int) []runtime.Value {
+	vals := append([]runtime.Value(nil), vm.stack[len(vm.stack)-n:]...)
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	return vals
+}
+
+// errorAt returns a runtime error at the source of the instruction at pos.
+func (vm *VM) errorAt(fr *frame, pos int, format string, args ...interface{}) error {
+	return &runtime.RuntimeError{Message: fmt.Sprintf(format, args...), Span: fr.cl.Fn.SpanAt(pos)}
+}
+
+// run executes until the frame that was innermost on entry returns, and
+// returns its result.
+func (vm *VM) run() (runtime.Value, error) {
+	stop := len(vm.frames) - 1
+	for {
+		fr := &vm.frames[len(vm.frames)-1]
+		ins := fr.cl.Fn.Instructions
+		start := fr.ip
+		op := compiler.Opcode(ins[fr.ip])
+		fr.ip++
+		var a, b int
+		width := compiler.Width(op)
+		switch width {
+		case 1:
+			a = int(ins[fr.ip])
+		case 2:
+			a = compiler.ReadUint16(ins[fr.ip:])
+		case 3:
+			a, b = compiler.ReadUint16(ins[fr.ip:]), int(ins[fr.ip+2])
+		}
+		fr.ip += width
+		locals := vm.stack[fr.base:]
+
+		switch op {
+		case compiler.OpConstant:
+			vm.push(vm.prog.constants[a])
+		case compiler.OpNull:
+			vm.push(runtime.NullVal{})
+		case compiler.OpTrue:
+			vm.push(runtime.BoolVal(true))
+		case compiler.OpFalse:
+			vm.push(runtime.BoolVal(false))
+		case compiler.OpPop:
+			vm.pop()
+		case compiler.OpDup:
+			vm.stack = append(vm.stack, vm.stack[len(vm.stack)-a:]...)
+		case compiler.OpRot:
+			top := len(vm.stack) - 1
+			v := vm.stack[top]
+			copy(vm.stack[top-a+1:], vm.stack[top-a:top])
+			vm.stack[top-a] = v
+
+		case compiler.OpBinary:
+			right, left := vm.pop(), vm.pop()
+			val, err := runtime.BinaryOp(token.Kind(a), left, right)
+			if err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+			vm.push(val)
+		case compiler.OpNot:
+			vm.push(runtime.BoolVal(!runtime.IsTruthy(vm.pop())))
+		case compiler.OpNeg:
+			val, err := runtime.Negate(vm.pop())
+			if err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+			vm.push(val)
+		case compiler.OpBitNot:
+			v := vm.pop()
+			n, ok := v.(runtime.IntVal)
+			if !ok {
+				return nil, vm.errorAt(fr, start, "'~' requires an integer operand, got '%s'", v.TypeName())
+			}
+			vm.push(^n)
+
+		case compiler.OpJump:
+			if a < start {
+				// A loop's back-edge: each iteration is a step
+				if err := vm.prog.interp.Step(fr.cl.Fn.SpanAt(start)); err != nil {
+					return nil, err
+				}
+			}
+			fr.ip = a
+		case compiler.OpJumpIfFalse:
+			if !runtime.IsTruthy(vm.pop()) {
+				fr.ip = a
+			}
+		case compiler.OpAndJump:
+			if !runtime.IsTruthy(vm.stack[len(vm.stack)-1]) {
+				fr.ip = a
+			} else {
+				vm.pop()
+			}
+		case compiler.OpOrJump:
+			if runtime.IsTruthy(vm.stack[len(vm.stack)-1]) {
+				fr.ip = a
+			} else {
+				vm.pop()
+			}
+		case compiler.OpNullJump:
+			if _, isNull := vm.stack[len(vm.stack)-1].(runtime.NullVal); !isNull {
+				fr.ip = a
+			} else {
+				vm.pop()
+			}
+
+		case compiler.OpGetGlobal:
+			name := string(vm.prog.constants[a].(runtime.StringVal))
+			val, ok := vm.prog.globals.Get(name)
+			if !ok {
+				return nil, vm.errorAt(fr, start, "undefined variable '%s'", name)
+			}
+			vm.push(val)
+		case compiler.OpSetGlobal:
+			name := string(vm.prog.constants[a].(runtime.StringVal))
+			if err := vm.prog.globals.Set(name, vm.pop()); err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+		case compiler.OpDefineGlobal:
+			name := string(vm.prog.constants[a].(runtime.StringVal))
+			if err := vm.prog.globals.Define(name, vm.pop(), b == 1); err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+		case compiler.OpGetLocal:
+			if locals[a] == nil {
+				return nil, vm.errorAt(fr, start, "undefined variable '%s'", fr.cl.Fn.LocalNames[a])
+			}
+			vm.push(locals[a])
+		case compiler.OpSetLocal:
+			locals[a] = vm.pop()
+		case compiler.OpMakeCell:
+			locals[a] = &Cell{Value: locals[a]}
+		case compiler.OpNewCell:
+			locals[a] = &Cell{}
+		case compiler.OpGetCell:
+			val := locals[a].(*Cell).Value
+			if val == nil {
+				return nil, vm.errorAt(fr, start, "undefined variable '%s'", fr.cl.Fn.LocalNames[a])
+			}
+			vm.push(val)
+		case compiler.OpSetCell:
+			locals[a].(*Cell).Value = vm.pop()
+		case compiler.OpLoadCell:
+			vm.push(locals[a])
+		case compiler.OpGetFree:
+			val := fr.cl.Free[a].Value
+			if val == nil {
+				return nil, vm.errorAt(fr, start, "undefined variable '%s'", fr.cl.Fn.FreeNames[a])
+			}
+			vm.push(val)
+		case compiler.OpSetFree:
+			fr.cl.Free[a].Value = vm.pop()
+		case compiler.OpLoadFree:
+			vm.push(fr.cl.Free[a])
+		case compiler.OpClosure:
+			free := make([]*Cell, b)
+			for idx, v := range vm.popN(b) {
+				free[idx] = v.(*Cell)
+			}
+			vm.push(&Closure{Fn: vm.prog.constants[a].(*compiler.Function), Free: free, prog: vm.prog})
+
+		case compiler.OpCall:
+			callee := vm.pop()
+			if cl, ok := callee.(*Closure); ok {
+				if !vm.bindArgs(cl.Fn, a) {
+					return nil, vm.errorAt(fr, start, "%s", arityMessage(cl.Fn, a))
+				}
+				if err := vm.enter(cl, fr.cl.Fn.SpanAt(start)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			args := vm.popN(a)
+			var val runtime.Value
+			var err error
+			switch fn := callee.(type) {
+			case *runtime.BuiltinVal:
+				val, err = fn.Fn(args)
+				if failed, ok := err.(*runtime.AssertionError); ok {
+					err = vm.prog.interp.ThrowAssertion(failed, fr.cl.Fn.SpanAt(start), nil)
+				}
+			case runtime.Callable:
+				val, err = fn.Call(args)
+			default:
+				return nil, vm.errorAt(fr, start, "cannot call value of type '%s'", callee.TypeName())
+			}
+			if err != nil {
+				return nil, err
+			}
+			vm.push(val)
+		case compiler.OpCallMethod:
+			recv := vm.pop()
+			name := string(vm.prog.constants[a].(runtime.StringVal))
+			val, err := vm.prog.interp.CallMember(recv, name, vm.popN(b))
+			if err != nil {
+				if rerr, ok := err.(*runtime.RuntimeError); ok && rerr.Span == (span.Span{}) {
+					return nil, vm.errorAt(fr, start, "%s", rerr.Message)
+				}
+				return nil, err
+			}
+			vm.push(val)
+		case compiler.OpReturn, compiler.OpReturnNull:
+			var val runtime.Value = runtime.NullVal{}
+			if op == compiler.OpReturn {
+				val = vm.pop()
+			}
+			if fr.cl.Fn == vm.prog.main {
+				switch v := val.(type) {
+				case runtime.NullVal:
+				case runtime.IntVal:
+					vm.exitCode = int(v)
+				default:
+					return nil, vm.errorAt(fr, start, "top-level return value must be an integer exit code, got '%s'", val.TypeName())
+				}
+			}
+			vm.stack = vm.stack[:fr.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == stop {
+				return val, nil
+			}
+			vm.push(val)
+
+		case compiler.OpArray:
+			vm.push(&runtime.ArrayVal{Elements: vm.popN(a)})
+		case compiler.OpMap:
+			pairs := vm.popN(2 * a)
+			m := &runtime.MapVal{Keys: make([]string, 0, a), Values: make(map[string]runtime.Value, a)}
+			for idx := 0; idx < len(pairs); idx += 2 {
+				keyStr, ok := pairs[idx].(runtime.StringVal)
+				if !ok {
+					return nil, vm.errorAt(fr, start, "map key must be a string, got '%s'", pairs[idx].TypeName())
+				}
+				key := string(keyStr)
+				if _, exists := m.Values[key]; !exists {
+					m.Keys = append(m.Keys, key)
+				}
+				m.Values[key] = pairs[idx+1]
+			}
+			vm.push(m)
+		case compiler.OpConcat:
+			var sb strings.Builder
+			for _, v := range vm.popN(a) {
+				sb.WriteString(v.String())
+			}
+			vm.push(runtime.StringVal(sb.String()))
+		case compiler.OpIndex:
+			idx, obj := vm.pop(), vm.pop()
+			val, err := runtime.IndexValue(obj, idx)
+			if err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+			vm.push(val)
+		case compiler.OpSetIndex:
+			idx, obj, val := vm.pop(), vm.pop(), vm.pop()
+			if err := runtime.SetIndex(obj, idx, val); err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+		case compiler.OpGetMember:
+			name := string(vm.prog.constants[a].(runtime.StringVal))
+			val, err := runtime.GetMember(vm.pop(), name)
+			if err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+			vm.push(val)
+		case compiler.OpSetMember:
+			name := string(vm.prog.constants[a].(runtime.StringVal))
+			obj, val := vm.pop(), vm.pop()
+			if err := runtime.SetMember(obj, name, val); err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+		case compiler.OpUnpack:
+			val := vm.pop()
+			arr, ok := val.(*runtime.ArrayVal)
+			if !ok {
+				return nil, vm.errorAt(fr, start, "cannot unpack value of type '%s' into %d variables", val.TypeName(), a)
+			}
+			if len(arr.Elements) != a {
+				return nil, vm.errorAt(fr, start, "cannot unpack %d values into %d variables", len(arr.Elements), a)
+			}
+			for idx := a - 1; idx >= 0; idx-- {
+				vm.push(arr.Elements[idx])
+			}
+
+		case compiler.OpIterStart:
+			if rng, ok := vm.stack[len(vm.stack)-1].(*runtime.RangeVal); ok {
+				vm.stack[len(vm.stack)-1] = &iterator{rng: rng}
+				break
+			}
+			items, values, err := runtime.ForOfItems(vm.pop())
+			if err != nil {
+				return nil, vm.errorAt(fr, start, "%s", err)
+			}
+			vm.push(&iterator{items: items, values: values})
+		case compiler.OpIterNext:
+			it := vm.stack[len(vm.stack)-1].(*iterator)
+			if it.more() {
+				vm.push(it.item())
+				it.pos++
+			} else {
+				vm.pop()
+				fr.ip = a
+			}
+		case compiler.OpIterPair:
+			it := vm.stack[len(vm.stack)-1].(*iterator)
+			switch {
+			case !it.more():
+				vm.pop()
+				fr.ip = a
+			case it.values != nil:
+				vm.push(it.items[it.pos])
+				vm.push(it.values[it.pos])
+				it.pos++
+			default:
+				vm.push(runtime.IntVal(it.pos))
+				vm.push(it.item())
+				it.pos++
+			}
+
+		default:
+			return nil, vm.errorAt(fr, start, "unknown opcode %d", op)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package vm
+
+import (
+	"bytes"
+	"light-lang/internal/compiler"
+	"light-lang/internal/lexer"
+	"light-lang/internal/parser"
+	"light-lang/internal/runtime"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run executes source on the interpreter or, with useVM, on the VM, and
+// returns the output, the error message and the exit code.
+func run(t *testing.T, source string, useVM bool) (string, string, int) {
+	t.Helper()
+	tokens, _ := lexer.New(source, "test.lt").Tokenize()
+	file, diags := parser.New(tokens).ParseFile()
+	if len(diags) > 0 {
+		t.Fatalf("parse errors: %v", diags)
+	}
+	var buf bytes.Buffer
+	interp := runtime.NewInterpreter(&buf)
+	var err error
+	code := 0
+	if useVM {
+		bc, cerr := compiler.Compile(file)
+		if cerr != nil {
+			t.Fatalf("compile error: %v", cerr)
+		}
+		machine := New(bc, interp)
+		err = machine.Run()
+		code = machine.ExitCode()
+	} else {
+		err = interp.Run(file)
+		code = interp.ExitCode()
+	}
+	if err == nil {
+		err = interp.RunEventLoop()
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	return buf.String(), msg, code
+}
+
+// expectSame runs source on both backends and requires the same output,
+// error and exit code.
+func expectSame(t *testing.T, source string) {
+	t.Helper()
+	wantOut, wantErr, wantCode := run(t, source, false)
+	gotOut, gotErr, gotCode := run(t, source, true)
+	if gotOut != wantOut {
+		t.Errorf("output differs:\ninterpreter: %q\nvm:          %q", wantOut, gotOut)
+	}
+	if gotErr != wantErr {
+		t.Errorf("error differs:\ninterpreter: %q\nvm:          %q", wantErr, gotErr)
+	}
+	if gotCode != wantCode {
+		t.Errorf("exit code differs: interpreter %d, vm %d", wantCode, gotCode)
+	}
+}
+
+func TestMatchesInterpreter(t *testing.T) {
+	programs := map[string]string{
+		"arithmetic": `
+print(1 + 2 * 3, 7 / 2, 7.0 / 2, 7 % 3, -4, !true, "a" + 1)
+print(1 < 2, 2 <= 1, 1 == 1.0, "x" != "y", null || "default", 0 && 1)
+print(true ? "yes" : "no", ` + "`sum=${1 + 2}!`" + `)`,
+		"unicode strings": `
+var s = "héllo 世界"
+print(len(s), s.length, s[1], s[6], s.slice(6), s.codePointAt(7), fromCodePoint(0x4E16))
+for (var c of "añ") { print(c) }`,
+		"strict equality": `
+print(1 == 1.0, 1 === 1.0, 1 !== 1.0, "a" === "a", 2 !== 2)`,
+		"map literals": `
+var x = 1
+var k = "key"
+print({ x, y: 2, "z w": 3, [k + "s"]: 4 }, { a: 1 }.a)`,
+		"sets": `
+var s = set([3, 1, 3, 1.0]).add(2)
+print(s, s.size(), s.has(1), s.delete(3), s.union(set([9])), s.intersection(set([2])))
+for (var x of s) { print(x) }`,
+		"map methods": `
+var m = {a: 1, b: 2, c: 3}
+print(m.has("a"), m.has("z"), m.get("z", 0), m.delete("b"), m.delete("b"), m)
+print(m.entries(), m.merge({c: 30, d: 4}), m)`,
+		"array helpers": `
+var a = [1, 2, 3, 4, 5]
+print(a.splice(1, 2, "x"), a.shift(), a.unshift(0), a.insert(-1, "i"), a)
+print([1, 2, 3, 4].fill(0, 1, -1), [1, 2].flatMap((x) => [x, x * 10]), [1, 2, 1].lastIndexOf(1))
+print([1, [2, [3, [4]]]].flat(), [1, [2, [3, [4]]]].flat(2), [1, [2, [3, [4]]]].flat(-1), [[1, [2]]].flatDeep())
+print([1, 2, 3].findIndex((x) => x > 1), [1, 2, 3].every((x) => x > 0), [1, 2, 3].some((x) => x > 2), [1, 2, 3, 4].count((x) => x % 2 == 0))`,
+		"clone": `
+var a = {list: [1, [2, 3]], s: set([1])}
+var b = clone(a)
+b.list[1].push(4)
+print(a, b, deepEquals(a, b), deepEquals(a, clone(a)), deepEquals([1, 2.0], [1, 2]))`,
+		"math": `
+print(Math.sqrt(16), Math.pow(2, 10), Math.abs(-3), Math.floor(2.7), Math.round(-2.5), Math.max([1, 5.5, 2]), Math.PI)`,
+		"json": `
+var v = jsonParse("{\"a\": [1, 2.5, null], \"b\": {}}")
+print(v, jsonStringify(v), jsonStringify({x: [1, set([2])], y: 1.0}, 1))`,
+		"exit": `
+setTimeout(() => print("dropped"), 0)
+for (var k = 0; k < 10; k += 1) {
+  if (k == 2) { exit(4) }
+  print(k, env("LIGHT_NO_SUCH_VAR"), args())
+}
+print("unreachable")`,
+		"time": `
+var ts = time.parse("2006-01-02", "2024-03-01")
+print(time.format(ts, "Jan 2, 2006"), time.date(ts).weekday, time.monotonic() >= 0)`,
+		"format": `
+print(format("%-5s|%3d|%.2f|%v", "ab", 7, 1.005, {a: 1}), "%x".format(255))`,
+		"number conversion": `
+print(toInt("7") + 1, toFloat("2.5"), parseInt("ff", 16), parseFloat("x", null), isNaN(1), isFinite(1.5))`,
+		"char utilities": `
+print(ord("a"), chr(98), "héllo".chars(), "hé".bytes(), "abc".reverse(), "5".padStart(3, "0"), "a".padEnd(3, "-"), "aXa".lastIndexOf("a"))`,
+		"sort helpers": `
+var words = ["pear", "fig", "apple", "kiwi"]
+print(words.sorted(), words, words.sortBy((w) => [len(w), w]), words.sortDesc())`,
+		"range": `
+var total = 0
+for (var k of range(100000)) { total += k }
+for (var idx, v of range(10, 0, -4)) { print(idx, v) }
+print(total, range(3), len(range(1, 10, 2)), range(4).map((x) => x * 2))`,
+		"channels": `
+var ch = channel(3)
+ch.send([1])
+ch.send("two")
+ch.close()
+print(ch.recv(), select([ch]), ch.recv(), select([channel()], 1))`,
+		"promises": `
+delay(30, 2).then((v) => print("then", v * 21))
+Promise.all([delay(1, "a"), "b"]).then((vs) => print(vs))
+fs.readFileAsync("/no/such/file").then(null, (e) => print("caught", e.message.startsWith("fs.readFileAsync():")))`,
+		"bitwise": `
+print(2 ** 10, 2 ** -1, -2 ** 2, 6 & 3, 6 | 3, 6 ^ 3, ~5, 1 << 4, -16 >> 2)`,
+		"recursion": `
+function fib(n) {
+    if (n < 2) { return n }
+    return fib(n - 1) + fib(n - 2)
+}
+print(fib(20))`,
+		"closures": `
+function counter() {
+    var count = 0
+    return function() {
+        count += 1
+        return count
+    }
+}
+var a = counter()
+var b = counter()
+a()
+a()
+print(a(), b())
+function adder(x) { return function(y) { return x + y } }
+print(adder(2)(3))`,
+		"loop closures": `
+var fns = []
+for (var i = 0; i < 3; i += 1) {
+    var j = i * 10
+    fns.push(function() { return i + j })
+}
+for (var fn of fns) { print(fn()) }`,
+		"mutual recursion": `
+function parity(n) {
+    function isEven(k) { if (k == 0) { return true } return isOdd(k - 1) }
+    function isOdd(k) { if (k == 0) { return false } return isEven(k - 1) }
+    return isEven(n)
+}
+print(parity(10), parity(7))`,
+		"loops": `
+var n = 0
+var log = []
+while (true) {
+    n += 1
+    if (n % 2 == 0) { continue }
+    if (n > 7) { break }
+    log.push(n)
+}
+print(log)
+var xs = [1, 2, 3]
+var m = {n: 7}
+function at() { n += 1; return 1 }
+xs[at()] **= 3
+m.n <<= 2
+xs[0] |= 6
+print(xs, m, n)
+var order = []
+function t(name, v) { order.push(name); return v }
+t("xs", xs)[t("idx", 2)] += t("rhs", 1)
+t("m", m).n -= t("rhs", 8)
+print(order, xs, m)
+var p = 1
+var q = 2
+p, q = q, p
+p = m.n = xs[1] = (q += 10)
+print(p, q, m, xs, (m.n *= 2), (xs[0] -= 1), m, xs)
+for (var i = 0; i < 3; i += 1) {
+    for (var k of ["a", "b", "c"]) {
+        if (k == "b") { continue }
+        if (i == 2) { break }
+        print(i, k)
+    }
+}`,
+		"bind": `
+function add(a, b) { return a + b }
+var inc = add.bind(null, 1)
+var log = print.bind(null, "log:")
+log(inc(41), [1, 2].map(inc), inc)`,
+		"function methods": `
+function add(a, b) { return a + b }
+function sum(first, ...rest) { return first + rest.length }
+var dispatch = {add: add, sum: sum, pair: (x, y) => [x, y]}
+for (var name of keys(dispatch)) {
+    var fn = dispatch[name]
+    print(name, fn.name, fn.arity, fn.apply([4, 5, 6].slice(0, fn.arity)), fn.call(2, 3))
+}
+print(print.arity, add.bind(null, 1).arity, curry(sum)(1))`,
+		"assignment in expressions": `
+var lines = ["a", "b", null]
+var line
+var at = 0
+function next() { at += 1; return lines[at - 1] }
+while (line = next()) { print(line) }
+function twice(v) { return v * 2 }
+var k
+var q
+var w = q = 5
+if (k = 3) { print(twice(k = 4), k, w, q) }`,
+		"shadowed builtins": `
+var set = [1, 2]
+function count() { return len(set) }
+print(set, count())`,
+		"per-iteration loop variables": `
+var callbacks = []
+for (var i = 0; i < 3; i += 1) {
+    if (i == 1) { continue }
+    callbacks.push(function() { return i })
+}
+function counters() {
+    var fs = []
+    for (var k = 0; k < 2; k += 1) { fs.push(() => { k += 10; return k }) }
+    return fs
+}
+var cs = counters()
+print(callbacks.map((f) => f()), cs[0](), cs[0](), cs[1]())`,
+		"collections": `
+var m = {name: "light", tags: ["a", "b"]}
+m.version = 2
+m["extra"] = true
+for (var key of m) { print(key, m[key]) }
+for (var key, value of m) { print(key, value) }
+for (var idx, ch of "né") { print(idx, ch) }
+for (var idx, tag of m.tags) {
+    if (idx > 0) { break }
+    print(idx, tag)
+}
+var arr = [3, 1, 2]
+arr[0] = 4
+print(arr.map(function(x) { return x * 2 }), arr.filter(function(x) { return x > 1 }), arr.length)
+var first, second = ["x", "y"]
+print(first, second, "abc"[1], len(arr))`,
+		"globals from functions": `
+var total = 0
+function add(n) { total = total + n }
+add(2)
+add(3)
+print(total)
+function later() { return defined }
+var defined = "ok"
+print(later())`,
+		"rest parameters": `
+function join(sep, ...parts) { return parts.join(sep) }
+var pair = (first, ...rest) => [first, rest]
+print(join("-"), join("-", "a", "b"), pair(1), pair(1, 2, 3))
+print(memoize(join)("+", "x", "y"))`,
+		"null coalescing": `
+var none = null
+var calls = 0
+function side() { calls += 1; return "side" }
+print(none ?? "default", 0 ?? 1, false ?? side(), none ?? side(), calls)`,
+		"builtin callbacks": `
+var calls = 0
+var slowSquare = memoize(function(n) { calls += 1; return n * n })
+print(slowSquare(4), slowSquare(4), calls)
+var add3 = curry(function(a, b, c) { return a + b + c })
+print(add3(1)(2)(3), pipe(function(x) { return x + 1 }, function(x) { return x * 10 })(1))
+setTimeout(function() { print("timer") }, 0)
+print("before timer")`,
+	}
+	for name, source := range programs {
+		t.Run(name, func(t *testing.T) { expectSame(t, source) })
+	}
+}
+
+func TestErrorsMatchInterpreter(t *testing.T) {
+	programs := []string{
+		"print(missing)",
+		"function f(a) {}\nf(1, 2)",
+		"var x = 1\nx.y = 2",
+		"print([1, 2][5])",
+		`print(1 + true)`,
+		"const c = 1\nfunction g() { c = 2 }\ng()",
+		"var a, b = [1]",
+		"for (var x of 5) {}",
+		"for (var k, v of true) {}",
+		"print(-\"s\")",
+		"var v = 1\nvar v = 2",
+		"[1].nope()",
+		"var n = 1\nprint(n << 64)",
+		"var n = 3\nn <<= 62",
+		"print({ [1]: 2 })",
+		"function f() { return g() }\nfunction g() { return f(1) }\nf()",
+		"function f(a, ...b) {}\nf()",
+		"return 3",
+		`return "done"`,
+		"print(1)\nassertEquals([1, 2], [1, 3], \"pair\")",
+		"function f(x) { assert(x > 0) }\nf(-1)",
+		"var big = 9223372036854775807\nprint(big + 1)",
+		"var m = -9223372036854775807 - 1\nprint(-m)",
+		"const xs = freeze([1, [2]])\nxs[1][0] = 3",
+		"var o = freeze({n: 1})\no.n += 1",
+		"freeze([2, 1]).sort()",
+	}
+	for _, source := range programs {
+		expectSame(t, source)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err, _ := run(t, "function f(n) { return f(n + 1) }\nf(0)", true)
+	if err != "runtime error at 1:24: stack overflow" {
+		t.Errorf("got %q", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		name, source string
+		limits       runtime.Limits
+		want         string
+	}{
+		{"timeout", "while (true) {}", runtime.Limits{Timeout: 50 * time.Millisecond}, "timeout of 50ms exceeded"},
+		{"steps", "var n = 0\nwhile (true) { n += 1 }", runtime.Limits{MaxSteps: 100}, "step limit of 100 exceeded"},
+		{"depth", "function f(n) { return f(n + 1) }\nf(0)", runtime.Limits{MaxCallDepth: 50}, "runtime error at 1:24: call depth limit of 50 exceeded"},
+		{"depth ok", "function f(n) { return n == 0 ? 0 : f(n - 1) }\nprint(f(49))", runtime.Limits{MaxCallDepth: 50}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, _ := lexer.New(tc.source, "test.lt").Tokenize()
+			file, _ := parser.New(tokens).ParseFile()
+			bc, err := compiler.Compile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			interp := runtime.NewInterpreter(&bytes.Buffer{})
+			interp.SetLimits(tc.limits)
+			err = New(bc, interp).Run()
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+// TestGolden runs the golden programs that use only what the compiler
+// supports and compares their output to the interpreter's expected output.
+func TestGolden(t *testing.T) {
+	for _, name := range []string{"golden_array", "golden_for", "golden_stdlib"} {
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(filepath.Join("..", "..", "testdata", name+".lt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := os.ReadFile(filepath.Join("..", "..", "testdata", name+".expected"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, msg, _ := run(t, string(source), true)
+			if msg != "" {
+				t.Fatalf("error: %s", msg)
+			}
+			if strings.TrimRight(out, "\n") != strings.TrimRight(string(expected), "\n") {
+				t.Errorf("output differs from %s.expected:\n%s", name, out)
+			}
+		})
+	}
+}
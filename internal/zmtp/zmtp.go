@@ -0,0 +1,375 @@
+// Package zmtp implements the subset of ZMTP 3.0 (the ZeroMQ wire protocol)
+// needed to talk to ZeroMQ peers over TCP without linking libzmq: the NULL
+// security mechanism, multipart messages, and listening sockets that either
+// reply to the sending peer or publish to every peer.
+package zmtp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Frame flag bits.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// greetingSize is the fixed size of the ZMTP 3.x greeting.
+const greetingSize = 64
+
+// maxFrameSize guards against absurd length prefixes from a broken peer.
+const maxFrameSize = 1 << 30
+
+// Conn is a single ZMTP connection that has completed its handshake.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	wmu  sync.Mutex
+
+	// PeerType is the socket type the peer announced in its READY command.
+	PeerType string
+}
+
+// Dial connects to addr and performs the handshake as socketType.
+func Dial(addr, socketType string) (*Conn, error) {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := handshake(nc, socketType, false)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake exchanges greetings and READY commands.
+func handshake(nc net.Conn, socketType string, asServer bool) (*Conn, error) {
+	c := &Conn{conn: nc, r: bufio.NewReader(nc)}
+
+	greeting := make([]byte, greetingSize)
+	greeting[0] = 0xFF
+	greeting[9] = 0x7F
+	greeting[10] = 3 // version 3.0
+	greeting[11] = 0
+	copy(greeting[12:32], "NULL")
+	if asServer {
+		greeting[32] = 1
+	}
+	if _, err := nc.Write(greeting); err != nil {
+		return nil, err
+	}
+
+	peer := make([]byte, greetingSize)
+	if _, err := io.ReadFull(c.r, peer); err != nil {
+		return nil, fmt.Errorf("zmtp: reading greeting: %w", err)
+	}
+	if peer[0] != 0xFF || peer[9]&0x01 != 0x01 {
+		return nil, errors.New("zmtp: peer is not speaking ZMTP")
+	}
+	if peer[10] < 3 {
+		return nil, fmt.Errorf("zmtp: unsupported peer version %d.%d", peer[10], peer[11])
+	}
+	if mech := string(bytes.TrimRight(peer[12:32], "\x00")); mech != "NULL" {
+		return nil, fmt.Errorf("zmtp: unsupported security mechanism %q", mech)
+	}
+
+	if err := c.writeFrame(readyCommand(socketType), flagCommand); err != nil {
+		return nil, err
+	}
+	body, flags, err := c.readFrame()
+	if err != nil {
+		return nil, fmt.Errorf("zmtp: reading READY: %w", err)
+	}
+	if flags&flagCommand == 0 {
+		return nil, errors.New("zmtp: expected READY command")
+	}
+	name, props, err := parseCommand(body)
+	if err != nil {
+		return nil, err
+	}
+	if name != "READY" {
+		return nil, fmt.Errorf("zmtp: expected READY, got %s", name)
+	}
+	c.PeerType = props["Socket-Type"]
+	return c, nil
+}
+
+// readyCommand encodes a READY command announcing socketType.
+func readyCommand(socketType string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(5)
+	b.WriteString("READY")
+	writeProperty(&b, "Socket-Type", socketType)
+	return b.Bytes()
+}
+
+func writeProperty(b *bytes.Buffer, name, value string) {
+	b.WriteByte(byte(len(name)))
+	b.WriteString(name)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(value)))
+	b.Write(size[:])
+	b.WriteString(value)
+}
+
+// parseCommand splits a command body into its name and metadata properties.
+func parseCommand(body []byte) (string, map[string]string, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("zmtp: malformed command")
+	}
+	name := string(body[1 : 1+body[0]])
+	rest := body[1+body[0]:]
+	props := map[string]string{}
+	if name != "READY" {
+		return name, props, nil
+	}
+	for len(rest) > 0 {
+		n := int(rest[0])
+		if len(rest) < 1+n+4 {
+			return "", nil, errors.New("zmtp: malformed property")
+		}
+		key := string(rest[1 : 1+n])
+		size := int(binary.BigEndian.Uint32(rest[1+n:]))
+		rest = rest[1+n+4:]
+		if len(rest) < size {
+			return "", nil, errors.New("zmtp: malformed property value")
+		}
+		props[key] = string(rest[:size])
+		rest = rest[size:]
+	}
+	return name, props, nil
+}
+
+func (c *Conn) readFrame() ([]byte, byte, error) {
+	flags, err := c.r.ReadByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		var buf [8]byte
+		if _, err := io.ReadFull(c.r, buf[:]); err != nil {
+			return nil, 0, err
+		}
+		size = binary.BigEndian.Uint64(buf[:])
+	} else {
+		n, err := c.r.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		size = uint64(n)
+	}
+	if size > maxFrameSize {
+		return nil, 0, fmt.Errorf("zmtp: frame of %d bytes is too large", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, 0, err
+	}
+	return body, flags, nil
+}
+
+// writeFrame writes one frame; callers hold wmu when writing multipart messages.
+func (c *Conn) writeFrame(body []byte, flags byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = make([]byte, 9)
+		header[0] = flags | flagLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(body)
+	return err
+}
+
+// ReadMessage reads the next multipart message, skipping commands.
+func (c *Conn) ReadMessage() ([][]byte, error) {
+	var frames [][]byte
+	for {
+		body, flags, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			continue // PING, SUBSCRIBE and friends are not needed here
+		}
+		frames = append(frames, body)
+		if flags&flagMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+// WriteMessage writes a multipart message atomically with respect to other writers.
+func (c *Conn) WriteMessage(frames [][]byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for idx, frame := range frames {
+		var flags byte
+		if idx < len(frames)-1 {
+			flags = flagMore
+		}
+		if err := c.writeFrame(frame, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Message is a multipart message received by a Socket, along with the
+// connection it arrived on so that a reply can be routed back.
+type Message struct {
+	Frames [][]byte
+	From   *Conn
+}
+
+// Socket accepts ZMTP connections on a TCP address. Incoming messages from
+// all peers are delivered through Recv; Reply answers a single peer and
+// Publish broadcasts to every peer.
+type Socket struct {
+	socketType string
+	ln         net.Listener
+	incoming   chan Message
+	done       chan struct{}
+
+	mu    sync.Mutex
+	peers map[*Conn]bool
+}
+
+// Listen starts a socket of the given ZeroMQ type ("ROUTER", "PUB", "REP", ...).
+func Listen(socketType, addr string) (*Socket, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{
+		socketType: socketType,
+		ln:         ln,
+		incoming:   make(chan Message, 64),
+		done:       make(chan struct{}),
+		peers:      make(map[*Conn]bool),
+	}
+	go s.acceptLoop()
+	return s, nil
+}
+
+// Addr returns the listening address.
+func (s *Socket) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *Socket) acceptLoop() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.servePeer(nc)
+	}
+}
+
+func (s *Socket) servePeer(nc net.Conn) {
+	c, err := handshake(nc, s.socketType, true)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	s.mu.Lock()
+	s.peers[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.peers, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	for {
+		frames, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if s.socketType == "PUB" {
+			continue // subscriptions are ignored: everything is published to everyone
+		}
+		select {
+		case s.incoming <- Message{Frames: frames, From: c}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Recv returns the next incoming message. ok is false once the socket is closed.
+func (s *Socket) Recv() (msg Message, ok bool) {
+	select {
+	case msg = <-s.incoming:
+		return msg, true
+	case <-s.done:
+		return Message{}, false
+	}
+}
+
+// Reply sends frames back to the peer msg came from.
+func (s *Socket) Reply(msg Message, frames [][]byte) error {
+	return msg.From.WriteMessage(frames)
+}
+
+// Publish sends frames to every connected peer. Peers that fail are dropped.
+func (s *Socket) Publish(frames [][]byte) {
+	s.mu.Lock()
+	peers := make([]*Conn, 0, len(s.peers))
+	for c := range s.peers {
+		peers = append(peers, c)
+	}
+	s.mu.Unlock()
+	for _, c := range peers {
+		if err := c.WriteMessage(frames); err != nil {
+			c.Close()
+		}
+	}
+}
+
+// Peers reports how many peers have completed the handshake.
+func (s *Socket) Peers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.peers)
+}
+
+// Close stops accepting connections and closes all peers.
+func (s *Socket) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.peers {
+		c.Close()
+	}
+	s.mu.Unlock()
+	return err
+}
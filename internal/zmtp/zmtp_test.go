@@ -0,0 +1,47 @@
+package zmtp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReplyRoundTrip(t *testing.T) {
+	sock, err := Listen("ROUTER", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+
+	client, err := Dial(sock.Addr().String(), "DEALER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if client.PeerType != "ROUTER" {
+		t.Errorf("expected peer type ROUTER, got %q", client.PeerType)
+	}
+
+	long := []byte(strings.Repeat("x", 1000)) // exercises the 8-byte length form
+	if err := client.WriteMessage([][]byte{[]byte("hello"), {}, long}); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := sock.Recv()
+	if !ok {
+		t.Fatal("socket closed")
+	}
+	if len(msg.Frames) != 3 || string(msg.Frames[0]) != "hello" || len(msg.Frames[1]) != 0 || !bytes.Equal(msg.Frames[2], long) {
+		t.Fatalf("unexpected frames: %q", msg.Frames)
+	}
+
+	if err := sock.Reply(msg, [][]byte{[]byte("world")}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply) != 1 || string(reply[0]) != "world" {
+		t.Errorf("unexpected reply: %q", reply)
+	}
+}
@@ -0,0 +1,93 @@
+// Package light is the public Go API of light-lang.
+//
+// Go programs can ship light-lang scripts inside their binary with go:embed
+// and run them with RunEmbedded; `light embed` generates such a host:
+//
+//	//go:embed scripts
+//	var scripts embed.FS
+//
+//	func main() {
+//		if err := light.RunEmbedded(scripts, "scripts/main.lt"); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// Native extensions import it to register builtins without depending on the
+// internal packages. An extension is a Go plugin exporting Register:
+//
+//	package main
+//
+//	import "light-lang/pkg/light"
+//
+//	func Register(env *light.Environment) {
+//		env.Define("double", &light.BuiltinVal{
+//			Name: "double",
+//			Fn: func(args []light.Value) (light.Value, error) {
+//				return args[0].(light.IntVal) * 2, nil
+//			},
+//		}, true)
+//	}
+//
+// Build it with `go build -buildmode=plugin -o ext.so` using the same Go
+// toolchain and light-lang sources as the light binary, then load it with
+// `light run main.lt --plugin ext.so` or `import native "ext"`.
+package light
+
+import (
+	"io"
+	"io/fs"
+	"light-lang/internal/runtime"
+	"os"
+)
+
+// Environment is a variable scope.
+type Environment = runtime.Environment
+
+// Value is any light-lang runtime value.
+type Value = runtime.Value
+
+// Value types.
+type (
+	IntVal     = runtime.IntVal
+	FloatVal   = runtime.FloatVal
+	StringVal  = runtime.StringVal
+	BoolVal    = runtime.BoolVal
+	NullVal    = runtime.NullVal
+	ArrayVal   = runtime.ArrayVal
+	MapVal     = runtime.MapVal
+	BuiltinVal = runtime.BuiltinVal
+	BuiltinFn  = runtime.BuiltinFn
+)
+
+// RegisterFunc is the signature of a native extension's Register symbol.
+type RegisterFunc = func(env *Environment)
+
+// RegisterSymbol is the name of the symbol a native extension must export.
+const RegisterSymbol = runtime.NativeRegisterSymbol
+
+// Interpreter runs light-lang programs.
+type Interpreter = runtime.Interpreter
+
+// Limits bounds the work a script may do; see Interpreter.SetLimits.
+type Limits = runtime.Limits
+
+// Option configures an interpreter made by NewInterpreter.
+type Option = runtime.Option
+
+// WithLimits makes NewInterpreter apply l, so untrusted scripts cannot
+// loop, recurse or allocate without bound.
+func WithLimits(l Limits) Option {
+	return runtime.WithLimits(l)
+}
+
+// NewInterpreter creates an interpreter that prints to w.
+func NewInterpreter(w io.Writer, opts ...Option) *Interpreter {
+	return runtime.NewInterpreter(w, opts...)
+}
+
+// RunEmbedded runs the script entry from fsys, printing to standard output.
+// Imports in the script and its modules resolve within fsys, so a Go binary
+// with embedded sources needs no files on disk.
+func RunEmbedded(fsys fs.FS, entry string) error {
+	return runtime.NewInterpreter(os.Stdout).RunFS(fsys, entry)
+}